@@ -10,6 +10,7 @@ import (
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 	"net/http"
+	"time"
 )
 
 // Protocol message types
@@ -322,6 +323,9 @@ func DecideOnProposal(p ProtocolHandler,
 			// compatible with the producer's policy.
 		} else if err := policy.Are_Compatible(producerPolicy, termsAndConditions, nil); err != nil {
 			replyErr = errors.New(fmt.Sprintf("Protocol %v decide on proposal received error, T and C policy is not compatible, rejecting proposal: %v", p.Name(), err))
+			// The node does not accept agreements outside of the maintenance window published in its node policy.
+		} else if err := checkNodeMaintenanceWindow(nodePolicy, time.Now()); err != nil {
+			replyErr = errors.New(fmt.Sprintf("Protocol %v decide on proposal received error, rejecting proposal: %v", p.Name(), err))
 		} else if err := p.PolicyManager().FinalAgreement(policies, proposal.AgreementId(), myOrg); err != nil {
 			replyErr = errors.New(fmt.Sprintf("Protocol %v decide on proposal received error, unable to record agreement state in PM: %v", p.Name(), err))
 		} else {
@@ -570,6 +574,24 @@ func DemarshalProposal(proposal string) (Proposal, error) {
 
 }
 
+// Returns an error if the node publishes a maintenance window that is closed at the given time.
+func checkNodeMaintenanceWindow(nodePol *externalpolicy.ExternalPolicy, now time.Time) error {
+	if nodePol == nil {
+		return nil
+	} else if sched, err := externalpolicy.GetNodeMaintenanceWindow(nodePol.Properties); err != nil {
+		// The node policy is validated when it is set, so this should not happen. Do not let it block agreements.
+		glog.Warningf(fmt.Sprintf("ignoring node maintenance window, error: %v", err))
+		return nil
+	} else if !sched.AgreementsAllowed(now) {
+		next := sched.NextAgreementWindow(now)
+		if next.IsZero() {
+			return errors.New("outside of the node maintenance window, no window opens within a year")
+		}
+		return errors.New(fmt.Sprintf("outside of the node maintenance window, the next window opens at %v", next.Format(time.RFC3339)))
+	}
+	return nil
+}
+
 // Adds node built-in properties to the producer policy.
 // It will get node's CPU count, available memory and arch and add them to
 // the producer policy that was used to make the proposal on agbot.
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/abstractprotocol"
+	"github.com/open-horizon/anax/agreementbot/archive"
 	"github.com/open-horizon/anax/agreementbot/persistence"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
@@ -30,6 +31,9 @@ const GOVERN_ARCHIVED_AGREEMENTS = "AgBotGovernArchivedAgreements"
 const POLICY_WATCHER = "AgBotPolicyWatcher"
 const STALE_PARTITIONS = "AgbotStaleDatabasePartition"
 const MESSAGE_KEY_CHECK = "AgbotMessageKeyCheck"
+const PARTITION_REBALANCE = "AgbotPartitionRebalance"
+const LEADER_ELECTION = "AgbotLeaderElection"
+const PURGE_ORPHANED_PARTITIONS = "AgbotPurgeOrphanedPartitions"
 
 // Agreement governance timing state. Used in the GovernAgreements subworker.
 type DVState struct {
@@ -40,6 +44,9 @@ type DVState struct {
 //package level variable
 var patternManager *PatternManager
 var businessPolManager *BusinessPolicyManager
+var maintenanceQueue *MaintenanceQueue
+var consumerPHManager *ConsumerPHMgr
+var leaderElection *LeaderElection
 
 // must be safely-constructed!!
 type AgreementBotWorker struct {
@@ -53,8 +60,11 @@ type AgreementBotWorker struct {
 	GovTiming         DVState
 	shutdownStarted   bool
 	MMSObjectPM       *MMSObjectPolicyManager
-	noworkDispatch    int64       // The last time the NoWorkHandler was dispatched.
-	nodeSearch        *NodeSearch // The object that controls node searches and the state of search sessions.
+	noworkDispatch    int64               // The last time the NoWorkHandler was dispatched.
+	nodeSearch        *NodeSearch         // The object that controls node searches and the state of search sessions.
+	archiveSink       archive.ArchiveSink // Receives a copy of archived agreements before they are purged, nil if not configured.
+	leader            *LeaderElection     // Decides whether this agbot runs the singleton duties.
+	purgeOrphans      func() bool         // This agbot purges the archived agreements of the partitions that no live agbot owns.
 }
 
 func NewAgreementBotWorker(name string, cfg *config.HorizonConfig, db persistence.AgbotDatabase) *AgreementBotWorker {
@@ -73,9 +83,14 @@ func NewAgreementBotWorker(name string, cfg *config.HorizonConfig, db persistenc
 		shutdownStarted: false,
 		noworkDispatch:  time.Now().Unix(),
 		nodeSearch:      NewNodeSearch(),
+		leader:          NewLeaderElection(db, cfg.GetLeaderLeaseS()),
 	}
 
 	patternManager = NewPatternManager()
+	maintenanceQueue = NewMaintenanceQueue()
+	consumerPHManager = worker.consumerPH
+	leaderElection = worker.leader
+	worker.registerMetrics()
 
 	glog.Info("Starting AgreementBot worker")
 	worker.Start(worker, int(cfg.AgreementBot.NewContractIntervalS))
@@ -293,13 +308,27 @@ func (w *AgreementBotWorker) Initialize() bool {
 		return w.fail()
 	}
 
+	// Initialize the sink that keeps a copy of archived agreements after they are purged from the database, if one is configured.
+	if sink, err := archive.InitArchiveSink(w.Config); err != nil {
+		glog.Errorf("AgreementBotWorker unable to initialize archive sink, terminating, error: %v", err)
+		return w.fail()
+	} else {
+		w.archiveSink = sink
+	}
+
 	// Start the go thread that heartbeats to the database.
 	w.DispatchSubworker(DATABASE_HEARTBEAT, w.databaseHeartBeat, int(w.BaseWorker.Manager.Config.GetPartitionStale()/3), false)
 
+	// Find out if this agbot is the leader of the agbots sharing the database, and start the go thread that keeps the
+	// lease renewed or takes over when the leader stops.
+	w.leader.Campaign()
+	w.DispatchSubworker(LEADER_ELECTION, w.leader.Campaign, w.leader.RenewInterval(), false)
+
 	// Give the policy manager a chance to read in all the policies. The agbot worker will not proceed past this point
 	// until it has some policies to work with.
 	businessPolManager = NewBusinessPolicyManager(w.Messages())
 	w.MMSObjectPM = NewMMSObjectPolicyManager(w.BaseWorker.Manager.Config)
+	w.MMSObjectPM.SetGarbageCollectionCheck(w.leader.Check(MMS_GARBAGE_COLLECTION))
 	for {
 
 		// Query the exchange for patterns that this agbot is supposed to serve and generate a policy for each one. If an error
@@ -366,14 +395,21 @@ func (w *AgreementBotWorker) Initialize() bool {
 	// Start the go thread that checks for stale partitions.
 	w.DispatchSubworker(STALE_PARTITIONS, w.stalePartitions, int(w.BaseWorker.Manager.Config.GetPartitionStale()), false)
 
+	// Start the go thread that rebalances agreements across the partitions of the agbots sharing the database.
+	w.DispatchSubworker(PARTITION_REBALANCE, w.rebalancePartitions, int(w.BaseWorker.Manager.Config.GetPartitionRebalanceS()), false)
+
+	// Start the go thread that dispatches the policy changes and upgrades that were waiting for a maintenance window.
+	w.DispatchSubworker(MAINTENANCE_DISPATCH, w.dispatchMaintenance, 60, false)
+
 	// The agbot worker is now ready to handle incoming messages
 	w.ready = true
 
 	// Start the governance routines using the subworker APIs.
 	w.DispatchSubworker(GOVERN_AGREEMENTS, w.GovernAgreements, int(w.BaseWorker.Manager.Config.AgreementBot.ProcessGovernanceIntervalS), false)
+	w.purgeOrphans = w.leader.Check(PURGE_ORPHANED_PARTITIONS)
 	w.DispatchSubworker(GOVERN_ARCHIVED_AGREEMENTS, w.GovernArchivedAgreements, 1800, false)
 	//w.DispatchSubworker(GOVERN_BC_NEEDS, w.GovernBlockchainNeeds, 60, false)
-	w.DispatchSubworker(MESSAGE_KEY_CHECK, w.messageKeyCheck, w.BaseWorker.Manager.Config.AgreementBot.MessageKeyCheck, false)
+	w.DispatchSubworker(MESSAGE_KEY_CHECK, w.leader.Singleton(MESSAGE_KEY_CHECK, w.messageKeyCheck), w.BaseWorker.Manager.Config.AgreementBot.MessageKeyCheck, false)
 
 	if w.Config.AgreementBot.CheckUpdatedPolicyS != 0 {
 		// Use custom subworker APIs for the policy watcher because it is stateful and already does its own time management.
@@ -426,11 +462,15 @@ func (w *AgreementBotWorker) CommandHandler(command worker.Command) bool {
 			}
 
 			// Send the policy change command to all protocol handlers just in case an agreement protocol was
-			// deleted from the new policy file.
-			for _, agp := range w.consumerPH.GetAll() {
-				// Queue the command to the relevant protocol handler for further processing.
-				if w.consumerPH.Get(agp).AcceptCommand(cmd) {
-					w.consumerPH.Get(agp).HandlePolicyChanged(cmd, w.consumerPH.Get(agp))
+			// deleted from the new policy file. Agreements are only cancelled because of the change during an upgrade
+			// window of the policy, otherwise the change is queued until the window opens. A newer change replaces it.
+			if w.upgradeAllowed(cmd, PENDING_POLICY_CHANGE, cmd.Msg.Org(), pol, "", "") {
+				maintenanceQueue.Remove(PENDING_POLICY_CHANGE, pol.Header.Name)
+				for _, agp := range w.consumerPH.GetAll() {
+					// Queue the command to the relevant protocol handler for further processing.
+					if w.consumerPH.Get(agp).AcceptCommand(cmd) {
+						w.consumerPH.Get(agp).HandlePolicyChanged(cmd, w.consumerPH.Get(agp))
+					}
 				}
 			}
 
@@ -451,6 +491,9 @@ func (w *AgreementBotWorker) CommandHandler(command worker.Command) bool {
 			w.pm.DeletePolicy(cmd.Msg.Org(), pol)
 			glog.V(5).Infof("AgreementBotWorker deleted policy from PM.")
 
+			// Forget the work that was waiting for a maintenance window of the policy.
+			maintenanceQueue.RemovePolicy(pol.Header.Name)
+
 			// Queue the command to the correct protocol worker pool(s) for further processing. The deleted policy
 			// might not contain a supported protocol, so we need to check that first.
 			for _, agp := range pol.AgreementProtocols {
@@ -502,6 +545,12 @@ func (w *AgreementBotWorker) CommandHandler(command worker.Command) bool {
 
 	case *WorkloadUpgradeCommand:
 		cmd, _ := command.(*WorkloadUpgradeCommand)
+
+		// The upgrade is only done during an upgrade window of the policy, otherwise it is queued until the window opens.
+		if org, pol := w.findUpgradePolicy(cmd.Msg.PolicyName); pol != nil && !w.upgradeAllowed(cmd, PENDING_UPGRADE, org, pol, cmd.Msg.DeviceId, cmd.Msg.AgreementId) {
+			break
+		}
+
 		// The workload upgrade request might not involve a specific agreement, so we can't know precisely which agreement
 		// protocol might be relevant. Therefore we will send this upgrade to all protocol worker pools.
 		for _, ch := range w.consumerPH.GetAll() {
@@ -703,9 +752,14 @@ func (w *AgreementBotWorker) NoWorkHandler() {
 			// Shutdown the subworkers.
 			w.TerminateSubworkers()
 
-			// Shutdown the database partition.
+			// Give up the leadership and shutdown the database partition.
+			w.leader.Resign()
 			w.db.QuiescePartition()
 
+			if w.archiveSink != nil {
+				w.archiveSink.Close()
+			}
+
 			w.Messages() <- events.NewNodeShutdownCompleteMessage(events.AGBOT_QUIESCE_COMPLETE, "")
 
 		}
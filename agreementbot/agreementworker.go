@@ -326,7 +326,8 @@ func (b *BaseAgreementWorker) AgreementLockManager() *AgreementLockManager {
 	return b.alm
 }
 
-func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler, wi *InitiateAgreement, random *rand.Rand, workerId string) {
+// Returns the id of the agreement when a proposal was sent to the node, otherwise an empty string.
+func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler, wi *InitiateAgreement, random *rand.Rand, workerId string) (proposedId string) {
 
 	// Generate an agreement ID
 	agreementIdString, aerr := cutil.GenerateAgreementId()
@@ -573,6 +574,15 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 					policy_match = true
 				} else {
 					glog.Warningf(BAWlogstring(workerId, fmt.Sprintf("failed matching node policy %v and %v, error: %v", wi.ProducerPolicy, wi.ConsumerPolicy, reason)))
+
+					// show which constraints are not satisfied, on the deployment side and on the node side
+					if glog.V(3) && consumPol != nil {
+						if trace, err := policy.Explain_Compatibility(nodePolicy, consumPol); err != nil {
+							glog.Warningf(BAWlogstring(workerId, fmt.Sprintf("unable to explain the policy incompatibility for node %v, error: %v", wi.Device.Id, err)))
+						} else {
+							glog.Infof(BAWlogstring(workerId, fmt.Sprintf("skipping node %v for policy %v, evaluation of the constraints:\n%v", wi.Device.Id, wi.ConsumerPolicy.Header.Name, trace)))
+						}
+					}
 				}
 			}
 		}
@@ -686,6 +696,12 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 		return
 	}
 
+	// If the node publishes a maintenance window that is closed, wait for the window to open.
+	if !nodeAgreementAllowed(wi.Org, wi.ConsumerPolicy.Header.Name, wi.Device.Id, &wi.ProducerPolicy) {
+		glog.V(3).Infof(BAWlogstring(workerId, fmt.Sprintf("skipping device %v, outside of its maintenance window", wi.Device.Id)))
+		return
+	}
+
 	// Create pending agreement in database
 	if err := b.db.AgreementAttempt(agreementIdString, wi.Org, wi.Device.Id, nodeType, wi.ConsumerPolicy.Header.Name, bcType, bcName, bcOrg, cph.Name(), wi.ConsumerPolicy.PatternId, svcIds, wi.ConsumerPolicy.NodeH); err != nil {
 		glog.Errorf(BAWlogstring(workerId, fmt.Sprintf("error persisting agreement attempt: %v", err)))
@@ -710,10 +726,14 @@ func (b *BaseAgreementWorker) InitiateNewAgreement(cph ConsumerProtocolHandler,
 		// TODO: Publish error on the message bus
 
 		// Update the agreement in the DB with the proposal and policy
-	} else if err := cph.PersistAgreement(wi, proposal, workerId); err != nil {
-		glog.Errorf(err.Error())
+	} else {
+		proposedId = agreementIdString
+		if err := cph.PersistAgreement(wi, proposal, workerId); err != nil {
+			glog.Errorf(err.Error())
+		}
 	}
 
+	return
 }
 
 // get the merged producer policy. asl is the spec list for the dependent services for a top level service.
@@ -803,6 +823,7 @@ func (b *BaseAgreementWorker) HandleAgreementReply(cph ConsumerProtocolHandler,
 		} else {
 			// Done handling the response successfully
 			ackReplyAsValid = true
+			observeProposalRoundTrip(cph.Name(), agreement)
 
 			// If we dont have a workload usage record for this device, then we need to create one. If there is already a
 			// workload usage record and workload rollback retry counting is enabled, then check to see if the workload priority
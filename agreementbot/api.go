@@ -10,11 +10,14 @@ import (
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/metrics"
 	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"io/ioutil"
 	"net/http"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -30,6 +33,7 @@ type API struct {
 	em             *events.EventStateManager
 	shutdownError  string
 	configFile     string
+	cancelPacer    *cancelPacer
 }
 
 func NewAPIListener(name string, config *config.HorizonConfig, db persistence.AgbotDatabase, configFile string) *API {
@@ -41,11 +45,12 @@ func NewAPIListener(name string, config *config.HorizonConfig, db persistence.Ag
 			Messages: messages,
 		},
 
-		name:       name,
-		db:         db,
-		EC:         worker.NewExchangeContext(config.AgreementBot.ExchangeId, config.AgreementBot.ExchangeToken, config.AgreementBot.ExchangeURL, config.GetAgbotCSSURL(), config.Collaborators.HTTPClientFactory),
-		em:         events.NewEventStateManager(),
-		configFile: configFile,
+		name:        name,
+		db:          db,
+		EC:          worker.NewExchangeContext(config.AgreementBot.ExchangeId, config.AgreementBot.ExchangeToken, config.AgreementBot.ExchangeURL, config.GetAgbotCSSURL(), config.Collaborators.HTTPClientFactory),
+		em:          events.NewEventStateManager(),
+		configFile:  configFile,
+		cancelPacer: newCancelPacer(config.GetBulkCancelPerMinute()),
 	}
 
 	listener.listen(config.AgreementBot.APIListen)
@@ -323,8 +328,15 @@ func (a *API) listen(apiListen string) {
 		router := mux.NewRouter()
 
 		router.HandleFunc("/agreement", a.agreement).Methods("GET", "OPTIONS")
+		router.HandleFunc("/agreement/events", a.agreementEvents).Methods("GET", "OPTIONS")
+		router.HandleFunc("/agreement/cancel", a.agreementCancel).Methods("POST", "OPTIONS")
 		router.HandleFunc("/agreement/{id}", a.agreement).Methods("GET", "DELETE", "OPTIONS")
 		router.HandleFunc("/partition", a.partition).Methods("GET", "OPTIONS")
+		router.HandleFunc("/partition/moves", a.partitionMoves).Methods("GET", "OPTIONS")
+		router.HandleFunc("/rollout", a.rollout).Methods("GET", "OPTIONS")
+		router.HandleFunc("/maintenance", a.maintenance).Methods("GET", "OPTIONS")
+		router.HandleFunc("/db/export", a.dbexport).Methods("GET", "OPTIONS")
+		router.HandleFunc("/db/import", a.dbimport).Methods("POST", "OPTIONS")
 		router.HandleFunc("/policy", a.policy).Methods("GET", "OPTIONS")
 		router.HandleFunc("/policy/{org}", a.policy).Methods("GET", "OPTIONS")
 		router.HandleFunc("/policy/{org}/{name}", a.policy).Methods("GET", "OPTIONS")
@@ -333,6 +345,7 @@ func (a *API) listen(apiListen string) {
 		router.HandleFunc("/status", a.status).Methods("GET", "OPTIONS")
 		router.HandleFunc("/health", a.health).Methods("GET", "OPTIONS")
 		router.HandleFunc("/status/workers", a.workerstatus).Methods("GET", "OPTIONS")
+		router.HandleFunc("/metrics", a.metrics).Methods("GET", "OPTIONS")
 		router.HandleFunc("/node", a.node).Methods("GET", "DELETE", "OPTIONS")
 		router.HandleFunc("/config", a.config).Methods("GET", "OPTIONS")
 		router.HandleFunc("/cache/servedorg", a.ListServedOrgs).Methods("GET", "OPTIONS")
@@ -418,16 +431,10 @@ func (a *API) agreement(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusInternalServerError)
 		} else if ag == nil {
 			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "id", Error: "agreement id not found"})
+		} else if _, err := a.cancelAgreement(ag.CurrentAgreementId, ag.AgreementProtocol); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding agreement %v, error: %v", id, err)))
+			w.WriteHeader(http.StatusInternalServerError)
 		} else {
-			if ag.AgreementTimedout == 0 {
-				// Update the database
-				if _, err := a.db.AgreementTimedout(ag.CurrentAgreementId, ag.AgreementProtocol); err != nil {
-					glog.Errorf(APIlogString(fmt.Sprintf("error marking agreement %v terminated: %v", ag.CurrentAgreementId, err)))
-				}
-				a.Messages() <- events.NewABApiAgreementCancelationMessage(events.AGREEMENT_ENDED, ag.AgreementProtocol, ag.CurrentAgreementId)
-			} else {
-				glog.V(3).Infof(APIlogString(fmt.Sprintf("agreement %v not deleted, already timed out at %v", id, ag.AgreementTimedout)))
-			}
 			w.WriteHeader(http.StatusOK)
 		}
 
@@ -625,7 +632,15 @@ func (a *API) status(w http.ResponseWriter, r *http.Request) {
 		}
 		info.LiveHealth = health
 
-		writeResponse(w, info, http.StatusOK)
+		agbotInfo := &AgbotInfo{Info: info}
+		if agbotInfo.DatabaseSchema, err = a.db.GetSchemaStatus(); err != nil {
+			glog.Errorf(APIlogString(fmt.Sprintf("Unable to get DB schema status, error: %v", err)))
+		}
+		if leaderElection != nil {
+			agbotInfo.Leader = leaderElection.Status()
+		}
+
+		writeResponse(w, agbotInfo, http.StatusOK)
 	case "OPTIONS":
 		w.Header().Set("Allow", "GET, OPTIONS")
 		w.WriteHeader(http.StatusOK)
@@ -656,10 +671,19 @@ func (a *API) health(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// The worker status, with the state of the agreement work queue of each agreement protocol.
+type WorkerStatusOutput struct {
+	*worker.WorkerStatusManager
+	WorkQueues map[string]WorkQueueStatus `json:"work_queues,omitempty"`
+}
+
 func (a *API) workerstatus(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
-		status := worker.GetWorkerStatusManager()
+		status := WorkerStatusOutput{WorkerStatusManager: worker.GetWorkerStatusManager()}
+		if consumerPHManager != nil {
+			status.WorkQueues = consumerPHManager.WorkQueueStatus()
+		}
 		writeResponse(w, status, http.StatusOK)
 	case "OPTIONS":
 		w.Header().Set("Allow", "GET, OPTIONS")
@@ -669,6 +693,22 @@ func (a *API) workerstatus(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (a *API) metrics(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", metrics.CONTENT_TYPE)
+		w.WriteHeader(http.StatusOK)
+		if err := metrics.DefaultRegistry.WriteText(w); err != nil {
+			glog.Errorf(APIlogString(fmt.Sprintf("error writing metrics, error: %v", err)))
+		}
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (a *API) node(w http.ResponseWriter, r *http.Request) {
 
 	resource := "node"
@@ -756,64 +796,269 @@ func (a *API) config(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Stream the agreement state transitions as server-sent events. The stream starts with the transitions after the
+// cursor, or with the next transition when there is no cursor. Each event carries its id, which is the cursor to resume
+// from. When the transitions after the cursor are no longer known, a gap event is sent first.
+func (a *API) agreementEvents(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		filter := persistence.AgreementEventFilter{
+			Org:        r.URL.Query().Get("org"),
+			PolicyName: r.URL.Query().Get("policy"),
+			Pattern:    r.URL.Query().Get("pattern"),
+			DeviceId:   r.URL.Query().Get("node"),
+		}
+
+		// A reconnecting event source sends the id of the last event it received.
+		cursorParam := r.URL.Query().Get("cursor")
+		if lastId := r.Header.Get("Last-Event-ID"); lastId != "" {
+			cursorParam = lastId
+		}
+		cursor := uint64(0)
+		if cursorParam != "" {
+			var err error
+			if cursor, err = strconv.ParseUint(cursorParam, 10, 64); err != nil {
+				writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "cursor", Error: fmt.Sprintf("cursor %v is not a number", cursorParam)})
+				return
+			}
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(30 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			evs, latest, changed, complete := persistence.AgreementEvents.Since(cursor, filter)
+			if !complete {
+				fmt.Fprintf(w, "event: gap\ndata: {\"cursor\":%v}\n\n", cursor)
+			}
+			for _, ev := range evs {
+				if data, err := json.Marshal(ev); err != nil {
+					glog.Error(APIlogString(fmt.Sprintf("error marshalling agreement event %v, error: %v", ev, err)))
+				} else {
+					fmt.Fprintf(w, "id: %v\nevent: %v\ndata: %s\n\n", ev.Id, ev.Type, data)
+				}
+			}
+			flusher.Flush()
+			cursor = latest
+
+			select {
+			case <-changed:
+			case <-keepAlive.C:
+				fmt.Fprintf(w, ": keepalive\n\n")
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Cancel the agreements selected by deployment policy, pattern, service, node org or node property. The selected
+// agreements are returned right away and cancelled in the background at no more than the requested rate, which is limited
+// to the BulkCancelPerMinute config of the agbot.
+func (a *API) agreementCancel(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "POST":
+		var input BulkCancelRequest
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: fmt.Sprintf("unable to demarshal input: %v", err)})
+			return
+		} else if err := input.Selector.Validate(); err != nil {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "selector", Error: err.Error()})
+			return
+		} else if input.MaxPerMinute < 0 {
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "max_per_minute", Error: "must not be negative"})
+			return
+		}
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("handling bulk cancel of agreements selected by %v, dry run: %v", input.Selector, input.DryRun)))
+
+		maxPerMinute := input.MaxPerMinute
+		if maxPerMinute == 0 || maxPerMinute > a.Config.GetBulkCancelPerMinute() {
+			maxPerMinute = a.Config.GetBulkCancelPerMinute()
+		}
+
+		nodePolicyHandler := exchange.GetHTTPNodePolicyHandler(a)
+		nodeProperties := func(nodeId string) (externalpolicy.PropertyList, error) {
+			return getNodeProperties(nodePolicyHandler, nodeId)
+		}
+
+		if agreements, err := selectAgreements(a.db, &input.Selector, nodeProperties); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error selecting agreements to cancel, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			if !input.DryRun && len(agreements) != 0 {
+				a.startBulkCancel(input.Selector, agreements, maxPerMinute)
+			}
+			writeResponse(w, BulkCancelResult{DryRun: input.DryRun, MaxPerMinute: maxPerMinute, Agreements: agreements}, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (a *API) partition(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
 
 		// For each partition, how many agreements and other objects are in it. The top level keys in the output
-		// are the partition names, the sub maps are for each of agreements, workload usage, etc.
+		// are the partition names, the sub maps are for each of agreements, workload usage, etc. The ownership and
+		// load of each partition, and the agreement moves in flight to or from the partition, are also included.
 		const PARTITION_OWNER = "owner"
+		const PARTITION_HEARTBEAT = "heartbeat"
+		const PARTITION_LIVE = "live"
+		const PARTITION_PRIMARY = "primary"
+		const PARTITION_LOAD = "load"
+		const PARTITION_MOVES = "in-flight moves"
 		const AGREEMENT_ACTIVE_KEY = "active agreements"
 		const AGREEMENT_ARCHIVED_KEY = "archived agreements"
 		const WORKLOAD_USAGES_KEY = "workload usages"
 
 		output := make(map[string]map[string]interface{}, 0)
 
-		if partitions, err := a.db.FindPartitions(); err != nil {
-			glog.Error(APIlogString(fmt.Sprintf("error finding all partitions, error: %v", err)))
+		loads, err := persistence.GetPartitionLoads(a.db, a.Config.GetPartitionStale())
+		if err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding partition loads, error: %v", err)))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		} else {
+			return
+		}
 
-			// For each partition, get a count of records in the partition.
-			for _, p := range partitions {
-				partitionMaps := make(map[string]interface{}, 0)
+		moves, err := a.db.FindPartitionMoves()
+		if err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding partition moves, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 
-				// First get the partition owner.
-				if owner, err := a.db.GetPartitionOwner(p); err != nil {
-					glog.Error(APIlogString(fmt.Sprintf("error finding partition %v owner, error: %v", p, err)))
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
-					return
-				} else {
-					partitionMaps[PARTITION_OWNER] = owner
-				}
+		// The load of a live partition is its share (in percent) of the active agreements in all the live partitions.
+		var totalActive int64
+		for _, l := range loads {
+			if l.Live {
+				totalActive += l.Active
+			}
+		}
 
-				// Then get the agreement count.
-				if active, archived, err := a.db.GetAgreementCount(p); err != nil {
-					glog.Error(APIlogString(fmt.Sprintf("error finding agreement count in partition %v, error: %v", p, err)))
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
-					return
-				} else {
-					partitionMaps[AGREEMENT_ACTIVE_KEY] = active
-					partitionMaps[AGREEMENT_ARCHIVED_KEY] = archived
-				}
+		// For each partition, get a count of records in the partition.
+		for _, l := range loads {
+			partitionMaps := make(map[string]interface{}, 0)
 
-				// Then get the workload_usage count.
-				if num, err := a.db.GetWorkloadUsagesCount(p); err != nil {
-					glog.Error(APIlogString(fmt.Sprintf("error finding workload usage count in partition %v, error: %v", p, err)))
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
-					return
-				} else {
-					partitionMaps[WORKLOAD_USAGES_KEY] = num
-				}
+			partitionMaps[PARTITION_OWNER] = l.Owner
+			partitionMaps[PARTITION_HEARTBEAT] = l.Heartbeat
+			partitionMaps[PARTITION_LIVE] = l.Live
+			partitionMaps[PARTITION_PRIMARY] = l.Id == a.db.PrimaryPartition()
+			partitionMaps[AGREEMENT_ACTIVE_KEY] = l.Active
+			partitionMaps[AGREEMENT_ARCHIVED_KEY] = l.Archived
+
+			if l.Live && totalActive != 0 {
+				partitionMaps[PARTITION_LOAD] = l.Active * 100 / totalActive
+			} else {
+				partitionMaps[PARTITION_LOAD] = 0
+			}
 
-				// Set the values for the current partition
-				output[p] = partitionMaps
+			// Then get the workload_usage count.
+			if num, err := a.db.GetWorkloadUsagesCount(l.Id); err != nil {
+				glog.Error(APIlogString(fmt.Sprintf("error finding workload usage count in partition %v, error: %v", l.Id, err)))
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			} else {
+				partitionMaps[WORKLOAD_USAGES_KEY] = num
+			}
 
+			inFlight := make([]persistence.PartitionMove, 0)
+			for _, m := range moves {
+				if m.State == persistence.PARTITION_MOVE_HANDED_OFF && (m.FromPartition == l.Id || m.ToPartition == l.Id) {
+					inFlight = append(inFlight, m)
+				}
 			}
+			partitionMaps[PARTITION_MOVES] = inFlight
+
+			// Set the values for the current partition
+			output[l.Id] = partitionMaps
+
+		}
+
+		writeResponse(w, output, http.StatusOK)
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Return the agreement moves between partitions that are in flight or that completed recently.
+func (a *API) partitionMoves(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		if moves, err := a.db.FindPartitionMoves(); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding partition moves, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, moves, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Get the progress of the deployment policy rollouts run by this agbot.
+func (a *API) rollout(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		if states, err := a.db.FindRolloutStates(); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error finding rollout states, error: %v", err)))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		} else {
+			writeResponse(w, states, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
 
-			writeResponse(w, output, http.StatusOK)
+// List the work that is waiting for a maintenance window of a deployment policy or pattern to open.
+func (a *API) maintenance(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		pending := make([]PendingWork, 0)
+		if maintenanceQueue != nil {
+			pending = maintenanceQueue.List()
 		}
+		writeResponse(w, pending, http.StatusOK)
 
 	case "OPTIONS":
 		w.Header().Set("Allow", "GET, OPTIONS")
@@ -823,6 +1068,51 @@ func (a *API) partition(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Export all the agreements, workload usages and search sessions in the database as a JSON lines archive. The archive is
+// streamed, so an error after the response has started is reported in the trailer record at the end of the archive.
+func (a *API) dbexport(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", "attachment; filename=agbot-archive.jsonl")
+		w.WriteHeader(http.StatusOK)
+
+		if summary, err := persistence.ExportArchive(a.db, w); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error exporting database, error: %v", err)))
+		} else {
+			glog.V(3).Infof(APIlogString(fmt.Sprintf("exported database archive: %v", summary)))
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Import an archive created by the export API into the database. Records that are already in the database are skipped.
+func (a *API) dbimport(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "POST":
+		if summary, err := persistence.ImportArchive(a.db, r.Body); err != nil {
+			glog.Error(APIlogString(fmt.Sprintf("error importing database archive, imported %v before the error, error: %v", summary, err)))
+			writeInputErr(w, http.StatusBadRequest, &APIUserInputError{Input: "body", Error: err.Error()})
+		} else {
+			glog.V(3).Infof(APIlogString(fmt.Sprintf("imported database archive: %v", summary)))
+			writeResponse(w, summary, http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 // ==========================================================================================
 // Utility functions used by many of the API endpoints.
 //
@@ -838,6 +1128,13 @@ func NewHorizonAgbot(id string, org string) *HorizonAgbot {
 	}
 }
 
+// The agbot status is the common status augmented with the state of the agbot's database schema.
+type AgbotInfo struct {
+	*apicommon.Info
+	DatabaseSchema *persistence.SchemaStatus `json:"databaseSchema,omitempty"`
+	Leader         *LeaderStatus             `json:"leader,omitempty"`
+}
+
 type HorizonAgbotConfig struct {
 	InMemoryConfig   config.AGConfig `json:"InMemoryConfig"`
 	FileSystemConfig config.AGConfig `json:"FileSystemConfig"`
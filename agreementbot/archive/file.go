@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The file sink appends records, one JSON document per line, to a file in the configured directory. When the file reaches
+// its maximum size it is renamed with a timestamp suffix and a new file is started. The oldest rotated files are removed
+// when there are more than the configured number of them.
+type FileSink struct {
+	lock     sync.Mutex
+	dir      string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func init() {
+	Register("file", new(FileSink))
+}
+
+const FILE_SINK_DEFAULT_MAX_SIZE_MB = 100
+
+// The suffix added to the name of a rotated file. It sorts in time order.
+const FILE_SINK_ROTATE_TIME_FORMAT = "20060102T150405.000000000Z"
+
+func (f *FileSink) Name() string {
+	return "file"
+}
+
+func (f *FileSink) Initialize(cfg *config.HorizonConfig) error {
+	sc := cfg.AgreementBot.ArchiveSink
+	if sc.FilePath == "" {
+		return errors.New(fmt.Sprintf("the file archive sink requires a FilePath"))
+	} else if sc.FileMaxSizeMB < 0 || sc.FileMaxFiles < 0 {
+		return errors.New(fmt.Sprintf("FileMaxSizeMB and FileMaxFiles must not be negative"))
+	} else if err := os.MkdirAll(sc.FilePath, 0750); err != nil {
+		return errors.New(fmt.Sprintf("unable to create archive directory %v, error: %v", sc.FilePath, err))
+	}
+
+	f.dir = sc.FilePath
+	f.maxSize = int64(FILE_SINK_DEFAULT_MAX_SIZE_MB) * 1024 * 1024
+	if sc.FileMaxSizeMB != 0 {
+		f.maxSize = int64(sc.FileMaxSizeMB) * 1024 * 1024
+	}
+	f.maxFiles = sc.FileMaxFiles
+
+	glog.V(3).Infof("Archive sink writing purged agreements to %v", f.currentFileName())
+	return nil
+}
+
+func (f *FileSink) Write(records []PurgedAgreement) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return errors.New(fmt.Sprintf("unable to serialize archive record %v, error: %v", r, err))
+		}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	// Rotate before the batch would take the file over its maximum size, unless the file is empty. A batch is never split
+	// across files.
+	if f.size != 0 && f.size+int64(buf.Len()) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := f.file.Write(buf.Bytes())
+	f.size += int64(n)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to write to archive file %v, error: %v", f.file.Name(), err))
+	} else if err := f.file.Sync(); err != nil {
+		return errors.New(fmt.Sprintf("unable to sync archive file %v, error: %v", f.file.Name(), err))
+	}
+	return nil
+}
+
+func (f *FileSink) Close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+func (f *FileSink) currentFileName() string {
+	return path.Join(f.dir, config.ArchiveSinkFileName)
+}
+
+// Open the current archive file, if it is not already open.
+func (f *FileSink) open() error {
+	if f.file != nil {
+		return nil
+	}
+
+	file, err := os.OpenFile(f.currentFileName(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to open archive file %v, error: %v", f.currentFileName(), err))
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.New(fmt.Sprintf("unable to stat archive file %v, error: %v", f.currentFileName(), err))
+	}
+
+	f.file = file
+	f.size = fi.Size()
+	return nil
+}
+
+// Rename the current archive file, open a new one and remove the oldest rotated files.
+func (f *FileSink) rotate() error {
+	f.file.Close()
+	f.file = nil
+
+	ext := path.Ext(config.ArchiveSinkFileName)
+	base := strings.TrimSuffix(config.ArchiveSinkFileName, ext)
+	rotated := path.Join(f.dir, fmt.Sprintf("%v-%v%v", base, time.Now().UTC().Format(FILE_SINK_ROTATE_TIME_FORMAT), ext))
+
+	if err := os.Rename(f.currentFileName(), rotated); err != nil {
+		return errors.New(fmt.Sprintf("unable to rotate archive file %v, error: %v", f.currentFileName(), err))
+	}
+	glog.V(3).Infof("Archive sink rotated %v to %v", f.currentFileName(), rotated)
+
+	if err := f.prune(base, ext); err != nil {
+		glog.Errorf("Archive sink unable to remove old archive files, error: %v", err)
+	}
+
+	return f.open()
+}
+
+// Remove the oldest rotated files, keeping at most maxFiles of them.
+func (f *FileSink) prune(base string, ext string) error {
+	if f.maxFiles == 0 {
+		return nil
+	}
+
+	files, err := filepath.Glob(path.Join(f.dir, fmt.Sprintf("%v-*%v", base, ext)))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for len(files) > f.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		glog.V(3).Infof("Archive sink removed %v", files[0])
+		files = files[1:]
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// The http sink POSTs each batch of records to the configured URL. The body of the request contains one JSON document per
+// line. Any 2xx response indicates that the receiver has stored the records.
+type HTTPSink struct {
+	url           string
+	authorization string
+	httpClient    *http.Client
+}
+
+func init() {
+	Register("http", new(HTTPSink))
+}
+
+func (h *HTTPSink) Name() string {
+	return "http"
+}
+
+func (h *HTTPSink) Initialize(cfg *config.HorizonConfig) error {
+	sc := cfg.AgreementBot.ArchiveSink
+	if sc.URL == "" {
+		return errors.New(fmt.Sprintf("the http archive sink requires a URL"))
+	}
+
+	h.url = sc.URL
+	h.authorization = sc.Authorization
+	h.httpClient = cfg.Collaborators.HTTPClientFactory.NewHTTPClient(nil)
+
+	glog.V(3).Infof("Archive sink sending purged agreements to %v", h.url)
+	return nil
+}
+
+func (h *HTTPSink) Write(records []PurgedAgreement) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return errors.New(fmt.Sprintf("unable to serialize archive record %v, error: %v", r, err))
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.url, buf)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to create archive request for %v, error: %v", h.url, err))
+	}
+	req.Header.Add("Content-Type", "application/x-ndjson")
+	if h.authorization != "" {
+		req.Header.Add("Authorization", h.authorization)
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to send archive records to %v, error: %v", h.url, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.New(fmt.Sprintf("archive records rejected by %v, HTTP code %v, response: %v", h.url, resp.StatusCode, string(body)))
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+func (h *HTTPSink) Close() {}
@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"time"
+)
+
+// An archive sink receives a copy of each archived agreement just before the agbot purges it from its database. The sink
+// implementations register themselves with the registry below when their init() method is driven, in the same way as the
+// agbot database providers, so that new kinds of sinks can be plugged in without changing the governance code.
+type ArchiveSink interface {
+
+	// Called once, before any records are written to the sink.
+	Initialize(cfg *config.HorizonConfig) error
+
+	// Write a batch of records to the sink. The records must be durably stored by the sink when this function returns
+	// without error, because the agbot deletes the agreements from its database afterwards. When an error is returned,
+	// the agreements are left in the database and written again on the next purge.
+	Write(records []PurgedAgreement) error
+
+	// Release any resources held by the sink.
+	Close()
+
+	// The name of the sink, used in logs.
+	Name() string
+}
+
+type ArchiveSinkRegistry map[string]ArchiveSink
+
+var ArchiveSinks = ArchiveSinkRegistry{}
+
+func Register(name string, sink ArchiveSink) {
+	ArchiveSinks[name] = sink
+}
+
+// Initialize the configured archive sink. Returns nil (and no error) when no sink is configured.
+func InitArchiveSink(cfg *config.HorizonConfig) (ArchiveSink, error) {
+	if !cfg.IsArchiveSinkConfigured() {
+		return nil, nil
+	} else if sink, ok := ArchiveSinks[cfg.AgreementBot.ArchiveSink.Type]; !ok {
+		return nil, errors.New(fmt.Sprintf("archive sink type %v is not supported", cfg.AgreementBot.ArchiveSink.Type))
+	} else if err := sink.Initialize(cfg); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to initialize %v archive sink, error: %v", sink.Name(), err))
+	} else {
+		return sink, nil
+	}
+}
+
+// The record written to an archive sink for each purged agreement. The agreement contains the proposal, the termination
+// reason and the timing of each stage of the agreement's life.
+type PurgedAgreement struct {
+	Agbot     string                `json:"agbot"`  // The exchange id of the agbot that purged the agreement.
+	Purged    uint64                `json:"purged"` // The time when the agreement was purged.
+	Agreement persistence.Agreement `json:"agreement"`
+}
+
+func (p PurgedAgreement) String() string {
+	return fmt.Sprintf("Agbot: %v, Purged: %v, Agreement: %v", p.Agbot, p.Purged, p.Agreement.CurrentAgreementId)
+}
+
+// Create the archive record for an agreement. The data verification password is removed so that it is not copied out of the
+// agbot's database.
+func NewPurgedAgreement(agbot string, ag persistence.Agreement) PurgedAgreement {
+	ag.DataVerificationPW = ""
+	return PurgedAgreement{
+		Agbot:     agbot,
+		Purged:    uint64(time.Now().Unix()),
+		Agreement: ag,
+	}
+}
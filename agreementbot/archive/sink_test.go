@@ -0,0 +1,180 @@
+// +build unit
+
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRecords(n int, prefix string) []PurgedAgreement {
+	records := make([]PurgedAgreement, 0, n)
+	for i := 0; i < n; i++ {
+		ag := persistence.Agreement{
+			CurrentAgreementId:    prefix + strings.Repeat("a", 200) + string('a'+rune(i)),
+			AgreementProtocol:     "Basic",
+			Proposal:              "{}",
+			DataVerificationPW:    "secret",
+			TerminatedReason:      200,
+			TerminatedDescription: "node policy changed",
+		}
+		records = append(records, NewPurgedAgreement("myorg/agbot1", ag))
+	}
+	return records
+}
+
+func Test_InitArchiveSink(t *testing.T) {
+
+	cfg := &config.HorizonConfig{}
+	if sink, err := InitArchiveSink(cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if sink != nil {
+		t.Errorf("no sink should be returned when none is configured")
+	}
+
+	cfg.AgreementBot.ArchiveSink.Type = "ftp"
+	if _, err := InitArchiveSink(cfg); err == nil {
+		t.Errorf("an unknown sink type should be rejected")
+	}
+
+	cfg.AgreementBot.ArchiveSink.Type = "file"
+	if _, err := InitArchiveSink(cfg); err == nil {
+		t.Errorf("a file sink without a path should be rejected")
+	}
+
+	cfg.AgreementBot.ArchiveSink.Type = "http"
+	if _, err := InitArchiveSink(cfg); err == nil {
+		t.Errorf("an http sink without a URL should be rejected")
+	}
+}
+
+func Test_NewPurgedAgreement(t *testing.T) {
+
+	r := testRecords(1, "ag")[0]
+	if r.Agreement.DataVerificationPW != "" {
+		t.Errorf("the data verification password should not be archived")
+	} else if r.Agbot != "myorg/agbot1" || r.Purged == 0 {
+		t.Errorf("unexpected record %v", r)
+	} else if r.Agreement.TerminatedDescription != "node policy changed" {
+		t.Errorf("termination reason should be archived, got %v", r.Agreement)
+	}
+}
+
+func Test_FileSink_rotate(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "archive-sink-")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &config.HorizonConfig{}
+	cfg.AgreementBot.ArchiveSink = config.ArchiveSinkConfig{Type: "file", FilePath: dir, FileMaxFiles: 2}
+
+	sink := new(FileSink)
+	if err := sink.Initialize(cfg); err != nil {
+		t.Fatalf("unable to initialize file sink, error: %v", err)
+	}
+	defer sink.Close()
+
+	// Use a tiny maximum size so that every batch after the first causes a rotation.
+	sink.maxSize = 1024
+
+	for i := 0; i < 4; i++ {
+		if err := sink.Write(testRecords(3, string('a'+rune(i)))); err != nil {
+			t.Fatalf("unable to write to file sink, error: %v", err)
+		}
+		// Rotated file names have nanosecond resolution, make sure they are distinct.
+		time.Sleep(time.Millisecond)
+	}
+
+	rotated, _ := filepath.Glob(path.Join(dir, "purged-agreements-*.jsonl"))
+	if len(rotated) != 2 {
+		t.Errorf("expected 2 rotated files, found %v", rotated)
+	}
+
+	// The current file contains only the last batch, and a batch is never split.
+	f, err := os.Open(path.Join(dir, config.ArchiveSinkFileName))
+	if err != nil {
+		t.Fatalf("unable to open current archive file, error: %v", err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r PurgedAgreement
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Errorf("unable to read archive record, error: %v", err)
+		} else if !strings.HasPrefix(r.Agreement.CurrentAgreementId, "d") {
+			t.Errorf("unexpected record in current file %v", r)
+		}
+		lines += 1
+	}
+	if lines != 3 {
+		t.Errorf("expected 3 records in the current file, found %v", lines)
+	}
+}
+
+func Test_HTTPSink(t *testing.T) {
+
+	received := 0
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer abc" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		} else if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var rec PurgedAgreement
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received += 1
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := &config.HorizonConfig{
+		Collaborators: config.Collaborators{
+			HTTPClientFactory: &config.HTTPClientFactory{
+				NewHTTPClient: func(overrideTimeoutS *uint) *http.Client { return &http.Client{Timeout: 5 * time.Second} },
+			},
+		},
+	}
+	cfg.AgreementBot.ArchiveSink = config.ArchiveSinkConfig{Type: "http", URL: server.URL, Authorization: "Bearer abc"}
+
+	sink := new(HTTPSink)
+	if err := sink.Initialize(cfg); err != nil {
+		t.Fatalf("unable to initialize http sink, error: %v", err)
+	}
+
+	if err := sink.Write(testRecords(5, "ag")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if received != 5 {
+		t.Errorf("expected 5 records to be received, got %v", received)
+	}
+
+	fail = true
+	if err := sink.Write(testRecords(1, "ag")); err == nil {
+		t.Errorf("a rejected POST should return an error")
+	}
+}
@@ -149,10 +149,16 @@ func (a *BasicAgreementWorker) start(work *PrioritizedWorkQueue, random *rand.Ra
 
 		if workItem.Type() == INITIATE {
 			wi := workItem.(InitiateAgreement)
-			a.InitiateNewAgreement(a.protocolHandler, &wi, random, a.workerID)
+			// The attempt stays in progress until the node replies or the agreement is cancelled.
+			if agreementId := a.InitiateNewAgreement(a.protocolHandler, &wi, random, a.workerID); agreementId != "" {
+				work.Sent(workItemPtr, agreementId)
+			} else {
+				work.Done(workItemPtr)
+			}
 
 		} else if workItem.Type() == REPLY {
 			wi := workItem.(HandleReply)
+			work.Resolved(wi.Reply.AgreementId())
 			if ok := a.HandleAgreementReply(a.protocolHandler, &wi, a.workerID); ok {
 				// Update state in the database
 				if ag, err := a.db.AgreementFinalized(wi.Reply.AgreementId(), a.protocolHandler.Name()); err != nil {
@@ -172,6 +178,7 @@ func (a *BasicAgreementWorker) start(work *PrioritizedWorkQueue, random *rand.Ra
 
 		} else if workItem.Type() == CANCEL {
 			wi := workItem.(CancelAgreement)
+			work.Resolved(wi.AgreementId)
 			deleteMessage := a.CancelAgreementWithLock(a.protocolHandler, wi.AgreementId, wi.Reason, a.workerID)
 
 			// Get rid of the original agreement cancellation message if the agreement is owned by this agbot.
@@ -40,7 +40,9 @@ func NewBasicProtocolHandler(name string, cfg *config.HorizonConfig, db persiste
 			},
 			agreementPH: basicprotocol.NewProtocolHandler(cfg.Collaborators.HTTPClientFactory.NewHTTPClient(nil), pm),
 			// Allow the main agbot thread to distribute protocol msgs and agreement handling to the worker pool.
-			Work: NewPrioritizedWorkQueue(cfg.GetAgbotAgreementQueueSize()),
+			// An agreement attempt without a reply is cancelled after the protocol timeout, its in-flight slot is released
+			// after twice that time in case the cancellation is lost.
+			Work: NewPrioritizedWorkQueue(cfg.GetAgbotAgreementQueueSize(), cfg.GetAgbotWorkQueueFairness(), 2*time.Duration(cfg.AgreementBot.ProtocolTimeoutS)*time.Second),
 		}
 	} else {
 		return nil
@@ -176,6 +178,19 @@ func (c *BasicProtocolHandler) IsTerminationReasonNodeShutdown(code uint) bool {
 	return uint(code) == basicprotocol.CANCEL_NODE_SHUTDOWN
 }
 
+// Returns true when the agreement was terminated because the service could not be deployed or did not work on the node.
+func (c *BasicProtocolHandler) IsTerminationReasonFailure(code uint) bool {
+	switch code {
+	case basicprotocol.CANCEL_CONTAINER_FAILURE, basicprotocol.CANCEL_NOT_EXECUTED_TIMEOUT, basicprotocol.CANCEL_MICROSERVICE_FAILURE,
+		basicprotocol.CANCEL_WL_IMAGE_LOAD_FAILURE, basicprotocol.CANCEL_MS_IMAGE_LOAD_FAILURE, basicprotocol.CANCEL_IMAGE_DATA_ERROR,
+		basicprotocol.CANCEL_IMAGE_FETCH_FAILURE, basicprotocol.CANCEL_IMAGE_FETCH_AUTH_FAILURE, basicprotocol.CANCEL_IMAGE_SIG_VERIF_FAILURE,
+		basicprotocol.CANCEL_MS_IMAGE_FETCH_FAILURE, basicprotocol.AB_CANCEL_NO_REPLY, basicprotocol.AB_CANCEL_NO_DATA_RECEIVED:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *BasicProtocolHandler) SetBlockchainWritable(ev *events.AccountFundedMessage) {
 	return
 }
@@ -0,0 +1,297 @@
+package agreementbot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/compcheck"
+	"github.com/open-horizon/anax/events"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/semanticversion"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A bulk cancel selects the active agreements of this agbot by deployment policy, pattern, service, node org or node
+// property and cancels them at a limited rate, so that a large number of nodes do not stop and restart their services
+// at the same time. A dry run returns the agreements that would be cancelled without cancelling them.
+
+// Selects the agreements to cancel. Empty fields match every agreement, but at least one field must be set.
+type AgreementSelector struct {
+	PolicyName     string `json:"policy,omitempty"`          // The deployment policy, org/name.
+	Pattern        string `json:"pattern,omitempty"`         // The pattern, org/name.
+	Service        string `json:"service,omitempty"`         // The service, org/url.
+	ServiceVersion string `json:"service_version,omitempty"` // A version or a version range of the service.
+	NodeOrg        string `json:"node_org,omitempty"`        // The org of the node.
+	NodeProperty   string `json:"node_property,omitempty"`   // A node property, name=value.
+}
+
+func (s AgreementSelector) String() string {
+	return fmt.Sprintf("PolicyName: %v, Pattern: %v, Service: %v, ServiceVersion: %v, NodeOrg: %v, NodeProperty: %v",
+		s.PolicyName, s.Pattern, s.Service, s.ServiceVersion, s.NodeOrg, s.NodeProperty)
+}
+
+func (s *AgreementSelector) IsEmpty() bool {
+	return s.PolicyName == "" && s.Pattern == "" && s.Service == "" && s.ServiceVersion == "" && s.NodeOrg == "" && s.NodeProperty == ""
+}
+
+// Returns the name and value of the node property.
+func (s *AgreementSelector) nodeProperty() (string, string) {
+	parts := strings.SplitN(s.NodeProperty, "=", 2)
+	if len(parts) != 2 {
+		return parts[0], ""
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+func (s *AgreementSelector) Validate() error {
+	if s.IsEmpty() {
+		return errors.New("at least one of policy, pattern, service, service_version, node_org or node_property must be specified")
+	} else if s.PolicyName != "" && s.Pattern != "" {
+		return errors.New("policy and pattern are mutually exclusive")
+	} else if s.ServiceVersion != "" && s.Service == "" {
+		return errors.New("service_version requires service")
+	} else if s.Service != "" && !strings.Contains(s.Service, "/") {
+		return fmt.Errorf("service %v must be in the form org/url", s.Service)
+	} else if s.ServiceVersion != "" && !semanticversion.IsVersionString(s.ServiceVersion) && !semanticversion.IsVersionExpression(s.ServiceVersion) {
+		return fmt.Errorf("service_version %v is not a valid version or version range", s.ServiceVersion)
+	} else if s.NodeProperty != "" {
+		if name, value := s.nodeProperty(); name == "" || value == "" {
+			return fmt.Errorf("node_property %v must be in the form name=value", s.NodeProperty)
+		}
+	}
+	return nil
+}
+
+// Returns true if the agreement is selected, not counting the node property which is not in the agreement.
+func (s *AgreementSelector) Matches(ag *persistence.Agreement) bool {
+	if s.PolicyName != "" && (ag.Pattern != "" || ag.PolicyName != s.PolicyName) {
+		return false
+	} else if s.Pattern != "" && ag.Pattern != s.Pattern {
+		return false
+	} else if s.NodeOrg != "" && exchange.GetOrg(ag.DeviceId) != s.NodeOrg {
+		return false
+	} else if s.Service != "" {
+		for _, svc := range agreementServices(ag) {
+			if svc.url == s.Service && s.matchesVersion(svc.version) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (s *AgreementSelector) matchesVersion(version string) bool {
+	if s.ServiceVersion == "" {
+		return true
+	} else if semanticversion.IsVersionString(s.ServiceVersion) {
+		return version == s.ServiceVersion
+	} else if vExp, err := semanticversion.Version_Expression_Factory(s.ServiceVersion); err != nil {
+		return false
+	} else if inRange, err := vExp.Is_within_range(version); err != nil {
+		return false
+	} else {
+		return inRange
+	}
+}
+
+// Returns true if the properties of the node match the node property of the selector.
+func (s *AgreementSelector) MatchesNode(props externalpolicy.PropertyList) bool {
+	if s.NodeProperty == "" {
+		return true
+	}
+	name, value := s.nodeProperty()
+	nodeValue, ok := compcheck.PlacementValue(props, name)
+	return ok && nodeValue == value
+}
+
+type agreementService struct {
+	url     string // org/url
+	version string
+}
+
+// Returns the services of the agreement. The service ids are only saved for agreements made for deployment policies,
+// the services of pattern agreements are in the policy of the agreement, once it has been proposed.
+func agreementServices(ag *persistence.Agreement) []agreementService {
+	services := make([]agreementService, 0)
+	if len(ag.ServiceId) != 0 {
+		// The service ids are in the form of org/url_version_arch.
+		for _, serviceId := range ag.ServiceId {
+			if ix := strings.LastIndex(serviceId, "_"); ix != -1 {
+				serviceId = serviceId[:ix]
+			}
+			if ix := strings.LastIndex(serviceId, "_"); ix != -1 {
+				services = append(services, agreementService{url: serviceId[:ix], version: serviceId[ix+1:]})
+			}
+		}
+	} else if ag.Policy != "" {
+		if pol, err := policy.DemarshalPolicy(ag.Policy); err != nil {
+			glog.Errorf(APIlogString(fmt.Sprintf("unable to demarshal policy of agreement %v, error: %v", ag.CurrentAgreementId, err)))
+		} else {
+			for _, wl := range pol.Workloads {
+				services = append(services, agreementService{url: fmt.Sprintf("%v/%v", wl.Org, wl.WorkloadURL), version: wl.Version})
+			}
+		}
+	}
+	return services
+}
+
+// The body of a bulk cancel request.
+type BulkCancelRequest struct {
+	Selector     AgreementSelector `json:"selector"`
+	DryRun       bool              `json:"dry_run,omitempty"`
+	MaxPerMinute int               `json:"max_per_minute,omitempty"` // The default is the agbot's BulkCancelPerMinute config.
+}
+
+// An agreement selected by a bulk cancel.
+type BulkCancelAgreement struct {
+	AgreementId string `json:"agreement_id"`
+	Protocol    string `json:"protocol"`
+	DeviceId    string `json:"device_id"`
+	PolicyName  string `json:"policy_name,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+}
+
+type BulkCancelResult struct {
+	DryRun       bool                  `json:"dry_run"`
+	MaxPerMinute int                   `json:"max_per_minute"`
+	Agreements   []BulkCancelAgreement `json:"agreements"`
+}
+
+// Find the active agreements that are selected. The properties of the nodes are only read when the selector has a node
+// property.
+func selectAgreements(db persistence.AgbotDatabase, selector *AgreementSelector, nodeProperties func(nodeId string) (externalpolicy.PropertyList, error)) ([]BulkCancelAgreement, error) {
+	selectorFilter := func(a persistence.Agreement) bool { return a.AgreementTimedout == 0 && selector.Matches(&a) }
+
+	selected := make([]BulkCancelAgreement, 0)
+	nodeMatches := make(map[string]bool)
+	for _, agp := range policy.AllAgreementProtocols() {
+		agreements, err := db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter(), selectorFilter}, agp)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the %v agreements, error: %v", agp, err)
+		}
+
+		for _, ag := range agreements {
+			if selector.NodeProperty != "" {
+				matches, ok := nodeMatches[ag.DeviceId]
+				if !ok {
+					if props, err := nodeProperties(ag.DeviceId); err != nil {
+						return nil, fmt.Errorf("unable to get the properties of node %v, error: %v", ag.DeviceId, err)
+					} else {
+						matches = selector.MatchesNode(props)
+						nodeMatches[ag.DeviceId] = matches
+					}
+				}
+				if !matches {
+					continue
+				}
+			}
+			selected = append(selected, BulkCancelAgreement{
+				AgreementId: ag.CurrentAgreementId,
+				Protocol:    ag.AgreementProtocol,
+				DeviceId:    ag.DeviceId,
+				PolicyName:  ag.PolicyName,
+				Pattern:     ag.Pattern,
+			})
+		}
+	}
+	return selected, nil
+}
+
+// Spaces out the cancellations of all the bulk cancels running in the agbot, so that together they cancel no more than
+// the BulkCancelPerMinute config of the agbot in a minute, however many bulk cancels are started.
+type cancelPacer struct {
+	lock     sync.Mutex
+	interval time.Duration
+	next     time.Time // the earliest time that the next cancellation can be made
+	now      func() time.Time
+	sleep    func(time.Duration)
+}
+
+func newCancelPacer(maxPerMinute int) *cancelPacer {
+	return &cancelPacer{
+		interval: time.Minute / time.Duration(maxPerMinute),
+		now:      time.Now,
+		sleep:    time.Sleep,
+	}
+}
+
+// Wait until the next cancellation can be made. The time slot is reserved before sleeping, so callers that wait at the
+// same time are given different slots.
+func (p *cancelPacer) wait() {
+	p.lock.Lock()
+	now := p.now()
+	if p.next.After(now) {
+		delay := p.next.Sub(now)
+		p.next = p.next.Add(p.interval)
+		p.lock.Unlock()
+		p.sleep(delay)
+		return
+	}
+	p.next = now.Add(p.interval)
+	p.lock.Unlock()
+}
+
+// Cancel the agreements, no more than maxPerMinute of them in a minute. The cancellations are spread evenly over the
+// minute, and each one also waits for its turn on the pacer shared by all bulk cancels. Cancelling stops early when
+// cancel returns false.
+func paceCancellations(agreements []BulkCancelAgreement, maxPerMinute int, sleep func(time.Duration), wait func(), cancel func(ag *BulkCancelAgreement) bool) {
+	interval := time.Minute / time.Duration(maxPerMinute)
+	for ix := range agreements {
+		if ix != 0 {
+			sleep(interval)
+		}
+		wait()
+		if !cancel(&agreements[ix]) {
+			return
+		}
+	}
+}
+
+// Cancel the agreement if it has not already been cancelled, returns false if the agreement was not found.
+func (a *API) cancelAgreement(agreementId string, protocol string) (bool, error) {
+	ag, err := a.db.FindSingleAgreementByAgreementId(agreementId, protocol, []persistence.AFilter{persistence.UnarchivedAFilter()})
+	if err != nil {
+		return false, err
+	} else if ag == nil {
+		return false, nil
+	}
+
+	if ag.AgreementTimedout == 0 {
+		// Update the database
+		if _, err := a.db.AgreementTimedout(ag.CurrentAgreementId, ag.AgreementProtocol); err != nil {
+			glog.Errorf(APIlogString(fmt.Sprintf("error marking agreement %v terminated: %v", ag.CurrentAgreementId, err)))
+		}
+		a.Messages() <- events.NewABApiAgreementCancelationMessage(events.AGREEMENT_ENDED, ag.AgreementProtocol, ag.CurrentAgreementId)
+	} else {
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("agreement %v not deleted, already timed out at %v", agreementId, ag.AgreementTimedout)))
+	}
+	return true, nil
+}
+
+// Cancel the selected agreements in the background.
+func (a *API) startBulkCancel(selector AgreementSelector, agreements []BulkCancelAgreement, maxPerMinute int) {
+	go func() {
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("bulk cancel of %v agreements selected by %v, %v per minute", len(agreements), selector, maxPerMinute)))
+
+		cancelled := 0
+		paceCancellations(agreements, maxPerMinute, time.Sleep, a.cancelPacer.wait, func(ag *BulkCancelAgreement) bool {
+			if a.shutdownError != "" {
+				glog.Warningf(APIlogString(fmt.Sprintf("bulk cancel stopped by agbot shutdown after %v of %v agreements", cancelled, len(agreements))))
+				return false
+			} else if found, err := a.cancelAgreement(ag.AgreementId, ag.Protocol); err != nil {
+				glog.Errorf(APIlogString(fmt.Sprintf("error finding agreement %v, error: %v", ag.AgreementId, err)))
+			} else if found {
+				cancelled += 1
+			}
+			return true
+		})
+
+		glog.V(3).Infof(APIlogString(fmt.Sprintf("bulk cancel selected by %v cancelled %v of %v agreements", selector, cancelled, len(agreements))))
+	}()
+}
@@ -0,0 +1,178 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/agreementbot/persistence/memory"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+	"time"
+)
+
+func Test_AgreementSelector_Validate(t *testing.T) {
+	valid := []AgreementSelector{
+		{PolicyName: "org/bp"},
+		{Pattern: "org/pat", NodeOrg: "org2"},
+		{Service: "IBM/https://bluehorizon.network/services/gps", ServiceVersion: "[1.0.0,2.0.0)"},
+		{Service: "IBM/gps", ServiceVersion: "1.2.3"},
+		{NodeProperty: "store = s1"},
+	}
+	for _, s := range valid {
+		if err := s.Validate(); err != nil {
+			t.Errorf("selector %v should be valid, error: %v", s, err)
+		}
+	}
+
+	invalid := []AgreementSelector{
+		{},
+		{PolicyName: "org/bp", Pattern: "org/pat"},
+		{ServiceVersion: "1.0.0"},
+		{Service: "gps"},
+		{Service: "IBM/gps", ServiceVersion: "one"},
+		{NodeProperty: "store"},
+		{NodeProperty: "=s1"},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("selector %v should not be valid", s)
+		}
+	}
+}
+
+func Test_AgreementSelector_Matches(t *testing.T) {
+	patternPolicy := `{"workloads":[{"workloadUrl":"https://bluehorizon.network/services/gps","organization":"IBM","version":"2.0.1","arch":"amd64"}]}`
+
+	policyAg := &persistence.Agreement{DeviceId: "org1/n1", PolicyName: "org1/bp", ServiceId: []string{"IBM/https://bluehorizon.network/services/gps_1.2.3_amd64", "IBM/cpu_1.0.0_amd64"}}
+	patternAg := &persistence.Agreement{DeviceId: "org2/n2", PolicyName: "org1/pat_IBM_amd64", Pattern: "org1/pat", Policy: patternPolicy}
+
+	tests := []struct {
+		selector AgreementSelector
+		policy   bool
+		pattern  bool
+	}{
+		{AgreementSelector{PolicyName: "org1/bp"}, true, false},
+		{AgreementSelector{Pattern: "org1/pat"}, false, true},
+		{AgreementSelector{NodeOrg: "org2"}, false, true},
+		{AgreementSelector{Service: "IBM/https://bluehorizon.network/services/gps"}, true, true},
+		{AgreementSelector{Service: "IBM/https://bluehorizon.network/services/gps", ServiceVersion: "1.2.3"}, true, false},
+		{AgreementSelector{Service: "IBM/https://bluehorizon.network/services/gps", ServiceVersion: "[2.0.0,3.0.0)"}, false, true},
+		{AgreementSelector{Service: "IBM/cpu", NodeOrg: "org1"}, true, false},
+		{AgreementSelector{Service: "IBM/netspeed"}, false, false},
+	}
+	for _, test := range tests {
+		if matches := test.selector.Matches(policyAg); matches != test.policy {
+			t.Errorf("selector %v matches policy agreement: %v, expected %v", test.selector, matches, test.policy)
+		}
+		if matches := test.selector.Matches(patternAg); matches != test.pattern {
+			t.Errorf("selector %v matches pattern agreement: %v, expected %v", test.selector, matches, test.pattern)
+		}
+	}
+
+	s := AgreementSelector{NodeProperty: "store=s1"}
+	if !s.MatchesNode(externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", "s1")}) {
+		t.Errorf("node in store s1 should match")
+	} else if s.MatchesNode(externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", "s2")}) {
+		t.Errorf("node in store s2 should not match")
+	} else if s.MatchesNode(externalpolicy.PropertyList{}) {
+		t.Errorf("node without the property should not match")
+	}
+}
+
+func Test_selectAgreements(t *testing.T) {
+	db := new(memory.AgbotMemoryDB)
+	if err := db.Initialize(&config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true}}); err != nil {
+		t.Fatalf("unable to initialize database, error: %v", err)
+	}
+	defer db.Close()
+
+	for _, node := range []string{"org1/n1", "org1/n2", "org1/n3"} {
+		if err := db.AgreementAttempt("ag-"+node[5:], "org1", node, "device", "org1/bp", "", "", "", policy.BasicProtocol, "", []string{"IBM/gps_1.0.0_amd64"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unable to create agreement, error: %v", err)
+		}
+	}
+	if _, err := db.AgreementTimedout("ag-n3", policy.BasicProtocol); err != nil {
+		t.Fatalf("unable to time out agreement, error: %v", err)
+	}
+
+	stores := map[string]string{"org1/n1": "s1", "org1/n2": "s2"}
+	nodeProperties := func(nodeId string) (externalpolicy.PropertyList, error) {
+		if store, ok := stores[nodeId]; ok {
+			return externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", store)}, nil
+		}
+		return nil, errors.New("unknown node")
+	}
+
+	if selected, err := selectAgreements(db, &AgreementSelector{PolicyName: "org1/bp"}, nodeProperties); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if len(selected) != 2 {
+		t.Errorf("cancelled agreements should not be selected: %v", selected)
+	}
+
+	if selected, err := selectAgreements(db, &AgreementSelector{PolicyName: "org1/bp", NodeProperty: "store=s2"}, nodeProperties); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if len(selected) != 1 || selected[0].AgreementId != "ag-n2" || selected[0].DeviceId != "org1/n2" {
+		t.Errorf("wrong agreements selected by node property: %v", selected)
+	}
+
+	stores = map[string]string{}
+	if _, err := selectAgreements(db, &AgreementSelector{NodeProperty: "store=s2"}, nodeProperties); err == nil {
+		t.Errorf("expected an error when the node properties cannot be read")
+	}
+}
+
+func Test_paceCancellations(t *testing.T) {
+	agreements := []BulkCancelAgreement{{AgreementId: "ag1"}, {AgreementId: "ag2"}, {AgreementId: "ag3"}}
+
+	slept := make([]time.Duration, 0)
+	waited := 0
+	cancelled := make([]string, 0)
+	paceCancellations(agreements, 30, func(d time.Duration) { slept = append(slept, d) }, func() { waited += 1 }, func(ag *BulkCancelAgreement) bool {
+		cancelled = append(cancelled, ag.AgreementId)
+		return true
+	})
+
+	if len(cancelled) != 3 {
+		t.Errorf("all agreements should be cancelled: %v", cancelled)
+	} else if len(slept) != 2 || slept[0] != 2*time.Second {
+		t.Errorf("cancellations should be 2 seconds apart: %v", slept)
+	} else if waited != 3 {
+		t.Errorf("each cancellation should wait on the shared pacer, waited %v times", waited)
+	}
+
+	cancelled = make([]string, 0)
+	paceCancellations(agreements, 30, func(d time.Duration) {}, func() {}, func(ag *BulkCancelAgreement) bool {
+		cancelled = append(cancelled, ag.AgreementId)
+		return ag.AgreementId != "ag2"
+	})
+	if len(cancelled) != 2 {
+		t.Errorf("cancelling should stop early: %v", cancelled)
+	}
+}
+
+// Bulk cancels that run at the same time share the rate of the agbot.
+func Test_cancelPacer(t *testing.T) {
+	now := time.Unix(1000, 0)
+	slept := make([]time.Duration, 0)
+	p := newCancelPacer(60)
+	p.now = func() time.Time { return now }
+	p.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	// Three cancellations at the same time are spread a second apart.
+	p.wait()
+	p.wait()
+	p.wait()
+	if len(slept) != 2 || slept[0] != time.Second || slept[1] != 2*time.Second {
+		t.Errorf("cancellations should be a second apart: %v", slept)
+	}
+
+	// Once the reserved slots have passed, a cancellation does not wait.
+	now = now.Add(time.Minute)
+	p.wait()
+	if len(slept) != 2 {
+		t.Errorf("cancellation should not wait: %v", slept)
+	}
+}
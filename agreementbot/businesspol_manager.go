@@ -12,6 +12,7 @@ import (
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/externalpolicy"
 	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/schedule"
 	"golang.org/x/crypto/sha3"
 	"reflect"
 	"sort"
@@ -79,6 +80,10 @@ type BusinessPolicyEntry struct {
 	Updated         uint64                         `json:"updatedTime,omitempty"`     // the time when this entry was updated
 	Hash            []byte                         `json:"hash,omitempty"`            // a hash of the business policy to compare for matadata changes in the exchange
 	ServicePolicies map[string]*ServicePolicyEntry `json:"servicePolicies,omitempty"` // map of the service id and service policies
+	Rollout         *businesspolicy.RolloutPolicy  `json:"rollout,omitempty"`         // the staged rollout of the business policy, nil when it is deployed to all nodes at once
+	Maintenance     *schedule.MaintenanceSchedule  `json:"maintenance,omitempty"`     // when agreements can be formed and upgraded, nil when there are no restrictions
+	NodeRanking     *businesspolicy.NodeRanking    `json:"nodeRanking,omitempty"`     // the order in which agreements are made with the nodes found, nil for the search order
+	Placement       *businesspolicy.Placement      `json:"placement,omitempty"`       // the limits on where the service is placed, nil when there are no limits
 }
 
 // return a pointer to a copy of BusinessPolicyEntry
@@ -110,7 +115,19 @@ func (p *BusinessPolicyEntry) DeepCopy() *BusinessPolicyEntry {
 		}
 	}
 
-	copyBusinessPolicyEntry := BusinessPolicyEntry{Policy: newPolicy, Updated: newUpdated, Hash: newHash, ServicePolicies: newServePolicy}
+	var newRollout *businesspolicy.RolloutPolicy
+	if p.Rollout != nil {
+		r := *p.Rollout
+		newRollout = &r
+	}
+
+	var newRanking *businesspolicy.NodeRanking
+	if p.NodeRanking != nil {
+		r := *p.NodeRanking
+		newRanking = &r
+	}
+
+	copyBusinessPolicyEntry := BusinessPolicyEntry{Policy: newPolicy, Updated: newUpdated, Hash: newHash, ServicePolicies: newServePolicy, Rollout: newRollout, Maintenance: p.Maintenance.DeepCopy(), NodeRanking: newRanking, Placement: p.Placement.DeepCopy()}
 	return &copyBusinessPolicyEntry
 
 }
@@ -135,6 +152,10 @@ func NewBusinessPolicyEntry(pol *businesspolicy.BusinessPolicy, polId string) (*
 		return nil, fmt.Errorf("Failed to convert the business policy to internal policy format: %v. %v", *pol, err)
 	} else {
 		pBE.Policy = pPolicy
+		pBE.Rollout = pol.Rollout
+		pBE.Maintenance = pol.Maintenance
+		pBE.NodeRanking = pol.NodeRanking
+		pBE.Placement = pol.Placement
 	}
 
 	return pBE, nil
@@ -145,8 +166,12 @@ func (p *BusinessPolicyEntry) String() string {
 		"Updated: %v "+
 		"Hash: %x "+
 		"Policy: %v"+
-		"ServicePolicies: %v",
-		p.Updated, p.Hash, p.Policy, p.ServicePolicies)
+		"ServicePolicies: %v "+
+		"Rollout: %v "+
+		"Maintenance: %v "+
+		"NodeRanking: %v "+
+		"Placement: %v",
+		p.Updated, p.Hash, p.Policy, p.ServicePolicies, p.Rollout, p.Maintenance, p.NodeRanking, p.Placement)
 }
 
 func (p *BusinessPolicyEntry) ShortString() string {
@@ -245,6 +270,10 @@ func (p *BusinessPolicyEntry) UpdateEntry(pol *businesspolicy.BusinessPolicy, po
 		return nil, fmt.Errorf("Failed to convert the business policy to internal policy format: %v. %v", *pol, err)
 	} else {
 		p.Policy = pPolicy
+		p.Rollout = pol.Rollout
+		p.Maintenance = pol.Maintenance
+		p.NodeRanking = pol.NodeRanking
+		p.Placement = pol.Placement
 		return pPolicy, nil
 	}
 }
@@ -48,6 +48,7 @@ type ConsumerProtocolHandler interface {
 	GetTerminationCode(reason string) uint
 	GetTerminationReason(code uint) string
 	IsTerminationReasonNodeShutdown(code uint) bool
+	IsTerminationReasonFailure(code uint) bool
 	GetSendMessage() func(mt interface{}, pay []byte) error
 	RecordConsumerAgreementState(agreementId string, pol *policy.Policy, org string, state string, workerID string) error
 	DeleteMessage(msgId int) error
@@ -39,6 +39,17 @@ func (c *ConsumerPHMgr) Get(protocol string) ConsumerProtocolHandler {
 	return c.cphMap[protocol]
 }
 
+// Returns the state of the work queue of each CPH, keyed by protocol.
+func (c *ConsumerPHMgr) WorkQueueStatus() map[string]WorkQueueStatus {
+	c.mapLock.Lock()
+	defer c.mapLock.Unlock()
+	res := make(map[string]WorkQueueStatus, len(c.cphMap))
+	for protocol, cph := range c.cphMap {
+		res[protocol] = cph.WorkQueue().Status()
+	}
+	return res
+}
+
 // Iterate over each CPH.
 func (c *ConsumerPHMgr) GetAll() []string {
 	c.mapLock.Lock()
@@ -0,0 +1,108 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/compcheck"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"sort"
+)
+
+// A what-if analysis of a change to a deployment policy. The proposed policy is checked for compatibility with every
+// node in the orgs that this agbot serves the policy to, using the same policy and user input checks as the
+// /deploycheck/deploycompatible API. The result is compared with the current agreements for the policy so that the
+// caller can see which nodes would gain an agreement, keep their agreement or lose it.
+
+// The input of the /deploycheck/impact API.
+type DeployImpactCheck struct {
+	BusinessPolId  string                         `json:"business_policy_id"`        // the exchange id (org/name) of the deployment policy, required
+	BusinessPolicy *businesspolicy.BusinessPolicy `json:"business_policy,omitempty"` // the proposed policy, the policy in the exchange is used if omitted
+	ServicePolicy  *externalpolicy.ExternalPolicy `json:"service_policy,omitempty"`  // the proposed service policy, the one in the exchange is used if omitted
+}
+
+func (d DeployImpactCheck) String() string {
+	return fmt.Sprintf("BusinessPolId: %v, BusinessPolicy: %v, ServicePolicy: %v", d.BusinessPolId, d.BusinessPolicy, d.ServicePolicy)
+}
+
+// A node whose agreement would be affected by the change.
+type DeployImpactNode struct {
+	NodeId      string            `json:"node_id"`
+	NodeArch    string            `json:"node_arch,omitempty"`
+	AgreementId string            `json:"agreement_id,omitempty"` // the current agreement with the node, for nodes that keep or lose it
+	Reason      map[string]string `json:"reason,omitempty"`       // why the node is not compatible, for nodes that lose their agreement
+}
+
+// The output of the /deploycheck/impact API.
+type DeployImpactOutput struct {
+	BusinessPolId string             `json:"business_policy_id"`
+	NodeOrgs      []string           `json:"node_orgs"`     // the orgs the policy is served to
+	NodesChecked  int                `json:"nodes_checked"` // the number of nodes that were checked
+	Gain          []DeployImpactNode `json:"gain"`          // compatible nodes without an agreement
+	Keep          []DeployImpactNode `json:"keep"`          // compatible nodes with an agreement
+	Lose          []DeployImpactNode `json:"lose"`          // nodes with an agreement that are no longer compatible
+	Errors        map[string]string  `json:"errors,omitempty"`
+}
+
+// Checks the compatibility of the proposed policy with one node.
+type nodeCompatibleFunc func(nodeId string) (*compcheck.CompCheckOutput, error)
+
+// Classify the nodes by the effect that the proposed policy would have on them. The nodes are the ones found in the
+// served orgs, nodes that have an agreement for the policy are checked too even if they were not found. Nodes that use
+// a pattern or are not registered are skipped because they cannot make an agreement for a deployment policy.
+func evaluateDeployImpact(bpId string, nodeOrgs []string, nodes map[string]exchange.Device, agreements []persistence.Agreement, check nodeCompatibleFunc) *DeployImpactOutput {
+
+	output := &DeployImpactOutput{
+		BusinessPolId: bpId,
+		NodeOrgs:      nodeOrgs,
+		Gain:          []DeployImpactNode{},
+		Keep:          []DeployImpactNode{},
+		Lose:          []DeployImpactNode{},
+		Errors:        map[string]string{},
+	}
+
+	// The current agreements for the policy, keyed by node id.
+	current := make(map[string]string)
+	for _, ag := range agreements {
+		if !ag.Archived && ag.AgreementTimedout == 0 && ag.Pattern == "" && ag.PolicyName == bpId {
+			current[ag.DeviceId] = ag.CurrentAgreementId
+		}
+	}
+
+	nodeIds := make([]string, 0, len(nodes)+len(current))
+	for id, dev := range nodes {
+		if _, ok := current[id]; ok || (dev.Pattern == "" && dev.PublicKey != "") {
+			nodeIds = append(nodeIds, id)
+		}
+	}
+	for id := range current {
+		if _, ok := nodes[id]; !ok {
+			nodeIds = append(nodeIds, id)
+		}
+	}
+	sort.Strings(nodeIds)
+
+	for _, id := range nodeIds {
+		compOutput, err := check(id)
+		if err != nil {
+			output.Errors[id] = err.Error()
+			continue
+		}
+		output.NodesChecked += 1
+
+		node := DeployImpactNode{NodeId: id, NodeArch: nodes[id].Arch, AgreementId: current[id]}
+		if node.AgreementId == "" {
+			if compOutput.Compatible {
+				output.Gain = append(output.Gain, node)
+			}
+		} else if compOutput.Compatible {
+			output.Keep = append(output.Keep, node)
+		} else {
+			node.Reason = compOutput.Reason
+			output.Lose = append(output.Lose, node)
+		}
+	}
+
+	return output
+}
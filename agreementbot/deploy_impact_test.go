@@ -0,0 +1,65 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/compcheck"
+	"github.com/open-horizon/anax/exchange"
+	"testing"
+)
+
+func Test_evaluateDeployImpact(t *testing.T) {
+
+	bpId := "myorg/bp1"
+	nodes := map[string]exchange.Device{
+		"myorg/n1": exchange.Device{Arch: "amd64", PublicKey: "key"},                // compatible, no agreement -> gain
+		"myorg/n2": exchange.Device{Arch: "amd64", PublicKey: "key"},                // compatible, agreement -> keep
+		"myorg/n3": exchange.Device{Arch: "arm", PublicKey: "key"},                  // not compatible, agreement -> lose
+		"myorg/n4": exchange.Device{Arch: "amd64", PublicKey: "key"},                // not compatible, no agreement -> not listed
+		"myorg/n5": exchange.Device{Arch: "amd64", PublicKey: "key", Pattern: "p1"}, // pattern node -> skipped
+		"myorg/n6": exchange.Device{Arch: "amd64"},                                  // not registered -> skipped
+		"myorg/n7": exchange.Device{Arch: "amd64", PublicKey: "key"},                // check fails -> error
+	}
+	agreements := []persistence.Agreement{
+		persistence.Agreement{CurrentAgreementId: "a2", DeviceId: "myorg/n2", PolicyName: bpId},
+		persistence.Agreement{CurrentAgreementId: "a3", DeviceId: "myorg/n3", PolicyName: bpId},
+		persistence.Agreement{CurrentAgreementId: "a4", DeviceId: "myorg/n4", PolicyName: "myorg/bp2"},
+		persistence.Agreement{CurrentAgreementId: "a1", DeviceId: "myorg/n1", PolicyName: bpId, AgreementTimedout: 1},
+		persistence.Agreement{CurrentAgreementId: "a8", DeviceId: "otherorg/n8", PolicyName: bpId}, // not in the node list, still checked
+	}
+
+	checked := map[string]bool{}
+	check := func(nodeId string) (*compcheck.CompCheckOutput, error) {
+		checked[nodeId] = true
+		switch nodeId {
+		case "myorg/n1", "myorg/n2":
+			return compcheck.NewCompCheckOutput(true, map[string]string{}, nil), nil
+		case "myorg/n7":
+			return nil, errors.New("exchange error")
+		default:
+			return compcheck.NewCompCheckOutput(false, map[string]string{"svc": "Incompatible"}, nil), nil
+		}
+	}
+
+	output := evaluateDeployImpact(bpId, []string{"myorg"}, nodes, agreements, check)
+
+	if checked["myorg/n5"] || checked["myorg/n6"] {
+		t.Errorf("pattern and unregistered nodes should not be checked: %v", checked)
+	} else if !checked["otherorg/n8"] {
+		t.Errorf("node with an agreement should be checked even if it is not in the served orgs: %v", checked)
+	} else if output.NodesChecked != 5 {
+		t.Errorf("expected 5 nodes checked, got %v", output.NodesChecked)
+	} else if len(output.Gain) != 1 || output.Gain[0].NodeId != "myorg/n1" || output.Gain[0].AgreementId != "" {
+		t.Errorf("unexpected gain: %v", output.Gain)
+	} else if len(output.Keep) != 1 || output.Keep[0].NodeId != "myorg/n2" || output.Keep[0].AgreementId != "a2" {
+		t.Errorf("unexpected keep: %v", output.Keep)
+	} else if len(output.Lose) != 2 || output.Lose[0].NodeId != "myorg/n3" || output.Lose[1].NodeId != "otherorg/n8" {
+		t.Errorf("unexpected lose: %v", output.Lose)
+	} else if output.Lose[0].AgreementId != "a3" || output.Lose[0].Reason["svc"] != "Incompatible" || output.Lose[0].NodeArch != "arm" {
+		t.Errorf("unexpected lose details: %v", output.Lose[0])
+	} else if len(output.Errors) != 1 || output.Errors["myorg/n7"] == "" {
+		t.Errorf("unexpected errors: %v", output.Errors)
+	}
+}
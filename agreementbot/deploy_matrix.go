@@ -0,0 +1,163 @@
+package agreementbot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/compcheck"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"sort"
+)
+
+// A compatibility matrix checks a set of deployment policies and patterns against a set of nodes, using the same
+// checks as the /deploycheck/deploycompatible API for every node and deployment. The nodes are either listed or are
+// all the nodes in an org, optionally narrowed down by constraints on their node policy properties. The check of a cell
+// reads the exchange resources through a cache shared by the whole matrix, so each deployment is resolved once and each
+// node policy is read once, however many cells use them.
+
+// The type of a deployment in the matrix.
+const (
+	DEPLOY_MATRIX_POLICY  = "policy"
+	DEPLOY_MATRIX_PATTERN = "pattern"
+)
+
+// The input of the /deploycheck/matrix API.
+type DeployMatrixCheck struct {
+	BusinessPolIds []string                            `json:"business_policy_ids,omitempty"` // the deployment policies to check, org/name
+	PatternIds     []string                            `json:"pattern_ids,omitempty"`         // the patterns to check, org/name
+	NodeIds        []string                            `json:"node_ids,omitempty"`            // the nodes to check, org/id
+	NodeOrg        string                              `json:"node_org,omitempty"`            // check all the nodes in the org, mutually exclusive with node_ids
+	NodeSelector   externalpolicy.ConstraintExpression `json:"node_selector,omitempty"`       // only check the nodes whose properties satisfy the constraints
+}
+
+func (d DeployMatrixCheck) String() string {
+	return fmt.Sprintf("BusinessPolIds: %v, PatternIds: %v, NodeIds: %v, NodeOrg: %v, NodeSelector: %v", d.BusinessPolIds, d.PatternIds, d.NodeIds, d.NodeOrg, d.NodeSelector)
+}
+
+func (d *DeployMatrixCheck) Validate() error {
+	if len(d.BusinessPolIds) == 0 && len(d.PatternIds) == 0 {
+		return errors.New("at least one deployment policy or pattern must be specified")
+	} else if len(d.NodeIds) == 0 && d.NodeOrg == "" {
+		return errors.New("either node_ids or node_org must be specified")
+	} else if len(d.NodeIds) != 0 && d.NodeOrg != "" {
+		return errors.New("node_ids and node_org are mutually exclusive")
+	}
+	for _, id := range append(append(append([]string{}, d.BusinessPolIds...), d.PatternIds...), d.NodeIds...) {
+		if org, name := exchange.GetOrg(id), exchange.GetId(id); org == "" || name == "" {
+			return fmt.Errorf("%v must be in the format of org/name", id)
+		}
+	}
+	if len(d.NodeSelector) != 0 {
+		if _, err := d.NodeSelector.Validate(); err != nil {
+			return fmt.Errorf("node_selector %v is not valid, %v", d.NodeSelector, err)
+		}
+	}
+	return nil
+}
+
+// Returns the deployments in the order of the columns of the matrix, policies first.
+func (d *DeployMatrixCheck) Deployments() []DeployMatrixDeployment {
+	deployments := make([]DeployMatrixDeployment, 0, len(d.BusinessPolIds)+len(d.PatternIds))
+	for _, id := range d.BusinessPolIds {
+		deployments = append(deployments, DeployMatrixDeployment{Id: id, Type: DEPLOY_MATRIX_POLICY})
+	}
+	for _, id := range d.PatternIds {
+		deployments = append(deployments, DeployMatrixDeployment{Id: id, Type: DEPLOY_MATRIX_PATTERN})
+	}
+	return deployments
+}
+
+// Returns the orgs that the nodes are read from.
+func (d *DeployMatrixCheck) NodeOrgs() []string {
+	if d.NodeOrg != "" {
+		return []string{d.NodeOrg}
+	}
+	orgs := make([]string, 0)
+	found := make(map[string]bool)
+	for _, id := range d.NodeIds {
+		if org := exchange.GetOrg(id); !found[org] {
+			found[org] = true
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs
+}
+
+// A column of the matrix.
+type DeployMatrixDeployment struct {
+	Id   string `json:"id"`   // org/name
+	Type string `json:"type"` // policy or pattern
+}
+
+// The result of the check of one deployment against one node.
+type DeployMatrixCell struct {
+	Compatible bool              `json:"compatible"`
+	Reason     map[string]string `json:"reason,omitempty"` // the reason for each service, as in the /deploycheck/deploycompatible output
+	Error      string            `json:"error,omitempty"`  // the node could not be checked
+}
+
+// A row of the matrix.
+type DeployMatrixNode struct {
+	NodeId   string             `json:"node_id"`
+	NodeArch string             `json:"node_arch,omitempty"`
+	Results  []DeployMatrixCell `json:"results"` // in the order of the deployments
+}
+
+// The output of the /deploycheck/matrix API.
+type DeployMatrixOutput struct {
+	Deployments []DeployMatrixDeployment `json:"deployments"`
+	Nodes       []DeployMatrixNode       `json:"nodes"`
+	Errors      map[string]string        `json:"errors,omitempty"` // nodes that could not be found or selected
+}
+
+// Checks the compatibility of one deployment with one node.
+type deployMatrixCheckFunc func(nodeId string, deployment DeployMatrixDeployment) (*compcheck.CompCheckOutput, error)
+
+// Build the matrix for the nodes that are selected. The nodes are the listed nodes, or all the nodes that were read
+// when none are listed.
+func evaluateDeployMatrix(input *DeployMatrixCheck, nodes map[string]exchange.Device, nodeProperties func(nodeId string) (externalpolicy.PropertyList, error), check deployMatrixCheckFunc) *DeployMatrixOutput {
+
+	output := &DeployMatrixOutput{
+		Deployments: input.Deployments(),
+		Nodes:       []DeployMatrixNode{},
+		Errors:      map[string]string{},
+	}
+
+	nodeIds := input.NodeIds
+	if len(nodeIds) == 0 {
+		nodeIds = make([]string, 0, len(nodes))
+		for id := range nodes {
+			nodeIds = append(nodeIds, id)
+		}
+	}
+	sort.Strings(nodeIds)
+
+	for _, id := range nodeIds {
+		dev, ok := nodes[id]
+		if !ok {
+			output.Errors[id] = "node not found"
+			continue
+		}
+
+		if len(input.NodeSelector) != 0 {
+			if props, err := nodeProperties(id); err != nil {
+				output.Errors[id] = err.Error()
+				continue
+			} else if input.NodeSelector.IsSatisfiedBy(props) != nil {
+				continue
+			}
+		}
+
+		row := DeployMatrixNode{NodeId: id, NodeArch: dev.Arch, Results: make([]DeployMatrixCell, 0, len(output.Deployments))}
+		for _, deployment := range output.Deployments {
+			if compOutput, err := check(id, deployment); err != nil {
+				row.Results = append(row.Results, DeployMatrixCell{Error: err.Error()})
+			} else {
+				row.Results = append(row.Results, DeployMatrixCell{Compatible: compOutput.Compatible, Reason: compOutput.Reason})
+			}
+		}
+		output.Nodes = append(output.Nodes, row)
+	}
+
+	return output
+}
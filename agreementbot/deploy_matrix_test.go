@@ -0,0 +1,87 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/compcheck"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	_ "github.com/open-horizon/anax/externalpolicy/text_language"
+	"testing"
+)
+
+func Test_DeployMatrixCheck_Validate(t *testing.T) {
+	valid := []DeployMatrixCheck{
+		{BusinessPolIds: []string{"org/bp"}, NodeOrg: "org"},
+		{PatternIds: []string{"IBM/pat"}, NodeIds: []string{"org/n1", "org2/n2"}},
+		{BusinessPolIds: []string{"org/bp"}, NodeOrg: "org", NodeSelector: externalpolicy.ConstraintExpression{"purpose == test"}},
+	}
+	for _, input := range valid {
+		if err := input.Validate(); err != nil {
+			t.Errorf("input %v should be valid, error: %v", input, err)
+		}
+	}
+
+	invalid := []DeployMatrixCheck{
+		{NodeOrg: "org"},
+		{BusinessPolIds: []string{"org/bp"}},
+		{BusinessPolIds: []string{"org/bp"}, NodeOrg: "org", NodeIds: []string{"org/n1"}},
+		{BusinessPolIds: []string{"bp"}, NodeOrg: "org"},
+		{BusinessPolIds: []string{"org/bp"}, NodeIds: []string{"n1"}},
+		{BusinessPolIds: []string{"org/bp"}, NodeOrg: "org", NodeSelector: externalpolicy.ConstraintExpression{"purpose =="}},
+	}
+	for _, input := range invalid {
+		if err := input.Validate(); err == nil {
+			t.Errorf("input %v should not be valid", input)
+		}
+	}
+
+	input := DeployMatrixCheck{BusinessPolIds: []string{"org/bp"}, PatternIds: []string{"IBM/pat"}, NodeIds: []string{"org/n1", "org2/n2", "org/n3"}}
+	if orgs := input.NodeOrgs(); len(orgs) != 2 || orgs[0] != "org" || orgs[1] != "org2" {
+		t.Errorf("wrong node orgs %v", orgs)
+	} else if deps := input.Deployments(); len(deps) != 2 || deps[0].Type != DEPLOY_MATRIX_POLICY || deps[1] != (DeployMatrixDeployment{Id: "IBM/pat", Type: DEPLOY_MATRIX_PATTERN}) {
+		t.Errorf("wrong deployments %v", deps)
+	}
+}
+
+func Test_evaluateDeployMatrix(t *testing.T) {
+	nodes := map[string]exchange.Device{
+		"org/n1": {Arch: "amd64"},
+		"org/n2": {Arch: "arm64"},
+		"org/n3": {Arch: "amd64"},
+	}
+	purposes := map[string]string{"org/n1": "test", "org/n2": "test", "org/n3": "prod"}
+	nodeProperties := func(nodeId string) (externalpolicy.PropertyList, error) {
+		return externalpolicy.PropertyList{*externalpolicy.Property_Factory("purpose", purposes[nodeId])}, nil
+	}
+	check := func(nodeId string, deployment DeployMatrixDeployment) (*compcheck.CompCheckOutput, error) {
+		if nodeId == "org/n2" && deployment.Type == DEPLOY_MATRIX_PATTERN {
+			return nil, errors.New("exchange error")
+		} else if nodes[nodeId].Arch == "amd64" {
+			return compcheck.NewCompCheckOutput(true, map[string]string{"IBM/gps_1.0.0_amd64": "Compatible"}, nil), nil
+		}
+		return compcheck.NewCompCheckOutput(false, map[string]string{"IBM/gps_1.0.0_amd64": "Architecture Incompatible"}, nil), nil
+	}
+
+	// all the nodes in the org that are selected
+	input := &DeployMatrixCheck{BusinessPolIds: []string{"org/bp"}, PatternIds: []string{"IBM/pat"}, NodeOrg: "org", NodeSelector: externalpolicy.ConstraintExpression{"purpose == test"}}
+	output := evaluateDeployMatrix(input, nodes, nodeProperties, check)
+
+	if len(output.Deployments) != 2 || len(output.Nodes) != 2 || len(output.Errors) != 0 {
+		t.Fatalf("wrong matrix: %v", output)
+	}
+	if n1 := output.Nodes[0]; n1.NodeId != "org/n1" || n1.NodeArch != "amd64" || !n1.Results[0].Compatible || !n1.Results[1].Compatible {
+		t.Errorf("n1 should be compatible with both deployments: %v", n1)
+	}
+	if n2 := output.Nodes[1]; n2.NodeId != "org/n2" || n2.Results[0].Compatible || n2.Results[0].Reason["IBM/gps_1.0.0_amd64"] != "Architecture Incompatible" || n2.Results[1].Error == "" {
+		t.Errorf("n2 should be incompatible with the policy and fail the pattern check: %v", n2)
+	}
+
+	// listed nodes, one of them is unknown
+	input = &DeployMatrixCheck{BusinessPolIds: []string{"org/bp"}, NodeIds: []string{"org/n3", "org/n9"}}
+	output = evaluateDeployMatrix(input, nodes, nodeProperties, check)
+	if len(output.Nodes) != 1 || output.Nodes[0].NodeId != "org/n3" || output.Errors["org/n9"] == "" {
+		t.Errorf("wrong matrix for the listed nodes: %v", output)
+	}
+}
@@ -0,0 +1,216 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/config"
+	"sort"
+	"time"
+)
+
+// The low priority side of the work queue is where new agreement attempts wait for an agreement worker. A single large
+// policy change can queue thousands of attempts for one org, so the low priority work is kept in a lane per org (or per org
+// and deployment policy) and the lanes are served by weighted fair queuing. Each lane has a virtual time at which its head
+// should be served, the lane with the earliest virtual time goes next and its virtual time moves forward by 1/weight. A lane
+// that was empty starts at the current virtual time so that it cannot save up credit while it is idle. An org can also be
+// limited to a number of agreement attempts in progress at once, its lanes are skipped while it is at the limit. An attempt
+// is in progress from the time a worker takes it until the node replies to the proposal or the agreement is cancelled, which
+// includes the protocol timeout when the node does not reply. An attempt that is never resolved is released after the
+// attempt timeout so that a lost reply or cancellation cannot block its org forever.
+//
+// The fairQueue is not thread safe, it is protected by the bufferLock of the PrioritizedWorkQueue.
+
+type queuedWork struct {
+	work   *AgreementWork
+	queued time.Time
+}
+
+type fairLane struct {
+	org      string
+	work     []queuedWork
+	vtime    float64       // The virtual time at which the head of the lane should be served.
+	lastWait time.Duration // How long the last work item taken from the lane waited.
+}
+
+// An agreement attempt whose proposal was sent, it holds an in-flight slot of its org until the agreement is resolved.
+type pendingAttempt struct {
+	org  string
+	sent time.Time
+}
+
+type fairQueue struct {
+	fairness       config.WorkQueueFairnessConfig
+	attemptTimeout time.Duration             // How long a pending attempt can hold its slot, zero when there is no limit.
+	lanes          map[string]*fairLane      // The lanes with queued work, keyed by org or org/policy.
+	inFlight       map[string]int            // The number of agreement attempts in progress, keyed by org.
+	pending        map[string]pendingAttempt // The attempts waiting for the node, keyed by agreement id.
+	vtime          float64                   // The virtual time of the last work item taken from the queue.
+	length         int
+}
+
+func newFairQueue(fairness config.WorkQueueFairnessConfig, attemptTimeout time.Duration) *fairQueue {
+	return &fairQueue{
+		fairness:       fairness,
+		attemptTimeout: attemptTimeout,
+		lanes:          make(map[string]*fairLane),
+		inFlight:       make(map[string]int),
+		pending:        make(map[string]pendingAttempt),
+	}
+}
+
+// Returns the lane and the org of a work item. Only new agreement attempts have an org, all other work shares one lane.
+func (f *fairQueue) laneOf(w *AgreementWork) (string, string) {
+	if w == nil {
+		return "", ""
+	} else if wi, ok := (*w).(InitiateAgreement); !ok {
+		return "", ""
+	} else if f.fairness.ByPolicy {
+		return fmt.Sprintf("%v/%v", wi.Org, wi.ConsumerPolicyName), wi.Org
+	} else {
+		return wi.Org, wi.Org
+	}
+}
+
+func (f *fairQueue) add(w *AgreementWork, now time.Time) {
+	key, org := f.laneOf(w)
+	lane, ok := f.lanes[key]
+	if !ok {
+		lane = &fairLane{org: org, vtime: f.vtime}
+		f.lanes[key] = lane
+	}
+	lane.work = append(lane.work, queuedWork{work: w, queued: now})
+	f.length += 1
+}
+
+// Returns the lane whose head should be served next, or an empty string when there is no work that can be served now.
+func (f *fairQueue) next() (string, *AgreementWork) {
+	best := ""
+	var bestLane *fairLane
+	for key, lane := range f.lanes {
+		if max := f.fairness.GetMaxInFlight(lane.org); lane.org != "" && max > 0 && f.inFlight[lane.org] >= max {
+			continue
+		} else if bestLane == nil || lane.vtime < bestLane.vtime || (lane.vtime == bestLane.vtime && key < best) {
+			best, bestLane = key, lane
+		}
+	}
+	if bestLane == nil {
+		return "", nil
+	}
+	return best, bestLane.work[0].work
+}
+
+// Take the head of a lane, it is now in progress on a worker until done is called.
+func (f *fairQueue) remove(key string, now time.Time) {
+	lane, ok := f.lanes[key]
+	if !ok || len(lane.work) == 0 {
+		return
+	}
+
+	lane.lastWait = now.Sub(lane.work[0].queued)
+	lane.work = lane.work[1:]
+	f.length -= 1
+	if lane.org != "" {
+		f.inFlight[lane.org] += 1
+	}
+
+	f.vtime = lane.vtime
+	lane.vtime += 1.0 / float64(f.fairness.GetWeight(key, lane.org))
+	if len(lane.work) == 0 {
+		delete(f.lanes, key)
+	}
+}
+
+// Called when a worker has finished with a work item taken from the queue and no agreement is waiting for the node.
+func (f *fairQueue) done(w *AgreementWork) {
+	_, org := f.laneOf(w)
+	f.release(org)
+}
+
+// Called when a worker has sent the proposal of a new agreement attempt. The attempt keeps its in-flight slot until
+// resolved is called with its agreement id.
+func (f *fairQueue) sent(w *AgreementWork, agreementId string, now time.Time) {
+	if _, org := f.laneOf(w); org == "" {
+		return
+	} else if _, ok := f.pending[agreementId]; ok {
+		f.release(org)
+	} else {
+		f.pending[agreementId] = pendingAttempt{org: org, sent: now}
+	}
+}
+
+// Called when the node replied to a proposal or the agreement was cancelled. Returns true if the agreement was holding
+// an in-flight slot.
+func (f *fairQueue) resolved(agreementId string) bool {
+	if p, ok := f.pending[agreementId]; ok {
+		delete(f.pending, agreementId)
+		f.release(p.org)
+		return true
+	}
+	return false
+}
+
+// Release the slots of the attempts that have been waiting for longer than the attempt timeout.
+func (f *fairQueue) expire(now time.Time) {
+	if f.attemptTimeout <= 0 {
+		return
+	}
+	for agreementId, p := range f.pending {
+		if now.Sub(p.sent) > f.attemptTimeout {
+			delete(f.pending, agreementId)
+			f.release(p.org)
+		}
+	}
+}
+
+func (f *fairQueue) release(org string) {
+	if org != "" && f.inFlight[org] > 0 {
+		f.inFlight[org] -= 1
+		if f.inFlight[org] == 0 {
+			delete(f.inFlight, org)
+		}
+	}
+}
+
+// The state of a lane of the work queue, as reported on the /status/workers API.
+type WorkQueueLaneStatus struct {
+	Org         string `json:"org"`
+	Weight      int    `json:"weight"`
+	Depth       int    `json:"depth"`
+	OldestWaitS int64  `json:"oldest_wait_s"` // how long the head of the lane has been waiting for a worker
+	LastWaitS   int64  `json:"last_wait_s"`   // how long the last work item taken from the lane waited for a worker
+}
+
+// The state of a work queue, as reported on the /status/workers API.
+type WorkQueueStatus struct {
+	HighDepth int                            `json:"high_depth"`
+	LowDepth  int                            `json:"low_depth"`
+	Lanes     map[string]WorkQueueLaneStatus `json:"lanes"`     // the low priority lanes with queued work, keyed by org or org/policy
+	InFlight  map[string]int                 `json:"in_flight"` // the agreement attempts in progress, keyed by org
+}
+
+func (f *fairQueue) status(now time.Time) (map[string]WorkQueueLaneStatus, map[string]int) {
+	lanes := make(map[string]WorkQueueLaneStatus, len(f.lanes))
+	for key, lane := range f.lanes {
+		lanes[key] = WorkQueueLaneStatus{
+			Org:         lane.org,
+			Weight:      f.fairness.GetWeight(key, lane.org),
+			Depth:       len(lane.work),
+			OldestWaitS: int64(now.Sub(lane.work[0].queued).Seconds()),
+			LastWaitS:   int64(lane.lastWait.Seconds()),
+		}
+	}
+	inFlight := make(map[string]int, len(f.inFlight))
+	for org, n := range f.inFlight {
+		inFlight[org] = n
+	}
+	return lanes, inFlight
+}
+
+// Returns the lanes with queued work, for logging.
+func (f *fairQueue) String() string {
+	keys := make([]string, 0, len(f.lanes))
+	for key, lane := range f.lanes {
+		keys = append(keys, fmt.Sprintf("%v: %v", key, len(lane.work)))
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("Lanes: %v, InFlight: %v", keys, f.inFlight)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/archive"
 	"github.com/open-horizon/anax/agreementbot/persistence"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/events"
@@ -483,25 +484,80 @@ func (w *AgreementBotWorker) GovernArchivedAgreements() int {
 		}
 	}
 
-	// Find all archived agreements that are old enough and delete them.
-	for _, agp := range policy.AllAgreementProtocols() {
-		now := time.Now().Unix()
-		if agreements, err := w.db.FindAgreements([]persistence.AFilter{persistence.ArchivedAFilter(), agedOutFilter(now, ageLimit)}, agp); err == nil {
-			for _, ag := range agreements {
-				if err := w.db.DeleteAgreement(ag.CurrentAgreementId, agp); err != nil {
-					glog.Error(logString(fmt.Sprintf("error deleting archived agreement %v, error: %v", ag.CurrentAgreementId, err)))
-				} else {
-					glog.V(3).Infof(logString(fmt.Sprintf("archive purge deleted %v", ag.CurrentAgreementId)))
+	// Each agbot purges the archived agreements in its own partition. The partitions that no live agbot owns, because their
+	// owner stopped, are purged by the leader of the agbots sharing the database, so that their archived agreements do not
+	// pile up. The partitions of the other live agbots are left to their owners.
+	loads, err := persistence.GetPartitionLoads(w.db, w.Config.GetPartitionStale())
+	if err != nil {
+		glog.Errorf(logString(fmt.Sprintf("unable to read partitions from database, error: %v", err)))
+		return 0
+	}
+
+	purgeOrphans := w.purgeOrphans != nil && w.purgeOrphans()
+	partitions := make([]string, 0, len(loads))
+	for _, load := range loads {
+		if load.Id == w.db.PrimaryPartition() || (!load.Live && purgeOrphans) {
+			partitions = append(partitions, load.Id)
+		}
+	}
+
+	// Find all archived agreements that are old enough and delete them. If an archive sink is configured, the agreements
+	// are written to the sink first. Agreements that could not be written to the sink are not deleted, they will be tried
+	// again on the next purge.
+	for _, partition := range partitions {
+		for _, agp := range policy.AllAgreementProtocols() {
+			now := time.Now().Unix()
+			if agreements, err := w.db.FindAgreementsInPartition(partition, []persistence.AFilter{persistence.ArchivedAFilter(), agedOutFilter(now, ageLimit)}, agp); err == nil {
+				for start := 0; start < len(agreements); start += ARCHIVE_SINK_BATCH_SIZE {
+					end := start + ARCHIVE_SINK_BATCH_SIZE
+					if end > len(agreements) {
+						end = len(agreements)
+					}
+					batch := agreements[start:end]
+
+					if err := w.writeToArchiveSink(batch); err != nil {
+						glog.Errorf(logString(fmt.Sprintf("unable to write %v archived agreements to the %v archive sink, they will not be purged, error: %v", len(batch), w.archiveSink.Name(), err)))
+						break
+					}
+
+					for _, ag := range batch {
+						if err := w.db.DeletePartitionAgreement(partition, ag.CurrentAgreementId, agp); err != nil {
+							glog.Error(logString(fmt.Sprintf("error deleting archived agreement %v, error: %v", ag.CurrentAgreementId, err)))
+						} else {
+							glog.V(3).Infof(logString(fmt.Sprintf("archive purge deleted %v from partition %v", ag.CurrentAgreementId, partition)))
+						}
+					}
 				}
-			}
 
-		} else {
-			glog.Errorf(logString(fmt.Sprintf("unable to read archived agreements from database for protocol %v, error: %v", agp, err)))
+			} else {
+				glog.Errorf(logString(fmt.Sprintf("unable to read archived agreements from database partition %v for protocol %v, error: %v", partition, agp, err)))
+			}
 		}
 	}
 	return 0
 }
 
+// The number of agreements written to the archive sink at a time.
+const ARCHIVE_SINK_BATCH_SIZE = 100
+
+// Write a batch of archived agreements to the archive sink, if there is one.
+func (w *AgreementBotWorker) writeToArchiveSink(agreements []persistence.Agreement) error {
+	if w.archiveSink == nil || len(agreements) == 0 {
+		return nil
+	}
+
+	records := make([]archive.PurgedAgreement, 0, len(agreements))
+	for _, ag := range agreements {
+		records = append(records, archive.NewPurgedAgreement(w.GetExchangeId(), ag))
+	}
+
+	if err := w.archiveSink.Write(records); err != nil {
+		return err
+	}
+	glog.V(5).Infof(logString(fmt.Sprintf("archive purge wrote %v agreements to the %v archive sink", len(records), w.archiveSink.Name())))
+	return nil
+}
+
 // Govern the active agreements, reporting which ones need a blockchain running so that the blockchain workers
 // can keep them running.
 func (w *AgreementBotWorker) GovernBlockchainNeeds() int {
@@ -0,0 +1,143 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"sort"
+	"sync"
+	"time"
+)
+
+// When several agbots share a database, some duties (purging archived agreements, garbage collecting MMS object policies
+// and checking the message key) only need to run in one of them. The agbots elect a leader through the database, see
+// leader.go in the persistence package. Each agbot periodically tries to acquire or renew the leader lease, more often than
+// the lease expires, so that a new leader takes over soon after the previous one stops. The singleton duties are registered
+// with the leader election and are skipped when this agbot is not the leader.
+
+type LeaderElection struct {
+	db     persistence.AgbotDatabase
+	leaseS uint64          // The length of the lease.
+	lock   sync.Mutex      // Protects the fields below.
+	leader bool            // This agbot is the leader.
+	since  int64           // The time this agbot became the leader.
+	duties map[string]bool // The names of the registered singleton duties.
+}
+
+func NewLeaderElection(db persistence.AgbotDatabase, leaseS uint64) *LeaderElection {
+	return &LeaderElection{
+		db:     db,
+		leaseS: leaseS,
+		duties: make(map[string]bool),
+	}
+}
+
+func (l *LeaderElection) String() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return fmt.Sprintf("Leader: %v, Since: %v, Lease: %v, Duties: %v", l.leader, l.since, l.leaseS, len(l.duties))
+}
+
+// The number of seconds between attempts to acquire or renew the lease.
+func (l *LeaderElection) RenewInterval() int {
+	if interval := int(l.leaseS / 3); interval > 0 {
+		return interval
+	}
+	return 1
+}
+
+func (l *LeaderElection) IsLeader() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.leader
+}
+
+// Acquire or renew the lease. It is called by a subworker. If the lease cannot be renewed, this agbot stops being the leader
+// right away rather than waiting for the lease to expire, so that 2 agbots do not run the singleton duties at the same time.
+func (l *LeaderElection) Campaign() int {
+	leader, err := l.db.AcquireLeadership(l.leaseS)
+	if err != nil {
+		glog.Errorf(leaderLogString(fmt.Sprintf("unable to acquire leadership, error: %v", err)))
+	}
+	l.setLeader(leader && err == nil)
+	return 0
+}
+
+// Give up the lease so that another agbot can take over right away. It is called when the agbot quiesces.
+func (l *LeaderElection) Resign() {
+	if !l.IsLeader() {
+		return
+	}
+	if err := l.db.ReleaseLeadership(); err != nil {
+		glog.Errorf(leaderLogString(fmt.Sprintf("unable to release leadership, error: %v", err)))
+	}
+	l.setLeader(false)
+}
+
+func (l *LeaderElection) setLeader(leader bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if leader && !l.leader {
+		l.since = time.Now().Unix()
+		glog.Infof(leaderLogString(fmt.Sprintf("this agbot is now the leader, running singleton duties")))
+	} else if !leader && l.leader {
+		l.since = 0
+		glog.Infof(leaderLogString(fmt.Sprintf("this agbot is no longer the leader")))
+	}
+	l.leader = leader
+}
+
+// Register a singleton duty that decides for itself when to run. The returned function tells the duty whether this agbot
+// is the leader.
+func (l *LeaderElection) Check(name string) func() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.duties[name] = true
+	return l.IsLeader
+}
+
+// Register a singleton duty. The returned function runs the duty only when this agbot is the leader, it can be dispatched
+// as a subworker.
+func (l *LeaderElection) Singleton(name string, duty func() int) func() int {
+	isLeader := l.Check(name)
+
+	return func() int {
+		if !isLeader() {
+			glog.V(5).Infof(leaderLogString(fmt.Sprintf("skipping %v, this agbot is not the leader", name)))
+			return 0
+		}
+		return duty()
+	}
+}
+
+// The leader as shown in the agbot status.
+type LeaderStatus struct {
+	IsLeader bool                     `json:"isLeader"`        // This agbot is the leader.
+	Since    int64                    `json:"since,omitempty"` // The time this agbot became the leader.
+	Duties   []string                 `json:"duties"`          // The singleton duties that only run in the leader.
+	Lease    *persistence.LeaderLease `json:"lease,omitempty"` // The current lease in the database, there is none while no agbot is the leader.
+	Error    string                   `json:"error,omitempty"` // The lease could not be read from the database.
+}
+
+func (l *LeaderElection) Status() *LeaderStatus {
+	l.lock.Lock()
+	status := &LeaderStatus{IsLeader: l.leader, Since: l.since, Duties: make([]string, 0, len(l.duties))}
+	for name := range l.duties {
+		status.Duties = append(status.Duties, name)
+	}
+	l.lock.Unlock()
+
+	sort.Strings(status.Duties)
+	if lease, err := l.db.GetLeader(); err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Lease = lease
+	}
+	return status
+}
+
+var leaderLogString = func(v interface{}) string {
+	return fmt.Sprintf("Leader Election: %v", v)
+}
@@ -0,0 +1,52 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence/memory"
+	"github.com/open-horizon/anax/config"
+	"testing"
+)
+
+func Test_LeaderElection(t *testing.T) {
+	db := new(memory.AgbotMemoryDB)
+	if err := db.Initialize(&config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true}}); err != nil {
+		t.Fatalf("unable to initialize database, error: %v", err)
+	}
+
+	l := NewLeaderElection(db, 30)
+	if l.RenewInterval() != 10 {
+		t.Errorf("the lease should be renewed every 10 seconds, got %v", l.RenewInterval())
+	} else if NewLeaderElection(db, 2).RenewInterval() != 1 {
+		t.Errorf("the lease should be renewed at least every second")
+	}
+
+	runs := 0
+	duty := l.Singleton("duty", func() int { runs++; return 0 })
+	check := l.Check("check")
+
+	// Singleton duties do not run until this agbot is the leader.
+	duty()
+	if runs != 0 || check() {
+		t.Errorf("singleton duties should not run before the election, runs: %v", runs)
+	}
+
+	l.Campaign()
+	duty()
+	if !l.IsLeader() || runs != 1 || !check() {
+		t.Errorf("singleton duties should run in the leader, runs: %v", runs)
+	}
+
+	status := l.Status()
+	if !status.IsLeader || status.Since == 0 || status.Lease == nil || len(status.Duties) != 2 || status.Duties[0] != "check" || status.Duties[1] != "duty" {
+		t.Errorf("wrong leader status: %v", status)
+	}
+
+	l.Resign()
+	duty()
+	if l.IsLeader() || runs != 1 {
+		t.Errorf("singleton duties should not run after resigning, runs: %v", runs)
+	} else if status := l.Status(); status.IsLeader || status.Since != 0 || status.Lease != nil {
+		t.Errorf("wrong leader status after resigning: %v", status)
+	}
+}
@@ -0,0 +1,283 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/schedule"
+	"github.com/open-horizon/anax/worker"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Deployment policies and patterns can have a maintenance schedule that restricts when the agbot forms new agreements and
+// when it cancels agreements to upgrade the service. Work that arrives outside of a window is queued here until the window
+// opens. New agreements are queued by the node search, which skips the policy and searches for its nodes again once
+// the window opens. Policy changes and workload upgrades are queued by the command handler, and are dispatched again when the
+// window opens. A node can also publish its own maintenance window in a node property. Agreement attempts with a node outside
+// of its window are queued by the agreement worker, and the nodes of the policy are searched again when the window opens.
+// The queue is kept in memory, it is not shared with the other agbots.
+
+const MAINTENANCE_DISPATCH = "AgbotMaintenanceDispatch"
+
+const (
+	PENDING_AGREEMENTS    = "agreements"    // new agreements for the policy are waiting for an agreement window
+	PENDING_POLICY_CHANGE = "policy change" // agreements using the changed policy are waiting for an upgrade window
+	PENDING_UPGRADE       = "upgrade"       // a workload upgrade requested through the API is waiting for an upgrade window
+	PENDING_NODE_WINDOW   = "node window"   // a new agreement is waiting for the maintenance window of the node
+)
+
+// Work that is waiting for a maintenance window to open.
+type PendingWork struct {
+	Type        string                        `json:"type"`
+	PolicyName  string                        `json:"policyName"`
+	Org         string                        `json:"org"`
+	Device      string                        `json:"device,omitempty"`      // the node to upgrade or to make an agreement with
+	AgreementId string                        `json:"agreementId,omitempty"` // the agreement to upgrade, for upgrades of a single agreement
+	Queued      uint64                        `json:"queuedTime"`            // when the work was first queued
+	NextWindow  uint64                        `json:"nextWindowTime"`        // when the next window opens, 0 when no window opens within a year
+	command     worker.Command                // the command to dispatch when the window opens, nil for new agreements
+	nodeWindow  *schedule.MaintenanceSchedule // the maintenance window of the node, for agreements waiting for the node
+}
+
+func (p PendingWork) String() string {
+	return fmt.Sprintf("Type: %v, PolicyName: %v, Org: %v, Device: %v, AgreementId: %v, Queued: %v, NextWindow: %v",
+		p.Type, p.PolicyName, p.Org, p.Device, p.AgreementId, p.Queued, p.NextWindow)
+}
+
+func (p *PendingWork) key() string {
+	return fmt.Sprintf("%v/%v/%v/%v", p.Type, p.PolicyName, p.Device, p.AgreementId)
+}
+
+type MaintenanceQueue struct {
+	lock    sync.Mutex              // The lock that protects the pending work, it is used by the API, the node search and the agbot worker.
+	pending map[string]*PendingWork // The pending work, keyed by type, policy, device and agreement.
+}
+
+func NewMaintenanceQueue() *MaintenanceQueue {
+	return &MaintenanceQueue{
+		pending: make(map[string]*PendingWork),
+	}
+}
+
+// Queue the work, replacing the same kind of work for the same policy and node. The time it was first queued is kept.
+func (q *MaintenanceQueue) Add(work *PendingWork) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if existing, ok := q.pending[work.key()]; ok {
+		work.Queued = existing.Queued
+	}
+	q.pending[work.key()] = work
+}
+
+// Remove the work of the given type for a policy, for all nodes.
+func (q *MaintenanceQueue) Remove(workType string, policyName string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for k, work := range q.pending {
+		if work.Type == workType && work.PolicyName == policyName {
+			delete(q.pending, k)
+		}
+	}
+}
+
+// Remove all the work for a policy.
+func (q *MaintenanceQueue) RemovePolicy(policyName string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for k, work := range q.pending {
+		if work.PolicyName == policyName {
+			delete(q.pending, k)
+		}
+	}
+}
+
+// Remove and return the queued commands and node agreements that can be dispatched at the given time. The schedule function
+// returns the maintenance schedule of a policy, and false when the policy no longer exists.
+func (q *MaintenanceQueue) Ready(now time.Time, getSchedule func(org string, policyName string) (*schedule.MaintenanceSchedule, bool)) []*PendingWork {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	ready := make([]*PendingWork, 0)
+	for k, work := range q.pending {
+		if work.nodeWindow != nil {
+			if work.nodeWindow.AgreementsAllowed(now) {
+				delete(q.pending, k)
+				ready = append(ready, work)
+			} else {
+				work.NextWindow = windowTime(work.nodeWindow.NextAgreementWindow(now))
+			}
+		} else if work.command != nil {
+			if sched, found := getSchedule(work.Org, work.PolicyName); !found {
+				glog.V(3).Infof(AWlogString(fmt.Sprintf("dropping pending work %v, the policy no longer exists", work)))
+				delete(q.pending, k)
+			} else if sched.UpgradesAllowed(now) {
+				delete(q.pending, k)
+				ready = append(ready, work)
+			} else {
+				work.NextWindow = windowTime(sched.NextUpgradeWindow(now))
+			}
+		}
+	}
+
+	sort.Slice(ready, func(i, j int) bool { return ready[i].Queued < ready[j].Queued })
+	return ready
+}
+
+// Return a copy of the pending work, oldest first.
+func (q *MaintenanceQueue) List() []PendingWork {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	res := make([]PendingWork, 0, len(q.pending))
+	for _, work := range q.pending {
+		res = append(res, *work)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Queued != res[j].Queued {
+			return res[i].Queued < res[j].Queued
+		}
+		return res[i].key() < res[j].key()
+	})
+	return res
+}
+
+// Convert the time of the next window to seconds, 0 when there is no next window.
+func windowTime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix())
+}
+
+// Return the maintenance schedule of the deployment policy or pattern that a policy was generated from, nil when it does
+// not have one. This function is called from different threads.
+func getMaintenanceSchedule(org string, pol *policy.Policy) *schedule.MaintenanceSchedule {
+	if pol.PatternId != "" {
+		if patternManager == nil {
+			return nil
+		}
+		return patternManager.GetMaintenanceSchedule(org, exchange.GetId(pol.PatternId))
+	} else if businessPolManager != nil {
+		if pBE := businessPolManager.GetBusinessPolicyEntry(org, pol); pBE != nil {
+			return pBE.Maintenance.DeepCopy()
+		}
+	}
+	return nil
+}
+
+// Returns true if the upgrade or policy change can be done now. If not, the command is queued until the next upgrade window
+// of the policy opens.
+func (w *AgreementBotWorker) upgradeAllowed(cmd worker.Command, workType string, org string, pol *policy.Policy, device string, agreementId string) bool {
+
+	now := time.Now()
+	sched := getMaintenanceSchedule(org, pol)
+	if sched.UpgradesAllowed(now) {
+		return true
+	}
+
+	work := &PendingWork{
+		Type:        workType,
+		PolicyName:  pol.Header.Name,
+		Org:         org,
+		Device:      device,
+		AgreementId: agreementId,
+		Queued:      uint64(now.Unix()),
+		NextWindow:  windowTime(sched.NextUpgradeWindow(now)),
+		command:     cmd,
+	}
+	glog.V(3).Infof(AWlogString(fmt.Sprintf("queueing %v until the next upgrade window: %v", workType, work)))
+	maintenanceQueue.Add(work)
+	return false
+}
+
+// Find the policy that an upgrade request refers to. The request only has the policy name, so look for it in all the orgs.
+func (w *AgreementBotWorker) findUpgradePolicy(policyName string) (string, *policy.Policy) {
+	for _, org := range w.pm.GetAllPolicyOrgs() {
+		if pol := w.pm.GetPolicy(org, policyName); pol != nil {
+			return org, pol
+		}
+	}
+	return "", nil
+}
+
+// Dispatch the queued policy changes and upgrades whose upgrade window has opened. The commands are handled again by the
+// command handler. The nodes of a policy are searched again when a node that was waiting for its own window can make
+// agreements.
+func (w *AgreementBotWorker) dispatchMaintenance() int {
+
+	getSchedule := func(org string, policyName string) (*schedule.MaintenanceSchedule, bool) {
+		if pol := w.pm.GetPolicy(org, policyName); pol == nil {
+			return nil, false
+		} else {
+			return getMaintenanceSchedule(org, pol), true
+		}
+	}
+
+	retries := make(map[string]bool)
+	for _, work := range maintenanceQueue.Ready(time.Now(), getSchedule) {
+		if work.command != nil {
+			glog.V(3).Infof(AWlogString(fmt.Sprintf("upgrade window open, dispatching %v", work)))
+			w.Commands <- work.command
+		} else if !retries[work.PolicyName] {
+			glog.V(3).Infof(AWlogString(fmt.Sprintf("node maintenance window open, searching again for %v", work)))
+			retries[work.PolicyName] = true
+			w.nodeSearch.AddRetry(work.PolicyName, 1)
+		}
+	}
+	return 0
+}
+
+// Returns true if new agreements can be made for the policy now. If not, the policy is reported as pending until its next
+// agreement window opens.
+func (n *NodeSearch) agreementsAllowed(org string, pol *policy.Policy) bool {
+
+	now := time.Now()
+	sched := getMaintenanceSchedule(org, pol)
+	if sched.AgreementsAllowed(now) {
+		maintenanceQueue.Remove(PENDING_AGREEMENTS, pol.Header.Name)
+		return true
+	}
+
+	maintenanceQueue.Add(&PendingWork{
+		Type:       PENDING_AGREEMENTS,
+		PolicyName: pol.Header.Name,
+		Org:        org,
+		Queued:     uint64(now.Unix()),
+		NextWindow: windowTime(sched.NextAgreementWindow(now)),
+	})
+	return false
+}
+
+// Returns true if the node can make a new agreement now. If the node publishes a maintenance window that is closed, the agreement
+// is queued until the window opens. A window that is not valid does not restrict the node, the node rejects it when it is set.
+func nodeAgreementAllowed(org string, policyName string, deviceId string, nodePol *policy.Policy) bool {
+
+	sched, err := externalpolicy.GetNodeMaintenanceWindow(nodePol.Properties)
+	if err != nil {
+		glog.Warningf(AWlogString(fmt.Sprintf("ignoring maintenance window of node %v, error: %v", deviceId, err)))
+		return true
+	}
+
+	now := time.Now()
+	if sched.AgreementsAllowed(now) {
+		return true
+	}
+
+	maintenanceQueue.Add(&PendingWork{
+		Type:       PENDING_NODE_WINDOW,
+		PolicyName: policyName,
+		Org:        org,
+		Device:     deviceId,
+		Queued:     uint64(now.Unix()),
+		NextWindow: windowTime(sched.NextAgreementWindow(now)),
+		nodeWindow: sched,
+	})
+	return false
+}
@@ -0,0 +1,78 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/schedule"
+	"testing"
+	"time"
+)
+
+func Test_MaintenanceQueue_Ready(t *testing.T) {
+
+	q := NewMaintenanceQueue()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	// Upgrades of mypol are allowed from noon to 1pm, upgrades of otherpol from 10pm to 11pm.
+	schedules := map[string]*schedule.MaintenanceSchedule{
+		"myorg/mypol":    {UpgradeWindows: []schedule.Window{{Cron: "0 12 * * *", DurationM: 60}}},
+		"myorg/otherpol": {UpgradeWindows: []schedule.Window{{Cron: "0 22 * * *", DurationM: 60}}},
+	}
+	getSchedule := func(org string, policyName string) (*schedule.MaintenanceSchedule, bool) {
+		s, ok := schedules[policyName]
+		return s, ok
+	}
+
+	q.Add(&PendingWork{Type: PENDING_POLICY_CHANGE, PolicyName: "myorg/mypol", Org: "myorg", Queued: 100, command: &PolicyChangedCommand{}})
+	q.Add(&PendingWork{Type: PENDING_POLICY_CHANGE, PolicyName: "myorg/mypol", Org: "myorg", Queued: 200, command: &PolicyChangedCommand{}})
+	q.Add(&PendingWork{Type: PENDING_UPGRADE, PolicyName: "myorg/otherpol", Org: "myorg", Device: "myorg/node1", Queued: 150, command: &WorkloadUpgradeCommand{}})
+	q.Add(&PendingWork{Type: PENDING_UPGRADE, PolicyName: "myorg/gone", Org: "myorg", Queued: 160, command: &WorkloadUpgradeCommand{}})
+	q.Add(&PendingWork{Type: PENDING_AGREEMENTS, PolicyName: "myorg/mypol", Org: "myorg", Queued: 170})
+
+	// The second policy change replaced the first one and kept its queued time.
+	if pending := q.List(); len(pending) != 4 {
+		t.Errorf("expected 4 pending work items, got %v", pending)
+	} else if pending[0].Queued != 100 || pending[0].Type != PENDING_POLICY_CHANGE {
+		t.Errorf("expected the policy change first, got %v", pending[0])
+	}
+
+	ready := q.Ready(now, getSchedule)
+	if len(ready) != 1 || ready[0].PolicyName != "myorg/mypol" {
+		t.Errorf("expected the policy change of mypol to be ready, got %v", ready)
+	}
+
+	// The work for the deleted policy is dropped, the new agreements and the upgrade of otherpol are still pending.
+	if pending := q.List(); len(pending) != 2 {
+		t.Errorf("expected 2 pending work items, got %v", pending)
+	} else if pending[0].Type != PENDING_UPGRADE || pending[0].NextWindow != uint64(time.Date(2026, 10, 18, 22, 0, 0, 0, time.UTC).Unix()) {
+		t.Errorf("expected the upgrade of otherpol with the next window at 10pm, got %v", pending[0])
+	}
+
+	q.RemovePolicy("myorg/mypol")
+	if pending := q.List(); len(pending) != 1 || pending[0].PolicyName != "myorg/otherpol" {
+		t.Errorf("expected only the upgrade of otherpol, got %v", pending)
+	}
+}
+
+func Test_MaintenanceQueue_NodeWindow(t *testing.T) {
+
+	q := NewMaintenanceQueue()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	nodeWindow, err := schedule.ParseMaintenanceWindow("0 13 * * * 60")
+	if err != nil {
+		t.Fatalf("unexpected error parsing the node window: %v", err)
+	}
+
+	q.Add(&PendingWork{Type: PENDING_NODE_WINDOW, PolicyName: "myorg/mypol", Org: "myorg", Device: "myorg/node1", Queued: 100, nodeWindow: nodeWindow})
+
+	noSchedule := func(org string, policyName string) (*schedule.MaintenanceSchedule, bool) { return nil, true }
+
+	if ready := q.Ready(now, noSchedule); len(ready) != 0 {
+		t.Errorf("the node window is closed, got %v", ready)
+	} else if ready := q.Ready(now.Add(90*time.Minute), noSchedule); len(ready) != 1 || ready[0].Device != "myorg/node1" {
+		t.Errorf("the node window is open, got %v", ready)
+	} else if pending := q.List(); len(pending) != 0 {
+		t.Errorf("expected no pending work, got %v", pending)
+	}
+}
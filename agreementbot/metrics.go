@@ -0,0 +1,171 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/metrics"
+	"sync"
+	"time"
+)
+
+// The agbot metrics that are served on the /metrics API. The agreement counts, work queue depths and partitions are
+// computed from the state of the agbot when the metrics are scraped, the latencies and durations are recorded as they
+// happen. They are registered with the worker framework by the agbot worker. Counting the agreements loads every agreement
+// in the agbot's partitions, so the counts are cached for AGREEMENT_COUNT_CACHE_S seconds instead of being read from the
+// database on every scrape.
+
+const (
+	SEARCH_TYPE_PATTERN = "pattern"
+	SEARCH_TYPE_POLICY  = "policy"
+)
+
+// The states of an agreement reported by the agreement count metric.
+const (
+	AG_STATE_PROPOSED  = "proposed"  // the proposal was sent, there is no reply yet
+	AG_STATE_ACCEPTED  = "accepted"  // the node accepted the proposal
+	AG_STATE_FINALIZED = "finalized" // the agreement is finalized
+	AG_STATE_TIMEDOUT  = "timedout"  // the agreement timed out and is being cancelled
+	AG_STATE_ARCHIVED  = "archived"  // the agreement is terminated
+)
+
+// How long the agreement counts are cached.
+const AGREEMENT_COUNT_CACHE_S = 60
+
+var proposalRoundTrip = metrics.NewHistogramVec("horizon_agbot_proposal_round_trip_seconds",
+	"The time between sending an agreement proposal and receiving the node's acceptance.",
+	[]float64{1, 2, 5, 10, 30, 60, 120, 300, 600, 1800}, "protocol", "org")
+
+var searchSessionDuration = metrics.NewHistogramVec("horizon_agbot_search_session_duration_seconds",
+	"The time taken to search the exchange for the nodes of a policy, from the first to the last page of results.",
+	[]float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600}, "type")
+
+func observeProposalRoundTrip(protocol string, ag *persistence.Agreement) {
+	if now := uint64(time.Now().Unix()); ag.AgreementInceptionTime != 0 && now >= ag.AgreementInceptionTime {
+		proposalRoundTrip.Observe(float64(now-ag.AgreementInceptionTime), protocol, ag.Org)
+	}
+}
+
+func agreementMetricsState(ag *persistence.Agreement) string {
+	if ag.Archived {
+		return AG_STATE_ARCHIVED
+	} else if ag.AgreementTimedout != 0 {
+		return AG_STATE_TIMEDOUT
+	} else if ag.AgreementFinalizedTime != 0 {
+		return AG_STATE_FINALIZED
+	} else if ag.AgreementCreationTime != 0 {
+		return AG_STATE_ACCEPTED
+	}
+	return AG_STATE_PROPOSED
+}
+
+func (w *AgreementBotWorker) registerMetrics() {
+	w.RegisterCollector(proposalRoundTrip)
+	w.RegisterCollector(searchSessionDuration)
+	w.RegisterCollector(metrics.CollectorFunc(w.collectAgreements))
+	w.RegisterCollector(metrics.CollectorFunc(w.collectWorkQueues))
+	w.RegisterCollector(metrics.CollectorFunc(w.collectPartitions))
+}
+
+// The agreement counts by state, protocol and org, and when they were read from the database.
+type agreementCountCache struct {
+	lock    sync.Mutex
+	ttl     time.Duration
+	updated time.Time
+	counts  map[[3]string]int
+}
+
+func newAgreementCountCache(ttl time.Duration) *agreementCountCache {
+	return &agreementCountCache{ttl: ttl}
+}
+
+// Return the cached counts, or the counts returned by the load function if the cached counts are too old.
+func (c *agreementCountCache) get(load func() map[[3]string]int) map[[3]string]int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.counts == nil || time.Since(c.updated) >= c.ttl {
+		c.counts = load()
+		c.updated = time.Now()
+	}
+	return c.counts
+}
+
+var agreementCounts = newAgreementCountCache(AGREEMENT_COUNT_CACHE_S * time.Second)
+
+// Count the agreements in the database by state, protocol and org.
+func (w *AgreementBotWorker) collectAgreements() []*metrics.Family {
+	f := metrics.NewFamily("horizon_agbot_agreements", "The number of agreements in the database, by state, protocol and org.", metrics.GAUGE)
+
+	for k, count := range agreementCounts.get(w.countAgreements) {
+		f.Add(float64(count), []string{"state", "protocol", "org"}, k[0], k[1], k[2])
+	}
+	return []*metrics.Family{f}
+}
+
+func (w *AgreementBotWorker) countAgreements() map[[3]string]int {
+	counts := make(map[[3]string]int)
+	for _, protocol := range w.consumerPH.GetAll() {
+		agreements, err := w.db.FindAgreements([]persistence.AFilter{}, protocol)
+		if err != nil {
+			glog.Errorf(AWlogString(fmt.Sprintf("unable to read %v agreements for metrics, error: %v", protocol, err)))
+			continue
+		}
+
+		for ix := range agreements {
+			counts[[3]string{agreementMetricsState(&agreements[ix]), protocol, agreements[ix].Org}] += 1
+		}
+	}
+	return counts
+}
+
+// Report the depth of the work queues, and the depth, wait time and agreement attempts in progress of each org.
+func (w *AgreementBotWorker) collectWorkQueues() []*metrics.Family {
+	depth := metrics.NewFamily("horizon_agbot_work_queue_depth", "The number of work items waiting for an agreement worker, by protocol and priority.", metrics.GAUGE)
+	laneDepth := metrics.NewFamily("horizon_agbot_work_queue_lane_depth", "The number of new agreement attempts waiting for an agreement worker, by protocol and lane.", metrics.GAUGE)
+	laneWait := metrics.NewFamily("horizon_agbot_work_queue_lane_oldest_wait_seconds", "How long the oldest new agreement attempt in a lane has been waiting, by protocol and lane.", metrics.GAUGE)
+	inFlight := metrics.NewFamily("horizon_agbot_work_queue_in_flight", "The number of agreement attempts in progress, by protocol and org.", metrics.GAUGE)
+
+	for protocol, status := range w.consumerPH.WorkQueueStatus() {
+		depth.Add(float64(status.HighDepth), []string{"protocol", "priority"}, protocol, HIGH_PRIORITY)
+		depth.Add(float64(status.LowDepth), []string{"protocol", "priority"}, protocol, LOW_PRIORITY)
+		for lane, ls := range status.Lanes {
+			laneDepth.Add(float64(ls.Depth), []string{"protocol", "lane", "org"}, protocol, lane, ls.Org)
+			laneWait.Add(float64(ls.OldestWaitS), []string{"protocol", "lane", "org"}, protocol, lane, ls.Org)
+		}
+		for org, n := range status.InFlight {
+			inFlight.Add(float64(n), []string{"protocol", "org"}, protocol, org)
+		}
+	}
+	return []*metrics.Family{depth, laneDepth, laneWait, inFlight}
+}
+
+// Report the owner and the agreement counts of each database partition.
+func (w *AgreementBotWorker) collectPartitions() []*metrics.Family {
+	owner := metrics.NewFamily("horizon_agbot_partition_owner", "The owner of each database partition, the value is always 1.", metrics.GAUGE)
+	primary := metrics.NewFamily("horizon_agbot_partition_primary", "1 for the partition owned by this agbot, 0 for the others.", metrics.GAUGE)
+	live := metrics.NewFamily("horizon_agbot_partition_live", "1 when the owner of the partition is heartbeating, 0 when the partition is stale.", metrics.GAUGE)
+	agreements := metrics.NewFamily("horizon_agbot_partition_agreements", "The number of active and archived agreements in each partition.", metrics.GAUGE)
+
+	loads, err := persistence.GetPartitionLoads(w.db, w.Config.GetPartitionStale())
+	if err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to read partitions for metrics, error: %v", err)))
+		return nil
+	}
+
+	for _, l := range loads {
+		owner.Add(1, []string{"partition", "owner"}, l.Id, l.Owner)
+		primary.Add(boolMetric(l.Id == w.db.PrimaryPartition()), []string{"partition"}, l.Id)
+		live.Add(boolMetric(l.Live), []string{"partition"}, l.Id)
+		agreements.Add(float64(l.Active), []string{"partition", "state"}, l.Id, "active")
+		agreements.Add(float64(l.Archived), []string{"partition", "state"}, l.Id, "archived")
+	}
+	return []*metrics.Family{owner, primary, live, agreements}
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_agreementCountCache(t *testing.T) {
+	loads := 0
+	load := func() map[[3]string]int {
+		loads += 1
+		return map[[3]string]int{{AG_STATE_FINALIZED, "Basic", "myorg"}: loads}
+	}
+
+	c := newAgreementCountCache(time.Hour)
+	if counts := c.get(load); loads != 1 || counts[[3]string{AG_STATE_FINALIZED, "Basic", "myorg"}] != 1 {
+		t.Errorf("the first scrape should read the counts, got %v after %v loads", counts, loads)
+	} else if counts := c.get(load); loads != 1 || counts[[3]string{AG_STATE_FINALIZED, "Basic", "myorg"}] != 1 {
+		t.Errorf("the next scrape should use the cached counts, got %v after %v loads", counts, loads)
+	}
+
+	// The counts are read again once they are too old.
+	c.updated = time.Now().Add(-2 * time.Hour)
+	if counts := c.get(load); loads != 2 || counts[[3]string{AG_STATE_FINALIZED, "Basic", "myorg"}] != 2 {
+		t.Errorf("the counts should be read again when they are too old, got %v after %v loads", counts, loads)
+	}
+}
@@ -0,0 +1,194 @@
+package agreementbot
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"sort"
+)
+
+// The node search makes agreements with the nodes in the order that the exchange search returns them, unless the
+// deployment policy chooses a node ranking strategy. The order matters when agreements cannot be made with all the nodes
+// found at once, for example when a rollout limits the number of new agreements. Each strategy is a node ranker that
+// registers itself by name, the built-in rankers are registered when the package is initialized. A ranker gets the
+// data it needs about the nodes through the ranking context, so that the data is only read when it is used. The data is
+// read once per pass of the node search, see searchPassCache.
+//
+// A ranker only orders the nodes of one page of search results (plus the nodes held back by a rollout or placement). The
+// nodes on the next page of a large search are offered agreements after all the nodes on this page, whatever their rank.
+
+// The data that a node ranker can use to order the nodes.
+type NodeRankingContext struct {
+	Ranking        *businesspolicy.NodeRanking
+	PolicyName     string
+	PolicyNodes    []string                                                 // the nodes that have an agreement for the policy
+	AgreementCount func() (map[string]int, error)                           // the number of current agreements of each node, for all policies
+	NodeProperties func(nodeId string) (externalpolicy.PropertyList, error) // the properties in the node's policy
+	LastHeartbeat  func(nodeId string) (int64, error)                       // the time of the node's last heartbeat, in seconds since the epoch
+}
+
+// Each node ranking strategy implements this interface.
+type NodeRanker interface {
+	// Returns the nodes in the order in which agreements should be made with them.
+	Rank(nodes []exchange.SearchResultDevice, ctx *NodeRankingContext) ([]exchange.SearchResultDevice, error)
+}
+
+// Global node ranker registry, keyed by strategy name.
+var nodeRankers = map[string]NodeRanker{}
+
+// Node rankers call this function to register themselves in the global registry.
+func RegisterNodeRanker(name string, r NodeRanker) {
+	nodeRankers[name] = r
+}
+
+func init() {
+	RegisterNodeRanker(businesspolicy.RANKING_FEWEST_AGREEMENTS, fewestAgreementsRanker{})
+	RegisterNodeRanker(businesspolicy.RANKING_SPREAD, spreadRanker{})
+	RegisterNodeRanker(businesspolicy.RANKING_RECENT_HEARTBEAT, recentHeartbeatRanker{})
+}
+
+// Prefer the nodes with the fewest current agreements.
+type fewestAgreementsRanker struct{}
+
+func (r fewestAgreementsRanker) Rank(nodes []exchange.SearchResultDevice, ctx *NodeRankingContext) ([]exchange.SearchResultDevice, error) {
+	counts, err := ctx.AgreementCount()
+	if err != nil {
+		return nil, err
+	}
+
+	ranked := append([]exchange.SearchResultDevice{}, nodes...)
+	sort.SliceStable(ranked, func(i, j int) bool { return counts[ranked[i].Id] < counts[ranked[j].Id] })
+	return ranked, nil
+}
+
+// Prefer the nodes whose heartbeat is most recent. Nodes whose heartbeat cannot be read go last.
+type recentHeartbeatRanker struct{}
+
+func (r recentHeartbeatRanker) Rank(nodes []exchange.SearchResultDevice, ctx *NodeRankingContext) ([]exchange.SearchResultDevice, error) {
+	heartbeats := make(map[string]int64, len(nodes))
+	for _, dev := range nodes {
+		if hb, err := ctx.LastHeartbeat(dev.Id); err != nil {
+			glog.Warningf(AWlogString(fmt.Sprintf("unable to get the heartbeat of %v for ranking, error: %v", dev.Id, err)))
+		} else {
+			heartbeats[dev.Id] = hb
+		}
+	}
+
+	ranked := append([]exchange.SearchResultDevice{}, nodes...)
+	sort.SliceStable(ranked, func(i, j int) bool { return heartbeats[ranked[i].Id] > heartbeats[ranked[j].Id] })
+	return ranked, nil
+}
+
+// Spread the agreements of the policy evenly across the values of a node property. The next node is always taken from
+// the value that has the fewest agreements so far, counting the agreements that the policy already has. Nodes without
+// the property go last.
+type spreadRanker struct{}
+
+func (r spreadRanker) Rank(nodes []exchange.SearchResultDevice, ctx *NodeRankingContext) ([]exchange.SearchResultDevice, error) {
+	if ctx.Ranking == nil || ctx.Ranking.Property == "" {
+		return nil, errors.New(fmt.Sprintf("no property to spread the nodes across"))
+	}
+
+	valueOf := func(nodeId string) (string, bool) {
+		if props, err := ctx.NodeProperties(nodeId); err != nil {
+			glog.Warningf(AWlogString(fmt.Sprintf("unable to get the properties of %v for ranking, error: %v", nodeId, err)))
+			return "", false
+		} else if prop, err := props.GetProperty(ctx.Ranking.Property); err != nil {
+			return "", false
+		} else {
+			return fmt.Sprintf("%v", prop.Value), true
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, nodeId := range ctx.PolicyNodes {
+		if value, ok := valueOf(nodeId); ok {
+			counts[value] += 1
+		}
+	}
+
+	// Group the nodes by value, keeping the search order within each group and the order in which the values were seen.
+	groups := make(map[string][]exchange.SearchResultDevice)
+	values := make([]string, 0)
+	others := make([]exchange.SearchResultDevice, 0)
+	for _, dev := range nodes {
+		if value, ok := valueOf(dev.Id); !ok {
+			others = append(others, dev)
+		} else {
+			if _, seen := groups[value]; !seen {
+				values = append(values, value)
+			}
+			groups[value] = append(groups[value], dev)
+		}
+	}
+
+	ranked := make([]exchange.SearchResultDevice, 0, len(nodes))
+	for len(ranked)+len(others) < len(nodes) {
+		next := -1
+		for ix, value := range values {
+			if len(groups[value]) != 0 && (next == -1 || counts[value] < counts[values[next]]) {
+				next = ix
+			}
+		}
+		value := values[next]
+		ranked = append(ranked, groups[value][0])
+		groups[value] = groups[value][1:]
+		counts[value] += 1
+	}
+	return append(ranked, others...), nil
+}
+
+// Order the nodes found for a deployment policy by the policy's node ranking strategy. The search order is kept when the
+// policy does not have a strategy or the strategy fails.
+func (n *NodeSearch) rankNodes(policyName string, ranking *businesspolicy.NodeRanking, nodes []exchange.SearchResultDevice, allAgreements map[string][]persistence.Agreement) []exchange.SearchResultDevice {
+	if ranking == nil || len(nodes) < 2 {
+		return nodes
+	}
+
+	ranker, ok := nodeRankers[ranking.Strategy]
+	if !ok {
+		glog.Errorf(AWlogString(fmt.Sprintf("unknown node ranking strategy %v for %v, using the search order", ranking.Strategy, policyName)))
+		return nodes
+	}
+
+	if ranked, err := ranker.Rank(nodes, n.newNodeRankingContext(policyName, ranking, allAgreements)); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to rank nodes for %v with strategy %v, using the search order, error: %v", policyName, ranking.Strategy, err)))
+		return nodes
+	} else {
+		glog.V(5).Infof(AWlogString(fmt.Sprintf("ranked %v nodes for %v with strategy %v", len(ranked), policyName, ranking.Strategy)))
+		return ranked
+	}
+}
+
+func (n *NodeSearch) newNodeRankingContext(policyName string, ranking *businesspolicy.NodeRanking, allAgreements map[string][]persistence.Agreement) *NodeRankingContext {
+
+	policyNodes := make([]string, 0)
+	for _, ags := range allAgreements {
+		for _, ag := range ags {
+			policyNodes = append(policyNodes, ag.DeviceId)
+		}
+	}
+
+	return &NodeRankingContext{
+		Ranking:        ranking,
+		PolicyName:     policyName,
+		PolicyNodes:    policyNodes,
+		AgreementCount: n.getAgreementCounts,
+		NodeProperties: n.getNodeProperties,
+		LastHeartbeat:  n.getLastHeartbeat,
+	}
+}
+
+func getNodeProperties(nodePolicyHandler exchange.NodePolicyHandler, nodeId string) (externalpolicy.PropertyList, error) {
+	if nodePolicy, err := nodePolicyHandler(nodeId); err != nil {
+		return nil, err
+	} else if nodePolicy == nil {
+		return externalpolicy.PropertyList{}, nil
+	} else {
+		return nodePolicy.GetExternalPolicy().Properties, nil
+	}
+}
@@ -0,0 +1,154 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/agreementbot/persistence/memory"
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+)
+
+func rankingNodes(ids ...string) []exchange.SearchResultDevice {
+	nodes := make([]exchange.SearchResultDevice, 0, len(ids))
+	for _, id := range ids {
+		nodes = append(nodes, exchange.SearchResultDevice{Id: id, PublicKey: "key"})
+	}
+	return nodes
+}
+
+func rankedIds(nodes []exchange.SearchResultDevice) []string {
+	ids := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		ids = append(ids, n.Id)
+	}
+	return ids
+}
+
+func checkRanking(t *testing.T, strategy string, ranked []exchange.SearchResultDevice, err error, expected ...string) {
+	if err != nil {
+		t.Errorf("%v: unexpected error: %v", strategy, err)
+		return
+	}
+	ids := rankedIds(ranked)
+	if len(ids) != len(expected) {
+		t.Errorf("%v: expected %v, got %v", strategy, expected, ids)
+		return
+	}
+	for ix := range ids {
+		if ids[ix] != expected[ix] {
+			t.Errorf("%v: expected %v, got %v", strategy, expected, ids)
+			return
+		}
+	}
+}
+
+func Test_NodeRanking_fewest_agreements(t *testing.T) {
+	ctx := &NodeRankingContext{
+		AgreementCount: func() (map[string]int, error) {
+			return map[string]int{"org/n1": 3, "org/n2": 1, "org/n4": 1}, nil
+		},
+	}
+
+	ranked, err := nodeRankers[businesspolicy.RANKING_FEWEST_AGREEMENTS].Rank(rankingNodes("org/n1", "org/n2", "org/n3", "org/n4"), ctx)
+	checkRanking(t, businesspolicy.RANKING_FEWEST_AGREEMENTS, ranked, err, "org/n3", "org/n2", "org/n4", "org/n1")
+
+	ctx.AgreementCount = func() (map[string]int, error) { return nil, errors.New("db error") }
+	if _, err := nodeRankers[businesspolicy.RANKING_FEWEST_AGREEMENTS].Rank(rankingNodes("org/n1", "org/n2"), ctx); err == nil {
+		t.Errorf("expected an error when the agreements cannot be counted")
+	}
+}
+
+func Test_NodeRanking_recent_heartbeat(t *testing.T) {
+	ctx := &NodeRankingContext{
+		LastHeartbeat: func(nodeId string) (int64, error) {
+			switch nodeId {
+			case "org/n1":
+				return 100, nil
+			case "org/n2":
+				return 300, nil
+			case "org/n3":
+				return 200, nil
+			}
+			return 0, errors.New("exchange error")
+		},
+	}
+
+	ranked, err := nodeRankers[businesspolicy.RANKING_RECENT_HEARTBEAT].Rank(rankingNodes("org/n4", "org/n1", "org/n2", "org/n3"), ctx)
+	checkRanking(t, businesspolicy.RANKING_RECENT_HEARTBEAT, ranked, err, "org/n2", "org/n3", "org/n1", "org/n4")
+}
+
+func Test_NodeRanking_spread(t *testing.T) {
+	zones := map[string]string{
+		"org/a1": "east", "org/a2": "east", "org/a3": "east",
+		"org/b1": "west", "org/b2": "west",
+		"org/c1":   "north",
+		"org/old1": "east", "org/old2": "north",
+	}
+
+	ctx := &NodeRankingContext{
+		Ranking:     &businesspolicy.NodeRanking{Strategy: businesspolicy.RANKING_SPREAD, Property: "zone"},
+		PolicyNodes: []string{"org/old1", "org/old2"},
+		NodeProperties: func(nodeId string) (externalpolicy.PropertyList, error) {
+			if zone, ok := zones[nodeId]; ok {
+				return externalpolicy.PropertyList{*externalpolicy.Property_Factory("zone", zone)}, nil
+			}
+			return externalpolicy.PropertyList{}, nil
+		},
+	}
+
+	// east and north already have an agreement, so west goes first. Ties go to the value that was found first, nodes without the property go last.
+	ranked, err := nodeRankers[businesspolicy.RANKING_SPREAD].Rank(rankingNodes("org/a1", "org/a2", "org/x1", "org/b1", "org/a3", "org/c1", "org/b2"), ctx)
+	checkRanking(t, businesspolicy.RANKING_SPREAD, ranked, err, "org/b1", "org/a1", "org/b2", "org/c1", "org/a2", "org/a3", "org/x1")
+}
+
+func Test_NodeSearch_rankNodes_fallback(t *testing.T) {
+	n := NewNodeSearch()
+	nodes := rankingNodes("org/n1", "org/n2")
+
+	checkRanking(t, "none", n.rankNodes("org/bp", nil, nodes, nil), nil, "org/n1", "org/n2")
+	checkRanking(t, "unknown", n.rankNodes("org/bp", &businesspolicy.NodeRanking{Strategy: "unknown"}, nodes, nil), nil, "org/n1", "org/n2")
+}
+
+// The agreement counts and node properties used for ranking are read once per pass of the node search.
+func Test_NodeSearch_search_pass_cache(t *testing.T) {
+	db := new(memory.AgbotMemoryDB)
+	if err := db.Initialize(&config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true}}); err != nil {
+		t.Fatalf("unable to initialize the database, error: %v", err)
+	}
+
+	n := NewNodeSearch()
+	n.db = db
+
+	attempt := func(agId string) {
+		if err := db.AgreementAttempt(agId, "org", "org/n1", "device", "org/bp", "", "", "", policy.BasicProtocol, "", []string{}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unable to create agreement, error: %v", err)
+		}
+	}
+
+	attempt("ag1")
+	if counts, err := n.getAgreementCounts(); err != nil || counts["org/n1"] != 1 {
+		t.Errorf("expected 1 agreement, got %v %v", counts, err)
+	}
+
+	attempt("ag2")
+	if counts, err := n.getAgreementCounts(); err != nil || counts["org/n1"] != 1 {
+		t.Errorf("expected the counts of the current pass, got %v %v", counts, err)
+	}
+
+	n.pass.nodeProperties["org/n1"] = cachedNodeProperties{props: externalpolicy.PropertyList{*externalpolicy.Property_Factory("zone", "east")}}
+	if props, err := n.getNodeProperties("org/n1"); err != nil || !props.HasProperty("zone") {
+		t.Errorf("expected the cached node properties, got %v %v", props, err)
+	}
+
+	n.startSearchPass()
+	if counts, err := n.getAgreementCounts(); err != nil || counts["org/n1"] != 2 {
+		t.Errorf("expected 2 agreements in the next pass, got %v %v", counts, err)
+	} else if len(n.pass.nodeProperties) != 0 {
+		t.Errorf("expected the node properties to be forgotten in the next pass")
+	}
+}
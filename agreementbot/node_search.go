@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/businesspolicy"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/events"
@@ -30,12 +31,18 @@ type NodeSearch struct {
 	lastSearchComplete   bool
 	lastSearchTime       uint64
 	searchThread         chan bool
-	rescanLock           sync.Mutex // The lock that protects the rescanNeeded flag. The rescanNeeded flag can be checked/changed on different threads.
-	rescanNeeded         bool       // A broad indicator that something policy or pattern related changed, and therefore the agbot needs to rescan all nodes.
-	batchSize            uint64     // The max number of nodes that this object will process in a deployment policy search result.
-	activeDeviceTimeoutS int        // The amount of time a device can go without heartbeating and still be considered active for the purposes of search.
-	retryLookBack        uint64     // The amount of time to look backward for node changes when node retries are happening.
-	policyOrder          bool       // When true, order policies most recently changed to least recently changed.
+	rescanLock           sync.Mutex                // The lock that protects the rescanNeeded flag. The rescanNeeded flag can be checked/changed on different threads.
+	rescanNeeded         bool                      // A broad indicator that something policy or pattern related changed, and therefore the agbot needs to rescan all nodes.
+	batchSize            uint64                    // The max number of nodes that this object will process in a deployment policy search result.
+	activeDeviceTimeoutS int                       // The amount of time a device can go without heartbeating and still be considered active for the purposes of search.
+	retryLookBack        uint64                    // The amount of time to look backward for node changes when node retries are happening.
+	policyOrder          bool                      // When true, order policies most recently changed to least recently changed.
+	rollouts             map[string]*rolloutNodes  // The nodes found and held back by deployment policy rollouts, keyed by policy name. Only used on the search thread.
+	sessionStarts        map[string]time.Time      // When the current search session of each deployment policy started, keyed by policy name. Only used on the search thread.
+	placements           map[string]heldNodes      // The nodes held back by the placement of deployment policies, keyed by policy name. Only used on the search thread.
+	placementAttempts    map[string]queuedAttempts // The agreement attempts queued for deployment policies with a placement, keyed by policy name. Only used on the search thread.
+	attemptTimeoutS      uint64                    // How long a queued agreement attempt counts against the placement of its policy before it is in the database.
+	pass                 *searchPassCache          // The node data read during the current pass of the search. Only used on the search thread.
 }
 
 func NewNodeSearch() *NodeSearch {
@@ -46,6 +53,11 @@ func NewNodeSearch() *NodeSearch {
 		lastSearchTime:      0,
 		searchThread:        make(chan bool, 10),
 		rescanNeeded:        false,
+		rollouts:            make(map[string]*rolloutNodes),
+		sessionStarts:       make(map[string]time.Time),
+		placements:          make(map[string]heldNodes),
+		placementAttempts:   make(map[string]queuedAttempts),
+		pass:                newSearchPassCache(),
 	}
 	return ns
 }
@@ -64,6 +76,7 @@ func (n *NodeSearch) Init(db persistence.AgbotDatabase, pm *policy.PolicyManager
 	n.activeDeviceTimeoutS = cfg.AgreementBot.ActiveDeviceTimeoutS
 	n.retryLookBack = cfg.GetAgbotRetryLookBackWindow()
 	n.policyOrder = cfg.GetAgbotPolicyOrder()
+	n.attemptTimeoutS = cfg.AgreementBot.ProtocolTimeoutS
 
 	// Set the time of the worker restart to 1 minute ago. This time is used to indicate that the node searches need to go backward in time
 	// because this agbot just restarted, and therefore could have lost search results that were in memory but the database was
@@ -146,6 +159,8 @@ func (n *NodeSearch) Scan() {
 // main thread so that the main thread can continue handling inflight agreements and changes.
 func (n *NodeSearch) findAndMakeAgreements() {
 
+	n.startSearchPass()
+
 	if err := n.db.DumpSearchSessions(); err != nil {
 		glog.Errorf(AWlogString(fmt.Sprintf("unable to dump search session records, error: %v", err)))
 	}
@@ -166,16 +181,24 @@ func (n *NodeSearch) findAndMakeAgreements() {
 
 		for _, consumerPolicy := range availablePolicies {
 
+			// Skip the policy while its maintenance schedule does not allow new agreements. The search session of the policy
+			// is not used, so the nodes that change in the meantime are found when the agreement window opens.
+			if !n.agreementsAllowed(org, &consumerPolicy) {
+				glog.V(3).Infof(AWlogString(fmt.Sprintf("skipping %v, outside of its agreement windows", consumerPolicy.Header.Name)))
+				n.SetRescanNeeded()
+				continue
+			}
+
 			// Search for nodes based on the current changedSince timestamp to pick up any newly changed nodes.
 			if consumerPolicy.PatternId != "" {
-				if _, err := n.searchNodesAndMakeAgreements(&consumerPolicy, org, "", 0); err != nil {
+				if _, err := n.searchNodesAndMakeAgreements(&consumerPolicy, org, "", 0, nil, nil, nil); err != nil {
 					// Dont move the changed since time forward since there was an error.
 					searchError = true
 					break
 				}
 			} else if pBE := businessPolManager.GetBusinessPolicyEntry(org, &consumerPolicy); pBE != nil {
 				_, polName := cutil.SplitOrgSpecUrl(consumerPolicy.Header.Name)
-				if lastPage, err := n.searchNodesAndMakeAgreements(&consumerPolicy, org, polName, pBE.Updated); err != nil {
+				if lastPage, err := n.searchNodesAndMakeAgreements(&consumerPolicy, org, polName, pBE.Updated, pBE.Rollout, pBE.NodeRanking, pBE.Placement); err != nil {
 					// Dont move the changed since time forward since there was an error.
 					searchError = true
 					break
@@ -198,6 +221,10 @@ func (n *NodeSearch) findAndMakeAgreements() {
 		n.SetRescanNeeded()
 	}
 
+	// Forget about rollouts for deployment policies that are gone.
+	n.pruneRollouts()
+	n.prunePlacements()
+
 	// Dump search tables to the log.
 	if err := n.db.DumpSearchSessions(); err != nil {
 		glog.Errorf(AWlogString(fmt.Sprintf("unable to dump search session records, error: %v", err)))
@@ -227,8 +254,10 @@ func (n *NodeSearch) getOrderedPolicies(org string) []policy.Policy {
 
 // Search the exchange and make agreements with any device that is eligible based on the policies we have and
 // agreement protocols that we support. If the search did not process all the possible node matches, return false
-// to indicate that there are more nodes to be processed.
-func (n *NodeSearch) searchNodesAndMakeAgreements(consumerPolicy *policy.Policy, org string, polName string, polLastUpdateTime uint64) (bool, error) {
+// to indicate that there are more nodes to be processed. When the deployment policy has a rollout section, agreements are only
+// made with as many nodes as the current step of the rollout allows. When the deployment policy has a node ranking strategy,
+// the nodes are offered agreements in the order chosen by the strategy.
+func (n *NodeSearch) searchNodesAndMakeAgreements(consumerPolicy *policy.Policy, org string, polName string, polLastUpdateTime uint64, rollout *businesspolicy.RolloutPolicy, ranking *businesspolicy.NodeRanking, placement *businesspolicy.Placement) (bool, error) {
 
 	endOfResults := true
 
@@ -263,7 +292,37 @@ func (n *NodeSearch) searchNodesAndMakeAgreements(consumerPolicy *policy.Policy,
 			}
 		}
 
-		for _, dev := range *devices {
+		// Apply the rollout of the deployment policy. The nodes held back by the rollout are processed with the nodes from
+		// the search, up to the number of new agreements that the rollout allows.
+		candidates := *devices
+		allowance := -1
+		if rollout != nil {
+			if rs, nodes, allowed, err := n.startRolloutSearch(consumerPolicy.Header.Name, rollout, polLastUpdateTime, *devices, ags); err != nil {
+				glog.Errorf(AWlogString(fmt.Sprintf("unable to apply rollout for %v, error: %v", consumerPolicy.Header.Name, err)))
+				return endOfResults, err
+			} else {
+				candidates = nodes
+				allowance = allowed
+				defer n.finishRolloutSearch(rs)
+			}
+		}
+
+		// Check the nodes against the placement of the deployment policy. The nodes held back by the placement are
+		// checked again, the agreements that kept them out might be gone.
+		var tracker *placementTracker
+		if placement != nil {
+			var err error
+			if tracker, err = n.newPlacementTracker(consumerPolicy.Header.Name, placement, ags); err != nil {
+				glog.Errorf(AWlogString(fmt.Sprintf("unable to apply placement for %v, error: %v", consumerPolicy.Header.Name, err)))
+				return endOfResults, err
+			}
+			candidates = n.addPlacementNodes(consumerPolicy.Header.Name, candidates, ags)
+		}
+
+		// Order the nodes so that the ones preferred by the ranking strategy are offered agreements first.
+		candidates = n.rankNodes(consumerPolicy.Header.Name, ranking, candidates, ags)
+
+		for _, dev := range candidates {
 
 			glog.V(3).Infof(AWlogString(fmt.Sprintf("picked up %v for policy %v.", dev.ShortString(), consumerPolicy.Header.Name)))
 			glog.V(5).Infof(AWlogString(fmt.Sprintf("picked up %v", dev)))
@@ -280,6 +339,28 @@ func (n *NodeSearch) searchNodesAndMakeAgreements(consumerPolicy *policy.Policy,
 				continue
 			}
 
+			// If the placement of the policy does not allow an agreement with the device, hold it back until the placement changes.
+			if tracker != nil {
+				if tracker.queued(dev.Id) {
+					glog.V(5).Infof(AWlogString(fmt.Sprintf("skipping device id %v, agreement attempt already queued with %v", dev.Id, consumerPolicy.Header.Name)))
+					continue
+				} else if allowed, reason, err := tracker.allows(dev.Id); err != nil {
+					glog.Errorf(AWlogString(fmt.Sprintf("skipping device id %v, unable to check placement of %v, error: %v", dev.Id, consumerPolicy.Header.Name, err)))
+					continue
+				} else if !allowed {
+					glog.V(5).Infof(AWlogString(fmt.Sprintf("holding back device id %v, placement of %v does not allow it: %v", dev.Id, consumerPolicy.Header.Name, reason)))
+					n.holdBackPlacementNode(consumerPolicy.Header.Name, dev)
+					continue
+				}
+			}
+
+			// If the rollout does not allow more agreements, hold the device back until the rollout moves to the next step.
+			if rollout != nil && allowance == 0 {
+				glog.V(5).Infof(AWlogString(fmt.Sprintf("holding back device id %v, rollout of %v does not allow more agreements", dev.Id, consumerPolicy.Header.Name)))
+				n.holdBackRolloutNode(consumerPolicy.Header.Name, dev)
+				continue
+			}
+
 			producerPolicy := policy.Policy_Factory(consumerPolicy.Header.Name)
 
 			// Get the cached service policies from the business policy manager. The returned value
@@ -311,6 +392,16 @@ func (n *NodeSearch) searchNodesAndMakeAgreements(consumerPolicy *policy.Policy,
 				glog.Errorf(AWlogString(fmt.Sprintf("protocol handler for %v not accepting new agreement commands.", protocol)))
 			} else {
 				n.ph.Get(protocol).HandleMakeAgreement(cmd, n.ph.Get(protocol))
+				if rollout != nil {
+					n.releaseRolloutNode(consumerPolicy.Header.Name, dev)
+					if allowance > 0 {
+						allowance -= 1
+					}
+				}
+				if tracker != nil {
+					tracker.placed(dev.Id)
+					n.releasePlacementNode(consumerPolicy.Header.Name, dev)
+				}
 				glog.V(5).Infof(AWlogString(fmt.Sprintf("queued agreement attempt for policy %v and node %v using protocol %v", consumerPolicy.Header.Name, dev.Id, protocol)))
 			}
 		}
@@ -372,8 +463,10 @@ func (n *NodeSearch) searchExchange(pol *policy.Policy, polOrg string, polName s
 		glog.V(3).Infof(AWlogString(fmt.Sprintf("searching %v with %v", pol.PatternId, ser)))
 
 		// Invoke the exchange
+		start := time.Now()
 		devs, err := exchange.GetHTTPAgbotPatternNodeSearchHandler(n.ec)(ser, polOrg, pol.PatternId)
 		if err == nil {
+			searchSessionDuration.Observe(time.Since(start).Seconds(), SEARCH_TYPE_PATTERN)
 			glog.V(3).Infof(AWlogString(fmt.Sprintf("found %v devices in exchange.", len(*devs))))
 		}
 		return devs, err
@@ -399,12 +492,15 @@ func (n *NodeSearch) searchExchange(pol *policy.Policy, polOrg string, polName s
 		if err != nil {
 			glog.Errorf(AWlogString(fmt.Sprintf("unable to start a new search session for %v, error: %v", pol.Header.Name, err)))
 			return nil, err
+		} else if _, ok := n.sessionStarts[pol.Header.Name]; !ok {
+			n.sessionStarts[pol.Header.Name] = time.Now()
 		}
 
 		// Get a list of node orgs that the agbot is serving for this business policy.
 		nodeOrgs := businessPolManager.GetServedNodeOrgs(polOrg, polName)
 		if len(nodeOrgs) == 0 {
 			glog.V(3).Infof(AWlogString(fmt.Sprintf("Business policy %v exists but currently the agbot is not serving this policy for any organizations.", pol.Header.Name)))
+			delete(n.sessionStarts, pol.Header.Name)
 			empty := make([]exchange.SearchResultDevice, 0, 0)
 			return &empty, nil
 		}
@@ -458,6 +554,10 @@ func (n *NodeSearch) searchExchange(pol *policy.Policy, polOrg string, polName s
 					// Update the DB with the new changedSince value, indicating that the scan is complete. This update also
 					// ends the current search session for this policy.
 					glog.V(3).Infof(AWlogString(fmt.Sprintf("for %v ending Session: %v", pol.Header.Name, searchSession)))
+					if started, ok := n.sessionStarts[pol.Header.Name]; ok {
+						searchSessionDuration.Observe(time.Since(started).Seconds(), SEARCH_TYPE_POLICY)
+						delete(n.sessionStarts, pol.Header.Name)
+					}
 					if sessionEnded, err := n.db.UpdateSearchSessionChangedSince(changedSince, currentSearchStart, pol.Header.Name); err != nil {
 						glog.Errorf(AWlogString(fmt.Sprintf("unable to update search session changed since, error: %v", err)))
 					} else {
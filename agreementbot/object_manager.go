@@ -22,6 +22,7 @@ type MMSObjectPolicyManager struct {
 	orgMap            map[string]map[string][]MMSObjectPolicyEntry // The list of object policies in the cache.
 	ServedOrgs        map[string]exchange.ServedBusinessPolicy     // The served node org, business policy org and business policy triplets. The key is the triplet exchange id.
 	garbageCollection int64                                        // Last time garbage collection was done.
+	gcCheck           func() bool                                  // Garbage collection is only done when this returns true, nil means always.
 	config            *config.HorizonConfig
 }
 
@@ -34,6 +35,17 @@ func NewMMSObjectPolicyManager(cfg *config.HorizonConfig) *MMSObjectPolicyManage
 	return m
 }
 
+// The name of the garbage collection of the cache as a singleton duty of the leader agbot.
+const MMS_GARBAGE_COLLECTION = "AgbotMMSGarbageCollection"
+
+// When several agbots share a database, only the leader garbage collects the cache. The object policies that the other agbots
+// keep for deleted objects are harmless, an object is checked again before it is placed on a node.
+func (m *MMSObjectPolicyManager) SetGarbageCollectionCheck(check func() bool) {
+	m.orgMapLock.Lock()
+	defer m.orgMapLock.Unlock()
+	m.gcCheck = check
+}
+
 func (m *MMSObjectPolicyManager) String() string {
 	m.orgMapLock.Lock()
 	defer m.orgMapLock.Unlock()
@@ -190,7 +202,7 @@ func (m *MMSObjectPolicyManager) UpdatePolicies(org string, updatedPolicies *exc
 	// If there are object policies that have been deleted, we wont know until we ask the MMS if the object still exists.
 	// Loop through all the cached object policies checking to see if they still exist.
 	diff := time.Now().Unix() - m.garbageCollection
-	if diff >= m.config.AgreementBot.MMSGarbageCollectionInterval {
+	if diff >= m.config.AgreementBot.MMSGarbageCollectionInterval && (m.gcCheck == nil || m.gcCheck()) {
 		m.garbageCollection = time.Now().Unix()
 		glog.V(5).Infof(mmsLogString(fmt.Sprintf("Starting object policy garbage collection")))
 		for org, serviceMap := range m.orgMap {
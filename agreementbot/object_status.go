@@ -0,0 +1,277 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/gorilla/mux"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/compcheck"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
+	"golang.org/x/text/message"
+	"net/http"
+	"sort"
+)
+
+// The delivery status of an MMS object with a destination policy shows, for each node that has an agreement with this
+// agbot for a service in the object's policy, whether the object is expected on the node, whether the node is in the
+// object's destination list and the status of the delivery reported by the CSS.
+
+// The delivery state of an object on a node.
+const (
+	OBJECT_DELIVERY_DELIVERED    = "delivered"    // the CSS has delivered the object to the node, or the node has consumed it
+	OBJECT_DELIVERY_PENDING      = "pending"      // the node is a destination, the object is not delivered yet
+	OBJECT_DELIVERY_FAILED       = "failed"       // the CSS reported an error delivering the object, or the object was deleted from the node
+	OBJECT_DELIVERY_MISSING      = "missing"      // the object is expected on the node but the node is not a destination
+	OBJECT_DELIVERY_NOT_EXPECTED = "not_expected" // the node is a destination but the object is not expected on it by this agbot
+)
+
+// The destination type of an edge node in the CSS.
+const CSS_DEST_TYPE_EDGE_NODE = "openhorizon.edgenode"
+
+// The delivery status of an object on one node.
+type ObjectDeliveryNode struct {
+	NodeId      string `json:"node_id"`
+	AgreementId string `json:"agreement_id,omitempty"` // the agreement that makes the node eligible for the object
+	Expected    bool   `json:"expected"`               // the node's agreement and node policy are compatible with the object's policy
+	Destination bool   `json:"destination"`            // the node is in the object's destination list
+	Status      string `json:"status,omitempty"`       // the destination status reported by the CSS
+	Message     string `json:"message,omitempty"`      // the destination message reported by the CSS
+	Delivery    string `json:"delivery"`               // the delivery state
+	Reason      string `json:"reason,omitempty"`       // why the object is not expected on the node
+}
+
+// The delivery status of an object on all the nodes that are expected or are destinations.
+type ObjectDeliveryStatus struct {
+	OrgID      string               `json:"orgID"`
+	ObjectType string               `json:"objectType"`
+	ObjectID   string               `json:"objectID"`
+	Nodes      []ObjectDeliveryNode `json:"nodes"`
+	Summary    map[string]int       `json:"summary"`          // the number of nodes in each delivery state
+	Errors     map[string]string    `json:"errors,omitempty"` // the nodes whose policy could not be checked
+}
+
+// Checks the object's policy against the node's policy. It returns the reason when the object is not compatible
+// with the node.
+type objectNodeCheckFunc func(nodeId string) (string, error)
+
+// Returns the delivery state for the CSS status of a destination.
+func objectDeliveryState(cssStatus string) string {
+	switch cssStatus {
+	case "delivered", "consumed":
+		return OBJECT_DELIVERY_DELIVERED
+	case "error", "deleted":
+		return OBJECT_DELIVERY_FAILED
+	}
+	return OBJECT_DELIVERY_PENDING
+}
+
+// The agreements that could place an object on a node, they are in progress and are not for a pattern. These are the
+// same agreements that the agreement workers use when an object policy changes.
+func objectPolicyAgreementFilters() []persistence.AFilter {
+	inProgress := func(e persistence.Agreement) bool { return e.AgreementCreationTime != 0 && e.AgreementTimedout == 0 }
+	notPattern := func(e persistence.Agreement) bool { return e.Pattern == "" }
+	return []persistence.AFilter{inProgress, notPattern, persistence.UnarchivedAFilter()}
+}
+
+// Build the delivery status of an object from the agreements of this agbot and the object's destinations. Only the
+// agreements with nodes in the object's org are considered, objects are not placed on nodes in other orgs.
+func evaluateObjectDelivery(objPol *exchange.ObjectDestinationPolicy, agreements []persistence.Agreement, dests exchange.ObjectDestinationStatuses, archSynonyms config.ArchSynonyms, check objectNodeCheckFunc) *ObjectDeliveryStatus {
+
+	output := &ObjectDeliveryStatus{
+		OrgID:      objPol.OrgID,
+		ObjectType: objPol.ObjectType,
+		ObjectID:   objPol.ObjectID,
+		Nodes:      []ObjectDeliveryNode{},
+		Summary:    map[string]int{},
+		Errors:     map[string]string{},
+	}
+
+	nodes := make(map[string]*ObjectDeliveryNode)
+
+	// The nodes that have an agreement for a service in the object's policy.
+	for _, ag := range agreements {
+		if exchange.GetOrg(ag.DeviceId) != objPol.OrgID {
+			continue
+		} else if n, ok := nodes[ag.DeviceId]; ok && n.Expected {
+			continue
+		}
+
+		compatible := false
+		for _, serviceId := range ag.ServiceId {
+			if found, err := findCompatibleService(serviceId, objPol, "SecureAPI", archSynonyms); err == nil && found {
+				compatible = true
+				break
+			}
+		}
+		if !compatible {
+			continue
+		}
+
+		node := &ObjectDeliveryNode{NodeId: ag.DeviceId, AgreementId: ag.CurrentAgreementId}
+		if reason, err := check(ag.DeviceId); err != nil {
+			output.Errors[ag.DeviceId] = err.Error()
+			continue
+		} else if reason != "" {
+			node.Reason = reason
+		} else {
+			node.Expected = true
+		}
+		nodes[ag.DeviceId] = node
+	}
+
+	// The destinations of the object, the destination ids are the node ids without the org.
+	for _, dest := range dests {
+		if dest.DestType != CSS_DEST_TYPE_EDGE_NODE {
+			continue
+		}
+		nodeId := fmt.Sprintf("%v/%v", objPol.OrgID, dest.DestID)
+		if _, failed := output.Errors[nodeId]; failed {
+			continue
+		}
+		node, ok := nodes[nodeId]
+		if !ok {
+			node = &ObjectDeliveryNode{NodeId: nodeId, Reason: "no agreement with this agbot for a service in the object policy"}
+			nodes[nodeId] = node
+		}
+		node.Destination = true
+		node.Status = dest.Status
+		node.Message = dest.Message
+	}
+
+	nodeIds := make([]string, 0, len(nodes))
+	for id, node := range nodes {
+		if node.Expected || node.Destination {
+			nodeIds = append(nodeIds, id)
+		}
+	}
+	sort.Strings(nodeIds)
+
+	for _, id := range nodeIds {
+		node := nodes[id]
+		if !node.Expected {
+			node.Delivery = OBJECT_DELIVERY_NOT_EXPECTED
+		} else if !node.Destination {
+			node.Delivery = OBJECT_DELIVERY_MISSING
+		} else {
+			node.Delivery = objectDeliveryState(node.Status)
+		}
+		output.Summary[node.Delivery]++
+		output.Nodes = append(output.Nodes, *node)
+	}
+
+	return output
+}
+
+// @Title object_status
+// @Description Show the delivery status of the MMS objects with a destination policy in an organization. For each object, the nodes that have an agreement with this agbot for a service in the object's policy and whose node policy is compatible with the object's policy are expected to receive the object. They are compared with the object's destination list and the delivery status reported by the CSS.
+// @Accept  json
+// @Produce json
+// @Param   org          path     string   true         "The organization of the objects."
+// @Param   objectType   query    string   false        "Only show the objects of this type."
+// @Param   objectID     query    string   false        "Only show the object with this id."
+// @Success 200 {array}  agreementbot.ObjectDeliveryStatus
+// @Failure 400 {object}  string      "Invalid input"
+// @Failure 401 {object}  string      "Failed to authenticate"
+// @Failure 403 {object}  string      "Role not allowed"
+// @Failure 500 {object}  string      "Error"
+// @Resource /mms
+// @Router /mms/status/{org} [get]
+// This function shows the delivery status of the objects with a destination policy.
+func (a *SecureAPI) object_status(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		glog.V(5).Infof(APIlogString(fmt.Sprintf("/mms/status called.")))
+
+		if user_ec, msgPrinter, ok := a.processUserCred("/mms/status", SECURE_API_ROLE_READ_ONLY, w, r); ok {
+			org := mux.Vars(r)["org"]
+			objType := r.URL.Query().Get("objectType")
+			objId := r.URL.Query().Get("objectID")
+			if objId != "" && objType == "" {
+				writeResponse(w, msgPrinter.Sprintf("objectType must be specified with objectID."), http.StatusBadRequest)
+			} else {
+				output, err := a.objectStatus(user_ec, org, objType, objId, msgPrinter)
+				a.writeCompCheckResponse(w, output, err, msgPrinter)
+			}
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Get the delivery status of the objects with a destination policy in the org. The objects and their destinations are
+// read from the CSS with the caller's credentials, so only the objects that the caller can see are shown.
+func (a *SecureAPI) objectStatus(user_ec exchange.ExchangeContext, org string, objType string, objId string, msgPrinter *message.Printer) ([]ObjectDeliveryStatus, error) {
+
+	objPolicies, err := exchange.GetUpdatedObjects(user_ec, org, 0)
+	if err != nil {
+		return nil, fmt.Errorf(msgPrinter.Sprintf("Failed to get the object policies in organization %v from the CSS. %v", org, err))
+	}
+
+	agreements := make([]persistence.Agreement, 0)
+	for _, protocol := range policy.AllAgreementProtocols() {
+		if ags, err := a.db.FindAgreements(objectPolicyAgreementFilters(), protocol); err != nil {
+			return nil, fmt.Errorf(msgPrinter.Sprintf("Failed to get the %v agreements from the database. %v", protocol, err))
+		} else {
+			agreements = append(agreements, ags...)
+		}
+	}
+
+	// The node policies are read once for all the objects.
+	nodePolicyHandler := exchange.GetHTTPNodePolicyHandler(user_ec)
+	nodePolicies := make(map[string]*policy.Policy)
+	getNodePolicy := func(nodeId string) (*policy.Policy, error) {
+		if pol, ok := nodePolicies[nodeId]; ok {
+			return pol, nil
+		}
+		_, pol, err := compcheck.GetNodePolicy(nodePolicyHandler, nodeId, msgPrinter)
+		if err != nil {
+			return nil, err
+		} else if pol == nil {
+			return nil, fmt.Errorf(msgPrinter.Sprintf("No node policy found for %v", nodeId))
+		}
+		nodePolicies[nodeId] = pol
+		return pol, nil
+	}
+
+	output := make([]ObjectDeliveryStatus, 0)
+	for _, objPol := range *objPolicies {
+		if (objType != "" && objPol.ObjectType != objType) || (objId != "" && objPol.ObjectID != objId) {
+			continue
+		}
+
+		check := func(nodeId string) (string, error) {
+			nodePolicy, err := getNodePolicy(nodeId)
+			if err != nil {
+				return "", err
+			}
+			// The node policy is copied because the check removes its constraints.
+			np := *nodePolicy
+			if err := checkObjectPolicy(&objPol, &np); err != nil {
+				return err.Error(), nil
+			}
+			return "", nil
+		}
+
+		dests, err := exchange.GetObjectDestinations(user_ec, objPol.OrgID, objPol.ObjectID, objPol.ObjectType)
+		if err != nil {
+			return nil, fmt.Errorf(msgPrinter.Sprintf("Failed to get the destinations of object %v of type %v from the CSS. %v", objPol.ObjectID, objPol.ObjectType, err))
+		} else if dests == nil {
+			dests = new(exchange.ObjectDestinationStatuses)
+		}
+
+		output = append(output, *evaluateObjectDelivery(&objPol, agreements, *dests, a.Config.ArchSynonyms, check))
+	}
+
+	if objId != "" && len(output) == 0 {
+		return nil, compcheck.NewCompCheckError(fmt.Errorf(msgPrinter.Sprintf("Object %v of type %v with a destination policy not found in organization %v.", objId, objType, org)), compcheck.COMPCHECK_INPUT_ERROR)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,87 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/edge-sync-service/common"
+	"testing"
+)
+
+func Test_evaluateObjectDelivery(t *testing.T) {
+	objPol := &exchange.ObjectDestinationPolicy{
+		OrgID:      "org1",
+		ObjectType: "model",
+		ObjectID:   "obj1",
+		DestinationPolicy: exchange.DestinationPolicy{
+			Services: []common.ServiceID{{OrgID: "org1", ServiceName: "svc1", Arch: "amd64", Version: "[1.0.0,2.0.0)"}},
+		},
+	}
+
+	agreement := func(agId string, nodeId string, serviceId string) persistence.Agreement {
+		return persistence.Agreement{CurrentAgreementId: agId, DeviceId: nodeId, ServiceId: []string{serviceId}}
+	}
+	agreements := []persistence.Agreement{
+		agreement("ag1", "org1/n1", "org1/svc1_1.0.0_amd64"), // expected and delivered
+		agreement("ag2", "org1/n2", "org1/svc1_1.5.0_amd64"), // expected and not a destination
+		agreement("ag3", "org1/n3", "org1/svc1_1.0.0_amd64"), // node policy is not compatible
+		agreement("ag4", "org1/n4", "org1/svc1_3.0.0_amd64"), // service version out of range
+		agreement("ag5", "org2/n5", "org1/svc1_1.0.0_amd64"), // node in another org
+		agreement("ag6", "org1/n6", "org1/svc1_1.0.0_amd64"), // expected, delivery failed
+		agreement("ag7", "org1/n7", "org1/svc1_1.0.0_amd64"), // node policy could not be read
+	}
+
+	dests := exchange.ObjectDestinationStatuses{
+		{DestType: CSS_DEST_TYPE_EDGE_NODE, DestID: "n1", Status: "consumed"},
+		{DestType: CSS_DEST_TYPE_EDGE_NODE, DestID: "n3", Status: "delivered"},
+		{DestType: CSS_DEST_TYPE_EDGE_NODE, DestID: "n6", Status: "error", Message: "no space"},
+		{DestType: CSS_DEST_TYPE_EDGE_NODE, DestID: "n7", Status: "pending"},
+		{DestType: CSS_DEST_TYPE_EDGE_NODE, DestID: "n8", Status: "delivering"},
+		{DestType: "other", DestID: "n9", Status: "delivered"},
+	}
+
+	check := func(nodeId string) (string, error) {
+		switch nodeId {
+		case "org1/n3":
+			return "Policy Incompatible", nil
+		case "org1/n7":
+			return "", errors.New("exchange error")
+		}
+		return "", nil
+	}
+
+	output := evaluateObjectDelivery(objPol, agreements, dests, config.NewArchSynonyms(), check)
+
+	expected := []ObjectDeliveryNode{
+		{NodeId: "org1/n1", AgreementId: "ag1", Expected: true, Destination: true, Status: "consumed", Delivery: OBJECT_DELIVERY_DELIVERED},
+		{NodeId: "org1/n2", AgreementId: "ag2", Expected: true, Delivery: OBJECT_DELIVERY_MISSING},
+		{NodeId: "org1/n3", AgreementId: "ag3", Destination: true, Status: "delivered", Delivery: OBJECT_DELIVERY_NOT_EXPECTED, Reason: "Policy Incompatible"},
+		{NodeId: "org1/n6", AgreementId: "ag6", Expected: true, Destination: true, Status: "error", Message: "no space", Delivery: OBJECT_DELIVERY_FAILED},
+		{NodeId: "org1/n8", Destination: true, Status: "delivering", Delivery: OBJECT_DELIVERY_NOT_EXPECTED, Reason: "no agreement with this agbot for a service in the object policy"},
+	}
+
+	if len(output.Nodes) != len(expected) {
+		t.Fatalf("expected %v nodes, got %v", len(expected), output.Nodes)
+	}
+	for ix, node := range output.Nodes {
+		if node != expected[ix] {
+			t.Errorf("expected node %v, got %v", expected[ix], node)
+		}
+	}
+
+	if output.Summary[OBJECT_DELIVERY_DELIVERED] != 1 || output.Summary[OBJECT_DELIVERY_MISSING] != 1 || output.Summary[OBJECT_DELIVERY_FAILED] != 1 || output.Summary[OBJECT_DELIVERY_NOT_EXPECTED] != 2 {
+		t.Errorf("wrong summary %v", output.Summary)
+	} else if len(output.Errors) != 1 || output.Errors["org1/n7"] == "" {
+		t.Errorf("wrong errors %v", output.Errors)
+	}
+
+	// objectDeliveryState maps the CSS statuses
+	for status, state := range map[string]string{"pending": OBJECT_DELIVERY_PENDING, "delivering": OBJECT_DELIVERY_PENDING, "delivered": OBJECT_DELIVERY_DELIVERED, "consumed": OBJECT_DELIVERY_DELIVERED, "error": OBJECT_DELIVERY_FAILED, "deleted": OBJECT_DELIVERY_FAILED} {
+		if s := objectDeliveryState(status); s != state {
+			t.Errorf("status %v should be %v, got %v", status, state, s)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+	"sort"
+)
+
+// The agbots sharing a database rebalance the agreements across their partitions. Each agbot periodically compares the
+// number of active agreements in its own partition with the other live partitions. An agbot only ever hands off agreements
+// from its own partition, because those are the agreements that it can quiesce, so the agbots never compete for the same
+// agreements. The receiving agbot adopts the agreements the next time it checks the partitions.
+
+// Calculate the partition to hand off agreements to, and the number of agreements to hand off, so that the primary partition
+// moves towards the average number of active agreements. Only live partitions take part. Nothing is handed off unless the
+// primary partition has more than threshold agreements more than the least loaded partition.
+func planRebalance(primary string, loads []persistence.PartitionLoad, threshold int64, batch int64) (string, int64) {
+
+	var primaryLoad *persistence.PartitionLoad
+	var minLoad *persistence.PartitionLoad
+	var total, live int64
+
+	for i, l := range loads {
+		if !l.Live {
+			continue
+		}
+		total += l.Active
+		live += 1
+		if l.Id == primary {
+			primaryLoad = &loads[i]
+		} else if minLoad == nil || l.Active < minLoad.Active {
+			minLoad = &loads[i]
+		}
+	}
+
+	if primaryLoad == nil || minLoad == nil || threshold < 0 || primaryLoad.Active-minLoad.Active <= threshold {
+		return "", 0
+	}
+
+	// Hand off no more than the primary partition has above the average, and no more than the receiving partition has below
+	// the average, so that the receiver does not become the most loaded partition.
+	excess := primaryLoad.Active - (total+live-1)/live
+	deficit := total/live - minLoad.Active
+
+	count := excess
+	if deficit < count {
+		count = deficit
+	}
+	if batch < count {
+		count = batch
+	}
+	if count <= 0 {
+		return "", 0
+	}
+	return minLoad.Id, count
+}
+
+// Agreements that are finalized and not being terminated are stable, so they can be handed off to another agbot.
+func handOffAFilter() persistence.AFilter {
+	return func(a persistence.Agreement) bool {
+		return !a.Archived && a.AgreementFinalizedTime != 0 && a.AgreementTimedout == 0 && a.TerminatedReason == 0
+	}
+}
+
+// The subworker that keeps the agreements balanced across partitions.
+func (w *AgreementBotWorker) rebalancePartitions() int {
+
+	// First adopt any agreements that were handed off to us.
+	w.adoptHandedOffAgreements()
+
+	if w.Config.GetPartitionRebalanceThreshold() < 0 {
+		return 0
+	}
+
+	loads, err := persistence.GetPartitionLoads(w.db, w.Config.GetPartitionStale())
+	if err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to get partition loads, error: %v", err)))
+		return 0
+	}
+
+	target, count := planRebalance(w.db.PrimaryPartition(), loads, w.Config.GetPartitionRebalanceThreshold(), w.Config.GetPartitionRebalanceBatch())
+	if count == 0 {
+		glog.V(5).Infof(AWlogString(fmt.Sprintf("partitions are balanced: %v", loads)))
+		return 0
+	}
+
+	glog.V(3).Infof(AWlogString(fmt.Sprintf("handing off %v agreements to partition %v, partition loads: %v", count, target, loads)))
+	w.handOffAgreements(target, count)
+	return 0
+}
+
+// Hand off up to count stable agreements to the target partition, oldest first.
+func (w *AgreementBotWorker) handOffAgreements(target string, count int64) {
+
+	for _, agp := range policy.AllAgreementProtocols() {
+		if count <= 0 {
+			return
+		}
+
+		agreements, err := w.db.FindAgreements([]persistence.AFilter{handOffAFilter()}, agp)
+		if err != nil {
+			glog.Errorf(AWlogString(fmt.Sprintf("unable to read agreements for protocol %v, error: %v", agp, err)))
+			return
+		}
+
+		sort.Slice(agreements, func(i, j int) bool {
+			return agreements[i].AgreementFinalizedTime < agreements[j].AgreementFinalizedTime
+		})
+		if int64(len(agreements)) > count {
+			agreements = agreements[:count]
+		}
+		if len(agreements) == 0 {
+			continue
+		}
+
+		byId := make(map[string]persistence.Agreement, len(agreements))
+		ids := make([]string, 0, len(agreements))
+		for _, ag := range agreements {
+			byId[ag.CurrentAgreementId] = ag
+			ids = append(ids, ag.CurrentAgreementId)
+		}
+
+		move, err := w.db.HandOffAgreements(target, agp, ids)
+		if err != nil {
+			glog.Errorf(AWlogString(fmt.Sprintf("unable to hand off agreements to partition %v, error: %v", target, err)))
+			return
+		} else if move == nil {
+			continue
+		}
+
+		// The agreements are no longer ours, so they no longer count against our policies.
+		for _, agId := range move.Agreements {
+			ag := byId[agId]
+			if pol := w.getAgreementPolicy(&ag); pol != nil {
+				if err := w.pm.CancelAgreement([]policy.Policy{*pol}, agId, ag.Org); err != nil {
+					glog.Warningf(AWlogString(fmt.Sprintf("unable to remove handed off agreement %v from the policy agreement counter, error: %v", agId, err)))
+				}
+			}
+		}
+
+		glog.V(3).Infof(AWlogString(fmt.Sprintf("handed off agreements: %v", move)))
+		count -= int64(len(move.Agreements))
+	}
+}
+
+// Add the agreements that other agbots have handed off to us to the policy agreement counter, and complete the moves.
+func (w *AgreementBotWorker) adoptHandedOffAgreements() {
+
+	moves, err := w.db.FindPartitionMoves()
+	if err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to read partition moves, error: %v", err)))
+		return
+	}
+
+	for _, move := range moves {
+		if move.State != persistence.PARTITION_MOVE_HANDED_OFF || move.ToPartition != w.db.PrimaryPartition() {
+			continue
+		}
+
+		for _, agId := range move.Agreements {
+			if ag, err := w.db.FindSingleAgreementByAgreementId(agId, move.Protocol, []persistence.AFilter{persistence.UnarchivedAFilter()}); err != nil {
+				glog.Errorf(AWlogString(fmt.Sprintf("unable to read handed off agreement %v, error: %v", agId, err)))
+			} else if ag == nil {
+				glog.V(3).Infof(AWlogString(fmt.Sprintf("handed off agreement %v is no longer active", agId)))
+			} else if pol := w.getAgreementPolicy(ag); pol == nil {
+				continue
+			} else if err := w.pm.AttemptingAgreement([]policy.Policy{*pol}, agId, ag.Org); err != nil {
+				glog.Warningf(AWlogString(fmt.Sprintf("unable to add handed off agreement %v to the policy agreement counter, error: %v", agId, err)))
+			} else if err := w.pm.FinalAgreement([]policy.Policy{*pol}, agId, ag.Org); err != nil {
+				glog.Warningf(AWlogString(fmt.Sprintf("unable to add handed off agreement %v to the policy agreement counter, error: %v", agId, err)))
+			}
+		}
+
+		if err := w.db.CompletePartitionMove(move.Id); err != nil {
+			glog.Errorf(AWlogString(fmt.Sprintf("unable to complete partition move %v, error: %v", move.Id, err)))
+		} else {
+			glog.V(3).Infof(AWlogString(fmt.Sprintf("adopted handed off agreements: %v", move)))
+		}
+	}
+}
+
+// Return the policy manager's copy of the agreement's policy, or nil if the policy is not known.
+func (w *AgreementBotWorker) getAgreementPolicy(ag *persistence.Agreement) *policy.Policy {
+	if pol, err := policy.DemarshalPolicy(ag.Policy); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to demarshal policy for agreement %v, error %v", ag.CurrentAgreementId, err)))
+	} else if existingPol := w.pm.GetPolicy(ag.Org, pol.Header.Name); existingPol == nil {
+		glog.Warningf(AWlogString(fmt.Sprintf("agreement %v has a policy %v that doesn't exist anymore", ag.CurrentAgreementId, pol.Header.Name)))
+	} else {
+		return existingPol
+	}
+	return nil
+}
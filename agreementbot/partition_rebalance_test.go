@@ -0,0 +1,62 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"testing"
+)
+
+func Test_planRebalance_new_agbot(t *testing.T) {
+
+	loads := []persistence.PartitionLoad{
+		{Id: "1", Live: true, Active: 100},
+		{Id: "2", Live: true, Active: 0},
+	}
+
+	if target, count := planRebalance("1", loads, 10, 100); target != "2" || count != 50 {
+		t.Errorf("expected 50 agreements handed off to partition 2, got %v to %v", count, target)
+	} else if target, count := planRebalance("1", loads, 10, 20); target != "2" || count != 20 {
+		t.Errorf("expected the hand off to be limited to the batch size, got %v to %v", count, target)
+	} else if _, count := planRebalance("2", loads, 10, 100); count != 0 {
+		t.Errorf("the least loaded partition should not hand off agreements, got %v", count)
+	}
+}
+
+func Test_planRebalance_threshold(t *testing.T) {
+
+	loads := []persistence.PartitionLoad{
+		{Id: "1", Live: true, Active: 15},
+		{Id: "2", Live: true, Active: 6},
+	}
+
+	if _, count := planRebalance("1", loads, 10, 100); count != 0 {
+		t.Errorf("partitions within the threshold should not be rebalanced, got %v", count)
+	} else if target, count := planRebalance("1", loads, 5, 100); target != "2" || count != 4 {
+		t.Errorf("expected 4 agreements handed off to partition 2, got %v to %v", count, target)
+	} else if _, count := planRebalance("1", loads, -1, 100); count != 0 {
+		t.Errorf("a negative threshold turns off rebalancing, got %v", count)
+	}
+}
+
+func Test_planRebalance_live_partitions(t *testing.T) {
+
+	// Partitions that are not live never receive agreements and do not count towards the average.
+	loads := []persistence.PartitionLoad{
+		{Id: "1", Live: true, Active: 90},
+		{Id: "2", Live: false, Active: 0},
+		{Id: "3", Live: true, Active: 30},
+		{Id: "4", Live: true, Active: 60},
+	}
+
+	if target, count := planRebalance("1", loads, 10, 100); target != "3" || count != 30 {
+		t.Errorf("expected 30 agreements handed off to partition 3, got %v to %v", count, target)
+	} else if _, count := planRebalance("4", loads, 10, 100); count != 0 {
+		t.Errorf("a partition at the average should not hand off agreements, got %v", count)
+	}
+
+	// A single live partition has nothing to rebalance with.
+	if _, count := planRebalance("1", loads[:2], 10, 100); count != 0 {
+		t.Errorf("expected nothing to rebalance, got %v", count)
+	}
+}
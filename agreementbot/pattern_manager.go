@@ -8,6 +8,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/schedule"
 	"golang.org/x/crypto/sha3"
 	"sync"
 	"time"
@@ -224,6 +225,20 @@ func (pm *PatternManager) GetServedNodeOrgs(pattten_org string, pattern string)
 	return node_orgs
 }
 
+// return the maintenance schedule of the given pattern, nil if the pattern does not have one.
+// this function is called from a different thread.
+func (pm *PatternManager) GetMaintenanceSchedule(pattern_org string, pattern string) *schedule.MaintenanceSchedule {
+	pm.patMapLock.Lock()
+	defer pm.patMapLock.Unlock()
+
+	if pm.hasPattern(pattern_org, pattern) {
+		if pe := pm.OrgPatterns[pattern_org][pattern]; pe.Pattern != nil {
+			return pe.Pattern.Maintenance.DeepCopy()
+		}
+	}
+	return nil
+}
+
 func (pm *PatternManager) GetAllPatternOrgs() []string {
 	pm.spMapLock.Lock()
 	defer pm.spMapLock.Unlock()
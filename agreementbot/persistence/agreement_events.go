@@ -0,0 +1,200 @@
+package persistence
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/policy"
+	"sync"
+	"time"
+)
+
+// Every state transition of an agreement is recorded as an event in an in memory log, so that clients can follow the
+// agreements of the agbot without polling. The log keeps the most recent events, clients resume from the id of the
+// last event they have seen. Event ids increase, also across agbot restarts, but the log itself does not survive a
+// restart.
+
+// The agreement state transitions.
+const (
+	AG_EVENT_ATTEMPT       = "attempt"
+	AG_EVENT_UPDATE        = "update"
+	AG_EVENT_MADE          = "made"
+	AG_EVENT_FINALIZED     = "finalized"
+	AG_EVENT_DATA_VERIFIED = "data_verified"
+	AG_EVENT_TIMED_OUT     = "timed_out"
+	AG_EVENT_ARCHIVED      = "archived"
+)
+
+// The number of events kept in the agreement event log.
+const AG_EVENT_LOG_SIZE = 10000
+
+type AgreementEvent struct {
+	Id                uint64 `json:"id"`
+	Type              string `json:"type"`
+	Time              uint64 `json:"time"`
+	AgreementId       string `json:"agreement_id"`
+	Protocol          string `json:"protocol"`
+	Org               string `json:"org"`
+	DeviceId          string `json:"device_id"`
+	PolicyName        string `json:"policy_name,omitempty"`
+	Pattern           string `json:"pattern,omitempty"`
+	Reason            uint   `json:"reason,omitempty"`             // the termination reason code, for archived agreements
+	ReasonDescription string `json:"reason_description,omitempty"` // the termination reason, for archived agreements
+}
+
+func (e AgreementEvent) String() string {
+	return fmt.Sprintf("Id: %v, Type: %v, Time: %v, AgreementId: %v, Protocol: %v, Org: %v, DeviceId: %v, PolicyName: %v, Pattern: %v, Reason: %v, ReasonDescription: %v",
+		e.Id, e.Type, e.Time, e.AgreementId, e.Protocol, e.Org, e.DeviceId, e.PolicyName, e.Pattern, e.Reason, e.ReasonDescription)
+}
+
+// Selects the events of interest to a client, empty fields match everything.
+type AgreementEventFilter struct {
+	Org        string
+	PolicyName string
+	Pattern    string
+	DeviceId   string
+}
+
+func (f AgreementEventFilter) Matches(e *AgreementEvent) bool {
+	return (f.Org == "" || f.Org == e.Org) &&
+		(f.PolicyName == "" || f.PolicyName == e.PolicyName) &&
+		(f.Pattern == "" || f.Pattern == e.Pattern) &&
+		(f.DeviceId == "" || f.DeviceId == e.DeviceId)
+}
+
+type AgreementEventLog struct {
+	lock    sync.Mutex
+	events  []AgreementEvent // oldest first
+	size    int
+	nextId  uint64
+	changed chan bool // closed when an event is added
+}
+
+func NewAgreementEventLog(size int) *AgreementEventLog {
+	return &AgreementEventLog{
+		events:  make([]AgreementEvent, 0),
+		size:    size,
+		nextId:  uint64(time.Now().UnixNano() / int64(time.Microsecond)),
+		changed: make(chan bool),
+	}
+}
+
+// The agreement event log of this agbot.
+var AgreementEvents = NewAgreementEventLog(AG_EVENT_LOG_SIZE)
+
+// Record a state transition of the agreement.
+func (l *AgreementEventLog) Add(eventType string, ag *Agreement) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.events = append(l.events, AgreementEvent{
+		Id:          l.nextId,
+		Type:        eventType,
+		Time:        uint64(time.Now().Unix()),
+		AgreementId: ag.CurrentAgreementId,
+		Protocol:    ag.AgreementProtocol,
+		Org:         ag.Org,
+		DeviceId:    ag.DeviceId,
+		PolicyName:  ag.PolicyName,
+		Pattern:     ag.Pattern,
+	})
+	if eventType == AG_EVENT_ARCHIVED {
+		l.events[len(l.events)-1].Reason = ag.TerminatedReason
+		l.events[len(l.events)-1].ReasonDescription = ag.TerminatedDescription
+	}
+	l.nextId += 1
+
+	// Drop the oldest events, in batches so that the log is not copied on every event.
+	if len(l.events) >= 2*l.size {
+		l.events = append(make([]AgreementEvent, 0, 2*l.size), l.events[len(l.events)-l.size:]...)
+	}
+
+	close(l.changed)
+	l.changed = make(chan bool)
+}
+
+// Returns the events after the cursor that match the filter, and the id of the last event looked at, which is the
+// cursor for the next call. A cursor of 0 returns no events, only the cursor of the latest event. The returned
+// channel is closed when more events are added. The last return value is false when events after the cursor are no
+// longer in the log.
+func (l *AgreementEventLog) Since(cursor uint64, filter AgreementEventFilter) ([]AgreementEvent, uint64, <-chan bool, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	latest := l.nextId - 1
+	if cursor == 0 || cursor >= latest {
+		return []AgreementEvent{}, latest, l.changed, true
+	}
+
+	first := len(l.events) - l.size
+	if first < 0 {
+		first = 0
+	}
+
+	complete := true
+	if len(l.events) == 0 || cursor+1 < l.events[first].Id {
+		complete = false
+	}
+
+	events := make([]AgreementEvent, 0)
+	for _, e := range l.events[first:] {
+		if e.Id > cursor && filter.Matches(&e) {
+			events = append(events, e)
+		}
+	}
+	return events, latest, l.changed, complete
+}
+
+// An agbot database that records the agreement state transitions in an agreement event log. The transitions are
+// recorded after the database has been updated.
+type agreementEventDB struct {
+	AgbotDatabase
+	events *AgreementEventLog
+}
+
+func WithAgreementEvents(db AgbotDatabase, events *AgreementEventLog) AgbotDatabase {
+	return &agreementEventDB{AgbotDatabase: db, events: events}
+}
+
+func (db *agreementEventDB) record(eventType string, ag *Agreement, err error) (*Agreement, error) {
+	if err == nil && ag != nil {
+		db.events.Add(eventType, ag)
+	}
+	return ag, err
+}
+
+func (db *agreementEventDB) AgreementAttempt(agreementid string, org string, deviceid string, deviceType string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, serviceId []string, nhPolicy policy.NodeHealth) error {
+	if err := db.AgbotDatabase.AgreementAttempt(agreementid, org, deviceid, deviceType, policyName, bcType, bcName, bcOrg, agreementProto, pattern, serviceId, nhPolicy); err != nil {
+		return err
+	}
+	db.events.Add(AG_EVENT_ATTEMPT, &Agreement{CurrentAgreementId: agreementid, Org: org, DeviceId: deviceid, PolicyName: policyName, AgreementProtocol: agreementProto, Pattern: pattern})
+	return nil
+}
+
+func (db *agreementEventDB) AgreementUpdate(agreementid string, proposal string, policy string, dvPolicy policy.DataVerification, defaultCheckRate uint64, hash string, sig string, protocol string, agreementProtoVersion int) (*Agreement, error) {
+	ag, err := db.AgbotDatabase.AgreementUpdate(agreementid, proposal, policy, dvPolicy, defaultCheckRate, hash, sig, protocol, agreementProtoVersion)
+	return db.record(AG_EVENT_UPDATE, ag, err)
+}
+
+func (db *agreementEventDB) AgreementMade(agreementId string, counterParty string, signature string, protocol string, hapartners []string, bcType string, bcName string, bcOrg string) (*Agreement, error) {
+	ag, err := db.AgbotDatabase.AgreementMade(agreementId, counterParty, signature, protocol, hapartners, bcType, bcName, bcOrg)
+	return db.record(AG_EVENT_MADE, ag, err)
+}
+
+func (db *agreementEventDB) AgreementFinalized(agreementid string, protocol string) (*Agreement, error) {
+	ag, err := db.AgbotDatabase.AgreementFinalized(agreementid, protocol)
+	return db.record(AG_EVENT_FINALIZED, ag, err)
+}
+
+func (db *agreementEventDB) DataVerified(agreementid string, protocol string) (*Agreement, error) {
+	ag, err := db.AgbotDatabase.DataVerified(agreementid, protocol)
+	return db.record(AG_EVENT_DATA_VERIFIED, ag, err)
+}
+
+func (db *agreementEventDB) AgreementTimedout(agreementid string, protocol string) (*Agreement, error) {
+	ag, err := db.AgbotDatabase.AgreementTimedout(agreementid, protocol)
+	return db.record(AG_EVENT_TIMED_OUT, ag, err)
+}
+
+func (db *agreementEventDB) ArchiveAgreement(agreementid string, protocol string, reason uint, desc string) (*Agreement, error) {
+	ag, err := db.AgbotDatabase.ArchiveAgreement(agreementid, protocol, reason, desc)
+	return db.record(AG_EVENT_ARCHIVED, ag, err)
+}
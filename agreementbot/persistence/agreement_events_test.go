@@ -0,0 +1,97 @@
+// +build unit
+
+package persistence_test
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/agreementbot/persistence/memory"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+)
+
+func Test_AgreementEvents_lifecycle(t *testing.T) {
+	cfg := &config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true}}
+	events := persistence.NewAgreementEventLog(100)
+	db, cleanup := initialize(t, persistence.WithAgreementEvents(new(memory.AgbotMemoryDB), events), cfg, "")
+	defer cleanup()
+
+	_, start, _, _ := events.Since(0, persistence.AgreementEventFilter{})
+
+	agid := uniqueId("ag")
+	if err := db.AgreementAttempt(agid, "myorg", "myorg/dev1", "device", "myorg/pol1", "", "", "", testProtocol, "", []string{"svc1"}, policy.NodeHealth{}); err != nil {
+		t.Fatalf("unexpected error on attempt: %v", err)
+	} else if _, err := db.AgreementUpdate(agid, "proposal", "policy", policy.DataVerification{}, 15, "hash", "sig", testProtocol, 2); err != nil {
+		t.Fatalf("unexpected error on update: %v", err)
+	} else if _, err := db.AgreementMade(agid, "counterparty", "proposalsig", testProtocol, []string{}, "", "", ""); err != nil {
+		t.Fatalf("unexpected error on made: %v", err)
+	} else if _, err := db.AgreementFinalized(agid, testProtocol); err != nil {
+		t.Fatalf("unexpected error on finalize: %v", err)
+	} else if _, err := db.DataVerified(agid, testProtocol); err != nil {
+		t.Fatalf("unexpected error on data verified: %v", err)
+	} else if _, err := db.AgreementTimedout(agid, testProtocol); err != nil {
+		t.Fatalf("unexpected error on timed out: %v", err)
+	} else if _, err := db.ArchiveAgreement(agid, testProtocol, 3, "cancelled"); err != nil {
+		t.Fatalf("unexpected error on archive: %v", err)
+	} else if _, err := db.AgreementFinalized("unknown", testProtocol); err == nil {
+		t.Errorf("updating an unknown agreement should fail")
+	}
+
+	evs, latest, _, complete := events.Since(start, persistence.AgreementEventFilter{})
+	expected := []string{persistence.AG_EVENT_ATTEMPT, persistence.AG_EVENT_UPDATE, persistence.AG_EVENT_MADE, persistence.AG_EVENT_FINALIZED,
+		persistence.AG_EVENT_DATA_VERIFIED, persistence.AG_EVENT_TIMED_OUT, persistence.AG_EVENT_ARCHIVED}
+
+	if !complete {
+		t.Errorf("no events should be missing")
+	} else if len(evs) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, evs)
+	} else if latest != evs[len(evs)-1].Id {
+		t.Errorf("the cursor %v should be the id of the last event %v", latest, evs[len(evs)-1].Id)
+	}
+	for ix, ev := range evs {
+		if ev.Type != expected[ix] || ev.AgreementId != agid || ev.Org != "myorg" || ev.DeviceId != "myorg/dev1" || ev.PolicyName != "myorg/pol1" || ev.Protocol != testProtocol {
+			t.Errorf("wrong event %v, expected type %v", ev, expected[ix])
+		}
+	}
+	if last := evs[len(evs)-1]; last.Reason != 3 || last.ReasonDescription != "cancelled" {
+		t.Errorf("archived event should have the reason: %v", last)
+	}
+}
+
+func Test_AgreementEventLog(t *testing.T) {
+	events := persistence.NewAgreementEventLog(3)
+
+	evs, cursor, changed, complete := events.Since(0, persistence.AgreementEventFilter{})
+	if len(evs) != 0 || !complete {
+		t.Errorf("a new log should not return events: %v", evs)
+	}
+
+	events.Add(persistence.AG_EVENT_ATTEMPT, &persistence.Agreement{CurrentAgreementId: "ag1", Org: "org1", DeviceId: "org1/n1", PolicyName: "org1/bp"})
+	select {
+	case <-changed:
+	default:
+		t.Errorf("adding an event should close the changed channel")
+	}
+
+	events.Add(persistence.AG_EVENT_ATTEMPT, &persistence.Agreement{CurrentAgreementId: "ag2", Org: "org2", DeviceId: "org2/n2", Pattern: "org2/pat"})
+
+	if evs, _, _, _ := events.Since(cursor, persistence.AgreementEventFilter{Org: "org2"}); len(evs) != 1 || evs[0].AgreementId != "ag2" {
+		t.Errorf("filter by org returned %v", evs)
+	} else if evs, _, _, _ := events.Since(cursor, persistence.AgreementEventFilter{PolicyName: "org1/bp", DeviceId: "org1/n1"}); len(evs) != 1 || evs[0].AgreementId != "ag1" {
+		t.Errorf("filter by policy and node returned %v", evs)
+	} else if evs, _, _, _ := events.Since(cursor, persistence.AgreementEventFilter{Pattern: "org1/pat"}); len(evs) != 0 {
+		t.Errorf("filter by pattern returned %v", evs)
+	}
+
+	// Only the last 3 events are kept, resuming from the first event misses the ones dropped from the log.
+	for _, id := range []string{"ag3", "ag4", "ag5", "ag6"} {
+		events.Add(persistence.AG_EVENT_ATTEMPT, &persistence.Agreement{CurrentAgreementId: id})
+	}
+	if evs, _, _, complete := events.Since(cursor, persistence.AgreementEventFilter{}); complete {
+		t.Errorf("events should be missing")
+	} else if len(evs) != 3 || evs[0].AgreementId != "ag4" || evs[2].AgreementId != "ag6" {
+		t.Errorf("expected the last 3 events, got %v", evs)
+	} else if evs, _, _, complete := events.Since(evs[0].Id, persistence.AgreementEventFilter{}); !complete || len(evs) != 2 {
+		t.Errorf("expected the last 2 events without a gap, got %v, complete %v", evs, complete)
+	}
+}
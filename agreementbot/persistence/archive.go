@@ -0,0 +1,283 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/policy"
+	"io"
+	"time"
+)
+
+// An archive is a portable copy of the agbot's agreement state. It can be exported from any database provider and imported into
+// any other database provider, which makes it possible to move an agbot from one database to another, or to recover an agbot
+// without cancelling all of its agreements. The archive is a stream of JSON records, one per line. The first record is always the
+// header, the last record is always the trailer, the records in between contain agreements (active and archived), workload usages
+// and search sessions. The archive is streamed, so an error during the export is reported in the trailer, and an archive that
+// does not end with a trailer was truncated.
+
+const ARCHIVE_VERSION = 1
+
+const ARCHIVE_RECORD_HEADER = "header"
+const ARCHIVE_RECORD_AGREEMENT = "agreement"
+const ARCHIVE_RECORD_WORKLOAD_USAGE = "workload_usage"
+const ARCHIVE_RECORD_SEARCH_SESSION = "search_session"
+const ARCHIVE_RECORD_TRAILER = "trailer"
+
+type ArchiveHeader struct {
+	Version  int    `json:"version"`
+	Exported uint64 `json:"exported"` // The time when the archive was created.
+}
+
+// The last record of an archive. When the export fails part way through, the trailer is not complete and contains the error.
+type ArchiveTrailer struct {
+	Complete bool   `json:"complete"`
+	Records  int    `json:"records"` // The number of records between the header and the trailer.
+	Error    string `json:"error,omitempty"`
+}
+
+func (t ArchiveTrailer) String() string {
+	return fmt.Sprintf("Complete: %v, Records: %v, Error: %v", t.Complete, t.Records, t.Error)
+}
+
+// A single line in an archive. The type field indicates which of the other fields is set.
+type ArchiveRecord struct {
+	Type          string          `json:"type"`
+	Header        *ArchiveHeader  `json:"header,omitempty"`
+	Agreement     *Agreement      `json:"agreement,omitempty"`
+	WorkloadUsage *WorkloadUsage  `json:"workload_usage,omitempty"`
+	SearchSession *SearchSession  `json:"search_session,omitempty"`
+	Trailer       *ArchiveTrailer `json:"trailer,omitempty"`
+}
+
+// A portable representation of a search session. Some database providers keep a single search session for all policies, in
+// which case the policy name is empty.
+type SearchSession struct {
+	PolicyName          string `json:"policy_name"`
+	ChangedSince        uint64 `json:"changed_since"`
+	SessionToken        uint64 `json:"session_token"`
+	SessionEnded        bool   `json:"session_ended"`
+	RestartChangedSince uint64 `json:"restart_changed_since"`
+}
+
+func (s SearchSession) String() string {
+	return fmt.Sprintf("PolicyName: %v, ChangedSince: %v, SessionToken: %v, SessionEnded: %v, RestartChangedSince: %v", s.PolicyName, s.ChangedSince, s.SessionToken, s.SessionEnded, s.RestartChangedSince)
+}
+
+// The number of records written to or read from an archive.
+type ArchiveSummary struct {
+	Agreements     int `json:"agreements"`
+	WorkloadUsages int `json:"workload_usages"`
+	SearchSessions int `json:"search_sessions"`
+	Skipped        int `json:"skipped"` // Records in the archive that were not imported because they are already in the database.
+}
+
+func (s ArchiveSummary) String() string {
+	return fmt.Sprintf("Agreements: %v, WorkloadUsages: %v, SearchSessions: %v, Skipped: %v", s.Agreements, s.WorkloadUsages, s.SearchSessions, s.Skipped)
+}
+
+// Write all the agreements, workload usages and search sessions in the database to the input writer, followed by the trailer.
+// When an error occurs after the header has been written, the error is also written in the trailer.
+func ExportArchive(db AgbotDatabase, w io.Writer) (*ArchiveSummary, error) {
+
+	summary := new(ArchiveSummary)
+	enc := json.NewEncoder(w)
+
+	header := ArchiveRecord{Type: ARCHIVE_RECORD_HEADER, Header: &ArchiveHeader{Version: ARCHIVE_VERSION, Exported: uint64(time.Now().Unix())}}
+	if err := enc.Encode(header); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to write archive header, error: %v", err))
+	}
+
+	err := exportRecords(db, enc, summary)
+
+	trailer := &ArchiveTrailer{Complete: err == nil, Records: summary.Agreements + summary.WorkloadUsages + summary.SearchSessions}
+	if err != nil {
+		trailer.Error = err.Error()
+	}
+	if terr := enc.Encode(ArchiveRecord{Type: ARCHIVE_RECORD_TRAILER, Trailer: trailer}); terr != nil && err == nil {
+		err = errors.New(fmt.Sprintf("unable to write archive trailer, error: %v", terr))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	glog.V(3).Infof("Exported agbot database archive: %v", summary)
+	return summary, nil
+}
+
+// Write the records between the header and the trailer, counting them in the summary.
+func exportRecords(db AgbotDatabase, enc *json.Encoder, summary *ArchiveSummary) error {
+
+	// Agreements are exported for every protocol, including agreements that are archived.
+	for _, protocol := range policy.AllAgreementProtocols() {
+		if ags, err := db.FindAgreements([]AFilter{}, protocol); err != nil {
+			return errors.New(fmt.Sprintf("unable to read %v agreements, error: %v", protocol, err))
+		} else {
+			for i := range ags {
+				if err := enc.Encode(ArchiveRecord{Type: ARCHIVE_RECORD_AGREEMENT, Agreement: &ags[i]}); err != nil {
+					return errors.New(fmt.Sprintf("unable to write agreement %v to archive, error: %v", ags[i].CurrentAgreementId, err))
+				}
+				summary.Agreements += 1
+			}
+		}
+	}
+
+	if wus, err := db.FindWorkloadUsages([]WUFilter{}); err != nil {
+		return errors.New(fmt.Sprintf("unable to read workload usages, error: %v", err))
+	} else {
+		for i := range wus {
+			if err := enc.Encode(ArchiveRecord{Type: ARCHIVE_RECORD_WORKLOAD_USAGE, WorkloadUsage: &wus[i]}); err != nil {
+				return errors.New(fmt.Sprintf("unable to write workload usage %v to archive, error: %v", wus[i].ShortString(), err))
+			}
+			summary.WorkloadUsages += 1
+		}
+	}
+
+	if sss, err := db.FindSearchSessions(); err != nil {
+		return errors.New(fmt.Sprintf("unable to read search sessions, error: %v", err))
+	} else {
+		for i := range sss {
+			if err := enc.Encode(ArchiveRecord{Type: ARCHIVE_RECORD_SEARCH_SESSION, SearchSession: &sss[i]}); err != nil {
+				return errors.New(fmt.Sprintf("unable to write search session %v to archive, error: %v", sss[i], err))
+			}
+			summary.SearchSessions += 1
+		}
+	}
+
+	return nil
+}
+
+// Verify that an archive ends with a complete trailer, without importing it. Returns the trailer.
+func VerifyArchiveTrailer(archive []byte) (*ArchiveTrailer, error) {
+	lines := bytes.Split(bytes.TrimSpace(archive), []byte("\n"))
+
+	var rec ArchiveRecord
+	if err := json.Unmarshal(lines[len(lines)-1], &rec); err != nil || rec.Type != ARCHIVE_RECORD_TRAILER || rec.Trailer == nil {
+		return nil, errors.New(fmt.Sprintf("archive is truncated, it does not end with a trailer record"))
+	} else if !rec.Trailer.Complete {
+		return rec.Trailer, errors.New(fmt.Sprintf("archive is incomplete, the export failed: %v", rec.Trailer.Error))
+	} else if rec.Trailer.Records != len(lines)-2 {
+		return rec.Trailer, errors.New(fmt.Sprintf("archive has %v records, but the trailer has %v", len(lines)-2, rec.Trailer.Records))
+	}
+	return rec.Trailer, nil
+}
+
+// Read an archive from the input reader and write its records into the database. Agreements and workload usages that are already
+// in the database are left alone, so an import that was interrupted can be run again. Search sessions from the archive replace
+// the search sessions in the database, as long as the database keeps search sessions in the same way as the exporting database.
+// The records are imported as they are read, so the records before the end of an archive that was truncated or that has an
+// incomplete trailer are imported before the error is returned.
+func ImportArchive(db AgbotDatabase, r io.Reader) (*ArchiveSummary, error) {
+
+	summary := new(ArchiveSummary)
+	dec := json.NewDecoder(r)
+
+	var trailer *ArchiveTrailer
+	for line := 1; ; line++ {
+		var rec ArchiveRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			if line == 1 {
+				return nil, errors.New(fmt.Sprintf("archive is empty"))
+			} else if trailer == nil {
+				return summary, errors.New(fmt.Sprintf("archive is truncated, it does not end with a trailer record"))
+			}
+			break
+		} else if err != nil {
+			return summary, errors.New(fmt.Sprintf("unable to read archive record %v, error: %v", line, err))
+		} else if trailer != nil {
+			return summary, errors.New(fmt.Sprintf("archive record %v follows the trailer record", line))
+		}
+
+		// The header must be the first record.
+		if line == 1 {
+			if rec.Type != ARCHIVE_RECORD_HEADER || rec.Header == nil {
+				return nil, errors.New(fmt.Sprintf("archive does not begin with a header record"))
+			} else if rec.Header.Version > ARCHIVE_VERSION {
+				return nil, errors.New(fmt.Sprintf("archive version %v is not supported, the highest supported version is %v", rec.Header.Version, ARCHIVE_VERSION))
+			}
+			continue
+		}
+
+		var err error
+		skipped := false
+		switch rec.Type {
+		case ARCHIVE_RECORD_AGREEMENT:
+			skipped, err = importAgreement(db, rec.Agreement)
+			if err == nil && !skipped {
+				summary.Agreements += 1
+			}
+		case ARCHIVE_RECORD_WORKLOAD_USAGE:
+			skipped, err = importWorkloadUsage(db, rec.WorkloadUsage)
+			if err == nil && !skipped {
+				summary.WorkloadUsages += 1
+			}
+		case ARCHIVE_RECORD_SEARCH_SESSION:
+			if rec.SearchSession == nil {
+				err = errors.New(fmt.Sprintf("search session is missing"))
+			} else if imported, ierr := db.ImportSearchSession(rec.SearchSession); ierr != nil {
+				err = ierr
+			} else if imported {
+				summary.SearchSessions += 1
+			} else {
+				skipped = true
+			}
+		case ARCHIVE_RECORD_TRAILER:
+			if trailer = rec.Trailer; trailer == nil {
+				err = errors.New(fmt.Sprintf("trailer is missing"))
+			} else if !trailer.Complete {
+				err = errors.New(fmt.Sprintf("archive is incomplete, the export failed: %v", trailer.Error))
+			} else if trailer.Records != line-2 {
+				err = errors.New(fmt.Sprintf("archive has %v records, but the trailer has %v", line-2, trailer.Records))
+			}
+			if err != nil {
+				return summary, err
+			}
+			continue
+		default:
+			err = errors.New(fmt.Sprintf("unknown record type %v", rec.Type))
+		}
+
+		if err != nil {
+			return summary, errors.New(fmt.Sprintf("unable to import archive record %v, error: %v", line, err))
+		} else if skipped {
+			summary.Skipped += 1
+		}
+	}
+
+	glog.V(3).Infof("Imported agbot database archive: %v", summary)
+	return summary, nil
+}
+
+// Returns true if the agreement was not imported because it is already in the database.
+func importAgreement(db AgbotDatabase, ag *Agreement) (bool, error) {
+	if ag == nil {
+		return false, errors.New(fmt.Sprintf("agreement is missing"))
+	} else if ag.CurrentAgreementId == "" {
+		return false, errors.New(fmt.Sprintf("agreement has no id"))
+	} else if !policy.SupportedAgreementProtocol(ag.AgreementProtocol) {
+		return false, errors.New(fmt.Sprintf("agreement %v has unsupported protocol %v", ag.CurrentAgreementId, ag.AgreementProtocol))
+	} else if existing, err := db.FindSingleAgreementByAgreementId(ag.CurrentAgreementId, ag.AgreementProtocol, []AFilter{}); err != nil {
+		return false, err
+	} else if existing != nil {
+		glog.V(5).Infof("Skipping import of agreement %v, it already exists", ag.CurrentAgreementId)
+		return true, nil
+	}
+	return false, db.ImportAgreement(ag)
+}
+
+// Returns true if the workload usage was not imported because it is already in the database.
+func importWorkloadUsage(db AgbotDatabase, wu *WorkloadUsage) (bool, error) {
+	if wu == nil {
+		return false, errors.New(fmt.Sprintf("workload usage is missing"))
+	} else if wu.DeviceId == "" || wu.PolicyName == "" {
+		return false, errors.New(fmt.Sprintf("workload usage %v has no device id or policy name", wu.ShortString()))
+	} else if existing, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(wu.DeviceId, wu.PolicyName); err != nil {
+		return false, err
+	} else if existing != nil {
+		glog.V(5).Infof("Skipping import of workload usage %v, it already exists", wu.ShortString())
+		return true, nil
+	}
+	return false, db.ImportWorkloadUsage(wu)
+}
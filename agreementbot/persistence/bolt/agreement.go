@@ -21,24 +21,39 @@ const AGREEMENTS = "agreements" // The bolt DB bucket name for agreement objects
 
 // This is the object that represents the handle to the bolt func (db *AgbotBoltDB)
 type AgbotBoltDB struct {
-	db *bolt.DB
+	db     *bolt.DB
+	leader persistence.LocalLease // The bolt DB is used by only 1 agbot, so it is always the leader.
 }
 
 func (db *AgbotBoltDB) String() string {
 	return fmt.Sprintf("DB Handle: %v", db.db)
 }
 
+// Count the agreements in one pass over the buckets, only the archived flag of each agreement is decoded.
 func (db *AgbotBoltDB) GetAgreementCount(partition string) (int64, int64, error) {
 	var activeNum, archivedNum int64
-	for _, protocol := range policy.AllAgreementProtocols() {
-		if activeAgreements, err := db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter()}, protocol); err != nil {
-			return 0, 0, err
-		} else if archivedAgreements, err := db.FindAgreements([]persistence.AFilter{persistence.ArchivedAFilter()}, protocol); err != nil {
-			return 0, 0, err
-		} else {
-			activeNum += int64(len(activeAgreements))
-			archivedNum += int64(len(archivedAgreements))
+	readErr := db.db.View(func(tx *bolt.Tx) error {
+		for _, protocol := range policy.AllAgreementProtocols() {
+			if b := tx.Bucket([]byte(bucketName(protocol))); b != nil {
+				b.ForEach(func(k, v []byte) error {
+					var a struct {
+						Archived bool `json:"archived"`
+					}
+					if err := json.Unmarshal(v, &a); err != nil {
+						glog.Errorf("Unable to deserialize db record: %v", v)
+					} else if a.Archived {
+						archivedNum += 1
+					} else {
+						activeNum += 1
+					}
+					return nil
+				})
+			}
 		}
+		return nil
+	})
+	if readErr != nil {
+		return 0, 0, readErr
 	}
 	return activeNum, archivedNum, nil
 }
@@ -83,6 +98,14 @@ func (db *AgbotBoltDB) FindAgreements(filters []persistence.AFilter, protocol st
 	}
 }
 
+// The bolt DB is used by only 1 agbot, so all the agreements are in the global partition.
+func (db *AgbotBoltDB) FindAgreementsInPartition(partition string, filters []persistence.AFilter, protocol string) ([]persistence.Agreement, error) {
+	if partition != "global" {
+		return []persistence.Agreement{}, nil
+	}
+	return db.FindAgreements(filters, protocol)
+}
+
 func (db *AgbotBoltDB) AgreementAttempt(agreementid string, org string, deviceid string, deviceType string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, serviceId []string, nhPolicy policy.NodeHealth) error {
 	if agreement, err := persistence.NewAgreement(agreementid, org, deviceid, deviceType, policyName, bcType, bcName, bcOrg, agreementProto, pattern, serviceId, nhPolicy); err != nil {
 		return err
@@ -241,6 +264,13 @@ func (db *AgbotBoltDB) DeleteAgreement(pk string, protocol string) error {
 	}
 }
 
+func (db *AgbotBoltDB) DeletePartitionAgreement(partition string, agreementid string, protocol string) error {
+	if partition != "global" {
+		return nil
+	}
+	return db.DeleteAgreement(agreementid, protocol)
+}
+
 func (db *AgbotBoltDB) persistNew(pk string, bucket string, record interface{}) error {
 	if pk == "" || bucket == "" {
 		return fmt.Errorf("Missing required args, pk and/or bucket")
@@ -271,6 +301,11 @@ func (db *AgbotBoltDB) Close() {
 	glog.V(2).Infof("Closed bolt database")
 }
 
+// The bolt schema is not versioned.
+func (db *AgbotBoltDB) GetSchemaStatus() (*persistence.SchemaStatus, error) {
+	return nil, nil
+}
+
 // Utility functions specific to the bolt database implementation
 func bucketName(protocol string) string {
 	return AGREEMENTS + "-" + protocol
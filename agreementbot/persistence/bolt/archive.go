@@ -0,0 +1,50 @@
+package bolt
+
+import (
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"time"
+)
+
+// Functions used to export and import the contents of the database.
+
+// The bolt DB has a single search session that is used for all policies, so it is exported without a policy name.
+func (db *AgbotBoltDB) FindSearchSessions() ([]persistence.SearchSession, error) {
+	if ss, err := db.findSearchSession(); err != nil {
+		return nil, err
+	} else {
+		return []persistence.SearchSession{{
+			ChangedSince: ss.ChangedSince,
+			SessionToken: ss.SessionToken,
+			SessionEnded: ss.SessionEnded,
+		}}, nil
+	}
+}
+
+func (db *AgbotBoltDB) ImportAgreement(ag *persistence.Agreement) error {
+	return db.persistNew(ag.CurrentAgreementId, bucketName(ag.AgreementProtocol), ag)
+}
+
+// The record id is allocated by the bolt DB, so the imported record's id is not preserved.
+func (db *AgbotBoltDB) ImportWorkloadUsage(wu *persistence.WorkloadUsage) error {
+	record := *wu
+	return db.WUPersistNew(wuBucketName(), &record)
+}
+
+// Only a search session without a policy name can be imported, because the bolt DB does not keep search sessions per
+// policy. The imported session is ended, so that the next search allocates a new session token.
+func (db *AgbotBoltDB) ImportSearchSession(ss *persistence.SearchSession) (bool, error) {
+	if ss.PolicyName != "" {
+		glog.V(3).Infof("Skipping import of search session %v, bolt only has a single search session", ss)
+		return false, nil
+	}
+
+	imported := SearchSession{
+		ChangedSince:  ss.ChangedSince,
+		SessionToken:  ss.SessionToken,
+		SessionEnded:  true,
+		UpdatingAgbot: "this",
+		Updated:       uint64(time.Now().Unix()),
+	}
+	return true, db.saveSearchSession(&imported)
+}
@@ -0,0 +1,19 @@
+package bolt
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// The bolt DB is used by only 1 agbot, so that agbot is always the leader.
+func (db *AgbotBoltDB) AcquireLeadership(leaseS uint64) (bool, error) {
+	return db.leader.Acquire("global", "global", leaseS), nil
+}
+
+func (db *AgbotBoltDB) ReleaseLeadership() error {
+	db.leader.Release()
+	return nil
+}
+
+func (db *AgbotBoltDB) GetLeader() (*persistence.LeaderLease, error) {
+	return db.leader.Get(), nil
+}
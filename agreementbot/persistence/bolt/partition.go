@@ -1,6 +1,10 @@
 package bolt
 
-import ()
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
 
 // Functions related to partitions in the bolt database. It does not use partitions, or rather has only 1 global partition.
 func (db *AgbotBoltDB) FindPartitions() ([]string, error) {
@@ -32,3 +36,24 @@ func (db *AgbotBoltDB) GetPartitionOwner(id string) (string, error) {
 func (db *AgbotBoltDB) MovePartition(timeout uint64) (bool, error) {
 	return false, nil
 }
+
+// There is only 1 partition, so there is nothing to rebalance.
+func (db *AgbotBoltDB) PrimaryPartition() string {
+	return "global"
+}
+
+func (db *AgbotBoltDB) GetPartitionHeartbeat(id string) (uint64, error) {
+	return 0, nil
+}
+
+func (db *AgbotBoltDB) HandOffAgreements(toPartition string, protocol string, agreementIds []string) (*persistence.PartitionMove, error) {
+	return nil, errors.New(fmt.Sprintf("partition %v does not exist, the database has only 1 partition", toPartition))
+}
+
+func (db *AgbotBoltDB) FindPartitionMoves() ([]persistence.PartitionMove, error) {
+	return []persistence.PartitionMove{}, nil
+}
+
+func (db *AgbotBoltDB) CompletePartitionMove(id string) error {
+	return errors.New(fmt.Sprintf("partition move %v does not exist", id))
+}
@@ -0,0 +1,79 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"time"
+)
+
+const ROLLOUT_BUCKET = "rollouts" // The bolt DB bucket name for rollout state objects, keyed by policy name.
+
+func (db *AgbotBoltDB) FindRolloutStates() ([]persistence.RolloutState, error) {
+	states := make([]persistence.RolloutState, 0)
+
+	readErr := db.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(ROLLOUT_BUCKET)); b != nil {
+			return b.ForEach(func(k, v []byte) error {
+				var rs persistence.RolloutState
+				if err := json.Unmarshal(v, &rs); err != nil {
+					return fmt.Errorf("Unable to deserialize rollout state record: %v", v)
+				}
+				states = append(states, rs)
+				return nil
+			})
+		}
+		return nil // end transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	return states, nil
+}
+
+// Returns nil if there is no rollout state for the policy.
+func (db *AgbotBoltDB) GetRolloutState(policyName string) (*persistence.RolloutState, error) {
+	var rs *persistence.RolloutState
+
+	readErr := db.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(ROLLOUT_BUCKET)); b != nil {
+			if v := b.Get([]byte(policyName)); v != nil {
+				rs = new(persistence.RolloutState)
+				if err := json.Unmarshal(v, rs); err != nil {
+					return fmt.Errorf("Unable to deserialize rollout state record: %v", v)
+				}
+			}
+		}
+		return nil // end transaction
+	})
+
+	if readErr != nil {
+		return nil, readErr
+	}
+	return rs, nil
+}
+
+func (db *AgbotBoltDB) SaveRolloutState(state *persistence.RolloutState) error {
+	state.Updated = uint64(time.Now().Unix())
+
+	return db.db.Update(func(tx *bolt.Tx) error {
+		if b, err := tx.CreateBucketIfNotExists([]byte(ROLLOUT_BUCKET)); err != nil {
+			return err
+		} else if serial, err := json.Marshal(state); err != nil {
+			return fmt.Errorf("Failed to serialize rollout state: %v. Error: %v", *state, err)
+		} else {
+			return b.Put([]byte(state.PolicyName), serial)
+		}
+	})
+}
+
+func (db *AgbotBoltDB) DeleteRolloutState(policyName string) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(ROLLOUT_BUCKET)); b != nil {
+			return b.Delete([]byte(policyName))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,526 @@
+// +build unit
+
+package persistence_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/agreementbot/persistence/bolt"
+	"github.com/open-horizon/anax/agreementbot/persistence/memory"
+	"github.com/open-horizon/anax/agreementbot/persistence/postgresql"
+	"github.com/open-horizon/anax/agreementbot/persistence/sqlite"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/policy"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// This is the conformance suite that every AgbotDatabase provider must pass. Each test is run against every provider.
+// The postgresql provider is only tested when a database is available, which is indicated by setting the standard
+// PGHOST, PGPORT, PGUSER, PGPASSWORD and PGDATABASE environment variables.
+
+const testProtocol = policy.BasicProtocol
+
+type providerFactory struct {
+	name  string
+	newDB func(t *testing.T) (persistence.AgbotDatabase, func())
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "agbot-conformance-")
+	if err != nil {
+		t.Fatalf("unable to create temp dir, error: %v", err)
+	}
+	return dir
+}
+
+func initialize(t *testing.T, db persistence.AgbotDatabase, cfg *config.HorizonConfig, dir string) (persistence.AgbotDatabase, func()) {
+	if err := db.Initialize(cfg); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("unable to initialize database, error: %v", err)
+	}
+	return db, func() {
+		db.Close()
+		if dir != "" {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+func providers() []providerFactory {
+	return []providerFactory{
+		{"memory", func(t *testing.T) (persistence.AgbotDatabase, func()) {
+			cfg := &config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true}}
+			return initialize(t, new(memory.AgbotMemoryDB), cfg, "")
+		}},
+		{"bolt", func(t *testing.T) (persistence.AgbotDatabase, func()) {
+			dir := tempDir(t)
+			cfg := &config.HorizonConfig{AgreementBot: config.AGConfig{DBPath: dir}}
+			return initialize(t, new(bolt.AgbotBoltDB), cfg, dir)
+		}},
+		{"sqlite", func(t *testing.T) (persistence.AgbotDatabase, func()) {
+			dir := tempDir(t)
+			cfg := &config.HorizonConfig{AgreementBot: config.AGConfig{Sqlite: config.SqliteConfig{DBPath: dir}}}
+			return initialize(t, new(sqlite.AgbotSqliteDB), cfg, dir)
+		}},
+		{"postgresql", func(t *testing.T) (persistence.AgbotDatabase, func()) {
+			if os.Getenv("PGHOST") == "" {
+				t.Skip("PGHOST is not set, skipping postgresql conformance tests")
+			}
+			cfg := &config.HorizonConfig{AgreementBot: config.AGConfig{
+				Postgresql: config.PostgresqlConfig{
+					Host:     os.Getenv("PGHOST"),
+					Port:     os.Getenv("PGPORT"),
+					User:     os.Getenv("PGUSER"),
+					Password: os.Getenv("PGPASSWORD"),
+					DBName:   os.Getenv("PGDATABASE"),
+					SSLMode:  "disable",
+				},
+				PartitionStale: 60,
+			}}
+			return initialize(t, new(postgresql.AgbotPostgresqlDB), cfg, "")
+		}},
+	}
+}
+
+// Run the input test against every provider.
+func runConformance(t *testing.T, test func(t *testing.T, db persistence.AgbotDatabase)) {
+	for _, p := range providers() {
+		p := p
+		t.Run(p.name, func(t *testing.T) {
+			db, cleanup := p.newDB(t)
+			defer cleanup()
+			test(t, db)
+		})
+	}
+}
+
+// Generate ids that are unique across test runs, since the postgresql database is not cleaned up between runs.
+func uniqueId(prefix string) string {
+	return fmt.Sprintf("%v-%v", prefix, time.Now().UnixNano())
+}
+
+// Count the agreements in all the partitions in the database.
+func countAgreements(t *testing.T, db persistence.AgbotDatabase) (int64, int64) {
+	partitions, err := db.FindPartitions()
+	if err != nil {
+		t.Fatalf("unable to find partitions, error: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var active, archived int64
+	for _, p := range partitions {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if ac, ar, err := db.GetAgreementCount(p); err != nil {
+			t.Fatalf("unable to count agreements in partition %v, error: %v", p, err)
+		} else {
+			active += ac
+			archived += ar
+		}
+	}
+	return active, archived
+}
+
+func Test_Conformance_AgreementLifecycle(t *testing.T) {
+	runConformance(t, func(t *testing.T, db persistence.AgbotDatabase) {
+
+		agid := uniqueId("ag")
+		startActive, startArchived := countAgreements(t, db)
+
+		if err := db.AgreementAttempt(agid, "myorg", "myorg/dev1", "device", "myorg/pol1", "", "", "", testProtocol, "", []string{"svc1"}, policy.NodeHealth{MissingHBInterval: 60}); err != nil {
+			t.Fatalf("unexpected error on attempt: %v", err)
+		} else if err := db.AgreementAttempt(agid, "myorg", "myorg/dev1", "device", "myorg/pol1", "", "", "", testProtocol, "", []string{"svc1"}, policy.NodeHealth{}); err == nil {
+			t.Errorf("a second attempt with the same agreement id should fail")
+		}
+
+		if active, _ := countAgreements(t, db); active != startActive+1 {
+			t.Errorf("expected %v active agreements, got %v", startActive+1, active)
+		}
+
+		dv := policy.DataVerification{Enabled: true, URL: "http://dv", CheckRate: 0, Interval: 300}
+		if ag, err := db.AgreementUpdate(agid, "proposal", "policy", dv, 15, "hash", "sig", testProtocol, 2); err != nil {
+			t.Fatalf("unexpected error on update: %v", err)
+		} else if ag.Proposal != "proposal" || ag.AgreementCreationTime == 0 || ag.DataVerificationCheckRate != 15 {
+			t.Errorf("agreement update not applied: %v", ag)
+		}
+
+		// Fields that can only be set once are not changed by a second update.
+		if _, err := db.AgreementUpdate(agid, "another proposal", "another policy", dv, 15, "another hash", "another sig", testProtocol, 3); err != nil {
+			t.Fatalf("unexpected error on second update: %v", err)
+		} else if ag, err := db.FindSingleAgreementByAgreementId(agid, testProtocol, []persistence.AFilter{}); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if ag == nil {
+			t.Fatalf("agreement %v not found", agid)
+		} else if ag.Proposal != "proposal" || ag.ProposalHash != "hash" || ag.AgreementProtocolVersion != 2 {
+			t.Errorf("agreement state transition not validated: %v", ag)
+		} else if ag.NHMissingHBInterval != 60 || len(ag.ServiceId) != 1 || ag.ServiceId[0] != "svc1" {
+			t.Errorf("agreement attempt fields not persisted: %v", ag)
+		}
+
+		if ag, err := db.AgreementMade(agid, "counterparty", "proposalsig", testProtocol, []string{"partner"}, "", "", ""); err != nil {
+			t.Fatalf("unexpected error on made: %v", err)
+		} else if ag.CounterPartyAddress != "counterparty" || ag.ProposalSig != "proposalsig" {
+			t.Errorf("agreement made not applied: %v", ag)
+		} else if ag, err := db.AgreementFinalized(agid, testProtocol); err != nil {
+			t.Fatalf("unexpected error on finalize: %v", err)
+		} else if ag.AgreementFinalizedTime == 0 {
+			t.Errorf("agreement not finalized: %v", ag)
+		} else if _, err := db.DataNotVerified(agid, testProtocol); err != nil {
+			t.Fatalf("unexpected error on data not verified: %v", err)
+		} else if ag, err := db.DataNotVerified(agid, testProtocol); err != nil {
+			t.Fatalf("unexpected error on data not verified: %v", err)
+		} else if ag.DataVerificationMissedCount != 2 {
+			t.Errorf("expected 2 missed data verifications, got %v", ag.DataVerificationMissedCount)
+		} else if _, err := db.MeteringNotification(agid, testProtocol, "msg1"); err != nil {
+			t.Fatalf("unexpected error on metering notification: %v", err)
+		} else if _, err := db.MeteringNotification(agid, testProtocol, "msg2"); err != nil {
+			t.Fatalf("unexpected error on metering notification: %v", err)
+		} else if ag, err := db.FindSingleAgreementByAgreementIdAllProtocols(agid, policy.AllAgreementProtocols(), []persistence.AFilter{}); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if ag == nil {
+			t.Fatalf("agreement %v not found in any protocol", agid)
+		} else if len(ag.MeteringNotificationMsgs) != 2 || ag.MeteringNotificationMsgs[0] != "msg2" || ag.MeteringNotificationMsgs[1] != "msg1" {
+			t.Errorf("metering notification messages not rotated: %v", ag.MeteringNotificationMsgs)
+		} else if len(ag.HAPartners) != 1 || ag.HAPartners[0] != "partner" {
+			t.Errorf("HA partners not persisted: %v", ag.HAPartners)
+		}
+
+		// Archive the agreement, archived agreements are filtered by the archive filters.
+		if ag, err := db.ArchiveAgreement(agid, testProtocol, 3, "cancelled"); err != nil {
+			t.Fatalf("unexpected error on archive: %v", err)
+		} else if !ag.Archived || ag.TerminatedReason != 3 || ag.TerminatedDescription != "cancelled" {
+			t.Errorf("agreement not archived: %v", ag)
+		} else if ag, err := db.FindSingleAgreementByAgreementId(agid, testProtocol, []persistence.AFilter{persistence.UnarchivedAFilter()}); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if ag != nil {
+			t.Errorf("archived agreement should be filtered out: %v", ag)
+		} else if ags, err := db.FindAgreements([]persistence.AFilter{persistence.ArchivedAFilter(), persistence.IdAFilter(agid)}, testProtocol); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if len(ags) != 1 {
+			t.Errorf("expected 1 archived agreement, got %v", ags)
+		}
+
+		if active, archived := countAgreements(t, db); active != startActive || archived != startArchived+1 {
+			t.Errorf("expected %v active and %v archived agreements, got %v and %v", startActive, startArchived+1, active, archived)
+		}
+
+		if err := db.DeleteAgreement(agid, testProtocol); err != nil {
+			t.Fatalf("unexpected error on delete: %v", err)
+		} else if ag, err := db.FindSingleAgreementByAgreementId(agid, testProtocol, []persistence.AFilter{}); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if ag != nil {
+			t.Errorf("agreement should have been deleted: %v", ag)
+		} else if _, err := db.AgreementFinalized(agid, testProtocol); err == nil {
+			t.Errorf("updating a deleted agreement should fail")
+		}
+	})
+}
+
+func Test_Conformance_WorkloadUsage(t *testing.T) {
+	runConformance(t, func(t *testing.T, db persistence.AgbotDatabase) {
+
+		device := uniqueId("myorg/dev")
+		agid := uniqueId("ag")
+
+		if err := db.NewWorkloadUsage(device, []string{}, "", "myorg/pol1", 1, 60, 120, false, agid); err != nil {
+			t.Fatalf("unexpected error on create: %v", err)
+		} else if err := db.NewWorkloadUsage(device, []string{}, "", "myorg/pol1", 1, 60, 120, false, agid); err == nil {
+			t.Errorf("a duplicate workload usage should not be created")
+		} else if err := db.NewWorkloadUsage(device, []string{}, "", "myorg/pol2", 1, 60, 120, false, agid); err != nil {
+			t.Fatalf("unexpected error on create: %v", err)
+		}
+
+		if wus, err := db.FindWorkloadUsages([]persistence.WUFilter{persistence.DWUFilter(device)}); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if len(wus) != 2 {
+			t.Errorf("expected 2 workload usages, got %v", wus)
+		} else if wus, err := db.FindWorkloadUsages([]persistence.WUFilter{persistence.DWUFilter(device), persistence.PWUFilter("myorg/pol2")}); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if len(wus) != 1 || wus[0].PolicyName != "myorg/pol2" {
+			t.Errorf("expected 1 workload usage for myorg/pol2, got %v", wus)
+		}
+
+		if wu, err := db.UpdatePriority(device, "myorg/pol1", 2, 90, 180, agid); err != nil {
+			t.Fatalf("unexpected error on priority update: %v", err)
+		} else if wu.Priority != 2 || wu.RetryDurationS != 90 || wu.VerifiedDurationS != 180 {
+			t.Errorf("priority update not applied: %v", wu)
+		} else if _, err := db.UpdateRetryCount(device, "myorg/pol1", 3, agid); err != nil {
+			t.Fatalf("unexpected error on retry count update: %v", err)
+		} else if _, err := db.UpdatePendingUpgrade(device, "myorg/pol1"); err != nil {
+			t.Fatalf("unexpected error on pending upgrade update: %v", err)
+		} else if _, err := db.UpdatePolicy(device, "myorg/pol1", "policy text"); err != nil {
+			t.Fatalf("unexpected error on policy update: %v", err)
+		} else if _, err := db.UpdatePolicy(device, "myorg/pol1", "other policy text"); err != nil {
+			t.Fatalf("unexpected error on policy update: %v", err)
+		} else if _, err := db.DisableRollbackChecking(device, "myorg/pol1"); err != nil {
+			t.Fatalf("unexpected error on disable rollback: %v", err)
+		} else if wu, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(device, "myorg/pol1"); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if wu == nil {
+			t.Fatalf("workload usage not found")
+		} else if wu.Priority != 2 || wu.RetryCount != 0 || !wu.DisableRetry || wu.PendingUpgradeTime == 0 || wu.Policy != "policy text" {
+			t.Errorf("workload usage state transitions not applied correctly: %v", wu)
+		}
+
+		// The agreement id goes from set to empty to set.
+		if _, err := db.UpdateWUAgreementId(device, "myorg/pol1", "", testProtocol); err != nil {
+			t.Fatalf("unexpected error on agreement id update: %v", err)
+		} else if wu, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(device, "myorg/pol1"); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if wu.CurrentAgreementId != "" {
+			t.Errorf("agreement id should have been cleared: %v", wu)
+		}
+
+		if err := db.DeleteWorkloadUsage(device, "myorg/pol1"); err != nil {
+			t.Fatalf("unexpected error on delete: %v", err)
+		} else if wu, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(device, "myorg/pol1"); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if wu != nil {
+			t.Errorf("workload usage should have been deleted: %v", wu)
+		} else if _, err := db.UpdatePolicy(device, "myorg/pol1", "policy text"); err == nil {
+			t.Errorf("updating a deleted workload usage should fail")
+		} else if err := db.DeleteWorkloadUsage(device, "myorg/pol2"); err != nil {
+			t.Fatalf("unexpected error on delete: %v", err)
+		}
+	})
+}
+
+func Test_Conformance_SearchSession(t *testing.T) {
+	runConformance(t, func(t *testing.T, db persistence.AgbotDatabase) {
+
+		policyName := uniqueId("myorg/pol")
+
+		token1, cs, err := db.ObtainSearchSession(policyName)
+		if err != nil {
+			t.Fatalf("unexpected error obtaining session: %v", err)
+		} else if token1 == "" {
+			t.Fatalf("no session token returned")
+		}
+
+		// Ending the session causes a new session token to be allocated.
+		if _, err := db.UpdateSearchSessionChangedSince(cs, cs+100, policyName); err != nil {
+			t.Fatalf("unexpected error updating session: %v", err)
+		} else if token2, _, err := db.ObtainSearchSession(policyName); err != nil {
+			t.Fatalf("unexpected error obtaining session: %v", err)
+		} else if token2 == token1 {
+			t.Errorf("a new session token should have been allocated, got %v twice", token1)
+		} else if err := db.ResetPolicyChangedSince(policyName, cs); err != nil {
+			t.Fatalf("unexpected error resetting policy session: %v", err)
+		} else if err := db.ResetAllChangedSince(cs); err != nil {
+			t.Fatalf("unexpected error resetting all sessions: %v", err)
+		} else if err := db.DumpSearchSessions(); err != nil {
+			t.Fatalf("unexpected error dumping sessions: %v", err)
+		}
+	})
+}
+
+func Test_Conformance_Rollouts(t *testing.T) {
+	runConformance(t, func(t *testing.T, db persistence.AgbotDatabase) {
+
+		policyName := uniqueId("myorg/pol")
+
+		if rs, err := db.GetRolloutState(policyName); err != nil {
+			t.Fatalf("unexpected error getting rollout state: %v", err)
+		} else if rs != nil {
+			t.Errorf("there should be no rollout state for %v, got %v", policyName, rs)
+		}
+
+		rs := &persistence.RolloutState{PolicyName: policyName, PolicyUpdated: 100, Step: 0, Limit: 5, State: persistence.ROLLOUT_IN_PROGRESS}
+		if err := db.SaveRolloutState(rs); err != nil {
+			t.Fatalf("unexpected error saving rollout state: %v", err)
+		}
+
+		rs.Step = 1
+		rs.State = persistence.ROLLOUT_PAUSED
+		if err := db.SaveRolloutState(rs); err != nil {
+			t.Fatalf("unexpected error updating rollout state: %v", err)
+		} else if saved, err := db.GetRolloutState(policyName); err != nil {
+			t.Fatalf("unexpected error getting rollout state: %v", err)
+		} else if saved == nil || saved.Step != 1 || saved.State != persistence.ROLLOUT_PAUSED || saved.Limit != 5 || saved.Updated == 0 {
+			t.Errorf("wrong rollout state returned: %v", saved)
+		} else if all, err := db.FindRolloutStates(); err != nil {
+			t.Fatalf("unexpected error finding rollout states: %v", err)
+		} else if len(all) != 1 || all[0].PolicyName != policyName {
+			t.Errorf("expected 1 rollout state, got %v", all)
+		} else if err := db.DeleteRolloutState(policyName); err != nil {
+			t.Fatalf("unexpected error deleting rollout state: %v", err)
+		} else if deleted, err := db.GetRolloutState(policyName); err != nil {
+			t.Fatalf("unexpected error getting rollout state: %v", err)
+		} else if deleted != nil {
+			t.Errorf("rollout state should have been deleted, got %v", deleted)
+		}
+	})
+}
+
+func Test_Conformance_Partitions(t *testing.T) {
+	runConformance(t, func(t *testing.T, db persistence.AgbotDatabase) {
+
+		if partitions, err := db.FindPartitions(); err != nil {
+			t.Fatalf("unexpected error finding partitions: %v", err)
+		} else if len(partitions) == 0 {
+			t.Errorf("there should be at least 1 partition")
+		} else if _, err := db.GetPartitionOwner(partitions[0]); err != nil {
+			t.Fatalf("unexpected error getting partition owner: %v", err)
+		} else if err := db.HeartbeatPartition(); err != nil {
+			t.Fatalf("unexpected error heartbeating: %v", err)
+		} else if _, err := db.GetHeartbeat(); err != nil {
+			t.Fatalf("unexpected error getting heartbeat: %v", err)
+		} else if _, err := db.MovePartition(60); err != nil {
+			t.Fatalf("unexpected error moving partition: %v", err)
+		} else if num, err := db.GetWorkloadUsagesCount(partitions[0]); err != nil {
+			t.Fatalf("unexpected error counting workload usages: %v", err)
+		} else if num < 0 {
+			t.Errorf("workload usage count should not be negative: %v", num)
+		}
+	})
+}
+
+func Test_Conformance_Leadership(t *testing.T) {
+	runConformance(t, func(t *testing.T, db persistence.AgbotDatabase) {
+
+		if leader, err := db.AcquireLeadership(30); err != nil {
+			t.Fatalf("unexpected error acquiring leadership: %v", err)
+		} else if !leader {
+			t.Fatalf("the only agbot should become the leader")
+		}
+
+		lease, err := db.GetLeader()
+		if err != nil {
+			t.Fatalf("unexpected error getting leader: %v", err)
+		} else if lease == nil || lease.Holder == "" || lease.Partition != db.PrimaryPartition() || lease.Expires <= uint64(time.Now().Unix()) {
+			t.Fatalf("wrong leader lease returned: %v", lease)
+		}
+
+		if leader, err := db.AcquireLeadership(30); err != nil || !leader {
+			t.Fatalf("the leader should renew its lease, leader: %v, error: %v", leader, err)
+		} else if renewed, err := db.GetLeader(); err != nil {
+			t.Fatalf("unexpected error getting leader: %v", err)
+		} else if renewed == nil || renewed.Holder != lease.Holder || renewed.Acquired != lease.Acquired {
+			t.Errorf("renewing the lease should not change the holder, got %v, was %v", renewed, lease)
+		}
+
+		// The leader purges agreements by partition.
+		agid := uniqueId("leader")
+		if err := db.AgreementAttempt(agid, "myorg", "myorg/dev1", "device", "myorg/pol1", "", "", "", testProtocol, "", []string{"svc1"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unexpected error creating agreement: %v", err)
+		} else if ags, err := db.FindAgreementsInPartition(db.PrimaryPartition(), []persistence.AFilter{}, testProtocol); err != nil {
+			t.Fatalf("unexpected error finding agreements in partition: %v", err)
+		} else if !containsAgreement(ags, agid) {
+			t.Errorf("agreement %v should be in partition %v", agid, db.PrimaryPartition())
+		} else if err := db.DeletePartitionAgreement(db.PrimaryPartition(), agid, testProtocol); err != nil {
+			t.Fatalf("unexpected error deleting agreement from partition: %v", err)
+		} else if ag, err := db.FindSingleAgreementByAgreementId(agid, testProtocol, []persistence.AFilter{}); err != nil {
+			t.Fatalf("unexpected error finding agreement: %v", err)
+		} else if ag != nil {
+			t.Errorf("agreement should have been deleted, got %v", ag)
+		}
+
+		if err := db.ReleaseLeadership(); err != nil {
+			t.Fatalf("unexpected error releasing leadership: %v", err)
+		} else if lease, err := db.GetLeader(); err != nil {
+			t.Fatalf("unexpected error getting leader: %v", err)
+		} else if lease != nil {
+			t.Errorf("there should be no leader after releasing the lease, got %v", lease)
+		}
+	})
+}
+
+func containsAgreement(ags []persistence.Agreement, agid string) bool {
+	for _, ag := range ags {
+		if ag.CurrentAgreementId == agid {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_Conformance_ExportImport(t *testing.T) {
+	runConformance(t, func(t *testing.T, db persistence.AgbotDatabase) {
+
+		agid1 := uniqueId("ag1")
+		agid2 := uniqueId("ag2")
+		device := uniqueId("myorg/dev")
+		policyName := uniqueId("myorg/pol")
+
+		if err := db.AgreementAttempt(agid1, "myorg", device, "device", policyName, "", "", "", testProtocol, "", []string{"svc1"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unexpected error on attempt: %v", err)
+		} else if err := db.AgreementAttempt(agid2, "myorg", device, "device", policyName, "", "", "", testProtocol, "", []string{"svc1"}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unexpected error on attempt: %v", err)
+		} else if _, err := db.ArchiveAgreement(agid2, testProtocol, 3, "cancelled"); err != nil {
+			t.Fatalf("unexpected error on archive: %v", err)
+		} else if err := db.NewWorkloadUsage(device, []string{}, "", policyName, 2, 60, 120, false, agid1); err != nil {
+			t.Fatalf("unexpected error on workload usage create: %v", err)
+		} else if _, cs, err := db.ObtainSearchSession(policyName); err != nil {
+			t.Fatalf("unexpected error obtaining session: %v", err)
+		} else if _, err := db.UpdateSearchSessionChangedSince(cs, 1000, policyName); err != nil {
+			t.Fatalf("unexpected error updating session: %v", err)
+		}
+
+		var archive bytes.Buffer
+		summary, err := persistence.ExportArchive(db, &archive)
+		if err != nil {
+			t.Fatalf("unexpected error on export: %v", err)
+		} else if summary.Agreements < 2 || summary.WorkloadUsages < 1 || summary.SearchSessions < 1 {
+			t.Errorf("export is missing records: %v", summary)
+		}
+
+		// Import the archive into a new database.
+		target := new(memory.AgbotMemoryDB)
+		if err := target.Initialize(&config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true}}); err != nil {
+			t.Fatalf("unable to initialize target database, error: %v", err)
+		}
+
+		if imported, err := persistence.ImportArchive(target, bytes.NewReader(archive.Bytes())); err != nil {
+			t.Fatalf("unexpected error on import: %v", err)
+		} else if imported.Agreements != summary.Agreements || imported.WorkloadUsages != summary.WorkloadUsages || imported.Skipped+imported.SearchSessions != summary.SearchSessions {
+			t.Errorf("import %v does not match export %v", imported, summary)
+		} else if ag, err := target.FindSingleAgreementByAgreementId(agid2, testProtocol, []persistence.AFilter{persistence.ArchivedAFilter()}); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if ag == nil || ag.TerminatedDescription != "cancelled" || ag.DeviceId != device {
+			t.Errorf("archived agreement not imported correctly: %v", ag)
+		} else if wu, err := target.FindSingleWorkloadUsageByDeviceAndPolicyName(device, policyName); err != nil {
+			t.Fatalf("unexpected error on find: %v", err)
+		} else if wu == nil || wu.Priority != 2 || wu.CurrentAgreementId != agid1 {
+			t.Errorf("workload usage not imported correctly: %v", wu)
+		}
+
+		// Importing the archive back into the database it came from skips the agreements and workload usages.
+		if imported, err := persistence.ImportArchive(db, bytes.NewReader(archive.Bytes())); err != nil {
+			t.Fatalf("unexpected error on import: %v", err)
+		} else if imported.Agreements != 0 || imported.WorkloadUsages != 0 || imported.Skipped < summary.Agreements+summary.WorkloadUsages {
+			t.Errorf("existing records should be skipped: %v", imported)
+		}
+
+		// An archive without a header is rejected.
+		if _, err := persistence.ImportArchive(target, bytes.NewReader([]byte(`{"type":"agreement"}`))); err == nil {
+			t.Errorf("an archive without a header should be rejected")
+		} else if _, err := persistence.ImportArchive(target, bytes.NewReader([]byte{})); err == nil {
+			t.Errorf("an empty archive should be rejected")
+		}
+
+		// The archive ends with a complete trailer, an archive that was truncated or that has an incomplete trailer is rejected.
+		lines := bytes.Split(bytes.TrimSpace(archive.Bytes()), []byte("\n"))
+		truncated := bytes.Join(lines[:len(lines)-1], []byte("\n"))
+		failed := append(append([]byte{}, truncated...), []byte(`
+{"type":"trailer","trailer":{"complete":false,"records":1,"error":"database is gone"}}`)...)
+		if trailer, err := persistence.VerifyArchiveTrailer(archive.Bytes()); err != nil {
+			t.Errorf("unexpected error verifying the archive: %v", err)
+		} else if trailer.Records != summary.Agreements+summary.WorkloadUsages+summary.SearchSessions {
+			t.Errorf("the trailer should count the records in %v, is %v", summary, trailer)
+		} else if _, err := persistence.VerifyArchiveTrailer(truncated); err == nil {
+			t.Errorf("a truncated archive should not be verified")
+		} else if _, err := persistence.ImportArchive(target, bytes.NewReader(truncated)); err == nil {
+			t.Errorf("a truncated archive should be rejected")
+		} else if _, err := persistence.VerifyArchiveTrailer(failed); err == nil {
+			t.Errorf("an incomplete archive should not be verified")
+		} else if _, err := persistence.ImportArchive(target, bytes.NewReader(failed)); err == nil {
+			t.Errorf("an incomplete archive should be rejected")
+		}
+	})
+}
@@ -15,6 +15,7 @@ type AgbotDatabase interface {
 	// Database related functions
 	Initialize(cfg *config.HorizonConfig) error
 	Close()
+	GetSchemaStatus() (*SchemaStatus, error)
 
 	// Database partition related functions.
 	FindPartitions() ([]string, error)
@@ -25,8 +26,28 @@ type AgbotDatabase interface {
 	GetPartitionOwner(id string) (string, error)
 	MovePartition(timeout uint64) (bool, error)
 
+	// Functions related to rebalancing agreements across partitions, see partition.go.
+	PrimaryPartition() string
+	GetPartitionHeartbeat(id string) (uint64, error)
+	HandOffAgreements(toPartition string, protocol string, agreementIds []string) (*PartitionMove, error)
+	FindPartitionMoves() ([]PartitionMove, error)
+	CompletePartitionMove(id string) error
+
+	// Functions related to staged rollouts of deployment policies, see rollout.go.
+	FindRolloutStates() ([]RolloutState, error)
+	GetRolloutState(policyName string) (*RolloutState, error)
+	SaveRolloutState(state *RolloutState) error
+	DeleteRolloutState(policyName string) error
+
+	// Functions related to the election of a leader for singleton duties, see leader.go.
+	AcquireLeadership(leaseS uint64) (bool, error)
+	ReleaseLeadership() error
+	GetLeader() (*LeaderLease, error)
+
 	// Persistent agreement related functions
 	FindAgreements(filters []AFilter, protocol string) ([]Agreement, error)
+	FindAgreementsInPartition(partition string, filters []AFilter, protocol string) ([]Agreement, error)
+	DeletePartitionAgreement(partition string, agreementid string, protocol string) error
 	FindSingleAgreementByAgreementId(agreementid string, protocol string, filters []AFilter) (*Agreement, error)
 	FindSingleAgreementByAgreementIdAllProtocols(agreementid string, protocols []string, filters []AFilter) (*Agreement, error)
 
@@ -74,4 +95,10 @@ type AgbotDatabase interface {
 	ResetAllChangedSince(newChangedSince uint64) error
 	ResetPolicyChangedSince(policy string, newChangedSince uint64) error
 	DumpSearchSessions() error
+
+	// Functions related to export and import of the database contents, see archive.go.
+	FindSearchSessions() ([]SearchSession, error)
+	ImportAgreement(ag *Agreement) error
+	ImportWorkloadUsage(wu *WorkloadUsage) error
+	ImportSearchSession(ss *SearchSession) (bool, error)
 }
@@ -0,0 +1,60 @@
+package persistence
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// When several agbots share a database, some duties (e.g. purging archived agreements) only need to run in one of them.
+// The agbots elect a leader through the database. The leader holds a lease that it renews periodically, and gives up when
+// it quiesces. When the leader stops renewing the lease, another agbot takes over. Databases that are private to a single
+// agbot use a LocalLease, so that agbot is always the leader.
+
+type LeaderLease struct {
+	Holder    string `json:"holder"`    // The identity of the agbot that holds the lease.
+	Partition string `json:"partition"` // The primary partition of the agbot that holds the lease.
+	Acquired  uint64 `json:"acquired"`  // The time the holder became the leader.
+	Expires   uint64 `json:"expires"`   // The time the lease expires if it is not renewed.
+}
+
+func (l LeaderLease) String() string {
+	return fmt.Sprintf("Holder: %v, Partition: %v, Acquired: %v, Expires: %v", l.Holder, l.Partition, l.Acquired, l.Expires)
+}
+
+// The leader lease of a database that is used by only 1 agbot. Acquiring the lease always succeeds.
+type LocalLease struct {
+	lock  sync.Mutex
+	lease *LeaderLease
+}
+
+func (l *LocalLease) Acquire(holder string, partition string, leaseS uint64) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := uint64(time.Now().Unix())
+	if l.lease == nil || l.lease.Holder != holder || l.lease.Expires <= now {
+		l.lease = &LeaderLease{Holder: holder, Partition: partition, Acquired: now}
+	}
+	l.lease.Expires = now + leaseS
+	return true
+}
+
+func (l *LocalLease) Release() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.lease = nil
+}
+
+// Returns nil if there is no leader or the lease has expired.
+func (l *LocalLease) Get() *LeaderLease {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.lease == nil || l.lease.Expires <= uint64(time.Now().Unix()) {
+		return nil
+	}
+	lease := *l.lease
+	return &lease
+}
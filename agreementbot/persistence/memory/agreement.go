@@ -0,0 +1,271 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+	"sync"
+	"time"
+)
+
+// This function registers an uninitialized agbot DB instance with the DB plugin registry. The plugin's Initialize
+// method is used to configure the object.
+func init() {
+	persistence.Register("memory", new(AgbotMemoryDB))
+}
+
+// Functions that implement the database replacement abstraction in memory. Nothing is persisted, so all state is lost when
+// the agbot terminates. This implementation is meant for unit tests and development agbots. Records are kept in their
+// serialized form, the same way the bolt implementation keeps them, so that callers never share memory with the database.
+
+// This is the object that represents the handle to the in memory database.
+type AgbotMemoryDB struct {
+	lock           sync.Mutex
+	agreements     map[string]map[string][]byte // Serialized agreements keyed by protocol and then by agreement id.
+	workloadUsages map[uint64][]byte            // Serialized workload usages keyed by record id.
+	wuSequence     uint64                       // The last workload usage record id that was allocated.
+	searchSessions map[string]*searchSession    // Search sessions keyed by policy name.
+	rollouts       map[string][]byte            // Serialized rollout states keyed by policy name.
+	leader         persistence.LocalLease       // This agbot is always the leader.
+	initialized    time.Time                    // When the tables were created.
+}
+
+func (db *AgbotMemoryDB) String() string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return fmt.Sprintf("In memory DB, Agreement protocols: %v, Workload usages: %v, Search sessions: %v", len(db.agreements), len(db.workloadUsages), len(db.searchSessions))
+}
+
+// The in memory database is private to a single agbot, so all the agreements are in its only partition.
+func (db *AgbotMemoryDB) GetAgreementCount(partition string) (int64, int64, error) {
+	var activeNum, archivedNum int64
+	if partition != MEMORY_PARTITION {
+		return activeNum, archivedNum, nil
+	}
+	for _, protocol := range policy.AllAgreementProtocols() {
+		if activeAgreements, err := db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter()}, protocol); err != nil {
+			return 0, 0, err
+		} else if archivedAgreements, err := db.FindAgreements([]persistence.AFilter{persistence.ArchivedAFilter()}, protocol); err != nil {
+			return 0, 0, err
+		} else {
+			activeNum += int64(len(activeAgreements))
+			archivedNum += int64(len(archivedAgreements))
+		}
+	}
+	return activeNum, archivedNum, nil
+}
+
+func (db *AgbotMemoryDB) FindAgreements(filters []persistence.AFilter, protocol string) ([]persistence.Agreement, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	agreements := make([]persistence.Agreement, 0)
+
+	for _, v := range db.agreements[protocol] {
+		var a persistence.Agreement
+		if err := json.Unmarshal(v, &a); err != nil {
+			glog.Errorf("Unable to deserialize db record: %v", v)
+		} else if agPassed := persistence.RunFilters(&a, filters); agPassed != nil {
+			agreements = append(agreements, a)
+		}
+	}
+
+	return agreements, nil
+}
+
+// The in memory database is private to a single agbot, so all the agreements are in its only partition.
+func (db *AgbotMemoryDB) FindAgreementsInPartition(partition string, filters []persistence.AFilter, protocol string) ([]persistence.Agreement, error) {
+	if partition != MEMORY_PARTITION {
+		return []persistence.Agreement{}, nil
+	}
+	return db.FindAgreements(filters, protocol)
+}
+
+func (db *AgbotMemoryDB) AgreementAttempt(agreementid string, org string, deviceid string, deviceType string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, serviceId []string, nhPolicy policy.NodeHealth) error {
+	if agreement, err := persistence.NewAgreement(agreementid, org, deviceid, deviceType, policyName, bcType, bcName, bcOrg, agreementProto, pattern, serviceId, nhPolicy); err != nil {
+		return err
+	} else {
+		return db.insertAgreement(agreement, agreementProto)
+	}
+}
+
+func (db *AgbotMemoryDB) AgreementUpdate(agreementid string, proposal string, policy string, dvPolicy policy.DataVerification, defaultCheckRate uint64, hash string, sig string, protocol string, agreementProtoVersion int) (*persistence.Agreement, error) {
+	return persistence.AgreementUpdate(db, agreementid, proposal, policy, dvPolicy, defaultCheckRate, hash, sig, protocol, agreementProtoVersion)
+}
+
+func (db *AgbotMemoryDB) AgreementMade(agreementId string, counterParty string, signature string, protocol string, hapartners []string, bcType string, bcName string, bcOrg string) (*persistence.Agreement, error) {
+	return persistence.AgreementMade(db, agreementId, counterParty, signature, protocol, hapartners, bcType, bcName, bcOrg)
+}
+
+func (db *AgbotMemoryDB) AgreementBlockchainUpdate(agreementId string, consumerSig string, hash string, counterParty string, signature string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementBlockchainUpdate(db, agreementId, consumerSig, hash, counterParty, signature, protocol)
+}
+
+func (db *AgbotMemoryDB) AgreementBlockchainUpdateAck(agreementId string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementBlockchainUpdateAck(db, agreementId, protocol)
+}
+
+func (db *AgbotMemoryDB) AgreementFinalized(agreementId string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementFinalized(db, agreementId, protocol)
+}
+
+func (db *AgbotMemoryDB) AgreementTimedout(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementTimedout(db, agreementid, protocol)
+}
+
+func (db *AgbotMemoryDB) DataVerified(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataVerified(db, agreementid, protocol)
+}
+
+func (db *AgbotMemoryDB) DataNotVerified(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataNotVerified(db, agreementid, protocol)
+}
+
+func (db *AgbotMemoryDB) DataNotification(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataNotification(db, agreementid, protocol)
+}
+
+func (db *AgbotMemoryDB) MeteringNotification(agreementid string, protocol string, mn string) (*persistence.Agreement, error) {
+	return persistence.MeteringNotification(db, agreementid, protocol, mn)
+}
+
+func (db *AgbotMemoryDB) ArchiveAgreement(agreementid string, protocol string, reason uint, desc string) (*persistence.Agreement, error) {
+	return persistence.ArchiveAgreement(db, agreementid, protocol, reason, desc)
+}
+
+// no error on not found, only nil
+func (db *AgbotMemoryDB) FindSingleAgreementByAgreementId(agreementid string, protocol string, filters []persistence.AFilter) (*persistence.Agreement, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if v, ok := db.agreements[protocol][agreementid]; !ok {
+		return nil, nil
+	} else {
+		var a persistence.Agreement
+		if err := json.Unmarshal(v, &a); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal agreement DB data: %v", string(v))
+		}
+		return persistence.RunFilters(&a, filters), nil
+	}
+}
+
+// no error on not found, only nil
+func (db *AgbotMemoryDB) FindSingleAgreementByAgreementIdAllProtocols(agreementid string, protocols []string, filters []persistence.AFilter) (*persistence.Agreement, error) {
+	for _, protocol := range protocols {
+		if agreement, err := db.FindSingleAgreementByAgreementId(agreementid, protocol, filters); err != nil {
+			return nil, err
+		} else if agreement != nil {
+			return agreement, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *AgbotMemoryDB) SingleAgreementUpdate(agreementid string, protocol string, fn func(persistence.Agreement) *persistence.Agreement) (*persistence.Agreement, error) {
+	if agreement, err := db.FindSingleAgreementByAgreementId(agreementid, protocol, []persistence.AFilter{}); err != nil {
+		return nil, err
+	} else if agreement == nil {
+		return nil, fmt.Errorf("Unable to locate agreement id: %v", agreementid)
+	} else {
+		updated := fn(*agreement)
+		return updated, db.persistUpdatedAgreement(agreementid, protocol, updated)
+	}
+}
+
+// does whole-member replacements of values that are legal to change during the course of an agreement's life
+func (db *AgbotMemoryDB) persistUpdatedAgreement(agreementid string, protocol string, update *persistence.Agreement) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	current, ok := db.agreements[protocol][agreementid]
+	var mod persistence.Agreement
+
+	if !ok {
+		return fmt.Errorf("No agreement with given id available to update: %v", agreementid)
+	} else if err := json.Unmarshal(current, &mod); err != nil {
+		return fmt.Errorf("Failed to unmarshal agreement DB data: %v", string(current))
+	}
+
+	// The database lock is held while the current record (mod) is read and then updated according to the updates
+	// within the input update record. It is critical to check for correct data transitions under the lock.
+	persistence.ValidateStateTransition(&mod, update)
+
+	if serialized, err := json.Marshal(mod); err != nil {
+		return fmt.Errorf("Failed to serialize agreement record: %v", mod)
+	} else {
+		db.agreements[protocol][agreementid] = serialized
+		glog.V(2).Infof("Succeeded updating agreement record to %v", mod)
+	}
+	return nil
+}
+
+func (db *AgbotMemoryDB) DeleteAgreement(pk string, protocol string) error {
+	if pk == "" {
+		return fmt.Errorf("Missing required arg pk")
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if existing, ok := db.agreements[protocol][pk]; !ok {
+		glog.Errorf("Warning: record deletion requested, but record does not exist: %v", pk)
+		return nil // handle already-deleted agreement as success
+	} else {
+		var record persistence.Agreement
+
+		if err := json.Unmarshal(existing, &record); err != nil {
+			glog.Errorf("Error deserializing agreement: %v. This is a pre-deletion warning message function so deletion will still proceed", record)
+		} else if record.CurrentAgreementId != "" && !record.Archived {
+			glog.Warningf("Warning! Deleting an agreement record with an agreement id, this operation should only be done after cancelling on the blockchain.")
+		}
+	}
+
+	delete(db.agreements[protocol], pk)
+	return nil
+}
+
+func (db *AgbotMemoryDB) DeletePartitionAgreement(partition string, agreementid string, protocol string) error {
+	if partition != MEMORY_PARTITION {
+		return nil
+	}
+	return db.DeleteAgreement(agreementid, protocol)
+}
+
+func (db *AgbotMemoryDB) Close() {
+	glog.V(2).Infof("Closed in memory database")
+}
+
+// The in memory database schema is not versioned, it is always created by the code that is running, so it is always at
+// the latest version.
+func (db *AgbotMemoryDB) GetSchemaStatus() (*persistence.SchemaStatus, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return &persistence.SchemaStatus{
+		Provider:    "memory",
+		Description: "in memory tables, not versioned",
+		Updated:     db.initialized.Format(time.RFC3339),
+	}, nil
+}
+
+func (db *AgbotMemoryDB) insertAgreement(ag *persistence.Agreement, protocol string) error {
+	if serialized, err := json.Marshal(ag); err != nil {
+		return fmt.Errorf("Unable to serialize record %v. Error: %v", ag, err)
+	} else {
+		db.lock.Lock()
+		defer db.lock.Unlock()
+
+		if _, ok := db.agreements[protocol]; !ok {
+			db.agreements[protocol] = make(map[string][]byte)
+		}
+		if _, ok := db.agreements[protocol][ag.CurrentAgreementId]; ok {
+			return fmt.Errorf("Protocol %v already contains record with primary key: %v", protocol, ag.CurrentAgreementId)
+		}
+		db.agreements[protocol][ag.CurrentAgreementId] = serialized
+		glog.V(2).Infof("Succeeded writing agreement record identified by %v in %v", ag.CurrentAgreementId, protocol)
+		return nil
+	}
+}
@@ -0,0 +1,38 @@
+// +build unit
+
+package memory
+
+import (
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+)
+
+// The agreements are only counted in the memory partition, and the schema status is always reported.
+func Test_GetAgreementCount_partition(t *testing.T) {
+
+	db := new(AgbotMemoryDB)
+	if err := db.Initialize(&config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true}}); err != nil {
+		t.Fatalf("unable to initialize the database, error: %v", err)
+	} else if err := db.AgreementAttempt("ag1", "myorg", "myorg/node1", "device", "mypolicy", "", "", "", policy.BasicProtocol, "", []string{}, policy.NodeHealth{}); err != nil {
+		t.Fatalf("unable to create agreement, error: %v", err)
+	}
+
+	if active, archived, err := db.GetAgreementCount(MEMORY_PARTITION); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if active != 1 || archived != 0 {
+		t.Errorf("the memory partition should have 1 active agreement, has %v active and %v archived", active, archived)
+	}
+
+	if active, archived, err := db.GetAgreementCount("other"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if active != 0 || archived != 0 {
+		t.Errorf("another partition should have no agreements, has %v active and %v archived", active, archived)
+	}
+
+	if status, err := db.GetSchemaStatus(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if status == nil || status.Provider != "memory" || status.CurrentVersion != status.LatestVersion {
+		t.Errorf("the schema status should be reported, is %v", status)
+	}
+}
@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"time"
+)
+
+// Functions used to export and import the contents of the database.
+
+func (db *AgbotMemoryDB) FindSearchSessions() ([]persistence.SearchSession, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	sss := make([]persistence.SearchSession, 0, len(db.searchSessions))
+	for policyName, ss := range db.searchSessions {
+		sss = append(sss, persistence.SearchSession{
+			PolicyName:          policyName,
+			ChangedSince:        ss.ChangedSince,
+			SessionToken:        ss.SessionToken,
+			SessionEnded:        ss.SessionEnded,
+			RestartChangedSince: ss.RestartChangedSince,
+		})
+	}
+	return sss, nil
+}
+
+func (db *AgbotMemoryDB) ImportAgreement(ag *persistence.Agreement) error {
+	return db.insertAgreement(ag, ag.AgreementProtocol)
+}
+
+// The record id is allocated by the database, so the imported record's id is not preserved.
+func (db *AgbotMemoryDB) ImportWorkloadUsage(wu *persistence.WorkloadUsage) error {
+	record := *wu
+	return db.insertWorkloadUsage(&record)
+}
+
+// Search sessions are kept per policy, so a session from a database that has a single search session for all policies
+// is not imported. The imported session is ended, so that the next search allocates a new session token.
+func (db *AgbotMemoryDB) ImportSearchSession(ss *persistence.SearchSession) (bool, error) {
+	if ss.PolicyName == "" {
+		glog.V(3).Infof("Skipping import of search session %v, it does not belong to a policy", ss)
+		return false, nil
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.searchSessions[ss.PolicyName] = &searchSession{
+		ChangedSince:        ss.ChangedSince,
+		SessionToken:        ss.SessionToken,
+		SessionEnded:        true,
+		RestartChangedSince: ss.RestartChangedSince,
+		Updated:             uint64(time.Now().Unix()),
+	}
+	return true, nil
+}
@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
+	"time"
+)
+
+// Setup everything the in memory database needs to be able to run an agbot. Any state left over from a previous
+// initialization is discarded.
+func (db *AgbotMemoryDB) Initialize(cfg *config.HorizonConfig) error {
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.agreements = make(map[string]map[string][]byte)
+	db.workloadUsages = make(map[uint64][]byte)
+	db.wuSequence = 0
+	db.searchSessions = make(map[string]*searchSession)
+	db.rollouts = make(map[string][]byte)
+	db.initialized = time.Now()
+
+	glog.Warningf("Agreementbot is using an in memory database, agreement state will be lost when the agbot terminates.")
+	return nil
+
+}
@@ -0,0 +1,19 @@
+package memory
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// The in memory database is private to a single agbot, so that agbot is always the leader.
+func (db *AgbotMemoryDB) AcquireLeadership(leaseS uint64) (bool, error) {
+	return db.leader.Acquire(MEMORY_PARTITION, MEMORY_PARTITION, leaseS), nil
+}
+
+func (db *AgbotMemoryDB) ReleaseLeadership() error {
+	db.leader.Release()
+	return nil
+}
+
+func (db *AgbotMemoryDB) GetLeader() (*persistence.LeaderLease, error) {
+	return db.leader.Get(), nil
+}
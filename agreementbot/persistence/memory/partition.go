@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// The in memory database is private to a single agbot, so it has only 1 partition.
+const MEMORY_PARTITION = "memory"
+
+func (db *AgbotMemoryDB) FindPartitions() ([]string, error) {
+	return []string{MEMORY_PARTITION}, nil
+}
+
+func (db *AgbotMemoryDB) ClaimPartition(timeout uint64) (string, error) {
+	return MEMORY_PARTITION, nil
+}
+
+func (db *AgbotMemoryDB) HeartbeatPartition() error {
+	return nil
+}
+
+func (db *AgbotMemoryDB) GetHeartbeat() (uint64, error) {
+	return 0, nil
+}
+
+func (db *AgbotMemoryDB) QuiescePartition() error {
+	return nil
+}
+
+func (db *AgbotMemoryDB) GetPartitionOwner(id string) (string, error) {
+	return MEMORY_PARTITION, nil
+}
+
+func (db *AgbotMemoryDB) MovePartition(timeout uint64) (bool, error) {
+	return false, nil
+}
+
+// There is only 1 partition, so there is nothing to rebalance.
+func (db *AgbotMemoryDB) PrimaryPartition() string {
+	return MEMORY_PARTITION
+}
+
+func (db *AgbotMemoryDB) GetPartitionHeartbeat(id string) (uint64, error) {
+	return 0, nil
+}
+
+func (db *AgbotMemoryDB) HandOffAgreements(toPartition string, protocol string, agreementIds []string) (*persistence.PartitionMove, error) {
+	return nil, errors.New(fmt.Sprintf("partition %v does not exist, the database has only 1 partition", toPartition))
+}
+
+func (db *AgbotMemoryDB) FindPartitionMoves() ([]persistence.PartitionMove, error) {
+	return []persistence.PartitionMove{}, nil
+}
+
+func (db *AgbotMemoryDB) CompletePartitionMove(id string) error {
+	return errors.New(fmt.Sprintf("partition move %v does not exist", id))
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"time"
+)
+
+func (db *AgbotMemoryDB) FindRolloutStates() ([]persistence.RolloutState, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	states := make([]persistence.RolloutState, 0, len(db.rollouts))
+	for _, v := range db.rollouts {
+		var rs persistence.RolloutState
+		if err := json.Unmarshal(v, &rs); err != nil {
+			glog.Errorf("Unable to deserialize db record: %v", v)
+		} else {
+			states = append(states, rs)
+		}
+	}
+	return states, nil
+}
+
+// Returns nil if there is no rollout state for the policy.
+func (db *AgbotMemoryDB) GetRolloutState(policyName string) (*persistence.RolloutState, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if v, ok := db.rollouts[policyName]; !ok {
+		return nil, nil
+	} else {
+		rs := new(persistence.RolloutState)
+		if err := json.Unmarshal(v, rs); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal rollout state DB data: %v", string(v))
+		}
+		return rs, nil
+	}
+}
+
+func (db *AgbotMemoryDB) SaveRolloutState(state *persistence.RolloutState) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	state.Updated = uint64(time.Now().Unix())
+	if serialized, err := json.Marshal(state); err != nil {
+		return fmt.Errorf("Failed to serialize rollout state: %v, error: %v", *state, err)
+	} else {
+		db.rollouts[state.PolicyName] = serialized
+	}
+	return nil
+}
+
+func (db *AgbotMemoryDB) DeleteRolloutState(policyName string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	delete(db.rollouts, policyName)
+	return nil
+}
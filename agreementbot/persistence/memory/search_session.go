@@ -0,0 +1,112 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"strconv"
+	"time"
+)
+
+// Search sessions are kept per policy, with the same semantics as the postgresql implementation.
+type searchSession struct {
+	ChangedSince        uint64
+	SessionToken        uint64
+	SessionEnded        bool
+	RestartChangedSince uint64
+	Updated             uint64
+}
+
+func (r searchSession) String() string {
+	return fmt.Sprintf("ChangedSince: %v, SessionToken: %v, SessionEnded: %v, RestartCS: %v, Updated: %v", r.ChangedSince, r.SessionToken, r.SessionEnded, r.RestartChangedSince, r.Updated)
+}
+
+// Get a session token and changedSince values so that the caller can use it to perform a node search. The
+// returned token might be a new session token or it might be the current session, depends whether or not the
+// session has ended.
+func (db *AgbotMemoryDB) ObtainSearchSession(policyName string) (string, uint64, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	ss, ok := db.searchSessions[policyName]
+	if !ok {
+		ss = &searchSession{
+			ChangedSince: 0,
+			SessionToken: 1999999998,
+			SessionEnded: false,
+			Updated:      uint64(time.Now().Unix()),
+		}
+		db.searchSessions[policyName] = ss
+
+	} else if ss.SessionEnded {
+		// Update changedSince based on an agbot restart, then allocate a new session token. The session token is
+		// actually a number so be careful of the number rolling over.
+		if ss.RestartChangedSince != 0 {
+			ss.ChangedSince = ss.RestartChangedSince
+			ss.RestartChangedSince = 0
+		}
+		ss.SessionToken += 1
+		if ss.SessionToken > 2000000000 {
+			ss.SessionToken = 1
+		}
+		ss.SessionEnded = false
+		ss.Updated = uint64(time.Now().Unix())
+	}
+
+	return strconv.FormatUint(ss.SessionToken, 10), ss.ChangedSince, nil
+}
+
+func (db *AgbotMemoryDB) UpdateSearchSessionChangedSince(currentChangedSince uint64, newChangedSince uint64, policyName string) (bool, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	ss, ok := db.searchSessions[policyName]
+	if !ok {
+		return false, fmt.Errorf("no search session for policy %v", policyName)
+	}
+
+	// Save the current session state for return at the end.
+	currentSessionState := ss.SessionEnded
+
+	if ss.ChangedSince == currentChangedSince && !ss.SessionEnded {
+		ss.ChangedSince = newChangedSince
+		ss.SessionEnded = true
+		ss.Updated = uint64(time.Now().Unix())
+	}
+	return currentSessionState, nil
+}
+
+func (db *AgbotMemoryDB) ResetAllChangedSince(newChangedSince uint64) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for _, ss := range db.searchSessions {
+		if ss.SessionEnded {
+			ss.ChangedSince = newChangedSince
+		} else {
+			ss.RestartChangedSince = newChangedSince
+		}
+		ss.Updated = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+func (db *AgbotMemoryDB) ResetPolicyChangedSince(policy string, newChangedSince uint64) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if ss, ok := db.searchSessions[policy]; ok && (ss.RestartChangedSince == 0 || ss.RestartChangedSince > newChangedSince) {
+		ss.RestartChangedSince = newChangedSince
+		ss.Updated = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+func (db *AgbotMemoryDB) DumpSearchSessions() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for policyName, ss := range db.searchSessions {
+		glog.V(4).Infof("Search Session: Policy: %v, %v", policyName, ss)
+	}
+	return nil
+}
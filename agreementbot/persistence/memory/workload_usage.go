@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+func (db *AgbotMemoryDB) NewWorkloadUsage(deviceId string, hapartners []string, policy string, policyName string, priority int, retryDurationS int, verifiedDurationS int, reqsNotMet bool, agid string) error {
+	if wlUsage, err := persistence.NewWorkloadUsage(deviceId, hapartners, policy, policyName, priority, retryDurationS, verifiedDurationS, reqsNotMet, agid); err != nil {
+		return err
+	} else if existing, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(deviceId, policyName); err != nil {
+		return err
+	} else if existing != nil {
+		return fmt.Errorf("Workload usage record for device %v and policy name %v already exists.", deviceId, policyName)
+	} else {
+		return db.insertWorkloadUsage(wlUsage)
+	}
+}
+
+func (db *AgbotMemoryDB) GetWorkloadUsagesCount(partition string) (int64, error) {
+	if wus, err := db.FindWorkloadUsages([]persistence.WUFilter{}); err != nil {
+		return 0, err
+	} else {
+		return int64(len(wus)), nil
+	}
+}
+
+func (db *AgbotMemoryDB) FindSingleWorkloadUsageByDeviceAndPolicyName(deviceid string, policyName string) (*persistence.WorkloadUsage, error) {
+	filters := []persistence.WUFilter{persistence.DaPWUFilter(deviceid, policyName)}
+
+	if wlUsages, err := db.FindWorkloadUsages(filters); err != nil {
+		return nil, err
+	} else if len(wlUsages) > 1 {
+		return nil, fmt.Errorf("Expected only one record for device: %v and policy: %v, but retrieved: %v", deviceid, policyName, wlUsages)
+	} else if len(wlUsages) == 0 {
+		return nil, nil
+	} else {
+		return &wlUsages[0], nil
+	}
+}
+
+func (db *AgbotMemoryDB) UpdatePendingUpgrade(deviceid string, policyName string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdatePendingUpgrade(db, deviceid, policyName)
+}
+
+func (db *AgbotMemoryDB) UpdateRetryCount(deviceid string, policyName string, retryCount int, agid string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdateRetryCount(db, deviceid, policyName, retryCount, agid)
+}
+
+func (db *AgbotMemoryDB) UpdatePriority(deviceid string, policyName string, priority int, retryDurationS int, verifiedDurationS int, agid string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdatePriority(db, deviceid, policyName, priority, retryDurationS, verifiedDurationS, agid)
+}
+
+func (db *AgbotMemoryDB) UpdatePolicy(deviceid string, policyName string, pol string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdatePolicy(db, deviceid, policyName, pol)
+}
+
+func (db *AgbotMemoryDB) UpdateWUAgreementId(deviceid string, policyName string, agid string, protocol string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdateWUAgreementId(db, deviceid, policyName, agid)
+}
+
+func (db *AgbotMemoryDB) DisableRollbackChecking(deviceid string, policyName string) (*persistence.WorkloadUsage, error) {
+	return persistence.DisableRollbackChecking(db, deviceid, policyName)
+}
+
+func (db *AgbotMemoryDB) SingleWorkloadUsageUpdate(deviceid string, policyName string, fn func(persistence.WorkloadUsage) *persistence.WorkloadUsage) (*persistence.WorkloadUsage, error) {
+	if wlUsage, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(deviceid, policyName); err != nil {
+		return nil, err
+	} else if wlUsage == nil {
+		return nil, fmt.Errorf("Unable to locate workload usage for device: %v, and policy: %v", deviceid, policyName)
+	} else {
+		updated := fn(*wlUsage)
+		return updated, db.persistUpdatedWorkloadUsage(wlUsage.Id, updated)
+	}
+}
+
+// does whole-member replacements of values that are legal to change during the course of a workload usage
+func (db *AgbotMemoryDB) persistUpdatedWorkloadUsage(id uint64, update *persistence.WorkloadUsage) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	current, ok := db.workloadUsages[id]
+	var mod persistence.WorkloadUsage
+
+	if !ok {
+		return fmt.Errorf("No workload usage with id %v available to update", id)
+	} else if err := json.Unmarshal(current, &mod); err != nil {
+		return fmt.Errorf("Failed to unmarshal workload usage DB data: %v", string(current))
+	}
+
+	// The database lock is held while the current record (mod) is read and then updated according to the updates
+	// within the input update record. It is critical to check for correct data transitions under the lock.
+	persistence.ValidateWUStateTransition(&mod, update)
+
+	if serialized, err := json.Marshal(mod); err != nil {
+		return fmt.Errorf("Failed to serialize workload usage record: %v", mod)
+	} else {
+		db.workloadUsages[id] = serialized
+		glog.V(2).Infof("Succeeded updating workload usage record to %v", mod.ShortString())
+	}
+	return nil
+}
+
+func (db *AgbotMemoryDB) DeleteWorkloadUsage(deviceid string, policyName string) error {
+	if deviceid == "" || policyName == "" {
+		return fmt.Errorf("Missing required arg deviceid or policyName")
+	} else if wlUsage, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(deviceid, policyName); err != nil {
+		return err
+	} else if wlUsage == nil {
+		return fmt.Errorf("Unable to locate workload usage for device: %v, and policy: %v", deviceid, policyName)
+	} else {
+		db.lock.Lock()
+		defer db.lock.Unlock()
+
+		glog.V(3).Infof("Deleting workload usage record for %v with policy %v", deviceid, policyName)
+		delete(db.workloadUsages, wlUsage.Id)
+		return nil
+	}
+}
+
+func (db *AgbotMemoryDB) FindWorkloadUsages(filters []persistence.WUFilter) ([]persistence.WorkloadUsage, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	wlUsages := make([]persistence.WorkloadUsage, 0)
+
+	for _, v := range db.workloadUsages {
+		var a persistence.WorkloadUsage
+
+		if err := json.Unmarshal(v, &a); err != nil {
+			glog.Errorf("Unable to deserialize db record: %v", v)
+		} else {
+			exclude := false
+			for _, filterFn := range filters {
+				if !filterFn(a) {
+					exclude = true
+				}
+			}
+			if !exclude {
+				wlUsages = append(wlUsages, a)
+			}
+		}
+	}
+
+	return wlUsages, nil
+}
+
+func (db *AgbotMemoryDB) insertWorkloadUsage(wlUsage *persistence.WorkloadUsage) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	// Allocate the record's primary key from the DB's internal sequence counter.
+	db.wuSequence += 1
+	wlUsage.Id = db.wuSequence
+	if serialized, err := json.Marshal(wlUsage); err != nil {
+		return fmt.Errorf("Unable to serialize record %v. Error: %v", wlUsage, err)
+	} else {
+		db.workloadUsages[wlUsage.Id] = serialized
+		glog.V(2).Infof("Succeeded writing workload usage record identified by key %v, record %v", wlUsage.Id, *wlUsage)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The schema migration scaffolding shared by the database providers that version their schema. Each provider keeps its own
+// list of migrations and runs them against its own database, the functions in this file verify the list and compute the
+// steps needed to move the schema from one version to another.
+
+// A migration moves the database schema from version (Version - 1) to Version when it is applied (up), and back again
+// when it is reverted (down). The statements of a migration are run in a single transaction, together with the update of
+// the version table and the migration history, so a migration is either completely applied or not applied at all.
+type Migration struct {
+	Version int      // The schema version introduced by this migration.
+	Name    string   // A short description of the schema change.
+	Up      []string // The SQL statements that apply the schema change.
+	Down    []string // The SQL statements that revert the schema change. Empty if the migration cannot be reverted.
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("Version: %v, Name: %v", m.Version, m.Name)
+}
+
+// A single step in a migration plan.
+type MigrationStep struct {
+	Migration Migration
+	Direction string // MIGRATION_UP or MIGRATION_DOWN
+}
+
+func (s MigrationStep) Statements() []string {
+	if s.Direction == MIGRATION_UP {
+		return s.Migration.Up
+	}
+	return s.Migration.Down
+}
+
+// The version of the schema after the step has run.
+func (s MigrationStep) ResultVersion() int {
+	if s.Direction == MIGRATION_UP {
+		return s.Migration.Version
+	}
+	return s.Migration.Version - 1
+}
+
+// The description of the schema after the step has run, for the version table.
+func (s MigrationStep) Description() string {
+	if s.Direction == MIGRATION_DOWN {
+		return fmt.Sprintf("reverted %v", s.Migration.Name)
+	}
+	return s.Migration.Name
+}
+
+func (s MigrationStep) String() string {
+	return fmt.Sprintf("%v %v (%v)", s.Direction, s.Migration.Version, s.Migration.Name)
+}
+
+// Verify that the list of migrations is well formed. Versions must be contiguous, starting at initial + 1 and ending at
+// highest.
+func ValidateMigrations(ms []Migration, initial int, highest int) error {
+	expected := initial + 1
+	for _, m := range ms {
+		if m.Version != expected {
+			return errors.New(fmt.Sprintf("schema migration %v is out of order, expected version %v", m, expected))
+		} else if m.Name == "" {
+			return errors.New(fmt.Sprintf("schema migration version %v has no name", m.Version))
+		} else if len(m.Up) == 0 {
+			return errors.New(fmt.Sprintf("schema migration %v has no up statements", m))
+		}
+		expected += 1
+	}
+	if expected-1 != highest {
+		return errors.New(fmt.Sprintf("schema migrations end at version %v, but the highest database version is %v", expected-1, highest))
+	}
+	return nil
+}
+
+// The target version used to migrate the schema to the latest version supported by this code.
+const LATEST_SCHEMA_VERSION = -1
+
+// Compute the ordered list of migration steps that move the schema from the current version to the target version. A
+// database that is newer than the code is left alone when the target is LATEST_SCHEMA_VERSION, so that older agbots
+// can keep running during a rolling upgrade.
+func PlanMigrations(ms []Migration, current int, target int, highest int) ([]MigrationStep, error) {
+	steps := make([]MigrationStep, 0)
+
+	if target == LATEST_SCHEMA_VERSION {
+		if current >= highest {
+			return steps, nil
+		}
+		target = highest
+	}
+
+	if target < 0 {
+		return nil, errors.New(fmt.Sprintf("target schema version %v is not valid", target))
+	} else if target > highest {
+		return nil, errors.New(fmt.Sprintf("target schema version %v is higher than the highest version %v supported by this agbot", target, highest))
+	} else if current > highest && target < current {
+		return nil, errors.New(fmt.Sprintf("database schema version %v is newer than this agbot supports (%v), it cannot be migrated down by this agbot", current, highest))
+	}
+
+	byVersion := make(map[int]Migration)
+	for _, m := range ms {
+		byVersion[m.Version] = m
+	}
+
+	for v := current + 1; v <= target; v++ {
+		if m, ok := byVersion[v]; !ok {
+			return nil, errors.New(fmt.Sprintf("no schema migration to version %v", v))
+		} else {
+			steps = append(steps, MigrationStep{Migration: m, Direction: MIGRATION_UP})
+		}
+	}
+
+	for v := current; v > target; v-- {
+		if m, ok := byVersion[v]; !ok {
+			return nil, errors.New(fmt.Sprintf("no schema migration from version %v", v))
+		} else if len(m.Down) == 0 {
+			return nil, errors.New(fmt.Sprintf("schema migration %v cannot be reverted", m))
+		} else {
+			steps = append(steps, MigrationStep{Migration: m, Direction: MIGRATION_DOWN})
+		}
+	}
+
+	return steps, nil
+}
+
+// Convert a migration plan into a readable list for logs and error messages.
+func StepsString(steps []MigrationStep) string {
+	s := make([]string, 0, len(steps))
+	for _, step := range steps {
+		s = append(s, step.String())
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,106 @@
+// +build unit
+
+package persistence_test
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"testing"
+)
+
+func testMigrations() []persistence.Migration {
+	return []persistence.Migration{
+		{Version: 1, Name: "add column", Up: []string{"ALTER TABLE t ADD COLUMN c int;"}, Down: []string{"ALTER TABLE t DROP COLUMN c;"}},
+		{Version: 2, Name: "add index", Up: []string{"CREATE INDEX i ON t (c);"}, Down: []string{"DROP INDEX i;"}},
+		{Version: 3, Name: "drop table", Up: []string{"DROP TABLE old;"}},
+	}
+}
+
+func Test_ValidateMigrations(t *testing.T) {
+	ms := testMigrations()
+
+	if err := persistence.ValidateMigrations(ms, 0, 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if err := persistence.ValidateMigrations(ms, 0, 4); err == nil {
+		t.Errorf("migrations that do not reach the highest version should be rejected")
+	} else if err := persistence.ValidateMigrations([]persistence.Migration{ms[0], ms[2]}, 0, 3); err == nil {
+		t.Errorf("migrations with a gap should be rejected")
+	} else if err := persistence.ValidateMigrations([]persistence.Migration{{Version: 1, Up: []string{"x"}}}, 0, 1); err == nil {
+		t.Errorf("a migration without a name should be rejected")
+	} else if err := persistence.ValidateMigrations([]persistence.Migration{{Version: 1, Name: "empty"}}, 0, 1); err == nil {
+		t.Errorf("a migration without up statements should be rejected")
+	}
+}
+
+func Test_PlanMigrations_up(t *testing.T) {
+	ms := testMigrations()
+
+	if steps, err := persistence.PlanMigrations(ms, 0, 3, 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if len(steps) != 3 {
+		t.Errorf("expected 3 steps, got %v", steps)
+	} else {
+		for i, step := range steps {
+			if step.Direction != persistence.MIGRATION_UP || step.Migration.Version != i+1 || step.ResultVersion() != i+1 {
+				t.Errorf("step %v is wrong: %v", i, step)
+			}
+		}
+	}
+
+	if steps, err := persistence.PlanMigrations(ms, 1, 2, 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if len(steps) != 1 || steps[0].Migration.Version != 2 {
+		t.Errorf("expected a single step to version 2, got %v", steps)
+	}
+
+	if steps, err := persistence.PlanMigrations(ms, 3, 3, 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if len(steps) != 0 {
+		t.Errorf("expected no steps, got %v", steps)
+	}
+
+	if _, err := persistence.PlanMigrations(ms, 0, 4, 3); err == nil {
+		t.Errorf("a target above the highest version should be rejected")
+	}
+}
+
+func Test_PlanMigrations_down(t *testing.T) {
+	ms := testMigrations()
+
+	if steps, err := persistence.PlanMigrations(ms, 2, 0, 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if len(steps) != 2 {
+		t.Errorf("expected 2 steps, got %v", steps)
+	} else if steps[0].Direction != persistence.MIGRATION_DOWN || steps[0].Migration.Version != 2 || steps[0].ResultVersion() != 1 {
+		t.Errorf("first step is wrong: %v", steps[0])
+	} else if steps[1].Migration.Version != 1 || steps[1].ResultVersion() != 0 || len(steps[1].Statements()) != 1 {
+		t.Errorf("second step is wrong: %v", steps[1])
+	}
+
+	if _, err := persistence.PlanMigrations(ms, 3, 2, 3); err == nil {
+		t.Errorf("an irreversible migration should not be planned for a downgrade")
+	}
+}
+
+func Test_PlanMigrations_latest(t *testing.T) {
+	ms := testMigrations()
+
+	if steps, err := persistence.PlanMigrations(ms, 1, persistence.LATEST_SCHEMA_VERSION, 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if len(steps) != 2 || steps[1].ResultVersion() != 3 {
+		t.Errorf("expected 2 steps to version 3, got %v", steps)
+	}
+
+	// A newer database is left alone when migrating to the latest version known by the agbot.
+	if steps, err := persistence.PlanMigrations(ms, 5, persistence.LATEST_SCHEMA_VERSION, 3); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if len(steps) != 0 {
+		t.Errorf("expected no steps, got %v", steps)
+	}
+
+	// But it cannot be explicitly migrated down by an agbot that does not know the newer migrations.
+	if steps, err := persistence.PlanMigrations(ms, 5, 3, 3); err == nil {
+		t.Errorf("a newer database cannot be migrated down, got %v", steps)
+	} else if _, err := persistence.PlanMigrations(ms, 1, -2, 3); err == nil {
+		t.Errorf("a negative target version should be rejected")
+	}
+}
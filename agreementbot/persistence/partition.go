@@ -0,0 +1,78 @@
+package persistence
+
+import (
+	"fmt"
+	"time"
+)
+
+// Agbots that share a database each own a partition of the agreements in the database. Partitions normally only move when
+// an agbot quiesces or stops heartbeating. To keep the agreements evenly spread when a new agbot joins or the counts become
+// skewed, an agbot with too many agreements hands some of them off to the least loaded agbot. A hand off moves the agreements
+// and their workload usages into the receiving agbot's partition and records the move in the database. The receiving agbot
+// adopts the moved agreements (i.e. updates its in memory state) the next time it checks the partitions, which completes the
+// move. Until then the move is in flight.
+
+const PARTITION_MOVE_HANDED_OFF = "handed off" // The records have been moved, the receiving agbot has not adopted them yet.
+const PARTITION_MOVE_ADOPTED = "adopted"       // The receiving agbot has adopted the moved agreements.
+
+// Completed moves are kept in the database for this long so that they can be seen in the API.
+const PARTITION_MOVE_HISTORY_S = 24 * 60 * 60
+
+// The partition owner returned by GetPartitionOwner when no agbot owns the partition.
+const PARTITION_NO_OWNER = "NO OWNER"
+
+type PartitionMove struct {
+	Id            string   `json:"id"`
+	FromPartition string   `json:"fromPartition"`
+	ToPartition   string   `json:"toPartition"`
+	Protocol      string   `json:"protocol"`
+	Agreements    []string `json:"agreements"`
+	State         string   `json:"state"`
+	Started       uint64   `json:"started"`
+	Completed     uint64   `json:"completed,omitempty"`
+}
+
+func (m PartitionMove) String() string {
+	return fmt.Sprintf("Id: %v, FromPartition: %v, ToPartition: %v, Protocol: %v, Agreements: %v, State: %v, Started: %v, Completed: %v",
+		m.Id, m.FromPartition, m.ToPartition, m.Protocol, len(m.Agreements), m.State, m.Started, m.Completed)
+}
+
+// The ownership and load of a partition.
+type PartitionLoad struct {
+	Id        string
+	Owner     string
+	Heartbeat uint64
+	Live      bool // The partition has an owner that is heartbeating.
+	Active    int64
+	Archived  int64
+}
+
+func (p PartitionLoad) String() string {
+	return fmt.Sprintf("Id: %v, Owner: %v, Heartbeat: %v, Live: %v, Active: %v, Archived: %v", p.Id, p.Owner, p.Heartbeat, p.Live, p.Active, p.Archived)
+}
+
+// Return the ownership and load of every partition in the database. A partition is live when it has an owner that has
+// heartbeated within the stale timeout. The primary partition of the calling agbot is always live.
+func GetPartitionLoads(db AgbotDatabase, staleS uint64) ([]PartitionLoad, error) {
+
+	partitions, err := db.FindPartitions()
+	if err != nil {
+		return nil, err
+	}
+
+	now := uint64(time.Now().Unix())
+	loads := make([]PartitionLoad, 0, len(partitions))
+	for _, p := range partitions {
+		load := PartitionLoad{Id: p}
+		if load.Owner, err = db.GetPartitionOwner(p); err != nil {
+			return nil, err
+		} else if load.Heartbeat, err = db.GetPartitionHeartbeat(p); err != nil {
+			return nil, err
+		} else if load.Active, load.Archived, err = db.GetAgreementCount(p); err != nil {
+			return nil, err
+		}
+		load.Live = p == db.PrimaryPartition() || (load.Owner != PARTITION_NO_OWNER && load.Heartbeat != 0 && load.Heartbeat+staleS > now)
+		loads = append(loads, load)
+	}
+	return loads, nil
+}
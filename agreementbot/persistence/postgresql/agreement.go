@@ -9,6 +9,7 @@ import (
 	"github.com/open-horizon/anax/agreementbot/persistence"
 	"github.com/open-horizon/anax/policy"
 	"strings"
+	"sync"
 )
 
 // This function registers an uninitialized agbot DB instance with the DB plugin registry. The plugin's Initialize
@@ -104,7 +105,10 @@ const AGREEMENT_QUERY = `SELECT agreement FROM "agreements_ WHERE agreement_id =
 const ALL_AGREEMENTS_QUERY = `SELECT agreement FROM "agreements_ WHERE protocol = $1;`
 const AGREEMENT_PARTITION_EMPTY = `SELECT agreement_id FROM "agreements_;`
 
-const AGREEMENT_COUNT = `SELECT agreement FROM "agreements_;`
+// Count the active and archived agreements in a partition, without reading the agreements.
+const AGREEMENT_COUNT = `SELECT COUNT(*) FILTER (WHERE NOT COALESCE((agreement->>'archived')::boolean, false)),
+	COUNT(*) FILTER (WHERE COALESCE((agreement->>'archived')::boolean, false))
+	FROM "agreements_;`
 
 const AGREEMENT_INSERT = `INSERT INTO "agreements_ (agreement_id, protocol, partition, agreement) VALUES ($1, $2, $3, $4);`
 const AGREEMENT_UPDATE = `UPDATE "agreements_ SET agreement = $3, updated = current_timestamp WHERE agreement_id = $1 AND protocol = $2;`
@@ -127,6 +131,9 @@ type AgbotPostgresqlDB struct {
 	db               *sql.DB  // A handle to the underlying database.
 	primaryPartition string   // The partition to use when creating new agreements.
 	partitions       []string // The list of partitions this agbot is responsible to maintain.
+
+	leaderLock sync.Mutex // Serializes the use of the leader connection.
+	leaderConn *sql.Conn  // The session that holds the leader lock, nil when this agbot is not the leader.
 }
 
 func (db *AgbotPostgresqlDB) String() string {
@@ -223,30 +230,8 @@ func (db *AgbotPostgresqlDB) GetAgreementCount(partition string) (int64, int64,
 
 	var activeNum, archivedNum int64
 
-	rows, err := db.db.Query(db.GetAgreementPartitionTableCount(partition))
-	if err != nil {
-		return 0, 0, errors.New(fmt.Sprintf("error getting rows for agreement counts, error: %v", err))
-	}
-
-	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
-	defer rows.Close()
-	for rows.Next() {
-		agBytes := make([]byte, 0, 2048)
-		ag := new(persistence.Agreement)
-		if err := rows.Scan(&agBytes); err != nil {
-			return 0, 0, errors.New(fmt.Sprintf("error scanning row for agreement counts: %v", err))
-		} else if err := json.Unmarshal(agBytes, ag); err != nil {
-			return 0, 0, errors.New(fmt.Sprintf("error demarshalling row for agreement count: %v, error: %v", string(agBytes), err))
-		} else if ag.Archived {
-			archivedNum += 1
-		} else {
-			activeNum += 1
-		}
-	}
-
-	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
-	if err = rows.Err(); err != nil {
-		return 0, 0, errors.New(fmt.Sprintf("error iterating rows for agreement counts: %v", err))
+	if err := db.db.QueryRow(db.GetAgreementPartitionTableCount(partition)).Scan(&activeNum, &archivedNum); err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("error getting agreement counts, error: %v", err))
 	}
 
 	return activeNum, archivedNum, nil
@@ -258,38 +243,53 @@ func (db *AgbotPostgresqlDB) FindAgreements(filters []persistence.AFilter, proto
 	ags := make([]persistence.Agreement, 0, 100)
 
 	for _, currentPartition := range db.AllPartitions() {
-		// Find all the agreement objects, read them in and run them through the filters (after unmarshalling the blob into an
-		// in memory agreement object).
-		sql := strings.Replace(ALL_AGREEMENTS_QUERY, AGREEMENT_TABLE_NAME_ROOT, db.GetAgreementPartitionTableName(currentPartition), 1)
-		glog.V(5).Infof("Find agreements using SQL: %v for partition %v", sql, currentPartition)
-		rows, err := db.db.Query(sql, protocol)
-		if err != nil {
-			return nil, errors.New(fmt.Sprintf("error querying for agreements error: %v", err))
+		if partitionAgs, err := db.FindAgreementsInPartition(currentPartition, filters, protocol); err != nil {
+			return nil, err
+		} else {
+			ags = append(ags, partitionAgs...)
 		}
+	}
 
-		// If the rows object doesnt get closed, memory and connections will grow and/or leak.
-		defer rows.Close()
-		for rows.Next() {
-			agBytes := make([]byte, 0, 2048)
-			ag := new(persistence.Agreement)
-			if err := rows.Scan(&agBytes); err != nil {
-				return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
-			} else if err := json.Unmarshal(agBytes, ag); err != nil {
-				return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(agBytes), err))
-			} else {
-				if !ag.Archived {
-					glog.V(5).Infof("Demarshalled agreement in partition %v from DB: %v", currentPartition, ag)
-				}
-				if agPassed := persistence.RunFilters(ag, filters); agPassed != nil {
-					ags = append(ags, *ag)
-				}
+	return ags, nil
+
+}
+
+// Retrieve the agreements in a partition, whether or not it is owned by this agbot, and filter them based on the input filters.
+func (db *AgbotPostgresqlDB) FindAgreementsInPartition(partition string, filters []persistence.AFilter, protocol string) ([]persistence.Agreement, error) {
+
+	ags := make([]persistence.Agreement, 0, 100)
+
+	// Find all the agreement objects, read them in and run them through the filters (after unmarshalling the blob into an
+	// in memory agreement object).
+	sql := strings.Replace(ALL_AGREEMENTS_QUERY, AGREEMENT_TABLE_NAME_ROOT, db.GetAgreementPartitionTableName(partition), 1)
+	glog.V(5).Infof("Find agreements using SQL: %v for partition %v", sql, partition)
+	rows, err := db.db.Query(sql, protocol)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for agreements error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		agBytes := make([]byte, 0, 2048)
+		ag := new(persistence.Agreement)
+		if err := rows.Scan(&agBytes); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
+		} else if err := json.Unmarshal(agBytes, ag); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(agBytes), err))
+		} else {
+			if !ag.Archived {
+				glog.V(5).Infof("Demarshalled agreement in partition %v from DB: %v", partition, ag)
+			}
+			if agPassed := persistence.RunFilters(ag, filters); agPassed != nil {
+				ags = append(ags, *ag)
 			}
 		}
+	}
 
-		// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
-		if err = rows.Err(); err != nil {
-			return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
-		}
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
 	}
 
 	return ags, nil
@@ -422,6 +422,20 @@ func (db *AgbotPostgresqlDB) DeleteAgreement(agreementid string, protocol string
 	}
 }
 
+// Delete an agreement from a partition, whether or not it is owned by this agbot. The partition table is not removed when
+// it becomes empty, that is left to the agbot that owns the partition.
+func (db *AgbotPostgresqlDB) DeletePartitionAgreement(partition string, agreementid string, protocol string) error {
+
+	sql := strings.Replace(AGREEMENT_DELETE, AGREEMENT_TABLE_NAME_ROOT, db.GetAgreementPartitionTableName(partition), 1)
+	if _, err := db.db.Exec(sql, agreementid); err != nil {
+		return errors.New(fmt.Sprintf("error deleting agreement %v from partition %v, error: %v", agreementid, partition, err))
+	}
+
+	glog.V(5).Infof("Agreement %v deleted from partition %v.", agreementid, partition)
+	return nil
+
+}
+
 func (db *AgbotPostgresqlDB) Close() {
 	glog.V(2).Infof("Closing Postgresql database")
 	db.db.Close()
@@ -0,0 +1,62 @@
+package postgresql
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// Functions used to export and import the contents of the database. Imported records are always written into the
+// primary partition of this agbot.
+
+const SEARCH_SESSIONS_FIND = `SELECT policyName, changedSince, sessionToken, sessionEnded, restartChangedSince FROM search_sessions;`
+
+// Imported sessions are always ended, so that the next search for the policy allocates a new session token.
+const SEARCH_SESSIONS_IMPORT = `INSERT INTO search_sessions (policyName, changedSince, sessionToken, sessionEnded, restartChangedSince, updatingAgbot, updated)
+	VALUES ($1, $2, $3, true, $4, $5, current_timestamp)
+	ON CONFLICT (policyName) DO UPDATE
+	SET changedSince = EXCLUDED.changedSince, sessionToken = EXCLUDED.sessionToken, sessionEnded = true,
+		restartChangedSince = EXCLUDED.restartChangedSince, updatingAgbot = EXCLUDED.updatingAgbot, updated = current_timestamp;`
+
+func (db *AgbotPostgresqlDB) FindSearchSessions() ([]persistence.SearchSession, error) {
+	rows, err := db.db.Query(SEARCH_SESSIONS_FIND)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying search sessions, error: %v", err))
+	}
+	defer rows.Close()
+
+	sss := make([]persistence.SearchSession, 0)
+	for rows.Next() {
+		var ss persistence.SearchSession
+		if err := rows.Scan(&ss.PolicyName, &ss.ChangedSince, &ss.SessionToken, &ss.SessionEnded, &ss.RestartChangedSince); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning search session row, error: %v", err))
+		}
+		sss = append(sss, ss)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating search sessions, error: %v", err))
+	}
+	return sss, nil
+}
+
+func (db *AgbotPostgresqlDB) ImportAgreement(ag *persistence.Agreement) error {
+	return db.insertAgreement(ag, ag.AgreementProtocol)
+}
+
+func (db *AgbotPostgresqlDB) ImportWorkloadUsage(wu *persistence.WorkloadUsage) error {
+	return db.insertWorkloadUsage(nil, wu)
+}
+
+// Search sessions are kept per policy, so a session from a database that has a single search session for all policies
+// is not imported. The policy's session will be created when the policy is first searched.
+func (db *AgbotPostgresqlDB) ImportSearchSession(ss *persistence.SearchSession) (bool, error) {
+	if ss.PolicyName == "" {
+		glog.V(3).Infof("Skipping import of search session %v, it does not belong to a policy", ss)
+		return false, nil
+	} else if _, err := db.db.Exec(SEARCH_SESSIONS_IMPORT, ss.PolicyName, ss.ChangedSince, ss.SessionToken, ss.RestartChangedSince, db.identity); err != nil {
+		return false, errors.New(fmt.Sprintf("error importing %v search session, error: %v", ss.PolicyName, err))
+	}
+	return true, nil
+}
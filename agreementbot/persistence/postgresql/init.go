@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/golang/glog"
 	_ "github.com/lib/pq"
+	"github.com/open-horizon/anax/agreementbot/persistence"
 	"github.com/open-horizon/anax/config"
 	"github.com/satori/go.uuid"
 )
@@ -47,6 +48,8 @@ func (db *AgbotPostgresqlDB) Initialize(cfg *config.HorizonConfig) error {
 			return errors.New(fmt.Sprintf("unable to create version table, error: %v", err))
 		} else if _, err := db.db.Exec(VERSION_INSERT); err != nil {
 			return errors.New(fmt.Sprintf("unable to insert singleton version row, error: %v", err))
+		} else if _, err := db.db.Exec(MIGRATION_HISTORY_CREATE_TABLE); err != nil {
+			return errors.New(fmt.Sprintf("unable to create migration history table, error: %v", err))
 		}
 
 		// Create the search session table if necessary, and initialize the stored procedure functions.
@@ -93,37 +96,27 @@ func (db *AgbotPostgresqlDB) Initialize(cfg *config.HorizonConfig) error {
 
 		glog.V(3).Infof("Postgresql primary partition database tables exist.")
 
-		// Migrate the database tables if necessary. Extract the current schema version from the version table,
-		// and then run each version's migration SQL to bring the database up to the current version supported
-		// by this code.
-		var dbVersion int
-		var description string
-		var timestamp string
-		if err := db.db.QueryRow(VERSION_QUERY).Scan(&dbVersion, &description, &timestamp); err != nil {
-			return errors.New(fmt.Sprintf("error scanning row for current version, error: %v", err))
-		} else {
-			glog.V(3).Infof("Postgresql database tables are at version %v, %v, as of %v.", dbVersion, description, timestamp)
+		// Migrate the database tables if necessary, to the configured schema version or to the latest version supported
+		// by this code. In dry run mode, the migrations are verified and rolled back, and the agbot is stopped so that it
+		// does not run against a schema it does not expect.
+		if err := persistence.ValidateMigrations(migrations, v1, HIGHEST_DATABASE_VERSION); err != nil {
+			return err
 		}
 
-		if dbVersion < HIGHEST_DATABASE_VERSION {
-			glog.V(3).Infof("Postgresql database tables upgrading from version %v to %v.", dbVersion, HIGHEST_DATABASE_VERSION)
-
-			// Each new database version has it's own key in the migration SQL map.
-			for v := dbVersion + 1; v <= HIGHEST_DATABASE_VERSION; v++ {
-
-				// Run each SQL statement in the array of SQL statements for the current verion.
-				for si := 0; si < len(migrationSQL[v].sql); si++ {
-					if _, err := db.db.Exec(migrationSQL[v].sql[si]); err != nil {
-						return errors.New(fmt.Sprintf("unable to run SQL migration statement version %v, index %v, statement %v, error: %v", v, si, migrationSQL[v].sql[si], err))
-					} else if _, err := db.db.Exec(VERSION_UPDATE, HIGHEST_DATABASE_VERSION, migrationSQL[v].description); err != nil {
-						return errors.New(fmt.Sprintf("unable to create version table, error: %v", err))
-					} else {
-						glog.V(3).Infof("Postgresql database tables upgraded to version %v, %v", v, migrationSQL[v].description)
-					}
-				}
-			}
+		target, ok := cfg.AgreementBot.Postgresql.GetSchemaVersion()
+		if !ok {
+			target = persistence.LATEST_SCHEMA_VERSION
+		}
 
-			glog.V(3).Infof("Postgresql database tables upgraded to version %v", HIGHEST_DATABASE_VERSION)
+		if cfg.AgreementBot.Postgresql.MigrationDryRun {
+			if steps, err := db.migrateDryRun(target); err != nil {
+				return errors.New(fmt.Sprintf("schema migration dry run failed, error: %v", err))
+			} else if len(steps) != 0 {
+				return errors.New(fmt.Sprintf("schema migration dry run succeeded, the database was not changed, migrations to run: %v", persistence.StepsString(steps)))
+			}
+			glog.V(3).Infof("Postgresql database schema migration dry run found no migrations to run.")
+		} else if err := db.migrate(target); err != nil {
+			return errors.New(fmt.Sprintf("unable to migrate database schema, error: %v", err))
 		}
 
 		glog.V(3).Infof("Postgresql database tables initialized.")
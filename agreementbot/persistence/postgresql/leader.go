@@ -0,0 +1,160 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// Constants for the SQL statements that are used to elect a leader among the agbots sharing the database, see leader.go in
+// the persistence package. The leader is the agbot that holds a session level advisory lock. The lock is held on a dedicated
+// connection, so it is released by the database as soon as the leader's session ends, which lets another agbot take over on
+// its next attempt. The leader also records its lease in the leader table, which shows all the agbots who the leader is. The
+// leader renews the lease while it holds the lock, and gives up the lock when the lease cannot be renewed before it expires,
+// for example after the agbot was stalled, so that it does not keep running the singleton duties on a stale lease. The
+// leader table is created by schema migration 4.
+//
+// leader schema:
+// id:        Always 1.
+// holder:    The identity of the agbot that holds the lock.
+// partition: The primary partition of the agbot that holds the lock.
+// acquired:  A timestamp to record when the holder became the leader.
+// expires:   A timestamp to record when the lease expires if it is not renewed.
+//
+
+const LEADER_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS leader (
+	id int PRIMARY KEY CHECK (id = 1),
+	holder text NOT NULL,
+	partition text NOT NULL,
+	acquired timestamp with time zone NOT NULL,
+	expires timestamp with time zone NOT NULL
+);`
+
+const LEADER_DROP_MAIN_TABLE = `DROP TABLE IF EXISTS leader;`
+
+const LEADER_UPSERT = `INSERT INTO leader (id, holder, partition, acquired, expires)
+	VALUES (1, $1, $2, current_timestamp, current_timestamp + $3::int * interval '1 second')
+	ON CONFLICT (id) DO UPDATE SET holder = EXCLUDED.holder, partition = EXCLUDED.partition,
+		acquired = CASE WHEN leader.holder = EXCLUDED.holder THEN leader.acquired ELSE EXCLUDED.acquired END,
+		expires = EXCLUDED.expires;`
+
+// Renew the lease of the holder, if it has not expired.
+const LEADER_RENEW = `UPDATE leader SET partition = $2, expires = current_timestamp + $3::int * interval '1 second'
+	WHERE id = 1 AND holder = $1 AND expires > current_timestamp;`
+
+const LEADER_DELETE = `DELETE FROM leader WHERE holder = $1;`
+
+const LEADER_QUERY = `SELECT holder, partition, EXTRACT (EPOCH FROM acquired)::bigint, EXTRACT (EPOCH FROM expires)::bigint FROM leader WHERE expires > current_timestamp;`
+
+// The advisory lock that is held by the leader. It is different from the schema migration lock.
+const LEADER_LOCK_ID = 0x6c656164
+
+const LEADER_TRY_LOCK = `SELECT pg_try_advisory_lock($1);`
+
+const LEADER_UNLOCK = `SELECT pg_advisory_unlock($1);`
+
+// A lock on a single bigint key is reported in pg_locks with the low order 32 bits of the key in objid.
+const LEADER_LOCK_HELD = `SELECT EXISTS (SELECT 1 FROM pg_locks WHERE locktype = 'advisory' AND objid = $1 AND pid = pg_backend_pid() AND granted);`
+
+// Acquire the leader lock, or check that this agbot still holds it, and renew the lease. Returns false if another agbot
+// holds the lock. The leader steps down, and gives up the lock, if its lease has expired or cannot be renewed.
+func (db *AgbotPostgresqlDB) AcquireLeadership(leaseS uint64) (bool, error) {
+
+	db.leaderLock.Lock()
+	defer db.leaderLock.Unlock()
+
+	ctx := context.Background()
+	if db.leaderConn != nil {
+		// This agbot is the leader as long as the session that holds the lock is alive and the lease is renewed in time.
+		var held bool
+		if err := db.leaderConn.QueryRowContext(ctx, LEADER_LOCK_HELD, LEADER_LOCK_ID).Scan(&held); err != nil || !held {
+			db.closeLeaderConn()
+			return false, errors.New(fmt.Sprintf("Agbot %v lost the leader lock, held: %v, error: %v", db.identity, held, err))
+		}
+
+		if res, err := db.leaderConn.ExecContext(ctx, LEADER_RENEW, db.identity, db.PrimaryPartition(), leaseS); err != nil {
+			db.closeLeaderConn()
+			return false, errors.New(fmt.Sprintf("Agbot %v unable to renew the leader lease, error: %v", db.identity, err))
+		} else if num, err := res.RowsAffected(); err != nil {
+			db.closeLeaderConn()
+			return false, errors.New(fmt.Sprintf("Agbot %v unable to get the leader lease renewal result, error: %v", db.identity, err))
+		} else if num != 1 {
+			db.closeLeaderConn()
+			return false, errors.New(fmt.Sprintf("Agbot %v leader lease is stale, giving up the leader lock", db.identity))
+		}
+		return true, nil
+	}
+
+	conn, err := db.db.Conn(ctx)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("Agbot %v unable to get a connection for the leader lock, error: %v", db.identity, err))
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, LEADER_TRY_LOCK, LEADER_LOCK_ID).Scan(&locked); err != nil {
+		conn.Close()
+		return false, errors.New(fmt.Sprintf("Agbot %v unable to try the leader lock, error: %v", db.identity, err))
+	} else if !locked {
+		conn.Close()
+		return false, nil
+	}
+	db.leaderConn = conn
+
+	// The lease of the previous leader is replaced, it may not have expired yet if its session ended abruptly.
+	if _, err := db.leaderConn.ExecContext(ctx, LEADER_UPSERT, db.identity, db.PrimaryPartition(), leaseS); err != nil {
+		db.closeLeaderConn()
+		return false, errors.New(fmt.Sprintf("Agbot %v unable to record the leader lease, error: %v", db.identity, err))
+	}
+
+	glog.V(3).Infof("AgreementBot %v acquired the leader lock", db.identity)
+	return true, nil
+
+}
+
+func (db *AgbotPostgresqlDB) ReleaseLeadership() error {
+
+	db.leaderLock.Lock()
+	defer db.leaderLock.Unlock()
+
+	if db.leaderConn == nil {
+		return nil
+	}
+
+	_, err := db.leaderConn.ExecContext(context.Background(), LEADER_DELETE, db.identity)
+	db.closeLeaderConn()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Agbot %v unable to delete the leader lease, error: %v", db.identity, err))
+	}
+
+	glog.V(3).Infof("AgreementBot %v released leadership", db.identity)
+	return nil
+
+}
+
+// Returns nil if there is no leader or the lease has expired.
+func (db *AgbotPostgresqlDB) GetLeader() (*persistence.LeaderLease, error) {
+
+	lease := new(persistence.LeaderLease)
+	if err := db.db.QueryRow(LEADER_QUERY).Scan(&lease.Holder, &lease.Partition, &lease.Acquired, &lease.Expires); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.New(fmt.Sprintf("error scanning row for leader, error: %v", err))
+	}
+	return lease, nil
+
+}
+
+// Unlock the leader lock and give the connection back to the pool. The connection is pooled, so the lock has to be
+// unlocked explicitly. If the session has already ended, the unlock fails and the broken connection is discarded.
+// The caller must hold the leader lock mutex.
+func (db *AgbotPostgresqlDB) closeLeaderConn() {
+	var unlocked bool
+	if err := db.leaderConn.QueryRowContext(context.Background(), LEADER_UNLOCK, LEADER_LOCK_ID).Scan(&unlocked); err != nil {
+		glog.Warningf("Agbot %v unable to unlock the leader lock, error: %v", db.identity, err)
+	}
+	db.leaderConn.Close()
+	db.leaderConn = nil
+}
@@ -0,0 +1,168 @@
+package postgresql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// The ordered list of schema migrations. Versions must be contiguous, starting at v1 + 1 and ending at
+// HIGHEST_DATABASE_VERSION. Once a migration has been released it must never be changed, add a new migration instead.
+var migrations = []persistence.Migration{
+	{
+		Version: v2,
+		Name:    "add partition moves table",
+		Up:      []string{PARTITION_MOVES_CREATE_MAIN_TABLE},
+		Down:    []string{PARTITION_MOVES_DROP_MAIN_TABLE},
+	},
+	{
+		Version: v3,
+		Name:    "add rollouts table",
+		Up:      []string{ROLLOUTS_CREATE_MAIN_TABLE},
+		Down:    []string{ROLLOUTS_DROP_MAIN_TABLE},
+	},
+	{
+		Version: v4,
+		Name:    "add leader table",
+		Up:      []string{LEADER_CREATE_MAIN_TABLE},
+		Down:    []string{LEADER_DROP_MAIN_TABLE},
+	},
+}
+
+// Take the migration lock and return the current schema version, within the input transaction.
+func lockAndGetVersion(tx *sql.Tx) (int, error) {
+	var dbVersion int
+	var description string
+	var timestamp string
+	if _, err := tx.Exec(MIGRATION_LOCK, MIGRATION_LOCK_ID); err != nil {
+		return 0, errors.New(fmt.Sprintf("unable to obtain schema migration lock, error: %v", err))
+	} else if err := tx.QueryRow(VERSION_QUERY).Scan(&dbVersion, &description, &timestamp); err != nil {
+		return 0, errors.New(fmt.Sprintf("error scanning row for current version, error: %v", err))
+	} else {
+		glog.V(3).Infof("Postgresql database tables are at version %v, %v, as of %v.", dbVersion, description, timestamp)
+	}
+	return dbVersion, nil
+}
+
+// Run the statements of a migration step and record it in the version table and the migration history.
+func (db *AgbotPostgresqlDB) runMigrationStep(tx *sql.Tx, step persistence.MigrationStep) error {
+	for si, stmt := range step.Statements() {
+		if _, err := tx.Exec(stmt); err != nil {
+			return errors.New(fmt.Sprintf("unable to run SQL migration statement %v, index %v, statement %v, error: %v", step, si, stmt, err))
+		}
+	}
+
+	if _, err := tx.Exec(VERSION_UPDATE, step.ResultVersion(), step.Description()); err != nil {
+		return errors.New(fmt.Sprintf("unable to update version table, error: %v", err))
+	} else if _, err := tx.Exec(MIGRATION_HISTORY_INSERT, step.Migration.Version, step.Migration.Name, step.Direction, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("unable to insert migration history, error: %v", err))
+	}
+	return nil
+}
+
+// Migrate the database schema to the target version. Each migration runs in its own transaction while holding the migration
+// advisory lock, and the current version is re-read under the lock, so that when several agbots start at the same time only
+// one of them runs each migration.
+func (db *AgbotPostgresqlDB) migrate(target int) error {
+	for {
+		tx, err := db.db.Begin()
+		if err != nil {
+			return errors.New(fmt.Sprintf("unable to start schema migration transaction, error: %v", err))
+		}
+
+		dbVersion, err := lockAndGetVersion(tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		steps, err := persistence.PlanMigrations(migrations, dbVersion, target, HIGHEST_DATABASE_VERSION)
+		if err != nil {
+			tx.Rollback()
+			return err
+		} else if len(steps) == 0 {
+			return tx.Commit()
+		}
+
+		glog.V(3).Infof("Postgresql database tables migrating: %v", steps[0])
+		if err := db.runMigrationStep(tx, steps[0]); err != nil {
+			tx.Rollback()
+			return err
+		} else if err := tx.Commit(); err != nil {
+			return errors.New(fmt.Sprintf("unable to commit schema migration %v, error: %v", steps[0], err))
+		}
+		glog.V(3).Infof("Postgresql database tables migrated to version %v", steps[0].ResultVersion())
+	}
+}
+
+// Run all the migrations needed to reach the target version in a single transaction and then roll it back, so that the
+// migrations are verified against the real database without changing it. Returns the steps that would be run.
+func (db *AgbotPostgresqlDB) migrateDryRun(target int) ([]persistence.MigrationStep, error) {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to start schema migration transaction, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	dbVersion, err := lockAndGetVersion(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := persistence.PlanMigrations(migrations, dbVersion, target, HIGHEST_DATABASE_VERSION)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, step := range steps {
+		if err := db.runMigrationStep(tx, step); err != nil {
+			return nil, err
+		}
+		glog.V(3).Infof("Postgresql database tables dry run migration succeeded: %v", step)
+	}
+	return steps, nil
+}
+
+// Return the version of the database schema, the migrations needed to bring it to the latest version and the most
+// recent migration history.
+func (db *AgbotPostgresqlDB) GetSchemaStatus() (*persistence.SchemaStatus, error) {
+	status := &persistence.SchemaStatus{
+		Provider:      "postgresql",
+		LatestVersion: HIGHEST_DATABASE_VERSION,
+		Pending:       make([]string, 0),
+		History:       make([]persistence.SchemaMigration, 0),
+	}
+
+	if err := db.db.QueryRow(VERSION_QUERY).Scan(&status.CurrentVersion, &status.Description, &status.Updated); err != nil {
+		return nil, errors.New(fmt.Sprintf("error scanning row for current version, error: %v", err))
+	}
+
+	if steps, err := persistence.PlanMigrations(migrations, status.CurrentVersion, persistence.LATEST_SCHEMA_VERSION, HIGHEST_DATABASE_VERSION); err != nil {
+		return nil, err
+	} else {
+		for _, step := range steps {
+			status.Pending = append(status.Pending, step.Migration.Name)
+		}
+	}
+
+	rows, err := db.db.Query(MIGRATION_HISTORY_QUERY, MIGRATION_HISTORY_STATUS_LIMIT)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying migration history, error: %v", err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m persistence.SchemaMigration
+		if err := rows.Scan(&m.Version, &m.Name, &m.Direction, &m.Agbot, &m.Applied); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning migration history row, error: %v", err))
+		}
+		status.History = append(status.History, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating migration history, error: %v", err))
+	}
+	return status, nil
+}
@@ -0,0 +1,14 @@
+// +build unit
+
+package postgresql
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"testing"
+)
+
+func Test_migrations(t *testing.T) {
+	if err := persistence.ValidateMigrations(migrations, v1, HIGHEST_DATABASE_VERSION); err != nil {
+		t.Errorf("the released migrations are not valid: %v", err)
+	}
+}
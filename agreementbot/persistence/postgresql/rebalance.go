@@ -0,0 +1,215 @@
+package postgresql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"strings"
+)
+
+// Constants for the SQL statements that are used to hand off agreements from one partition to another, see partition.go in
+// the persistence package for a description of rebalancing. The partition_moves table is created by schema migration 1.
+//
+// partition_moves schema:
+// id:             The move id, serially incremented by the database when a new move is recorded.
+// from_partition: The partition that handed off the agreements.
+// to_partition:   The partition that received the agreements.
+// protocol:       The agreement protocol of the moved agreements.
+// agreements:     A JSON array of the moved agreement ids.
+// state:          The state of the move, see the PARTITION_MOVE_* constants in the persistence package.
+// started:        A timestamp to record when the agreements were handed off.
+// completed:      A timestamp to record when the agreements were adopted by the receiving agbot.
+//
+
+const PARTITION_MOVES_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS partition_moves (
+	id SERIAL PRIMARY KEY,
+	from_partition text NOT NULL,
+	to_partition text NOT NULL,
+	protocol text NOT NULL,
+	agreements jsonb NOT NULL,
+	state text NOT NULL,
+	started timestamp with time zone DEFAULT current_timestamp,
+	completed timestamp with time zone
+);`
+
+const PARTITION_MOVES_DROP_MAIN_TABLE = `DROP TABLE IF EXISTS partition_moves;`
+
+const PARTITION_MOVES_INSERT = `INSERT INTO partition_moves (from_partition, to_partition, protocol, agreements, state) VALUES ($1, $2, $3, $4, $5) RETURNING id;`
+
+const PARTITION_MOVES_QUERY = `SELECT id, from_partition, to_partition, protocol, agreements, state, EXTRACT (EPOCH FROM started), COALESCE(EXTRACT (EPOCH FROM completed), 0) FROM partition_moves
+	WHERE state = $1 OR completed > current_timestamp - make_interval(secs => $2) ORDER BY id;`
+
+const PARTITION_MOVES_COMPLETE = `UPDATE partition_moves SET state = $3, completed = current_timestamp WHERE id = $1 AND to_partition = $2 AND state = $4;`
+
+const PARTITION_MOVES_PRUNE = `DELETE FROM partition_moves WHERE state = $1 AND completed <= current_timestamp - make_interval(secs => $2);`
+
+// Moves that were handed off to a partition which is then taken over by another agbot are redirected to the new owner.
+const PARTITION_MOVES_REDIRECT = `UPDATE partition_moves SET to_partition = $2 WHERE to_partition = $1 AND state = $3;`
+
+// The receiving partition row is locked so that it cannot be claimed by another agbot while the agreements are handed off.
+const PARTITION_OWNER_LOCK = `SELECT owner FROM partitions WHERE id = $1 FOR SHARE;`
+
+const AGREEMENT_HAND_OFF = `WITH moved_rows AS (
+    DELETE FROM "agreements_ a WHERE a.agreement_id = $1 AND a.protocol = $2
+    RETURNING a.agreement_id, a.protocol, a.agreement
+)
+INSERT INTO "agreements_ (agreement_id, protocol, partition, agreement) SELECT agreement_id, protocol, $3, agreement FROM moved_rows;
+`
+
+const WORKLOAD_USAGE_HAND_OFF = `WITH moved_rows AS (
+    DELETE FROM "workload_usages_ a WHERE a.device_id = $1 AND a.policy_name = $2
+    RETURNING a.device_id, a.policy_name, a.workload_usage
+)
+INSERT INTO "workload_usages_ (device_id, policy_name, partition, workload_usage) SELECT device_id, policy_name, $3, workload_usage FROM moved_rows;
+`
+
+// The first table name in the hand off SQL is the partition that the records are moved from, the second is the partition that
+// they are moved to.
+func (db *AgbotPostgresqlDB) getAgreementHandOff(fromPartition string, toPartition string) string {
+	sql := strings.Replace(AGREEMENT_HAND_OFF, AGREEMENT_TABLE_NAME_ROOT, db.GetAgreementPartitionTableName(fromPartition), 1)
+	sql = strings.Replace(sql, `"`+AGREEMENT_TABLE_NAME_ROOT+` (`, `"`+db.GetAgreementPartitionTableName(toPartition)+` (`, 1)
+	return sql
+}
+
+func (db *AgbotPostgresqlDB) getWorkloadUsageHandOff(fromPartition string, toPartition string) string {
+	sql := strings.Replace(WORKLOAD_USAGE_HAND_OFF, WORKLOAD_USAGE_TABLE_NAME_ROOT, db.GetWorkloadUsagePartitionTableName(fromPartition), 1)
+	sql = strings.Replace(sql, `"`+WORKLOAD_USAGE_TABLE_NAME_ROOT+` (`, `"`+db.GetWorkloadUsagePartitionTableName(toPartition)+` (`, 1)
+	return sql
+}
+
+// Retrieve the heartbeat timestamp for a given partition. Zero is returned when the partition has no heartbeat.
+func (db *AgbotPostgresqlDB) GetPartitionHeartbeat(id string) (uint64, error) {
+
+	var hb sql.NullFloat64
+	if err := db.db.QueryRow(PARTITION_GET_HEARTBEAT, id).Scan(&hb); err != nil && err != sql.ErrNoRows {
+		return 0, errors.New(fmt.Sprintf("error scanning partition %v heartbeat result, error: %v", id, err))
+	}
+	return uint64(hb.Float64), nil
+}
+
+// Move the input agreements, and their workload usages, from our primary partition to the input partition. The receiving
+// partition must be owned by another agbot. Agreements that are no longer in our partition are skipped. Returns nil if no
+// agreements were moved.
+func (db *AgbotPostgresqlDB) HandOffAgreements(toPartition string, protocol string, agreementIds []string) (*persistence.PartitionMove, error) {
+
+	if toPartition == db.PrimaryPartition() {
+		return nil, errors.New(fmt.Sprintf("cannot hand off agreements to our own partition %v", toPartition))
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to start transaction for handing off agreements, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	var owner sql.NullString
+	if err := tx.QueryRow(PARTITION_OWNER_LOCK, toPartition).Scan(&owner); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to find partition %v, error: %v", toPartition, err))
+	} else if !owner.Valid {
+		return nil, errors.New(fmt.Sprintf("partition %v has no owner", toPartition))
+	}
+
+	agHandOff := db.getAgreementHandOff(db.PrimaryPartition(), toPartition)
+	wuHandOff := db.getWorkloadUsageHandOff(db.PrimaryPartition(), toPartition)
+
+	moved := make([]string, 0, len(agreementIds))
+	for _, agId := range agreementIds {
+		if ag, partition, err := db.internalFindSingleAgreementByAgreementId(tx, agId, protocol, []persistence.AFilter{}); err != nil {
+			return nil, err
+		} else if ag == nil || partition != db.PrimaryPartition() {
+			glog.V(5).Infof("AgreementBot %v skipping hand off of agreement %v, it is not in partition %v", db.identity, agId, db.PrimaryPartition())
+		} else if _, err := tx.Exec(agHandOff, agId, protocol, toPartition); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to hand off agreement %v, error: %v", agId, err))
+		} else if _, err := tx.Exec(wuHandOff, ag.DeviceId, ag.PolicyName, toPartition); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to hand off workload usage for agreement %v, error: %v", agId, err))
+		} else {
+			moved = append(moved, agId)
+		}
+	}
+
+	if len(moved) == 0 {
+		return nil, nil
+	}
+
+	agBytes, err := json.Marshal(moved)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to serialize moved agreement ids, error: %v", err))
+	}
+
+	var id string
+	if err := tx.QueryRow(PARTITION_MOVES_INSERT, db.PrimaryPartition(), toPartition, protocol, agBytes, persistence.PARTITION_MOVE_HANDED_OFF).Scan(&id); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to record partition move, error: %v", err))
+	} else if err := tx.Commit(); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to commit transaction for handing off agreements, error: %v", err))
+	}
+
+	glog.V(3).Infof("AgreementBot %v handed off %v agreements from partition %v to %v", db.identity, len(moved), db.PrimaryPartition(), toPartition)
+	return db.findPartitionMove(id)
+}
+
+// Return the moves that are in flight and the moves that completed recently.
+func (db *AgbotPostgresqlDB) FindPartitionMoves() ([]persistence.PartitionMove, error) {
+
+	moves := make([]persistence.PartitionMove, 0, 10)
+
+	rows, err := db.db.Query(PARTITION_MOVES_QUERY, persistence.PARTITION_MOVE_HANDED_OFF, persistence.PARTITION_MOVE_HISTORY_S)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for partition moves, error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var m persistence.PartitionMove
+		var agBytes []byte
+		var started, completed float64
+		if err := rows.Scan(&m.Id, &m.FromPartition, &m.ToPartition, &m.Protocol, &agBytes, &m.State, &started, &completed); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning partition move row, error: %v", err))
+		} else if err := json.Unmarshal(agBytes, &m.Agreements); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling partition move %v agreements, error: %v", m.Id, err))
+		}
+		m.Started = uint64(started)
+		m.Completed = uint64(completed)
+		moves = append(moves, m)
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating partition moves, error: %v", err))
+	}
+
+	return moves, nil
+}
+
+func (db *AgbotPostgresqlDB) findPartitionMove(id string) (*persistence.PartitionMove, error) {
+	if moves, err := db.FindPartitionMoves(); err != nil {
+		return nil, err
+	} else {
+		for i := range moves {
+			if moves[i].Id == id {
+				return &moves[i], nil
+			}
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("partition move %v not found", id))
+}
+
+// Record that we have adopted the agreements handed off to our partition, and remove old completed moves.
+func (db *AgbotPostgresqlDB) CompletePartitionMove(id string) error {
+
+	if res, err := db.db.Exec(PARTITION_MOVES_COMPLETE, id, db.PrimaryPartition(), persistence.PARTITION_MOVE_ADOPTED, persistence.PARTITION_MOVE_HANDED_OFF); err != nil {
+		return errors.New(fmt.Sprintf("unable to complete partition move %v, error: %v", id, err))
+	} else if num, err := res.RowsAffected(); err != nil {
+		return errors.New(fmt.Sprintf("error getting rows affected completing partition move %v, error: %v", id, err))
+	} else if num == 0 {
+		return errors.New(fmt.Sprintf("partition move %v to partition %v is not in flight", id, db.PrimaryPartition()))
+	}
+
+	if _, err := db.db.Exec(PARTITION_MOVES_PRUNE, persistence.PARTITION_MOVE_ADOPTED, persistence.PARTITION_MOVE_HISTORY_S); err != nil {
+		glog.Warningf("unable to remove old partition moves, error: %v", err)
+	}
+	return nil
+}
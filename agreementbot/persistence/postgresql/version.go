@@ -3,8 +3,8 @@ package postgresql
 import ()
 
 // Constants for the SQL statements that are used to work with the database version. The entire database schema has a single
-// version that is kept in the version table. Agbots automatically upgrade the database during initialization based on their version
-// and the version in the database.
+// version that is kept in the version table. Agbots automatically migrate the database during initialization based on their version
+// and the version in the database. See migration.go for the migrations that move the schema between versions.
 
 // version schema:
 // ver:     The current version of the database schema.
@@ -29,12 +29,41 @@ END $$`
 
 const VERSION_UPDATE = `UPDATE version SET ver = $1, description = $2, updated = current_timestamp WHERE id = 1;`
 
-const HIGHEST_DATABASE_VERSION = v1
-const v1 = 0
+// The history of every migration that has been applied to or reverted from the database.
+//
+// migration_history schema:
+// ver:       The schema version introduced by the migration.
+// name:      The name of the migration.
+// direction: Whether the migration was applied (up) or reverted (down).
+// agbot:     The identity of the agbot instance that ran the migration.
+// applied:   A timestamp to record when the migration ran.
+//
+const MIGRATION_HISTORY_CREATE_TABLE = `CREATE TABLE IF NOT EXISTS migration_history (
+	id serial PRIMARY KEY,
+	ver int NOT NULL,
+	name text NOT NULL,
+	direction text NOT NULL,
+	agbot text NOT NULL,
+	applied timestamp with time zone DEFAULT current_timestamp
+);`
 
-type SchemaUpdate struct {
-	sql         []string // The SQL statements to run for an update to the schema.
-	description string   // A description of the schema change.
-}
+const MIGRATION_HISTORY_INSERT = `INSERT INTO migration_history (ver, name, direction, agbot) VALUES ($1, $2, $3, $4);`
 
-var migrationSQL = map[int]SchemaUpdate{}
+const MIGRATION_HISTORY_QUERY = `SELECT ver, name, direction, agbot, applied FROM migration_history ORDER BY id DESC LIMIT $1;`
+
+// The number of history records returned in the schema status.
+const MIGRATION_HISTORY_STATUS_LIMIT = 10
+
+// The advisory lock that serializes schema migrations across all the agbot instances sharing the database. The
+// lock is a transaction level lock so that it is released when each migration commits or rolls back.
+const MIGRATION_LOCK_ID = 0x61676274
+
+const MIGRATION_LOCK = `SELECT pg_advisory_xact_lock($1);`
+
+// The initial version of the schema, created by the table definitions in this package. New schema versions are introduced
+// by adding a migration to the migrations list in migration.go and moving HIGHEST_DATABASE_VERSION to the new version.
+const HIGHEST_DATABASE_VERSION = v4
+const v1 = 0
+const v2 = 1
+const v3 = 2
+const v4 = 3
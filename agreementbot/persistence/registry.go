@@ -20,19 +20,29 @@ func Register(name string, db AgbotDatabase) {
 	DatabaseProviders[name] = db
 }
 
-// Initialize the underlying Agbot database depending on what is configured. If the bolt DB is configured, it is used. Next,
-// the postgresql config is checked and used if configured. If nothing is configured, an error is returned.
+// Initialize the underlying Agbot database depending on what is configured. The in memory database is an explicit opt-in
+// so it is checked first. If the bolt DB is configured, it is used. Next, the postgresql config is checked and used if configured,
+// followed by the embedded sqlite config. If nothing is configured, an error is returned. The returned database records the
+// agreement state transitions in the agreement event log.
 func InitDatabase(cfg *config.HorizonConfig) (AgbotDatabase, error) {
 
-	if cfg.IsBoltDBConfigured() {
-		dbObj := DatabaseProviders["bolt"]
-		return dbObj, dbObj.Initialize(cfg)
+	var dbObj AgbotDatabase
+	if cfg.IsMemoryDBConfigured() {
+		dbObj = DatabaseProviders["memory"]
+
+	} else if cfg.IsBoltDBConfigured() {
+		dbObj = DatabaseProviders["bolt"]
 
 	} else if cfg.IsPostgresqlConfigured() {
-		dbObj := DatabaseProviders["postgresql"]
-		return dbObj, dbObj.Initialize(cfg)
+		dbObj = DatabaseProviders["postgresql"]
+
+	} else if cfg.IsSqliteConfigured() {
+		dbObj = DatabaseProviders["sqlite"]
 
+	} else {
+		return nil, errors.New(fmt.Sprintf("neither bolt DB, Postgresql DB nor sqlite DB is configured correctly."))
 	}
-	return nil, errors.New(fmt.Sprintf("neither bolt DB nor Postgresql DB is configured correctly."))
+
+	return WithAgreementEvents(dbObj, AgreementEvents), dbObj.Initialize(cfg)
 
 }
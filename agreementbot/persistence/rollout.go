@@ -0,0 +1,33 @@
+package persistence
+
+import (
+	"fmt"
+)
+
+// A deployment policy with a rollout section is deployed to its compatible nodes in steps. The progress of each rollout is
+// kept in the database so that it survives an agbot restart. Rollouts are tracked per partition, each agbot applies the
+// rollout to the nodes that it finds and the agreements that it owns.
+
+const ROLLOUT_IN_PROGRESS = "in progress" // The rollout is waiting for the current step to meet the success criteria.
+const ROLLOUT_PAUSED = "paused"           // Too many agreements failed, no more nodes are added until the policy is changed.
+const ROLLOUT_COMPLETE = "complete"       // The last step includes all the compatible nodes.
+
+type RolloutState struct {
+	PolicyName    string `json:"policyName"`       // The fully qualified (org/name) deployment policy.
+	PolicyUpdated uint64 `json:"policyUpdated"`    // The time the policy last changed. A change restarts the rollout.
+	Step          int    `json:"step"`             // The current step, starting at 0.
+	StepStarted   uint64 `json:"stepStarted"`      // The time the current step started.
+	Nodes         int    `json:"nodes"`            // The number of compatible nodes found since the rollout started.
+	Limit         int    `json:"limit"`            // The number of nodes that can have an agreement in the current step.
+	Active        int    `json:"active"`           // The number of nodes that have an active agreement.
+	Succeeded     int    `json:"succeeded"`        // The number of active agreements that meet the success criteria.
+	Failed        int    `json:"failed"`           // The number of agreements that failed since the rollout started.
+	State         string `json:"state"`            // One of the ROLLOUT_* constants.
+	Reason        string `json:"reason,omitempty"` // Why the rollout is paused.
+	Updated       uint64 `json:"updated"`
+}
+
+func (r RolloutState) String() string {
+	return fmt.Sprintf("PolicyName: %v, PolicyUpdated: %v, Step: %v, StepStarted: %v, Nodes: %v, Limit: %v, Active: %v, Succeeded: %v, Failed: %v, State: %v, Reason: %v, Updated: %v",
+		r.PolicyName, r.PolicyUpdated, r.Step, r.StepStarted, r.Nodes, r.Limit, r.Active, r.Succeeded, r.Failed, r.State, r.Reason, r.Updated)
+}
@@ -0,0 +1,39 @@
+package persistence
+
+import (
+	"fmt"
+)
+
+// The schema status describes the version of the database schema used by the agbot, and any schema migrations
+// that have been run against the database. It is returned by the agbot's /status API. Providers that do not
+// version their schema return a nil status.
+type SchemaStatus struct {
+	Provider       string            `json:"provider"`
+	CurrentVersion int               `json:"currentVersion"`
+	LatestVersion  int               `json:"latestVersion"` // The highest schema version known to this agbot.
+	Description    string            `json:"description"`
+	Updated        string            `json:"updated"`
+	Pending        []string          `json:"pending,omitempty"` // Names of the migrations needed to reach the latest version.
+	History        []SchemaMigration `json:"history,omitempty"` // The most recent migrations run against the database.
+}
+
+func (s SchemaStatus) String() string {
+	return fmt.Sprintf("Provider: %v, CurrentVersion: %v, LatestVersion: %v, Description: %v, Updated: %v, Pending: %v, History: %v",
+		s.Provider, s.CurrentVersion, s.LatestVersion, s.Description, s.Updated, s.Pending, s.History)
+}
+
+// A record of a single schema migration that was applied to (or reverted from) the database.
+type SchemaMigration struct {
+	Version   int    `json:"version"`
+	Name      string `json:"name"`
+	Direction string `json:"direction"` // Either MIGRATION_UP or MIGRATION_DOWN.
+	Agbot     string `json:"agbot"`     // The identity of the agbot instance that ran the migration.
+	Applied   string `json:"applied"`
+}
+
+const MIGRATION_UP = "up"
+const MIGRATION_DOWN = "down"
+
+func (s SchemaMigration) String() string {
+	return fmt.Sprintf("Version: %v, Name: %v, Direction: %v, Agbot: %v, Applied: %v", s.Version, s.Name, s.Direction, s.Agbot, s.Applied)
+}
@@ -0,0 +1,390 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/policy"
+)
+
+// This function registers an uninitialized agbot DB instance with the DB plugin registry. The plugin's Initialize
+// method is used to configure the object.
+func init() {
+	persistence.Register("sqlite", new(AgbotSqliteDB))
+}
+
+// Constants for the SQL statements that are used to work with agreements. Agreements are partitioned by agbot instances in the
+// same way as the postgresql implementation, each agbot instance "owns" 1 partition in the database. Since sqlite is an embedded
+// database in a single file, there is no need for a table per partition. Instead, there is a single agreements table where each
+// row records the partition it belongs to. Moving a partition is simply an update of the partition column, and dropping a
+// partition is just a delete of the row in the partitions table.
+//
+// agreements schema:
+// agreement_id: The stringified agreement id for the agreement object in the record.
+// protocol:     The agreement protocol in use.
+// partition:    The agbot partition that this agreement lives in. This is used to divide up ownership of agreements to specific agbot instances.
+// agreement:    The agreement object which is a JSON blob. The blob schema is defined by the Agreement struct in the
+//               persistence package.
+// updated:      A timestamp (in seconds since the epoch) to record last updated time.
+//
+
+const AGREEMENT_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS agreements (
+	agreement_id TEXT NOT NULL,
+	protocol TEXT NOT NULL,
+	partition TEXT NOT NULL,
+	agreement TEXT NOT NULL,
+	updated INTEGER NOT NULL DEFAULT (CAST(strftime('%s','now') AS INTEGER)),
+	PRIMARY KEY (agreement_id, protocol)
+);`
+const AGREEMENT_CREATE_PARTITION_INDEX = `CREATE INDEX IF NOT EXISTS agreements_partition_index ON agreements (partition);`
+
+const AGREEMENT_QUERY = `SELECT agreement FROM agreements WHERE agreement_id = ?1 AND protocol = ?2 AND partition = ?3;`
+const ALL_AGREEMENTS_QUERY = `SELECT agreement FROM agreements WHERE protocol = ?1 AND partition = ?2;`
+
+// Count the active and archived agreements in the database, without reading the agreements.
+const AGREEMENT_COUNT = `SELECT COALESCE(SUM(CASE WHEN json_extract(agreement, '$.archived') THEN 0 ELSE 1 END), 0),
+	COALESCE(SUM(CASE WHEN json_extract(agreement, '$.archived') THEN 1 ELSE 0 END), 0)
+	FROM agreements WHERE partition = ?1;`
+
+const AGREEMENT_INSERT = `INSERT INTO agreements (agreement_id, protocol, partition, agreement) VALUES (?1, ?2, ?3, ?4);`
+const AGREEMENT_UPDATE = `UPDATE agreements SET agreement = ?3, updated = CAST(strftime('%s','now') AS INTEGER) WHERE agreement_id = ?1 AND protocol = ?2;`
+const AGREEMENT_DELETE = `DELETE FROM agreements WHERE agreement_id = ?1 AND protocol = ?2;`
+const AGREEMENT_PARTITION_DELETE = `DELETE FROM agreements WHERE agreement_id = ?1 AND protocol = ?2 AND partition = ?3;`
+
+const AGREEMENT_MOVE = `UPDATE agreements SET partition = ?2 WHERE partition = ?1;`
+
+const AGREEMENT_PARTITIONS = `SELECT DISTINCT partition FROM agreements;`
+
+// The fields in this object are initialized in the Initialize method in this package.
+type AgbotSqliteDB struct {
+	identity         string   // The identity of this agbot in the partitions table.
+	db               *sql.DB  // A handle to the underlying database.
+	primaryPartition string   // The partition to use when creating new agreements.
+	partitions       []string // The list of partitions this agbot is responsible to maintain.
+}
+
+func (db *AgbotSqliteDB) String() string {
+	return fmt.Sprintf("Instance: %v, PrimaryPartition: %v, All Partitions: %v, DB Handle: %v", db.identity, db.primaryPartition, db.partitions, db.db)
+}
+
+func (db *AgbotSqliteDB) PrimaryPartition() string {
+	return db.primaryPartition
+}
+
+func (db *AgbotSqliteDB) AllPartitions() []string {
+	return db.partitions
+}
+
+func (db *AgbotSqliteDB) FindAgreementPartitions() ([]string, error) {
+
+	// Find all the agreement partitions.
+	partitions := make([]string, 0, 10)
+	foundPrimary := false
+
+	rows, err := db.db.Query(AGREEMENT_PARTITIONS)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for agreement partitions: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var partition string
+		if err := rows.Scan(&partition); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
+		} else {
+			partitions = append(partitions, partition)
+			if partition == db.PrimaryPartition() {
+				foundPrimary = true
+			}
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
+	}
+
+	// Make sure the primary partition appears (even if it doesnt have any agreements yet), if it has not already been added
+	if !foundPrimary {
+		partitions = append(partitions, db.PrimaryPartition())
+	}
+
+	return partitions, nil
+}
+
+func (db *AgbotSqliteDB) GetAgreementCount(partition string) (int64, int64, error) {
+
+	var activeNum, archivedNum int64
+
+	if err := db.db.QueryRow(AGREEMENT_COUNT, partition).Scan(&activeNum, &archivedNum); err != nil {
+		return 0, 0, errors.New(fmt.Sprintf("error getting agreement counts, error: %v", err))
+	}
+
+	return activeNum, archivedNum, nil
+}
+
+// Retrieve all agreements owned by this agbot from the database and filter them out based on the input filters.
+func (db *AgbotSqliteDB) FindAgreements(filters []persistence.AFilter, protocol string) ([]persistence.Agreement, error) {
+
+	ags := make([]persistence.Agreement, 0, 100)
+
+	for _, currentPartition := range db.AllPartitions() {
+		if partitionAgs, err := db.FindAgreementsInPartition(currentPartition, filters, protocol); err != nil {
+			return nil, err
+		} else {
+			ags = append(ags, partitionAgs...)
+		}
+	}
+
+	return ags, nil
+
+}
+
+// Retrieve the agreements in a partition, whether or not it is owned by this agbot, and filter them based on the input filters.
+func (db *AgbotSqliteDB) FindAgreementsInPartition(partition string, filters []persistence.AFilter, protocol string) ([]persistence.Agreement, error) {
+
+	ags := make([]persistence.Agreement, 0, 100)
+
+	rows, err := db.db.Query(ALL_AGREEMENTS_QUERY, protocol, partition)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for agreements error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var agBytes []byte
+		ag := new(persistence.Agreement)
+		if err := rows.Scan(&agBytes); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
+		} else if err := json.Unmarshal(agBytes, ag); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(agBytes), err))
+		} else {
+			if !ag.Archived {
+				glog.V(5).Infof("Demarshalled agreement in partition %v from DB: %v", partition, ag)
+			}
+			if agPassed := persistence.RunFilters(ag, filters); agPassed != nil {
+				ags = append(ags, *ag)
+			}
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
+	}
+
+	return ags, nil
+}
+
+// Find a specific agreement in the partitions owned by this agbot.
+func (db *AgbotSqliteDB) internalFindSingleAgreementByAgreementId(tx *sql.Tx, agreementId string, protocol string, filters []persistence.AFilter) (*persistence.Agreement, string, error) {
+
+	for _, currentPartition := range db.AllPartitions() {
+
+		var agBytes []byte
+		var qerr error
+		if tx == nil {
+			qerr = db.db.QueryRow(AGREEMENT_QUERY, agreementId, protocol, currentPartition).Scan(&agBytes)
+		} else {
+			qerr = tx.QueryRow(AGREEMENT_QUERY, agreementId, protocol, currentPartition).Scan(&agBytes)
+		}
+
+		if qerr != nil && qerr != sql.ErrNoRows {
+			return nil, "", errors.New(fmt.Sprintf("error scanning row for agreement %v error: %v", agreementId, qerr))
+		} else if qerr == sql.ErrNoRows {
+			continue
+		}
+
+		ag := new(persistence.Agreement)
+		if err := json.Unmarshal(agBytes, ag); err != nil {
+			return nil, "", errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(agBytes), err))
+		} else if agPassed := persistence.RunFilters(ag, filters); agPassed == nil {
+			return nil, "", nil // Agreement ids are unique. If we found the one we want but the filters rejected it, then we're done.
+		} else {
+			return ag, currentPartition, nil
+		}
+	}
+	return nil, "", nil
+
+}
+
+func (db *AgbotSqliteDB) FindSingleAgreementByAgreementId(agreementId string, protocol string, filters []persistence.AFilter) (*persistence.Agreement, error) {
+	ag, _, err := db.internalFindSingleAgreementByAgreementId(nil, agreementId, protocol, filters)
+	return ag, err
+}
+
+func (db *AgbotSqliteDB) FindSingleAgreementByAgreementIdAllProtocols(agreementid string, protocols []string, filters []persistence.AFilter) (*persistence.Agreement, error) {
+	for _, protocol := range protocols {
+		if ag, err := db.FindSingleAgreementByAgreementId(agreementid, protocol, filters); err != nil {
+			return nil, err
+		} else if ag != nil {
+			return ag, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *AgbotSqliteDB) AgreementAttempt(agreementid string, org string, deviceid string, deviceType string, policyName string, bcType string, bcName string, bcOrg string, agreementProto string, pattern string, serviceId []string, nhPolicy policy.NodeHealth) error {
+	if agreement, err := persistence.NewAgreement(agreementid, org, deviceid, deviceType, policyName, bcType, bcName, bcOrg, agreementProto, pattern, serviceId, nhPolicy); err != nil {
+		return err
+	} else if err := db.insertAgreement(agreement, agreementProto); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (db *AgbotSqliteDB) AgreementFinalized(agreementId string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementFinalized(db, agreementId, protocol)
+}
+
+func (db *AgbotSqliteDB) AgreementUpdate(agreementid string, proposal string, policy string, dvPolicy policy.DataVerification, defaultCheckRate uint64, hash string, sig string, protocol string, agreementProtoVersion int) (*persistence.Agreement, error) {
+	return persistence.AgreementUpdate(db, agreementid, proposal, policy, dvPolicy, defaultCheckRate, hash, sig, protocol, agreementProtoVersion)
+}
+
+func (db *AgbotSqliteDB) AgreementMade(agreementId string, counterParty string, signature string, protocol string, hapartners []string, bcType string, bcName string, bcOrg string) (*persistence.Agreement, error) {
+	return persistence.AgreementMade(db, agreementId, counterParty, signature, protocol, hapartners, bcType, bcName, bcOrg)
+}
+
+func (db *AgbotSqliteDB) AgreementTimedout(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementTimedout(db, agreementid, protocol)
+}
+
+func (db *AgbotSqliteDB) AgreementBlockchainUpdate(agreementId string, consumerSig string, hash string, counterParty string, signature string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementBlockchainUpdate(db, agreementId, consumerSig, hash, counterParty, signature, protocol)
+}
+
+func (db *AgbotSqliteDB) AgreementBlockchainUpdateAck(agreementId string, protocol string) (*persistence.Agreement, error) {
+	return persistence.AgreementBlockchainUpdateAck(db, agreementId, protocol)
+}
+
+func (db *AgbotSqliteDB) DataVerified(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataVerified(db, agreementid, protocol)
+}
+
+func (db *AgbotSqliteDB) DataNotVerified(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataNotVerified(db, agreementid, protocol)
+}
+
+func (db *AgbotSqliteDB) DataNotification(agreementid string, protocol string) (*persistence.Agreement, error) {
+	return persistence.DataNotification(db, agreementid, protocol)
+}
+
+func (db *AgbotSqliteDB) MeteringNotification(agreementid string, protocol string, mn string) (*persistence.Agreement, error) {
+	return persistence.MeteringNotification(db, agreementid, protocol, mn)
+}
+
+func (db *AgbotSqliteDB) ArchiveAgreement(agreementid string, protocol string, reason uint, desc string) (*persistence.Agreement, error) {
+	return persistence.ArchiveAgreement(db, agreementid, protocol, reason, desc)
+}
+
+func (db *AgbotSqliteDB) DeleteAgreement(agreementid string, protocol string) error {
+	if res, err := db.db.Exec(AGREEMENT_DELETE, agreementid, protocol); err != nil {
+		return err
+	} else if num, err := res.RowsAffected(); err != nil {
+		return err
+	} else if num == 0 {
+		glog.Warningf("Warning: record deletion requested, but agreement %v does not exist", agreementid)
+	} else {
+		glog.V(5).Infof("Agreement %v deleted from database.", agreementid)
+	}
+	return nil
+}
+
+// Delete an agreement from a partition, whether or not it is owned by this agbot.
+func (db *AgbotSqliteDB) DeletePartitionAgreement(partition string, agreementid string, protocol string) error {
+	if res, err := db.db.Exec(AGREEMENT_PARTITION_DELETE, agreementid, protocol, partition); err != nil {
+		return err
+	} else if num, err := res.RowsAffected(); err != nil {
+		return err
+	} else if num == 0 {
+		glog.Warningf("Warning: record deletion requested, but agreement %v does not exist in partition %v", agreementid, partition)
+	} else {
+		glog.V(5).Infof("Agreement %v deleted from partition %v.", agreementid, partition)
+	}
+	return nil
+}
+
+func (db *AgbotSqliteDB) Close() {
+	glog.V(2).Infof("Closing sqlite database")
+	db.db.Close()
+	glog.V(2).Infof("Closed sqlite database")
+}
+
+// Utility functions used by the public functions in this package.
+
+// This function is used by all functions that want to change something in the database. It first locates the agreement
+// to be updated, then calls the input function to update the agreement in memory, and finally starts a transaction that
+// will actually perform the update.
+func (db *AgbotSqliteDB) SingleAgreementUpdate(agreementid string, protocol string, fn func(persistence.Agreement) *persistence.Agreement) (*persistence.Agreement, error) {
+	if agreement, err := db.FindSingleAgreementByAgreementId(agreementid, protocol, []persistence.AFilter{}); err != nil {
+		return nil, err
+	} else if agreement == nil {
+		return nil, errors.New(fmt.Sprintf("unable to locate agreement id: %v", agreementid))
+	} else {
+		updated := fn(*agreement)
+		return updated, db.wrapTransaction(agreementid, protocol, updated)
+	}
+}
+
+// This function is used to wrap a database transaction around an update to an agreement object.
+func (db *AgbotSqliteDB) wrapTransaction(agreementid string, protocol string, updated *persistence.Agreement) error {
+
+	if tx, err := db.db.Begin(); err != nil {
+		return err
+	} else if err := db.persistUpdatedAgreement(tx, agreementid, protocol, updated); err != nil {
+		tx.Rollback()
+		return err
+	} else {
+		return tx.Commit()
+	}
+
+}
+
+// This function runs inside a transaction. It will atomicly read the agreement from the DB, verify that the updated
+// agreement object contains valid state transitions, and then write the updated agreement back to the database.
+func (db *AgbotSqliteDB) persistUpdatedAgreement(tx *sql.Tx, agreementid string, protocol string, update *persistence.Agreement) error {
+
+	if mod, _, err := db.internalFindSingleAgreementByAgreementId(tx, agreementid, protocol, []persistence.AFilter{}); err != nil {
+		return err
+	} else if mod == nil {
+		return errors.New(fmt.Sprintf("No agreement with given id available to update: %v", agreementid))
+	} else {
+		// This code is running in a database transaction. Within the tx, the current record (mod) is
+		// read and then updated according to the updates within the input update record. It is critical
+		// to check for correct data transitions within the tx.
+		persistence.ValidateStateTransition(mod, update)
+		return db.updateAgreement(tx, mod, protocol)
+	}
+}
+
+func (db *AgbotSqliteDB) insertAgreement(ag *persistence.Agreement, protocol string) error {
+
+	if agm, err := json.Marshal(ag); err != nil {
+		return err
+	} else if _, err = db.db.Exec(AGREEMENT_INSERT, ag.CurrentAgreementId, protocol, db.PrimaryPartition(), string(agm)); err != nil {
+		return err
+	} else {
+		glog.V(2).Infof("Succeeded creating agreement record %v", *ag)
+	}
+
+	return nil
+}
+
+func (db *AgbotSqliteDB) updateAgreement(tx *sql.Tx, ag *persistence.Agreement, protocol string) error {
+
+	if agm, err := json.Marshal(ag); err != nil {
+		return err
+	} else if _, err = tx.Exec(AGREEMENT_UPDATE, ag.CurrentAgreementId, protocol, string(agm)); err != nil {
+		return err
+	} else {
+		glog.V(2).Infof("Succeeded writing agreement record %v", *ag)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"github.com/satori/go.uuid"
+	_ "modernc.org/sqlite"
+	"os"
+)
+
+// This function is called by the anax main to allow the configured database a chance to initialize itself. The database
+// file can be shared by several agbots (e.g. on a shared volume), so this function has to handle the case where another
+// agbot has already created the tables, possibly at an older schema version. The sqlite driver used by this package is
+// written in pure Go, so it works in the agbot built with CGO_ENABLED=0.
+func (db *AgbotSqliteDB) Initialize(cfg *config.HorizonConfig) error {
+
+	if err := os.MkdirAll(cfg.AgreementBot.Sqlite.DBPath, 0700); err != nil {
+		return errors.New(fmt.Sprintf("unable to create directory %v for sqlite DB configuration, error: %v", cfg.AgreementBot.Sqlite.DBPath, err))
+	}
+
+	connectInfo, trace := cfg.AgreementBot.Sqlite.MakeConnectionString()
+
+	glog.V(1).Infof("Connecting to sqlite database: %v", trace)
+
+	if sdb, err := sql.Open("sqlite", connectInfo); err != nil {
+		return errors.New(fmt.Sprintf("unable to open sqlite database, error: %v", err))
+	} else if err := sdb.Ping(); err != nil {
+		return errors.New(fmt.Sprintf("unable to ping sqlite database, error: %v", err))
+	} else {
+		db.db = sdb
+
+		// Initialize the DB instance fields.
+		if id, err := uuid.NewV4(); err != nil {
+			return errors.New(fmt.Sprintf("unable to get UUID identity for this agbot, error: %v", err))
+		} else {
+			db.identity = id.String()
+		}
+		glog.V(1).Infof("Agreementbot %v initializing partitions", db.identity)
+
+		// Now create the tables and initialize them as necessary.
+		glog.V(3).Infof("Sqlite database tables initializing.")
+
+		if err := db.createTables(); err != nil {
+			return err
+		}
+
+		// Claim a partition for ourselves.
+		if partition, err := db.ClaimPartition(cfg.GetPartitionStale()); err != nil {
+			return errors.New(fmt.Sprintf("unable to claim a partition, error: %v", err))
+		} else {
+			db.primaryPartition = partition
+			db.partitions = append(db.partitions, partition)
+		}
+
+		glog.V(3).Infof("Sqlite database tables initialized.")
+
+	}
+	return nil
+
+}
+
+// Create all the tables and indexes, and bring the schema up to the version supported by this code.
+func (db *AgbotSqliteDB) createTables() error {
+
+	// Create the version and migration history tables if necessary, and insert the current version row if necessary.
+	if _, err := db.db.Exec(VERSION_CREATE_TABLE); err != nil {
+		return errors.New(fmt.Sprintf("unable to create version table, error: %v", err))
+	} else if _, err := db.db.Exec(VERSION_INSERT); err != nil {
+		return errors.New(fmt.Sprintf("unable to insert singleton version row, error: %v", err))
+	} else if _, err := db.db.Exec(MIGRATION_HISTORY_CREATE_TABLE); err != nil {
+		return errors.New(fmt.Sprintf("unable to create migration history table, error: %v", err))
+	}
+
+	// Create the search session, partition, workload usage and agreement tables if necessary. These are the tables of the
+	// initial schema version, the tables added later are created by the schema migrations.
+	if _, err := db.db.Exec(SEARCH_SESSIONS_CREATE_MAIN_TABLE); err != nil {
+		return errors.New(fmt.Sprintf("unable to create search session table, error: %v", err))
+	} else if _, err := db.db.Exec(PARTITION_CREATE_MAIN_TABLE); err != nil {
+		return errors.New(fmt.Sprintf("unable to create partition table, error: %v", err))
+	} else if _, err := db.db.Exec(WORKLOAD_USAGE_CREATE_MAIN_TABLE); err != nil {
+		return errors.New(fmt.Sprintf("unable to create workload usage table, error: %v", err))
+	} else if _, err := db.db.Exec(WORKLOAD_USAGE_CREATE_PARTITION_INDEX); err != nil {
+		return errors.New(fmt.Sprintf("unable to create workload usage partition index, error: %v", err))
+	} else if _, err := db.db.Exec(AGREEMENT_CREATE_MAIN_TABLE); err != nil {
+		return errors.New(fmt.Sprintf("unable to create agreements table, error: %v", err))
+	} else if _, err := db.db.Exec(AGREEMENT_CREATE_PARTITION_INDEX); err != nil {
+		return errors.New(fmt.Sprintf("unable to create agreements partition index, error: %v", err))
+	}
+
+	// Migrate the database tables to the latest version supported by this code.
+	if err := persistence.ValidateMigrations(migrations, v1, HIGHEST_DATABASE_VERSION); err != nil {
+		return err
+	}
+	return db.migrate()
+}
@@ -0,0 +1,86 @@
+// +build unit
+
+package sqlite
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// The unit tests are run by the Makefile with CGO_ENABLED=0, the same as the agbot build, so this test makes sure that the
+// sqlite driver works without cgo and that the connection options are understood by the driver.
+func Test_Initialize_connection_options(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "agbot-sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &config.HorizonConfig{
+		AgreementBot: config.AGConfig{
+			Sqlite:         config.SqliteConfig{DBPath: dir, BusyTimeoutMS: 1234},
+			PartitionStale: 60,
+		},
+	}
+	db := new(AgbotSqliteDB)
+	if err := db.Initialize(cfg); err != nil {
+		t.Fatalf("unable to initialize sqlite database, error: %v", err)
+	}
+	defer db.Close()
+
+	var timeout int
+	if err := db.db.QueryRow(`PRAGMA busy_timeout;`).Scan(&timeout); err != nil {
+		t.Fatalf("unable to query the busy timeout, error: %v", err)
+	} else if timeout != 1234 {
+		t.Errorf("the busy timeout should be 1234, is %v", timeout)
+	}
+}
+
+// The schema is migrated to the latest version by numbered migrations, which are recorded in the history.
+func Test_Initialize_migrations(t *testing.T) {
+
+	if err := persistence.ValidateMigrations(migrations, v1, HIGHEST_DATABASE_VERSION); err != nil {
+		t.Errorf("the sqlite migrations are not valid: %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "agbot-sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db1 := newTestDB(t, dir)
+	defer db1.Close()
+
+	if status, err := db1.GetSchemaStatus(); err != nil {
+		t.Fatalf("unable to get the schema status, error: %v", err)
+	} else if status.CurrentVersion != HIGHEST_DATABASE_VERSION || len(status.Pending) != 0 {
+		t.Errorf("the schema should be at the latest version, is %v", status)
+	} else if len(status.History) != len(migrations) || status.History[0].Name != "add leader table" || status.History[0].Agbot != db1.identity {
+		t.Errorf("the history should record each migration, is %v", status.History)
+	}
+
+	// Simulate a database file created before the leader table was added, a second agbot migrates it.
+	if _, err := db1.db.Exec(`DROP TABLE leader;`); err != nil {
+		t.Fatal(err)
+	} else if _, err := db1.db.Exec(VERSION_UPDATE, v3, "add rollouts table"); err != nil {
+		t.Fatal(err)
+	}
+
+	db2 := newTestDB(t, dir)
+	defer db2.Close()
+
+	if status, err := db2.GetSchemaStatus(); err != nil {
+		t.Fatalf("unable to get the schema status, error: %v", err)
+	} else if status.CurrentVersion != HIGHEST_DATABASE_VERSION || len(status.History) != len(migrations)+1 {
+		t.Errorf("the schema should be migrated to the latest version, is %v", status)
+	} else if status.History[0].Version != v4 || status.History[0].Agbot != db2.identity {
+		t.Errorf("the history should record the migration by the second agbot, is %v", status.History[0])
+	} else if _, err := db2.db.Exec(`SELECT COUNT(*) FROM leader;`); err != nil {
+		t.Errorf("the leader table should be created by the migration, error: %v", err)
+	}
+}
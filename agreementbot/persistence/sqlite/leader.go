@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// Constants for the SQL statements that are used to elect a leader among the agbots sharing the database file, see leader.go
+// in the persistence package. There is at most 1 row in the leader table. An agbot becomes the leader when there is no row,
+// when it already holds the lease, or when the lease has expired. Each statement runs atomically, so only 1 agbot can take
+// over an expired lease.
+//
+// leader schema:
+// id:        Always 1.
+// holder:    The identity of the agbot that holds the lease.
+// partition: The primary partition of the agbot that holds the lease.
+// acquired:  The time (in seconds since the epoch) when the holder became the leader.
+// expires:   The time (in seconds since the epoch) when the lease expires if it is not renewed.
+//
+
+const LEADER_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS leader (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	holder TEXT NOT NULL,
+	partition TEXT NOT NULL,
+	acquired INTEGER NOT NULL,
+	expires INTEGER NOT NULL
+);`
+
+const LEADER_ACQUIRE = `INSERT INTO leader (id, holder, partition, acquired, expires)
+	VALUES (1, ?1, ?2, CAST(strftime('%s','now') AS INTEGER), CAST(strftime('%s','now') AS INTEGER) + ?3)
+	ON CONFLICT (id) DO UPDATE SET holder = ?1, partition = ?2,
+		acquired = CASE WHEN leader.holder = ?1 THEN leader.acquired ELSE CAST(strftime('%s','now') AS INTEGER) END,
+		expires = CAST(strftime('%s','now') AS INTEGER) + ?3
+	WHERE leader.holder = ?1 OR leader.expires <= CAST(strftime('%s','now') AS INTEGER);`
+
+const LEADER_RELEASE = `DELETE FROM leader WHERE holder = ?1;`
+
+const LEADER_QUERY = `SELECT holder, partition, acquired, expires FROM leader WHERE expires > CAST(strftime('%s','now') AS INTEGER);`
+
+// Acquire or renew the lease. Returns false if another agbot holds an unexpired lease.
+func (db *AgbotSqliteDB) AcquireLeadership(leaseS uint64) (bool, error) {
+
+	if res, err := db.db.Exec(LEADER_ACQUIRE, db.identity, db.PrimaryPartition(), leaseS); err != nil {
+		return false, errors.New(fmt.Sprintf("Agbot %v unable to acquire leadership, error: %v", db.identity, err))
+	} else if num, err := res.RowsAffected(); err != nil {
+		return false, errors.New(fmt.Sprintf("Agbot %v unable to get leadership result, error: %v", db.identity, err))
+	} else {
+		return num == 1, nil
+	}
+
+}
+
+func (db *AgbotSqliteDB) ReleaseLeadership() error {
+
+	if _, err := db.db.Exec(LEADER_RELEASE, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("Agbot %v unable to release leadership, error: %v", db.identity, err))
+	} else {
+		glog.V(3).Infof("AgreementBot %v released leadership", db.identity)
+	}
+	return nil
+
+}
+
+// Returns nil if there is no leader or the lease has expired.
+func (db *AgbotSqliteDB) GetLeader() (*persistence.LeaderLease, error) {
+
+	lease := new(persistence.LeaderLease)
+	if err := db.db.QueryRow(LEADER_QUERY).Scan(&lease.Holder, &lease.Partition, &lease.Acquired, &lease.Expires); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.New(fmt.Sprintf("error scanning row for leader, error: %v", err))
+	}
+	return lease, nil
+
+}
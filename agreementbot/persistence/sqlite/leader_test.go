@@ -0,0 +1,54 @@
+// +build unit
+
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func Test_leader_election(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "agbot-sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Two agbots sharing the database file.
+	db1 := newTestDB(t, dir)
+	defer db1.Close()
+	db2 := newTestDB(t, dir)
+	defer db2.Close()
+
+	if leader, err := db1.AcquireLeadership(30); err != nil || !leader {
+		t.Fatalf("db1 should become the leader, leader: %v, error: %v", leader, err)
+	} else if leader, err := db2.AcquireLeadership(30); err != nil || leader {
+		t.Fatalf("db2 should not become the leader while db1 holds the lease, leader: %v, error: %v", leader, err)
+	} else if lease, err := db2.GetLeader(); err != nil || lease == nil || lease.Holder != db1.identity || lease.Partition != db1.PrimaryPartition() {
+		t.Fatalf("db2 should see db1 as the leader, lease: %v, error: %v", lease, err)
+	}
+
+	// A lease that is not renewed expires, and another agbot takes over.
+	if leader, err := db1.AcquireLeadership(0); err != nil || !leader {
+		t.Fatalf("db1 should renew its lease, leader: %v, error: %v", leader, err)
+	} else if lease, err := db2.GetLeader(); err != nil || lease != nil {
+		t.Fatalf("the lease should have expired, lease: %v, error: %v", lease, err)
+	} else if leader, err := db2.AcquireLeadership(30); err != nil || !leader {
+		t.Fatalf("db2 should take over the expired lease, leader: %v, error: %v", leader, err)
+	} else if leader, err := db1.AcquireLeadership(30); err != nil || leader {
+		t.Fatalf("db1 should not get the lease back, leader: %v, error: %v", leader, err)
+	}
+
+	// The leader gives up the lease when it quiesces.
+	if err := db1.ReleaseLeadership(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if lease, err := db1.GetLeader(); err != nil || lease == nil || lease.Holder != db2.identity {
+		t.Fatalf("releasing a lease that is not held should not change the leader, lease: %v, error: %v", lease, err)
+	} else if err := db2.ReleaseLeadership(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if leader, err := db1.AcquireLeadership(30); err != nil || !leader {
+		t.Fatalf("db1 should become the leader after db2 released the lease, leader: %v, error: %v", leader, err)
+	}
+}
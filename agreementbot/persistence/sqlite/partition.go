@@ -0,0 +1,247 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"strconv"
+)
+
+// Constants for the SQL statements that are used to work with partitions. The partition semantics are the same as in the
+// postgresql implementation. Each agbot owns a single partition and identifies itself with an instance id (uuid) that is created
+// every time the agbot starts. Agbots sharing the same database file periodically scan the partition table looking for partitions
+// that are no longer being used by an agbot, either because the owner quiesced or because it terminated suddenly and stopped
+// heartbeating within the "stale" timeout. Running agbots take ownership of these partitions and move the agreement related
+// records into their own partition.
+//
+// Sqlite serializes writers with a database wide lock. The connection string used by this package causes every transaction to
+// take that lock when it begins, which is what makes the claim of an unowned partition atomic across agbot processes.
+//
+// partitions schema:
+// id:        The partition id, incremented by the database when a new partition is created.
+// owner:     The UUID of the agbot that owns this partition. NULL means that the previous owner quiesced so the partition is
+//            available to be taken over immediately.
+// heartbeat: The time (in seconds since the epoch) of the last heartbeat. If the owning agbot stops heartbeating, the partition
+//            becomes eligible to be taken over by another agbot.
+//
+
+const PARTITION_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS partitions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner TEXT,
+	heartbeat INTEGER
+);`
+
+const PARTITION_OWNER = `SELECT owner FROM partitions WHERE id = ?1;`
+
+const PARTITION_ALL = `SELECT id FROM partitions;`
+
+const PARTITION_INSERT = `INSERT INTO partitions (owner, heartbeat) VALUES (?1, CAST(strftime('%s','now') AS INTEGER));`
+
+const PARTITION_HEARTBEAT = `UPDATE partitions SET heartbeat = CAST(strftime('%s','now') AS INTEGER) WHERE id = ?1 AND owner = ?2;`
+
+const PARTITION_GET_HEARTBEAT = `SELECT heartbeat FROM partitions WHERE id = ?1;`
+
+const PARTITION_QUIESCE = `UPDATE partitions SET owner = NULL, heartbeat = NULL WHERE owner = ?1;`
+
+const PARTITION_DELETE = `DELETE FROM partitions WHERE id = ?1;`
+
+// Find a partition that has no owner, or whose owner has not heartbeated within the timeout. A partition owned by the caller
+// is never returned, even when the caller's own heartbeat is late.
+const PARTITION_FIND_UNOWNED = `SELECT id FROM partitions
+	WHERE
+		(owner IS NULL AND heartbeat IS NULL)
+		OR
+		(owner IS NOT NULL AND owner != ?1 AND (CAST(strftime('%s','now') AS INTEGER) - heartbeat) > ?2)
+	LIMIT 1;`
+
+const PARTITION_CLAIM = `UPDATE partitions SET owner = ?2, heartbeat = CAST(strftime('%s','now') AS INTEGER) WHERE id = ?1;`
+
+// Functions related to partitions in the sqlite database. The workload usages should always be using the same partitions
+// as the agreements.
+
+// Look for an ownerless or stale partition. If none exist, create a new partition.
+func (db *AgbotSqliteDB) ClaimPartition(timeout uint64) (string, error) {
+
+	if unownedPartition, err := db.findUnownedPartition(timeout); err != nil {
+		return "", errors.New(fmt.Sprintf("unable to claim an unowned partition, error: %v", err))
+	} else if unownedPartition != "" {
+		return unownedPartition, nil
+	}
+
+	// There were no claimable partitions, so create a new partition.
+	if res, err := db.db.Exec(PARTITION_INSERT, db.identity); err != nil {
+		return "", errors.New(fmt.Sprintf("AgreementBot %v unable to insert new partition, error: %v", db.identity, err))
+	} else if id, err := res.LastInsertId(); err != nil {
+		return "", errors.New(fmt.Sprintf("AgreementBot %v unable to get new partition id, error: %v", db.identity, err))
+	} else {
+		glog.V(5).Infof("AgreementBot %v creating new partition %v", db.identity, id)
+		return strconv.FormatInt(id, 10), nil
+	}
+}
+
+// Find and claim an unowned partition. The find and the claim run in the same transaction so that no other agbot can claim
+// the same partition. An empty string is returned when there are no partitions to claim.
+func (db *AgbotSqliteDB) findUnownedPartition(timeout uint64) (string, error) {
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("unable to start transaction, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow(PARTITION_FIND_UNOWNED, db.identity, timeout).Scan(&id); err != nil && err != sql.ErrNoRows {
+		return "", errors.New(fmt.Sprintf("unable to find stale partition, error: %v", err))
+	} else if err == sql.ErrNoRows {
+		// There were no partitions to be claimed.
+		return "", tx.Commit()
+	} else if _, err := tx.Exec(PARTITION_CLAIM, id, db.identity); err != nil {
+		return "", errors.New(fmt.Sprintf("unable to claim partition %v, error: %v", id, err))
+	} else if err := tx.Commit(); err != nil {
+		return "", errors.New(fmt.Sprintf("unable to commit claim on unowned partition %v, error: %v", id, err))
+	}
+
+	glog.Infof("AgreementBot %v claimed partition %v", db.identity, id)
+	return strconv.FormatInt(id, 10), nil
+}
+
+// Locate all the partitions currently found in the database, for all agbots. This includes partitions that are known to the
+// partitions table but have no agreements in them yet.
+func (db *AgbotSqliteDB) FindPartitions() ([]string, error) {
+
+	allPartitions, err := db.FindAgreementPartitions()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.db.Query(PARTITION_ALL)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for partitions: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning partition row: %v", err))
+		}
+
+		partition := strconv.FormatInt(id, 10)
+		found := false
+		for _, p := range allPartitions {
+			if p == partition {
+				found = true
+				break
+			}
+		}
+		if !found {
+			allPartitions = append(allPartitions, partition)
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating partitions: %v", err))
+	}
+
+	return allPartitions, nil
+
+}
+
+// Retrieve the partition owner for a given partition.
+func (db *AgbotSqliteDB) GetPartitionOwner(id string) (string, error) {
+
+	var owner sql.NullString
+	if err := db.db.QueryRow(PARTITION_OWNER, id).Scan(&owner); err == sql.ErrNoRows {
+		return persistence.PARTITION_NO_OWNER, nil
+	} else if err != nil {
+		return "", errors.New(fmt.Sprintf("error scanning partition %v owner result, error: %v", id, err))
+	} else if !owner.Valid {
+		return persistence.PARTITION_NO_OWNER, nil
+	} else {
+		return owner.String, nil
+	}
+
+}
+
+// Update the hearbeat for our partition.
+func (db *AgbotSqliteDB) HeartbeatPartition() error {
+
+	if res, err := db.db.Exec(PARTITION_HEARTBEAT, db.PrimaryPartition(), db.identity); err != nil {
+		return errors.New(fmt.Sprintf("AgreementBot %v unable to heartbeat, error: %v", db.identity, err))
+	} else if num, err := res.RowsAffected(); err != nil {
+		return errors.New(fmt.Sprintf("AgreementBot %v error getting rows affected, error: %v", db.identity, err))
+	} else if num == 0 {
+		msg := fmt.Sprintf("AgreementBot %v heartbeat to partition %v failed to update any rows, assuming the partition has been stolen due to previously missing heartbeats.", db.identity, db.PrimaryPartition())
+		glog.Errorf(msg)
+		panic(msg)
+	} else if num != 1 {
+		return errors.New(fmt.Sprintf("AgreementBot %v, heartbeat update should have changed 1 row, but changed %v", db.identity, num))
+	} else {
+		glog.V(3).Infof("AgreementBot %v heartbeat", db.identity)
+	}
+	return nil
+}
+
+// Retrieve the heartbeat timestamp for our partition.
+func (db *AgbotSqliteDB) GetHeartbeat() (uint64, error) {
+
+	var hb sql.NullInt64
+	if err := db.db.QueryRow(PARTITION_GET_HEARTBEAT, db.PrimaryPartition()).Scan(&hb); err != nil {
+		return 0, errors.New(fmt.Sprintf("error scanning partition %v heartbeat result, error: %v", db.PrimaryPartition(), err))
+	} else {
+		return uint64(hb.Int64), nil
+	}
+}
+
+// Quiesce our partition.
+func (db *AgbotSqliteDB) QuiescePartition() error {
+
+	if _, err := db.db.Exec(PARTITION_QUIESCE, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("Agbot %v unable to quiesce partition, error: %v", db.identity, err))
+	} else {
+		glog.V(3).Infof("AgreementBot %v quiesced partition", db.identity)
+	}
+	return nil
+}
+
+// Move all records from one partition to another if there is a stale or unowned partition in the database.
+func (db *AgbotSqliteDB) MovePartition(timeout uint64) (bool, error) {
+
+	if fromPartition, err := db.findUnownedPartition(timeout); err != nil {
+		return false, err
+	} else if fromPartition == "" {
+		glog.V(3).Infof("AgreementBot %v did not find an unowned database partition.", db.identity)
+		return false, nil
+	} else {
+		// We have found a partition and we have claimed it so no other agbot can grab it now. Move all the agreement related
+		// records in the partition into our primary partition and remove the partition row from the partitions table. This is
+		// all done under a single transaction so that if the agbot were to terminate during this time, another agbot will
+		// eventually claim this partition and attempt this same cleanup again.
+		tx, err := db.db.Begin()
+		if err != nil {
+			return false, errors.New(fmt.Sprintf("unable to start transaction for moving agreements, error: %v", err))
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(AGREEMENT_MOVE, fromPartition, db.PrimaryPartition()); err != nil {
+			return false, err
+		} else if _, err := tx.Exec(WORKLOAD_USAGE_MOVE, fromPartition, db.PrimaryPartition()); err != nil {
+			return false, err
+		} else if _, err := tx.Exec(PARTITION_MOVES_REDIRECT, fromPartition, db.PrimaryPartition(), persistence.PARTITION_MOVE_HANDED_OFF); err != nil {
+			return false, err
+		} else if _, err := tx.Exec(ROLLOUTS_DELETE_PARTITION, fromPartition); err != nil {
+			return false, err
+		} else if _, err := tx.Exec(PARTITION_DELETE, fromPartition); err != nil {
+			return false, err
+		} else if err := tx.Commit(); err != nil {
+			return false, errors.New(fmt.Sprintf("unable to commit transaction for moving agreements, error: %v", err))
+		}
+		glog.V(3).Infof("AgreementBot %v moved agreements from partition %v to %v", db.identity, fromPartition, db.PrimaryPartition())
+	}
+	// We found a partition and moved all the records.
+	return true, nil
+}
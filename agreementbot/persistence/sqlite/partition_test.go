@@ -0,0 +1,249 @@
+// +build unit
+
+package sqlite
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/policy"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const testProtocol = policy.BasicProtocol
+
+func newTestDB(t *testing.T, dir string) *AgbotSqliteDB {
+	cfg := &config.HorizonConfig{
+		AgreementBot: config.AGConfig{
+			Sqlite:         config.SqliteConfig{DBPath: dir},
+			PartitionStale: 60,
+		},
+	}
+	db := new(AgbotSqliteDB)
+	if err := db.Initialize(cfg); err != nil {
+		t.Fatalf("unable to initialize sqlite database, error: %v", err)
+	}
+	return db
+}
+
+func Test_agreement_lifecycle(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "agbot-sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := newTestDB(t, dir)
+	defer db.Close()
+
+	if err := db.AgreementAttempt("ag1", "myorg", "myorg/dev1", "device", "myorg/pol1", "", "", "", testProtocol, "", []string{}, policy.NodeHealth{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := db.AgreementUpdate("ag1", "proposal", "policy", policy.DataVerification{}, 10, "hash", "sig", testProtocol, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ag, err := db.AgreementFinalized("ag1", testProtocol); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ag.AgreementFinalizedTime == 0 {
+		t.Errorf("agreement should be finalized: %v", ag)
+	} else if _, err := db.ArchiveAgreement("ag1", testProtocol, 5, "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ag, err := db.FindSingleAgreementByAgreementId("ag1", testProtocol, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ag == nil || !ag.Archived || ag.Proposal != "proposal" || ag.TerminatedReason != 5 {
+		t.Errorf("agreement was not updated correctly: %v", ag)
+	} else if active, archived, err := db.GetAgreementCount(db.PrimaryPartition()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if active != 0 || archived != 1 {
+		t.Errorf("expected 0 active and 1 archived agreement, got %v and %v", active, archived)
+	} else if err := db.DeleteAgreement("ag1", testProtocol); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ags, err := db.FindAgreements(nil, testProtocol); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(ags) != 0 {
+		t.Errorf("expected no agreements, got %v", ags)
+	}
+
+}
+
+func Test_partition_quiesce_and_move(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "agbot-sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Two agbots sharing the same database file each get their own partition.
+	db1 := newTestDB(t, dir)
+	defer db1.Close()
+	db2 := newTestDB(t, dir)
+	defer db2.Close()
+
+	if db1.PrimaryPartition() == db2.PrimaryPartition() {
+		t.Fatalf("agbots should own different partitions, both own %v", db1.PrimaryPartition())
+	} else if owner, err := db1.GetPartitionOwner(db2.PrimaryPartition()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if owner != db2.identity {
+		t.Errorf("partition %v should be owned by %v, is owned by %v", db2.PrimaryPartition(), db2.identity, owner)
+	}
+
+	// Agreements made by one agbot are not visible to the other.
+	if err := db1.AgreementAttempt("ag1", "myorg", "myorg/dev1", "device", "myorg/pol1", "", "", "", testProtocol, "", []string{}, policy.NodeHealth{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := db1.NewWorkloadUsage("myorg/dev1", []string{}, "", "myorg/pol1", 1, 60, 60, false, "ag1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ag, err := db2.FindSingleAgreementByAgreementId("ag1", testProtocol, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ag != nil {
+		t.Errorf("agreement %v should not be visible in partition %v", ag, db2.PrimaryPartition())
+	}
+
+	// Nothing to move while both agbots are heartbeating.
+	if err := db1.HeartbeatPartition(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if moved, err := db2.MovePartition(60); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if moved {
+		t.Errorf("no partition should have been moved")
+	}
+
+	// Once the first agbot quiesces, the second agbot takes over its agreements and workload usages.
+	if err := db1.QuiescePartition(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if moved, err := db2.MovePartition(60); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !moved {
+		t.Errorf("the quiesced partition should have been moved")
+	} else if ag, err := db2.FindSingleAgreementByAgreementId("ag1", testProtocol, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ag == nil {
+		t.Errorf("agreement ag1 should have moved to partition %v", db2.PrimaryPartition())
+	} else if wu, err := db2.FindSingleWorkloadUsageByDeviceAndPolicyName("myorg/dev1", "myorg/pol1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if wu == nil {
+		t.Errorf("workload usage should have moved to partition %v", db2.PrimaryPartition())
+	} else if partitions, err := db2.FindPartitions(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(partitions) != 1 || partitions[0] != db2.PrimaryPartition() {
+		t.Errorf("expected only partition %v, got %v", db2.PrimaryPartition(), partitions)
+	}
+
+}
+
+func Test_partition_hand_off(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "agbot-sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db1 := newTestDB(t, dir)
+	defer db1.Close()
+	db2 := newTestDB(t, dir)
+	defer db2.Close()
+
+	for _, agId := range []string{"ag1", "ag2"} {
+		if err := db1.AgreementAttempt(agId, "myorg", "myorg/dev-"+agId, "device", "myorg/pol1", "", "", "", testProtocol, "", []string{}, policy.NodeHealth{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if err := db1.NewWorkloadUsage("myorg/dev-"+agId, []string{}, "", "myorg/pol1", 1, 60, 60, false, agId); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Agreements cannot be handed off to our own partition.
+	if _, err := db1.HandOffAgreements(db1.PrimaryPartition(), testProtocol, []string{"ag1"}); err == nil {
+		t.Errorf("hand off to our own partition should fail")
+	}
+
+	// Unknown agreements are skipped.
+	move, err := db1.HandOffAgreements(db2.PrimaryPartition(), testProtocol, []string{"ag1", "unknown"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if move == nil || move.State != persistence.PARTITION_MOVE_HANDED_OFF || len(move.Agreements) != 1 || move.Agreements[0] != "ag1" {
+		t.Fatalf("unexpected move %v", move)
+	} else if move.FromPartition != db1.PrimaryPartition() || move.ToPartition != db2.PrimaryPartition() || move.Started == 0 {
+		t.Errorf("unexpected move %v", move)
+	}
+
+	// The agreement and its workload usage are now in the receiving partition.
+	if ag, err := db1.FindSingleAgreementByAgreementId("ag1", testProtocol, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ag != nil {
+		t.Errorf("agreement ag1 should have been handed off")
+	} else if ag, err := db2.FindSingleAgreementByAgreementId("ag1", testProtocol, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ag == nil {
+		t.Errorf("agreement ag1 should be in partition %v", db2.PrimaryPartition())
+	} else if wu, err := db2.FindSingleWorkloadUsageByDeviceAndPolicyName("myorg/dev-ag1", "myorg/pol1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if wu == nil {
+		t.Errorf("workload usage should be in partition %v", db2.PrimaryPartition())
+	} else if ag, err := db1.FindSingleAgreementByAgreementId("ag2", testProtocol, nil); err != nil || ag == nil {
+		t.Errorf("agreement ag2 should not have moved, error: %v", err)
+	}
+
+	// Nothing is recorded when no agreements are moved.
+	if move, err := db1.HandOffAgreements(db2.PrimaryPartition(), testProtocol, []string{"ag1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if move != nil {
+		t.Errorf("no move expected, got %v", move)
+	}
+
+	// Only the receiving agbot can complete the move.
+	if err := db1.CompletePartitionMove(move.Id); err == nil {
+		t.Errorf("the sending agbot should not be able to complete the move")
+	} else if err := db2.CompletePartitionMove(move.Id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if moves, err := db1.FindPartitionMoves(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(moves) != 1 || moves[0].State != persistence.PARTITION_MOVE_ADOPTED || moves[0].Completed == 0 {
+		t.Errorf("expected the completed move, got %v", moves)
+	} else if err := db2.CompletePartitionMove(move.Id); err == nil {
+		t.Errorf("a completed move cannot be completed again")
+	}
+
+	// A move in flight to a partition that is taken over is redirected to the new owner.
+	if move, err = db1.HandOffAgreements(db2.PrimaryPartition(), testProtocol, []string{"ag2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := db2.QuiescePartition(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if moved, err := db1.MovePartition(60); err != nil || !moved {
+		t.Fatalf("the quiesced partition should have been moved, error: %v", err)
+	} else if err := db1.CompletePartitionMove(move.Id); err != nil {
+		t.Errorf("the redirected move should be completed by the new owner, error: %v", err)
+	}
+
+}
+
+func Test_search_session(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "agbot-sqlite-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := newTestDB(t, dir)
+	defer db.Close()
+
+	if token, cs, err := db.ObtainSearchSession("myorg/pol1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if token != "1999999998" || cs != 0 {
+		t.Errorf("unexpected initial session %v %v", token, cs)
+	} else if ended, err := db.UpdateSearchSessionChangedSince(0, 100, "myorg/pol1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ended {
+		t.Errorf("session should not have been ended yet")
+	} else if ended, err := db.UpdateSearchSessionChangedSince(0, 200, "myorg/pol1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !ended {
+		t.Errorf("session should have been ended already")
+	} else if token, cs, err := db.ObtainSearchSession("myorg/pol1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if token != "1999999999" || cs != 100 {
+		t.Errorf("unexpected next session %v %v", token, cs)
+	}
+
+}
@@ -0,0 +1,186 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"strconv"
+)
+
+// Constants for the SQL statements that are used to hand off agreements from one partition to another, see partition.go in
+// the persistence package for a description of rebalancing.
+//
+// partition_moves schema:
+// id:             The move id, incremented by the database when a new move is recorded.
+// from_partition: The partition that handed off the agreements.
+// to_partition:   The partition that received the agreements.
+// protocol:       The agreement protocol of the moved agreements.
+// agreements:     A JSON array of the moved agreement ids.
+// state:          The state of the move, see the PARTITION_MOVE_* constants in the persistence package.
+// started:        The time (in seconds since the epoch) when the agreements were handed off.
+// completed:      The time (in seconds since the epoch) when the agreements were adopted by the receiving agbot.
+//
+
+const PARTITION_MOVES_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS partition_moves (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	from_partition TEXT NOT NULL,
+	to_partition TEXT NOT NULL,
+	protocol TEXT NOT NULL,
+	agreements TEXT NOT NULL,
+	state TEXT NOT NULL,
+	started INTEGER NOT NULL DEFAULT (CAST(strftime('%s','now') AS INTEGER)),
+	completed INTEGER
+);`
+
+const PARTITION_MOVES_INSERT = `INSERT INTO partition_moves (from_partition, to_partition, protocol, agreements, state) VALUES (?1, ?2, ?3, ?4, ?5);`
+
+const PARTITION_MOVES_QUERY = `SELECT id, from_partition, to_partition, protocol, agreements, state, started, completed FROM partition_moves
+	WHERE state = ?1 OR completed > CAST(strftime('%s','now') AS INTEGER) - ?2 ORDER BY id;`
+
+const PARTITION_MOVES_COMPLETE = `UPDATE partition_moves SET state = ?3, completed = CAST(strftime('%s','now') AS INTEGER) WHERE id = ?1 AND to_partition = ?2 AND state = ?4;`
+
+const PARTITION_MOVES_PRUNE = `DELETE FROM partition_moves WHERE state = ?1 AND completed <= CAST(strftime('%s','now') AS INTEGER) - ?2;`
+
+// Moves that were handed off to a partition which is then taken over by another agbot are redirected to the new owner.
+const PARTITION_MOVES_REDIRECT = `UPDATE partition_moves SET to_partition = ?2 WHERE to_partition = ?1 AND state = ?3;`
+
+const AGREEMENT_SET_PARTITION = `UPDATE agreements SET partition = ?4 WHERE agreement_id = ?1 AND protocol = ?2 AND partition = ?3;`
+
+// Retrieve the heartbeat timestamp for a given partition. Zero is returned when the partition has no heartbeat.
+func (db *AgbotSqliteDB) GetPartitionHeartbeat(id string) (uint64, error) {
+
+	var hb sql.NullInt64
+	if err := db.db.QueryRow(PARTITION_GET_HEARTBEAT, id).Scan(&hb); err != nil && err != sql.ErrNoRows {
+		return 0, errors.New(fmt.Sprintf("error scanning partition %v heartbeat result, error: %v", id, err))
+	}
+	return uint64(hb.Int64), nil
+}
+
+// Move the input agreements, and their workload usages, from our primary partition to the input partition. The receiving
+// partition must be owned by another agbot. Agreements that are no longer in our partition are skipped. Returns nil if no
+// agreements were moved.
+func (db *AgbotSqliteDB) HandOffAgreements(toPartition string, protocol string, agreementIds []string) (*persistence.PartitionMove, error) {
+
+	if toPartition == db.PrimaryPartition() {
+		return nil, errors.New(fmt.Sprintf("cannot hand off agreements to our own partition %v", toPartition))
+	}
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to start transaction for handing off agreements, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	var owner sql.NullString
+	if err := tx.QueryRow(PARTITION_OWNER, toPartition).Scan(&owner); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to find partition %v, error: %v", toPartition, err))
+	} else if !owner.Valid {
+		return nil, errors.New(fmt.Sprintf("partition %v has no owner", toPartition))
+	}
+
+	moved := make([]string, 0, len(agreementIds))
+	for _, agId := range agreementIds {
+		if ag, partition, err := db.internalFindSingleAgreementByAgreementId(tx, agId, protocol, []persistence.AFilter{}); err != nil {
+			return nil, err
+		} else if ag == nil || partition != db.PrimaryPartition() {
+			glog.V(5).Infof("AgreementBot %v skipping hand off of agreement %v, it is not in partition %v", db.identity, agId, db.PrimaryPartition())
+		} else if _, err := tx.Exec(AGREEMENT_SET_PARTITION, agId, protocol, db.PrimaryPartition(), toPartition); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to hand off agreement %v, error: %v", agId, err))
+		} else if _, err := tx.Exec(WORKLOAD_USAGE_SET_PARTITION, ag.DeviceId, ag.PolicyName, db.PrimaryPartition(), toPartition); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to hand off workload usage for agreement %v, error: %v", agId, err))
+		} else {
+			moved = append(moved, agId)
+		}
+	}
+
+	if len(moved) == 0 {
+		return nil, nil
+	}
+
+	agBytes, err := json.Marshal(moved)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to serialize moved agreement ids, error: %v", err))
+	}
+
+	res, err := tx.Exec(PARTITION_MOVES_INSERT, db.PrimaryPartition(), toPartition, protocol, string(agBytes), persistence.PARTITION_MOVE_HANDED_OFF)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to record partition move, error: %v", err))
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to get partition move id, error: %v", err))
+	} else if err := tx.Commit(); err != nil {
+		return nil, errors.New(fmt.Sprintf("unable to commit transaction for handing off agreements, error: %v", err))
+	}
+
+	glog.V(3).Infof("AgreementBot %v handed off %v agreements from partition %v to %v", db.identity, len(moved), db.PrimaryPartition(), toPartition)
+	return db.findPartitionMove(strconv.FormatInt(id, 10))
+}
+
+// Return the moves that are in flight and the moves that completed recently.
+func (db *AgbotSqliteDB) FindPartitionMoves() ([]persistence.PartitionMove, error) {
+
+	moves := make([]persistence.PartitionMove, 0, 10)
+
+	rows, err := db.db.Query(PARTITION_MOVES_QUERY, persistence.PARTITION_MOVE_HANDED_OFF, persistence.PARTITION_MOVE_HISTORY_S)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for partition moves, error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var m persistence.PartitionMove
+		var id int64
+		var agBytes []byte
+		var completed sql.NullInt64
+		if err := rows.Scan(&id, &m.FromPartition, &m.ToPartition, &m.Protocol, &agBytes, &m.State, &m.Started, &completed); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning partition move row, error: %v", err))
+		} else if err := json.Unmarshal(agBytes, &m.Agreements); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling partition move %v agreements, error: %v", id, err))
+		}
+		m.Id = strconv.FormatInt(id, 10)
+		m.Completed = uint64(completed.Int64)
+		moves = append(moves, m)
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating partition moves, error: %v", err))
+	}
+
+	return moves, nil
+}
+
+func (db *AgbotSqliteDB) findPartitionMove(id string) (*persistence.PartitionMove, error) {
+	if moves, err := db.FindPartitionMoves(); err != nil {
+		return nil, err
+	} else {
+		for i := range moves {
+			if moves[i].Id == id {
+				return &moves[i], nil
+			}
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("partition move %v not found", id))
+}
+
+// Record that we have adopted the agreements handed off to our partition, and remove old completed moves.
+func (db *AgbotSqliteDB) CompletePartitionMove(id string) error {
+
+	if res, err := db.db.Exec(PARTITION_MOVES_COMPLETE, id, db.PrimaryPartition(), persistence.PARTITION_MOVE_ADOPTED, persistence.PARTITION_MOVE_HANDED_OFF); err != nil {
+		return errors.New(fmt.Sprintf("unable to complete partition move %v, error: %v", id, err))
+	} else if num, err := res.RowsAffected(); err != nil {
+		return errors.New(fmt.Sprintf("error getting rows affected completing partition move %v, error: %v", id, err))
+	} else if num == 0 {
+		return errors.New(fmt.Sprintf("partition move %v to partition %v is not in flight", id, db.PrimaryPartition()))
+	}
+
+	if _, err := db.db.Exec(PARTITION_MOVES_PRUNE, persistence.PARTITION_MOVE_ADOPTED, persistence.PARTITION_MOVE_HISTORY_S); err != nil {
+		glog.Warningf("unable to remove old partition moves, error: %v", err)
+	}
+	return nil
+}
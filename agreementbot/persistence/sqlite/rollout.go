@@ -0,0 +1,102 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"time"
+)
+
+// Constants for the SQL statements that are used to keep the state of deployment policy rollouts, see rollout.go in the
+// persistence package.
+//
+// rollouts schema:
+// partition:   The partition of the agbot that is running the rollout.
+// policy_name: The fully qualified (org/policy-name) deployment policy.
+// state:       A JSON serialization of the rollout state.
+// updated:     The time (in seconds since the epoch) when the state was last saved.
+//
+
+const ROLLOUTS_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS rollouts (
+	partition TEXT NOT NULL,
+	policy_name TEXT NOT NULL,
+	state TEXT NOT NULL,
+	updated INTEGER NOT NULL DEFAULT (CAST(strftime('%s','now') AS INTEGER)),
+	PRIMARY KEY (partition, policy_name)
+);`
+
+const ROLLOUTS_QUERY_ALL = `SELECT state FROM rollouts WHERE partition = ?1;`
+
+const ROLLOUTS_QUERY = `SELECT state FROM rollouts WHERE partition = ?1 AND policy_name = ?2;`
+
+const ROLLOUTS_UPSERT = `INSERT INTO rollouts (partition, policy_name, state) VALUES (?1, ?2, ?3)
+	ON CONFLICT (partition, policy_name) DO UPDATE SET state = ?3, updated = CAST(strftime('%s','now') AS INTEGER);`
+
+const ROLLOUTS_DELETE = `DELETE FROM rollouts WHERE partition = ?1 AND policy_name = ?2;`
+
+// The agbot that takes over a partition runs its own rollouts, so the rollout state of the partition is discarded.
+const ROLLOUTS_DELETE_PARTITION = `DELETE FROM rollouts WHERE partition = ?1;`
+
+func (db *AgbotSqliteDB) FindRolloutStates() ([]persistence.RolloutState, error) {
+
+	rows, err := db.db.Query(ROLLOUTS_QUERY_ALL, db.PrimaryPartition())
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for rollout states, error: %v", err))
+	}
+	defer rows.Close()
+
+	states := make([]persistence.RolloutState, 0)
+	for rows.Next() {
+		var stateBytes []byte
+		var rs persistence.RolloutState
+		if err := rows.Scan(&stateBytes); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row for rollout state, error: %v", err))
+		} else if err := json.Unmarshal(stateBytes, &rs); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling rollout state %v, error: %v", string(stateBytes), err))
+		}
+		states = append(states, rs)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating rollout states, error: %v", err))
+	}
+	return states, nil
+}
+
+// Returns nil if there is no rollout state for the policy.
+func (db *AgbotSqliteDB) GetRolloutState(policyName string) (*persistence.RolloutState, error) {
+
+	var stateBytes []byte
+	if err := db.db.QueryRow(ROLLOUTS_QUERY, db.PrimaryPartition(), policyName).Scan(&stateBytes); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.New(fmt.Sprintf("error scanning row for rollout state of %v, error: %v", policyName, err))
+	}
+
+	rs := new(persistence.RolloutState)
+	if err := json.Unmarshal(stateBytes, rs); err != nil {
+		return nil, errors.New(fmt.Sprintf("error demarshalling rollout state %v, error: %v", string(stateBytes), err))
+	}
+	return rs, nil
+}
+
+func (db *AgbotSqliteDB) SaveRolloutState(state *persistence.RolloutState) error {
+
+	state.Updated = uint64(time.Now().Unix())
+	if stateBytes, err := json.Marshal(state); err != nil {
+		return errors.New(fmt.Sprintf("error marshalling rollout state %v, error: %v", state, err))
+	} else if _, err := db.db.Exec(ROLLOUTS_UPSERT, db.PrimaryPartition(), state.PolicyName, stateBytes); err != nil {
+		return errors.New(fmt.Sprintf("error saving rollout state %v, error: %v", state, err))
+	}
+	return nil
+}
+
+func (db *AgbotSqliteDB) DeleteRolloutState(policyName string) error {
+
+	if _, err := db.db.Exec(ROLLOUTS_DELETE, db.PrimaryPartition(), policyName); err != nil {
+		return errors.New(fmt.Sprintf("error deleting rollout state of %v, error: %v", policyName, err))
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/cutil"
+	"strconv"
+	"time"
+)
+
+// Constants for the SQL statements that are used to manage search sessions. The schema and the semantics are the same as in
+// the postgresql implementation. Sqlite does not have stored procedures, so the logic of the postgresql functions is
+// implemented in this file, inside a transaction that holds the database write lock.
+//
+// schema:
+// policyName:          The fully qualified (org/policy-name) policy being searched
+// changedSince:        This is a linux epoch time stamp indicating that the exchange should return nodes that have changed since this time.
+// sessionToken:        This is a search session token, used to ensure that all agbots use the same session to search for nodes,
+//                      allowing the exchange to return a different page of results to each agbot. It is a number converted to a string.
+// sessionEnded:        Indicates that the current session is ended, so a new session can be allocated.
+// restartChangedSince: Indicates that an agbot was restarted, so this changedSince should be used when the next session is created.
+// updatingAgbot:       The UUID of the agbot that last updated this table/row.
+// updated:             The time when the agbot updated this table/row/
+//
+
+const SEARCH_SESSIONS_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS search_sessions (
+	policyName          TEXT    PRIMARY KEY,
+	changedSince        INTEGER NOT NULL,
+	sessionToken        INTEGER NOT NULL,
+	sessionEnded        BOOLEAN NOT NULL,
+	restartChangedSince INTEGER NOT NULL,
+	updatingAgbot       TEXT    NOT NULL,
+	updated INTEGER NOT NULL DEFAULT (CAST(strftime('%s','now') AS INTEGER))
+);`
+
+const SEARCH_SESSIONS_DUMP = `SELECT policyName, changedSince, sessionToken, sessionEnded, restartChangedSince, updatingAgbot, updated FROM search_sessions;`
+
+const SEARCH_SESSIONS_QUERY = `SELECT changedSince, sessionToken, sessionEnded, restartChangedSince FROM search_sessions WHERE policyName = ?1;`
+
+const SEARCH_SESSIONS_INSERT = `INSERT INTO search_sessions (policyName, changedSince, sessionToken, sessionEnded, restartChangedSince, updatingAgbot)
+	VALUES (?1, 0, ?2, 0, 0, ?3);`
+
+const SEARCH_SESSIONS_UPDATE = `UPDATE search_sessions
+	SET changedSince = ?2, sessionToken = ?3, sessionEnded = ?4, restartChangedSince = ?5, updatingAgbot = ?6, updated = CAST(strftime('%s','now') AS INTEGER)
+	WHERE policyName = ?1;`
+
+const SEARCH_SESSIONS_RESET_RESTART_CHANGED_SINCE = `UPDATE search_sessions
+	SET restartChangedSince = ?1, updatingAgbot = ?2, updated = CAST(strftime('%s','now') AS INTEGER)
+	WHERE sessionEnded = 0;`
+
+const SEARCH_SESSIONS_RESET_CHANGED_SINCE = `UPDATE search_sessions
+	SET changedSince = ?1, updatingAgbot = ?2, updated = CAST(strftime('%s','now') AS INTEGER)
+	WHERE sessionEnded = 1;`
+
+const SEARCH_SESSIONS_RESET_CHANGED_SINCE_FOR_POLICY = `UPDATE search_sessions
+	SET restartChangedSince = ?1, updatingAgbot = ?3, updated = CAST(strftime('%s','now') AS INTEGER)
+	WHERE policyName = ?2 AND (restartChangedSince = 0 OR restartChangedSince > ?1);`
+
+// The first session token handed out for a new policy. It is close to the roll over point so that the roll over logic
+// gets exercised early in the life of the database.
+const SEARCH_SESSIONS_INITIAL_TOKEN = 1999999998
+
+// Functions related to the search session table.
+
+// Get the current search session from the DB. If the current session is ended, then a new session token will
+// be allocated and stored in the DB.
+func (db *AgbotSqliteDB) ObtainSearchSession(policyName string) (string, uint64, error) {
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return "", 0, errors.New(fmt.Sprintf("error starting transaction for %v search session, error: %v", policyName, err))
+	}
+	defer tx.Rollback()
+
+	var changedSince, sessionToken, restartChangedSince int64
+	var sessionEnded bool
+	if err := tx.QueryRow(SEARCH_SESSIONS_QUERY, policyName).Scan(&changedSince, &sessionToken, &sessionEnded, &restartChangedSince); err == sql.ErrNoRows {
+
+		// The row doesnt exist at all, so create it.
+		sessionToken = SEARCH_SESSIONS_INITIAL_TOKEN
+		changedSince = 0
+		if _, err := tx.Exec(SEARCH_SESSIONS_INSERT, policyName, sessionToken, db.identity); err != nil {
+			return "", 0, errors.New(fmt.Sprintf("error creating %v search session, error: %v", policyName, err))
+		}
+
+	} else if err != nil {
+		return "", 0, errors.New(fmt.Sprintf("error obtaining %v search session, error: %v", policyName, err))
+
+	} else if sessionEnded {
+
+		// Update changedSince based on an agbot restart, then get a new session token, handling session token roll over.
+		if restartChangedSince != 0 {
+			changedSince = restartChangedSince
+		}
+		sessionToken += 1
+		if sessionToken > 2000000000 {
+			sessionToken = 1
+		}
+		if _, err := tx.Exec(SEARCH_SESSIONS_UPDATE, policyName, changedSince, sessionToken, false, 0, db.identity); err != nil {
+			return "", 0, errors.New(fmt.Sprintf("error updating %v search session, error: %v", policyName, err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", 0, errors.New(fmt.Sprintf("error committing %v search session, error: %v", policyName, err))
+	}
+	return strconv.FormatInt(sessionToken, 10), uint64(changedSince), nil
+}
+
+// Update the changed since time in the DB and mark the current session as ended. This is done when a node scan has completed
+// successfully and all pages of nodes have been processed. The returned boolean indicates whether or not the session was
+// already ended. If true, it means that another agbot ended the session before the caller did.
+func (db *AgbotSqliteDB) UpdateSearchSessionChangedSince(currentChangedSince uint64, newChangedSince uint64, policyName string) (bool, error) {
+	glog.V(3).Infof("AgreementBot updating changedSince from %v to %v for %v search session", time.Unix(int64(currentChangedSince), 0).Format(cutil.ExchangeTimeFormat), time.Unix(int64(newChangedSince), 0).Format(cutil.ExchangeTimeFormat), policyName)
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("error starting transaction for %v search session, error: %v", policyName, err))
+	}
+	defer tx.Rollback()
+
+	var changedSince, sessionToken, restartChangedSince int64
+	var sessionEnded bool
+	if err := tx.QueryRow(SEARCH_SESSIONS_QUERY, policyName).Scan(&changedSince, &sessionToken, &sessionEnded, &restartChangedSince); err != nil {
+		return false, errors.New(fmt.Sprintf("error updating %v search session changedSince, error: %v", policyName, err))
+	} else if uint64(changedSince) == currentChangedSince && !sessionEnded {
+		if _, err := tx.Exec(SEARCH_SESSIONS_UPDATE, policyName, newChangedSince, sessionToken, true, restartChangedSince, db.identity); err != nil {
+			return false, errors.New(fmt.Sprintf("error updating %v search session changedSince, error: %v", policyName, err))
+		} else if err := tx.Commit(); err != nil {
+			return false, errors.New(fmt.Sprintf("error committing %v search session changedSince, error: %v", policyName, err))
+		}
+	}
+	return sessionEnded, nil
+}
+
+// Update all search session with a new changed Since to account for possible lost search results when an agbot restarts.
+func (db *AgbotSqliteDB) ResetAllChangedSince(newChangedSince uint64) error {
+
+	tx, err := db.db.Begin()
+	if err != nil {
+		return errors.New(fmt.Sprintf("error starting transaction to reset changed since, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(SEARCH_SESSIONS_RESET_RESTART_CHANGED_SINCE, newChangedSince, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("error resetting changed since in all search sessions, error: %v", err))
+	} else if _, err := tx.Exec(SEARCH_SESSIONS_RESET_CHANGED_SINCE, newChangedSince, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("error resetting changed since in all search sessions, error: %v", err))
+	}
+	return tx.Commit()
+}
+
+// Update search session for a specific policy with a new changed Since to account for possible lost search results.
+func (db *AgbotSqliteDB) ResetPolicyChangedSince(policy string, newChangedSince uint64) error {
+	if _, err := db.db.Exec(SEARCH_SESSIONS_RESET_CHANGED_SINCE_FOR_POLICY, newChangedSince, policy, db.identity); err != nil {
+		return errors.New(fmt.Sprintf("error resetting changed since in %v search sessions, error: %v", policy, err))
+	}
+	return nil
+}
+
+type ssRecord struct {
+	pn string
+	cs int64
+	st int64
+	se bool
+	r  int64
+	ua string
+	up int64
+}
+
+func (r ssRecord) String() string {
+	return fmt.Sprintf("Policy: %v, ChangedSince: %v, SessionToken: %v, SessionEnded: %v, RestartCS: %v, Agbot: %v, Updated: %v", r.pn, r.cs, r.st, r.se, r.r, r.ua, r.up)
+}
+
+// Write all the search sessions to the log.
+func (db *AgbotSqliteDB) DumpSearchSessions() error {
+	if rows, err := db.db.Query(SEARCH_SESSIONS_DUMP); err != nil {
+		return errors.New(fmt.Sprintf("error dumping search sessions, error: %v", err))
+	} else {
+		defer rows.Close()
+		for rows.Next() {
+			out := ssRecord{}
+			if err := rows.Scan(&out.pn, &out.cs, &out.st, &out.se, &out.r, &out.ua, &out.up); err != nil {
+				glog.Errorf("AgbotDB: error dumping search sessions table, error: %v", err)
+			} else {
+				glog.V(4).Infof("Search Session: %v", out)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"time"
+)
+
+// Constants for the SQL statements that are used to work with the database version. The entire database schema has a single
+// version that is kept in the version table. Agbots automatically upgrade the database during initialization based on their version
+// and the version in the database.
+
+// version schema:
+// ver:     The current version of the database schema.
+// updated: A timestamp (in seconds since the epoch) to record last updated time.
+//
+const VERSION_CREATE_TABLE = `CREATE TABLE IF NOT EXISTS version (
+	id INTEGER PRIMARY KEY,
+	ver INTEGER NOT NULL,
+	description TEXT NOT NULL,
+	updated INTEGER NOT NULL DEFAULT (CAST(strftime('%s','now') AS INTEGER))
+);`
+
+const VERSION_QUERY = `SELECT ver, description, updated FROM version WHERE id = 1;`
+
+// There should only be 1 row in this table.
+const VERSION_INSERT = `INSERT OR IGNORE INTO version (id, ver, description) VALUES (1, 0, 'initial tables');`
+
+const VERSION_UPDATE = `UPDATE version SET ver = ?1, description = ?2, updated = CAST(strftime('%s','now') AS INTEGER) WHERE id = 1;`
+
+// The history of every migration that has been applied to the database.
+//
+// migration_history schema:
+// ver:     The schema version introduced by the migration.
+// name:    The name of the migration.
+// agbot:   The identity of the agbot instance that ran the migration.
+// applied: A timestamp (in seconds since the epoch) to record when the migration ran.
+//
+const MIGRATION_HISTORY_CREATE_TABLE = `CREATE TABLE IF NOT EXISTS migration_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	ver INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	agbot TEXT NOT NULL,
+	applied INTEGER NOT NULL DEFAULT (CAST(strftime('%s','now') AS INTEGER))
+);`
+
+const MIGRATION_HISTORY_INSERT = `INSERT INTO migration_history (ver, name, agbot) VALUES (?1, ?2, ?3);`
+
+const MIGRATION_HISTORY_QUERY = `SELECT ver, name, agbot, applied FROM migration_history ORDER BY id DESC LIMIT ?1;`
+
+// The number of history records returned in the schema status.
+const MIGRATION_HISTORY_STATUS_LIMIT = 10
+
+// The initial version of the schema is created by the table definitions in createTables. New schema versions are introduced
+// by adding a migration to the migrations list and moving HIGHEST_DATABASE_VERSION to the new version.
+const HIGHEST_DATABASE_VERSION = v4
+const v1 = 0
+const v2 = 1
+const v3 = 2
+const v4 = 3
+
+// The ordered list of schema migrations. Versions must be contiguous, starting at v1 + 1 and ending at
+// HIGHEST_DATABASE_VERSION. Once a migration has been released it must never be changed, add a new migration instead.
+// Unlike the postgresql provider, the sqlite provider only migrates forward to the latest version, so the migrations do
+// not have down statements. The tables are created with IF NOT EXISTS so that a database file that already has the table
+// is migrated without error.
+var migrations = []persistence.Migration{
+	{
+		Version: v2,
+		Name:    "add partition moves table",
+		Up:      []string{PARTITION_MOVES_CREATE_MAIN_TABLE},
+	},
+	{
+		Version: v3,
+		Name:    "add rollouts table",
+		Up:      []string{ROLLOUTS_CREATE_MAIN_TABLE},
+	},
+	{
+		Version: v4,
+		Name:    "add leader table",
+		Up:      []string{LEADER_CREATE_MAIN_TABLE},
+	},
+}
+
+// Migrate the database schema to the latest version. All the migrations run in a single transaction, which takes the
+// database lock when it begins, so that when several agbots sharing the database file start at the same time only one of
+// them runs each migration.
+func (db *AgbotSqliteDB) migrate() error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to start schema migration transaction, error: %v", err))
+	}
+	defer tx.Rollback()
+
+	var dbVersion int
+	var description string
+	var timestamp int64
+	if err := tx.QueryRow(VERSION_QUERY).Scan(&dbVersion, &description, &timestamp); err != nil {
+		return errors.New(fmt.Sprintf("error scanning row for current version, error: %v", err))
+	} else {
+		glog.V(3).Infof("Sqlite database tables are at version %v, %v, as of %v.", dbVersion, description, timestamp)
+	}
+
+	steps, err := persistence.PlanMigrations(migrations, dbVersion, persistence.LATEST_SCHEMA_VERSION, HIGHEST_DATABASE_VERSION)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		for si, stmt := range step.Statements() {
+			if _, err := tx.Exec(stmt); err != nil {
+				return errors.New(fmt.Sprintf("unable to run SQL migration statement %v, index %v, statement %v, error: %v", step, si, stmt, err))
+			}
+		}
+		if _, err := tx.Exec(VERSION_UPDATE, step.ResultVersion(), step.Description()); err != nil {
+			return errors.New(fmt.Sprintf("unable to update version table, error: %v", err))
+		} else if _, err := tx.Exec(MIGRATION_HISTORY_INSERT, step.Migration.Version, step.Migration.Name, db.identity); err != nil {
+			return errors.New(fmt.Sprintf("unable to insert migration history, error: %v", err))
+		}
+		glog.V(3).Infof("Sqlite database tables upgraded to version %v, %v", step.ResultVersion(), step.Migration.Name)
+	}
+
+	return tx.Commit()
+}
+
+// Return the version of the database schema, the migrations needed to bring it to the latest version and the most
+// recent migration history.
+func (db *AgbotSqliteDB) GetSchemaStatus() (*persistence.SchemaStatus, error) {
+	status := &persistence.SchemaStatus{
+		Provider:      "sqlite",
+		LatestVersion: HIGHEST_DATABASE_VERSION,
+		Pending:       make([]string, 0),
+		History:       make([]persistence.SchemaMigration, 0),
+	}
+
+	var timestamp int64
+	if err := db.db.QueryRow(VERSION_QUERY).Scan(&status.CurrentVersion, &status.Description, &timestamp); err != nil {
+		return nil, errors.New(fmt.Sprintf("error scanning row for current version, error: %v", err))
+	}
+	status.Updated = time.Unix(timestamp, 0).Format(time.RFC3339)
+
+	if steps, err := persistence.PlanMigrations(migrations, status.CurrentVersion, persistence.LATEST_SCHEMA_VERSION, HIGHEST_DATABASE_VERSION); err != nil {
+		return nil, err
+	} else {
+		for _, step := range steps {
+			status.Pending = append(status.Pending, step.Migration.Name)
+		}
+	}
+
+	rows, err := db.db.Query(MIGRATION_HISTORY_QUERY, MIGRATION_HISTORY_STATUS_LIMIT)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying migration history, error: %v", err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := persistence.SchemaMigration{Direction: persistence.MIGRATION_UP}
+		var applied int64
+		if err := rows.Scan(&m.Version, &m.Name, &m.Agbot, &applied); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning migration history row, error: %v", err))
+		}
+		m.Applied = time.Unix(applied, 0).Format(time.RFC3339)
+		status.History = append(status.History, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating migration history, error: %v", err))
+	}
+	return status, nil
+}
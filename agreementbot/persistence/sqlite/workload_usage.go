@@ -0,0 +1,275 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+)
+
+// Constants for the SQL statements that are used to work with workload usages. These records are used to track what workload
+// is running on each device so that we can do proper management of HA devices. Workload usages are partitioned by agbot
+// instances in the same way as agreements, using a partition column in a single table.
+//
+// workload_usages schema:
+// device_id:      The device's exchange id.
+// policy_name:    The name of the policy that is placing this workload on the device.
+// partition:      The agbot partition that this workload usage lives in.
+// workload_usage: The worload_usage object which is a JSON blob. The blob schema is defined by the WorkloadUsage struct in the persistence package.
+// updated:        A timestamp (in seconds since the epoch) to record last updated time.
+//
+
+const WORKLOAD_USAGE_CREATE_MAIN_TABLE = `CREATE TABLE IF NOT EXISTS workload_usages (
+	device_id TEXT NOT NULL,
+	policy_name TEXT NOT NULL,
+	partition TEXT NOT NULL,
+	workload_usage TEXT NOT NULL,
+	updated INTEGER NOT NULL DEFAULT (CAST(strftime('%s','now') AS INTEGER)),
+	PRIMARY KEY (device_id, policy_name, partition)
+);`
+const WORKLOAD_USAGE_CREATE_PARTITION_INDEX = `CREATE INDEX IF NOT EXISTS workload_usages_partition_index ON workload_usages (partition);`
+
+const WORKLOAD_USAGE_QUERY = `SELECT workload_usage FROM workload_usages WHERE device_id = ?1 AND policy_name = ?2 AND partition = ?3;`
+const ALL_WORKLOAD_USAGE_QUERY = `SELECT workload_usage FROM workload_usages WHERE partition = ?1;`
+
+const WORKLOAD_USAGE_COUNT = `SELECT COUNT(*) FROM workload_usages WHERE partition = ?1;`
+
+const WORKLOAD_USAGE_INSERT = `INSERT INTO workload_usages (device_id, policy_name, partition, workload_usage) VALUES (?1, ?2, ?3, ?4);`
+const WORKLOAD_USAGE_UPDATE = `UPDATE workload_usages SET workload_usage = ?4, updated = CAST(strftime('%s','now') AS INTEGER) WHERE device_id = ?1 AND policy_name = ?2 AND partition = ?3;`
+const WORKLOAD_USAGE_DELETE = `DELETE FROM workload_usages WHERE device_id = ?1 AND policy_name = ?2 AND partition = ?3;`
+
+const WORKLOAD_USAGE_SET_PARTITION = `UPDATE workload_usages SET partition = ?4 WHERE device_id = ?1 AND policy_name = ?2 AND partition = ?3;`
+
+const WORKLOAD_USAGE_MOVE = `UPDATE workload_usages SET partition = ?2 WHERE partition = ?1;`
+
+func (db *AgbotSqliteDB) GetWorkloadUsagesCount(partition string) (int64, error) {
+	var num int64
+	if err := db.db.QueryRow(WORKLOAD_USAGE_COUNT, partition).Scan(&num); err != nil && err != sql.ErrNoRows {
+		return 0, errors.New(fmt.Sprintf("error scanning result for workload usage count in partition %v, error: %v", partition, err))
+	} else {
+		return num, nil
+	}
+}
+
+// Find the workload usage record, but constrain the search to partitions owned by this agbot.
+func (db *AgbotSqliteDB) internalFindSingleWorkloadUsageByDeviceAndPolicyName(tx *sql.Tx, deviceid string, policyName string) (*persistence.WorkloadUsage, string, error) {
+
+	for _, currentPartition := range db.AllPartitions() {
+
+		var wuBytes []byte
+		var qerr error
+		if tx == nil {
+			qerr = db.db.QueryRow(WORKLOAD_USAGE_QUERY, deviceid, policyName, currentPartition).Scan(&wuBytes)
+		} else {
+			qerr = tx.QueryRow(WORKLOAD_USAGE_QUERY, deviceid, policyName, currentPartition).Scan(&wuBytes)
+		}
+
+		if qerr != nil && qerr != sql.ErrNoRows {
+			return nil, "", errors.New(fmt.Sprintf("error scanning row for workload usage for device id %v and policy name %v, error: %v", deviceid, policyName, qerr))
+		} else if qerr == sql.ErrNoRows {
+			continue
+		}
+
+		wu := new(persistence.WorkloadUsage)
+		if err := json.Unmarshal(wuBytes, wu); err != nil {
+			return nil, "", errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(wuBytes), err))
+		} else {
+			return wu, currentPartition, nil
+		}
+	}
+	// No records found.
+	return nil, "", nil
+
+}
+
+func (db *AgbotSqliteDB) FindSingleWorkloadUsageByDeviceAndPolicyName(deviceid string, policyName string) (*persistence.WorkloadUsage, error) {
+	wu, _, err := db.internalFindSingleWorkloadUsageByDeviceAndPolicyName(nil, deviceid, policyName)
+	return wu, err
+}
+
+func (db *AgbotSqliteDB) FindWorkloadUsages(filters []persistence.WUFilter) ([]persistence.WorkloadUsage, error) {
+	wus := make([]persistence.WorkloadUsage, 0, 100)
+
+	for _, currentPartition := range db.AllPartitions() {
+		if partitionWus, err := db.findWorkloadUsagesInPartition(currentPartition, filters); err != nil {
+			return nil, err
+		} else {
+			wus = append(wus, partitionWus...)
+		}
+	}
+
+	return wus, nil
+}
+
+func (db *AgbotSqliteDB) findWorkloadUsagesInPartition(partition string, filters []persistence.WUFilter) ([]persistence.WorkloadUsage, error) {
+	wus := make([]persistence.WorkloadUsage, 0, 100)
+
+	rows, err := db.db.Query(ALL_WORKLOAD_USAGE_QUERY, partition)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("error querying for workload usages, error: %v", err))
+	}
+
+	// If the rows object doesnt get closed, memory and connections will grow and/or leak.
+	defer rows.Close()
+	for rows.Next() {
+		var wuBytes []byte
+		wu := new(persistence.WorkloadUsage)
+		if err := rows.Scan(&wuBytes); err != nil {
+			return nil, errors.New(fmt.Sprintf("error scanning row: %v", err))
+		} else if err := json.Unmarshal(wuBytes, wu); err != nil {
+			return nil, errors.New(fmt.Sprintf("error demarshalling row: %v, error: %v", string(wuBytes), err))
+		} else {
+			exclude := false
+			for _, filterFn := range filters {
+				if !filterFn(*wu) {
+					exclude = true
+				}
+			}
+			if !exclude {
+				wus = append(wus, *wu)
+			}
+		}
+	}
+
+	// The rows.Next() function will exit with false when done or an error occurred. Get any error encountered during iteration.
+	if err = rows.Err(); err != nil {
+		return nil, errors.New(fmt.Sprintf("error iterating: %v", err))
+	}
+
+	return wus, nil
+}
+
+func (db *AgbotSqliteDB) NewWorkloadUsage(deviceId string, hapartners []string, policy string, policyName string, priority int, retryDurationS int, verifiedDurationS int, reqsNotMet bool, agid string) error {
+	if wlUsage, err := persistence.NewWorkloadUsage(deviceId, hapartners, policy, policyName, priority, retryDurationS, verifiedDurationS, reqsNotMet, agid); err != nil {
+		return err
+	} else if existing, partition, err := db.internalFindSingleWorkloadUsageByDeviceAndPolicyName(nil, deviceId, policyName); err != nil {
+		return err
+	} else if existing != nil {
+		return fmt.Errorf("Workload usage record for device %v and policy name %v already exists in partition %v.", deviceId, policyName, partition)
+	} else if err := db.insertWorkloadUsage(wlUsage); err != nil {
+		return err
+	} else {
+		return nil
+	}
+}
+
+func (db *AgbotSqliteDB) UpdatePendingUpgrade(deviceid string, policyName string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdatePendingUpgrade(db, deviceid, policyName)
+}
+
+func (db *AgbotSqliteDB) UpdateRetryCount(deviceid string, policyName string, retryCount int, agid string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdateRetryCount(db, deviceid, policyName, retryCount, agid)
+}
+
+func (db *AgbotSqliteDB) UpdatePriority(deviceid string, policyName string, priority int, retryDurationS int, verifiedDurationS int, agid string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdatePriority(db, deviceid, policyName, priority, retryDurationS, verifiedDurationS, agid)
+}
+
+func (db *AgbotSqliteDB) UpdatePolicy(deviceid string, policyName string, pol string) (*persistence.WorkloadUsage, error) {
+	return persistence.UpdatePolicy(db, deviceid, policyName, pol)
+}
+
+// The workload usage record might be in a different partition than the agreement it is now associated with, see the
+// postgresql implementation for the details of how that happens. When it is, the record follows the agreement into the
+// agreement's partition.
+func (db *AgbotSqliteDB) UpdateWUAgreementId(deviceid string, policyName string, agid string, protocol string) (*persistence.WorkloadUsage, error) {
+
+	if _, wlPartition, err := db.internalFindSingleWorkloadUsageByDeviceAndPolicyName(nil, deviceid, policyName); err != nil {
+		return nil, err
+	} else if _, agPartition, err := db.internalFindSingleAgreementByAgreementId(nil, agid, protocol, []persistence.AFilter{}); err != nil {
+		return nil, err
+	} else if wlPartition != "" && agPartition != "" && wlPartition != agPartition {
+		if _, err := db.db.Exec(WORKLOAD_USAGE_SET_PARTITION, deviceid, policyName, wlPartition, agPartition); err != nil {
+			return nil, errors.New(fmt.Sprintf("Unable to move workload usage record to partition %v, error %v", agPartition, err))
+		}
+	}
+
+	// Finally, update the agreement id in the workload usage object.
+	return persistence.UpdateWUAgreementId(db, deviceid, policyName, agid)
+}
+
+func (db *AgbotSqliteDB) DisableRollbackChecking(deviceid string, policyName string) (*persistence.WorkloadUsage, error) {
+	return persistence.DisableRollbackChecking(db, deviceid, policyName)
+}
+
+func (db *AgbotSqliteDB) DeleteWorkloadUsage(deviceid string, policyName string) error {
+	tx, err := db.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Delete the workload usage if it's there.
+	if wu, partition, err := db.internalFindSingleWorkloadUsageByDeviceAndPolicyName(tx, deviceid, policyName); err != nil {
+		return err
+	} else if wu != nil {
+		if _, err := tx.Exec(WORKLOAD_USAGE_DELETE, deviceid, policyName, partition); err != nil {
+			return err
+		}
+		glog.V(5).Infof("Succeeded deleting workload usage for device %v and policy %v from database.", deviceid, policyName)
+	}
+	return tx.Commit()
+}
+
+func (db *AgbotSqliteDB) SingleWorkloadUsageUpdate(deviceid string, policyName string, fn func(persistence.WorkloadUsage) *persistence.WorkloadUsage) (*persistence.WorkloadUsage, error) {
+	if wlUsage, err := db.FindSingleWorkloadUsageByDeviceAndPolicyName(deviceid, policyName); err != nil {
+		return nil, err
+	} else if wlUsage == nil {
+		return nil, fmt.Errorf("Unable to locate workload usage for device: %v, and policy: %v", deviceid, policyName)
+	} else {
+		updated := fn(*wlUsage)
+		return updated, db.wrapWUTransaction(deviceid, policyName, updated)
+	}
+}
+
+func (db *AgbotSqliteDB) wrapWUTransaction(deviceid string, policyName string, updated *persistence.WorkloadUsage) error {
+
+	if tx, err := db.db.Begin(); err != nil {
+		return err
+	} else if err := db.persistUpdatedWorkloadUsage(tx, deviceid, policyName, updated); err != nil {
+		tx.Rollback()
+		return err
+	} else {
+		return tx.Commit()
+	}
+
+}
+
+// This function runs inside a transaction. It will atomicly read the workload usage from the DB, verify that the updated
+// workload usage object contains valid state transitions, and then write the updated workload usage back to the database.
+func (db *AgbotSqliteDB) persistUpdatedWorkloadUsage(tx *sql.Tx, deviceid string, policyName string, update *persistence.WorkloadUsage) error {
+
+	if mod, partition, err := db.internalFindSingleWorkloadUsageByDeviceAndPolicyName(tx, deviceid, policyName); err != nil {
+		return err
+	} else if mod == nil {
+		return errors.New(fmt.Sprintf("No workload usage with device id %v and policy name %v available to update.", deviceid, policyName))
+	} else {
+		// This code is running in a database transaction. Within the tx, the current record (mod) is
+		// read and then updated according to the updates within the input update record. It is critical
+		// to check for correct data transitions within the tx.
+		persistence.ValidateWUStateTransition(mod, update)
+
+		if wum, err := json.Marshal(mod); err != nil {
+			return err
+		} else if _, err = tx.Exec(WORKLOAD_USAGE_UPDATE, mod.DeviceId, mod.PolicyName, partition, string(wum)); err != nil {
+			return err
+		} else {
+			glog.V(2).Infof("Succeeded writing workload usage record %v", mod.ShortString())
+		}
+		return nil
+	}
+}
+
+func (db *AgbotSqliteDB) insertWorkloadUsage(wu *persistence.WorkloadUsage) error {
+
+	if wum, err := json.Marshal(wu); err != nil {
+		return err
+	} else if _, err = db.db.Exec(WORKLOAD_USAGE_INSERT, wu.DeviceId, wu.PolicyName, db.PrimaryPartition(), string(wum)); err != nil {
+		return err
+	}
+	glog.V(2).Infof("Succeeded creating workload usage record %v", wu.ShortString())
+
+	return nil
+}
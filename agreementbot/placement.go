@@ -0,0 +1,332 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/compcheck"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/policy"
+	"golang.org/x/text/message"
+	"strings"
+	"time"
+)
+
+// The placement section of a deployment policy limits the number of nodes per value of a node property that get the
+// service, and keeps the service off the nodes that are running other services. The limits are checked against the
+// agreements in this agbot's database. The services running on a node are the ones in the agreements that this agbot
+// has made with the node for deployment policies, agreements made by other agbots or for patterns are not seen. The
+// agreement attempts that the node search has queued for a policy count against its limits until they are in the
+// database, so that the next search does not place more nodes while the agreement workers are busy.
+
+// Tracks the placement of a deployment policy while the node search makes new agreements for it.
+type placementTracker struct {
+	placement      *businesspolicy.Placement
+	valueCounts    map[string]map[string]int
+	nodeProps      map[string]externalpolicy.PropertyList
+	attempts       queuedAttempts
+	nodeProperties func(nodeId string) (externalpolicy.PropertyList, error)
+	nodeServices   func(nodeId string) ([]string, error)
+}
+
+// The agreement attempts queued for a deployment policy that are not in the database yet, keyed by node id. The value is
+// the time that the attempt was queued.
+type queuedAttempts map[string]time.Time
+
+func (n *NodeSearch) newPlacementTracker(policyName string, placement *businesspolicy.Placement, allAgreements map[string][]persistence.Agreement) (*placementTracker, error) {
+
+	policyNodes := make([]string, 0)
+	inDB := make(map[string]bool)
+	for _, ags := range allAgreements {
+		for _, ag := range ags {
+			policyNodes = append(policyNodes, ag.DeviceId)
+			inDB[ag.DeviceId] = true
+		}
+	}
+
+	// Count the attempts queued by earlier searches that are not in the database yet. An attempt that is still not in
+	// the database after the protocol timeout was dropped by the agreement worker.
+	attempts, ok := n.placementAttempts[policyName]
+	if !ok {
+		attempts = make(queuedAttempts)
+		n.placementAttempts[policyName] = attempts
+	}
+	for nodeId, queued := range attempts {
+		if inDB[nodeId] || time.Since(queued) > time.Duration(n.attemptTimeoutS)*time.Second {
+			delete(attempts, nodeId)
+		} else {
+			policyNodes = append(policyNodes, nodeId)
+		}
+	}
+
+	valueCounts, err := placementValueCounts(placement, policyNodes, n.getNodeProperties)
+	if err != nil {
+		return nil, err
+	}
+
+	return &placementTracker{
+		placement:      placement,
+		valueCounts:    valueCounts,
+		nodeProps:      make(map[string]externalpolicy.PropertyList),
+		attempts:       attempts,
+		nodeProperties: n.getNodeProperties,
+		nodeServices:   func(nodeId string) ([]string, error) { return nodeRunningServices(n.db, nodeId) },
+	}, nil
+}
+
+// Returns true if the placement of the policy allows an agreement with the node, or false and the reason if not.
+func (p *placementTracker) allows(nodeId string) (bool, string, error) {
+	props, ok := p.nodeProps[nodeId]
+	if !ok {
+		var err error
+		if props, err = p.nodeProperties(nodeId); err != nil {
+			return false, "", err
+		}
+		p.nodeProps[nodeId] = props
+	}
+
+	state := compcheck.PlacementState{ValueCounts: p.valueCounts}
+	if len(p.placement.AntiAffinity) != 0 {
+		var err error
+		if state.NodeServices, err = p.nodeServices(nodeId); err != nil {
+			return false, "", err
+		}
+	}
+
+	compatible, reason := compcheck.PlacementCompatible(p.placement, props, &state, nil)
+	return compatible, reason, nil
+}
+
+// Counts a new agreement attempt with the node, so that the nodes after it are checked against the new counts. The
+// attempt is counted by the next searches until it is in the database.
+func (p *placementTracker) placed(nodeId string) {
+	addPlacementValues(p.valueCounts, p.placement, p.nodeProps[nodeId])
+	p.attempts[nodeId] = time.Now()
+}
+
+// Returns true if an agreement attempt with the node is queued but not in the database yet.
+func (p *placementTracker) queued(nodeId string) bool {
+	_, ok := p.attempts[nodeId]
+	return ok
+}
+
+// Count the nodes with an agreement for a deployment policy by the values of the node properties that the placement
+// limits use.
+func placementValueCounts(placement *businesspolicy.Placement, policyNodes []string, nodeProperties func(nodeId string) (externalpolicy.PropertyList, error)) (map[string]map[string]int, error) {
+	valueCounts := make(map[string]map[string]int)
+	if len(placement.Limits) == 0 {
+		return valueCounts, nil
+	}
+
+	for _, nodeId := range policyNodes {
+		if props, err := nodeProperties(nodeId); err != nil {
+			return nil, fmt.Errorf("unable to get the properties of node %v, error: %v", nodeId, err)
+		} else {
+			addPlacementValues(valueCounts, placement, props)
+		}
+	}
+	return valueCounts, nil
+}
+
+func addPlacementValues(valueCounts map[string]map[string]int, placement *businesspolicy.Placement, props externalpolicy.PropertyList) {
+	for _, limit := range placement.Limits {
+		if value, ok := compcheck.PlacementValue(props, limit.Property); ok {
+			if _, ok := valueCounts[limit.Property]; !ok {
+				valueCounts[limit.Property] = make(map[string]int)
+			}
+			valueCounts[limit.Property][value] += 1
+		}
+	}
+}
+
+// Returns the services (org/url) in the current agreements that this agbot has with the node.
+func nodeRunningServices(db persistence.AgbotDatabase, nodeId string) ([]string, error) {
+	nodeFilter := func(a persistence.Agreement) bool { return a.DeviceId == nodeId && a.AgreementTimedout == 0 }
+
+	agreements := make([]persistence.Agreement, 0)
+	for _, agp := range policy.AllAgreementProtocols() {
+		if ags, err := db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter(), nodeFilter}, agp); err != nil {
+			return nil, err
+		} else {
+			agreements = append(agreements, ags...)
+		}
+	}
+
+	services := runningServices(agreements, nodeId)
+	glog.V(5).Infof(AWlogString(fmt.Sprintf("node %v is running services %v", nodeId, services)))
+	return services, nil
+}
+
+// Returns the services (org/url) in the agreements with the node.
+func runningServices(agreements []persistence.Agreement, nodeId string) []string {
+	services := make([]string, 0)
+	for _, ag := range agreements {
+		if ag.DeviceId != nodeId {
+			continue
+		}
+		// The service ids are in the form of org/url_version_arch.
+		for _, serviceId := range ag.ServiceId {
+			services = append(services, strings.SplitN(serviceId, "_", 2)[0])
+		}
+	}
+	return services
+}
+
+// The nodes held back by the placement of a deployment policy, keyed by node id.
+type heldNodes map[string]exchange.SearchResultDevice
+
+// Add the nodes held back by the placement of the policy to the nodes found by the search, so that they are checked
+// again against the current agreements. The held back nodes are not known after the agbot restarts, so the next search
+// for the policy looks at all the nodes again.
+func (n *NodeSearch) addPlacementNodes(policyName string, devices []exchange.SearchResultDevice, ags map[string][]persistence.Agreement) []exchange.SearchResultDevice {
+	held, ok := n.placements[policyName]
+	if !ok {
+		held = make(heldNodes)
+		n.placements[policyName] = held
+		n.AddRetry(policyName, 1)
+	}
+
+	// Nodes that have an agreement are no longer held back.
+	for _, agreements := range ags {
+		for _, ag := range agreements {
+			delete(held, ag.DeviceId)
+		}
+	}
+
+	candidates := make([]exchange.SearchResultDevice, 0, len(devices)+len(held))
+	found := make(map[string]bool, len(devices))
+	for _, dev := range devices {
+		found[dev.Id] = true
+		if _, ok := held[dev.Id]; ok {
+			// Keep the latest copy of the node from the exchange.
+			held[dev.Id] = dev
+		}
+		candidates = append(candidates, dev)
+	}
+	for id, dev := range held {
+		if !found[id] {
+			candidates = append(candidates, dev)
+		}
+	}
+	return candidates
+}
+
+// Hold back a node because the placement of the policy does not allow an agreement with it.
+func (n *NodeSearch) holdBackPlacementNode(policyName string, dev exchange.SearchResultDevice) {
+	if held, ok := n.placements[policyName]; ok {
+		held[dev.Id] = dev
+	}
+}
+
+// The node has been sent a proposal, so it is no longer held back.
+func (n *NodeSearch) releasePlacementNode(policyName string, dev exchange.SearchResultDevice) {
+	if held, ok := n.placements[policyName]; ok {
+		delete(held, dev.Id)
+	}
+}
+
+// Forget the nodes held back and the attempts queued for deployment policies that no longer exist or no longer have a
+// placement section.
+func (n *NodeSearch) prunePlacements() {
+	policyNames := make(map[string]bool)
+	for policyName := range n.placements {
+		policyNames[policyName] = true
+	}
+	for policyName := range n.placementAttempts {
+		policyNames[policyName] = true
+	}
+
+	for policyName := range policyNames {
+		org, _ := cutil.SplitOrgSpecUrl(policyName)
+		if pBE := businessPolManager.GetBusinessPolicyEntry(org, policy.Policy_Factory(policyName)); pBE == nil || pBE.Placement == nil {
+			glog.V(3).Infof(AWlogString(fmt.Sprintf("removing placement state for %v", policyName)))
+			delete(n.placements, policyName)
+			delete(n.placementAttempts, policyName)
+		}
+	}
+}
+
+// Checks the placement of deployment policies for the compatibility check APIs. The agreements are read from the
+// database once, and the node policies through the exchange cache of the request, so that a request that checks many
+// nodes does not read them again for each node.
+type placementChecker struct {
+	db             persistence.AgbotDatabase
+	nodeProperties func(nodeId string) (externalpolicy.PropertyList, error)
+	agreements     []persistence.Agreement // the current agreements of this agbot, nil until they are read
+}
+
+func (a *SecureAPI) newPlacementChecker(cache *compcheck.ExchangeCache) *placementChecker {
+	nodePolicyHandler := cache.NodePolicyHandler()
+	return &placementChecker{
+		db:             a.db,
+		nodeProperties: func(id string) (externalpolicy.PropertyList, error) { return getNodeProperties(nodePolicyHandler, id) },
+	}
+}
+
+func (c *placementChecker) getAgreements() ([]persistence.Agreement, error) {
+	if c.agreements != nil {
+		return c.agreements, nil
+	}
+
+	activeFilter := func(a persistence.Agreement) bool { return a.AgreementTimedout == 0 }
+	agreements := make([]persistence.Agreement, 0)
+	for _, agp := range policy.AllAgreementProtocols() {
+		if ags, err := c.db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter(), activeFilter}, agp); err != nil {
+			return nil, err
+		} else {
+			agreements = append(agreements, ags...)
+		}
+	}
+	c.agreements = agreements
+	return agreements, nil
+}
+
+// Add the placement check to the output of a compatibility check for a deployment policy, so that the output explains
+// when the placement of the policy is what keeps the node from getting the service. The node being checked is not
+// counted against the placement limits.
+func (c *placementChecker) check(output *compcheck.CompCheckOutput, msgPrinter *message.Printer) error {
+	if output == nil || !output.Compatible || output.Input == nil || output.Input.BusinessPolicy == nil || output.Input.BusinessPolicy.Placement == nil {
+		return nil
+	}
+
+	placement := output.Input.BusinessPolicy.Placement
+	bpId := output.Input.BusinessPolId
+	nodeId := output.Input.NodeId
+
+	agreements, err := c.getAgreements()
+	if err != nil {
+		return compcheck.NewCompCheckError(fmt.Errorf(msgPrinter.Sprintf("Unable to read the agreements of deployment policy %v. %v", bpId, err)), compcheck.COMPCHECK_GENERAL_ERROR)
+	}
+
+	// the nodes that already have an agreement for the policy
+	policyNodes := make([]string, 0)
+	if bpId != "" {
+		for _, ag := range agreements {
+			if ag.PolicyName == bpId && ag.Pattern == "" && ag.DeviceId != nodeId {
+				policyNodes = append(policyNodes, ag.DeviceId)
+			}
+		}
+	}
+
+	state := compcheck.PlacementState{}
+	if valueCounts, err := placementValueCounts(placement, policyNodes, c.nodeProperties); err != nil {
+		return compcheck.NewCompCheckError(fmt.Errorf(msgPrinter.Sprintf("Unable to count the placement of deployment policy %v. %v", bpId, err)), compcheck.COMPCHECK_EXCHANGE_ERROR)
+	} else {
+		state.ValueCounts = valueCounts
+	}
+
+	if nodeId != "" {
+		state.NodeServices = runningServices(agreements, nodeId)
+	}
+
+	nodeProps := externalpolicy.PropertyList{}
+	if output.Input.NodePolicy != nil {
+		nodeProps = output.Input.NodePolicy.Properties
+	}
+
+	compcheck.CheckPlacementCompatibility(output, placement, nodeProps, &state, msgPrinter)
+	return nil
+}
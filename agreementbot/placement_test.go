@@ -0,0 +1,192 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/agreementbot/persistence/memory"
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/compcheck"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/policy"
+	"testing"
+	"time"
+)
+
+func Test_placementTracker(t *testing.T) {
+	stores := map[string]string{"org/old1": "s1", "org/n1": "s1", "org/n2": "s2", "org/n3": "s2", "org/n4": "s3"}
+	nodeProperties := func(nodeId string) (externalpolicy.PropertyList, error) {
+		if nodeId == "org/bad" {
+			return nil, errors.New("exchange error")
+		} else if store, ok := stores[nodeId]; ok {
+			return externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", store)}, nil
+		}
+		return externalpolicy.PropertyList{}, nil
+	}
+
+	placement := &businesspolicy.Placement{
+		Limits:       []businesspolicy.PlacementLimit{{Property: "store", Max: 1}},
+		AntiAffinity: []businesspolicy.AntiAffinityRule{{Name: "gps", Org: "IBM"}},
+	}
+
+	if _, err := placementValueCounts(placement, []string{"org/old1", "org/bad"}, nodeProperties); err == nil {
+		t.Errorf("expected an error when the node properties cannot be read")
+	}
+
+	valueCounts, err := placementValueCounts(placement, []string{"org/old1"}, nodeProperties)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if valueCounts["store"]["s1"] != 1 {
+		t.Errorf("wrong counts: %v", valueCounts)
+	}
+
+	tracker := &placementTracker{
+		placement:      placement,
+		valueCounts:    valueCounts,
+		nodeProps:      make(map[string]externalpolicy.PropertyList),
+		attempts:       make(queuedAttempts),
+		nodeProperties: nodeProperties,
+		nodeServices: func(nodeId string) ([]string, error) {
+			if nodeId == "org/n4" {
+				return []string{"IBM/netspeed", "IBM/gps"}, nil
+			}
+			return []string{}, nil
+		},
+	}
+
+	// s1 is full, the first node in s2 is placed, the second one is then over the limit, n4 runs the gps service
+	expected := map[string]bool{"org/n1": false, "org/n2": true, "org/n3": false, "org/n4": false, "org/n5": true}
+	for _, nodeId := range []string{"org/n1", "org/n2", "org/n3", "org/n4", "org/n5"} {
+		if allowed, reason, err := tracker.allows(nodeId); err != nil {
+			t.Errorf("unexpected error for %v: %v", nodeId, err)
+		} else if allowed != expected[nodeId] {
+			t.Errorf("node %v allowed %v, expected %v, reason: %v", nodeId, allowed, expected[nodeId], reason)
+		} else if allowed {
+			tracker.placed(nodeId)
+		}
+	}
+
+	if _, _, err := tracker.allows("org/bad"); err == nil {
+		t.Errorf("expected an error when the node properties cannot be read")
+	}
+}
+
+func Test_NodeSearch_addPlacementNodes(t *testing.T) {
+	n := NewNodeSearch()
+	n.placements["org/bp"] = heldNodes{}
+
+	n.holdBackPlacementNode("org/bp", exchange.SearchResultDevice{Id: "org/n1"})
+	n.holdBackPlacementNode("org/bp", exchange.SearchResultDevice{Id: "org/n2"})
+	n.holdBackPlacementNode("org/other", exchange.SearchResultDevice{Id: "org/n3"})
+
+	// n2 now has an agreement, n1 is found again by the search
+	ags := map[string][]persistence.Agreement{"Basic": {{DeviceId: "org/n2", PolicyName: "org/bp"}}}
+	candidates := n.addPlacementNodes("org/bp", rankingNodes("org/n4", "org/n1"), ags)
+
+	checkRanking(t, "placement", candidates, nil, "org/n4", "org/n1")
+	if _, ok := n.placements["org/other"]; ok {
+		t.Errorf("nodes should only be held back for policies with a placement")
+	} else if _, ok := n.placements["org/bp"]["org/n2"]; ok {
+		t.Errorf("node with an agreement should no longer be held back")
+	}
+
+	n.releasePlacementNode("org/bp", exchange.SearchResultDevice{Id: "org/n1"})
+	if len(n.placements["org/bp"]) != 0 {
+		t.Errorf("no nodes should be held back: %v", n.placements["org/bp"])
+	}
+}
+
+// The agreement attempts queued by a search count against the placement of the next searches until they are in the
+// database or the protocol timeout has passed.
+func Test_NodeSearch_placement_queued_attempts(t *testing.T) {
+	n := NewNodeSearch()
+	n.attemptTimeoutS = 60
+	for _, id := range []string{"org/n1", "org/n2", "org/n3"} {
+		n.pass.nodeProperties[id] = cachedNodeProperties{props: externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", "s1")}}
+	}
+	placement := &businesspolicy.Placement{Limits: []businesspolicy.PlacementLimit{{Property: "store", Max: 1}}}
+
+	tracker, err := n.newPlacementTracker("org/bp", placement, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if allowed, _, _ := tracker.allows("org/n1"); !allowed {
+		t.Fatalf("the first node should be allowed")
+	}
+	tracker.placed("org/n1")
+
+	// The next search sees the queued attempt although it is not in the database yet.
+	tracker, _ = n.newPlacementTracker("org/bp", placement, nil)
+	if !tracker.queued("org/n1") {
+		t.Errorf("the attempt with n1 should be queued")
+	} else if allowed, _, _ := tracker.allows("org/n2"); allowed {
+		t.Errorf("n2 should be held back by the queued attempt")
+	}
+
+	// Once the attempt is in the database it is counted from there.
+	ags := map[string][]persistence.Agreement{"Basic": {{DeviceId: "org/n1", PolicyName: "org/bp"}}}
+	tracker, _ = n.newPlacementTracker("org/bp", placement, ags)
+	if tracker.queued("org/n1") {
+		t.Errorf("the attempt with n1 is in the database")
+	} else if tracker.valueCounts["store"]["s1"] != 1 {
+		t.Errorf("the attempt should be counted once, counts: %v", tracker.valueCounts)
+	}
+
+	// An attempt that never reaches the database stops counting after the protocol timeout.
+	n.placementAttempts["org/bp"]["org/n3"] = time.Now().Add(-2 * time.Minute)
+	tracker, _ = n.newPlacementTracker("org/bp", placement, nil)
+	if tracker.queued("org/n3") {
+		t.Errorf("the attempt with n3 should have expired")
+	} else if allowed, _, _ := tracker.allows("org/n2"); !allowed {
+		t.Errorf("n2 should be allowed")
+	}
+}
+
+// The placement checker of the compatibility check APIs reads the agreements once and does not count the node being checked.
+func Test_placementChecker(t *testing.T) {
+	db := new(memory.AgbotMemoryDB)
+	if err := db.Initialize(&config.HorizonConfig{AgreementBot: config.AGConfig{InMemoryDB: true}}); err != nil {
+		t.Fatalf("unable to initialize the database, error: %v", err)
+	} else if err := db.AgreementAttempt("ag1", "org", "org/old1", "device", "org/bp", "", "", "", policy.BasicProtocol, "", []string{"IBM/gps_1.0.0_amd64"}, policy.NodeHealth{}); err != nil {
+		t.Fatalf("unable to create agreement, error: %v", err)
+	}
+
+	lookups := 0
+	c := &placementChecker{
+		db: db,
+		nodeProperties: func(nodeId string) (externalpolicy.PropertyList, error) {
+			lookups += 1
+			return externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", "s1")}, nil
+		},
+	}
+
+	bp := &businesspolicy.BusinessPolicy{Placement: &businesspolicy.Placement{Limits: []businesspolicy.PlacementLimit{{Property: "store", Max: 1}}}}
+	output := func(nodeId string) *compcheck.CompCheckOutput {
+		return &compcheck.CompCheckOutput{
+			Compatible: true,
+			Reason:     map[string]string{"org/svc": "Compatible"},
+			Input: &compcheck.CompCheckResource{
+				NodeId:         nodeId,
+				NodePolicy:     &externalpolicy.ExternalPolicy{Properties: externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", "s1")}},
+				BusinessPolId:  "org/bp",
+				BusinessPolicy: bp,
+			},
+		}
+	}
+
+	if out := output("org/n1"); c.check(out, nil) != nil || out.Compatible {
+		t.Errorf("n1 should be held back by the agreement with old1, got %v", out)
+	} else if out := output("org/old1"); c.check(out, nil) != nil || !out.Compatible {
+		t.Errorf("old1 should not be counted against itself, got %v", out)
+	}
+
+	if err := db.AgreementAttempt("ag2", "org", "org/old2", "device", "org/bp", "", "", "", policy.BasicProtocol, "", []string{}, policy.NodeHealth{}); err != nil {
+		t.Fatalf("unable to create agreement, error: %v", err)
+	} else if out := output("org/n2"); c.check(out, nil) != nil || out.Compatible {
+		t.Errorf("n2 should be held back, got %v", out)
+	} else if len(c.agreements) != 1 {
+		t.Errorf("the agreements should be read once per request, got %v", c.agreements)
+	}
+}
@@ -47,19 +47,9 @@ func AssignObjectToNode(ec exchange.ExchangeContext, objPolicies *exchange.Objec
 			// Evaluate the object policy against the edge node policy. If the object policy is compatible, then place the object
 			// on the node for the current agreement.
 
-			// Convert the object's policy into an internal policy so that we can do the compatibility check.
-			internalObjPol := policy.Policy_Factory(fmt.Sprintf("object policy for %v type %v", objPol.ObjectID, objPol.ObjectType))
-			internalObjPol.Properties = objPol.DestinationPolicy.Properties
-			internalObjPol.Constraints = objPol.DestinationPolicy.Constraints
-			glog.V(5).Infof(opLogstring(fmt.Sprintf("converted object policy to: %v", internalObjPol)))
-
-			// temporary fix - eliminate node constraints so that models can be deployed without repeating business policy
-			// properties plus service policy properties in the model policy properties.
-			nodePolicy.Constraints = []string{}
-
 			// Check if node and model polices are compatible. Incompatible policies are not necessarily an error so just log a warning and return.
-			if err := policy.Are_Compatible(nodePolicy, internalObjPol, nil); err != nil {
-				glog.Warningf(opLogstring(fmt.Sprintf("error matching node policy %v and object policy %v, error: %v", nodePolicy, internalObjPol, err)))
+			if err := checkObjectPolicy(&objPol, nodePolicy); err != nil {
+				glog.Warningf(opLogstring(fmt.Sprintf("error matching node policy %v and object policy %v, error: %v", nodePolicy, objPol.DestinationPolicy, err)))
 				return false, nil
 			} else {
 				glog.V(3).Infof(opLogstring(fmt.Sprintf("node %v is compatible with object %v/%v with type %v", nodeId, objPol.OrgID, objPol.ObjectID, objPol.ObjectType)))
@@ -90,7 +80,7 @@ func AssignObjectToNode(ec exchange.ExchangeContext, objPolicies *exchange.Objec
 		}
 
 		if !found {
-			(*pdlr) = append((*pdlr), "openhorizon.edgenode:"+exchange.GetId(nodeId))
+			(*pdlr) = append((*pdlr), CSS_DEST_TYPE_EDGE_NODE+":"+exchange.GetId(nodeId))
 
 			// The update could fail if the object has been deleted in this small window.
 			if err := updateDestHandler(objPol.OrgID, &objPol, pdlr); err != nil {
@@ -105,6 +95,22 @@ func AssignObjectToNode(ec exchange.ExchangeContext, objPolicies *exchange.Objec
 	return true, nil
 }
 
+// Check the object's policy against the node policy. The node's constraints are not checked.
+func checkObjectPolicy(objPol *exchange.ObjectDestinationPolicy, nodePolicy *policy.Policy) error {
+
+	// Convert the object's policy into an internal policy so that we can do the compatibility check.
+	internalObjPol := policy.Policy_Factory(fmt.Sprintf("object policy for %v type %v", objPol.ObjectID, objPol.ObjectType))
+	internalObjPol.Properties = objPol.DestinationPolicy.Properties
+	internalObjPol.Constraints = objPol.DestinationPolicy.Constraints
+	glog.V(5).Infof(opLogstring(fmt.Sprintf("converted object policy to: %v", internalObjPol)))
+
+	// temporary fix - eliminate node constraints so that models can be deployed without repeating business policy
+	// properties plus service policy properties in the model policy properties.
+	nodePolicy.Constraints = []string{}
+
+	return policy.Are_Compatible(nodePolicy, internalObjPol, nil)
+}
+
 // This function is called to remove an object from a node. It is assumed that the caller has already done the
 // policy compatibility check.
 func UnassignObjectFromNode(ec exchange.ExchangeContext, objPol *exchange.ObjectDestinationPolicy, nodeId string) error {
@@ -3,6 +3,7 @@ package agreementbot
 import (
 	"fmt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/config"
 	"sync"
 	"time"
 )
@@ -11,27 +12,32 @@ import (
 // The high priority inbound channel can inject work into the workers even when the low priority queue is non-empty.
 // Essentially, this allows high priority work to skip to the front of the line for the worker threads.
 // Each inbound channel also has a buffer which holds inbound work that hasnt yet been dispatched to a worker. This
-// ensures that high priority work generators dont block for very long.
+// ensures that high priority work generators dont block for very long. The low priority buffer is shared fairly between
+// orgs, see fairQueue.
 type PrioritizedWorkQueue struct {
 	inboundHigh         chan *AgreementWork // This is the high priority inbound channel.
 	workQueueBufferHigh []*AgreementWork    // The internal work queue buffer for the high inbound channel.
 
 	inboundLow         chan *AgreementWork // This is the low priority inbound channel.
-	workQueueBufferLow []*AgreementWork    // The internal work queue buffer for the low inbound channel.
+	workQueueBufferLow *fairQueue          // The internal work queue buffer for the low inbound channel, with a lane per org.
 
 	recv       chan *AgreementWork // This is the channel where workers listen/block for work.
+	wake       chan bool           // Wakes up the queue when a worker finishes, so that an org at its in-flight limit can be served.
 	bufferLock sync.Mutex          // A lock that protects access to the work queue buffers.
 
 	bufferSize uint64 // The (rough) maximum queue depth that should not be exceeded without blocking. This is immutable once constructed.
 }
 
-func NewPrioritizedWorkQueue(bufferSize uint64) *PrioritizedWorkQueue {
+// The attemptTimeout is the longest time that an agreement attempt can count against the in-flight limit of its org while
+// it waits for the node, zero for no limit.
+func NewPrioritizedWorkQueue(bufferSize uint64, fairness config.WorkQueueFairnessConfig, attemptTimeout time.Duration) *PrioritizedWorkQueue {
 	n := &PrioritizedWorkQueue{
 		inboundHigh:         make(chan *AgreementWork, bufferSize),
 		workQueueBufferHigh: make([]*AgreementWork, 0, bufferSize*2),
 		inboundLow:          make(chan *AgreementWork, bufferSize),
-		workQueueBufferLow:  make([]*AgreementWork, 0, bufferSize*2),
+		workQueueBufferLow:  newFairQueue(fairness, attemptTimeout),
 		recv:                make(chan *AgreementWork),
+		wake:                make(chan bool, 1),
 		bufferSize:          bufferSize,
 	}
 
@@ -83,7 +89,54 @@ func (n *PrioritizedWorkQueue) Receive() chan *AgreementWork {
 func (n *PrioritizedWorkQueue) TotalBufferedWork() int {
 	n.bufferLock.Lock()
 	defer n.bufferLock.Unlock()
-	return len(n.workQueueBufferHigh) + len(n.workQueueBufferLow)
+	return len(n.workQueueBufferHigh) + n.workQueueBufferLow.length
+}
+
+// Workers call this function when they have finished with a work item, so that the agreement attempts in progress for
+// each org can be counted.
+func (n *PrioritizedWorkQueue) Done(w *AgreementWork) {
+	n.bufferLock.Lock()
+	n.workQueueBufferLow.done(w)
+	n.bufferLock.Unlock()
+	n.wakeUp()
+}
+
+// Workers call this function instead of Done when they have sent the proposal of a new agreement attempt. The attempt
+// stays in progress until Resolved is called for the agreement.
+func (n *PrioritizedWorkQueue) Sent(w *AgreementWork, agreementId string) {
+	n.bufferLock.Lock()
+	defer n.bufferLock.Unlock()
+	n.workQueueBufferLow.sent(w, agreementId, time.Now())
+}
+
+// Workers call this function when the node replied to the proposal of an agreement or the agreement was cancelled.
+func (n *PrioritizedWorkQueue) Resolved(agreementId string) {
+	n.bufferLock.Lock()
+	released := n.workQueueBufferLow.resolved(agreementId)
+	n.bufferLock.Unlock()
+	if released {
+		n.wakeUp()
+	}
+}
+
+func (n *PrioritizedWorkQueue) wakeUp() {
+	select {
+	case n.wake <- true:
+	default:
+	}
+}
+
+// Returns the depth of the queue, and the depth and wait time of each org.
+func (n *PrioritizedWorkQueue) Status() WorkQueueStatus {
+	n.bufferLock.Lock()
+	defer n.bufferLock.Unlock()
+	lanes, inFlight := n.workQueueBufferLow.status(time.Now())
+	return WorkQueueStatus{
+		HighDepth: len(n.workQueueBufferHigh),
+		LowDepth:  n.workQueueBufferLow.length,
+		Lanes:     lanes,
+		InFlight:  inFlight,
+	}
 }
 
 func (n *PrioritizedWorkQueue) HighPriorityBufferLen() int {
@@ -114,31 +167,37 @@ func (n *PrioritizedWorkQueue) AddToHighPriorityBuffer(w *AgreementWork) {
 func (n *PrioritizedWorkQueue) LowPriorityBufferLen() int {
 	n.bufferLock.Lock()
 	defer n.bufferLock.Unlock()
-	return len(n.workQueueBufferLow)
+	return n.workQueueBufferLow.length
 }
 
-func (n *PrioritizedWorkQueue) GetLowPriorityBufferHead() *AgreementWork {
+// Returns the lane that should be served next and the work at its head. The work is nil when none of the queued work can be
+// served because the orgs are at their in-flight limit.
+func (n *PrioritizedWorkQueue) GetLowPriorityBufferHead() (string, *AgreementWork) {
 	n.bufferLock.Lock()
 	defer n.bufferLock.Unlock()
-	head := n.workQueueBufferLow[0]
-	return head
+	n.workQueueBufferLow.expire(time.Now())
+	return n.workQueueBufferLow.next()
 }
-func (n *PrioritizedWorkQueue) RemoveLowPriorityBufferHead() {
+
+func (n *PrioritizedWorkQueue) RemoveLowPriorityBufferHead(lane string) {
 	n.bufferLock.Lock()
 	defer n.bufferLock.Unlock()
-	n.workQueueBufferLow = n.workQueueBufferLow[1:]
+	n.workQueueBufferLow.remove(lane, time.Now())
 }
 
 func (n *PrioritizedWorkQueue) AddToLowPriorityBuffer(w *AgreementWork) {
 	n.bufferLock.Lock()
 	defer n.bufferLock.Unlock()
-	n.workQueueBufferLow = append(n.workQueueBufferLow, w)
+	n.workQueueBufferLow.add(w, time.Now())
 }
 
 const HIGH_PRIORITY = "high"
 const LOW_PRIORITY = "low"
 const BOTH_PRIORITY = "both"
 
+// How often the queue checks for expired agreement attempts while the low priority work is held back by the in-flight limits.
+const ATTEMPT_EXPIRY_CHECK = 10 * time.Second
+
 // This function loops forever buffering items between the Send and Receive channels until the Send
 // channels are closed.
 func (n *PrioritizedWorkQueue) run() {
@@ -153,7 +212,12 @@ func (n *PrioritizedWorkQueue) run() {
 	// will be given preference within the select statement.
 	var inLowChan chan *AgreementWork
 
+	// A timer that fires while all of the queued low priority work is held back by the in-flight limits, so that the
+	// attempts that were never resolved can expire.
+	var expireChan <-chan time.Time
+
 	whichInbound := ""
+	lowLane := ""
 
 	for {
 		if n.inboundHigh == nil && n.HighPriorityBufferLen() == 0 {
@@ -164,6 +228,7 @@ func (n *PrioritizedWorkQueue) run() {
 
 		// Assume that the select should ONLY block on the inbound channels.
 		recvChan = nil
+		expireChan = nil
 
 		// However, if there is bufferd work, the select will use the channel that worker threads are blocked on. This
 		// will allow work to be passed to a worker.
@@ -173,9 +238,14 @@ func (n *PrioritizedWorkQueue) run() {
 			recvVal = n.GetHighPriorityBufferHead()
 			whichInbound = HIGH_PRIORITY
 		} else if n.LowPriorityBufferLen() > 0 {
-			recvChan = n.recv
-			recvVal = n.GetLowPriorityBufferHead()
-			whichInbound = LOW_PRIORITY
+			if lane, head := n.GetLowPriorityBufferHead(); head != nil {
+				recvChan = n.recv
+				recvVal = head
+				lowLane = lane
+				whichInbound = LOW_PRIORITY
+			} else {
+				expireChan = time.After(ATTEMPT_EXPIRY_CHECK)
+			}
 		}
 
 		// Assume that low priority inbound work is being accepted.
@@ -209,12 +279,17 @@ func (n *PrioritizedWorkQueue) run() {
 				glog.V(3).Infof(pwqString("closing inbound low"))
 				n.inboundLow = nil
 			}
+		case <-n.wake:
+			// A worker finished, an org that was at its in-flight limit might have work that can be served now.
+			glog.V(5).Infof(pwqString("worker done"))
+		case <-expireChan:
+			glog.V(5).Infof(pwqString("checking for expired agreement attempts"))
 		case recvChan <- recvVal:
 			glog.V(5).Infof(pwqString(fmt.Sprintf("receiving %v", *recvVal)))
 			if whichInbound == HIGH_PRIORITY {
 				n.RemoveHighPriorityBufferHead()
 			} else if whichInbound == LOW_PRIORITY {
-				n.RemoveLowPriorityBufferHead()
+				n.RemoveLowPriorityBufferHead(lowLane)
 			}
 		}
 	}
@@ -4,6 +4,10 @@ package agreementbot
 
 import (
 	"flag"
+	"fmt"
+	"github.com/open-horizon/anax/config"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
 	"testing"
 	"time"
 )
@@ -15,7 +19,7 @@ func init() {
 }
 
 func Test_PrioritizedWorkQueue_serial(t *testing.T) {
-	nbc := NewPrioritizedWorkQueue(uint64(100))
+	nbc := NewPrioritizedWorkQueue(uint64(100), config.WorkQueueFairnessConfig{}, 0)
 	if nbc == nil {
 		t.Errorf("constructor should return non-nil object")
 	}
@@ -50,7 +54,7 @@ func Test_PrioritizedWorkQueue_concurrent_priority_mix(t *testing.T) {
 	const QSIZE = uint64(100)
 
 	// Make the internal buffer smaller to force the work queue-ing thread to give up control once in a while.
-	nbc := NewPrioritizedWorkQueue(10)
+	nbc := NewPrioritizedWorkQueue(10, config.WorkQueueFairnessConfig{}, 0)
 	if nbc == nil {
 		t.Errorf("constructor should return non-nil object")
 	}
@@ -129,3 +133,173 @@ func workerThread(t *testing.T, nbc *PrioritizedWorkQueue, worklist *[]uint) {
 
 	}
 }
+
+func newTestInitiate(org string, policyName string, device string) *AgreementWork {
+	wi := NewInitiateAgreement(policy.Policy{}, policy.Policy{}, org, exchange.SearchResultDevice{Id: device}, policyName, nil)
+	return &wi
+}
+
+// Test that a large burst of work from one org does not starve the other orgs, and that the weights are honored.
+func Test_FairQueue_weights(t *testing.T) {
+
+	fq := newFairQueue(config.WorkQueueFairnessConfig{Weights: map[string]int{"org2": 2}}, 0)
+	now := time.Now()
+
+	for i := 0; i < 100; i++ {
+		fq.add(newTestInitiate("org1", "pol1", fmt.Sprintf("org1/node%v", i)), now)
+	}
+	for i := 0; i < 10; i++ {
+		fq.add(newTestInitiate("org2", "pol2", fmt.Sprintf("org2/node%v", i)), now)
+		fq.add(newTestInitiate("org3", "pol3", fmt.Sprintf("org3/node%v", i)), now)
+	}
+
+	// In the first 20 work items, org2 should get twice as many as org1 and org3, leaving org2 with nothing queued.
+	served := map[string]int{}
+	for i := 0; i < 20; i++ {
+		lane, w := fq.next()
+		if w == nil {
+			t.Fatalf("expected work to be available")
+		}
+		served[(*w).(InitiateAgreement).Org] += 1
+		fq.remove(lane, now)
+	}
+	if served["org2"] != 10 || served["org1"] != 5 || served["org3"] != 5 {
+		t.Errorf("expected org2 to be served twice as often as org1 and org3, got %v", served)
+	}
+
+	if fq.length != 100 {
+		t.Errorf("expected 100 queued work items, got %v", fq.length)
+	}
+	if lanes, inFlight := fq.status(now); len(lanes) != 2 || lanes["org1"].Depth != 95 || lanes["org3"].Depth != 5 || inFlight["org2"] != 10 {
+		t.Errorf("unexpected status %v %v", lanes, inFlight)
+	}
+}
+
+// Test the per org in-flight limit, and the lanes per deployment policy.
+func Test_FairQueue_max_in_flight(t *testing.T) {
+
+	fq := newFairQueue(config.WorkQueueFairnessConfig{ByPolicy: true, MaxInFlight: 2, OrgMaxInFlight: map[string]int{"org2": 0}}, 0)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		fq.add(newTestInitiate("org1", "pol1", fmt.Sprintf("org1/node%v", i)), now)
+		fq.add(newTestInitiate("org1", "pol2", fmt.Sprintf("org1/node%v", i)), now)
+	}
+
+	taken := make([]*AgreementWork, 0)
+	for {
+		lane, w := fq.next()
+		if w == nil {
+			break
+		}
+		fq.remove(lane, now)
+		taken = append(taken, w)
+	}
+
+	if len(taken) != 2 {
+		t.Fatalf("expected 2 work items before the in-flight limit, got %v", len(taken))
+	} else if (*taken[0]).(InitiateAgreement).ConsumerPolicyName == (*taken[1]).(InitiateAgreement).ConsumerPolicyName {
+		t.Errorf("expected one work item from each policy lane, got %v %v", (*taken[0]).ShortString(), (*taken[1]).ShortString())
+	}
+
+	// Finishing an attempt allows the next one.
+	fq.done(taken[0])
+	if lane, w := fq.next(); w == nil {
+		t.Errorf("expected work to be available after an attempt finished")
+	} else if lane != "org1/pol1" && lane != "org1/pol2" {
+		t.Errorf("unexpected lane %v", lane)
+	} else {
+		fq.remove(lane, now)
+	}
+
+	// org2 has no limit, and org1 is at its limit again.
+	for i := 0; i < 5; i++ {
+		fq.add(newTestInitiate("org2", "pol1", fmt.Sprintf("org2/node%v", i)), now)
+	}
+	for i := 0; i < 5; i++ {
+		if lane, w := fq.next(); w == nil || lane != "org2/pol1" {
+			t.Fatalf("expected org2 work, got %v", lane)
+		} else {
+			fq.remove(lane, now)
+		}
+	}
+}
+
+// Test that the work queue serves an org that was at its in-flight limit when a worker finishes.
+func Test_PrioritizedWorkQueue_done(t *testing.T) {
+
+	nbc := NewPrioritizedWorkQueue(10, config.WorkQueueFairnessConfig{MaxInFlight: 1}, 0)
+
+	nbc.InboundLow() <- newTestInitiate("org1", "pol1", "org1/node1")
+	nbc.InboundLow() <- newTestInitiate("org1", "pol1", "org1/node2")
+
+	first := <-nbc.Receive()
+
+	select {
+	case w := <-nbc.Receive():
+		t.Errorf("expected the second work item to wait for the first one, got %v", (*w).ShortString())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if status := nbc.Status(); status.LowDepth != 1 || status.InFlight["org1"] != 1 || status.Lanes["org1"].Depth != 1 {
+		t.Errorf("unexpected status %v", status)
+	}
+
+	nbc.Done(first)
+
+	select {
+	case w := <-nbc.Receive():
+		if (*w).(InitiateAgreement).Device.Id != "org1/node2" {
+			t.Errorf("unexpected work %v", (*w).ShortString())
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the second work item after the first one was done")
+	}
+
+	nbc.Close()
+	time.Sleep(10 * time.Millisecond)
+}
+
+// Test that an attempt whose proposal was sent keeps its in-flight slot until the agreement is resolved or the attempt expires.
+func Test_FairQueue_sent(t *testing.T) {
+
+	fq := newFairQueue(config.WorkQueueFairnessConfig{MaxInFlight: 1}, time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		fq.add(newTestInitiate("org1", "pol1", fmt.Sprintf("org1/node%v", i)), now)
+	}
+
+	lane, w := fq.next()
+	fq.remove(lane, now)
+	fq.sent(w, "ag1", now)
+
+	if _, w := fq.next(); w != nil {
+		t.Errorf("expected the org to be at its limit while the proposal waits for a reply")
+	} else if fq.resolved("unknown") {
+		t.Errorf("an unknown agreement should not release a slot")
+	} else if !fq.resolved("ag1") {
+		t.Errorf("the agreement should release its slot")
+	} else if fq.resolved("ag1") {
+		t.Errorf("the agreement should release its slot only once")
+	}
+
+	lane, w = fq.next()
+	if w == nil {
+		t.Fatalf("expected work to be available after the agreement was resolved")
+	}
+	fq.remove(lane, now)
+	fq.sent(w, "ag2", now)
+
+	fq.expire(now.Add(30 * time.Second))
+	if _, w := fq.next(); w != nil {
+		t.Errorf("expected the attempt to hold its slot before the attempt timeout")
+	}
+
+	fq.expire(now.Add(2 * time.Minute))
+	if _, w := fq.next(); w == nil {
+		t.Errorf("expected the slot to be released after the attempt timeout")
+	} else if _, inFlight := fq.status(now); len(inFlight) != 0 || len(fq.pending) != 0 {
+		t.Errorf("unexpected attempts in progress %v %v", inFlight, fq.pending)
+	}
+}
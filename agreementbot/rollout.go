@@ -0,0 +1,239 @@
+package agreementbot
+
+import (
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/policy"
+	"time"
+)
+
+// A deployment policy with a rollout section is deployed in steps. Each step allows more nodes to have an agreement for
+// the policy. The node search keeps track of the nodes that it found for the policy, and holds back the nodes that would
+// take the rollout over the limit of the current step. The held back nodes are offered an agreement when the rollout
+// moves to the next step. The progress of the rollout is saved in the database, the nodes found and held back are kept
+// in memory. When the agbot restarts, the nodes are found again by searching for all the nodes that are compatible
+// with the policy.
+
+// The in memory state of a rollout.
+type rolloutNodes struct {
+	policyUpdated uint64                                 // The policy change time that this state belongs to.
+	found         map[string]bool                        // The ids of the nodes found since the rollout started.
+	pending       map[string]exchange.SearchResultDevice // The nodes held back by the rollout, keyed by node id.
+}
+
+func newRolloutNodes(policyUpdated uint64) *rolloutNodes {
+	return &rolloutNodes{
+		policyUpdated: policyUpdated,
+		found:         make(map[string]bool),
+		pending:       make(map[string]exchange.SearchResultDevice),
+	}
+}
+
+// The agreements that the success criteria of a rollout are applied to.
+type rolloutCounts struct {
+	active    int // Agreements that are not archived or timed out.
+	succeeded int // Active agreements that have been finalized long enough.
+	failed    int // Agreements made since the rollout started that timed out or were terminated by a failure.
+}
+
+// Count the agreements for a deployment policy that the rollout success criteria are based on.
+func (n *NodeSearch) countRolloutAgreements(policyName string, ro *businesspolicy.RolloutPolicy, rolloutStart uint64) (rolloutCounts, error) {
+
+	counts := rolloutCounts{}
+	now := uint64(time.Now().Unix())
+
+	policyFilter := func(a persistence.Agreement) bool { return a.PolicyName == policyName }
+
+	for _, agp := range policy.AllAgreementProtocols() {
+		agreements, err := n.db.FindAgreements([]persistence.AFilter{policyFilter}, agp)
+		if err != nil {
+			return counts, err
+		}
+
+		for _, ag := range agreements {
+			if ag.Archived || ag.AgreementTimedout != 0 || ag.TerminatedReason != 0 {
+				if ag.AgreementInceptionTime >= rolloutStart && (ag.AgreementTimedout != 0 || (n.ph.Has(agp) && n.ph.Get(agp).IsTerminationReasonFailure(ag.TerminatedReason))) {
+					counts.failed += 1
+				}
+			} else {
+				counts.active += 1
+				if ag.AgreementFinalizedTime != 0 && now-ag.AgreementFinalizedTime >= uint64(ro.Success.RunningS) {
+					counts.succeeded += 1
+				}
+			}
+		}
+	}
+	return counts, nil
+}
+
+// Move the rollout forward based on the current agreement counts. The rollout is paused when too many agreements have failed.
+// The rollout moves to the next step when the wait time has passed, the current step is full (or there are no more nodes to
+// add to it) and enough of the agreements meet the success criteria. Returns true when the rollout moved to a new step.
+func updateRolloutState(ro *businesspolicy.RolloutPolicy, rs *persistence.RolloutState, counts rolloutCounts, pending int, now uint64) bool {
+
+	rs.Active = counts.active
+	rs.Succeeded = counts.succeeded
+	rs.Failed = counts.failed
+
+	if rs.State != persistence.ROLLOUT_IN_PROGRESS {
+		return false
+	}
+
+	if attempted := counts.active + counts.failed; counts.failed > 0 && counts.failed*100 > ro.GetMaxFailedPercent()*attempted {
+		rs.State = persistence.ROLLOUT_PAUSED
+		rs.Reason = fmt.Sprintf("%v of %v agreements failed, the maximum is %v%%", counts.failed, attempted, ro.GetMaxFailedPercent())
+		return false
+	}
+
+	limit, complete := ro.StepLimit(rs.Step, rs.Nodes)
+	advanced := false
+
+	if !complete && counts.active > 0 &&
+		(counts.active >= limit || pending == 0) &&
+		now-rs.StepStarted >= uint64(ro.StepWaitS) &&
+		counts.succeeded*100 >= ro.GetFinalizedPercent()*counts.active {
+
+		rs.Step += 1
+		rs.StepStarted = now
+		limit, complete = ro.StepLimit(rs.Step, rs.Nodes)
+		advanced = true
+	}
+
+	rs.Limit = limit
+	if complete {
+		rs.State = persistence.ROLLOUT_COMPLETE
+	}
+	return advanced
+}
+
+// Get the rollout state for a deployment policy ready for a node search. The nodes found by the search are added to the
+// rollout, the rollout is moved forward if possible and the nodes to process are returned, which includes the nodes that
+// were held back by previous searches. The returned allowance is the number of new agreements that the rollout allows,
+// it is negative when there is no limit.
+func (n *NodeSearch) startRolloutSearch(policyName string, ro *businesspolicy.RolloutPolicy, polLastUpdateTime uint64, devices []exchange.SearchResultDevice, ags map[string][]persistence.Agreement) (*persistence.RolloutState, []exchange.SearchResultDevice, int, error) {
+
+	now := uint64(time.Now().Unix())
+
+	rs, err := n.db.GetRolloutState(policyName)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	nodes, ok := n.rollouts[policyName]
+	if rs == nil || rs.PolicyUpdated != polLastUpdateTime {
+		// The policy is new or it has changed, so start the rollout from the beginning.
+		glog.V(3).Infof(AWlogString(fmt.Sprintf("starting rollout for %v: %v", policyName, ro)))
+		rs = &persistence.RolloutState{
+			PolicyName:    policyName,
+			PolicyUpdated: polLastUpdateTime,
+			StepStarted:   now,
+			State:         persistence.ROLLOUT_IN_PROGRESS,
+		}
+		nodes = newRolloutNodes(polLastUpdateTime)
+		n.rollouts[policyName] = nodes
+
+	} else if !ok || nodes.policyUpdated != polLastUpdateTime {
+		// The agbot restarted, so the nodes held back by the rollout are not known. Search for all the nodes again and
+		// restart the wait time of the current step so that the step does not end before the held back nodes are found.
+		glog.V(3).Infof(AWlogString(fmt.Sprintf("resuming rollout for %v at step %v", policyName, rs.Step)))
+		rs.StepStarted = now
+		nodes = newRolloutNodes(polLastUpdateTime)
+		n.rollouts[policyName] = nodes
+		n.AddRetry(policyName, 1)
+	}
+
+	// Nodes that have an agreement are no longer held back.
+	for _, agreements := range ags {
+		for _, ag := range agreements {
+			delete(nodes.pending, ag.DeviceId)
+		}
+	}
+
+	candidates := make([]exchange.SearchResultDevice, 0, len(devices)+len(nodes.pending))
+	for _, dev := range devices {
+		nodes.found[dev.Id] = true
+		if _, held := nodes.pending[dev.Id]; held {
+			// Keep the latest copy of the node from the exchange.
+			nodes.pending[dev.Id] = dev
+		} else {
+			candidates = append(candidates, dev)
+		}
+	}
+	for _, dev := range nodes.pending {
+		candidates = append(candidates, dev)
+	}
+
+	if len(nodes.found) > rs.Nodes {
+		rs.Nodes = len(nodes.found)
+	}
+
+	counts, err := n.countRolloutAgreements(policyName, ro, rs.PolicyUpdated)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if updateRolloutState(ro, rs, counts, len(nodes.pending), now) {
+		glog.V(3).Infof(AWlogString(fmt.Sprintf("rollout for %v moved to step %v, limit %v nodes", policyName, rs.Step, rs.Limit)))
+	}
+
+	allowance := 0
+	switch rs.State {
+	case persistence.ROLLOUT_COMPLETE:
+		allowance = -1
+	case persistence.ROLLOUT_IN_PROGRESS:
+		if rs.Limit > counts.active {
+			allowance = rs.Limit - counts.active
+		}
+		// Keep searching so that the rollout can move to the next step.
+		n.SetRescanNeeded()
+	case persistence.ROLLOUT_PAUSED:
+		glog.Warningf(AWlogString(fmt.Sprintf("rollout for %v is paused, %v", policyName, rs.Reason)))
+	}
+
+	return rs, candidates, allowance, nil
+}
+
+// Record the outcome of a node search in the rollout state.
+func (n *NodeSearch) finishRolloutSearch(rs *persistence.RolloutState) {
+	if err := n.db.SaveRolloutState(rs); err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to save rollout state %v, error: %v", rs, err)))
+	}
+}
+
+// Hold back a node because the rollout does not allow more agreements.
+func (n *NodeSearch) holdBackRolloutNode(policyName string, dev exchange.SearchResultDevice) {
+	if nodes, ok := n.rollouts[policyName]; ok {
+		nodes.pending[dev.Id] = dev
+	}
+}
+
+// The node has been sent a proposal, so it is no longer held back.
+func (n *NodeSearch) releaseRolloutNode(policyName string, dev exchange.SearchResultDevice) {
+	if nodes, ok := n.rollouts[policyName]; ok {
+		delete(nodes.pending, dev.Id)
+	}
+}
+
+// Remove the rollout state of deployment policies that no longer exist or no longer have a rollout section.
+func (n *NodeSearch) pruneRollouts() {
+	states, err := n.db.FindRolloutStates()
+	if err != nil {
+		glog.Errorf(AWlogString(fmt.Sprintf("unable to find rollout states, error: %v", err)))
+		return
+	}
+
+	for _, rs := range states {
+		org, _ := cutil.SplitOrgSpecUrl(rs.PolicyName)
+		if pBE := businessPolManager.GetBusinessPolicyEntry(org, policy.Policy_Factory(rs.PolicyName)); pBE == nil || pBE.Rollout == nil {
+			glog.V(3).Infof(AWlogString(fmt.Sprintf("removing rollout state for %v", rs.PolicyName)))
+			delete(n.rollouts, rs.PolicyName)
+			if err := n.db.DeleteRolloutState(rs.PolicyName); err != nil {
+				glog.Errorf(AWlogString(fmt.Sprintf("unable to delete rollout state for %v, error: %v", rs.PolicyName, err)))
+			}
+		}
+	}
+}
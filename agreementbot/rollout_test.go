@@ -0,0 +1,98 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/businesspolicy"
+	"testing"
+)
+
+func newTestRolloutState(nodes int) *persistence.RolloutState {
+	return &persistence.RolloutState{PolicyName: "myorg/mypol", PolicyUpdated: 1000, StepStarted: 1000, Nodes: nodes, State: persistence.ROLLOUT_IN_PROGRESS}
+}
+
+func Test_updateRolloutState_steps(t *testing.T) {
+
+	ro := &businesspolicy.RolloutPolicy{InitialPercent: 10, StepPercent: 40, StepWaitS: 60}
+	rs := newTestRolloutState(100)
+
+	// The first step is limited to 10 nodes.
+	if updateRolloutState(ro, rs, rolloutCounts{}, 0, 1000) {
+		t.Errorf("the rollout should not move to the next step without agreements")
+	} else if rs.Limit != 10 || rs.State != persistence.ROLLOUT_IN_PROGRESS {
+		t.Errorf("wrong state for the first step: %v", rs)
+	}
+
+	// The step is full but the wait time has not passed.
+	if updateRolloutState(ro, rs, rolloutCounts{active: 10, succeeded: 10}, 5, 1030) {
+		t.Errorf("the rollout should not move to the next step before the wait time")
+	}
+
+	// The step is full but not all agreements are finalized.
+	if updateRolloutState(ro, rs, rolloutCounts{active: 10, succeeded: 9}, 5, 1060) {
+		t.Errorf("the rollout should not move to the next step before all agreements are finalized")
+	}
+
+	// The step is not full and there are nodes held back.
+	if updateRolloutState(ro, rs, rolloutCounts{active: 8, succeeded: 8}, 5, 1060) {
+		t.Errorf("the rollout should not move to the next step before it is full")
+	}
+
+	// Everything is good, move to the next step.
+	if !updateRolloutState(ro, rs, rolloutCounts{active: 10, succeeded: 10}, 5, 1060) {
+		t.Errorf("the rollout should have moved to the next step")
+	} else if rs.Step != 1 || rs.Limit != 50 || rs.StepStarted != 1060 {
+		t.Errorf("wrong state for the second step: %v", rs)
+	}
+
+	// The last step includes all the nodes.
+	if !updateRolloutState(ro, rs, rolloutCounts{active: 50, succeeded: 50}, 0, 1120) {
+		t.Errorf("the rollout should have moved to the next step")
+	} else if rs.Step != 2 || rs.Limit != 90 || rs.State != persistence.ROLLOUT_IN_PROGRESS {
+		t.Errorf("wrong state for the third step: %v", rs)
+	} else if !updateRolloutState(ro, rs, rolloutCounts{active: 90, succeeded: 90}, 0, 1180) {
+		t.Errorf("the rollout should have moved to the last step")
+	} else if rs.State != persistence.ROLLOUT_COMPLETE || rs.Limit != 100 {
+		t.Errorf("the rollout should be complete: %v", rs)
+	} else if updateRolloutState(ro, rs, rolloutCounts{active: 100, succeeded: 100}, 0, 1240) {
+		t.Errorf("a complete rollout should not move")
+	}
+}
+
+func Test_updateRolloutState_pause(t *testing.T) {
+
+	ro := &businesspolicy.RolloutPolicy{InitialCount: 10, StepCount: 10, Success: businesspolicy.RolloutSuccess{MaxFailedPercent: 20}}
+	rs := newTestRolloutState(100)
+
+	// 2 of 10 failed agreements is not more than the maximum.
+	updateRolloutState(ro, rs, rolloutCounts{active: 8, succeeded: 2, failed: 2}, 0, 1000)
+	if rs.State != persistence.ROLLOUT_IN_PROGRESS {
+		t.Errorf("the rollout should not be paused: %v", rs)
+	}
+
+	updateRolloutState(ro, rs, rolloutCounts{active: 7, succeeded: 2, failed: 3}, 0, 1000)
+	if rs.State != persistence.ROLLOUT_PAUSED || rs.Reason == "" || rs.Failed != 3 {
+		t.Errorf("the rollout should be paused: %v", rs)
+	}
+
+	// A paused rollout stays paused.
+	if updateRolloutState(ro, rs, rolloutCounts{active: 10, succeeded: 10}, 0, 5000) || rs.State != persistence.ROLLOUT_PAUSED {
+		t.Errorf("the rollout should still be paused: %v", rs)
+	}
+}
+
+func Test_updateRolloutState_few_nodes(t *testing.T) {
+
+	// The step is not full, but no nodes are held back, so the rollout moves on.
+	ro := &businesspolicy.RolloutPolicy{InitialCount: 10, StepCount: 10}
+	rs := newTestRolloutState(25)
+
+	if !updateRolloutState(ro, rs, rolloutCounts{active: 5, succeeded: 5}, 0, 1000) {
+		t.Errorf("the rollout should have moved to the next step")
+	} else if rs.Step != 1 || rs.Limit != 20 {
+		t.Errorf("wrong state for the second step: %v", rs)
+	} else if updateRolloutState(ro, rs, rolloutCounts{active: 20, succeeded: 20}, 5, 1000); rs.State != persistence.ROLLOUT_COMPLETE {
+		t.Errorf("the rollout should be complete: %v", rs)
+	}
+}
@@ -0,0 +1,95 @@
+package agreementbot
+
+import (
+	"github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/policy"
+)
+
+// The data about the nodes that the node rankers and the placement checks read while the node search makes a pass over
+// the deployment policies. The same nodes are found for many policies and on every page of a search, so each node policy,
+// each org's node heartbeats and the agreement counts are read at most once per pass. The data can be as old as the pass,
+// which is fine for ordering and placing the nodes, an agreement attempt reads the node again before it is made. The cache
+// is only used on the search thread.
+type searchPassCache struct {
+	nodeProperties  map[string]cachedNodeProperties
+	heartbeats      map[string]cachedHeartbeats
+	agreementCounts map[string]int
+	countErr        error
+}
+
+type cachedNodeProperties struct {
+	props externalpolicy.PropertyList
+	err   error
+}
+
+type cachedHeartbeats struct {
+	heartbeats map[string]int64 // the last heartbeat of each node in the org, in seconds since the epoch
+	err        error
+}
+
+func newSearchPassCache() *searchPassCache {
+	return &searchPassCache{
+		nodeProperties: make(map[string]cachedNodeProperties),
+		heartbeats:     make(map[string]cachedHeartbeats),
+	}
+}
+
+// Start a new pass of the node search, the data read in the previous pass is forgotten.
+func (n *NodeSearch) startSearchPass() {
+	n.pass = newSearchPassCache()
+}
+
+// Returns the properties in the policy of a node in the exchange.
+func (n *NodeSearch) getNodeProperties(nodeId string) (externalpolicy.PropertyList, error) {
+	if cached, ok := n.pass.nodeProperties[nodeId]; ok {
+		return cached.props, cached.err
+	}
+	props, err := getNodeProperties(exchange.GetHTTPNodePolicyHandler(n.ec), nodeId)
+	n.pass.nodeProperties[nodeId] = cachedNodeProperties{props: props, err: err}
+	return props, err
+}
+
+// Returns the time of the last heartbeat of a node. The nodes of an org are read from the exchange in one call.
+func (n *NodeSearch) getLastHeartbeat(nodeId string) (int64, error) {
+	org := exchange.GetOrg(nodeId)
+	cached, ok := n.pass.heartbeats[org]
+	if !ok {
+		cached = cachedHeartbeats{heartbeats: make(map[string]int64)}
+		if devs, err := exchange.GetOrgDevices(n.ec, org); err != nil {
+			cached.err = err
+		} else {
+			for id, dev := range devs {
+				if dev.LastHeartbeat != "" {
+					cached.heartbeats[id] = cutil.TimeInSeconds(dev.LastHeartbeat, cutil.ExchangeTimeFormat)
+				}
+			}
+		}
+		n.pass.heartbeats[org] = cached
+	}
+	return cached.heartbeats[nodeId], cached.err
+}
+
+// Returns the number of current agreements of each node, for all policies.
+func (n *NodeSearch) getAgreementCounts() (map[string]int, error) {
+	if n.pass.agreementCounts != nil || n.pass.countErr != nil {
+		return n.pass.agreementCounts, n.pass.countErr
+	}
+
+	counts := make(map[string]int)
+	activeFilter := func(a persistence.Agreement) bool { return a.AgreementTimedout == 0 }
+	for _, agp := range policy.AllAgreementProtocols() {
+		if agreements, err := n.db.FindAgreements([]persistence.AFilter{persistence.UnarchivedAFilter(), activeFilter}, agp); err != nil {
+			n.pass.countErr = err
+			return nil, err
+		} else {
+			for _, ag := range agreements {
+				counts[ag.DeviceId] += 1
+			}
+		}
+	}
+	n.pass.agreementCounts = counts
+	return counts, nil
+}
@@ -3,6 +3,7 @@
 // @APIDescription This is the secure API for the agreement bot.
 // @BasePath https://host:port/
 // @SubApi Deployment Check API [/deploycheck]
+// @SubApi Model Management Service API [/mms]
 
 package agreementbot
 
@@ -18,7 +19,9 @@ import (
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/events"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
 	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/policy"
 	"github.com/open-horizon/anax/worker"
 	"golang.org/x/text/message"
 	"io/ioutil"
@@ -35,6 +38,8 @@ type SecureAPI struct {
 	httpClient     *http.Client // a shared HTTP client instance for this worker
 	em             *events.EventStateManager
 	shutdownError  string
+	sessions       *secureAPISessions
+	audit          *secureAPIAuditLog
 }
 
 func NewSecureAPIListener(name string, config *config.HorizonConfig, db persistence.AgbotDatabase, configFile string) *SecureAPI {
@@ -49,6 +54,8 @@ func NewSecureAPIListener(name string, config *config.HorizonConfig, db persiste
 		name:       name,
 		db:         db,
 		em:         events.NewEventStateManager(),
+		sessions:   newSecureAPISessions(time.Duration(config.GetSecureAPITokenTTL()) * time.Second),
+		audit:      newSecureAPIAuditLog(SECURE_API_AUDIT_LOG_SIZE),
 	}
 
 	listener.listen()
@@ -156,6 +163,11 @@ func (a *SecureAPI) listen() {
 		router.HandleFunc("/deploycheck/policycompatible", a.policy_compatible).Methods("GET", "OPTIONS")
 		router.HandleFunc("/deploycheck/userinputcompatible", a.userinput_compatible).Methods("GET", "OPTIONS")
 		router.HandleFunc("/deploycheck/deploycompatible", a.deploy_compatible).Methods("GET", "OPTIONS")
+		router.HandleFunc("/deploycheck/impact", a.deploy_impact).Methods("GET", "OPTIONS")
+		router.HandleFunc("/deploycheck/matrix", a.deploy_matrix).Methods("GET", "OPTIONS")
+		router.HandleFunc("/mms/status/{org}", a.object_status).Methods("GET", "OPTIONS")
+		router.HandleFunc("/token", a.token).Methods("POST", "DELETE", "OPTIONS")
+		router.HandleFunc("/audit", a.auditLog).Methods("GET", "OPTIONS")
 
 		apiListen := fmt.Sprintf("%v:%v", apiListenHost, apiListenPort)
 
@@ -177,6 +189,7 @@ func (a *SecureAPI) listen() {
 // @Produce json
 // @Param   checkAll     		query    bool     false        "Return the compatibility check result for all the service versions referenced in the business policy or pattern."
 // @Param   long         		query    bool     false        "Show the input which was used to come up with the result."
+// @Param   explain      		query    bool     false        "Show how the constraints of each side were evaluated against the properties of the other side."
 // @Param   node_id      		body     string   false        "The exchange id of the node. Mutually exclusive with node_policy."
 // @Param   node_arch    		body     string   false        "The architecture of the node."
 // @Param   node_policy  		body     externalpolicy.ExternalPolicy     false        "The node policy that will be put in the exchange. Mutually exclusive with node_id."
@@ -186,6 +199,7 @@ func (a *SecureAPI) listen() {
 // @Success 200 {object}  compcheck.CompCheckOutput
 // @Failure 400 {object}  string      "No input found"
 // @Failure 401 {object}  string      "Failed to authenticate"
+// @Failure 403 {object}  string      "Role not allowed"
 // @Failure 500 {object}  string      "Error"
 // @Resource /deploycheck
 // @Router /deploycheck/policycompatible [get]
@@ -197,7 +211,7 @@ func (a *SecureAPI) policy_compatible(w http.ResponseWriter, r *http.Request) {
 		glog.V(5).Infof(APIlogString(fmt.Sprintf("/deploycheck/policycompatible called.")))
 
 		// check user cred
-		if user_ec, msgPrinter, ok := a.processUserCred("/deploycheck/policycompatible", w, r); ok {
+		if user_ec, msgPrinter, ok := a.processUserCred("/deploycheck/policycompatible", SECURE_API_ROLE_READ_ONLY, w, r); ok {
 			body, _ := ioutil.ReadAll(r.Body)
 			if len(body) == 0 {
 				glog.Errorf(APIlogString(fmt.Sprintf("No input found.")))
@@ -208,9 +222,19 @@ func (a *SecureAPI) policy_compatible(w http.ResponseWriter, r *http.Request) {
 				// if checkAll is set, then check all the services defined in the business policy for compatibility.
 				checkAll := r.URL.Query().Get("checkAll")
 
+				// if explain is set, then return the evaluation of the constraints for each service.
+				if r.URL.Query().Get("explain") != "" {
+					input.Explain = true
+				}
+
 				// do policy compatibility check
 				output, err := compcheck.PolicyCompatible(user_ec, input, (checkAll != ""), msgPrinter)
 
+				// check the placement of the deployment policy against the agreements of this agbot
+				if err == nil {
+					err = a.newPlacementChecker(compcheck.NewExchangeCache(user_ec)).check(output, msgPrinter)
+				}
+
 				// nil out the policies in the output if 'long' is not set in the request
 				long := r.URL.Query().Get("long")
 				if long == "" && output != nil {
@@ -247,6 +271,7 @@ func (a *SecureAPI) policy_compatible(w http.ResponseWriter, r *http.Request) {
 // @Success 200 {object}  compcheck.CompCheckOutput
 // @Failure 400 {object}  string      "No input found"
 // @Failure 401 {object}  string      "Failed to authenticate"
+// @Failure 403 {object}  string      "Role not allowed"
 // @Failure 500 {object}  string      "Error"
 // @Resource /deploycheck
 // @Router /deploycheck/userinputcompatible [get]
@@ -257,7 +282,7 @@ func (a *SecureAPI) userinput_compatible(w http.ResponseWriter, r *http.Request)
 	case "GET":
 		glog.V(5).Infof(APIlogString(fmt.Sprintf("/deploycheck/userinputcompatible called.")))
 
-		if user_ec, msgPrinter, ok := a.processUserCred("/deploycheck/userinputcompatible", w, r); ok {
+		if user_ec, msgPrinter, ok := a.processUserCred("/deploycheck/userinputcompatible", SECURE_API_ROLE_READ_ONLY, w, r); ok {
 			body, _ := ioutil.ReadAll(r.Body)
 			if len(body) == 0 {
 				glog.Errorf(APIlogString(fmt.Sprintf("No input found.")))
@@ -309,6 +334,7 @@ func (a *SecureAPI) userinput_compatible(w http.ResponseWriter, r *http.Request)
 // @Success 200 {object}  compcheck.CompCheckOutput
 // @Failure 400 {object}  string      "No input found"
 // @Failure 401 {object}  string      "Failed to authenticate"
+// @Failure 403 {object}  string      "Role not allowed"
 // @Failure 500 {object}  string      "Error"
 // @Resource /deploycheck
 // @Router /deploycheck/deploycompatible [get]
@@ -319,7 +345,7 @@ func (a *SecureAPI) deploy_compatible(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		glog.V(5).Infof(APIlogString(fmt.Sprintf("/deploycheck/deploycompatible called.")))
 
-		if user_ec, msgPrinter, ok := a.processUserCred("/deploycheck/deploycompatible", w, r); ok {
+		if user_ec, msgPrinter, ok := a.processUserCred("/deploycheck/deploycompatible", SECURE_API_ROLE_READ_ONLY, w, r); ok {
 			body, _ := ioutil.ReadAll(r.Body)
 			if len(body) == 0 {
 				glog.Errorf(APIlogString(fmt.Sprintf("No input found.")))
@@ -333,6 +359,11 @@ func (a *SecureAPI) deploy_compatible(w http.ResponseWriter, r *http.Request) {
 				// do user input compatibility check
 				output, err := compcheck.DeployCompatible(user_ec, input, (checkAll != ""), msgPrinter)
 
+				// check the placement of the deployment policy against the agreements of this agbot
+				if err == nil {
+					err = a.newPlacementChecker(compcheck.NewExchangeCache(user_ec)).check(output, msgPrinter)
+				}
+
 				// nil out the details in the output if 'long' is not set in the request
 				long := r.URL.Query().Get("long")
 				if long == "" && output != nil {
@@ -352,30 +383,234 @@ func (a *SecureAPI) deploy_compatible(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// This function checks user cred and writes corrsponding response. It also creates a message printer with given language from the http request.
-func (a *SecureAPI) processUserCred(resource string, w http.ResponseWriter, r *http.Request) (exchange.ExchangeContext, *message.Printer, bool) {
-	// get message printer with the language passed in from the header
-	lan := r.Header.Get("Accept-Language")
-	if lan == "" {
-		lan = i18n.DEFAULT_LANGUAGE
+// @Title deploy_impact
+// @Description Show the impact of a change to a deployment policy. The proposed deployment policy is checked for policy, user input and placement compatibility with all the nodes in the organizations that this agbot serves the policy to, and the result is compared with the current agreements for the policy in all the partitions of the agbot database, including the agreements made by other agbots that share the database. The output lists the nodes that would gain an agreement, keep their agreement or lose it.
+// @Accept  json
+// @Produce json
+// @Param   business_policy_id  body     string   true         "The exchange id of the deployment policy, in the format of org/name."
+// @Param   business_policy  	body     businesspolicy.BusinessPolicy     false        "The proposed deployment policy. If omitted, the deployment policy will be retrieved from the exchange."
+// @Param   service_policy  	body     externalpolicy.ExternalPolicy     false        "The proposed service policy for the top level service referenced in the deployment policy. If omitted, the service policy will be retrieved from the exchange."
+// @Success 200 {object}  agreementbot.DeployImpactOutput
+// @Failure 400 {object}  string      "No input found"
+// @Failure 401 {object}  string      "Failed to authenticate"
+// @Failure 403 {object}  string      "Role not allowed"
+// @Failure 500 {object}  string      "Error"
+// @Resource /deploycheck
+// @Router /deploycheck/impact [get]
+// This function shows the impact of a deployment policy change on the nodes.
+func (a *SecureAPI) deploy_impact(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		glog.V(5).Infof(APIlogString(fmt.Sprintf("/deploycheck/impact called.")))
+
+		if user_ec, msgPrinter, ok := a.processUserCred("/deploycheck/impact", SECURE_API_ROLE_ORG_USER, w, r); ok {
+			body, _ := ioutil.ReadAll(r.Body)
+			if len(body) == 0 {
+				glog.Errorf(APIlogString(fmt.Sprintf("No input found.")))
+				writeResponse(w, msgPrinter.Sprintf("No input found."), http.StatusBadRequest)
+			} else if input, err := a.decodeImpactCheckBody(body, msgPrinter); err != nil {
+				writeResponse(w, err.Error(), http.StatusBadRequest)
+			} else {
+				output, err := a.deployImpact(user_ec, input, msgPrinter)
+				a.writeCompCheckResponse(w, output, err, msgPrinter)
+			}
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
-	msgPrinter := i18n.GetMessagePrinterWithLocale(lan)
+}
 
-	// check user cred
-	userId, userPasswd, ok := r.BasicAuth()
-	if !ok {
-		glog.Errorf(APIlogString(fmt.Sprintf("%v is called without exchange authentication.", resource)))
-		writeResponse(w, msgPrinter.Sprintf("Unauthorized. No exchange user id is supplied."), http.StatusUnauthorized)
-		return nil, nil, false
-	} else if user_ec, err := a.authenticateWithExchange(userId, userPasswd, msgPrinter); err != nil {
-		glog.Errorf(APIlogString(fmt.Sprintf("Failed to authenticate user %v with the Exchange. %v", userId, err)))
-		writeResponse(w, msgPrinter.Sprintf("Failed to authenticate the user with the Exchange. %v", err), http.StatusUnauthorized)
+// Check the proposed deployment policy against all the nodes in the orgs that the policy is served to and compare
+// the result with the current agreements.
+func (a *SecureAPI) deployImpact(user_ec exchange.ExchangeContext, input *DeployImpactCheck, msgPrinter *message.Printer) (*DeployImpactOutput, error) {
+
+	polOrg, polName := cutil.SplitOrgSpecUrl(input.BusinessPolId)
+	if polOrg == "" || polName == "" {
+		return nil, compcheck.NewCompCheckError(fmt.Errorf(msgPrinter.Sprintf("The deployment policy id %v must be in the format of org/name.", input.BusinessPolId)), compcheck.COMPCHECK_INPUT_ERROR)
+	} else if businessPolManager == nil {
+		return nil, fmt.Errorf(msgPrinter.Sprintf("The agbot is not ready to serve deployment policies."))
+	}
+
+	nodeOrgs := businessPolManager.GetServedNodeOrgs(polOrg, polName)
+	if len(nodeOrgs) == 0 {
+		return nil, compcheck.NewCompCheckError(fmt.Errorf(msgPrinter.Sprintf("Deployment policy %v is not served by this agbot.", input.BusinessPolId)), compcheck.COMPCHECK_INPUT_ERROR)
+	}
+
+	nodes := make(map[string]exchange.Device)
+	for _, org := range nodeOrgs {
+		if devs, err := exchange.GetOrgDevices(user_ec, org); err != nil {
+			return nil, fmt.Errorf(msgPrinter.Sprintf("Failed to get the nodes in organization %v from the exchange. %v", org, err))
+		} else {
+			for id, dev := range devs {
+				nodes[id] = dev
+			}
+		}
+	}
+
+	// The agreements are read from all the partitions in the database, so that the agreements made by the other agbots
+	// that share the database are compared too.
+	partitions, err := a.db.FindPartitions()
+	if err != nil {
+		return nil, fmt.Errorf(msgPrinter.Sprintf("Failed to get the partitions from the database. %v", err))
+	}
+
+	agreements := make([]persistence.Agreement, 0)
+	seen := make(map[string]bool)
+	for _, partition := range partitions {
+		if seen[partition] {
+			continue
+		}
+		seen[partition] = true
+		for _, protocol := range policy.AllAgreementProtocols() {
+			if ags, err := a.db.FindAgreementsInPartition(partition, []persistence.AFilter{persistence.UnarchivedAFilter()}, protocol); err != nil {
+				return nil, fmt.Errorf(msgPrinter.Sprintf("Failed to get the %v agreements in partition %v from the database. %v", protocol, partition, err))
+			} else {
+				agreements = append(agreements, ags...)
+			}
+		}
+	}
+
+	glog.V(5).Infof(APIlogString(fmt.Sprintf("checking the impact of %v on %v nodes in %v", input, len(nodes), nodeOrgs)))
+
+	// The deployment policy, its services and service policies are read from the exchange once for all the nodes.
+	cache := compcheck.NewExchangeCache(user_ec)
+	cache.AddDevices(nodes)
+	placement := a.newPlacementChecker(cache)
+
+	// A node is compatible when it is compatible with the policy and the placement of the policy allows it, the same as
+	// in the node search.
+	check := func(nodeId string) (*compcheck.CompCheckOutput, error) {
+		ccInput := compcheck.CompCheck{
+			NodeId:         nodeId,
+			BusinessPolId:  input.BusinessPolId,
+			BusinessPolicy: input.BusinessPolicy,
+			ServicePolicy:  input.ServicePolicy,
+		}
+		output, err := cache.DeployCompatible(&ccInput, false, msgPrinter)
+		if err == nil {
+			err = placement.check(output, msgPrinter)
+		}
+		return output, err
+	}
+
+	return evaluateDeployImpact(input.BusinessPolId, nodeOrgs, nodes, agreements, check), nil
+}
+
+// @Title deploy_matrix
+// @Description Check a list of deployment policies and patterns against a list of nodes, or against all the nodes in an organization. Each node and deployment is checked the same way as the /deploycheck/deploycompatible API does. The output is a matrix with a row for each node and a column for each deployment.
+// @Accept  json
+// @Produce json
+// @Param   business_policy_ids  body     []string   false        "The exchange ids of the deployment policies, in the format of org/name."
+// @Param   pattern_ids          body     []string   false        "The exchange ids of the patterns, in the format of org/name."
+// @Param   node_ids             body     []string   false        "The exchange ids of the nodes, in the format of org/id. Mutually exclusive with node_org."
+// @Param   node_org             body     string     false        "Check all the nodes in the organization. Mutually exclusive with node_ids."
+// @Param   node_selector        body     externalpolicy.ConstraintExpression     false        "Only check the nodes whose node policy properties satisfy the constraints."
+// @Success 200 {object}  agreementbot.DeployMatrixOutput
+// @Failure 400 {object}  string      "No input found"
+// @Failure 401 {object}  string      "Failed to authenticate"
+// @Failure 403 {object}  string      "Role not allowed"
+// @Failure 500 {object}  string      "Error"
+// @Resource /deploycheck
+// @Router /deploycheck/matrix [get]
+// This function checks the compatibility of deployments with nodes.
+func (a *SecureAPI) deploy_matrix(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		glog.V(5).Infof(APIlogString(fmt.Sprintf("/deploycheck/matrix called.")))
+
+		if user_ec, msgPrinter, ok := a.processUserCred("/deploycheck/matrix", SECURE_API_ROLE_READ_ONLY, w, r); ok {
+			body, _ := ioutil.ReadAll(r.Body)
+			if len(body) == 0 {
+				glog.Errorf(APIlogString(fmt.Sprintf("No input found.")))
+				writeResponse(w, msgPrinter.Sprintf("No input found."), http.StatusBadRequest)
+			} else if input, err := a.decodeMatrixCheckBody(body, msgPrinter); err != nil {
+				writeResponse(w, err.Error(), http.StatusBadRequest)
+			} else {
+				output, err := a.deployMatrix(user_ec, input, msgPrinter)
+				a.writeCompCheckResponse(w, output, err, msgPrinter)
+			}
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Check every deployment in the input against every node that is selected.
+func (a *SecureAPI) deployMatrix(user_ec exchange.ExchangeContext, input *DeployMatrixCheck, msgPrinter *message.Printer) (*DeployMatrixOutput, error) {
+
+	nodes := make(map[string]exchange.Device)
+	for _, org := range input.NodeOrgs() {
+		if devs, err := exchange.GetOrgDevices(user_ec, org); err != nil {
+			return nil, fmt.Errorf(msgPrinter.Sprintf("Failed to get the nodes in organization %v from the exchange. %v", org, err))
+		} else {
+			for id, dev := range devs {
+				nodes[id] = dev
+			}
+		}
+	}
+
+	glog.V(5).Infof(APIlogString(fmt.Sprintf("checking the compatibility matrix of %v with %v nodes", input, len(nodes))))
+
+	// Each deployment policy, pattern, service, service policy and node policy is read from the exchange once, for the
+	// first cell that needs it, the other cells are checked with the copy in the cache.
+	cache := compcheck.NewExchangeCache(user_ec)
+	cache.AddDevices(nodes)
+
+	nodePolicyHandler := cache.NodePolicyHandler()
+	nodeProperties := func(nodeId string) (externalpolicy.PropertyList, error) {
+		return getNodeProperties(nodePolicyHandler, nodeId)
+	}
+
+	placement := a.newPlacementChecker(cache)
+
+	check := func(nodeId string, deployment DeployMatrixDeployment) (*compcheck.CompCheckOutput, error) {
+		ccInput := compcheck.CompCheck{NodeId: nodeId}
+		if deployment.Type == DEPLOY_MATRIX_PATTERN {
+			ccInput.PatternId = deployment.Id
+		} else {
+			ccInput.BusinessPolId = deployment.Id
+		}
+
+		output, err := cache.DeployCompatible(&ccInput, false, msgPrinter)
+		if err == nil {
+			err = placement.check(output, msgPrinter)
+		}
+		return output, err
+	}
+
+	return evaluateDeployMatrix(input, nodes, nodeProperties, check), nil
+}
+
+// This function checks user cred and the role required for the resource, and writes corrsponding response. It also creates a message printer with given language from the http request.
+func (a *SecureAPI) processUserCred(resource string, role string, w http.ResponseWriter, r *http.Request) (exchange.ExchangeContext, *message.Printer, bool) {
+	msgPrinter := getSecureAPIMessagePrinter(r)
+
+	if session := a.authorize(resource, role, true, w, r, msgPrinter); session == nil {
 		return nil, nil, false
 	} else {
-		return user_ec, msgPrinter, true
+		return session.ec, msgPrinter, true
 	}
 }
 
+// get message printer with the language passed in from the header
+func getSecureAPIMessagePrinter(r *http.Request) *message.Printer {
+	lan := r.Header.Get("Accept-Language")
+	if lan == "" {
+		lan = i18n.DEFAULT_LANGUAGE
+	}
+	return i18n.GetMessagePrinterWithLocale(lan)
+}
+
 // This function checks if file exits or not
 func fileExists(filename string) bool {
 	fileinfo, err := os.Stat(filename)
@@ -449,18 +684,59 @@ func (a *SecureAPI) decodeCompCheckBody(body []byte, msgPrinter *message.Printer
 	}
 }
 
-// This function verifies the given exchange user name and password.
+// Verify the input body from the /deploycheck/impact api and convert it to DeployImpactCheck
+func (a *SecureAPI) decodeImpactCheckBody(body []byte, msgPrinter *message.Printer) (*DeployImpactCheck, error) {
+
+	var js map[string]interface{}
+	if err := json.Unmarshal(body, &js); err != nil {
+		glog.Errorf(APIlogString(fmt.Sprintf("Input body couldn't be deserialized to JSON object. %v", err)))
+		return nil, fmt.Errorf(msgPrinter.Sprintf("Input body couldn't be deserialized to JSON object. %v", err))
+	} else {
+		var input DeployImpactCheck
+		if err := json.Unmarshal(body, &input); err != nil {
+			glog.Errorf(APIlogString(fmt.Sprintf("Input body couldn't be deserialized to DeployImpactCheck object. %v", err)))
+			return nil, fmt.Errorf(msgPrinter.Sprintf("Input body couldn't be deserialized to DeployImpactCheck object. %v", err))
+		} else if input.BusinessPolId == "" {
+			return nil, fmt.Errorf(msgPrinter.Sprintf("The deployment policy id must be specified."))
+		} else {
+			// verification of the policies is done in the compcheck component, no need to validate them here.
+			return &input, nil
+		}
+	}
+}
+
+// Verify the input body from the /deploycheck/matrix api and convert it to DeployMatrixCheck
+func (a *SecureAPI) decodeMatrixCheckBody(body []byte, msgPrinter *message.Printer) (*DeployMatrixCheck, error) {
+
+	var js map[string]interface{}
+	if err := json.Unmarshal(body, &js); err != nil {
+		glog.Errorf(APIlogString(fmt.Sprintf("Input body couldn't be deserialized to JSON object. %v", err)))
+		return nil, fmt.Errorf(msgPrinter.Sprintf("Input body couldn't be deserialized to JSON object. %v", err))
+	} else {
+		var input DeployMatrixCheck
+		if err := json.Unmarshal(body, &input); err != nil {
+			glog.Errorf(APIlogString(fmt.Sprintf("Input body couldn't be deserialized to DeployMatrixCheck object. %v", err)))
+			return nil, fmt.Errorf(msgPrinter.Sprintf("Input body couldn't be deserialized to DeployMatrixCheck object. %v", err))
+		} else if err := input.Validate(); err != nil {
+			return nil, fmt.Errorf(msgPrinter.Sprintf("The input is not valid. %v", err))
+		} else {
+			return &input, nil
+		}
+	}
+}
+
+// This function verifies the given exchange user name and password, and returns true if the user is an org admin.
 // The user must be in the format of orgId/userId.
-func (a *SecureAPI) authenticateWithExchange(user string, userPasswd string, msgPrinter *message.Printer) (exchange.ExchangeContext, error) {
+func (a *SecureAPI) authenticateWithExchange(user string, userPasswd string, msgPrinter *message.Printer) (exchange.ExchangeContext, bool, error) {
 	glog.V(5).Infof(APIlogString(fmt.Sprintf("authenticateWithExchange called with user %v", user)))
 
 	orgId, userId := cutil.SplitOrgSpecUrl(user)
 	if userId == "" {
-		return nil, fmt.Errorf(msgPrinter.Sprintf("No exchange user id is supplied."))
+		return nil, false, fmt.Errorf(msgPrinter.Sprintf("No exchange user id is supplied."))
 	} else if orgId == "" {
-		return nil, fmt.Errorf(msgPrinter.Sprintf("No exchange user organization id is supplied."))
+		return nil, false, fmt.Errorf(msgPrinter.Sprintf("No exchange user organization id is supplied."))
 	} else if userPasswd == "" {
-		return nil, fmt.Errorf(msgPrinter.Sprintf("No exchange user password or api key is supplied."))
+		return nil, false, fmt.Errorf(msgPrinter.Sprintf("No exchange user password or api key is supplied."))
 	}
 
 	user_ec := a.createUserExchangeContext(user, userPasswd)
@@ -479,20 +755,24 @@ func (a *SecureAPI) authenticateWithExchange(user string, userPasswd string, msg
 			glog.Errorf(APIlogString(err.Error()))
 
 			if strings.Contains(err.Error(), "401") {
-				return nil, fmt.Errorf(msgPrinter.Sprintf("Wrong organization id, user id or password."))
+				return nil, false, fmt.Errorf(msgPrinter.Sprintf("Wrong organization id, user id or password."))
 			} else {
-				return nil, err
+				return nil, false, err
 			}
 		} else if tpErr != nil {
 			glog.Warningf(APIlogString(tpErr.Error()))
 
 			if retryCount <= 0 {
-				return nil, fmt.Errorf("Exceeded %v retries for error: %v", user_ec.GetHTTPFactory().RetryCount, tpErr)
+				return nil, false, fmt.Errorf("Exceeded %v retries for error: %v", user_ec.GetHTTPFactory().RetryCount, tpErr)
 			}
 			time.Sleep(time.Duration(retryInterval) * time.Second)
 			continue
 		} else {
-			return user_ec, nil
+			admin := false
+			for _, u := range resp.(*exchange.GetUsersResponse).Users {
+				admin = u.Admin
+			}
+			return user_ec, admin, nil
 		}
 	}
 }
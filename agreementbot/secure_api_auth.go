@@ -0,0 +1,392 @@
+package agreementbot
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/exchange"
+	"golang.org/x/text/message"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Callers of the secure API are authenticated with the exchange once. The verified identity is then cached, both for a
+// bearer token issued by the /token API and for the basic credentials that were verified, so that repeated calls do
+// not go back to the exchange until the cached identity expires. Verified basic credentials are only cached for a short
+// time, so that a password that is changed or a user that is removed in the exchange is noticed soon. Each endpoint
+// requires a role, and each call is recorded in an audit log.
+
+// The roles of a secure API caller, from the least to the most privileged. Exchange org admins have the admin role,
+// other exchange users have the user role. A caller can ask for a token with a lower role than its own.
+const (
+	SECURE_API_ROLE_READ_ONLY = "readonly"
+	SECURE_API_ROLE_ORG_USER  = "user"
+	SECURE_API_ROLE_ORG_ADMIN = "admin"
+)
+
+var secureAPIRoles = map[string]int{SECURE_API_ROLE_READ_ONLY: 1, SECURE_API_ROLE_ORG_USER: 2, SECURE_API_ROLE_ORG_ADMIN: 3}
+
+// How a secure API caller was authenticated.
+const (
+	SECURE_API_AUTH_BASIC = "basic"
+	SECURE_API_AUTH_TOKEN = "token"
+)
+
+// The longest time that verified basic credentials are cached. Callers that make many calls should use a token.
+const SECURE_API_BASIC_AUTH_TTL = 60 * time.Second
+
+// The number of entries kept in the secure API audit log.
+const SECURE_API_AUDIT_LOG_SIZE = 1000
+
+type SecureAPIIdentity struct {
+	User string `json:"user"` // org/user
+	Org  string `json:"org"`
+	Role string `json:"role"`
+}
+
+func (i SecureAPIIdentity) String() string {
+	return fmt.Sprintf("User: %v, Org: %v, Role: %v", i.User, i.Org, i.Role)
+}
+
+// Returns true if the identity has the role or a more privileged role.
+func (i *SecureAPIIdentity) HasRole(role string) bool {
+	return secureAPIRoles[i.Role] >= secureAPIRoles[role]
+}
+
+// A verified identity and the exchange context used to make exchange calls on its behalf.
+type secureAPISession struct {
+	identity SecureAPIIdentity
+	ec       exchange.ExchangeContext
+	expires  time.Time
+}
+
+// The verified identities, keyed by token or by a hash of the basic credentials.
+type secureAPISessions struct {
+	lock     sync.Mutex
+	sessions map[string]*secureAPISession
+	ttl      time.Duration // how long a token is valid
+	basicTTL time.Duration // how long verified basic credentials are cached
+	now      func() time.Time
+}
+
+func newSecureAPISessions(ttl time.Duration) *secureAPISessions {
+	basicTTL := ttl
+	if basicTTL > SECURE_API_BASIC_AUTH_TTL {
+		basicTTL = SECURE_API_BASIC_AUTH_TTL
+	}
+	return &secureAPISessions{
+		sessions: make(map[string]*secureAPISession),
+		ttl:      ttl,
+		basicTTL: basicTTL,
+		now:      time.Now,
+	}
+}
+
+func tokenKey(token string) string {
+	return SECURE_API_AUTH_TOKEN + ":" + token
+}
+
+// The basic credentials are not kept as a key, only a hash of them.
+func basicKey(user string, passwd string) string {
+	sum := sha256.Sum256([]byte(user + ":" + passwd))
+	return SECURE_API_AUTH_BASIC + ":" + hex.EncodeToString(sum[:])
+}
+
+// Returns the session for the key, or nil if there is none or it has expired.
+func (s *secureAPISessions) get(key string) *secureAPISession {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if session, ok := s.sessions[key]; !ok {
+		return nil
+	} else if !s.now().Before(session.expires) {
+		delete(s.sessions, key)
+		return nil
+	} else {
+		return session
+	}
+}
+
+// Add a session for the identity that expires after the ttl, expired sessions are removed.
+func (s *secureAPISessions) add(key string, identity SecureAPIIdentity, ec exchange.ExchangeContext, ttl time.Duration) *secureAPISession {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	for k, session := range s.sessions {
+		if !now.Before(session.expires) {
+			delete(s.sessions, k)
+		}
+	}
+
+	session := &secureAPISession{identity: identity, ec: ec, expires: now.Add(ttl)}
+	s.sessions[key] = session
+	return session
+}
+
+func (s *secureAPISessions) remove(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.sessions, key)
+}
+
+// Add a session for verified basic credentials, it expires after the shorter basic ttl.
+func (s *secureAPISessions) addBasic(user string, passwd string, identity SecureAPIIdentity, ec exchange.ExchangeContext) *secureAPISession {
+	return s.add(basicKey(user, passwd), identity, ec, s.basicTTL)
+}
+
+// Create a new token for the identity.
+func (s *secureAPISessions) newToken(identity SecureAPIIdentity, ec exchange.ExchangeContext) (string, *secureAPISession, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", nil, err
+	}
+	token := hex.EncodeToString(bytes)
+	return token, s.add(tokenKey(token), identity, ec, s.ttl), nil
+}
+
+type SecureAPIAuditEntry struct {
+	Time     int64  `json:"time"`
+	User     string `json:"user"`
+	Org      string `json:"org"`
+	Role     string `json:"role,omitempty"`
+	Auth     string `json:"auth"` // basic or token
+	Endpoint string `json:"endpoint"`
+	Method   string `json:"method"`
+	Allowed  bool   `json:"allowed"`
+	Reason   string `json:"reason,omitempty"` // why the call was not allowed
+}
+
+func (e SecureAPIAuditEntry) String() string {
+	return fmt.Sprintf("Time: %v, User: %v, Org: %v, Role: %v, Auth: %v, Endpoint: %v, Method: %v, Allowed: %v, Reason: %v",
+		e.Time, e.User, e.Org, e.Role, e.Auth, e.Endpoint, e.Method, e.Allowed, e.Reason)
+}
+
+// The most recent calls to the secure API, oldest first.
+type secureAPIAuditLog struct {
+	lock    sync.Mutex
+	entries []SecureAPIAuditEntry
+	size    int
+}
+
+func newSecureAPIAuditLog(size int) *secureAPIAuditLog {
+	return &secureAPIAuditLog{entries: make([]SecureAPIAuditEntry, 0), size: size}
+}
+
+func (l *secureAPIAuditLog) add(entry SecureAPIAuditEntry) {
+	glog.V(3).Infof(APIlogString(fmt.Sprintf("secure API audit: %v", entry)))
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.entries = append(l.entries, entry)
+	if len(l.entries) >= 2*l.size {
+		l.entries = append(make([]SecureAPIAuditEntry, 0, 2*l.size), l.entries[len(l.entries)-l.size:]...)
+	}
+}
+
+// Returns the entries for the callers in the org.
+func (l *secureAPIAuditLog) list(org string) []SecureAPIAuditEntry {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	first := len(l.entries) - l.size
+	if first < 0 {
+		first = 0
+	}
+
+	entries := make([]SecureAPIAuditEntry, 0)
+	for _, e := range l.entries[first:] {
+		if e.Org == org {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Returns the bearer token from the Authorization header of the request.
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:]), true
+	}
+	return "", false
+}
+
+// Authenticate the caller with a token or with basic credentials, returns the session and how the caller was
+// authenticated. Basic credentials are only verified with the exchange when they are not cached. The user in the
+// audit entry is set as soon as it is known.
+func (a *SecureAPI) authenticate(r *http.Request, tokenAllowed bool, entry *SecureAPIAuditEntry, msgPrinter *message.Printer) (*secureAPISession, error) {
+	if token, ok := bearerToken(r); ok {
+		entry.Auth = SECURE_API_AUTH_TOKEN
+		if !tokenAllowed {
+			return nil, fmt.Errorf(msgPrinter.Sprintf("A token cannot be used to create a token, use the exchange user id and password."))
+		} else if session := a.sessions.get(tokenKey(token)); session == nil {
+			return nil, fmt.Errorf(msgPrinter.Sprintf("The token is not valid or has expired."))
+		} else {
+			return session, nil
+		}
+	}
+
+	entry.Auth = SECURE_API_AUTH_BASIC
+	userId, userPasswd, ok := r.BasicAuth()
+	if !ok {
+		return nil, fmt.Errorf(msgPrinter.Sprintf("No exchange user id is supplied."))
+	}
+	entry.User = userId
+	entry.Org, _ = cutil.SplitOrgSpecUrl(userId)
+
+	key := basicKey(userId, userPasswd)
+	if session := a.sessions.get(key); session != nil {
+		return session, nil
+	}
+
+	user_ec, admin, err := a.authenticateWithExchange(userId, userPasswd, msgPrinter)
+	if err != nil {
+		return nil, fmt.Errorf(msgPrinter.Sprintf("Failed to authenticate the user with the Exchange. %v", err))
+	}
+
+	identity := SecureAPIIdentity{User: userId, Org: entry.Org, Role: SECURE_API_ROLE_ORG_USER}
+	if admin {
+		identity.Role = SECURE_API_ROLE_ORG_ADMIN
+	}
+	return a.sessions.addBasic(userId, userPasswd, identity, user_ec), nil
+}
+
+// Authenticate the caller and check that it has the role required by the endpoint, the call is recorded in the audit
+// log. Writes the error response and returns nil if the caller is not allowed to call the endpoint.
+func (a *SecureAPI) authorize(resource string, role string, tokenAllowed bool, w http.ResponseWriter, r *http.Request, msgPrinter *message.Printer) *secureAPISession {
+	entry := SecureAPIAuditEntry{Time: time.Now().Unix(), Endpoint: resource, Method: r.Method}
+	defer func() { a.audit.add(entry) }()
+
+	session, err := a.authenticate(r, tokenAllowed, &entry, msgPrinter)
+	if err != nil {
+		glog.Errorf(APIlogString(fmt.Sprintf("%v is called without valid authentication. %v", resource, err)))
+		entry.Reason = err.Error()
+		writeResponse(w, msgPrinter.Sprintf("Unauthorized. %v", err), http.StatusUnauthorized)
+		return nil
+	}
+
+	entry.User = session.identity.User
+	entry.Org = session.identity.Org
+	entry.Role = session.identity.Role
+	if !session.identity.HasRole(role) {
+		glog.Errorf(APIlogString(fmt.Sprintf("%v is called by %v without the %v role.", resource, session.identity, role)))
+		entry.Reason = fmt.Sprintf("the %v role is required", role)
+		writeResponse(w, msgPrinter.Sprintf("Forbidden. The %v role is required.", role), http.StatusForbidden)
+		return nil
+	}
+
+	entry.Allowed = true
+	return session
+}
+
+// The body of a token request.
+type SecureAPITokenRequest struct {
+	Role string `json:"role,omitempty"` // The role of the token, the default is the role of the caller.
+}
+
+type SecureAPIToken struct {
+	Token   string `json:"token"`
+	Expires int64  `json:"expires"` // The time when the token expires, in seconds since the epoch.
+	User    string `json:"user"`
+	Role    string `json:"role"`
+}
+
+// @Title token
+// @Description Create a bearer token for the exchange user, or revoke the token used to call the API. The token can be used instead of the exchange user id and password to call the other APIs, until it expires. The token is created with the role of the user, or with a lower role.
+// @Accept  json
+// @Produce json
+// @Param   role     body     string   false        "The role of the token, readonly, user or admin. The default is the role of the user."
+// @Success 200 {object}  agreementbot.SecureAPIToken
+// @Failure 400 {object}  string      "Invalid input"
+// @Failure 401 {object}  string      "Failed to authenticate"
+// @Failure 403 {object}  string      "Role not allowed"
+// @Resource /token
+// @Router /token [post]
+// This function creates and revokes secure API tokens.
+func (a *SecureAPI) token(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "POST":
+		msgPrinter := getSecureAPIMessagePrinter(r)
+
+		var input SecureAPITokenRequest
+		if body, _ := ioutil.ReadAll(r.Body); len(body) != 0 {
+			if err := json.Unmarshal(body, &input); err != nil {
+				writeResponse(w, msgPrinter.Sprintf("Input body couldn't be deserialized to a token request. %v", err), http.StatusBadRequest)
+				return
+			} else if _, ok := secureAPIRoles[input.Role]; input.Role != "" && !ok {
+				writeResponse(w, msgPrinter.Sprintf("The role %v is not valid, the valid roles are %v, %v and %v.", input.Role, SECURE_API_ROLE_READ_ONLY, SECURE_API_ROLE_ORG_USER, SECURE_API_ROLE_ORG_ADMIN), http.StatusBadRequest)
+				return
+			}
+		}
+
+		role := input.Role
+		if role == "" {
+			role = SECURE_API_ROLE_READ_ONLY
+		}
+
+		if session := a.authorize("/token", role, false, w, r, msgPrinter); session != nil {
+			identity := session.identity
+			if input.Role != "" {
+				identity.Role = input.Role
+			}
+			if token, tokenSession, err := a.sessions.newToken(identity, session.ec); err != nil {
+				glog.Errorf(APIlogString(fmt.Sprintf("unable to create a token for %v, error: %v", identity, err)))
+				writeResponse(w, msgPrinter.Sprintf("Internal server error"), http.StatusInternalServerError)
+			} else {
+				writeResponse(w, SecureAPIToken{Token: token, Expires: tokenSession.expires.Unix(), User: identity.User, Role: identity.Role}, http.StatusOK)
+			}
+		}
+
+	case "DELETE":
+		msgPrinter := getSecureAPIMessagePrinter(r)
+
+		if token, ok := bearerToken(r); !ok {
+			writeResponse(w, msgPrinter.Sprintf("Unauthorized. No token is supplied."), http.StatusUnauthorized)
+		} else if session := a.authorize("/token", SECURE_API_ROLE_READ_ONLY, true, w, r, msgPrinter); session != nil {
+			a.sessions.remove(tokenKey(token))
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "POST, DELETE, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title audit
+// @Description List the most recent calls to the secure API by the users in the caller's organization. The org admin role is required.
+// @Produce json
+// @Success 200 {array}  agreementbot.SecureAPIAuditEntry
+// @Failure 401 {object}  string      "Failed to authenticate"
+// @Failure 403 {object}  string      "Role not allowed"
+// @Resource /audit
+// @Router /audit [get]
+// This function lists the secure API audit log.
+func (a *SecureAPI) auditLog(w http.ResponseWriter, r *http.Request) {
+
+	switch r.Method {
+	case "GET":
+		msgPrinter := getSecureAPIMessagePrinter(r)
+		if session := a.authorize("/audit", SECURE_API_ROLE_ORG_ADMIN, true, w, r, msgPrinter); session != nil {
+			writeResponse(w, a.audit.list(session.identity.Org), http.StatusOK)
+		}
+
+	case "OPTIONS":
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
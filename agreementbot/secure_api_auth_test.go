@@ -0,0 +1,180 @@
+// +build unit
+
+package agreementbot
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/open-horizon/anax/i18n"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_secureAPISessions(t *testing.T) {
+	now := time.Unix(1000, 0)
+	sessions := newSecureAPISessions(time.Minute)
+	sessions.now = func() time.Time { return now }
+
+	identity := SecureAPIIdentity{User: "org1/u1", Org: "org1", Role: SECURE_API_ROLE_ORG_USER}
+	token, session, err := sessions.newToken(identity, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(token) != 64 || session.expires != now.Add(time.Minute) {
+		t.Errorf("wrong token %v or expiry %v", token, session.expires)
+	}
+
+	key := basicKey("org1/u1", "secret")
+	if strings.Contains(key, "secret") {
+		t.Errorf("the password should not be in the key: %v", key)
+	}
+	if s := sessions.addBasic("org1/u1", "secret", identity, nil); s.expires != now.Add(time.Minute) {
+		t.Errorf("basic credentials should be cached for a minute at most, expire at %v", s.expires)
+	}
+
+	if s := sessions.get(tokenKey(token)); s == nil || s.identity != identity {
+		t.Errorf("token session should be found: %v", s)
+	} else if s := sessions.get(key); s == nil || s.identity != identity {
+		t.Errorf("basic session should be found: %v", s)
+	} else if s := sessions.get(basicKey("org1/u1", "wrong")); s != nil {
+		t.Errorf("session should not be found with the wrong password")
+	}
+
+	now = now.Add(time.Minute)
+	if s := sessions.get(tokenKey(token)); s != nil {
+		t.Errorf("token session should have expired: %v", s)
+	}
+
+	sessions.add(tokenKey("other"), identity, nil, sessions.ttl)
+	if len(sessions.sessions) != 1 {
+		t.Errorf("expired sessions should be removed: %v", sessions.sessions)
+	}
+}
+
+// Basic credentials are cached for a shorter time than a token is valid.
+func Test_secureAPISessions_basicTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	sessions := newSecureAPISessions(15 * time.Minute)
+	sessions.now = func() time.Time { return now }
+
+	identity := SecureAPIIdentity{User: "org1/u1", Org: "org1", Role: SECURE_API_ROLE_ORG_USER}
+	token, _, _ := sessions.newToken(identity, nil)
+	sessions.addBasic("org1/u1", "secret", identity, nil)
+
+	now = now.Add(SECURE_API_BASIC_AUTH_TTL)
+	if s := sessions.get(basicKey("org1/u1", "secret")); s != nil {
+		t.Errorf("basic session should have expired: %v", s)
+	} else if s := sessions.get(tokenKey(token)); s == nil {
+		t.Errorf("token session should not have expired")
+	}
+}
+
+func Test_SecureAPIIdentity_HasRole(t *testing.T) {
+	admin := SecureAPIIdentity{Role: SECURE_API_ROLE_ORG_ADMIN}
+	readOnly := SecureAPIIdentity{Role: SECURE_API_ROLE_READ_ONLY}
+
+	if !admin.HasRole(SECURE_API_ROLE_ORG_USER) || !admin.HasRole(SECURE_API_ROLE_READ_ONLY) {
+		t.Errorf("admin should have the lower roles")
+	} else if readOnly.HasRole(SECURE_API_ROLE_ORG_USER) || !readOnly.HasRole(SECURE_API_ROLE_READ_ONLY) {
+		t.Errorf("read only should only have the read only role")
+	} else if (&SecureAPIIdentity{}).HasRole(SECURE_API_ROLE_READ_ONLY) {
+		t.Errorf("an identity without a role should not have a role")
+	}
+}
+
+func Test_secureAPIAuditLog(t *testing.T) {
+	log := newSecureAPIAuditLog(2)
+	log.add(SecureAPIAuditEntry{User: "org1/u1", Org: "org1", Endpoint: "/a"})
+	log.add(SecureAPIAuditEntry{User: "org2/u2", Org: "org2", Endpoint: "/b"})
+	log.add(SecureAPIAuditEntry{User: "org1/u1", Org: "org1", Endpoint: "/c"})
+	log.add(SecureAPIAuditEntry{User: "org1/u1", Org: "org1", Endpoint: "/d"})
+
+	if entries := log.list("org1"); len(entries) != 2 || entries[0].Endpoint != "/c" || entries[1].Endpoint != "/d" {
+		t.Errorf("expected the last 2 entries of org1, got %v", entries)
+	} else if entries := log.list("org2"); len(entries) != 0 {
+		t.Errorf("entries of org2 should have been dropped: %v", entries)
+	}
+}
+
+func Test_SecureAPI_authorize(t *testing.T) {
+	a := &SecureAPI{sessions: newSecureAPISessions(time.Minute), audit: newSecureAPIAuditLog(10)}
+	msgPrinter := i18n.GetMessagePrinter()
+
+	token, _, _ := a.sessions.newToken(SecureAPIIdentity{User: "org1/ci", Org: "org1", Role: SECURE_API_ROLE_READ_ONLY}, nil)
+	a.sessions.addBasic("org1/admin", "pw", SecureAPIIdentity{User: "org1/admin", Org: "org1", Role: SECURE_API_ROLE_ORG_ADMIN}, nil)
+
+	request := func(method string, path string, body string) *http.Request {
+		return httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	}
+
+	// A read only token can call the compatibility checks but not the impact check.
+	r := request("GET", "/deploycheck/deploycompatible", "")
+	r.Header.Set("Authorization", "Bearer "+token)
+	if s := a.authorize("/deploycheck/deploycompatible", SECURE_API_ROLE_READ_ONLY, true, httptest.NewRecorder(), r, msgPrinter); s == nil {
+		t.Errorf("read only token should be allowed")
+	}
+	w := httptest.NewRecorder()
+	if s := a.authorize("/deploycheck/impact", SECURE_API_ROLE_ORG_USER, true, w, r, msgPrinter); s != nil || w.Code != http.StatusForbidden {
+		t.Errorf("read only token should be forbidden, got %v", w.Code)
+	}
+
+	r = request("GET", "/deploycheck/impact", "")
+	r.Header.Set("Authorization", "Bearer unknown")
+	w = httptest.NewRecorder()
+	if s := a.authorize("/deploycheck/impact", SECURE_API_ROLE_READ_ONLY, true, w, r, msgPrinter); s != nil || w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown token should be unauthorized, got %v", w.Code)
+	}
+
+	// The cached admin credentials create a token with a lower role.
+	r = request("POST", "/token", `{"role":"user"}`)
+	r.SetBasicAuth("org1/admin", "pw")
+	w = httptest.NewRecorder()
+	a.token(w, r)
+	var output SecureAPIToken
+	if w.Code != http.StatusOK {
+		t.Errorf("token should be created, got %v: %v", w.Code, w.Body.String())
+	} else if err := json.Unmarshal(w.Body.Bytes(), &output); err != nil {
+		t.Errorf("unable to demarshal token: %v", err)
+	} else if s := a.sessions.get(tokenKey(output.Token)); s == nil || s.identity.Role != SECURE_API_ROLE_ORG_USER || output.User != "org1/admin" {
+		t.Errorf("wrong token session %v for %v", s, output)
+	}
+
+	// A token cannot be used to create a token with a higher role.
+	r = request("POST", "/token", `{"role":"admin"}`)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	if a.token(w, r); w.Code != http.StatusUnauthorized {
+		t.Errorf("a token should not create a token, got %v", w.Code)
+	}
+
+	// The admin sees the audit entries of its org.
+	r = request("GET", "/audit", "")
+	r.Header.Set("Authorization", "Bearer "+output.Token)
+	w = httptest.NewRecorder()
+	if a.auditLog(w, r); w.Code != http.StatusForbidden {
+		t.Errorf("a user token should not list the audit log, got %v", w.Code)
+	}
+	r = request("GET", "/audit", "")
+	r.SetBasicAuth("org1/admin", "pw")
+	w = httptest.NewRecorder()
+	var entries []SecureAPIAuditEntry
+	if a.auditLog(w, r); w.Code != http.StatusOK {
+		t.Errorf("admin should list the audit log, got %v", w.Code)
+	} else if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Errorf("unable to demarshal audit log: %v", err)
+	} else if len(entries) != 5 || entries[1].Allowed || entries[1].User != "org1/ci" || entries[1].Auth != SECURE_API_AUTH_TOKEN || entries[1].Endpoint != "/deploycheck/impact" {
+		t.Errorf("wrong audit entries: %v", entries)
+	}
+
+	// The token is revoked.
+	r = request("DELETE", "/token", "")
+	r.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	if a.token(w, r); w.Code != http.StatusNoContent {
+		t.Errorf("token should be revoked, got %v", w.Code)
+	} else if s := a.sessions.get(tokenKey(token)); s != nil {
+		t.Errorf("revoked token should not be found")
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/boltdb/bolt"
 	"github.com/golang/glog"
+	"github.com/open-horizon/anax/externalpolicy/geo"
 	"github.com/open-horizon/anax/persistence"
 	"github.com/open-horizon/anax/policy"
 )
@@ -104,6 +105,46 @@ func parseHTTPSBasicAuth(errorhandler ErrorHandler, permitEmpty bool, given *Att
 	}, false, nil
 }
 
+func parseLocation(errorhandler ErrorHandler, permitEmpty bool, given *Attribute) (*persistence.LocationAttributes, bool, error) {
+	if permitEmpty {
+		return nil, errorhandler(NewAPIUserInputError("partial update unsupported", "location.mappings")), nil
+	}
+
+	// latitude and longitude are required, the accuracy is optional
+	coords := map[string]float64{}
+	for _, key := range []string{"lat", "lon", "location_accuracy_km"} {
+		v, exists := (*given.Mappings)[key]
+		if !exists {
+			if key == "location_accuracy_km" {
+				continue
+			}
+			return nil, errorhandler(NewAPIUserInputError("missing key", fmt.Sprintf("location.mappings.%v", key))), nil
+		}
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, errorhandler(NewAPIUserInputError("expected number", fmt.Sprintf("location.mappings.%v", key))), nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, errorhandler(NewAPIUserInputError("could not convert to number", fmt.Sprintf("location.mappings.%v", key))), nil
+		}
+		coords[key] = f
+	}
+
+	if _, err := geo.NewPoint(coords["lat"], coords["lon"]); err != nil {
+		return nil, errorhandler(NewAPIUserInputError(err.Error(), "location.mappings")), nil
+	} else if coords["location_accuracy_km"] < 0 {
+		return nil, errorhandler(NewAPIUserInputError("cannot be negative", "location.mappings.location_accuracy_km")), nil
+	}
+
+	return &persistence.LocationAttributes{
+		Meta:               generateAttributeMetadata(*given, reflect.TypeOf(persistence.LocationAttributes{}).Name()),
+		Lat:                coords["lat"],
+		Lon:                coords["lon"],
+		LocationAccuracyKM: coords["location_accuracy_km"],
+	}, false, nil
+}
+
 func parseDockerRegistryAuth(errorhandler ErrorHandler, permitEmpty bool, given *Attribute) (*persistence.DockerRegistryAuthAttributes, bool, error) {
 	auths, exists := (*given.Mappings)["auths"]
 	if !exists {
@@ -451,6 +492,13 @@ func ValidateAndConvertAPIAttribute(errorhandler ErrorHandler, permitEmpty bool,
 			}
 			attribute = attr
 
+		case reflect.TypeOf(persistence.LocationAttributes{}).Name():
+			attr, inputErr, err := parseLocation(errorhandler, permitEmpty, &given)
+			if err != nil || inputErr {
+				return attribute, inputErr, err
+			}
+			attribute = attr
+
 		default:
 			return nil, errorhandler(NewAPIUserInputError("Unmappable type field", "mappings")), nil
 		}
@@ -6,6 +6,7 @@ import (
 	"github.com/open-horizon/anax/externalpolicy"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/schedule"
 	"strings"
 )
 
@@ -20,17 +21,25 @@ type BusinessPolicy struct {
 	Properties  externalpolicy.PropertyList         `json:"properties,omitempty"`
 	Constraints externalpolicy.ConstraintExpression `json:"constraints,omitempty"`
 	UserInput   []policy.UserInput                  `json:"userInput,omitempty"`
+	Rollout     *RolloutPolicy                      `json:"rollout,omitempty"`
+	Maintenance *schedule.MaintenanceSchedule       `json:"maintenance,omitempty"`
+	NodeRanking *NodeRanking                        `json:"nodeRanking,omitempty"`
+	Placement   *Placement                          `json:"placement,omitempty"`
 }
 
 func (w BusinessPolicy) String() string {
-	return fmt.Sprintf("Owner: %v, Label: %v, Description: %v, Service: %v, Properties: %v, Constraints: %v, UserInput: %v",
+	return fmt.Sprintf("Owner: %v, Label: %v, Description: %v, Service: %v, Properties: %v, Constraints: %v, UserInput: %v, Rollout: %v, Maintenance: %v, NodeRanking: %v, Placement: %v",
 		w.Owner,
 		w.Label,
 		w.Description,
 		w.Service,
 		w.Properties,
 		w.Constraints,
-		w.UserInput)
+		w.UserInput,
+		w.Rollout,
+		w.Maintenance,
+		w.NodeRanking,
+		w.Placement)
 }
 
 type ServiceRef struct {
@@ -67,7 +76,7 @@ func (w WorkloadPriority) String() string {
 
 type UpgradePolicy struct {
 	Lifecycle string `json:"lifecycle,omitempty"` // immediate, never, agreement
-	Time      string `json:"time,omitempty"`      // the time of the upgrade
+	Time      string `json:"time,omitempty"`      // not used, upgrade times are set by the maintenance schedule of the policy
 }
 
 func (w UpgradePolicy) String() string {
@@ -100,6 +109,220 @@ func (w NodeHealth) String() string {
 		w.CheckAgreementStatus)
 }
 
+// The rollout section of a business policy limits the number of nodes that can get the service at the same time. The
+// service is first deployed to an initial set of nodes, expressed either as a percentage of the compatible nodes or as
+// an absolute number of nodes. The set is then grown one step at a time. The next step starts when the wait time has
+// passed and the agreements made so far meet the success criteria. The rollout is paused when too many agreements fail,
+// and it is restarted when the business policy is changed.
+type RolloutPolicy struct {
+	InitialPercent int            `json:"initialPercent,omitempty"`  // the percentage of the compatible nodes in the first step
+	InitialCount   int            `json:"initialCount,omitempty"`    // the number of nodes in the first step, mutually exclusive with initialPercent
+	StepPercent    int            `json:"stepPercent,omitempty"`     // the percentage of the compatible nodes added by each subsequent step
+	StepCount      int            `json:"stepCount,omitempty"`       // the number of nodes added by each subsequent step, used with initialCount
+	StepWaitS      int            `json:"stepWaitSeconds,omitempty"` // the minimum number of seconds between steps
+	Success        RolloutSuccess `json:"successCriteria,omitempty"` // when the agreements made so far are good enough to start the next step
+}
+
+func (w RolloutPolicy) String() string {
+	return fmt.Sprintf("InitialPercent: %v, InitialCount: %v, StepPercent: %v, StepCount: %v, StepWaitS: %v, Success: %v",
+		w.InitialPercent,
+		w.InitialCount,
+		w.StepPercent,
+		w.StepCount,
+		w.StepWaitS,
+		w.Success)
+}
+
+const DEFAULT_ROLLOUT_FINALIZED_PERCENT = 100
+const DEFAULT_ROLLOUT_MAX_FAILED_PERCENT = 10
+
+type RolloutSuccess struct {
+	FinalizedPercent int `json:"finalizedPercent,omitempty"` // the percentage of the active agreements that must be successful, the default is 100
+	RunningS         int `json:"runningSeconds,omitempty"`   // how long an agreement must have been finalized, with the service running on the node, to be successful
+	MaxFailedPercent int `json:"maxFailedPercent,omitempty"` // the rollout is paused when more than this percentage of the agreements failed, the default is 10
+}
+
+func (w RolloutSuccess) String() string {
+	return fmt.Sprintf("FinalizedPercent: %v, RunningS: %v, MaxFailedPercent: %v",
+		w.FinalizedPercent,
+		w.RunningS,
+		w.MaxFailedPercent)
+}
+
+func (r *RolloutPolicy) GetFinalizedPercent() int {
+	if r.Success.FinalizedPercent == 0 {
+		return DEFAULT_ROLLOUT_FINALIZED_PERCENT
+	}
+	return r.Success.FinalizedPercent
+}
+
+func (r *RolloutPolicy) GetMaxFailedPercent() int {
+	if r.Success.MaxFailedPercent == 0 {
+		return DEFAULT_ROLLOUT_MAX_FAILED_PERCENT
+	}
+	return r.Success.MaxFailedPercent
+}
+
+// Returns the maximum number of nodes that can have an agreement during the input step (starting at 0), given the number
+// of compatible nodes. The returned boolean is true when the step includes all the compatible nodes, which means the
+// rollout is complete.
+func (r *RolloutPolicy) StepLimit(step int, nodes int) (int, bool) {
+	if r.InitialPercent != 0 {
+		percent := r.InitialPercent + step*r.StepPercent
+		if percent >= 100 {
+			return nodes, true
+		}
+		// Round up so that a step always includes at least 1 node.
+		return (nodes*percent + 99) / 100, false
+	}
+	count := r.InitialCount + step*r.StepCount
+	return count, nodes != 0 && count >= nodes
+}
+
+func (r *RolloutPolicy) Validate() error {
+
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if r.InitialPercent != 0 && r.InitialCount != 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout initialPercent and initialCount are mutually exclusive."))
+	} else if r.InitialPercent < 0 || r.InitialPercent > 100 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout initialPercent must be between 1 and 100."))
+	} else if r.InitialCount < 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout initialCount must be greater than 0."))
+	} else if r.InitialPercent == 0 && r.InitialCount == 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout must specify initialPercent or initialCount."))
+	} else if r.InitialPercent != 0 && r.StepCount != 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout stepCount cannot be used with initialPercent, use stepPercent."))
+	} else if r.InitialCount != 0 && r.StepPercent != 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout stepPercent cannot be used with initialCount, use stepCount."))
+	} else if r.StepPercent < 0 || r.StepPercent > 100 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout stepPercent must be between 1 and 100."))
+	} else if r.StepCount < 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout stepCount must be greater than 0."))
+	} else if r.InitialPercent != 0 && r.InitialPercent < 100 && r.StepPercent == 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout must specify stepPercent."))
+	} else if r.InitialCount != 0 && r.StepCount == 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout must specify stepCount."))
+	} else if r.StepWaitS < 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout stepWaitSeconds must not be negative."))
+	} else if r.Success.FinalizedPercent < 0 || r.Success.FinalizedPercent > 100 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout successCriteria finalizedPercent must be between 1 and 100."))
+	} else if r.Success.RunningS < 0 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout successCriteria runningSeconds must not be negative."))
+	} else if r.Success.MaxFailedPercent < 0 || r.Success.MaxFailedPercent > 100 {
+		return fmt.Errorf(msgPrinter.Sprintf("rollout successCriteria maxFailedPercent must be between 1 and 100."))
+	}
+	return nil
+}
+
+// The node ranking section of a business policy chooses the order in which the agbot makes agreements with the nodes
+// it finds. The order matters when the agbot cannot make agreements with all of them at once, for example during a
+// rollout. Without it, agreements are made in the order that the exchange search returns the nodes.
+type NodeRanking struct {
+	Strategy string `json:"strategy"`           // the name of a node ranking strategy
+	Property string `json:"property,omitempty"` // the node property whose values the nodes are spread across, for the spread strategy
+}
+
+func (w NodeRanking) String() string {
+	return fmt.Sprintf("Strategy: %v, Property: %v", w.Strategy, w.Property)
+}
+
+// The built-in node ranking strategies. The agbot can have other strategies.
+const (
+	RANKING_FEWEST_AGREEMENTS = "fewest_agreements" // prefer the nodes with the fewest current agreements
+	RANKING_SPREAD            = "spread"            // spread the agreements evenly across the values of a node property
+	RANKING_RECENT_HEARTBEAT  = "recent_heartbeat"  // prefer the nodes whose heartbeat is most recent
+)
+
+func (r *NodeRanking) Validate() error {
+
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if r.Strategy == "" {
+		return fmt.Errorf(msgPrinter.Sprintf("nodeRanking must specify a strategy."))
+	} else if r.Strategy == RANKING_SPREAD && r.Property == "" {
+		return fmt.Errorf(msgPrinter.Sprintf("nodeRanking strategy %v must specify a property.", RANKING_SPREAD))
+	} else if r.Strategy != RANKING_SPREAD && r.Property != "" {
+		return fmt.Errorf(msgPrinter.Sprintf("nodeRanking property can only be used with strategy %v.", RANKING_SPREAD))
+	}
+	return nil
+}
+
+// The placement section of a business policy limits where the agbot places the service. The limits are checked against
+// the agreements that the agbot already has when it makes new agreements.
+type Placement struct {
+	Limits       []PlacementLimit   `json:"limits,omitempty"`       // the limits on the number of nodes per value of a node property
+	AntiAffinity []AntiAffinityRule `json:"antiAffinity,omitempty"` // the services that must not be running on the node
+}
+
+func (w Placement) String() string {
+	return fmt.Sprintf("Limits: %v, AntiAffinity: %v", w.Limits, w.AntiAffinity)
+}
+
+// At most Max nodes with the same value of the node property get the service. Nodes without the property are not limited.
+type PlacementLimit struct {
+	Property string `json:"property"`
+	Max      int    `json:"max"`
+}
+
+func (w PlacementLimit) String() string {
+	return fmt.Sprintf("Property: %v, Max: %v", w.Property, w.Max)
+}
+
+// The service is never placed on a node that is already running the service named here.
+type AntiAffinityRule struct {
+	Name string `json:"name"` // the url of the service
+	Org  string `json:"org"`  // the org holding the service definition
+}
+
+func (w AntiAffinityRule) String() string {
+	return fmt.Sprintf("Name: %v, Org: %v", w.Name, w.Org)
+}
+
+// Returns a copy of the placement, or nil if there is none.
+func (p *Placement) DeepCopy() *Placement {
+	if p == nil {
+		return nil
+	}
+	newPlacement := Placement{}
+	if p.Limits != nil {
+		newPlacement.Limits = make([]PlacementLimit, len(p.Limits))
+		copy(newPlacement.Limits, p.Limits)
+	}
+	if p.AntiAffinity != nil {
+		newPlacement.AntiAffinity = make([]AntiAffinityRule, len(p.AntiAffinity))
+		copy(newPlacement.AntiAffinity, p.AntiAffinity)
+	}
+	return &newPlacement
+}
+
+func (p *Placement) Validate() error {
+
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	props := make(map[string]bool)
+	for _, limit := range p.Limits {
+		if limit.Property == "" {
+			return fmt.Errorf(msgPrinter.Sprintf("placement limit must specify a property."))
+		} else if limit.Max < 1 {
+			return fmt.Errorf(msgPrinter.Sprintf("placement limit for property %v must have a max of at least 1.", limit.Property))
+		} else if props[limit.Property] {
+			return fmt.Errorf(msgPrinter.Sprintf("placement has more than one limit for property %v.", limit.Property))
+		}
+		props[limit.Property] = true
+	}
+
+	for _, rule := range p.AntiAffinity {
+		if rule.Name == "" || rule.Org == "" {
+			return fmt.Errorf(msgPrinter.Sprintf("placement antiAffinity must specify the name and org of a service."))
+		}
+	}
+	return nil
+}
+
 // The validate function returns errors if the policy does not validate. It uses the constraint language
 // plugins to handle the constraints field.
 func (b *BusinessPolicy) Validate() error {
@@ -136,6 +359,34 @@ func (b *BusinessPolicy) Validate() error {
 		}
 	}
 
+	// Validate the rollout section.
+	if b.Rollout != nil {
+		if err := b.Rollout.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Validate the maintenance schedule.
+	if b.Maintenance != nil {
+		if err := b.Maintenance.Validate(); err != nil {
+			return fmt.Errorf(msgPrinter.Sprintf("maintenance contains an invalid schedule: %v", err))
+		}
+	}
+
+	// Validate the node ranking.
+	if b.NodeRanking != nil {
+		if err := b.NodeRanking.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Validate the placement limits.
+	if b.Placement != nil {
+		if err := b.Placement.Validate(); err != nil {
+			return err
+		}
+	}
+
 	// Validate the Constraints expression by invoking the plugins.
 	if b != nil && len(b.Constraints) != 0 {
 		_, err := b.Constraints.Validate()
@@ -320,3 +320,178 @@ func Test_GenPolicyFromBusinessPolicy_Complicated(t *testing.T) {
 		t.Errorf("Second user input variable value for service cpu should be val2 but got %v.", pPolicy.UserInput[0].Inputs[1].Value)
 	}
 }
+
+// rollout section validation
+func Test_Validate_Rollout(t *testing.T) {
+
+	bPolicy := BusinessPolicy{
+		Owner: "me",
+		Label: "my business policy",
+		Service: ServiceRef{
+			Name:            "cpu",
+			Org:             "mycomp",
+			Arch:            "amd64",
+			ServiceVersions: []WorkloadChoice{{Version: "1.0.0"}},
+		},
+	}
+
+	bad := []struct {
+		rollout RolloutPolicy
+		msg     string
+	}{
+		{RolloutPolicy{}, "must specify initialPercent or initialCount"},
+		{RolloutPolicy{InitialPercent: 10, InitialCount: 5, StepPercent: 10}, "mutually exclusive"},
+		{RolloutPolicy{InitialPercent: 101}, "initialPercent must be between"},
+		{RolloutPolicy{InitialPercent: 10}, "must specify stepPercent"},
+		{RolloutPolicy{InitialPercent: 10, StepCount: 10}, "stepCount cannot be used with initialPercent"},
+		{RolloutPolicy{InitialCount: 10, StepPercent: 10}, "stepPercent cannot be used with initialCount"},
+		{RolloutPolicy{InitialCount: 10}, "must specify stepCount"},
+		{RolloutPolicy{InitialCount: 10, StepCount: 10, StepWaitS: -1}, "stepWaitSeconds must not be negative"},
+		{RolloutPolicy{InitialCount: 10, StepCount: 10, Success: RolloutSuccess{MaxFailedPercent: 200}}, "maxFailedPercent must be between"},
+	}
+
+	for _, b := range bad {
+		r := b.rollout
+		bPolicy.Rollout = &r
+		if err := bPolicy.Validate(); err == nil {
+			t.Errorf("Validate should have returned error for %v but not.", r)
+		} else if !strings.Contains(err.Error(), b.msg) {
+			t.Errorf("Wrong error string for %v: %v", r, err)
+		}
+	}
+
+	good := []RolloutPolicy{
+		{InitialPercent: 100},
+		{InitialPercent: 5, StepPercent: 20, StepWaitS: 600},
+		{InitialCount: 10, StepCount: 100, Success: RolloutSuccess{FinalizedPercent: 90, RunningS: 300, MaxFailedPercent: 5}},
+	}
+
+	for _, r := range good {
+		ro := r
+		bPolicy.Rollout = &ro
+		if err := bPolicy.Validate(); err != nil {
+			t.Errorf("Validate should not have returned error for %v, error: %v", r, err)
+		}
+	}
+}
+
+// rollout step limits
+func Test_Rollout_StepLimit(t *testing.T) {
+
+	r := RolloutPolicy{InitialPercent: 5, StepPercent: 30}
+	if limit, complete := r.StepLimit(0, 5000); limit != 250 || complete {
+		t.Errorf("wrong limit for step 0: %v %v", limit, complete)
+	} else if limit, complete := r.StepLimit(0, 3); limit != 1 || complete {
+		t.Errorf("the limit should be rounded up: %v %v", limit, complete)
+	} else if limit, complete := r.StepLimit(3, 5000); limit != 4750 || complete {
+		t.Errorf("wrong limit for step 3: %v %v", limit, complete)
+	} else if limit, complete := r.StepLimit(4, 5000); limit != 5000 || !complete {
+		t.Errorf("step 4 should complete the rollout: %v %v", limit, complete)
+	}
+
+	r = RolloutPolicy{InitialCount: 10, StepCount: 100}
+	if limit, complete := r.StepLimit(0, 5000); limit != 10 || complete {
+		t.Errorf("wrong limit for step 0: %v %v", limit, complete)
+	} else if limit, complete := r.StepLimit(2, 5000); limit != 210 || complete {
+		t.Errorf("wrong limit for step 2: %v %v", limit, complete)
+	} else if limit, complete := r.StepLimit(2, 150); limit != 210 || !complete {
+		t.Errorf("step 2 should complete the rollout: %v %v", limit, complete)
+	} else if _, complete := r.StepLimit(2, 0); complete {
+		t.Errorf("a rollout without nodes should not be complete")
+	}
+
+	if r.GetFinalizedPercent() != DEFAULT_ROLLOUT_FINALIZED_PERCENT || r.GetMaxFailedPercent() != DEFAULT_ROLLOUT_MAX_FAILED_PERCENT {
+		t.Errorf("wrong success criteria defaults: %v", r.Success)
+	}
+}
+
+// node ranking validation
+func Test_Validate_NodeRanking(t *testing.T) {
+
+	bPolicy := BusinessPolicy{
+		Owner: "me",
+		Label: "my business policy",
+		Service: ServiceRef{
+			Name:            "cpu",
+			Org:             "mycomp",
+			Arch:            "amd64",
+			ServiceVersions: []WorkloadChoice{{Version: "1.0.0"}},
+		},
+	}
+
+	bad := []struct {
+		ranking NodeRanking
+		msg     string
+	}{
+		{NodeRanking{}, "must specify a strategy"},
+		{NodeRanking{Strategy: RANKING_SPREAD}, "must specify a property"},
+		{NodeRanking{Strategy: RANKING_FEWEST_AGREEMENTS, Property: "zone"}, "property can only be used"},
+	}
+
+	for _, b := range bad {
+		r := b.ranking
+		bPolicy.NodeRanking = &r
+		if err := bPolicy.Validate(); err == nil {
+			t.Errorf("Validate should have returned error for %v but not.", r)
+		} else if !strings.Contains(err.Error(), b.msg) {
+			t.Errorf("Wrong error string for %v: %v", r, err)
+		}
+	}
+
+	good := []NodeRanking{
+		{Strategy: RANKING_FEWEST_AGREEMENTS},
+		{Strategy: RANKING_SPREAD, Property: "zone"},
+		{Strategy: RANKING_RECENT_HEARTBEAT},
+		{Strategy: "my_strategy"},
+	}
+
+	for _, r := range good {
+		ro := r
+		bPolicy.NodeRanking = &ro
+		if err := bPolicy.Validate(); err != nil {
+			t.Errorf("Validate should not have returned error for %v, error: %v", r, err)
+		}
+	}
+}
+
+func Test_Validate_Placement(t *testing.T) {
+
+	bPolicy := BusinessPolicy{
+		Owner: "me",
+		Label: "my business policy",
+		Service: ServiceRef{
+			Name:            "cpu",
+			Org:             "mycomp",
+			Arch:            "amd64",
+			ServiceVersions: []WorkloadChoice{{Version: "1.0.0"}},
+		},
+	}
+
+	bad := []struct {
+		placement Placement
+		msg       string
+	}{
+		{Placement{Limits: []PlacementLimit{{Max: 1}}}, "must specify a property"},
+		{Placement{Limits: []PlacementLimit{{Property: "store", Max: 0}}}, "max of at least 1"},
+		{Placement{Limits: []PlacementLimit{{Property: "store", Max: 1}, {Property: "store", Max: 2}}}, "more than one limit"},
+		{Placement{AntiAffinity: []AntiAffinityRule{{Name: "gps"}}}, "must specify the name and org"},
+	}
+
+	for _, b := range bad {
+		p := b.placement
+		bPolicy.Placement = &p
+		if err := bPolicy.Validate(); err == nil {
+			t.Errorf("Validate should have returned error for %v but not.", p)
+		} else if !strings.Contains(err.Error(), b.msg) {
+			t.Errorf("Wrong error string for %v: %v", p, err)
+		}
+	}
+
+	bPolicy.Placement = &Placement{
+		Limits:       []PlacementLimit{{Property: "store", Max: 1}, {Property: "region", Max: 3}},
+		AntiAffinity: []AntiAffinityRule{{Name: "gps", Org: "IBM"}},
+	}
+	if err := bPolicy.Validate(); err != nil {
+		t.Errorf("Validate should not have returned error for %v, error: %v", bPolicy.Placement, err)
+	}
+}
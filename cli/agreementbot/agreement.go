@@ -3,10 +3,13 @@ package agreementbot
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/open-horizon/anax/agreementbot"
 	agbot "github.com/open-horizon/anax/agreementbot/persistence"
 	"github.com/open-horizon/anax/cli/cliutils"
 	"github.com/open-horizon/anax/i18n"
+	"net/http"
 	"os"
+	"strings"
 )
 
 type ActiveAgreement struct {
@@ -121,10 +124,20 @@ func AgreementList(archivedAgreements bool, agreement string) {
 	}
 }
 
-func AgreementCancel(agreementId string, allAgreements bool) {
+func AgreementCancel(agreementId string, allAgreements bool, selectors []string, dryRun bool, maxPerMinute int) {
 	// get message printer
 	msgPrinter := i18n.GetMessagePrinter()
 
+	if len(selectors) != 0 {
+		if agreementId != "" || allAgreements {
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("--selector cannot be specified with an agreement ID or -a."))
+		}
+		agreementCancelBySelector(selectors, dryRun, maxPerMinute)
+		return
+	} else if dryRun || maxPerMinute != 0 {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("--list-only and --max-per-minute can only be specified with --selector."))
+	}
+
 	// Put the agreement ids in a slice
 	var agrIds []string
 	if allAgreements {
@@ -154,3 +167,63 @@ func AgreementCancel(agreementId string, allAgreements bool) {
 		cliutils.HorizonDelete("agreement/"+id, []int{200, 204}, []int{}, false)
 	}
 }
+
+// Cancel the agreements selected by the selectors, each selector is in the form key=value.
+func agreementCancelBySelector(selectors []string, dryRun bool, maxPerMinute int) {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	input := agreementbot.BulkCancelRequest{DryRun: dryRun, MaxPerMinute: maxPerMinute}
+	for _, sel := range selectors {
+		parts := strings.SplitN(sel, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("invalid selector %v, the format is key=value.", sel))
+		}
+		switch key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]); key {
+		case "policy":
+			input.Selector.PolicyName = value
+		case "pattern":
+			input.Selector.Pattern = value
+		case "service":
+			input.Selector.Service = value
+		case "version":
+			input.Selector.ServiceVersion = value
+		case "node-org":
+			input.Selector.NodeOrg = value
+		case "property":
+			input.Selector.NodeProperty = value
+		default:
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("invalid selector key %v, the valid keys are policy, pattern, service, version, node-org and property.", key))
+		}
+	}
+	if err := input.Selector.Validate(); err != nil {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("invalid selector: %v", err))
+	}
+
+	if err := os.Setenv("HORIZON_URL", cliutils.GetAgbotUrlBase()); err != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("unable to set env var 'HORIZON_URL', error %v", err))
+	}
+
+	_, respBody, _ := cliutils.HorizonPutPost(http.MethodPost, "agreement/cancel", []int{200}, input, true)
+
+	result := agreementbot.BulkCancelResult{}
+	if err := json.Unmarshal([]byte(respBody), &result); err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal 'agbot agreement cancel' output: %v", err))
+	}
+
+	if result.DryRun {
+		jsonBytes, err := json.MarshalIndent(result.Agreements, "", cliutils.JSON_INDENT)
+		if err != nil {
+			cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to marshal 'agbot agreement cancel' output: %v", err))
+		}
+		fmt.Printf("%s\n", jsonBytes)
+		msgPrinter.Printf("Dry run, %v agreements would be canceled, %v per minute.", len(result.Agreements), result.MaxPerMinute)
+		msgPrinter.Println()
+	} else if len(result.Agreements) == 0 {
+		msgPrinter.Printf("No active agreements to cancel.")
+		msgPrinter.Println()
+	} else {
+		msgPrinter.Printf("Canceling %v agreements, %v per minute. Use 'hzn agbot agreement list' to follow the progress.", len(result.Agreements), result.MaxPerMinute)
+		msgPrinter.Println()
+	}
+}
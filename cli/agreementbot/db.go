@@ -0,0 +1,65 @@
+package agreementbot
+
+import (
+	"encoding/json"
+	"fmt"
+	agbot "github.com/open-horizon/anax/agreementbot/persistence"
+	"github.com/open-horizon/anax/cli/cliutils"
+	"github.com/open-horizon/anax/i18n"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// Export the agbot's agreements, workload usages and search sessions to a JSON lines archive. The archive is written
+// to stdout when no file is specified.
+func DbExport(filePath string) {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	// set env to call agbot url
+	if err := os.Setenv("HORIZON_URL", cliutils.GetAgbotUrlBase()); err != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("unable to set env var 'HORIZON_URL', error %v", err))
+	}
+
+	var archive string
+	cliutils.HorizonGet("db/export", []int{200}, &archive, false)
+
+	// The archive is streamed, an error during the export is reported in the trailer at the end of the archive.
+	if _, err := agbot.VerifyArchiveTrailer([]byte(archive)); err != nil {
+		cliutils.Fatal(cliutils.HTTP_ERROR, msgPrinter.Sprintf("failed to export the agbot database: %v", err))
+	}
+
+	if filePath == "" || filePath == "-" {
+		fmt.Print(archive)
+	} else if err := ioutil.WriteFile(filePath, []byte(archive), 0600); err != nil {
+		cliutils.Fatal(cliutils.FILE_IO_ERROR, msgPrinter.Sprintf("failed to write the agbot database archive to %v: %v", filePath, err))
+	} else {
+		msgPrinter.Printf("Agbot database archive written to %v", filePath)
+		msgPrinter.Println()
+	}
+}
+
+// Import an archive created by 'hzn agbot db export' into the agbot's database. Records that are already in the
+// database are skipped, so an import can be safely repeated.
+func DbImport(filePath string) {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	archive := cliutils.ReadFile(filePath)
+
+	// set env to call agbot url
+	if err := os.Setenv("HORIZON_URL", cliutils.GetAgbotUrlBase()); err != nil {
+		cliutils.Fatal(cliutils.CLI_GENERAL_ERROR, msgPrinter.Sprintf("unable to set env var 'HORIZON_URL', error %v", err))
+	}
+
+	_, respBody, _ := cliutils.HorizonPutPost(http.MethodPost, "db/import", []int{200}, archive, true)
+
+	summary := agbot.ArchiveSummary{}
+	if err := json.Unmarshal([]byte(respBody), &summary); err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal 'agbot db import' output: %v", err))
+	}
+
+	msgPrinter.Printf("Imported %v agreements, %v workload usages and %v search sessions. Skipped %v records that were already in the database.", summary.Agreements, summary.WorkloadUsages, summary.SearchSessions, summary.Skipped)
+	msgPrinter.Println()
+}
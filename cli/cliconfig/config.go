@@ -42,6 +42,9 @@ type HorizonCliConfig struct {
 	// exchange url, the default is shipped with the horizon-cli package
 	HZN_EXCHANGE_URL string `json:"HZN_EXCHANGE_URL,omitempty"`
 
+	// the url to the agbot secure API, used by the commands that need the agbot, for example 'hzn deploycheck impact'
+	HZN_AGBOT_URL string `json:"HZN_AGBOT_URL,omitempty"`
+
 	// http max retries and retry interval (in second) when transport error occurs.
 	HZN_HTTP_RETRIES        string `json:"HZN_HTTP_RETRIES,omitempty"`
 	HZN_HTTP_RETRY_INTERVAL string `json:"HZN_HTTP_RETRY_INTERVAL,omitempty"`
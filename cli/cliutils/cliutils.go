@@ -487,6 +487,15 @@ func GetAgbotUrlBase() string {
 	return GetHorizonUrlBase()
 }
 
+// Returns the agbot secure API url from HZN_AGBOT_URL. It is required by the commands that call the agbot secure API.
+func GetAgbotSecureAPIUrlBase() string {
+	envVar := os.Getenv("HZN_AGBOT_URL")
+	if envVar == "" {
+		Fatal(CLI_INPUT_ERROR, i18n.GetMessagePrinter().Sprintf("Please set the HZN_AGBOT_URL environment variable to the url of the agbot secure API."))
+	}
+	return strings.TrimSuffix(envVar, "/")
+}
+
 // GetRespBodyAsString converts an http response body to a string
 func GetRespBodyAsString(responseBody io.ReadCloser) string {
 	if responseBody == nil {
@@ -0,0 +1,66 @@
+package deploycheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot"
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/cli/cliconfig"
+	"github.com/open-horizon/anax/cli/cliutils"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/i18n"
+)
+
+// Show which nodes would gain, keep or lose an agreement if the deployment policy is changed. The check needs the
+// current agreements of the agbot, so it is done by the agbot secure API rather than locally.
+func DeployImpact(org string, userPw string, businessPolId string, businessPolFile string, servicePolFile string) {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if businessPolId == "" {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("-b must be specified."))
+	} else if userPw == "" {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Please specify the Exchange credential with -u for querying the nodes, deployment policy, service and service policy."))
+	}
+
+	// the org of the credentials, the deployment policy id defaults to it
+	userOrg := org
+	if userOrg == "" {
+		id, _ := cliutils.SplitIdToken(userPw)
+		userOrg, _ = cliutils.TrimOrg("", id)
+		if userOrg == "" {
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Please specify the organization with -o for the Exchange credentials: %v.", userPw))
+		}
+	}
+
+	impactInput := agreementbot.DeployImpactCheck{BusinessPolId: cliutils.AddOrg(userOrg, businessPolId)}
+
+	if businessPolFile != "" {
+		// read the proposed deployment policy from file
+		var bp businesspolicy.BusinessPolicy
+		newBytes := cliconfig.ReadJsonFileWithLocalConfig(businessPolFile)
+		if err := json.Unmarshal(newBytes, &bp); err != nil {
+			cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal deployment policy json input file %s: %v", businessPolFile, err))
+		}
+		impactInput.BusinessPolicy = &bp
+	}
+
+	if servicePolFile != "" {
+		// read the proposed service policy from file
+		var sp externalpolicy.ExternalPolicy
+		readExternalPolicyFile(servicePolFile, &sp)
+		impactInput.ServicePolicy = &sp
+	}
+
+	cliutils.Verbose(msgPrinter.Sprintf("Using impact checking input: %v", impactInput))
+
+	var output agreementbot.DeployImpactOutput
+	cliutils.ExchangePutPost("Agbot", "GET", cliutils.GetAgbotSecureAPIUrlBase(), "deploycheck/impact", cliutils.OrgAndCreds(userOrg, userPw), []int{200}, impactInput, &output)
+
+	// display the output
+	jsonOutput, err := cliutils.DisplayAsJson(output)
+	if err != nil {
+		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to marshal 'hzn deploycheck impact' output: %v", err))
+	}
+	fmt.Println(jsonOutput)
+}
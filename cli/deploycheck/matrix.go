@@ -0,0 +1,171 @@
+package deploycheck
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/open-horizon/anax/agreementbot"
+	"github.com/open-horizon/anax/cli/cliutils"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/i18n"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// The output formats of 'hzn deploycheck matrix'.
+const (
+	MATRIX_FORMAT_TABLE = "table"
+	MATRIX_FORMAT_CSV   = "csv"
+	MATRIX_FORMAT_JSON  = "json"
+)
+
+// Check a list of deployment policies and patterns against a list of nodes, or all the nodes in an org. The check is
+// done by the agbot secure API, so that the whole matrix is checked with one call.
+func DeployMatrix(org string, userPw string, businessPolIds []string, patternIds []string, nodeIds []string, nodeOrg string, nodeSelector []string, format string) {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if len(businessPolIds) == 0 && len(patternIds) == 0 {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("At least one -b or -p must be specified."))
+	} else if len(nodeIds) != 0 && nodeOrg != "" {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("-n and --node-org are mutually exclusive."))
+	} else if format != MATRIX_FORMAT_TABLE && format != MATRIX_FORMAT_CSV && format != MATRIX_FORMAT_JSON {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("The output format %v is not valid, the valid formats are %v, %v and %v.", format, MATRIX_FORMAT_TABLE, MATRIX_FORMAT_CSV, MATRIX_FORMAT_JSON))
+	} else if userPw == "" {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Please specify the Exchange credential with -u for querying the nodes, deployment policies, patterns and services."))
+	}
+
+	// the org of the credentials, the ids default to it
+	userOrg := org
+	if userOrg == "" {
+		id, _ := cliutils.SplitIdToken(userPw)
+		userOrg, _ = cliutils.TrimOrg("", id)
+		if userOrg == "" {
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Please specify the organization with -o for the Exchange credentials: %v.", userPw))
+		}
+	}
+
+	input := agreementbot.DeployMatrixCheck{NodeOrg: nodeOrg}
+	for _, id := range businessPolIds {
+		input.BusinessPolIds = append(input.BusinessPolIds, cliutils.AddOrg(userOrg, id))
+	}
+	for _, id := range patternIds {
+		input.PatternIds = append(input.PatternIds, cliutils.AddOrg(userOrg, id))
+	}
+	for _, id := range nodeIds {
+		input.NodeIds = append(input.NodeIds, cliutils.AddOrg(userOrg, id))
+	}
+	if len(input.NodeIds) == 0 && input.NodeOrg == "" {
+		input.NodeOrg = userOrg
+	}
+	if len(nodeSelector) != 0 {
+		input.NodeSelector = externalpolicy.ConstraintExpression(nodeSelector)
+	}
+
+	cliutils.Verbose(msgPrinter.Sprintf("Using matrix checking input: %v", input))
+
+	var output agreementbot.DeployMatrixOutput
+	cliutils.ExchangePutPost("Agbot", "GET", cliutils.GetAgbotSecureAPIUrlBase(), "deploycheck/matrix", cliutils.OrgAndCreds(userOrg, userPw), []int{200}, input, &output)
+
+	// display the output
+	switch format {
+	case MATRIX_FORMAT_JSON:
+		jsonOutput, err := cliutils.DisplayAsJson(output)
+		if err != nil {
+			cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to marshal 'hzn deploycheck matrix' output: %v", err))
+		}
+		fmt.Println(jsonOutput)
+	case MATRIX_FORMAT_CSV:
+		writeMatrixCSV(&output)
+	default:
+		writeMatrixTable(&output)
+	}
+
+	// the nodes that could not be checked
+	errNodes := make([]string, 0, len(output.Errors))
+	for id := range output.Errors {
+		errNodes = append(errNodes, id)
+	}
+	sort.Strings(errNodes)
+	for _, id := range errNodes {
+		cliutils.Warning(msgPrinter.Sprintf("node %v was not checked: %v", id, output.Errors[id]))
+	}
+}
+
+// The short result of a cell of the matrix.
+func matrixCellResult(cell *agreementbot.DeployMatrixCell) string {
+	if cell.Error != "" {
+		return "error"
+	} else if cell.Compatible {
+		return "compatible"
+	}
+	return "incompatible"
+}
+
+// The reasons for the result of a cell of the matrix, sorted by service.
+func matrixCellReason(cell *agreementbot.DeployMatrixCell) string {
+	if cell.Error != "" {
+		return cell.Error
+	}
+	services := make([]string, 0, len(cell.Reason))
+	for svc := range cell.Reason {
+		services = append(services, svc)
+	}
+	sort.Strings(services)
+
+	reasons := make([]string, 0, len(services))
+	for _, svc := range services {
+		reasons = append(reasons, fmt.Sprintf("%v: %v", svc, cell.Reason[svc]))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// Write the matrix as a table with a row for each node and a column for each deployment, followed by the reasons for
+// the incompatible nodes.
+func writeMatrixTable(output *agreementbot.DeployMatrixOutput) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	header := []string{"NODE", "ARCH"}
+	for _, dep := range output.Deployments {
+		header = append(header, fmt.Sprintf("%v (%v)", dep.Id, dep.Type))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, node := range output.Nodes {
+		row := []string{node.NodeId, node.NodeArch}
+		for ix := range node.Results {
+			row = append(row, matrixCellResult(&node.Results[ix]))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+
+	first := true
+	for _, node := range output.Nodes {
+		for ix := range node.Results {
+			if cell := &node.Results[ix]; !cell.Compatible && ix < len(output.Deployments) {
+				if first {
+					fmt.Println()
+					first = false
+				}
+				fmt.Printf("%v, %v: %v\n", node.NodeId, output.Deployments[ix].Id, matrixCellReason(cell))
+			}
+		}
+	}
+}
+
+// Write the matrix as CSV with a line for each node and deployment.
+func writeMatrixCSV(output *agreementbot.DeployMatrixOutput) {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"node_id", "node_arch", "deployment", "type", "result", "reason"})
+	for _, node := range output.Nodes {
+		for ix := range node.Results {
+			if ix < len(output.Deployments) {
+				cell := &node.Results[ix]
+				w.Write([]string{node.NodeId, node.NodeArch, output.Deployments[ix].Id, output.Deployments[ix].Type, matrixCellResult(cell), matrixCellReason(cell)})
+			}
+		}
+	}
+	w.Flush()
+}
@@ -22,7 +22,7 @@ func readExternalPolicyFile(filePath string, inputFileStruct *externalpolicy.Ext
 }
 
 // check if the policies are compatible
-func PolicyCompatible(org string, userPw string, nodeId string, nodeArch string, nodeType string, nodePolFile string, businessPolId string, businessPolFile string, servicePolFile string, svcDefFiles []string, checkAllSvcs bool, showDetail bool) {
+func PolicyCompatible(org string, userPw string, nodeId string, nodeArch string, nodeType string, nodePolFile string, businessPolId string, businessPolFile string, servicePolFile string, svcDefFiles []string, checkAllSvcs bool, showDetail bool, explain bool) {
 
 	msgPrinter := i18n.GetMessagePrinter()
 
@@ -32,6 +32,7 @@ func PolicyCompatible(org string, userPw string, nodeId string, nodeArch string,
 	policyCheckInput := compcheck.PolicyCheck{}
 	policyCheckInput.NodeArch = nodeArch
 	policyCheckInput.NodeType = nodeType
+	policyCheckInput.Explain = explain
 
 	// formalize node id or get node policy
 	bUseLocalNode := false
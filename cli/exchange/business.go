@@ -11,6 +11,7 @@ import (
 	"github.com/open-horizon/anax/externalpolicy"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/schedule"
 	"net/http"
 )
 
@@ -91,6 +92,14 @@ func BusinessAddPolicy(org string, credToUse string, policy string, jsonFilePath
 		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("The deployment policy has no constraints which might result in the service being deployed to all nodes. Please specify --no-constraints to confirm that this is acceptable."))
 	}
 
+	// warn about constraints that no node can satisfy, the policy is still published
+	if warnings, err := policyFile.Constraints.Analyze(); err == nil {
+		for _, w := range warnings {
+			cliutils.Warning(msgPrinter.Sprintf("deployment policy constraint: %v", w.Message))
+		}
+	}
+	checkServicePolicyConflicts(org, credToUse, &policyFile)
+
 	//add/overwrite business policy file
 	httpCode := cliutils.ExchangePutPost("Exchange", http.MethodPost, exchUrl, "orgs/"+polOrg+"/business/policies"+cliutils.AddSlash(policy), cliutils.OrgAndCreds(org, credToUse), []int{201, 403}, policyFile, nil)
 	if httpCode == 403 {
@@ -103,6 +112,59 @@ func BusinessAddPolicy(org string, credToUse string, policy string, jsonFilePath
 	}
 }
 
+// Warn about the constraints of the deployment policy that cannot be satisfied together with the constraints in the policy
+// of a service it deploys. The service policies are taken from the exchange, a service that is not found is ignored.
+func checkServicePolicyConflicts(org string, credToUse string, policyFile *businesspolicy.BusinessPolicy) {
+
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if len(policyFile.Constraints) == 0 {
+		return
+	}
+
+	svcOrg := policyFile.Service.Org
+	if svcOrg == "" {
+		svcOrg = org
+	}
+
+	checked := make(map[string]bool)
+	for _, wl := range policyFile.Service.ServiceVersions {
+		resSuffix := fmt.Sprintf("orgs/%v/services?url=%v", svcOrg, policyFile.Service.Name)
+		if wl.Version != "" {
+			resSuffix += fmt.Sprintf("&version=%v", wl.Version)
+		}
+		if policyFile.Service.Arch != "" && policyFile.Service.Arch != "*" {
+			resSuffix += fmt.Sprintf("&arch=%v", policyFile.Service.Arch)
+		}
+
+		var services exchange.GetServicesResponse
+		httpCode := cliutils.ExchangeGet("Exchange", cliutils.GetExchangeUrl(), resSuffix, cliutils.OrgAndCreds(org, credToUse), []int{200, 404}, &services)
+		if httpCode == 404 {
+			continue
+		}
+
+		for sId, sDef := range services.Services {
+			if checked[sId] {
+				continue
+			}
+			checked[sId] = true
+
+			var svcPolicy exchange.ExchangePolicy
+			httpCode := cliutils.ExchangeGet("Exchange", cliutils.GetExchangeUrl(), "orgs/"+sId+"/policy", cliutils.OrgAndCreds(org, credToUse), []int{200, 404}, &svcPolicy)
+			if httpCode == 404 || len(svcPolicy.Constraints) == 0 {
+				continue
+			}
+
+			if warnings, err := policyFile.Constraints.AnalyzeConflicts(&svcPolicy.Constraints); err == nil {
+				for _, w := range warnings {
+					cliutils.Warning(msgPrinter.Sprintf("service %v version %v arch %v: %v", sDef.URL, sDef.Version, sDef.Arch, w.Message))
+				}
+			}
+		}
+	}
+}
+
 //BusinessUpdatePolicy will replace a single attribute of a business policy in the Horizon Exchange
 func BusinessUpdatePolicy(org string, credToUse string, policyName string, filePath string) {
 
@@ -187,6 +249,36 @@ func BusinessUpdatePolicy(org string, credToUse string, policyName string, fileP
 		msgPrinter.Println()
 		msgPrinter.Printf("Policy %v/%v updated in the Horizon Exchange", polOrg, policyName)
 		msgPrinter.Println()
+	} else if _, ok := findPatchType["rollout"]; ok {
+		patch := make(map[string]*businesspolicy.RolloutPolicy)
+		err := json.Unmarshal([]byte(attribute), &patch)
+		if err != nil {
+			cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal attribute input %s: %v", attribute, err))
+		}
+		if newValue := patch["rollout"]; newValue != nil {
+			if err := newValue.Validate(); err != nil {
+				cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Invalid format for rollout: %v", err))
+			}
+		}
+		msgPrinter.Printf("Updating Policy %v/%v in the Horizon Exchange and re-evaluating all agreements based on this deployment policy. Existing agreements might be cancelled and re-negotiated.", polOrg, policyName)
+		msgPrinter.Println()
+		cliutils.ExchangePutPost("Exchange", http.MethodPatch, exchUrl, "orgs/"+polOrg+"/business/policies"+cliutils.AddSlash(policyName), cliutils.OrgAndCreds(org, credToUse), []int{201}, patch, nil)
+		msgPrinter.Printf("Policy %v/%v updated in the Horizon Exchange", polOrg, policyName)
+		msgPrinter.Println()
+	} else if _, ok := findPatchType["maintenance"]; ok {
+		patch := make(map[string]*schedule.MaintenanceSchedule)
+		err := json.Unmarshal([]byte(attribute), &patch)
+		if err != nil {
+			cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal attribute input %s: %v", attribute, err))
+		}
+		if newValue := patch["maintenance"]; newValue != nil {
+			if err := newValue.Validate(); err != nil {
+				cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Invalid format for maintenance: %v", err))
+			}
+		}
+		cliutils.ExchangePutPost("Exchange", http.MethodPatch, exchUrl, "orgs/"+polOrg+"/business/policies"+cliutils.AddSlash(policyName), cliutils.OrgAndCreds(org, credToUse), []int{201}, patch, nil)
+		msgPrinter.Printf("Policy %v/%v updated in the Horizon Exchange", polOrg, policyName)
+		msgPrinter.Println()
 	} else {
 		_, ok := findPatchType["label"]
 		_, ok2 := findPatchType["description"]
@@ -202,7 +294,7 @@ func BusinessUpdatePolicy(org string, credToUse string, policyName string, fileP
 			msgPrinter.Printf("Policy %v/%v updated in the Horizon Exchange", polOrg, policyName)
 			msgPrinter.Println()
 		} else {
-			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Deployment policy attribute to be updated is not found in the input file. Supported attributes are: label, description, service, properties, constraints, and userInput."))
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Deployment policy attribute to be updated is not found in the input file. Supported attributes are: label, description, service, properties, constraints, userInput, rollout, and maintenance."))
 		}
 	}
 }
@@ -276,6 +368,30 @@ func BusinessNewPolicy() {
 		`      ]`,
 		`    }`,
 		`  ]`,
+		`  /* ` + msgPrinter.Sprintf("Optional. To deploy the service to the compatible nodes in steps instead of all at once, add a rollout:"),
+		`  "rollout": {`,
+		`    "initialPercent": 10,  ` + msgPrinter.Sprintf("The percentage of the nodes in the first step. Or use initialCount and stepCount."),
+		`    "stepPercent": 10,     ` + msgPrinter.Sprintf("The percentage of the nodes added by each subsequent step."),
+		`    "stepWaitSeconds": 0,  ` + msgPrinter.Sprintf("The minimum time between steps."),
+		`    "successCriteria": {   ` + msgPrinter.Sprintf("When the next step can start, and when the rollout is paused."),
+		`      "finalizedPercent": 100,`,
+		`      "runningSeconds": 0,`,
+		`      "maxFailedPercent": 10`,
+		`    }`,
+		`  }`,
+		`  */`,
+		`  /* ` + msgPrinter.Sprintf("Optional. To limit when agreements can be formed and when the service can be upgraded, add maintenance windows:"),
+		`  "maintenance": {`,
+		`    "timezone": "",        ` + msgPrinter.Sprintf("The time zone of the windows, for example America/New_York. The default is UTC."),
+		`    "agreementWindows": [  ` + msgPrinter.Sprintf("When new agreements can be formed. Any time when empty."),
+		`      {`,
+		`        "cron": "0 8-17 * * 1-5",  ` + msgPrinter.Sprintf("When the window opens: minute hour day-of-month month day-of-week."),
+		`        "durationMinutes": 60      ` + msgPrinter.Sprintf("How long the window stays open."),
+		`      }`,
+		`    ],`,
+		`    "upgradeWindows": []   ` + msgPrinter.Sprintf("When agreements can be cancelled to upgrade the service. Any time when empty."),
+		`  }`,
+		`  */`,
 		`}`,
 	}
 
@@ -10,6 +10,7 @@ import (
 	"github.com/open-horizon/anax/compcheck"
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/externalpolicy"
+	_ "github.com/open-horizon/anax/externalpolicy/json_language"
 	_ "github.com/open-horizon/anax/externalpolicy/text_language"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/persistence"
@@ -419,11 +420,14 @@ func NodeAddPolicy(org string, credToUse string, node string, jsonFilePath strin
 		cliutils.Fatal(cliutils.JSON_PARSING_ERROR, msgPrinter.Sprintf("failed to unmarshal json input file %s: %v", jsonFilePath, err))
 	}
 
-	//Check the policy file format
-	err = policyFile.ValidateAndNormalize()
+	//Check the policy file format, and warn about constraints that no service can satisfy, the policy is still published
+	warnings, err := policyFile.ValidateAndNormalizeWithWarnings()
 	if err != nil {
 		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Incorrect policy format in file %s: %v", jsonFilePath, err))
 	}
+	for _, w := range warnings {
+		cliutils.Warning(msgPrinter.Sprintf("node policy constraint: %v", w.Message))
+	}
 
 	// check node exists first
 	var nodes ExchangeNodes
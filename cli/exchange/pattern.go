@@ -10,6 +10,7 @@ import (
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/schedule"
 	"github.com/open-horizon/rsapss-tool/sign"
 	"github.com/open-horizon/rsapss-tool/verify"
 	"net/http"
@@ -26,14 +27,15 @@ type ExchangePatterns struct {
 }
 
 type PatternOutput struct {
-	Owner              string                       `json:"owner"`
-	Label              string                       `json:"label"`
-	Description        string                       `json:"description"`
-	Public             bool                         `json:"public"`
-	Services           []ServiceReference           `json:"services"`
-	AgreementProtocols []exchange.AgreementProtocol `json:"agreementProtocols"`
-	UserInput          []policy.UserInput           `json:"userInput,omitempty"`
-	LastUpdated        string                       `json:"lastUpdated,omitempty"`
+	Owner              string                        `json:"owner"`
+	Label              string                        `json:"label"`
+	Description        string                        `json:"description"`
+	Public             bool                          `json:"public"`
+	Services           []ServiceReference            `json:"services"`
+	AgreementProtocols []exchange.AgreementProtocol  `json:"agreementProtocols"`
+	UserInput          []policy.UserInput            `json:"userInput,omitempty"`
+	Maintenance        *schedule.MaintenanceSchedule `json:"maintenance,omitempty"`
+	LastUpdated        string                        `json:"lastUpdated,omitempty"`
 }
 
 // These 5 structs are used when reading json file the user gives us as input to create the pattern struct
@@ -61,12 +63,13 @@ type ServiceReference struct {
 	NodeH           *exchange.NodeHealth      `json:"nodeHealth,omitempty"`       // this needs to be a ptr so it will be omitted if not specified, so exchange will default it
 }
 type PatternInput struct {
-	Label              string                       `json:"label"`
-	Description        string                       `json:"description,omitempty"`
-	Public             bool                         `json:"public"`
-	Services           []ServiceReference           `json:"services,omitempty"`
-	AgreementProtocols []exchange.AgreementProtocol `json:"agreementProtocols,omitempty"`
-	UserInput          []policy.UserInput           `json:"userInput,omitempty"`
+	Label              string                        `json:"label"`
+	Description        string                        `json:"description,omitempty"`
+	Public             bool                          `json:"public"`
+	Services           []ServiceReference            `json:"services,omitempty"`
+	AgreementProtocols []exchange.AgreementProtocol  `json:"agreementProtocols,omitempty"`
+	UserInput          []policy.UserInput            `json:"userInput,omitempty"`
+	Maintenance        *schedule.MaintenanceSchedule `json:"maintenance,omitempty"`
 }
 
 // List the pattern resources for the given org.
@@ -147,6 +150,14 @@ func PatternUpdate(org string, credToUse string, pattern string, filePath string
 	} else if _, ok := findPatchType["userInput"]; ok {
 		patch = make(map[string][]policy.UserInput)
 		err = json.Unmarshal([]byte(attribute), &patch)
+	} else if _, ok := findPatchType["maintenance"]; ok {
+		maintPatch := make(map[string]*schedule.MaintenanceSchedule)
+		if err = json.Unmarshal([]byte(attribute), &maintPatch); err == nil && maintPatch["maintenance"] != nil {
+			if verr := maintPatch["maintenance"].Validate(); verr != nil {
+				cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Invalid format for maintenance: %v", verr))
+			}
+		}
+		patch = maintPatch
 	} else {
 		_, ok := findPatchType["label"]
 		_, ok2 := findPatchType["description"]
@@ -154,7 +165,7 @@ func PatternUpdate(org string, credToUse string, pattern string, filePath string
 			patch = make(map[string]string)
 			err = json.Unmarshal([]byte(attribute), &patch)
 		} else {
-			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Pattern attribute to be updated is not found in the input file. Supported attributes are: label, description, services, and userInput."))
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("Pattern attribute to be updated is not found in the input file. Supported attributes are: label, description, services, userInput, and maintenance."))
 		}
 	}
 
@@ -225,7 +236,13 @@ func PatternPublish(org, userPw, jsonFilePath, keyFilePath, pubKeyFilePath, patN
 	if patFile.Org == "" {
 		patFile.Org = org
 	}
-	patInput := PatternInput{Label: patFile.Label, Description: patFile.Description, Public: patFile.Public, AgreementProtocols: patFile.AgreementProtocols, UserInput: patFile.UserInput}
+	patInput := PatternInput{Label: patFile.Label, Description: patFile.Description, Public: patFile.Public, AgreementProtocols: patFile.AgreementProtocols, UserInput: patFile.UserInput, Maintenance: patFile.Maintenance}
+
+	if patInput.Maintenance != nil {
+		if err := patInput.Maintenance.Validate(); err != nil {
+			cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("the pattern definition has an invalid maintenance schedule: %v", err))
+		}
+	}
 
 	//issue 924: Patterns with no services are not allowed
 	if patFile.Services == nil || len(patFile.Services) == 0 {
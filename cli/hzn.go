@@ -422,6 +422,7 @@ Environment Variables:
 	policyCompDepPolFile := policyCompCmd.Flag("deployment-pol", msgPrinter.Sprintf("The JSON input file name containing the Deployment policy. Mutually exclusive with -b.")).Short('B').String()
 	policyCompSPolFile := policyCompCmd.Flag("service-pol", msgPrinter.Sprintf("(optional) The JSON input file name containing the service policy. If omitted, the service policy will be retrieved from the Exchange for the service defined in the deployment policy.")).String()
 	policyCompSvcFile := policyCompCmd.Flag("service", msgPrinter.Sprintf("(optional) The JSON input file name containing the service definition. Mutually exclusive with -b. If omitted, the service referenced in the deployment policy is retrieved from the Exchange. This flag can be repeated to specify different versions of the service.")).Strings()
+	policyCompExplain := policyCompCmd.Flag("explain", msgPrinter.Sprintf("Show how the constraints of the node and of the deployment and service policies were evaluated against the properties of the other side, for each service.")).Bool()
 	userinputCompCmd := deploycheckCmd.Command("userinput", msgPrinter.Sprintf("Check user input compatibility."))
 	userinputCompNodeArch := userinputCompCmd.Flag("arch", msgPrinter.Sprintf("The architecture of the node. It is required when -n is not specified. If omitted, the service of all the architectures referenced in the deployment policy or pattern will be checked for compatibility.")).Short('a').String()
 	userinputCompNodeType := userinputCompCmd.Flag("node-type", msgPrinter.Sprintf("The node type. The valid values are 'device' and 'cluster'. The default value is the type of the node provided by -n or current registered device, if omitted.")).Short('t').String()
@@ -448,6 +449,17 @@ Environment Variables:
 	allCompSvcFile := allCompCmd.Flag("service", msgPrinter.Sprintf("(optional) The JSON input file name containing the service definition. If omitted, the service defined in the deployment policy or pattern will be retrieved from the Exchange. This flag can be repeated to specify different versions of the service.")).Strings()
 	allCompPatternId := allCompCmd.Flag("pattern-id", msgPrinter.Sprintf("The Horizon exchange pattern ID. Mutually exclusive with -P, -b, -B --node-pol and --service-pol. If you don't prepend it with the organization id, it will automatically be prepended with the node's organization id.")).Short('p').String()
 	allCompPatternFile := allCompCmd.Flag("pattern", msgPrinter.Sprintf("The JSON input file name containing the pattern. Mutually exclusive with -p, -b and -B, --node-pol and --service-pol.")).Short('P').String()
+	impactCmd := deploycheckCmd.Command("impact", msgPrinter.Sprintf("Show which nodes would gain, keep or lose an agreement if a deployment policy is changed. The agbot secure API in HZN_AGBOT_URL checks the changed policy against all the nodes that the agbot serves the policy to."))
+	impactDepPolId := impactCmd.Flag("deployment-pol-id", msgPrinter.Sprintf("The Horizon exchange deployment policy ID. If you don't prepend it with the organization id, it will automatically be prepended with the -o value.")).Short('b').Required().String()
+	impactDepPolFile := impactCmd.Flag("deployment-pol", msgPrinter.Sprintf("(optional) The JSON input file name containing the changed deployment policy. If omitted, the deployment policy in the Exchange will be checked.")).Short('B').String()
+	impactSPolFile := impactCmd.Flag("service-pol", msgPrinter.Sprintf("(optional) The JSON input file name containing the changed service policy. If omitted, the service policy will be retrieved from the Exchange for the service defined in the deployment policy.")).String()
+	matrixCmd := deploycheckCmd.Command("matrix", msgPrinter.Sprintf("Check the compatibility of deployment policies and patterns with a list of nodes or all the nodes in an organization. The agbot secure API in HZN_AGBOT_URL checks each node against each deployment policy and pattern."))
+	matrixDepPolIds := matrixCmd.Flag("deployment-pol-id", msgPrinter.Sprintf("The Horizon exchange deployment policy ID. If you don't prepend it with the organization id, it will automatically be prepended with the -o value. This flag can be repeated.")).Short('b').Strings()
+	matrixPatternIds := matrixCmd.Flag("pattern-id", msgPrinter.Sprintf("The Horizon exchange pattern ID. If you don't prepend it with the organization id, it will automatically be prepended with the -o value. This flag can be repeated.")).Short('p').Strings()
+	matrixNodeIds := matrixCmd.Flag("node-id", msgPrinter.Sprintf("The Horizon exchange node ID. If you don't prepend it with the organization id, it will automatically be prepended with the -o value. This flag can be repeated. Mutually exclusive with --node-org. If neither is specified, all the nodes in the -o organization are checked.")).Short('n').Strings()
+	matrixNodeOrg := matrixCmd.Flag("node-org", msgPrinter.Sprintf("Check all the nodes in this organization. Mutually exclusive with -n.")).String()
+	matrixSelector := matrixCmd.Flag("selector", msgPrinter.Sprintf("Only check the nodes whose node policy properties satisfy this constraint, for example 'purpose == test'. This flag can be repeated.")).Short('s').Strings()
+	matrixFormat := matrixCmd.Flag("output", msgPrinter.Sprintf("The output format: table, csv or json.")).Default("table").String()
 
 	agreementCmd := app.Command("agreement", msgPrinter.Sprintf("List or manage the active or archived agreements this edge node has made with a Horizon agreement bot."))
 	agreementListCmd := agreementCmd.Command("list", msgPrinter.Sprintf("List the active or archived agreements this edge node has made with a Horizon agreement bot."))
@@ -572,15 +584,23 @@ Environment Variables:
 	agbotAgreementListCmd := agbotAgreementCmd.Command("list", msgPrinter.Sprintf("List the active or archived agreements this Horizon agreement bot has with edge nodes."))
 	agbotlistArchivedAgreements := agbotAgreementListCmd.Flag("archived", msgPrinter.Sprintf("List archived agreements instead of the active agreements.")).Short('r').Bool()
 	agbotAgreement := agbotAgreementListCmd.Arg("agreement", msgPrinter.Sprintf("List just this one agreement.")).String()
-	agbotAgreementCancelCmd := agbotAgreementCmd.Command("cancel", msgPrinter.Sprintf("Cancel 1 or all of the active agreements this Horizon agreement bot has with edge nodes. Usually an agbot will immediately negotiated a new agreement. "))
+	agbotAgreementCancelCmd := agbotAgreementCmd.Command("cancel", msgPrinter.Sprintf("Cancel 1, all or a selection of the active agreements this Horizon agreement bot has with edge nodes. Usually an agbot will immediately negotiated a new agreement. "))
 	agbotCancelAllAgreements := agbotAgreementCancelCmd.Flag("all", msgPrinter.Sprintf("Cancel all of the current agreements.")).Short('a').Bool()
 	agbotCancelAgreementId := agbotAgreementCancelCmd.Arg("agreement", msgPrinter.Sprintf("The active agreement to cancel.")).String()
+	agbotCancelSelectors := agbotAgreementCancelCmd.Flag("selector", msgPrinter.Sprintf("Cancel the active agreements selected by key=value, where key is policy (org/name of a deployment policy), pattern (org/name), service (org/url), version (a version or version range of the service), node-org or property (a node property, name=value). This flag can be repeated, the agreements must match all the selectors. Mutually exclusive with -a and the agreement argument.")).Short('s').Strings()
+	agbotCancelListOnly := agbotAgreementCancelCmd.Flag("list-only", msgPrinter.Sprintf("List the agreements selected by --selector without canceling them.")).Bool()
+	agbotCancelMaxPerMinute := agbotAgreementCancelCmd.Flag("max-per-minute", msgPrinter.Sprintf("The maximum number of agreements selected by --selector that the agbot cancels in a minute. If omitted or higher than the agbot's configured limit, the configured limit is used.")).Int()
 	agbotPolicyCmd := agbotCmd.Command("policy", msgPrinter.Sprintf("List the policies this Horizon agreement bot hosts."))
 	agbotPolicyListCmd := agbotPolicyCmd.Command("list", msgPrinter.Sprintf("List policies this Horizon agreement bot hosts."))
 	agbotPolicyOrg := agbotPolicyListCmd.Arg("org", msgPrinter.Sprintf("The organization the policy belongs to.")).String()
 	agbotPolicyName := agbotPolicyListCmd.Arg("name", msgPrinter.Sprintf("The policy name.")).String()
 	agbotStatusCmd := agbotCmd.Command("status", msgPrinter.Sprintf("Display the current horizon internal status for the Horizon agreement bot."))
 	agbotStatusLong := agbotStatusCmd.Flag("long", msgPrinter.Sprintf("Show detailed status")).Short('l').Bool()
+	agbotDbCmd := agbotCmd.Command("db", msgPrinter.Sprintf("Export or import the agreement state in the Horizon agreement bot's database."))
+	agbotDbExportCmd := agbotDbCmd.Command("export", msgPrinter.Sprintf("Export all the agreements (active and archived), workload usages and search sessions in the agbot's database to a portable archive."))
+	agbotDbExportFile := agbotDbExportCmd.Flag("file", msgPrinter.Sprintf("The file to write the archive to. If omitted or '-', the archive is written to stdout.")).Short('f').String()
+	agbotDbImportCmd := agbotDbCmd.Command("import", msgPrinter.Sprintf("Import an archive created by 'hzn agbot db export' into the agbot's database. Agreements and workload usages that are already in the database are skipped."))
+	agbotDbImportFile := agbotDbImportCmd.Flag("file", msgPrinter.Sprintf("The archive file to import. Specify -f- to read from stdin.")).Short('f').Required().String()
 
 	utilCmd := app.Command("util", msgPrinter.Sprintf("Utility commands."))
 	utilSignCmd := utilCmd.Command("sign", msgPrinter.Sprintf("Sign the text in stdin. The signature is sent to stdout."))
@@ -628,6 +648,10 @@ Environment Variables:
 	mmsObjectDownloadId := mmsObjectDownloadCmd.Flag("id", msgPrinter.Sprintf("The id of the object to download data. This flag must be used with -t.")).Short('i').Required().String()
 	mmsObjectDownloadFile := mmsObjectDownloadCmd.Flag("file", msgPrinter.Sprintf("The file that the data of downloaded object is written to. This flag must be used with -f. If omit, will use default file name in format of objectType_objectID and save in current directory")).Short('f').String()
 	mmsObjectDownloadOverwrite := mmsObjectDownloadCmd.Flag("overwrite", msgPrinter.Sprintf("Overwrite the existing file if it exists in the file system.")).Short('O').Bool()
+	mmsObjectStatusCmd := mmsObjectCmd.Command("status", msgPrinter.Sprintf("Display the delivery status of an object on its destination nodes in the Horizon Model Management Service."))
+	mmsObjectStatusType := mmsObjectStatusCmd.Flag("type", msgPrinter.Sprintf("The type of the object. It can only be omitted with --policy.")).Short('t').String()
+	mmsObjectStatusId := mmsObjectStatusCmd.Flag("id", msgPrinter.Sprintf("The id of the object. This flag must be used with -t. It can only be omitted with --policy.")).Short('i').String()
+	mmsObjectStatusPolicy := mmsObjectStatusCmd.Flag("policy", msgPrinter.Sprintf("Ask the agbot in HZN_AGBOT_URL which nodes the object is expected on, based on its agreements and the object's policy, and compare them with the object's destinations. If -t and -i are omitted, all the objects with a policy are shown.")).Short('p').Bool()
 
 	voucherCmd := app.Command("voucher", msgPrinter.Sprintf("List and manage Horizon SDO ownership vouchers."))
 
@@ -999,11 +1023,15 @@ Environment Variables:
 	case policyRemoveCmd.FullCommand():
 		policy.Remove(*policyRemoveForce)
 	case policyCompCmd.FullCommand():
-		deploycheck.PolicyCompatible(*deploycheckOrg, *deploycheckUserPw, *policyCompNodeId, *policyCompNodeArch, *policyCompNodeType, *policyCompNodePolFile, *policyCompBPolId, *policyCompBPolFile, *policyCompSPolFile, *policyCompSvcFile, *deploycheckCheckAll, *deploycheckLong)
+		deploycheck.PolicyCompatible(*deploycheckOrg, *deploycheckUserPw, *policyCompNodeId, *policyCompNodeArch, *policyCompNodeType, *policyCompNodePolFile, *policyCompBPolId, *policyCompBPolFile, *policyCompSPolFile, *policyCompSvcFile, *deploycheckCheckAll, *deploycheckLong, *policyCompExplain)
 	case userinputCompCmd.FullCommand():
 		deploycheck.UserInputCompatible(*deploycheckOrg, *deploycheckUserPw, *userinputCompNodeId, *userinputCompNodeArch, *userinputCompNodeType, *userinputCompNodeUIFile, *userinputCompBPolId, *userinputCompBPolFile, *userinputCompPatternId, *userinputCompPatternFile, *userinputCompSvcFile, *deploycheckCheckAll, *deploycheckLong)
 	case allCompCmd.FullCommand():
 		deploycheck.AllCompatible(*deploycheckOrg, *deploycheckUserPw, *allCompNodeId, *allCompNodeArch, *allCompNodeType, *allCompNodePolFile, *allCompNodeUIFile, *allCompBPolId, *allCompBPolFile, *allCompPatternId, *allCompPatternFile, *allCompSPolFile, *allCompSvcFile, *deploycheckCheckAll, *deploycheckLong)
+	case impactCmd.FullCommand():
+		deploycheck.DeployImpact(*deploycheckOrg, *deploycheckUserPw, *impactDepPolId, *impactDepPolFile, *impactSPolFile)
+	case matrixCmd.FullCommand():
+		deploycheck.DeployMatrix(*deploycheckOrg, *deploycheckUserPw, *matrixDepPolIds, *matrixPatternIds, *matrixNodeIds, *matrixNodeOrg, *matrixSelector, *matrixFormat)
 	case agreementListCmd.FullCommand():
 		agreement.List(*listArchivedAgreements, *listAgreementId)
 	case agreementCancelCmd.FullCommand():
@@ -1061,11 +1089,15 @@ Environment Variables:
 	case agbotAgreementListCmd.FullCommand():
 		agreementbot.AgreementList(*agbotlistArchivedAgreements, *agbotAgreement)
 	case agbotAgreementCancelCmd.FullCommand():
-		agreementbot.AgreementCancel(*agbotCancelAgreementId, *agbotCancelAllAgreements)
+		agreementbot.AgreementCancel(*agbotCancelAgreementId, *agbotCancelAllAgreements, *agbotCancelSelectors, *agbotCancelListOnly, *agbotCancelMaxPerMinute)
 	case agbotListCmd.FullCommand():
 		agreementbot.List()
 	case agbotPolicyListCmd.FullCommand():
 		agreementbot.PolicyList(*agbotPolicyOrg, *agbotPolicyName)
+	case agbotDbExportCmd.FullCommand():
+		agreementbot.DbExport(*agbotDbExportFile)
+	case agbotDbImportCmd.FullCommand():
+		agreementbot.DbImport(*agbotDbImportFile)
 	case utilSignCmd.FullCommand():
 		utilcmds.Sign(*utilSignPrivKeyFile)
 	case utilVerifyCmd.FullCommand():
@@ -1086,6 +1118,8 @@ Environment Variables:
 		sync_service.ObjectDelete(*mmsOrg, *mmsUserPw, *mmsObjectDeleteType, *mmsObjectDeleteId)
 	case mmsObjectDownloadCmd.FullCommand():
 		sync_service.ObjectDownLoad(*mmsOrg, *mmsUserPw, *mmsObjectDownloadType, *mmsObjectDownloadId, *mmsObjectDownloadFile, *mmsObjectDownloadOverwrite)
+	case mmsObjectStatusCmd.FullCommand():
+		sync_service.ObjectStatus(*mmsOrg, *mmsUserPw, *mmsObjectStatusType, *mmsObjectStatusId, *mmsObjectStatusPolicy)
 	case voucherInspectCmd.FullCommand():
 		sdo.VoucherInspect(*voucherInspectFile)
 	case voucherImportCmd.FullCommand():
@@ -3,12 +3,14 @@ package sync_service
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/open-horizon/anax/agreementbot"
 	"github.com/open-horizon/anax/cli/cliconfig"
 	"github.com/open-horizon/anax/cli/cliutils"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/edge-sync-service/common"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"regexp"
@@ -416,3 +418,51 @@ func timeIsValid(timestamp string) (bool, string) {
 	}
 	return true, ""
 }
+
+// Display the delivery status of an object in the MMS. With policy, the agbot whose secure API url is in HZN_AGBOT_URL
+// compares the nodes that the object is expected on, based on the agbot's agreements and the object's policy, with the
+// object's destinations. The type and id can then be omitted to show all the objects with a destination policy.
+func ObjectStatus(org string, userPw string, objType string, objId string, withPolicy bool) {
+	// get message printer
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if userPw == "" {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("must specify exchange credentials to access the model management service."))
+	} else if objId != "" && objType == "" {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("must specify --type with --id."))
+	} else if !withPolicy && (objType == "" || objId == "") {
+		cliutils.Fatal(cliutils.CLI_INPUT_ERROR, msgPrinter.Sprintf("must specify --type and --id, they can only be omitted with --policy."))
+	}
+
+	// Set the API key env var if that's what we're using.
+	cliutils.SetWhetherUsingApiKey(userPw)
+
+	var output string
+	if withPolicy {
+		query := url.Values{}
+		if objType != "" {
+			query.Set("objectType", objType)
+		}
+		if objId != "" {
+			query.Set("objectID", objId)
+		}
+		urlPath := path.Join("mms/status", org)
+		if len(query) != 0 {
+			urlPath += "?" + query.Encode()
+		}
+
+		var objStatuses []agreementbot.ObjectDeliveryStatus
+		cliutils.ExchangeGet("Agbot", cliutils.GetAgbotSecureAPIUrlBase(), urlPath, cliutils.OrgAndCreds(org, userPw), []int{200}, &objStatuses)
+		output = cliutils.MarshalIndent(objStatuses, "mms object status")
+	} else {
+		var objectDests []common.DestinationsStatus
+		urlPath := path.Join("api/v1/objects/", org, objType, objId, "destinations")
+		httpCode := cliutils.ExchangeGet("Model Management Service", cliutils.GetMMSUrl(), urlPath, cliutils.OrgAndCreds(org, userPw), []int{200, 404}, &objectDests)
+		if httpCode == 404 {
+			cliutils.Fatal(cliutils.NOT_FOUND, msgPrinter.Sprintf("object '%s' of type '%s' not found in org %s", objId, objType, org))
+		}
+		output = cliutils.MarshalIndent(MMSObjectInfo{ObjectID: objId, ObjectType: objType, Destinations: objectDests}, "mms object status")
+	}
+
+	fmt.Println(output)
+}
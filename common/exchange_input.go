@@ -7,6 +7,7 @@ import (
 	"github.com/open-horizon/anax/exchange"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/schedule"
 	"github.com/open-horizon/anax/semanticversion"
 	"golang.org/x/text/message"
 )
@@ -32,14 +33,15 @@ type AbstractPatternFile interface {
 
 // This is used when reading json file the user gives us as an input to create the pattern
 type PatternFile struct {
-	Name               string                       `json:"name,omitempty"`
-	Org                string                       `json:"org,omitempty"` // optional
-	Label              string                       `json:"label"`
-	Description        string                       `json:"description,omitempty"`
-	Public             bool                         `json:"public"`
-	Services           []ServiceReferenceFile       `json:"services"`
-	AgreementProtocols []exchange.AgreementProtocol `json:"agreementProtocols,omitempty"`
-	UserInput          []policy.UserInput           `json:"userInput,omitempty"`
+	Name               string                        `json:"name,omitempty"`
+	Org                string                        `json:"org,omitempty"` // optional
+	Label              string                        `json:"label"`
+	Description        string                        `json:"description,omitempty"`
+	Public             bool                          `json:"public"`
+	Services           []ServiceReferenceFile        `json:"services"`
+	AgreementProtocols []exchange.AgreementProtocol  `json:"agreementProtocols,omitempty"`
+	UserInput          []policy.UserInput            `json:"userInput,omitempty"`
+	Maintenance        *schedule.MaintenanceSchedule `json:"maintenance,omitempty"`
 }
 
 func (p *PatternFile) GetOrg() string {
@@ -84,11 +84,14 @@ type CompCheckOutput struct {
 	Compatible bool               `json:"compatible"`
 	Reason     map[string]string  `json:"reason"` // set when not compatible
 	Input      *CompCheckResource `json:"input,omitempty"`
+
+	// The evaluation of the constraints for each service, set when the policy check is asked to explain it.
+	Trace map[string]*policy.CompatibilityTrace `json:"trace,omitempty"`
 }
 
 func (p *CompCheckOutput) String() string {
-	return fmt.Sprintf("Compatible: %v, Reason: %v, Input: %v",
-		p.Compatible, p.Reason, p.Input)
+	return fmt.Sprintf("Compatible: %v, Reason: %v, Input: %v, Trace: %v",
+		p.Compatible, p.Reason, p.Input, p.Trace)
 
 }
 
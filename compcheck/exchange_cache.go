@@ -0,0 +1,260 @@
+package compcheck
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/exchange"
+	"golang.org/x/text/message"
+	"sync"
+)
+
+// A cache of the exchange resources read by the compatibility checks, for APIs that check many nodes and deployments in
+// one request. Each node, node policy, deployment policy, pattern, service and service policy is read from the exchange
+// once, the checks of the other nodes and deployments use the copy in the cache. Errors are cached too, so a resource
+// that cannot be read fails every check that needs it without going back to the exchange.
+//
+// The cache does not notice changes made in the exchange after a resource was read, it should live no longer than the
+// request that created it.
+type ExchangeCache struct {
+	lock sync.Mutex
+
+	getDevice           exchange.DeviceHandler
+	getNodePolicy       exchange.NodePolicyHandler
+	getBusinessPolicies exchange.BusinessPoliciesHandler
+	getPatterns         exchange.PatternHandler
+	getServicePolicy    exchange.ServicePolicyHandler
+	getService          exchange.ServiceHandler
+	resolveServiceDef   exchange.ServiceDefResolverHandler
+	getSelectedServices exchange.SelectedServicesHandler
+
+	devices          map[string]cachedResult
+	nodePolicies     map[string]cachedResult
+	businessPolicies map[string]cachedResult
+	patterns         map[string]cachedResult
+	servicePolicies  map[string]cachedResult
+	services         map[string]cachedResult
+	resolvedServices map[string]cachedResult
+	selectedServices map[string]cachedResult
+}
+
+// The results of one exchange call.
+type cachedResult struct {
+	values []interface{}
+	err    error
+}
+
+func NewExchangeCache(ec exchange.ExchangeContext) *ExchangeCache {
+	return newExchangeCache(exchange.GetHTTPDeviceHandler(ec),
+		exchange.GetHTTPNodePolicyHandler(ec),
+		exchange.GetHTTPBusinessPoliciesHandler(ec),
+		exchange.GetHTTPExchangePatternHandler(ec),
+		exchange.GetHTTPServicePolicyHandler(ec),
+		exchange.GetHTTPServiceHandler(ec),
+		exchange.GetHTTPServiceDefResolverHandler(ec),
+		exchange.GetHTTPSelectedServicesHandler(ec))
+}
+
+func newExchangeCache(getDevice exchange.DeviceHandler,
+	getNodePolicy exchange.NodePolicyHandler,
+	getBusinessPolicies exchange.BusinessPoliciesHandler,
+	getPatterns exchange.PatternHandler,
+	getServicePolicy exchange.ServicePolicyHandler,
+	getService exchange.ServiceHandler,
+	resolveServiceDef exchange.ServiceDefResolverHandler,
+	getSelectedServices exchange.SelectedServicesHandler) *ExchangeCache {
+
+	return &ExchangeCache{
+		getDevice:           getDevice,
+		getNodePolicy:       getNodePolicy,
+		getBusinessPolicies: getBusinessPolicies,
+		getPatterns:         getPatterns,
+		getServicePolicy:    getServicePolicy,
+		getService:          getService,
+		resolveServiceDef:   resolveServiceDef,
+		getSelectedServices: getSelectedServices,
+		devices:             make(map[string]cachedResult),
+		nodePolicies:        make(map[string]cachedResult),
+		businessPolicies:    make(map[string]cachedResult),
+		patterns:            make(map[string]cachedResult),
+		servicePolicies:     make(map[string]cachedResult),
+		services:            make(map[string]cachedResult),
+		resolvedServices:    make(map[string]cachedResult),
+		selectedServices:    make(map[string]cachedResult),
+	}
+}
+
+func (c *ExchangeCache) String() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return fmt.Sprintf("Devices: %v, NodePolicies: %v, BusinessPolicies: %v, Patterns: %v, ServicePolicies: %v, Services: %v, ResolvedServices: %v, SelectedServices: %v",
+		len(c.devices), len(c.nodePolicies), len(c.businessPolicies), len(c.patterns), len(c.servicePolicies), len(c.services), len(c.resolvedServices), len(c.selectedServices))
+}
+
+// Add nodes that the caller has already read from the exchange, so that they are not read again one at a time.
+func (c *ExchangeCache) AddDevices(devices map[string]exchange.Device) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for id, dev := range devices {
+		d := dev
+		c.devices[id] = cachedResult{values: []interface{}{&d}}
+	}
+}
+
+// Returns the cached results for the key, or calls the exchange and caches its results.
+func (c *ExchangeCache) get(cache map[string]cachedResult, key string, call func() cachedResult) cachedResult {
+	c.lock.Lock()
+	if r, ok := cache[key]; ok {
+		c.lock.Unlock()
+		return r
+	}
+	c.lock.Unlock()
+
+	r := call()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cache[key] = r
+	return r
+}
+
+// The handlers below return copies of the cached objects, the compatibility checks add to the maps they are given.
+
+func (c *ExchangeCache) DeviceHandler() exchange.DeviceHandler {
+	return func(id string, token string) (*exchange.Device, error) {
+		r := c.get(c.devices, id, func() cachedResult {
+			dev, err := c.getDevice(id, token)
+			return cachedResult{values: []interface{}{dev}, err: err}
+		})
+		if dev := r.values[0].(*exchange.Device); dev != nil {
+			d := *dev
+			return &d, r.err
+		}
+		return nil, r.err
+	}
+}
+
+func (c *ExchangeCache) NodePolicyHandler() exchange.NodePolicyHandler {
+	return func(deviceId string) (*exchange.ExchangePolicy, error) {
+		r := c.get(c.nodePolicies, deviceId, func() cachedResult {
+			pol, err := c.getNodePolicy(deviceId)
+			return cachedResult{values: []interface{}{pol}, err: err}
+		})
+		if pol := r.values[0].(*exchange.ExchangePolicy); pol != nil {
+			p := *pol
+			return &p, r.err
+		}
+		return nil, r.err
+	}
+}
+
+func (c *ExchangeCache) BusinessPoliciesHandler() exchange.BusinessPoliciesHandler {
+	return func(org string, policy_id string) (map[string]exchange.ExchangeBusinessPolicy, error) {
+		r := c.get(c.businessPolicies, fmt.Sprintf("%v/%v", org, policy_id), func() cachedResult {
+			pols, err := c.getBusinessPolicies(org, policy_id)
+			return cachedResult{values: []interface{}{pols}, err: err}
+		})
+		pols := r.values[0].(map[string]exchange.ExchangeBusinessPolicy)
+		if pols == nil {
+			return nil, r.err
+		}
+		copied := make(map[string]exchange.ExchangeBusinessPolicy, len(pols))
+		for id, pol := range pols {
+			copied[id] = pol
+		}
+		return copied, r.err
+	}
+}
+
+func (c *ExchangeCache) PatternHandler() exchange.PatternHandler {
+	return func(org string, pattern string) (map[string]exchange.Pattern, error) {
+		r := c.get(c.patterns, fmt.Sprintf("%v/%v", org, pattern), func() cachedResult {
+			pats, err := c.getPatterns(org, pattern)
+			return cachedResult{values: []interface{}{pats}, err: err}
+		})
+		pats := r.values[0].(map[string]exchange.Pattern)
+		if pats == nil {
+			return nil, r.err
+		}
+		copied := make(map[string]exchange.Pattern, len(pats))
+		for id, pat := range pats {
+			copied[id] = pat
+		}
+		return copied, r.err
+	}
+}
+
+func (c *ExchangeCache) ServicePolicyHandler() exchange.ServicePolicyHandler {
+	return func(sUrl string, sOrg string, sVersion string, sArch string) (*exchange.ExchangePolicy, string, error) {
+		r := c.get(c.servicePolicies, serviceKey(sUrl, sOrg, sVersion, sArch), func() cachedResult {
+			pol, id, err := c.getServicePolicy(sUrl, sOrg, sVersion, sArch)
+			return cachedResult{values: []interface{}{pol, id}, err: err}
+		})
+		if pol := r.values[0].(*exchange.ExchangePolicy); pol != nil {
+			p := *pol
+			return &p, r.values[1].(string), r.err
+		}
+		return nil, r.values[1].(string), r.err
+	}
+}
+
+func (c *ExchangeCache) ServiceHandler() exchange.ServiceHandler {
+	return func(wUrl string, wOrg string, wVersion string, wArch string) (*exchange.ServiceDefinition, string, error) {
+		r := c.get(c.services, serviceKey(wUrl, wOrg, wVersion, wArch), func() cachedResult {
+			svc, id, err := c.getService(wUrl, wOrg, wVersion, wArch)
+			return cachedResult{values: []interface{}{svc, id}, err: err}
+		})
+		if svc := r.values[0].(*exchange.ServiceDefinition); svc != nil {
+			s := *svc
+			return &s, r.values[1].(string), r.err
+		}
+		return nil, r.values[1].(string), r.err
+	}
+}
+
+func (c *ExchangeCache) ServiceDefResolverHandler() exchange.ServiceDefResolverHandler {
+	return func(wUrl string, wOrg string, wVersion string, wArch string) (map[string]exchange.ServiceDefinition, *exchange.ServiceDefinition, string, error) {
+		r := c.get(c.resolvedServices, serviceKey(wUrl, wOrg, wVersion, wArch), func() cachedResult {
+			deps, top, id, err := c.resolveServiceDef(wUrl, wOrg, wVersion, wArch)
+			return cachedResult{values: []interface{}{deps, top, id}, err: err}
+		})
+		var deps map[string]exchange.ServiceDefinition
+		if cached := r.values[0].(map[string]exchange.ServiceDefinition); cached != nil {
+			deps = make(map[string]exchange.ServiceDefinition, len(cached))
+			for id, svc := range cached {
+				deps[id] = svc
+			}
+		}
+		var top *exchange.ServiceDefinition
+		if cached := r.values[1].(*exchange.ServiceDefinition); cached != nil {
+			s := *cached
+			top = &s
+		}
+		return deps, top, r.values[2].(string), r.err
+	}
+}
+
+func (c *ExchangeCache) SelectedServicesHandler() exchange.SelectedServicesHandler {
+	return func(wUrl string, wOrg string, wVersion string, wArch string) (map[string]exchange.ServiceDefinition, error) {
+		r := c.get(c.selectedServices, serviceKey(wUrl, wOrg, wVersion, wArch), func() cachedResult {
+			svcs, err := c.getSelectedServices(wUrl, wOrg, wVersion, wArch)
+			return cachedResult{values: []interface{}{svcs}, err: err}
+		})
+		svcs := r.values[0].(map[string]exchange.ServiceDefinition)
+		if svcs == nil {
+			return nil, r.err
+		}
+		copied := make(map[string]exchange.ServiceDefinition, len(svcs))
+		for id, svc := range svcs {
+			copied[id] = svc
+		}
+		return copied, r.err
+	}
+}
+
+func serviceKey(url string, org string, version string, arch string) string {
+	return fmt.Sprintf("%v/%v/%v/%v", org, url, version, arch)
+}
+
+// Same as DeployCompatible, with the exchange resources read through the cache.
+func (c *ExchangeCache) DeployCompatible(ccInput *CompCheck, checkAllSvcs bool, msgPrinter *message.Printer) (*CompCheckOutput, error) {
+	return deployCompatible(c.DeviceHandler(), c.NodePolicyHandler(), c.BusinessPoliciesHandler(), c.PatternHandler(), c.ServicePolicyHandler(), c.ServiceHandler(), c.ServiceDefResolverHandler(), c.SelectedServicesHandler(), ccInput, checkAllSvcs, msgPrinter)
+}
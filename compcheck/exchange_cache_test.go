@@ -0,0 +1,56 @@
+// +build unit
+
+package compcheck
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/exchange"
+	"testing"
+)
+
+// The exchange is called once for each resource, and the callers get copies of the cached objects.
+func Test_ExchangeCache(t *testing.T) {
+
+	calls := make(map[string]int)
+	getDevice := func(id string, token string) (*exchange.Device, error) {
+		calls["device "+id] += 1
+		return &exchange.Device{Name: id, Arch: "amd64"}, nil
+	}
+	getNodePolicy := func(deviceId string) (*exchange.ExchangePolicy, error) {
+		calls["policy "+deviceId] += 1
+		if deviceId == "myorg/bad" {
+			return nil, errors.New("no such node")
+		}
+		return &exchange.ExchangePolicy{}, nil
+	}
+	getSelectedServices := func(wUrl string, wOrg string, wVersion string, wArch string) (map[string]exchange.ServiceDefinition, error) {
+		calls["services "+wUrl] += 1
+		return map[string]exchange.ServiceDefinition{wOrg + "/" + wUrl: {URL: wUrl, Version: wVersion}}, nil
+	}
+
+	c := newExchangeCache(getDevice, getNodePolicy, nil, nil, nil, nil, nil, getSelectedServices)
+	c.AddDevices(map[string]exchange.Device{"myorg/n1": {Name: "n1", Arch: "arm64"}})
+
+	for i := 0; i < 3; i++ {
+		if dev, err := c.DeviceHandler()("myorg/n1", ""); err != nil || dev.Arch != "arm64" {
+			t.Errorf("expected the added node, got %v %v", dev, err)
+		} else {
+			dev.Arch = "changed"
+		}
+		if dev, err := c.DeviceHandler()("myorg/n2", ""); err != nil || dev.Arch != "amd64" {
+			t.Errorf("expected the node from the exchange, got %v %v", dev, err)
+		}
+		if _, err := c.NodePolicyHandler()("myorg/bad"); err == nil {
+			t.Errorf("expected the error to be cached")
+		}
+		if svcs, err := c.SelectedServicesHandler()("svc1", "myorg", "1.0.0", "amd64"); err != nil || len(svcs) != 1 {
+			t.Errorf("unexpected services %v %v", svcs, err)
+		} else {
+			svcs["myorg/other"] = exchange.ServiceDefinition{}
+		}
+	}
+
+	if calls["device myorg/n1"] != 0 || calls["device myorg/n2"] != 1 || calls["policy myorg/bad"] != 1 || calls["services svc1"] != 1 {
+		t.Errorf("unexpected exchange calls %v", calls)
+	}
+}
@@ -0,0 +1,90 @@
+package compcheck
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/externalpolicy"
+	"github.com/open-horizon/anax/i18n"
+	"golang.org/x/text/message"
+)
+
+// The current placement of a deployment policy. Only the agbot that serves the policy has the agreements that the
+// placement limits are checked against, so the placement check is done by the agbot and its secure API.
+type PlacementState struct {
+	ValueCounts  map[string]map[string]int // the number of nodes with an agreement for the policy, by node property name and value
+	NodeServices []string                  // the services (org/url) that are running on the node being checked
+}
+
+func (p PlacementState) String() string {
+	return fmt.Sprintf("ValueCounts: %v, NodeServices: %v", p.ValueCounts, p.NodeServices)
+}
+
+// Returns the value of a node property that the placement limits are counted by, and false if the node does not
+// have the property.
+func PlacementValue(nodeProps externalpolicy.PropertyList, property string) (string, bool) {
+	if prop, err := nodeProps.GetProperty(property); err != nil {
+		return "", false
+	} else {
+		return fmt.Sprintf("%v", prop.Value), true
+	}
+}
+
+// Check the placement section of a deployment policy against a node with the given properties. It returns false
+// and the reason when a placement limit or an anti-affinity rule excludes the node.
+func PlacementCompatible(placement *businesspolicy.Placement, nodeProps externalpolicy.PropertyList, state *PlacementState, msgPrinter *message.Printer) (bool, string) {
+	// get default message printer if nil
+	if msgPrinter == nil {
+		msgPrinter = i18n.GetMessagePrinter()
+	}
+
+	if placement == nil || state == nil {
+		return true, ""
+	}
+
+	for _, rule := range placement.AntiAffinity {
+		svc := fmt.Sprintf("%v/%v", rule.Org, rule.Name)
+		for _, running := range state.NodeServices {
+			if running == svc {
+				return false, msgPrinter.Sprintf("The node is already running service %v.", svc)
+			}
+		}
+	}
+
+	for _, limit := range placement.Limits {
+		if value, ok := PlacementValue(nodeProps, limit.Property); ok {
+			if count := state.ValueCounts[limit.Property][value]; count >= limit.Max {
+				return false, msgPrinter.Sprintf("%v node(s) with %v=%v already have the service, the limit is %v.", count, limit.Property, value, limit.Max)
+			}
+		}
+	}
+
+	return true, ""
+}
+
+// Add the result of the placement check to the output of a compatibility check. When the placement excludes the
+// node, the services that are otherwise compatible with the node are marked as incompatible with the reason.
+func CheckPlacementCompatibility(output *CompCheckOutput, placement *businesspolicy.Placement, nodeProps externalpolicy.PropertyList, state *PlacementState, msgPrinter *message.Printer) {
+	// get default message printer if nil
+	if msgPrinter == nil {
+		msgPrinter = i18n.GetMessagePrinter()
+	}
+
+	if output == nil || !output.Compatible {
+		return
+	}
+
+	if compatible, reason := PlacementCompatible(placement, nodeProps, state, msgPrinter); !compatible {
+		msg_compatible := msgPrinter.Sprintf("Compatible")
+		msg_incompatible := msgPrinter.Sprintf("Placement Incompatible")
+
+		output.Compatible = false
+		if output.Reason == nil {
+			output.Reason = map[string]string{}
+		}
+		for sId, rs := range output.Reason {
+			if rs == msg_compatible {
+				output.Reason[sId] = fmt.Sprintf("%v: %v", msg_incompatible, reason)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// +build unit
+
+package compcheck
+
+import (
+	"github.com/open-horizon/anax/businesspolicy"
+	"github.com/open-horizon/anax/externalpolicy"
+	"strings"
+	"testing"
+)
+
+func Test_PlacementCompatible(t *testing.T) {
+	placement := &businesspolicy.Placement{
+		Limits:       []businesspolicy.PlacementLimit{{Property: "store", Max: 1}, {Property: "region", Max: 3}},
+		AntiAffinity: []businesspolicy.AntiAffinityRule{{Name: "gps", Org: "IBM"}},
+	}
+	state := &PlacementState{
+		ValueCounts:  map[string]map[string]int{"store": {"s1": 1}, "region": {"east": 2, "west": 3}},
+		NodeServices: []string{"IBM/netspeed"},
+	}
+	props := func(store string, region string) externalpolicy.PropertyList {
+		return externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", store), *externalpolicy.Property_Factory("region", region)}
+	}
+
+	if ok, reason := PlacementCompatible(placement, props("s2", "east"), state, nil); !ok {
+		t.Errorf("node should be compatible, reason: %v", reason)
+	} else if ok, reason := PlacementCompatible(placement, props("s1", "east"), state, nil); ok || !strings.Contains(reason, "store=s1") {
+		t.Errorf("node should be excluded by the store limit, reason: %v", reason)
+	} else if ok, reason := PlacementCompatible(placement, props("s2", "west"), state, nil); ok || !strings.Contains(reason, "region=west") {
+		t.Errorf("node should be excluded by the region limit, reason: %v", reason)
+	} else if ok, _ := PlacementCompatible(placement, externalpolicy.PropertyList{}, state, nil); !ok {
+		t.Errorf("node without the properties should not be limited")
+	}
+
+	state.NodeServices = append(state.NodeServices, "IBM/gps")
+	if ok, reason := PlacementCompatible(placement, props("s2", "east"), state, nil); ok || !strings.Contains(reason, "IBM/gps") {
+		t.Errorf("node should be excluded by anti-affinity, reason: %v", reason)
+	}
+}
+
+func Test_CheckPlacementCompatibility(t *testing.T) {
+	placement := &businesspolicy.Placement{Limits: []businesspolicy.PlacementLimit{{Property: "store", Max: 1}}}
+	state := &PlacementState{ValueCounts: map[string]map[string]int{"store": {"s1": 1}}}
+	nodeProps := externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", "s1")}
+
+	output := NewCompCheckOutput(true, map[string]string{"IBM/cpu_1.0.0_amd64": COMPATIBLE, "IBM/cpu_1.0.0_arm": "Policy Incompatible: arch"}, nil)
+	CheckPlacementCompatibility(output, placement, nodeProps, state, nil)
+
+	if output.Compatible {
+		t.Errorf("output should not be compatible: %v", output)
+	} else if !strings.HasPrefix(output.Reason["IBM/cpu_1.0.0_amd64"], "Placement Incompatible") {
+		t.Errorf("wrong reason for the compatible service: %v", output.Reason)
+	} else if output.Reason["IBM/cpu_1.0.0_arm"] != "Policy Incompatible: arch" {
+		t.Errorf("the reason for the incompatible service should not change: %v", output.Reason)
+	}
+
+	output = NewCompCheckOutput(true, map[string]string{"IBM/cpu_1.0.0_amd64": COMPATIBLE}, nil)
+	CheckPlacementCompatibility(output, placement, externalpolicy.PropertyList{*externalpolicy.Property_Factory("store", "s2")}, state, nil)
+	if !output.Compatible || output.Reason["IBM/cpu_1.0.0_amd64"] != COMPATIBLE {
+		t.Errorf("output should still be compatible: %v", output)
+	}
+}
@@ -24,11 +24,12 @@ type PolicyCheck struct {
 	BusinessPolicy *businesspolicy.BusinessPolicy `json:"business_policy,omitempty"`
 	ServicePolicy  *externalpolicy.ExternalPolicy `json:"service_policy,omitempty"`
 	Service        []common.ServiceFile           `json:"service,omitempty"` //only needed if the services are not in the exchange
+	Explain        bool                           `json:"explain,omitempty"` // return the evaluation of the constraints in the output
 }
 
 func (p PolicyCheck) String() string {
-	return fmt.Sprintf("NodeId: %v, NodeArch: %v, NodeType: %v, NodePolicy: %v, BusinessPolId: %v, BusinessPolicy: %v, ServicePolicy: %v, Service：%v",
-		p.NodeId, p.NodeArch, p.NodeType, p.NodePolicy, p.BusinessPolId, p.BusinessPolicy, p.ServicePolicy, p.Service)
+	return fmt.Sprintf("NodeId: %v, NodeArch: %v, NodeType: %v, NodePolicy: %v, BusinessPolId: %v, BusinessPolicy: %v, ServicePolicy: %v, Service：%v, Explain: %v",
+		p.NodeId, p.NodeArch, p.NodeType, p.NodePolicy, p.BusinessPolId, p.BusinessPolicy, p.ServicePolicy, p.Service, p.Explain)
 }
 
 // This is the function that HZN and the agbot secure API calls.
@@ -123,6 +124,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 
 	// go through all the workloads and check if compatible or not
 	messages := map[string]string{}
+	traces := map[string]*policy.CompatibilityTrace{}
 	overall_compatible := false
 	for _, workload := range bPolicy.Workloads {
 
@@ -170,9 +172,12 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 					}
 					if compatible {
 						// policy compatibility check
-						compatible, reason, _, _, err1 = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
+						var consumerPol *policy.Policy
+						compatible, reason, _, consumerPol, err1 = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
 						if err1 != nil {
 							return nil, err1
+						} else if input.Explain {
+							traces[sId] = explainPolicyCompatibility(nPolicy, consumerPol)
 						}
 					}
 					if compatible {
@@ -180,7 +185,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 						if checkAllSvcs {
 							messages[sId] = msg_compatible
 						} else {
-							return NewCompCheckOutput(true, map[string]string{sId: msg_compatible}, resources), nil
+							return newPolicyCheckOutput(true, map[string]string{sId: msg_compatible}, resources, traces), nil
 						}
 					} else {
 						messages[sId] = fmt.Sprintf("%v: %v", msg_incompatible, reason)
@@ -209,9 +214,12 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 							}
 							if compatible {
 								// policy compatibility check
-								compatible, reason, _, _, err = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
+								var consumerPol *policy.Policy
+								compatible, reason, _, consumerPol, err = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
 								if err != nil {
 									return nil, err
+								} else if input.Explain {
+									traces[sId] = explainPolicyCompatibility(nPolicy, consumerPol)
 								}
 							}
 							if compatible {
@@ -219,7 +227,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 								if checkAllSvcs {
 									messages[sId] = msg_compatible
 								} else {
-									return NewCompCheckOutput(true, map[string]string{sId: msg_compatible}, resources), nil
+									return newPolicyCheckOutput(true, map[string]string{sId: msg_compatible}, resources, traces), nil
 								}
 							} else {
 								messages[sId] = fmt.Sprintf("%v: %v", msg_incompatible, reason)
@@ -254,9 +262,12 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 				}
 				if compatible {
 					// policy compatibility check
-					compatible, reason, _, _, err1 = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
+					var consumerPol *policy.Policy
+					compatible, reason, _, consumerPol, err1 = CheckPolicyCompatiblility(nPolicy, bPolicy, mergedServicePol, resources.NodeArch, msgPrinter)
 					if err1 != nil {
 						return nil, err1
+					} else if input.Explain {
+						traces[sId] = explainPolicyCompatibility(nPolicy, consumerPol)
 					}
 				}
 			}
@@ -265,7 +276,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 				if checkAllSvcs {
 					messages[sId] = msg_compatible
 				} else {
-					return NewCompCheckOutput(true, map[string]string{sId: msg_compatible}, resources), nil
+					return newPolicyCheckOutput(true, map[string]string{sId: msg_compatible}, resources, traces), nil
 				}
 			} else {
 				messages[sId] = fmt.Sprintf("%v: %v", msg_incompatible, reason)
@@ -274,7 +285,7 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 	}
 
 	if messages != nil && len(messages) != 0 {
-		return NewCompCheckOutput(overall_compatible, messages, resources), nil
+		return newPolicyCheckOutput(overall_compatible, messages, resources, traces), nil
 	} else {
 		// If we get here, it means that no workload is found in the bp that matches the required node arch.
 		if resources.NodeArch != "" {
@@ -287,6 +298,32 @@ func policyCompatible(getDeviceHandler exchange.DeviceHandler,
 	}
 }
 
+// Create the output of the policy check. The traces are only included for the services in the output.
+func newPolicyCheckOutput(compatible bool, messages map[string]string, resources *CompCheckResource, traces map[string]*policy.CompatibilityTrace) *CompCheckOutput {
+	output := NewCompCheckOutput(compatible, messages, resources)
+	for sId := range messages {
+		if trace, ok := traces[sId]; ok && trace != nil {
+			if output.Trace == nil {
+				output.Trace = map[string]*policy.CompatibilityTrace{}
+			}
+			output.Trace[sId] = trace
+		}
+	}
+	return output
+}
+
+// Explain why the node policy and the merged deployment policy are or are not compatible, see CheckPolicyCompatiblility.
+// The trace is only for information, it is nil if the constraints cannot be explained.
+func explainPolicyCompatibility(nodePolicy *policy.Policy, mergedConsumerPol *policy.Policy) *policy.CompatibilityTrace {
+	if nodePolicy == nil || mergedConsumerPol == nil {
+		return nil
+	} else if trace, err := policy.Explain_Compatibility(nodePolicy, mergedConsumerPol); err != nil {
+		return nil
+	} else {
+		return trace
+	}
+}
+
 // It does the policy compatibility check. node arch can be empty. It is called by agbot and PolicyCompatible function.
 // The node arch is supposed to be already compared against the service arch before calling this function.
 func CheckPolicyCompatiblility(nodePolicy *policy.Policy, businessPolicy *policy.Policy, mergedServicePolicy *externalpolicy.ExternalPolicy, nodeArch string, msgPrinter *message.Printer) (bool, string, *policy.Policy, *policy.Policy, error) {
@@ -370,6 +370,63 @@ func Test_policyCompatible_with_IDs(t *testing.T) {
 	}
 }
 
+func Test_policyCompatible_explain(t *testing.T) {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	input := PolicyCheck{
+		NodeId:        "myorg/mynode",
+		BusinessPolId: "myorg/mybp",
+		Explain:       true,
+	}
+
+	svcUrl := "weather"
+	svcOrg := "myorg"
+	svcVersion1 := "1.0.1"
+	svcArch := "amd64"
+	service := businesspolicy.ServiceRef{
+		Name:            svcUrl,
+		Org:             svcOrg,
+		Arch:            svcArch,
+		ServiceVersions: []businesspolicy.WorkloadChoice{businesspolicy.WorkloadChoice{Version: svcVersion1}},
+	}
+	sId1 := cutil.FormExchangeIdForService(svcUrl, svcVersion1, svcArch)
+	sId1 = fmt.Sprintf("%v/%v", svcOrg, sId1)
+
+	// the node does not have the value of prop4 required by the deployment policy
+	if compOutput, err := policyCompatible(getDeviceHandler("amd64"),
+		getNodePolicyHandler(map[string]string{"prop3": "val3", "prop4": "other value"}, []string{"prop1 == val1", "prop5 == val5"}),
+		getBusinessPolicyHandler(service, map[string]string{"prop1": "val1", "prop2": "val2"}, []string{"prop3 == val3 && prop4 == \"some value\""}),
+		getServicePolicyHandler(map[string]string{"prop5": "val5", "prop6": "val6"}, []string{}),
+		getSelectedServicesHandler(nil), getServiceHandler(), getServiceDefResolverHandler(),
+		&input, true, msgPrinter); err != nil {
+		t.Errorf("policyCompatible should have returned nil error but got: %v", err)
+	} else if compOutput.Compatible {
+		t.Errorf("policyCompatible should have returned not compatible but got: %v", compOutput)
+	} else if trace, ok := compOutput.Trace[sId1]; !ok || trace == nil {
+		t.Errorf("policyCompatible should have returned a trace for %v but got: %v", sId1, compOutput.Trace)
+	} else if trace.ConsumerConstraints.Result {
+		t.Errorf("The deployment constraints should not be satisfied: %v", trace.ConsumerConstraints)
+	} else if !trace.ProducerConstraints.Result {
+		t.Errorf("The node constraints should be satisfied: %v", trace.ProducerConstraints)
+	} else if !strings.Contains(trace.ConsumerConstraints.String(), "prop4 == \"some value\": false (prop4 is other value)") {
+		t.Errorf("The trace should show that prop4 is not satisfied but got: %v", trace.ConsumerConstraints)
+	}
+
+	// no trace unless it is asked for
+	input.Explain = false
+	if compOutput, err := policyCompatible(getDeviceHandler("amd64"),
+		getNodePolicyHandler(map[string]string{"prop3": "val3", "prop4": "other value"}, []string{"prop1 == val1", "prop5 == val5"}),
+		getBusinessPolicyHandler(service, map[string]string{"prop1": "val1", "prop2": "val2"}, []string{"prop3 == val3 && prop4 == \"some value\""}),
+		getServicePolicyHandler(map[string]string{"prop5": "val5", "prop6": "val6"}, []string{}),
+		getSelectedServicesHandler(nil), getServiceHandler(), getServiceDefResolverHandler(),
+		&input, true, msgPrinter); err != nil {
+		t.Errorf("policyCompatible should have returned nil error but got: %v", err)
+	} else if compOutput.Trace != nil {
+		t.Errorf("policyCompatible should not have returned a trace but got: %v", compOutput.Trace)
+	}
+}
+
 func Test_policyCompatible_with_Pols(t *testing.T) {
 
 	msgPrinter := i18n.GetMessagePrinter()
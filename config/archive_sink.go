@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+)
+
+// The archive sink receives a copy of each archived agreement just before the agbot purges it from the database, so that
+// a record of the agreement is kept after PurgeArchivedAgreementHours has passed.
+type ArchiveSinkConfig struct {
+	Type          string // The kind of sink, "file" or "http". Purged agreements are not archived when this is empty.
+	FilePath      string // The directory where the file sink writes its archive files.
+	FileMaxSizeMB int    // The size at which the file sink rotates the current archive file, the default is 100.
+	FileMaxFiles  int    // The number of rotated archive files kept by the file sink, the default (zero) keeps all of them.
+	URL           string // The URL that the http sink POSTs archived agreements to.
+	Authorization string // The value of the Authorization header sent by the http sink, if any.
+}
+
+const ArchiveSinkFileName = "purged-agreements.jsonl"
+
+func (a ArchiveSinkConfig) String() string {
+	mask := ""
+	if a.Authorization != "" {
+		mask = "******"
+	}
+	return fmt.Sprintf("Type: %v, FilePath: %v, FileMaxSizeMB: %v, FileMaxFiles: %v, URL: %v, Authorization: %v", a.Type, a.FilePath, a.FileMaxSizeMB, a.FileMaxFiles, a.URL, mask)
+}
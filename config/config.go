@@ -60,6 +60,7 @@ type Config struct {
 	DefaultNodePolicyFile            string    // the default node policy file name.
 	NodeCheckIntervalS               int       // the node check interval. The default is 15 seconds.
 	NodePolicyCheckIntervalS         int       // the node policy check interval. The default is 15 seconds.
+	NodeLocationFile                 string    // the file that contains the location of the node, latitude,longitude[,accuracy in km], for the openhorizon.location built-in property.
 	FileSyncService                  FSSConfig // The config for the embedded ESS sync service.
 	SurfaceErrorTimeoutS             int       // How long surfaced errors will remain active after they're created. Default is no timeout
 	SurfaceErrorCheckIntervalS       int       // Deprecated. Used to be how often the node will check for errors that are no longer active and update the exchange. Default is 15 seconds
@@ -77,44 +78,54 @@ type AGConfig struct {
 	TxLostDelayTolerationSeconds int
 	AgreementWorkers             int
 	DBPath                       string
-	Postgresql                   PostgresqlConfig // The Postgresql config if it is being used
-	PartitionStale               uint64           // Number of seconds to wait before declaring a partition to be stale (i.e. the previous owner has unexpectedly terminated).
-	ProtocolTimeoutS             uint64           // Number of seconds to wait before declaring proposal response is lost
-	AgreementTimeoutS            uint64           // Number of seconds to wait before declaring agreement not finalized in blockchain
-	NoDataIntervalS              uint64           // default should be 15 mins == 15*60 == 900. Ignored if the policy has data verification disabled.
-	ActiveAgreementsURL          string           // This field is used when policy files indicate they want data verification but they dont specify a URL
-	ActiveAgreementsUser         string           // This is the userid the agbot uses to authenticate to the data verifivcation API
-	ActiveAgreementsPW           string           // This is the password for the ActiveAgreementsUser
-	PolicyPath                   string           // The directory where policy files are kept, default /etc/provider-tremor/policy/
-	NewContractIntervalS         uint64           // default should be 1
-	ProcessGovernanceIntervalS   uint64           // How long the gov sleeps before general gov checks (new payloads, interval payments, etc).
-	IgnoreContractWithAttribs    string           // A comma seperated list of contract attributes. If set, the contracts that contain one or more of the attributes will be ignored. The default is "ethereum_account".
-	ExchangeURL                  string           // The URL of the Horizon exchange. If not configured, the exchange will not be used.
-	ExchangeHeartbeat            int              // Seconds between heartbeats to the exchange
-	ExchangeId                   string           // The id of the agbot, not the userid of the exchange user. Must be org qualified.
-	ExchangeToken                string           // The agbot's authentication token
-	DVPrefix                     string           // When looking for agreement ids in the data verification API response, look for agreement ids with this prefix.
-	ActiveDeviceTimeoutS         int              // The amount of time a device can go without heartbeating and still be considered active for the purposes of search
-	ExchangeMessageTTL           int              // The number of seconds the exchange will keep this message before automatically deleting it
-	MessageKeyPath               string           // The path to the location of messaging keys
-	MessageKeyCheck              int              // The interval (in seconds) indicating how often the agbot checks its own object in the exchange to ensure that the message key is still available.
-	DefaultWorkloadPW            string           // The default workload password if none is specified in the policy file
-	APIListen                    string           // Host and port for the API to listen on
-	SecureAPIListenHost          string           // The host for the secure API to listen on
-	SecureAPIListenPort          string           // The port for the secure API to listen on
-	SecureAPIServerCert          string           // The path to the certificate file for the secure api
-	SecureAPIServerKey           string           // The path to the server key file for the secure api
-	PurgeArchivedAgreementHours  int              // Number of hours to leave an archived agreement in the database before automatically deleting it
-	CheckUpdatedPolicyS          int              // The number of seconds to wait between checks for an updated policy file. Zero means auto checking is turned off.
-	CSSURL                       string           // The URL used to access the CSS.
-	CSSSSLCert                   string           // The path to the client side SSL certificate for the CSS.
-	MMSGarbageCollectionInterval int64            // The amount of time to wait between MMS object cache garbage collection scans.
-	AgreementBatchSize           uint64           // The number of nodes that the agbot will process in a batch.
-	AgreementQueueSize           uint64           // The agreement bot work queue max size.
-	FullRescanS                  uint64           // The number of seconds between policy scans when there have been no changes reported by the exchange.
-	MaxExchangeChanges           int              // The maximum number of exchange changes to request on a given call the exchange /changes API.
-	RetryLookBackWindow          uint64           // The time window (in seconds) used by the agbot to look backward in time for node changes when node agreements are retried.
-	PolicySearchOrder            bool             // When true, search policies from most recently changed to least recently changed.
+	Postgresql                   PostgresqlConfig         // The Postgresql config if it is being used
+	Sqlite                       SqliteConfig             // The embedded sqlite config if it is being used
+	InMemoryDB                   bool                     // Use a non-persistent in memory database, for unit tests and development agbots only
+	PartitionStale               uint64                   // Number of seconds to wait before declaring a partition to be stale (i.e. the previous owner has unexpectedly terminated).
+	PartitionRebalanceS          uint64                   // Number of seconds between checks for an uneven spread of agreements across the agbot partitions, the default is 300.
+	PartitionRebalanceThreshold  int64                    // The difference in active agreements between partitions that causes agreements to be handed off, the default is 10. A negative value turns off rebalancing.
+	PartitionRebalanceBatch      int64                    // The maximum number of agreements handed off in one check, the default is 100.
+	BulkCancelPerMinute          int                      // The maximum number of agreements cancelled per minute by a bulk cancel, the default is 60.
+	LeaderLeaseS                 uint64                   // Number of seconds that the leader of the agbots sharing the database holds its lease without renewing it, the default is 30.
+	ProtocolTimeoutS             uint64                   // Number of seconds to wait before declaring proposal response is lost
+	AgreementTimeoutS            uint64                   // Number of seconds to wait before declaring agreement not finalized in blockchain
+	NoDataIntervalS              uint64                   // default should be 15 mins == 15*60 == 900. Ignored if the policy has data verification disabled.
+	ActiveAgreementsURL          string                   // This field is used when policy files indicate they want data verification but they dont specify a URL
+	ActiveAgreementsUser         string                   // This is the userid the agbot uses to authenticate to the data verifivcation API
+	ActiveAgreementsPW           string                   // This is the password for the ActiveAgreementsUser
+	PolicyPath                   string                   // The directory where policy files are kept, default /etc/provider-tremor/policy/
+	NewContractIntervalS         uint64                   // default should be 1
+	ProcessGovernanceIntervalS   uint64                   // How long the gov sleeps before general gov checks (new payloads, interval payments, etc).
+	IgnoreContractWithAttribs    string                   // A comma seperated list of contract attributes. If set, the contracts that contain one or more of the attributes will be ignored. The default is "ethereum_account".
+	ExchangeURL                  string                   // The URL of the Horizon exchange. If not configured, the exchange will not be used.
+	ExchangeHeartbeat            int                      // Seconds between heartbeats to the exchange
+	ExchangeId                   string                   // The id of the agbot, not the userid of the exchange user. Must be org qualified.
+	ExchangeToken                string                   // The agbot's authentication token
+	DVPrefix                     string                   // When looking for agreement ids in the data verification API response, look for agreement ids with this prefix.
+	ActiveDeviceTimeoutS         int                      // The amount of time a device can go without heartbeating and still be considered active for the purposes of search
+	ExchangeMessageTTL           int                      // The number of seconds the exchange will keep this message before automatically deleting it
+	MessageKeyPath               string                   // The path to the location of messaging keys
+	MessageKeyCheck              int                      // The interval (in seconds) indicating how often the agbot checks its own object in the exchange to ensure that the message key is still available.
+	DefaultWorkloadPW            string                   // The default workload password if none is specified in the policy file
+	APIListen                    string                   // Host and port for the API to listen on
+	SecureAPIListenHost          string                   // The host for the secure API to listen on
+	SecureAPIListenPort          string                   // The port for the secure API to listen on
+	SecureAPIServerCert          string                   // The path to the certificate file for the secure api
+	SecureAPIServerKey           string                   // The path to the server key file for the secure api
+	SecureAPITokenTTLS           int                      // The number of seconds that a secure api token is valid, the default is 900. Verified basic credentials are cached for 60 seconds at most.
+	PurgeArchivedAgreementHours  int                      // Number of hours to leave an archived agreement in the database before automatically deleting it
+	ArchiveSink                  ArchiveSinkConfig        // Where to keep a copy of archived agreements before they are purged, if anywhere
+	CheckUpdatedPolicyS          int                      // The number of seconds to wait between checks for an updated policy file. Zero means auto checking is turned off.
+	CSSURL                       string                   // The URL used to access the CSS.
+	CSSSSLCert                   string                   // The path to the client side SSL certificate for the CSS.
+	MMSGarbageCollectionInterval int64                    // The amount of time to wait between MMS object cache garbage collection scans.
+	AgreementBatchSize           uint64                   // The number of nodes that the agbot will process in a batch.
+	AgreementQueueSize           uint64                   // The agreement bot work queue max size.
+	FullRescanS                  uint64                   // The number of seconds between policy scans when there have been no changes reported by the exchange.
+	MaxExchangeChanges           int                      // The maximum number of exchange changes to request on a given call the exchange /changes API.
+	RetryLookBackWindow          uint64                   // The time window (in seconds) used by the agbot to look backward in time for node changes when node agreements are retried.
+	PolicySearchOrder            bool                     // When true, search policies from most recently changed to least recently changed.
+	WorkQueueFairness            *WorkQueueFairnessConfig // How new agreement attempts from different orgs share the agreement workers.
 }
 
 func (c *HorizonConfig) UserPublicKeyPath() string {
@@ -137,6 +148,18 @@ func (c *HorizonConfig) IsPostgresqlConfigured() bool {
 	return (c.AgreementBot.Postgresql != (PostgresqlConfig{})) && (c.GetPartitionStale() != 0)
 }
 
+func (c *HorizonConfig) IsSqliteConfigured() bool {
+	return len(c.AgreementBot.Sqlite.DBPath) != 0
+}
+
+func (c *HorizonConfig) IsMemoryDBConfigured() bool {
+	return c.AgreementBot.InMemoryDB
+}
+
+func (c *HorizonConfig) IsArchiveSinkConfigured() bool {
+	return c.AgreementBot.ArchiveSink.Type != ""
+}
+
 func (c *HorizonConfig) GetPartitionStale() uint64 {
 	if c.AgreementBot.PartitionStale == 0 {
 		return 60
@@ -145,6 +168,54 @@ func (c *HorizonConfig) GetPartitionStale() uint64 {
 	}
 }
 
+func (c *HorizonConfig) GetPartitionRebalanceS() uint64 {
+	if c.AgreementBot.PartitionRebalanceS == 0 {
+		return 300
+	} else {
+		return c.AgreementBot.PartitionRebalanceS
+	}
+}
+
+func (c *HorizonConfig) GetPartitionRebalanceThreshold() int64 {
+	if c.AgreementBot.PartitionRebalanceThreshold == 0 {
+		return 10
+	} else {
+		return c.AgreementBot.PartitionRebalanceThreshold
+	}
+}
+
+func (c *HorizonConfig) GetPartitionRebalanceBatch() int64 {
+	if c.AgreementBot.PartitionRebalanceBatch <= 0 {
+		return 100
+	} else {
+		return c.AgreementBot.PartitionRebalanceBatch
+	}
+}
+
+func (c *HorizonConfig) GetLeaderLeaseS() uint64 {
+	if c.AgreementBot.LeaderLeaseS == 0 {
+		return 30
+	} else {
+		return c.AgreementBot.LeaderLeaseS
+	}
+}
+
+func (c *HorizonConfig) GetBulkCancelPerMinute() int {
+	if c.AgreementBot.BulkCancelPerMinute <= 0 {
+		return 60
+	} else {
+		return c.AgreementBot.BulkCancelPerMinute
+	}
+}
+
+func (c *HorizonConfig) GetSecureAPITokenTTL() int {
+	if c.AgreementBot.SecureAPITokenTTLS <= 0 {
+		return 900
+	} else {
+		return c.AgreementBot.SecureAPITokenTTLS
+	}
+}
+
 func (c *HorizonConfig) GetAgbotCSSURL() string {
 	return strings.TrimRight(c.AgreementBot.CSSURL, "/")
 }
@@ -161,6 +232,13 @@ func (c *HorizonConfig) GetAgbotAgreementQueueSize() uint64 {
 	return c.AgreementBot.AgreementQueueSize
 }
 
+func (c *HorizonConfig) GetAgbotWorkQueueFairness() WorkQueueFairnessConfig {
+	if c.AgreementBot.WorkQueueFairness == nil {
+		return WorkQueueFairnessConfig{}
+	}
+	return *c.AgreementBot.WorkQueueFairness
+}
+
 func (c *HorizonConfig) GetAgbotFullRescan() uint64 {
 	return c.AgreementBot.FullRescanS
 }
@@ -391,7 +469,14 @@ func (agc *AGConfig) String() string {
 		", AgreementWorkers: %v"+
 		", DBPath: %v"+
 		", Postgresql: {%v}"+
+		", Sqlite: {%v}"+
+		", InMemoryDB: %v"+
 		", PartitionStale: %v"+
+		", PartitionRebalanceS: %v"+
+		", PartitionRebalanceThreshold: %v"+
+		", PartitionRebalanceBatch: %v"+
+		", BulkCancelPerMinute: %v"+
+		", LeaderLeaseS: %v"+
 		", ProtocolTimeoutS: %v"+
 		", AgreementTimeoutS: %v"+
 		", NoDataIntervalS: %v"+
@@ -416,16 +501,18 @@ func (agc *AGConfig) String() string {
 		", SecureAPIListenPort: %v"+
 		", SecureAPIServerCert: %v"+
 		", SecureAPIServerkey: %v"+
+		", SecureAPITokenTTLS: %v"+
 		", PurgeArchivedAgreementHours: %v"+
+		", ArchiveSink: {%v}"+
 		", CheckUpdatedPolicyS: %v"+
 		", CSSURL: %v"+
 		", CSSSSLCert: %v"+
 		", AgreementBatchSize: %v",
-		agc.TxLostDelayTolerationSeconds, agc.AgreementWorkers, agc.DBPath, agc.Postgresql.String(),
-		agc.PartitionStale, agc.ProtocolTimeoutS, agc.AgreementTimeoutS, agc.NoDataIntervalS, agc.ActiveAgreementsURL,
+		agc.TxLostDelayTolerationSeconds, agc.AgreementWorkers, agc.DBPath, agc.Postgresql.String(), agc.Sqlite.String(), agc.InMemoryDB,
+		agc.PartitionStale, agc.PartitionRebalanceS, agc.PartitionRebalanceThreshold, agc.PartitionRebalanceBatch, agc.BulkCancelPerMinute, agc.LeaderLeaseS, agc.ProtocolTimeoutS, agc.AgreementTimeoutS, agc.NoDataIntervalS, agc.ActiveAgreementsURL,
 		agc.ActiveAgreementsUser, mask, agc.PolicyPath, agc.NewContractIntervalS, agc.ProcessGovernanceIntervalS,
 		agc.IgnoreContractWithAttribs, agc.ExchangeURL, agc.ExchangeHeartbeat, agc.ExchangeId,
 		mask, agc.DVPrefix, agc.ActiveDeviceTimeoutS, agc.ExchangeMessageTTL, agc.MessageKeyPath, mask, agc.APIListen,
-		agc.SecureAPIListenHost, agc.SecureAPIListenPort, agc.SecureAPIServerCert, agc.SecureAPIServerKey,
-		agc.PurgeArchivedAgreementHours, agc.CheckUpdatedPolicyS, agc.CSSURL, agc.CSSSSLCert, agc.AgreementBatchSize)
+		agc.SecureAPIListenHost, agc.SecureAPIListenPort, agc.SecureAPIServerCert, agc.SecureAPIServerKey, agc.SecureAPITokenTTLS,
+		agc.PurgeArchivedAgreementHours, agc.ArchiveSink.String(), agc.CheckUpdatedPolicyS, agc.CSSURL, agc.CSSSSLCert, agc.AgreementBatchSize)
 }
@@ -12,6 +12,8 @@ type PostgresqlConfig struct {
 	DBName             string
 	SSLMode            string
 	MaxOpenConnections int
+	SchemaVersion      *int // Migrate the schema up or down to this version, omit to migrate to the latest version.
+	MigrationDryRun    bool // Log the schema migrations that would run and then stop, without changing the database.
 }
 
 func (p PostgresqlConfig) MakeConnectionString() (string, string) {
@@ -33,6 +35,19 @@ func (p PostgresqlConfig) MakeConnectionString() (string, string) {
 	return connStr, traceString
 }
 
+// Returns the schema version that the agbot should migrate the database to, and true, or false if the agbot should
+// migrate to the latest schema version it supports.
+func (p PostgresqlConfig) GetSchemaVersion() (int, bool) {
+	if p.SchemaVersion == nil {
+		return 0, false
+	}
+	return *p.SchemaVersion, true
+}
+
 func (p PostgresqlConfig) String() string {
-	return fmt.Sprintf("Host: %v, Port: %v, User: %v, Password: %v, DBName: %v, SSLMode: %v MaxOpenConnections: %v", p.Host, p.Port, p.User, "******", p.DBName, p.SSLMode, p.MaxOpenConnections)
+	schemaVersion := "latest"
+	if v, ok := p.GetSchemaVersion(); ok {
+		schemaVersion = fmt.Sprintf("%v", v)
+	}
+	return fmt.Sprintf("Host: %v, Port: %v, User: %v, Password: %v, DBName: %v, SSLMode: %v MaxOpenConnections: %v, SchemaVersion: %v, MigrationDryRun: %v", p.Host, p.Port, p.User, "******", p.DBName, p.SSLMode, p.MaxOpenConnections, schemaVersion, p.MigrationDryRun)
 }
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+type SqliteConfig struct {
+	DBPath        string // The directory where the sqlite database file is kept. Can be a volume shared by several agbots.
+	BusyTimeoutMS int    // How long to wait (in milliseconds) for a lock held by another agbot before failing, the default is 5000.
+}
+
+const SqliteDatabaseName = "agreementbot.sqlite"
+
+func (s SqliteConfig) MakeConnectionString() (string, string) {
+
+	// By default we will wait 5 seconds for a database lock held by another agbot.
+	busyTimeout := 5000
+	if s.BusyTimeoutMS != 0 {
+		busyTimeout = s.BusyTimeoutMS
+	}
+
+	// Writers take the database lock when the transaction begins (instead of at the first write) so that agbots sharing
+	// the file serialize their transactions instead of failing with a deadlock error. The default rollback journal is used
+	// because WAL mode does not work when the file is on a network volume.
+	connStr := fmt.Sprintf("file:%s?_pragma=busy_timeout(%d)&_txlock=immediate", path.Join(s.DBPath, SqliteDatabaseName), busyTimeout)
+
+	return connStr, connStr
+}
+
+func (s SqliteConfig) String() string {
+	return fmt.Sprintf("DBPath: %v, BusyTimeoutMS: %v", s.DBPath, s.BusyTimeoutMS)
+}
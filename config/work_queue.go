@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Controls how the agreement bot work queue shares the agreement workers between the orgs it serves. New agreement attempts
+// are queued in a lane per org, or per org and deployment policy, and the lanes are served in proportion to their weights so
+// that a large policy change in one org does not starve the others.
+type WorkQueueFairnessConfig struct {
+	ByPolicy       bool           // When true, there is a lane for each org and deployment policy instead of a lane for each org.
+	Weights        map[string]int // The relative share of the workers for an org, or for an org/policy when ByPolicy is set. The default is 1.
+	MaxInFlight    int            // The maximum number of agreement attempts in progress for an org at the same time, the default (zero) is no limit. An attempt is in progress until the node replies or the agreement is cancelled.
+	OrgMaxInFlight map[string]int // Overrides MaxInFlight for the given orgs.
+}
+
+func (f WorkQueueFairnessConfig) String() string {
+	return fmt.Sprintf("ByPolicy: %v, Weights: %v, MaxInFlight: %v, OrgMaxInFlight: %v", f.ByPolicy, f.Weights, f.MaxInFlight, f.OrgMaxInFlight)
+}
+
+// Returns the weight of a lane. When lanes are per deployment policy, a weight for the policy takes precedence over a weight for its org.
+func (f WorkQueueFairnessConfig) GetWeight(lane string, org string) int {
+	if w, ok := f.Weights[lane]; ok && w > 0 {
+		return w
+	} else if w, ok := f.Weights[org]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// Returns the maximum number of agreement attempts in progress for an org, zero when there is no limit.
+func (f WorkQueueFairnessConfig) GetMaxInFlight(org string) int {
+	if m, ok := f.OrgMaxInFlight[org]; ok && m >= 0 {
+		return m
+	} else if f.MaxInFlight > 0 {
+		return f.MaxInFlight
+	}
+	return 0
+}
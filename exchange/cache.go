@@ -114,6 +114,12 @@ func GetExchangeVersionFromCache(exchangeURL string) string {
 
 // GetResourceFromCache will return the requested resource from the specified type exchange cache or nil if it is not present
 func GetResourceFromCache(resourceKey string, resourceType string, expirationS uint64) interface{} {
+	resource := getResourceFromCache(resourceKey, resourceType, expirationS)
+	recordCacheLookup(resourceType, resource != nil)
+	return resource
+}
+
+func getResourceFromCache(resourceKey string, resourceType string, expirationS uint64) interface{} {
 	glog.V(5).Infof("Get from exchange cache %s/%s", resourceType, resourceKey)
 
 	if ExchangeResourceCache == nil || ExchangeResourceCache.allResources == nil {
@@ -0,0 +1,102 @@
+package exchange
+
+import (
+	"github.com/open-horizon/anax/metrics"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Metrics for the calls to the exchange and for the exchange resource cache. The endpoint of an exchange call is its URL
+// path with the org, node, agbot and other resource ids replaced by '*', so that the number of endpoints stays small.
+
+const METRICS_OWNER = "Exchange"
+
+var exchangeRequests = metrics.NewCounterVec("horizon_exchange_requests_total", "The number of calls to the exchange.", "method", "endpoint")
+var exchangeErrors = metrics.NewCounterVec("horizon_exchange_request_errors_total", "The number of calls to the exchange that failed, by kind of failure (transport or error).", "method", "endpoint", "kind")
+var exchangeDuration = metrics.NewHistogramVec("horizon_exchange_request_duration_seconds", "The time taken by calls to the exchange.", metrics.DefaultBuckets, "method", "endpoint")
+var cacheLookups = metrics.NewCounterVec("horizon_exchange_cache_lookups_total", "The number of lookups in the exchange resource cache, by resource type and result (hit or miss).", "type", "result")
+
+func init() {
+	metrics.DefaultRegistry.Register(METRICS_OWNER, exchangeRequests)
+	metrics.DefaultRegistry.Register(METRICS_OWNER, exchangeErrors)
+	metrics.DefaultRegistry.Register(METRICS_OWNER, exchangeDuration)
+	metrics.DefaultRegistry.Register(METRICS_OWNER, cacheLookups)
+	metrics.DefaultRegistry.Register(METRICS_OWNER, metrics.CollectorFunc(collectCacheHitRatio))
+}
+
+// The path segments of exchange URLs that name a resource type or an action, rather than a resource.
+var exchangeEndpointWords = map[string]bool{
+	"v1": true, "orgs": true, "nodes": true, "agbots": true, "services": true, "patterns": true, "business": true, "policies": true,
+	"msgs": true, "changes": true, "maxchangeid": true, "search": true, "heartbeat": true, "nodehealth": true, "agreements": true,
+	"policy": true, "users": true, "status": true, "errors": true, "keys": true, "dockauths": true, "admin": true, "version": true,
+	"businesspols": true, "confirm": true,
+}
+
+// Returns the endpoint of an exchange URL, for example /v1/orgs/*/nodes/*/agreements/* for the agreement of a node.
+func metricsEndpoint(urlPath string) string {
+	path := urlPath
+	if u, err := url.Parse(urlPath); err == nil {
+		path = u.Path
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for ix, s := range segments {
+		if !exchangeEndpointWords[s] {
+			segments[ix] = "*"
+		}
+	}
+
+	// Drop any leading segments before the API version, they are part of the exchange base URL.
+	for ix, s := range segments {
+		if s == "v1" {
+			segments = segments[ix:]
+			break
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// Record a call to the exchange. The errors are the ones returned by InvokeExchange.
+func recordExchangeCall(method string, urlPath string, start time.Time, err error, tpErr error) {
+	endpoint := metricsEndpoint(urlPath)
+	exchangeRequests.Inc(method, endpoint)
+	exchangeDuration.Observe(time.Since(start).Seconds(), method, endpoint)
+	if tpErr != nil {
+		exchangeErrors.Inc(method, endpoint, "transport")
+	} else if err != nil {
+		exchangeErrors.Inc(method, endpoint, "error")
+	}
+}
+
+func recordCacheLookup(resourceType string, hit bool) {
+	if hit {
+		cacheLookups.Inc(resourceType, "hit")
+	} else {
+		cacheLookups.Inc(resourceType, "miss")
+	}
+}
+
+// Compute the hit ratio of each resource type in the cache from the lookup counts.
+func collectCacheHitRatio() []*metrics.Family {
+	ratios := metrics.NewFamily("horizon_exchange_cache_hit_ratio", "The fraction of lookups in the exchange resource cache that were hits, by resource type.", metrics.GAUGE)
+
+	hits := make(map[string]float64)
+	totals := make(map[string]float64)
+	for _, f := range cacheLookups.Collect() {
+		for _, s := range f.Samples {
+			resourceType, result := s.Labels[0].Value, s.Labels[1].Value
+			totals[resourceType] += s.Value
+			if result == "hit" {
+				hits[resourceType] += s.Value
+			}
+		}
+	}
+
+	for resourceType, total := range totals {
+		if total > 0 {
+			ratios.Add(hits[resourceType]/total, []string{"type"}, resourceType)
+		}
+	}
+	return []*metrics.Family{ratios}
+}
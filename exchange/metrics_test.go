@@ -0,0 +1,45 @@
+// +build unit
+
+package exchange
+
+import (
+	"testing"
+)
+
+func Test_metricsEndpoint(t *testing.T) {
+
+	tests := map[string]string{
+		"https://exchange.example.com/api/v1/orgs/myorg/nodes/node1/agreements/abc": "/v1/orgs/*/nodes/*/agreements/*",
+		"http://localhost:8080/v1/orgs/myorg/agbots/ag1/msgs?maxmsgs=100":           "/v1/orgs/*/agbots/*/msgs",
+		"http://localhost:8080/v1/orgs/myorg/business/policies/pol1/search":         "/v1/orgs/*/business/policies/*/search",
+		"http://localhost:8080/v1/orgs/myorg/services/svc_1.0.0_amd64/policy":       "/v1/orgs/*/services/*/policy",
+		"http://localhost:8080/v1/admin/version":                                    "/v1/admin/version",
+	}
+
+	for url, expected := range tests {
+		if endpoint := metricsEndpoint(url); endpoint != expected {
+			t.Errorf("for %v expected %v, got %v", url, expected, endpoint)
+		}
+	}
+}
+
+func Test_collectCacheHitRatio(t *testing.T) {
+
+	recordCacheLookup("TEST_RATIO_TYPE", true)
+	recordCacheLookup("TEST_RATIO_TYPE", true)
+	recordCacheLookup("TEST_RATIO_TYPE", true)
+	recordCacheLookup("TEST_RATIO_TYPE", false)
+
+	found := false
+	for _, s := range collectCacheHitRatio()[0].Samples {
+		if s.Labels[0].Value == "TEST_RATIO_TYPE" {
+			found = true
+			if s.Value != 0.75 {
+				t.Errorf("expected a hit ratio of 0.75, got %v", s.Value)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected a hit ratio for TEST_RATIO_TYPE")
+	}
+}
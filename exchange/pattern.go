@@ -6,29 +6,32 @@ import (
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/cutil"
 	"github.com/open-horizon/anax/policy"
+	"github.com/open-horizon/anax/schedule"
 	"strings"
 	"time"
 )
 
 type Pattern struct {
-	Owner              string              `json:"owner"`
-	Label              string              `json:"label"`
-	Description        string              `json:"description"`
-	Public             bool                `json:"public"`
-	Services           []ServiceReference  `json:"services"`
-	AgreementProtocols []AgreementProtocol `json:"agreementProtocols"`
-	UserInput          []policy.UserInput  `json:"userInput,omitempty"`
+	Owner              string                        `json:"owner"`
+	Label              string                        `json:"label"`
+	Description        string                        `json:"description"`
+	Public             bool                          `json:"public"`
+	Services           []ServiceReference            `json:"services"`
+	AgreementProtocols []AgreementProtocol           `json:"agreementProtocols"`
+	UserInput          []policy.UserInput            `json:"userInput,omitempty"`
+	Maintenance        *schedule.MaintenanceSchedule `json:"maintenance,omitempty"`
 }
 
 func (w Pattern) String() string {
-	return fmt.Sprintf("Owner: %v, Label: %v, Description: %v, Public: %v, Services: %v, AgreementProtocols: %v, UserInput: %v",
+	return fmt.Sprintf("Owner: %v, Label: %v, Description: %v, Public: %v, Services: %v, AgreementProtocols: %v, UserInput: %v, Maintenance: %v",
 		w.Owner,
 		w.Label,
 		w.Description,
 		w.Public,
 		w.Services,
 		w.AgreementProtocols,
-		w.UserInput)
+		w.UserInput,
+		w.Maintenance)
 }
 
 func (w Pattern) ShortString() string {
@@ -69,6 +72,8 @@ func (w Pattern) DeepCopy() *Pattern {
 		newPattern.UserInput = newUserInput
 	}
 
+	newPattern.Maintenance = w.Maintenance.DeepCopy()
+
 	return &newPattern
 }
 
@@ -81,7 +86,7 @@ type WorkloadPriority struct {
 
 type UpgradePolicy struct {
 	Lifecycle string `json:"lifecycle,omitempty"` // immediate, never, agreement
-	Time      string `json:"time,omitempty"`      // the time of the upgrade
+	Time      string `json:"time,omitempty"`      // not used, upgrade times are set by the maintenance schedule of the pattern
 }
 
 type WorkloadChoice struct {
@@ -210,6 +210,44 @@ func GetExchangeDevice(httpClientFactory *config.HTTPClientFactory, deviceId str
 	}
 }
 
+// Get all the nodes in an org that the caller is allowed to see.
+func GetOrgDevices(ec ExchangeContext, org string) (map[string]Device, error) {
+
+	glog.V(3).Infof(rpclogString(fmt.Sprintf("retrieving nodes in org %v from exchange", org)))
+
+	var resp interface{}
+	resp = new(GetDevicesResponse)
+	targetURL := ec.GetExchangeURL() + "orgs/" + org + "/nodes"
+
+	retryCount := ec.GetHTTPFactory().RetryCount
+	retryInterval := ec.GetHTTPFactory().GetRetryInterval()
+	for {
+		if err, tpErr := InvokeExchange(ec.GetHTTPFactory().NewHTTPClient(nil), "GET", targetURL, ec.GetExchangeId(), ec.GetExchangeToken(), nil, &resp); err != nil {
+			if strings.Contains(err.Error(), "status: 404") {
+				return map[string]Device{}, nil
+			}
+			glog.Errorf(err.Error())
+			return nil, err
+		} else if tpErr != nil {
+			glog.Warningf(rpclogString(fmt.Sprintf(tpErr.Error())))
+			if ec.GetHTTPFactory().RetryCount == 0 {
+				time.Sleep(time.Duration(retryInterval) * time.Second)
+				continue
+			} else if retryCount == 0 {
+				return nil, fmt.Errorf("Exceeded %v retries for error: %v", ec.GetHTTPFactory().RetryCount, tpErr)
+			} else {
+				retryCount--
+				time.Sleep(time.Duration(retryInterval) * time.Second)
+				continue
+			}
+		} else {
+			devs := resp.(*GetDevicesResponse).Devices
+			glog.V(3).Infof(rpclogString(fmt.Sprintf("retrieved %v nodes in org %v from exchange", len(devs), org)))
+			return devs, nil
+		}
+	}
+}
+
 // modify the the device
 func PutExchangeDevice(httpClientFactory *config.HTTPClientFactory, deviceId string, deviceToken string, exchangeUrl string, pdr *PutDeviceRequest) (*PutDeviceResponse, error) {
 	// create PUT body
@@ -914,6 +952,13 @@ func DeleteSurfaceErrors(ec ExchangeContext, deviceId string) error {
 // This function is used to invoke an exchange API
 // For GET, the given resp parameter will be untouched when http returns code 404.
 func InvokeExchange(httpClient *http.Client, method string, urlPath string, user string, pw string, params interface{}, resp *interface{}) (error, error) {
+	start := time.Now()
+	err, tpErr := invokeExchange(httpClient, method, urlPath, user, pw, params, resp)
+	recordExchangeCall(method, urlPath, start, err, tpErr)
+	return err, tpErr
+}
+
+func invokeExchange(httpClient *http.Client, method string, urlPath string, user string, pw string, params interface{}, resp *interface{}) (error, error) {
 
 	if len(method) == 0 {
 		return errors.New(fmt.Sprintf("Error invoking exchange, method name must be specified")), nil
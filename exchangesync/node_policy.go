@@ -357,9 +357,13 @@ func UpdateNodePolicy(pDevice *persistence.ExchangeDevice, db *bolt.DB, nodePoli
 	nodeGetPolicyHandler exchange.NodePolicyHandler,
 	nodePutPolicyHandler exchange.PutNodePolicyHandler) error {
 
-	// verify the policy
-	if err := nodePolicy.ValidateAndNormalize(); err != nil {
+	// verify the policy, the constraints that cannot be satisfied or have no effect are only logged
+	if warnings, err := nodePolicy.ValidateAndNormalizeWithWarnings(); err != nil {
 		return fmt.Errorf("Node policy does not validate. %v", err)
+	} else {
+		for _, w := range warnings {
+			glog.Warningf("Node policy constraint warning: %v", w.Message)
+		}
 	}
 
 	// add node's built-in properties
@@ -1,9 +1,16 @@
 package externalpolicy
 
 import (
+	"errors"
 	"github.com/golang/glog"
 	"github.com/open-horizon/anax/cutil"
+	"github.com/open-horizon/anax/externalpolicy/geo"
+	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/schedule"
+	"io/ioutil"
+	"os"
 	"runtime"
+	"strings"
 )
 
 // These are built-in property names that can be used in the policies.
@@ -17,6 +24,8 @@ const (
 	PROP_NODE_HARDWAREID  = "openhorizon.hardwareId"        // The device serial number if it can be found. A generated Id otherwise.
 	PROP_NODE_PRIVILEGED  = "openhorizon.allowPrivileged"   // Property set to determine if privileged services may be run on this device. Can be set by user, default is false.
 	PROP_NODE_K8S_VERSION = "openhorizon.kubernetesVersion" // Server version of the cluster the agent is running in
+	PROP_NODE_MAINT_WIN   = "openhorizon.maintenanceWindow" // When the node accepts new agreements and upgrades, see schedule.ParseMaintenanceWindow. Can be set by user, default is any time.
+	PROP_NODE_LOCATION    = "openhorizon.location"          // The location of the node, a geo property from the location attribute or the node location file. Can be set by user if the agent does not know it, omitted if the location is not known.
 
 	// for service policy
 	PROP_SVC_URL        = "openhorizon.service.url"     // The unique name of the service.
@@ -29,6 +38,89 @@ const (
 
 const MAX_MEMEORY = 1048576 // the unit is MB. This is 1000G
 
+// Returns the maintenance window published by a node in the PROP_NODE_MAINT_WIN property, nil if the node does not have one.
+func GetNodeMaintenanceWindow(props PropertyList) (*schedule.MaintenanceSchedule, error) {
+	if !props.HasProperty(PROP_NODE_MAINT_WIN) {
+		return nil, nil
+	}
+
+	prop, err := props.GetProperty(PROP_NODE_MAINT_WIN)
+	if err != nil {
+		return nil, err
+	}
+
+	msgPrinter := i18n.GetMessagePrinter()
+	if value, ok := prop.Value.(string); !ok {
+		return nil, errors.New(msgPrinter.Sprintf("Property %s must have a string value.", PROP_NODE_MAINT_WIN))
+	} else if sched, err := schedule.ParseMaintenanceWindow(value); err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("Property %s is not valid: %v", PROP_NODE_MAINT_WIN, err))
+	} else {
+		return sched, nil
+	}
+}
+
+// A NodeLocationSource returns the location of the node in the format of the geo property type, or an empty string if
+// the source does not know the location of the node.
+type NodeLocationSource func() (string, error)
+
+var nodeLocationSources []NodeLocationSource
+
+// Add a source of the location of the node for the PROP_NODE_LOCATION built-in property. The agent adds its sources when
+// it starts, they are tried in the order they are added and the first one that knows the location is used.
+func AddNodeLocationSource(source NodeLocationSource) {
+	nodeLocationSources = append(nodeLocationSources, source)
+}
+
+// Returns a source that reads the location of the node from a file. The file contains the location in the format of the
+// geo property type, for example 41.0064,-111.9393,0.5. The location is not known if the file does not exist.
+func NodeLocationFromFile(fileName string) NodeLocationSource {
+	return func() (string, error) {
+		if fileName == "" {
+			return "", nil
+		}
+		content, err := ioutil.ReadFile(fileName)
+		if os.IsNotExist(err) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+
+		location := strings.TrimSpace(string(content))
+		if location == "" {
+			return "", nil
+		} else if loc, err := geo.ParseLocation(location); err != nil {
+			return "", errors.New(i18n.GetMessagePrinter().Sprintf("The node location file %v is not valid: %v", fileName, err))
+		} else {
+			return loc.String(), nil
+		}
+	}
+}
+
+// Returns the location of the node from the first source that knows it, the second return value is true in that case.
+// If none of them does, the location set by the user in the existing policy is kept. An empty string means the location
+// is not known.
+func getNodeLocation(existingPolicy *ExternalPolicy) (string, bool) {
+	for _, source := range nodeLocationSources {
+		if location, err := source(); err != nil {
+			glog.V(2).Infof("Failed to get the node location: %v", err)
+		} else if location != "" {
+			return location, true
+		}
+	}
+
+	if existingPolicy != nil && existingPolicy.Properties.HasProperty(PROP_NODE_LOCATION) {
+		locProp, _ := existingPolicy.Properties.GetProperty(PROP_NODE_LOCATION)
+		if location, ok := locProp.Value.(string); !ok {
+			glog.V(1).Infof("Value of property %s must be a string.", PROP_NODE_LOCATION)
+		} else if _, err := geo.ParseLocation(location); err != nil {
+			glog.V(1).Infof("Value of property %s is not a valid location: %v", PROP_NODE_LOCATION, err)
+		} else {
+			return location, false
+		}
+	}
+	return "", false
+}
+
 func ListReadOnlyProperties() []string {
 	return []string{PROP_NODE_CPU, PROP_NODE_ARCH, PROP_NODE_MEMORY, PROP_NODE_HARDWAREID, PROP_NODE_K8S_VERSION}
 }
@@ -57,6 +149,9 @@ func createClusterNodeBuiltInPolicy(availableMem bool) *ExternalPolicy {
 	builtInPol.Add_Property(Property_Factory(PROP_NODE_ARCH, arch), false)
 	builtInPol.Add_Property(Property_Factory(PROP_NODE_CPU, cpu), false)
 	builtInPol.Add_Property(Property_Factory(PROP_NODE_PRIVILEGED, true), false)
+	if location, _ := getNodeLocation(nil); location != "" {
+		builtInPol.Add_Property(&Property{Name: PROP_NODE_LOCATION, Value: location, Type: GEO_TYPE}, false)
+	}
 	if vers != "" {
 		builtInPol.Add_Property(Property_Factory(PROP_NODE_K8S_VERSION, vers), false)
 	}
@@ -140,6 +235,13 @@ func createDeviceNodeBuiltInPolicy(availableMem bool, omitGenHwId bool, existing
 
 	nodeBuiltInReadWriteProps.Add_Property(Property_Factory(PROP_NODE_PRIVILEGED, privileged), false)
 
+	// The location is read-only when the agent knows it, the user can only set it when the agent does not.
+	if location, fromSource := getNodeLocation(existingPolicy); fromSource {
+		nodeBuiltInReadOnlyProps.Add_Property(&Property{Name: PROP_NODE_LOCATION, Value: location, Type: GEO_TYPE}, false)
+	} else if location != "" {
+		nodeBuiltInReadWriteProps.Add_Property(&Property{Name: PROP_NODE_LOCATION, Value: location, Type: GEO_TYPE}, false)
+	}
+
 	if availableMem {
 		nodeBuiltInReadOnlyProps.Add_Property(Property_Factory(PROP_NODE_MEMORY, float64(avail_mem)), false)
 	} else {
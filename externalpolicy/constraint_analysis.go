@@ -0,0 +1,737 @@
+package externalpolicy
+
+import (
+	"fmt"
+	"github.com/open-horizon/anax/externalpolicy/datetime"
+	"github.com/open-horizon/anax/i18n"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A constraint that no node can satisfy is usually only noticed when a deployment never makes an agreement. The functions
+// in this file analyze constraint expressions without any properties, so that such mistakes can be reported when a policy
+// is published. The analysis works on the expression tree produced by the constraint language plugin (see
+// RequiredPropertyFromConstraint), which it expands into alternatives, each of which is a list of comparisons that must all
+// be true. It finds:
+// - clauses and constraints that no node can satisfy, e.g. a == 1 && a == 2,
+// - constraints that any node with the property satisfies, e.g. a < 5 || a >= 5,
+// - comparisons, alternatives and constraints that are implied by others, e.g. a > 1 && a > 2,
+// - constraints that cannot be satisfied together, e.g. a deployment policy constraint and a service policy constraint.
+//
+// The type of a property is inferred from the values it is compared with: numbers, booleans or strings. An unquoted range
+// of numbers, e.g. a in [2,8), is a numeric range, other ranges are version ranges, which are not analyzed. The exists and
+// not exists operators are analyzed with the other comparisons, a comparison of the value of a property that is not defined
+// is false. A property is assumed to have a single value, a property with a list of values can satisfy a == x && a == y.
+// The results are warnings, they never make a policy invalid.
+
+// The types of constraint warnings.
+const (
+	CONSTRAINT_WARNING_UNSATISFIABLE = "unsatisfiable"
+	CONSTRAINT_WARNING_TAUTOLOGY     = "tautology"
+	CONSTRAINT_WARNING_REDUNDANT     = "redundant"
+	CONSTRAINT_WARNING_CONFLICT      = "conflict"
+)
+
+// The expansion of a constraint stops at this number of alternatives, larger constraints are not analyzed.
+const MAX_CONSTRAINT_ALTERNATIVES = 256
+
+type ConstraintWarning struct {
+	Type       string `json:"type"`
+	Constraint string `json:"constraint"` // The constraint the warning is about.
+	Message    string `json:"message"`
+}
+
+func (w ConstraintWarning) String() string {
+	return fmt.Sprintf("Type: %v, Constraint: %v, Message: %v", w.Type, w.Constraint, w.Message)
+}
+
+// Analyze the constraint expression and return the warnings. The expression should be validated first, an error is returned
+// if it cannot be parsed.
+func (c *ConstraintExpression) Analyze() ([]ConstraintWarning, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	constraints, err := analyzeConstraints(c)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := constraintWarnings{}
+	for _, ac := range constraints {
+		if ac.alternatives == nil {
+			continue
+		}
+
+		if len(ac.satisfiable) == 0 {
+			warnings.add(CONSTRAINT_WARNING_UNSATISFIABLE, ac.text, msgPrinter.Sprintf("The constraint %v cannot be satisfied by any node.", ac.text))
+			continue
+		}
+
+		// an alternative that cannot be satisfied has no effect
+		for _, alt := range ac.alternatives {
+			if !alt.satisfiable() {
+				warnings.add(CONSTRAINT_WARNING_UNSATISFIABLE, ac.text, msgPrinter.Sprintf("The clause %v in the constraint %v cannot be satisfied by any node, it has no effect.", alt, ac.text))
+			}
+		}
+
+		if name := ac.tautology(); name != "" {
+			warnings.add(CONSTRAINT_WARNING_TAUTOLOGY, ac.text, msgPrinter.Sprintf("The constraint %v is satisfied by any value of the property %v, it only requires the property to be defined.", ac.text, name))
+		}
+
+		for _, term := range ac.redundantTerms() {
+			warnings.add(CONSTRAINT_WARNING_REDUNDANT, ac.text, msgPrinter.Sprintf("The comparison %v in the constraint %v is redundant, it is implied by the other comparisons.", term.text, ac.text))
+		}
+
+		for _, r := range ac.redundantAlternatives() {
+			warnings.add(CONSTRAINT_WARNING_REDUNDANT, ac.text, msgPrinter.Sprintf("The clause %v in the constraint %v is redundant, any node that satisfies it also satisfies the clause %v.", r[0], ac.text, r[1]))
+		}
+	}
+
+	// The constraints are combined with AND, check them in pairs.
+	redundant := map[int]bool{}
+	for i, ac := range constraints {
+		for j, other := range constraints {
+			if i == j || !ac.analyzed() || !other.analyzed() {
+				continue
+			}
+			if i < j && !ac.compatibleWith(other) {
+				warnings.add(CONSTRAINT_WARNING_CONFLICT, ac.text, msgPrinter.Sprintf("The constraints %v and %v cannot be satisfied together by any node.", ac.text, other.text))
+			} else if !redundant[i] && !redundant[j] && ac.implies(other) {
+				redundant[j] = true
+				warnings.add(CONSTRAINT_WARNING_REDUNDANT, other.text, msgPrinter.Sprintf("The constraint %v is redundant, it is implied by the constraint %v.", other.text, ac.text))
+			}
+		}
+	}
+
+	return warnings.list, nil
+}
+
+// Return the warnings for the constraints in this expression that cannot be satisfied together with the constraints in the
+// other expression, e.g. the constraints of a deployment policy and the constraints of a service policy.
+func (c *ConstraintExpression) AnalyzeConflicts(other *ConstraintExpression) ([]ConstraintWarning, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	constraints, err := analyzeConstraints(c)
+	if err != nil {
+		return nil, err
+	}
+	otherConstraints, err := analyzeConstraints(other)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := constraintWarnings{}
+	for _, ac := range constraints {
+		for _, oc := range otherConstraints {
+			if ac.analyzed() && oc.analyzed() && !ac.compatibleWith(oc) {
+				warnings.add(CONSTRAINT_WARNING_CONFLICT, ac.text, msgPrinter.Sprintf("The constraint %v conflicts with the constraint %v, no node can satisfy both.", ac.text, oc.text))
+			}
+		}
+	}
+
+	return warnings.list, nil
+}
+
+// The warnings, without duplicates.
+type constraintWarnings struct {
+	list []ConstraintWarning
+}
+
+func (w *constraintWarnings) add(warningType string, constraint string, message string) {
+	if w.list == nil {
+		w.list = []ConstraintWarning{}
+	}
+	for _, existing := range w.list {
+		if existing.Message == message {
+			return
+		}
+	}
+	w.list = append(w.list, ConstraintWarning{Type: warningType, Constraint: constraint, Message: message})
+}
+
+// A single constraint string, expanded into alternatives.
+type analyzedConstraint struct {
+	text         string
+	alternatives []alternative // nil if the constraint has too many alternatives to be analyzed
+	satisfiable  []alternative // the alternatives that can be satisfied
+}
+
+func analyzeConstraints(c *ConstraintExpression) ([]analyzedConstraint, error) {
+	constraints := []analyzedConstraint{}
+	if c == nil {
+		return constraints, nil
+	}
+
+	for _, constraint := range *c {
+		text := strings.TrimSpace(strings.Replace(constraint, "\a", " ", -1))
+		if text == "" {
+			continue
+		}
+
+		// Each constraint is parsed on its own so that the warnings can show it as written.
+		ce := ConstraintExpression([]string{constraint})
+		rp, err := RequiredPropertyFromConstraint(&ce)
+		if err != nil {
+			return nil, err
+		} else if err := rp.IsValid(); err != nil {
+			return nil, err
+		}
+
+		ac := analyzedConstraint{text: text}
+		if len(*rp) != 0 {
+			topMap := make(map[string]interface{})
+			for k := range *rp {
+				topMap[k] = (*rp)[k]
+			}
+			nextId := 0
+			if alts, ok := expandConstraint(&topMap, &nextId); ok {
+				ac.alternatives = alts
+				ac.satisfiable = []alternative{}
+				for _, alt := range alts {
+					if alt.satisfiable() {
+						ac.satisfiable = append(ac.satisfiable, alt)
+					}
+				}
+			}
+		}
+		constraints = append(constraints, ac)
+	}
+	return constraints, nil
+}
+
+// The constraint could be expanded and can be satisfied.
+func (ac analyzedConstraint) analyzed() bool {
+	return ac.alternatives != nil && len(ac.satisfiable) != 0
+}
+
+// Returns the name of a property such that any value of the property satisfies the constraint.
+func (ac analyzedConstraint) tautology() string {
+	checked := map[string]bool{}
+	for _, alt := range ac.satisfiable {
+		name := alt.property()
+		if name == "" || checked[name] {
+			continue
+		}
+		checked[name] = true
+
+		// the alternatives that only compare this property
+		alts := []alternative{}
+		terms := []constraintTerm{}
+		for _, a := range ac.satisfiable {
+			if a.property() == name {
+				alts = append(alts, a)
+				terms = append(terms, a...)
+			}
+		}
+
+		// a test of whether the property is defined is not a tautology
+		kind := termsKind(terms)
+		if kind == termOther || kind == termExists || hasExistenceTerm(terms) {
+			continue
+		}
+		covered := true
+		for _, v := range termSamples(kind, terms) {
+			if v.undefined {
+				continue
+			}
+			satisfied := false
+			for _, a := range alts {
+				if allHold(a, v) {
+					satisfied = true
+					break
+				}
+			}
+			if !satisfied {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return name
+		}
+	}
+	return ""
+}
+
+// Returns the comparisons that are implied by the other comparisons of every alternative they are in. When 2 comparisons
+// imply each other, only the first one is redundant.
+func (ac analyzedConstraint) redundantTerms() []constraintTerm {
+	ids := []int{}
+	terms := map[int]constraintTerm{}
+	for _, alt := range ac.satisfiable {
+		for _, t := range alt {
+			if _, ok := terms[t.id]; !ok {
+				ids = append(ids, t.id)
+				terms[t.id] = t
+			}
+		}
+	}
+	sort.Ints(ids)
+
+	redundant := map[int]bool{}
+	result := []constraintTerm{}
+	for _, id := range ids {
+		implied := true
+		for _, alt := range ac.satisfiable {
+			if !alt.contains(id) {
+				continue
+			}
+			others := []constraintTerm{}
+			for _, t := range alt {
+				if t.id != id && !redundant[t.id] && t.name == terms[id].name {
+					others = append(others, t)
+				}
+			}
+			if !propertyImplies(others, terms[id]) {
+				implied = false
+				break
+			}
+		}
+		if implied {
+			redundant[id] = true
+			result = append(result, terms[id])
+		}
+	}
+	return result
+}
+
+// Returns the alternatives that imply another alternative, with the alternative they imply.
+func (ac analyzedConstraint) redundantAlternatives() [][2]alternative {
+	result := [][2]alternative{}
+	redundant := map[int]bool{}
+	for i, alt := range ac.satisfiable {
+		for j, other := range ac.satisfiable {
+			if i != j && !redundant[j] && alt.implies(other) {
+				redundant[i] = true
+				result = append(result, [2]alternative{alt, other})
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Returns false if no node can satisfy both constraints.
+func (ac analyzedConstraint) compatibleWith(other analyzedConstraint) bool {
+	for _, alt := range ac.satisfiable {
+		for _, otherAlt := range other.satisfiable {
+			combined := append(append(alternative{}, alt...), otherAlt...)
+			if combined.satisfiable() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns true if every node that satisfies this constraint also satisfies the other one.
+func (ac analyzedConstraint) implies(other analyzedConstraint) bool {
+	for _, alt := range ac.satisfiable {
+		implied := false
+		for _, otherAlt := range other.satisfiable {
+			if alt.implies(otherAlt) {
+				implied = true
+				break
+			}
+		}
+		if !implied {
+			return false
+		}
+	}
+	return true
+}
+
+// Expand a control operator into alternatives. Returns false if there are too many alternatives. It is called recursively
+// because control operators can be nested n levels deep.
+func expandConstraint(cop *map[string]interface{}, nextId *int) ([]alternative, bool) {
+	controlOp := getControlOperator(cop)
+
+	var result []alternative
+	if controlOp == OP_AND {
+		result = []alternative{alternative{}}
+	} else {
+		result = []alternative{}
+	}
+
+	propArray, _ := (*cop)[controlOp].([]interface{})
+	for _, p := range propArray {
+		var expanded []alternative
+		if prop := isPropertyExpression(p); prop != nil {
+			expanded = []alternative{alternative{newConstraintTerm(*nextId, prop)}}
+			*nextId++
+		} else if subCop := isControlOp(p); subCop != nil {
+			var ok bool
+			if expanded, ok = expandConstraint(subCop, nextId); !ok {
+				return nil, false
+			}
+		} else {
+			return nil, false
+		}
+
+		if controlOp == OP_AND {
+			product := []alternative{}
+			for _, r := range result {
+				for _, e := range expanded {
+					product = append(product, append(append(alternative{}, r...), e...))
+				}
+			}
+			result = product
+		} else {
+			result = append(result, expanded...)
+		}
+		if len(result) > MAX_CONSTRAINT_ALTERNATIVES {
+			return nil, false
+		}
+	}
+
+	return result, true
+}
+
+// A list of comparisons that must all be true.
+type alternative []constraintTerm
+
+func (a alternative) String() string {
+	texts := []string{}
+	for _, t := range a {
+		texts = append(texts, t.text)
+	}
+	return strings.Join(texts, " && ")
+}
+
+func (a alternative) contains(id int) bool {
+	for _, t := range a {
+		if t.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name of the property if all the comparisons are on the same property, empty otherwise.
+func (a alternative) property() string {
+	name := ""
+	for _, t := range a {
+		if name == "" {
+			name = t.name
+		} else if t.name != name {
+			return ""
+		}
+	}
+	return name
+}
+
+// The comparisons of each property.
+func (a alternative) byProperty() map[string][]constraintTerm {
+	props := map[string][]constraintTerm{}
+	for _, t := range a {
+		props[t.name] = append(props[t.name], t)
+	}
+	return props
+}
+
+func (a alternative) satisfiable() bool {
+	for _, terms := range a.byProperty() {
+		if !propertySatisfiable(terms) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if every node that satisfies this alternative also satisfies the other one.
+func (a alternative) implies(other alternative) bool {
+	props := a.byProperty()
+	for _, t := range other {
+		if !propertyImplies(props[t.name], t) {
+			return false
+		}
+	}
+	return true
+}
+
+// The kinds of values that a property can be compared with.
+const (
+	termOther = iota
+	termNumber
+	termBoolean
+	termString
+	termExists // the exists and not exists operators, which do not compare the value
+)
+
+// A comparison in a constraint.
+type constraintTerm struct {
+	id       int    // identifies the comparison in the constraint, the expansion copies it into several alternatives
+	name     string // the property name
+	op       string
+	kind     int
+	number   float64  // the lower bound of a numeric range
+	upper    float64  // the upper bound of a numeric range
+	boolean  bool     // true for exists, false for not exists
+	strs     []string // the accepted strings for == and in, the rejected string for !=
+	numRange string   // the numeric range for in
+	text     string   // the comparison as written
+}
+
+// A value of a property that the comparisons are evaluated with.
+type termValue struct {
+	undefined bool // the property is not defined
+	number    float64
+	boolean   bool
+	str       string
+}
+
+func newConstraintTerm(id int, pe *PropertyExpression) constraintTerm {
+	t := constraintTerm{id: id, name: strings.TrimSpace(pe.Name), op: pe.Op, kind: termOther}
+	if t.op == "" || t.op == equalto {
+		t.op = doubleequalto
+	}
+
+	value := strings.TrimSpace(fmt.Sprintf("%v", pe.Value))
+	t.text = strings.TrimSpace(fmt.Sprintf("%v %v %v", t.name, t.op, value))
+
+	quoted := len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")
+	if quoted {
+		value = value[1 : len(value)-1]
+	}
+
+	switch t.op {
+	case lessthan, greaterthan, lessthaneq, greaterthaneq:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			t.kind = termNumber
+			t.number = f
+		}
+	case doubleequalto, notequalto:
+		if f, err := strconv.ParseFloat(value, 64); err == nil && !quoted {
+			t.kind = termNumber
+			t.number = f
+		} else if b, err := strconv.ParseBool(value); err == nil && !quoted && (value == "true" || value == "false") {
+			t.kind = termBoolean
+			t.boolean = b
+		} else if isTimeValue(value) && !quoted {
+			// a datetime or a duration can be written in more than one way, e.g. 1d and 24h
+			t.kind = termOther
+		} else {
+			t.kind = termString
+			t.strs = []string{strings.TrimSpace(value)}
+		}
+	case isin:
+		// an unquoted value is a numeric range, a version or a version range
+		if quoted {
+			t.kind = termString
+			for _, s := range strings.Split(value, ",") {
+				t.strs = append(t.strs, strings.TrimSpace(s))
+			}
+		} else if lower, upper, ok := numericRangeBounds(value); ok {
+			t.kind = termNumber
+			t.number = lower
+			t.upper = upper
+			t.numRange = value
+		}
+	case exists, notexists:
+		t.kind = termExists
+		t.boolean = t.op == exists
+	}
+	return t
+}
+
+// Returns the bounds of a numeric range, e.g. [2,8) or (0.5,INFINITY), false if the value is not a numeric range.
+func numericRangeBounds(value string) (float64, float64, bool) {
+	if len(value) < 2 || !strings.ContainsAny(value[:1], "[(") || !strings.ContainsAny(value[len(value)-1:], "])") {
+		return 0, 0, false
+	}
+	bounds := strings.Split(value[1:len(value)-1], ",")
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+
+	lower, err := strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	upper := math.Inf(1)
+	if upperStr := strings.TrimSpace(bounds[1]); upperStr != "INFINITY" {
+		if upper, err = strconv.ParseFloat(upperStr, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return lower, upper, true
+}
+
+// Returns true if one of the comparisons is exists or not exists.
+func hasExistenceTerm(terms []constraintTerm) bool {
+	for _, t := range terms {
+		if t.kind == termExists {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the value is a datetime or a duration, which are compared by their time rather than their text.
+func isTimeValue(value string) bool {
+	if _, err := datetime.ParseDateTime(value); err == nil {
+		return true
+	} else if _, err := datetime.ParseDuration(value); err == nil {
+		return true
+	}
+	return datetime.IsNowExpression(value)
+}
+
+func (t constraintTerm) holds(v termValue) bool {
+	if v.undefined {
+		return t.kind == termExists && !t.boolean
+	}
+
+	switch t.kind {
+	case termExists:
+		return t.boolean
+	case termNumber:
+		switch t.op {
+		case isin:
+			return numericRangeContains(t.numRange, v.number)
+		case lessthan:
+			return v.number < t.number
+		case greaterthan:
+			return v.number > t.number
+		case lessthaneq:
+			return v.number <= t.number
+		case greaterthaneq:
+			return v.number >= t.number
+		case notequalto:
+			return v.number != t.number
+		default:
+			return v.number == t.number
+		}
+	case termBoolean:
+		if t.op == notequalto {
+			return v.boolean != t.boolean
+		}
+		return v.boolean == t.boolean
+	case termString:
+		if t.op == notequalto {
+			return v.str != t.strs[0]
+		}
+		for _, s := range t.strs {
+			if s == v.str {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func allHold(terms []constraintTerm, v termValue) bool {
+	for _, t := range terms {
+		if !t.holds(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the kind of the comparisons if they all compare the same kind of values, termOther otherwise. The exists and
+// not exists comparisons can be combined with any kind, the kind is termExists if there are no other comparisons.
+func termsKind(terms []constraintTerm) int {
+	kind := termExists
+	for _, t := range terms {
+		if t.kind == termOther || (kind != termExists && t.kind != termExists && t.kind != kind) {
+			return termOther
+		} else if t.kind != termExists {
+			kind = t.kind
+		}
+	}
+	return kind
+}
+
+// Returns values of the property such that every combination of results of the comparisons is produced by 1 of the
+// values. The result of a comparison only changes at the value it compares with, so it is enough to take these values,
+// a value between each 2 of them and a value outside of them. The first value is a property that is not defined.
+func termSamples(kind int, terms []constraintTerm) []termValue {
+	samples := []termValue{termValue{undefined: true}}
+	switch kind {
+	case termExists:
+		samples = append(samples, termValue{})
+	case termNumber:
+		numbers := []float64{}
+		for _, t := range terms {
+			if t.kind != termNumber {
+				continue
+			}
+			numbers = append(numbers, t.number)
+			if t.op == isin && !math.IsInf(t.upper, 1) {
+				numbers = append(numbers, t.upper)
+			}
+		}
+		sort.Float64s(numbers)
+		samples = append(samples, termValue{number: numbers[0] - 1}, termValue{number: numbers[len(numbers)-1] + 1})
+		for i, n := range numbers {
+			samples = append(samples, termValue{number: n})
+			if i != 0 && numbers[i-1] != n {
+				samples = append(samples, termValue{number: (numbers[i-1] + n) / 2})
+			}
+		}
+	case termBoolean:
+		samples = append(samples, termValue{boolean: true}, termValue{boolean: false})
+	case termString:
+		// a string that is not in any comparison, the constraint language does not allow control characters
+		samples = append(samples, termValue{str: "\x00"})
+		for _, t := range terms {
+			for _, s := range t.strs {
+				samples = append(samples, termValue{str: s})
+			}
+		}
+	}
+	return samples
+}
+
+// Returns true if some value of the property satisfies all the comparisons. The comparisons are on the same property.
+// Comparisons that cannot be analyzed are assumed to be satisfiable.
+func propertySatisfiable(terms []constraintTerm) bool {
+	kind := termsKind(terms)
+	if kind == termOther {
+		// a property that is not defined fails the other comparisons, a property that is defined fails not exists
+		for _, t := range terms {
+			if t.kind == termExists && !t.boolean {
+				return allHold(terms, termValue{undefined: true})
+			}
+		}
+		return true
+	}
+	for _, v := range termSamples(kind, terms) {
+		if allHold(terms, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if every value of the property that satisfies the comparisons also satisfies the comparison t. The
+// comparisons are on the same property.
+func propertyImplies(terms []constraintTerm, t constraintTerm) bool {
+	for _, other := range terms {
+		if other.text == t.text {
+			return true
+		}
+	}
+
+	if len(terms) == 0 {
+		return false
+	}
+	all := append(append([]constraintTerm{}, terms...), t)
+	kind := termsKind(all)
+	if kind == termOther {
+		return false
+	}
+	for _, v := range termSamples(kind, all) {
+		if allHold(terms, v) && !t.holds(v) {
+			return false
+		}
+	}
+	return true
+}
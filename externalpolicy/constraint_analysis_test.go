@@ -0,0 +1,152 @@
+// +build unit
+
+package externalpolicy
+
+import (
+	_ "github.com/open-horizon/anax/externalpolicy/text_language"
+	"testing"
+)
+
+// Constraints that no node can satisfy are reported.
+func Test_Analyze_unsatisfiable(t *testing.T) {
+
+	ce := new(ConstraintExpression)
+	(*ce) = append((*ce), "cpu == 1 && cpu == 2", "memory > 8 && memory < 4", "gpu == true && gpu != true", "location == \"us\" && location == \"eu\"",
+		"gpu exists && gpu not exists", "memory not exists && memory > 4", "cpu in [1,5) && cpu > 7", "cpu in (2,INFINITY) && cpu <= 2")
+	if warnings, err := ce.Analyze(); err != nil {
+		t.Errorf("Error: unable to analyze %v: %v", *ce, err)
+	} else if len(warnings) != 8 {
+		t.Errorf("Error: expected 8 warnings, got %v: %v", len(warnings), warnings)
+	} else {
+		for i, w := range warnings {
+			if w.Type != CONSTRAINT_WARNING_UNSATISFIABLE || w.Constraint != (*ce)[i] {
+				t.Errorf("Error: warning %v should be unsatisfiable for %v: %v", i, (*ce)[i], w)
+			}
+		}
+	}
+
+	// a clause that cannot be satisfied is reported when the constraint can be satisfied by another clause
+	ce = new(ConstraintExpression)
+	(*ce) = append((*ce), "cpu == 1 && cpu == 2 || memory >= 4")
+	if warnings, err := ce.Analyze(); err != nil {
+		t.Errorf("Error: unable to analyze %v: %v", *ce, err)
+	} else if len(warnings) != 1 || warnings[0].Type != CONSTRAINT_WARNING_UNSATISFIABLE {
+		t.Errorf("Error: expected 1 unsatisfiable warning, got %v", warnings)
+	}
+}
+
+// Constraints that can be satisfied do not have warnings.
+func Test_Analyze_no_warnings(t *testing.T) {
+
+	ce := new(ConstraintExpression)
+	(*ce) = append((*ce),
+		"iame2edev == true && cpu == 3 || memory <= 32",
+		"hello == \"world\"",
+		"version in [1.1.1,INFINITY) OR cert == USDA",
+		"location in \"us,eu\" && location != eu",
+		"cpu >= 2 && cpu <= 3",
+		"uptime == 1d && uptime == 24h",
+		"installedAt == 2026-01-01 && installedAt == 2026-01-01T00:00:00Z",
+		"gpu exists",
+		"arch not exists || arch == amd64",
+		"load in [1,5) && load >= 4")
+	if warnings, err := ce.Analyze(); err != nil {
+		t.Errorf("Error: unable to analyze %v: %v", *ce, err)
+	} else if len(warnings) != 0 {
+		t.Errorf("Error: expected no warnings, got %v", warnings)
+	}
+
+	// an empty expression has no warnings
+	ce = new(ConstraintExpression)
+	if warnings, err := ce.Analyze(); err != nil {
+		t.Errorf("Error: unable to analyze an empty expression: %v", err)
+	} else if len(warnings) != 0 {
+		t.Errorf("Error: expected no warnings, got %v", warnings)
+	}
+
+	// an invalid expression cannot be analyzed
+	(*ce) = append((*ce), "prop == ")
+	if _, err := ce.Analyze(); err == nil {
+		t.Errorf("Error: expression %v should not be analyzed", *ce)
+	}
+}
+
+// Tautologies and redundant comparisons, clauses and constraints are reported.
+func Test_Analyze_tautology_and_redundant(t *testing.T) {
+
+	tests := []struct {
+		constraint  string
+		warningType string
+	}{
+		{"memory < 5 || memory >= 5", CONSTRAINT_WARNING_TAUTOLOGY},
+		{"gpu == true || gpu == false", CONSTRAINT_WARNING_TAUTOLOGY},
+		{"location == us || location != us", CONSTRAINT_WARNING_TAUTOLOGY},
+		{"memory > 1 && memory > 2", CONSTRAINT_WARNING_REDUNDANT},
+		{"memory > 2 || memory > 2 && cpu == 3", CONSTRAINT_WARNING_REDUNDANT},
+		{"location == us && location != eu", CONSTRAINT_WARNING_REDUNDANT},
+		{"memory exists && memory > 4", CONSTRAINT_WARNING_REDUNDANT},
+		{"cpu in [1,5) && cpu < 8", CONSTRAINT_WARNING_REDUNDANT},
+	}
+
+	for _, test := range tests {
+		ce := ConstraintExpression([]string{test.constraint})
+		if warnings, err := ce.Analyze(); err != nil {
+			t.Errorf("Error: unable to analyze %v: %v", test.constraint, err)
+		} else if len(warnings) != 1 || warnings[0].Type != test.warningType {
+			t.Errorf("Error: expected 1 %v warning for %v, got %v", test.warningType, test.constraint, warnings)
+		}
+	}
+
+	// a constraint implied by another one is redundant
+	ce := new(ConstraintExpression)
+	(*ce) = append((*ce), "memory > 8 && cpu == 2", "memory > 4")
+	if warnings, err := ce.Analyze(); err != nil {
+		t.Errorf("Error: unable to analyze %v: %v", *ce, err)
+	} else if len(warnings) != 1 || warnings[0].Type != CONSTRAINT_WARNING_REDUNDANT || warnings[0].Constraint != "memory > 4" {
+		t.Errorf("Error: expected memory > 4 to be redundant, got %v", warnings)
+	}
+}
+
+// Constraints that cannot be satisfied together are reported, in the same expression and across expressions.
+func Test_Analyze_conflicts(t *testing.T) {
+
+	ce := new(ConstraintExpression)
+	(*ce) = append((*ce), "memory > 8 || cpu == 4", "memory <= 8 && cpu == 2")
+	if warnings, err := ce.Analyze(); err != nil {
+		t.Errorf("Error: unable to analyze %v: %v", *ce, err)
+	} else if len(warnings) != 1 || warnings[0].Type != CONSTRAINT_WARNING_CONFLICT {
+		t.Errorf("Error: expected 1 conflict warning, got %v", warnings)
+	}
+
+	svcCe := new(ConstraintExpression)
+	(*svcCe) = append((*svcCe), "location == eu", "gpu == true")
+	depCe := new(ConstraintExpression)
+	(*depCe) = append((*depCe), "location in \"us,ca\"", "gpu == true")
+	if warnings, err := depCe.AnalyzeConflicts(svcCe); err != nil {
+		t.Errorf("Error: unable to analyze %v with %v: %v", *depCe, *svcCe, err)
+	} else if len(warnings) != 1 || warnings[0].Type != CONSTRAINT_WARNING_CONFLICT || warnings[0].Constraint != "location in \"us,ca\"" {
+		t.Errorf("Error: expected the location constraints to conflict, got %v", warnings)
+	}
+
+	(*depCe)[0] = "location in \"us,eu\""
+	if warnings, err := depCe.AnalyzeConflicts(svcCe); err != nil {
+		t.Errorf("Error: unable to analyze %v with %v: %v", *depCe, *svcCe, err)
+	} else if len(warnings) != 0 {
+		t.Errorf("Error: expected no conflicts, got %v", warnings)
+	}
+}
+
+// The warnings never make a policy invalid.
+func Test_ValidateAndNormalizeWithWarnings(t *testing.T) {
+
+	ep := &ExternalPolicy{Constraints: ConstraintExpression([]string{"cpu == 1 && cpu == 2"})}
+	if warnings, err := ep.ValidateAndNormalizeWithWarnings(); err != nil {
+		t.Errorf("Error: policy %v should validate: %v", ep, err)
+	} else if len(warnings) != 1 || warnings[0].Type != CONSTRAINT_WARNING_UNSATISFIABLE {
+		t.Errorf("Error: expected 1 unsatisfiable warning, got %v", warnings)
+	}
+
+	if err := ep.ValidateAndNormalize(); err != nil {
+		t.Errorf("Error: policy %v should validate: %v", ep, err)
+	}
+}
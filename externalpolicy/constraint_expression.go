@@ -1,6 +1,8 @@
 package externalpolicy
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/open-horizon/anax/externalpolicy/plugin_registry"
 	"strings"
@@ -9,14 +11,54 @@ import (
 // This type implements all the ConstraintLanguage Plugin methods and delegates to plugin system.
 type ConstraintExpression []string
 
+// The constraints can be written in different constraint languages, each one is validated by the plugin that owns it.
 func (c *ConstraintExpression) Validate() ([]string, error) {
-	return plugin_registry.ConstraintLanguagePlugins.ValidatedByOne((*c).GetStrings())
+	validated := make([]string, 0, len(*c))
+	for _, constraint := range *c {
+		if v, err := plugin_registry.ConstraintLanguagePlugins.ValidatedByOne([]string{constraint}); err != nil {
+			return nil, err
+		} else {
+			validated = append(validated, v...)
+		}
+	}
+	return validated, nil
 }
 
 func (c *ConstraintExpression) GetLanguageHandler() (plugin_registry.ConstraintLanguagePlugin, error) {
 	return plugin_registry.ConstraintLanguagePlugins.GetLanguageHandlerByOne((*c).GetStrings())
 }
 
+// The constraints are strings, a constraint in the json language can also be written as a JSON object in a policy file.
+// The object is kept as its compact JSON text so that the constraints are always strings when they are saved.
+func (c *ConstraintExpression) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	} else if raw == nil {
+		(*c) = nil
+		return nil
+	}
+
+	constraints := make([]string, 0, len(raw))
+	for _, r := range raw {
+		var constraint string
+		if err := json.Unmarshal(r, &constraint); err == nil {
+			constraints = append(constraints, constraint)
+			continue
+		}
+
+		buf := new(bytes.Buffer)
+		if err := json.Compact(buf, r); err != nil {
+			return err
+		} else if !bytes.HasPrefix(buf.Bytes(), []byte("{")) {
+			return fmt.Errorf("constraint %s must be a string or a JSON object", string(r))
+		}
+		constraints = append(constraints, buf.String())
+	}
+	(*c) = constraints
+	return nil
+}
+
 // Create a simple, empty ConstraintExpression Object.
 func Constraint_Factory() *ConstraintExpression {
 	ce := new(ConstraintExpression)
@@ -133,8 +175,9 @@ func RequiredPropertyFromConstraint(extConstraint *ConstraintExpression) (*Requi
 	for _, remainder := range *extConstraint {
 		remainder := strings.Replace(remainder, "\a", " ", -1)
 
-		// Get a handle to the specific language handler we will be using.
-		handler, err = extConstraint.GetLanguageHandler()
+		// Get a handle to the specific language handler we will be using, each constraint can be in a different language.
+		ce := ConstraintExpression([]string{remainder})
+		handler, err = ce.GetLanguageHandler()
 		if err != nil {
 			return nil, fmt.Errorf("unable to obtain policy constraint language handler, error %v", err)
 		}
@@ -3,8 +3,11 @@
 package externalpolicy
 
 import (
+	"encoding/json"
+	_ "github.com/open-horizon/anax/externalpolicy/json_language"
 	_ "github.com/open-horizon/anax/externalpolicy/text_language"
 	"testing"
+	"time"
 )
 
 // ================================================================================================================
@@ -337,3 +340,183 @@ func Test_MergeWith(t *testing.T) {
 		t.Errorf("Error: constraints %v should have 4 elements but got %v", ce1, len(*ce1))
 	}
 }
+
+// Constraints in the json and text languages can be mixed, a json constraint can be written as a JSON object.
+func Test_json_language_constraints(t *testing.T) {
+
+	policy := `{"constraints": ["memory >= 32", {"and": [{"property": "location", "op": "in", "value": ["us", "eu"]}, {"not": {"property": "gpu", "value": true}}]}]}`
+	ep := new(ExternalPolicy)
+	if err := json.Unmarshal([]byte(policy), ep); err != nil {
+		t.Errorf("Error: unable to unmarshal %v: %v", policy, err)
+		return
+	}
+
+	ce := &ep.Constraints
+	if len(*ce) != 2 || (*ce)[1] != `{"and":[{"property":"location","op":"in","value":["us","eu"]},{"not":{"property":"gpu","value":true}}]}` {
+		t.Errorf("Error: the json constraint should be kept as a string: %v", *ce)
+	} else if _, err := ce.Validate(); err != nil {
+		t.Errorf("Error: constraints %v should validate: %v", *ce, err)
+	}
+
+	props := []Property{*Property_Factory("memory", float64(64)), *Property_Factory("location", "eu"), *Property_Factory("gpu", false)}
+	if err := ce.IsSatisfiedBy(props); err != nil {
+		t.Errorf("Error: constraints %v should be satisfied by %v: %v", *ce, props, err)
+	}
+
+	props = []Property{*Property_Factory("memory", float64(64)), *Property_Factory("location", "eu"), *Property_Factory("gpu", true)}
+	if err := ce.IsSatisfiedBy(props); err == nil {
+		t.Errorf("Error: constraints %v should not be satisfied by %v", *ce, props)
+	}
+
+	// a negated comparison is satisfied when the property is not defined
+	props = []Property{*Property_Factory("memory", float64(64)), *Property_Factory("location", "eu")}
+	if err := ce.IsSatisfiedBy(props); err != nil {
+		t.Errorf("Error: constraints %v should be satisfied by %v without gpu: %v", *ce, props, err)
+	}
+
+	notCe := &ConstraintExpression{`{"not": {"or": [{"property": "memory", "op": "<", "value": 8}, {"property": "location", "value": "us"}]}}`}
+	if err := notCe.IsSatisfiedBy([]Property{}); err != nil {
+		t.Errorf("Error: constraints %v should be satisfied without any properties: %v", *notCe, err)
+	} else if err := notCe.IsSatisfiedBy([]Property{*Property_Factory("location", "eu")}); err != nil {
+		t.Errorf("Error: constraints %v should be satisfied without memory: %v", *notCe, err)
+	} else if err := notCe.IsSatisfiedBy([]Property{*Property_Factory("memory", float64(4))}); err == nil {
+		t.Errorf("Error: constraints %v should not be satisfied with too little memory", *notCe)
+	}
+
+	// the constraints are saved as strings
+	if b, err := json.Marshal(ep); err != nil {
+		t.Errorf("Error: unable to marshal %v: %v", ep, err)
+	} else if ep2 := new(ExternalPolicy); json.Unmarshal(b, ep2) != nil || !ep2.Constraints.IsSame(ep.Constraints) {
+		t.Errorf("Error: the constraints should be the same after a round trip: %v", string(b))
+	}
+
+	if err := json.Unmarshal([]byte(`{"constraints": [1]}`), ep); err == nil {
+		t.Errorf("Error: a constraint that is a number should be rejected")
+	}
+	(*ce) = append((*ce), `{"property": "gpu", "op": "like", "value": true}`)
+	if _, err := ce.Validate(); err == nil {
+		t.Errorf("Error: constraints %v should not validate", *ce)
+	}
+}
+
+// The string operators, the exists operators and numeric ranges.
+func Test_text_operators_IsSatisfiedBy(t *testing.T) {
+
+	prop_list := `[{"name":"arch", "value":"arm64"},{"name":"hostname", "value":"edge-lab-prod"},{"name":"location", "value":"us"},{"name":"cpu", "value":4},{"name":"memory", "value":2.5},{"name":"gpu", "value":true},{"name":"tags", "value":"camera,Sensor", "type":"list of strings"}]`
+	props := create_property_list(prop_list, t)
+
+	satisfied := []string{
+		"arch matches \"^arm(64)?$\"",
+		"hostname startswith edge- && hostname endswith \"-prod\" && hostname contains lab",
+		"location iequals US",
+		"tags iequals sensor && tags startswith cam",
+		"gpu exists && tpu not exists",
+		"cpu in [2,8) && cpu in [4,4] && memory in (0.5,INFINITY)",
+		"hostname contains nothing || cpu in (4,8] || arch matches \"^arm\"",
+	}
+	for _, c := range satisfied {
+		ce := ConstraintExpression([]string{c})
+		if err := ce.IsSatisfiedBy(*props); err != nil {
+			t.Errorf("Error: %v should be satisfied by %v, error: %v", c, *props, err)
+		}
+	}
+
+	notSatisfied := []string{
+		"arch matches \"^arm$\"",
+		"hostname startswith lab",
+		"hostname endswith edge",
+		"hostname contains LAB",
+		"location iequals eu",
+		"tags contains video",
+		"tpu exists",
+		"gpu not exists",
+		"cpu in (4,8]",
+		"cpu in [1,4)",
+		"cpu contains 4",
+		"gpu startswith t",
+	}
+	for _, c := range notSatisfied {
+		ce := ConstraintExpression([]string{c})
+		if err := ce.IsSatisfiedBy(*props); err == nil {
+			t.Errorf("Error: %v should not be satisfied by %v", c, *props)
+		}
+	}
+}
+
+// The geographic operators compare a geo property with an area.
+func Test_geo_operators_IsSatisfiedBy(t *testing.T) {
+
+	// a store in Salt Lake City, a vehicle somewhere near Ogden and a node without a location
+	prop_list := `[{"name":"store", "value":"40.7608,-111.8910", "type":"geo"},{"name":"vehicle", "value":"41.2230,-111.9738,5"},{"name":"cpu", "value":4}]`
+	props := create_property_list(prop_list, t)
+
+	satisfied := []string{
+		"store within 10km of (40.7,-111.9)",
+		"store within 60km of (41.2230,-111.9738) && vehicle within 60 km of (40.7608,-111.8910)",
+		"store inside [(41.0,-112.2),(41.0,-111.6),(40.5,-111.6),(40.5,-112.2)]",
+		"vehicle inside [(41.5,-112.3),(41.5,-111.6),(41.0,-111.6),(41.0,-112.3)]",
+		"cpu within 10km of (40.7,-111.9) || store within 1km of (40.7608,-111.8910)",
+	}
+	for _, c := range satisfied {
+		ce := ConstraintExpression([]string{c})
+		if err := ce.IsSatisfiedBy(*props); err != nil {
+			t.Errorf("Error: %v should be satisfied by %v, error: %v", c, *props, err)
+		}
+	}
+
+	notSatisfied := []string{
+		"store within 5km of (40.7,-111.9)",
+		"vehicle within 4km of (41.2230,-111.9738)",
+		"vehicle inside [(41.25,-112.0),(41.25,-111.9),(41.2,-111.9),(41.2,-112.0)]",
+		"store inside [(41.5,-112.3),(41.5,-111.6),(41.0,-111.6),(41.0,-112.3)]",
+		"cpu within 10km of (40.7,-111.9)",
+		"tpu within 10km of (40.7,-111.9)",
+	}
+	for _, c := range notSatisfied {
+		ce := ConstraintExpression([]string{c})
+		if err := ce.IsSatisfiedBy(*props); err == nil {
+			t.Errorf("Error: %v should not be satisfied by %v", c, *props)
+		}
+	}
+}
+
+// The comparison operators compare datetime and duration properties, a datetime can be relative to now.
+func Test_datetime_operators_IsSatisfiedBy(t *testing.T) {
+
+	expiry := time.Now().Add(60 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	prop_list := `[{"name":"certExpiry", "value":"` + expiry + `", "type":"datetime"},{"name":"installedAt", "value":"2025-06-01"},{"name":"uptime", "value":"36h", "type":"duration"},{"name":"status", "value":"now"}]`
+	props := create_property_list(prop_list, t)
+
+	satisfied := []string{
+		"certExpiry > now+30d",
+		"certExpiry < now+90d && certExpiry >= now",
+		"installedAt < 2026-01-01 && installedAt > 2025-05-31T23:59:59Z",
+		"installedAt == 2025-06-01T00:00:00Z",
+		"uptime > 1d && uptime <= 1.5d && uptime == 1d12h",
+		"uptime != 1h",
+		"status == now",
+	}
+	for _, c := range satisfied {
+		ce := ConstraintExpression([]string{c})
+		if err := ce.IsSatisfiedBy(*props); err != nil {
+			t.Errorf("Error: %v should be satisfied by %v, error: %v", c, *props, err)
+		}
+	}
+
+	notSatisfied := []string{
+		"certExpiry > now+90d",
+		"certExpiry < now",
+		"installedAt >= 2026-01-01",
+		"installedAt == 2025-06-02",
+		"uptime < 1d",
+		"uptime > 2026-01-01",
+		"status > now",
+		"missing < now",
+	}
+	for _, c := range notSatisfied {
+		ce := ConstraintExpression([]string{c})
+		if err := ce.IsSatisfiedBy(*props); err == nil {
+			t.Errorf("Error: %v should not be satisfied by %v", c, *props)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package externalpolicy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// When a set of properties does not satisfy a constraint expression, IsSatisfiedBy only says which part of the
+// expression failed first. A ConstraintTrace explains the whole evaluation. It is the expression tree parsed by the
+// constraint language plugin, less the control operators that only have 1 term, where each node records whether it is
+// satisfied. The leaves record the property that was looked up, the operator, the value in the constraint and the value
+// of the property. Unlike IsSatisfiedBy, the evaluation does not stop at the first result that decides the outcome,
+// every term of the expression is evaluated.
+
+type ConstraintTrace struct {
+	Expression string            `json:"expression,omitempty"` // The constraint as written, only set for each constraint in the expression.
+	Op         string            `json:"op,omitempty"`         // The control operator ("and" or "or"), not set for a leaf.
+	Terms      []ConstraintTrace `json:"terms,omitempty"`      // The terms combined by the control operator.
+	Property   *PropertyTrace    `json:"property,omitempty"`   // The comparison, only set for a leaf.
+	Result     bool              `json:"result"`               // The term is satisfied.
+}
+
+// The evaluation of a single comparison against the properties.
+type PropertyTrace struct {
+	Name          string      `json:"name"`                     // The name of the property.
+	Op            string      `json:"op"`                       // The comparison operator.
+	Value         interface{} `json:"value"`                    // The value in the constraint.
+	Found         bool        `json:"found"`                    // The property is in the properties.
+	PropertyValue interface{} `json:"property_value,omitempty"` // The value of the property, if it was found.
+}
+
+func (t ConstraintTrace) String() string {
+	return t.display("")
+}
+
+// Display the trace as an indented tree, 1 term per line.
+func (t ConstraintTrace) display(indent string) string {
+	const indentStep = "  "
+
+	if t.Expression != "" {
+		s := fmt.Sprintf("%v%v: %v", indent, t.Expression, t.Result)
+		term := ConstraintTrace{Op: t.Op, Terms: t.Terms, Property: t.Property, Result: t.Result}
+		if term.Property != nil || len(term.Terms) != 0 {
+			s = fmt.Sprintf("%v\n%v", s, term.display(indent+indentStep))
+		}
+		return s
+	} else if t.Property != nil {
+		s := fmt.Sprintf("%v%v %v %v: %v", indent, t.Property.Name, t.Property.Op, t.Property.Value, t.Result)
+		if t.Property.Value == "" {
+			// the exists operators do not have a value
+			s = fmt.Sprintf("%v%v %v: %v", indent, t.Property.Name, t.Property.Op, t.Result)
+		}
+		if t.Property.Found {
+			return fmt.Sprintf("%v (%v is %v)", s, t.Property.Name, t.Property.PropertyValue)
+		}
+		return fmt.Sprintf("%v (%v is not defined)", s, t.Property.Name)
+	} else if len(t.Terms) == 1 {
+		return t.Terms[0].display(indent)
+	}
+
+	lines := []string{fmt.Sprintf("%v%v: %v", indent, strings.ToUpper(t.Op), t.Result)}
+	for _, term := range t.Terms {
+		lines = append(lines, term.display(indent+indentStep))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Evaluate the constraint expression against the properties and return the trace of the evaluation. The result of the
+// trace is the same as the result of IsSatisfiedBy. An empty expression is satisfied by any properties.
+func (self *ConstraintExpression) Explain(props []Property) (*ConstraintTrace, error) {
+
+	trace := &ConstraintTrace{Op: OP_AND, Terms: []ConstraintTrace{}, Result: true}
+
+	// Each constraint is parsed on its own so that the trace can show it as written.
+	for _, constraint := range *self {
+		ce := ConstraintExpression([]string{constraint})
+		rp, err := RequiredPropertyFromConstraint(&ce)
+		if err != nil {
+			return nil, err
+		} else if err := rp.IsValid(); err != nil {
+			return nil, err
+		}
+
+		term := rp.Explain(props)
+		term.Expression = strings.Replace(constraint, "\a", " ", -1)
+		trace.Terms = append(trace.Terms, *term)
+		trace.Result = trace.Result && term.Result
+	}
+
+	return trace, nil
+}
+
+// Evaluate the RequiredProperty expression against the properties and return the trace of the evaluation.
+func (self *RequiredProperty) Explain(props []Property) *ConstraintTrace {
+
+	// If there is no expression at all, then there is nothing to satisify
+	if len(*self) == 0 {
+		return &ConstraintTrace{Op: OP_AND, Terms: []ConstraintTrace{}, Result: true}
+	}
+
+	// Make a copy of the object so that we can get it's type correct
+	topMap := make(map[string]interface{})
+	for k := range *self {
+		topMap[k] = (*self)[k]
+	}
+	return explain(&topMap, &props)
+}
+
+// This function evaluates a control operator and all of its terms. It is called recursively because control operators
+// can be nested n levels deep.
+func explain(cop *map[string]interface{}, props *[]Property) *ConstraintTrace {
+	controlOp := getControlOperator(cop)
+	trace := &ConstraintTrace{Op: controlOp, Terms: []ConstraintTrace{}}
+
+	// an AND is satisfied until a term is not, an OR is not satisfied until a term is
+	trace.Result = (controlOp == OP_AND)
+
+	propArray, _ := (*cop)[controlOp].([]interface{})
+	for _, p := range propArray {
+		var term *ConstraintTrace
+		if prop := isPropertyExpression(p); prop != nil {
+			term = explainProperty(prop, props)
+		} else if cop := isControlOp(p); cop != nil {
+			term = explain(cop, props)
+		} else {
+			// IsSatisfiedBy rejects the expression, so the term cannot be satisfied.
+			term = &ConstraintTrace{Expression: fmt.Sprintf("%v", p), Result: false}
+		}
+
+		if controlOp == OP_AND {
+			trace.Result = trace.Result && term.Result
+		} else if controlOp == OP_OR {
+			trace.Result = trace.Result || term.Result
+		}
+		trace.Terms = append(trace.Terms, *term)
+	}
+
+	// The parser wraps each term in control operators that only have 1 term, they do not change the result.
+	if len(trace.Terms) == 1 {
+		return &trace.Terms[0]
+	}
+	return trace
+}
+
+// This function evaluates a single comparison. The result is the same as propertyInArray, the trace records the value of the
+// first property with the same name because that is the property the comparison is made with.
+func explainProperty(propexp *PropertyExpression, props *[]Property) *ConstraintTrace {
+	op := propexp.Op
+	if op == "" {
+		op = doubleequalto
+	}
+
+	pt := &PropertyTrace{Name: propexp.Name, Op: op, Value: propexp.Value}
+	for _, p := range *props {
+		if p.Name == propexp.Name {
+			pt.Found = true
+			pt.PropertyValue = p.Value
+			break
+		}
+	}
+
+	return &ConstraintTrace{Property: pt, Result: propertyInArray(propexp, props)}
+}
@@ -0,0 +1,113 @@
+// +build unit
+
+package externalpolicy
+
+import (
+	"encoding/json"
+	_ "github.com/open-horizon/anax/externalpolicy/text_language"
+	"strings"
+	"testing"
+)
+
+// The trace has the same result as IsSatisfiedBy and records every comparison.
+func Test_Explain_result(t *testing.T) {
+
+	ce := new(ConstraintExpression)
+	(*ce) = append((*ce),
+		"iame2edev == true && cpu == 3 || memory <= 32",
+		"hello == \"world\"",
+		"version in [1.1.1,INFINITY) OR cert == USDA")
+	prop_list := `[{"name":"iame2edev", "value":true},{"name":"cpu", "value":3},{"name":"memory", "value":64},{"name":"hello", "value":"world"},{"name":"version","value":"1.2.1","type":"version"}]`
+	props := create_property_list(prop_list, t)
+
+	if trace, err := ce.Explain(*props); err != nil {
+		t.Errorf("Error: unable to explain %v: %v", *ce, err)
+	} else if !trace.Result {
+		t.Errorf("Error: trace should be satisfied: %v", trace)
+	} else if len(trace.Terms) != 3 {
+		t.Errorf("Error: trace should have a term for each constraint: %v", trace)
+	} else if trace.Terms[0].Expression != (*ce)[0] {
+		t.Errorf("Error: the first term should be the constraint %v, is %v", (*ce)[0], trace.Terms[0].Expression)
+	} else if leaves := traceLeaves(trace); len(leaves) != 6 {
+		t.Errorf("Error: trace should have 6 comparisons, has %v: %v", len(leaves), trace)
+	} else if leaves[2].Property.Name != "memory" || leaves[2].Result || leaves[2].Property.PropertyValue != float64(64) {
+		t.Errorf("Error: memory should not be satisfied: %v", leaves[2])
+	} else if leaves[5].Property.Name != "cert" || leaves[5].Property.Found || leaves[5].Result {
+		t.Errorf("Error: cert should not be found: %v", leaves[5])
+	}
+
+	// the trace agrees with IsSatisfiedBy when the properties do not satisfy the constraints
+	prop_list = `[{"name":"iame2edev", "value":false},{"name":"cpu", "value":3},{"name":"memory", "value":64},{"name":"hello", "value":"world"},{"name":"version","value":"1.2.1","type":"version"}]`
+	props = create_property_list(prop_list, t)
+
+	if err := ce.IsSatisfiedBy(*props); err == nil {
+		t.Errorf("Error: constraints %v should not be satisfied", *ce)
+	} else if trace, err := ce.Explain(*props); err != nil {
+		t.Errorf("Error: unable to explain %v: %v", *ce, err)
+	} else if trace.Result {
+		t.Errorf("Error: trace should not be satisfied: %v", trace)
+	} else if trace.Terms[0].Result || !trace.Terms[1].Result || !trace.Terms[2].Result {
+		t.Errorf("Error: only the first constraint should not be satisfied: %v", trace)
+	} else if leaves := traceLeaves(trace); len(leaves) != 6 {
+		t.Errorf("Error: all comparisons should be evaluated, has %v: %v", len(leaves), trace)
+	}
+}
+
+// An empty expression is satisfied and an invalid expression cannot be explained.
+func Test_Explain_empty_and_invalid(t *testing.T) {
+
+	ce := new(ConstraintExpression)
+	if trace, err := ce.Explain([]Property{}); err != nil {
+		t.Errorf("Error: unable to explain an empty expression: %v", err)
+	} else if !trace.Result || len(trace.Terms) != 0 {
+		t.Errorf("Error: an empty expression should be satisfied: %v", trace)
+	}
+
+	(*ce) = append((*ce), "prop == ")
+	if _, err := ce.Explain([]Property{}); err == nil {
+		t.Errorf("Error: expression %v should not be explained", *ce)
+	}
+}
+
+// The trace can be serialized and displayed.
+func Test_Explain_display(t *testing.T) {
+
+	ce := new(ConstraintExpression)
+	(*ce) = append((*ce), "prop == value && (prop2 < 3 || prop3 == true)")
+	props := []Property{*Property_Factory("prop", "value"), *Property_Factory("prop2", float64(5))}
+
+	trace, err := ce.Explain(props)
+	if err != nil {
+		t.Errorf("Error: unable to explain %v: %v", *ce, err)
+		return
+	}
+
+	expected := strings.Join([]string{
+		"prop == value && (prop2 < 3 || prop3 == true): false",
+		"  AND: false",
+		"    prop == value: true (prop is value)",
+		"    OR: false",
+		"      prop2 < 3: false (prop2 is 5)",
+		"      prop3 == true: false (prop3 is not defined)",
+	}, "\n")
+	if trace.String() != expected {
+		t.Errorf("Error: trace should be displayed as\n%v\nis\n%v", expected, trace)
+	}
+
+	if b, err := json.Marshal(trace); err != nil {
+		t.Errorf("Error: unable to marshal the trace: %v", err)
+	} else if !strings.Contains(string(b), `"property":{"name":"prop3","op":"==","value":"true","found":false}`) {
+		t.Errorf("Error: the trace should show that prop3 was not found: %v", string(b))
+	}
+}
+
+func traceLeaves(trace *ConstraintTrace) []ConstraintTrace {
+	leaves := []ConstraintTrace{}
+	if trace.Property != nil {
+		return append(leaves, *trace)
+	}
+	for i := range trace.Terms {
+		leaves = append(leaves, traceLeaves(&trace.Terms[i])...)
+	}
+	return leaves
+}
@@ -3,9 +3,14 @@ package externalpolicy
 import (
 	"errors"
 	"fmt"
+	"github.com/open-horizon/anax/externalpolicy/datetime"
+	"github.com/open-horizon/anax/externalpolicy/geo"
 	"github.com/open-horizon/anax/semanticversion"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // The purpose this file is to evaluate the Constraints field in the Policy struct
@@ -23,8 +28,10 @@ import (
 // _control_operator_    = {"and", "or", "not"}
 // _expression_          = _control_operator_: [_expression_] || property
 // _property_            = "name": _property_name_, "value": _property_value, "op": _comparison_operator_
-// _comparison_operator_ = {"<", "=", ">", "<=", ">=", "!="}
+// _comparison_operator_ = {"<", "=", ">", "<=", ">=", "!=", "in", "matches", "startswith", "endswith", "contains", "iequals", "exists", "not exists"}
 // The "=" and "!=" comparison operators can be applied to strings and integers.
+// The "matches", "startswith", "endswith", "contains" and "iequals" operators can only be applied to strings.
+// The "exists" and "not exists" operators ignore the value, they test whether the property is defined.
 // If the "op" key is missing, then equal is assumed.
 //
 // See the unit tests for examples of valid and invalid syntax
@@ -65,6 +72,15 @@ const lessthaneq = "<="
 const greaterthaneq = ">="
 const notequalto = "!="
 const isin = "in"
+const matches = "matches"
+const startswith = "startswith"
+const endswith = "endswith"
+const contains = "contains"
+const iequals = "iequals"
+const exists = "exists"
+const notexists = "not exists"
+const within = "within"
+const inside = "inside"
 
 // This struct represents property value expressions to be satisfied
 type PropertyExpression struct {
@@ -282,7 +298,8 @@ func controlOperators() map[string]int {
 // of the supported comparison operators.
 func comparisonOperators() map[string]int {
 	// return map[string]int {and:0, or:0, not:0}
-	return map[string]int{lessthan: 0, greaterthan: 0, doubleequalto: 0, equalto: 0, lessthaneq: 0, greaterthaneq: 0, notequalto: 0, isin: 0}
+	return map[string]int{lessthan: 0, greaterthan: 0, doubleequalto: 0, equalto: 0, lessthaneq: 0, greaterthaneq: 0, notequalto: 0, isin: 0,
+		matches: 0, startswith: 0, endswith: 0, contains: 0, iequals: 0, exists: 0, notexists: 0, within: 0, inside: 0}
 }
 
 // Return a map of comparison operators that only work on strings
@@ -290,6 +307,16 @@ func stringOperators() map[string]int {
 	return map[string]int{doubleequalto: 0, equalto: 0, notequalto: 0, isin: 0}
 }
 
+// Return a map of comparison operators that match the text of a string
+func textOperators() map[string]int {
+	return map[string]int{matches: 0, startswith: 0, endswith: 0, contains: 0, iequals: 0}
+}
+
+// Return a map of comparison operators that compare the location of a geo property with an area
+func geoOperators() map[string]int {
+	return map[string]int{within: 0, inside: 0}
+}
+
 // This function checks the type of the input interface object to see if it's a map of string to
 // interface. Control operators and Properties are both of this type when deserialized by the
 // JSON library.
@@ -412,12 +439,28 @@ func getKeys(m map[string]interface{}) []string {
 // This function compares a Property object with an array of Property objects to see if it's
 // in the array with an appropriate value.
 func propertyInArray(propexp *PropertyExpression, props *[]Property) bool {
+
+	// The exists operators only test whether the property is defined.
+	if propexp.Op == exists || propexp.Op == notexists {
+		for _, p := range *props {
+			if p.Name == propexp.Name {
+				return propexp.Op == exists
+			}
+		}
+		return propexp.Op == notexists
+	}
+
 	for _, p := range *props {
 		if p.Name != propexp.Name {
 			// These are not the droids we're looking for
 			continue
 		} else {
 			if isFloat64(p.Value) {
+				if _, ok := textOperators()[propexp.Op]; ok {
+					return false
+				} else if propexp.Op == isin && isString(propexp.Value) {
+					return numericRangeContains(propexp.Value.(string), p.Value.(float64))
+				}
 				var propexpFloat float64
 				if isFloat64(propexp.Value) {
 					propexpFloat = propexp.Value.(float64)
@@ -460,6 +503,13 @@ func propertyInArray(propexp *PropertyExpression, props *[]Property) bool {
 					return p.Value.(bool) == propexpBool
 				}
 			} else if isString(p.Value) && isString(propexp.Value) {
+				if _, ok := geoOperators()[propexp.Op]; ok {
+					return geoOperatorSatisfied(propexp.Op, p.Value.(string), propexp.Value.(string))
+				} else if _, ok := textOperators()[propexp.Op]; ok {
+					return textOperatorSatisfied(propexp.Op, &p, propexp.Value.(string))
+				} else if satisfied, compared := timeOperatorSatisfied(propexp.Op, &p, propexp.Value.(string)); compared {
+					return satisfied
+				}
 				pValue := removeSpaces(removeQuotes(p.Value.(string)))
 				propexpValue := removeSpaces(removeQuotes(propexp.Value.(string)))
 				if _, ok := stringOperators()[propexp.Op]; !ok {
@@ -509,6 +559,156 @@ func containsVersion(versRange string, version string) bool {
 	return within
 }
 
+// This function checks if the value is in a numeric range, e.g. [2,8) or (0.5,INFINITY).
+func numericRangeContains(numRange string, value float64) bool {
+	numRange = strings.TrimSpace(numRange)
+	if len(numRange) < 2 {
+		return false
+	}
+	bounds := strings.Split(numRange[1:len(numRange)-1], ",")
+	if len(bounds) != 2 {
+		return false
+	}
+
+	lower, err := strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64)
+	if err != nil {
+		return false
+	}
+	upper := math.Inf(1)
+	if upperStr := strings.TrimSpace(bounds[1]); upperStr != "INFINITY" {
+		if upper, err = strconv.ParseFloat(upperStr, 64); err != nil {
+			return false
+		}
+	}
+
+	if value < lower || (value == lower && numRange[0] == '(') {
+		return false
+	} else if value > upper || (value == upper && numRange[len(numRange)-1] == ')') {
+		return false
+	}
+	return true
+}
+
+// This function evaluates the operators that match the text of a string property. For a list of strings property, the
+// operator is satisfied if one of the strings in the list satisfies it.
+func textOperatorSatisfied(op string, p *Property, constrValue string) bool {
+	constrValue = strings.TrimSpace(constrValue)
+	if len(constrValue) >= 2 && strings.HasPrefix(constrValue, "\"") && strings.HasSuffix(constrValue, "\"") {
+		constrValue = constrValue[1 : len(constrValue)-1]
+	}
+
+	propValues := []string{p.Value.(string)}
+	if p.Type == LIST_TYPE {
+		propValues = strings.Split(p.Value.(string), ",")
+	}
+
+	var re *regexp.Regexp
+	if op == matches {
+		var err error
+		if re, err = regexp.Compile(constrValue); err != nil {
+			return false
+		}
+	}
+
+	for _, propValue := range propValues {
+		if p.Type == LIST_TYPE {
+			propValue = strings.TrimSpace(propValue)
+		}
+		switch op {
+		case matches:
+			if re.MatchString(propValue) {
+				return true
+			}
+		case startswith:
+			if strings.HasPrefix(propValue, constrValue) {
+				return true
+			}
+		case endswith:
+			if strings.HasSuffix(propValue, constrValue) {
+				return true
+			}
+		case contains:
+			if strings.Contains(propValue, constrValue) {
+				return true
+			}
+		case iequals:
+			if strings.EqualFold(propValue, constrValue) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// This function evaluates the operators that compare a location with an area. The whole circle given by the accuracy of
+// the location must be in the area.
+func geoOperatorSatisfied(op string, propValue string, constrValue string) bool {
+	loc, err := geo.ParseLocation(propValue)
+	if err != nil {
+		return false
+	}
+
+	if op == within {
+		if circle, err := geo.ParseCircle(constrValue); err == nil {
+			return circle.Contains(*loc)
+		}
+	} else if op == inside {
+		if polygon, err := geo.ParsePolygon(constrValue); err == nil {
+			return polygon.Contains(*loc)
+		}
+	}
+	return false
+}
+
+// This function compares a datetime or a duration property with the value of a constraint, which for a datetime can be
+// relative to the current time, e.g. now+30d. The second return value is false when the values are not both datetimes or
+// both durations, they are then compared as strings.
+func timeOperatorSatisfied(op string, p *Property, constrValue string) (bool, bool) {
+	constrValue = strings.TrimSpace(constrValue)
+	if p.Type == STRING_TYPE || p.Type == LIST_TYPE || strings.HasPrefix(constrValue, "\"") {
+		return false, false
+	}
+
+	order := 0
+	if propTime, err := datetime.ParseDateTime(p.Value.(string)); err == nil && p.Type != DURATION_TYPE {
+		constrTime, err := datetime.ParseDateTimeExpression(constrValue, time.Now())
+		if err != nil {
+			return false, false
+		} else if propTime.Before(constrTime) {
+			order = -1
+		} else if propTime.After(constrTime) {
+			order = 1
+		}
+	} else if propDuration, err := datetime.ParseDuration(p.Value.(string)); err == nil && p.Type != DATETIME_TYPE {
+		constrDuration, err := datetime.ParseDuration(constrValue)
+		if err != nil {
+			return false, false
+		} else if propDuration < constrDuration {
+			order = -1
+		} else if propDuration > constrDuration {
+			order = 1
+		}
+	} else {
+		return false, false
+	}
+
+	switch op {
+	case lessthan:
+		return order < 0, true
+	case greaterthan:
+		return order > 0, true
+	case lessthaneq:
+		return order <= 0, true
+	case greaterthaneq:
+		return order >= 0, true
+	case notequalto:
+		return order != 0, true
+	case equalto, doubleequalto:
+		return order == 0, true
+	}
+	return false, false
+}
+
 func stringListContains(propVal string, constrList string) bool {
 	constrValueList := strings.Split(constrList, ",")
 	propValTrimmed := removeQuotes(removeSpaces(propVal))
@@ -553,6 +753,13 @@ func displayRequiredProperty(cop *map[string]interface{}) string {
 				prop.Op = doubleequalto
 			}
 			s := fmt.Sprintf("%v%v%v", prop.Name, prop.Op, prop.Value)
+			if prop.Op == exists || prop.Op == notexists {
+				s = fmt.Sprintf("%v %v", prop.Name, prop.Op)
+			} else if _, ok := textOperators()[prop.Op]; ok {
+				s = fmt.Sprintf("%v %v %v", prop.Name, prop.Op, prop.Value)
+			} else if _, ok := geoOperators()[prop.Op]; ok {
+				s = fmt.Sprintf("%v %v %v", prop.Name, prop.Op, prop.Value)
+			}
 			display_strings = append(display_strings, s)
 		} else if cop1 := isControlOp(p); cop1 != nil {
 			s := displayRequiredProperty(cop1)
@@ -0,0 +1,120 @@
+package datetime
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/i18n"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This package implements the datetime and duration property types. A datetime is a date, 2026-01-01, which is midnight
+// UTC, or a date and time in the RFC 3339 format, 2026-01-01T10:30:00Z, where the time zone can be omitted for UTC. A
+// duration is a sequence of numbers followed by a unit, w (week), d (day), h (hour), m (minute) or s (second), e.g. 30d
+// or 1h30m. In a constraint, a datetime can also be relative to the time the constraint is evaluated: now, now+30d or
+// now-12h.
+
+const NOW = "now"
+
+var dateTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"}
+
+var durationUnits = map[byte]time.Duration{
+	'w': 7 * 24 * time.Hour,
+	'd': 24 * time.Hour,
+	'h': time.Hour,
+	'm': time.Minute,
+	's': time.Second,
+}
+
+// Parse an absolute datetime.
+func ParseDateTime(s string) (time.Time, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	s = strings.TrimSpace(s)
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New(msgPrinter.Sprintf("%v is not a valid datetime, it must be a date such as 2026-01-01 or a date and time such as 2026-01-01T10:30:00Z.", s))
+}
+
+// Parse a duration such as 30d or 1h30m.
+func ParseDuration(s string) (time.Duration, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	invalid := errors.New(msgPrinter.Sprintf("%v is not a valid duration, it must be a sequence of numbers followed by a unit (w, d, h, m or s) such as 30d or 1h30m.", s))
+
+	s = strings.TrimSpace(s)
+	remainder := s
+	negative := strings.HasPrefix(remainder, "-")
+	if negative {
+		remainder = remainder[1:]
+	}
+	if remainder == "" {
+		return 0, invalid
+	}
+
+	var d time.Duration
+	for remainder != "" {
+		end := strings.IndexFunc(remainder, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if end <= 0 {
+			return 0, invalid
+		}
+		unit, ok := durationUnits[remainder[end]]
+		if !ok {
+			return 0, invalid
+		}
+		num, err := strconv.ParseFloat(remainder[:end], 64)
+		if err != nil {
+			return 0, invalid
+		}
+		d += time.Duration(num * float64(unit))
+		remainder = remainder[end+1:]
+	}
+
+	if negative {
+		d = -d
+	}
+	return d, nil
+}
+
+// Returns true if the value is a datetime relative to the time of the evaluation, e.g. now or now+30d.
+func IsNowExpression(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == NOW {
+		return true
+	} else if (!strings.HasPrefix(s, NOW+"+") && !strings.HasPrefix(s, NOW+"-")) || strings.HasPrefix(s[len(NOW)+1:], "-") {
+		return false
+	}
+	_, err := ParseDuration(s[len(NOW)+1:])
+	return err == nil
+}
+
+// Parse a datetime in a constraint, which is either absolute or relative to the given time.
+func ParseDateTimeExpression(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, NOW) {
+		return ParseDateTime(s)
+	} else if s == NOW {
+		return now, nil
+	}
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if (s[len(NOW)] != '+' && s[len(NOW)] != '-') || strings.HasPrefix(s[len(NOW)+1:], "-") {
+		return time.Time{}, errors.New(msgPrinter.Sprintf("%v is not a valid datetime, a relative datetime must be written as now, now+duration or now-duration.", s))
+	}
+	d, err := ParseDuration(s[len(NOW)+1:])
+	if err != nil {
+		return time.Time{}, err
+	} else if s[len(NOW)] == '-' {
+		d = -d
+	}
+	return now.Add(d), nil
+}
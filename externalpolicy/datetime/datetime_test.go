@@ -0,0 +1,96 @@
+// +build unit
+
+package datetime
+
+import (
+	"testing"
+	"time"
+)
+
+// Datetimes are a date or a date and time in the RFC 3339 format.
+func Test_ParseDateTime(t *testing.T) {
+
+	tests := []struct {
+		s string
+		t time.Time
+	}{
+		{"2026-01-01", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{" 2026-01-01T10:30:00Z", time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"2026-01-01T10:30:00", time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"2026-01-01T10:30:00.5+02:00", time.Date(2026, 1, 1, 8, 30, 0, 500000000, time.UTC)},
+	}
+	for _, test := range tests {
+		if dt, err := ParseDateTime(test.s); err != nil {
+			t.Errorf("Error: unable to parse %v: %v", test.s, err)
+		} else if !dt.Equal(test.t) {
+			t.Errorf("Error: %v should be parsed to %v, is %v", test.s, test.t, dt)
+		}
+	}
+
+	for _, s := range []string{"", "now", "2026", "2026-13-01", "2026-01-01T25:00:00Z", "01/01/2026"} {
+		if dt, err := ParseDateTime(s); err == nil {
+			t.Errorf("Error: %v should not be parsed, was parsed to %v", s, dt)
+		}
+	}
+}
+
+// Durations are a sequence of numbers followed by a unit.
+func Test_ParseDuration(t *testing.T) {
+
+	tests := []struct {
+		s string
+		d time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"1h30m", 90 * time.Minute},
+		{"1.5h", 90 * time.Minute},
+		{"2w1s", 14*24*time.Hour + time.Second},
+		{"-12h", -12 * time.Hour},
+	}
+	for _, test := range tests {
+		if d, err := ParseDuration(test.s); err != nil {
+			t.Errorf("Error: unable to parse %v: %v", test.s, err)
+		} else if d != test.d {
+			t.Errorf("Error: %v should be parsed to %v, is %v", test.s, test.d, d)
+		}
+	}
+
+	for _, s := range []string{"", "-", "30", "d", "30x", "1h30", "1..5h", "--1h"} {
+		if d, err := ParseDuration(s); err == nil {
+			t.Errorf("Error: %v should not be parsed, was parsed to %v", s, d)
+		}
+	}
+}
+
+// Datetimes in a constraint can be relative to the time of the evaluation.
+func Test_ParseDateTimeExpression(t *testing.T) {
+
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		s string
+		t time.Time
+	}{
+		{"now", now},
+		{"now+30d", now.Add(30 * 24 * time.Hour)},
+		{"now-1h30m", now.Add(-90 * time.Minute)},
+		{"2026-01-01", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		if !IsNowExpression(test.s) && test.s[0] == 'n' {
+			t.Errorf("Error: %v should be a datetime relative to now", test.s)
+		} else if dt, err := ParseDateTimeExpression(test.s, now); err != nil {
+			t.Errorf("Error: unable to parse %v: %v", test.s, err)
+		} else if !dt.Equal(test.t) {
+			t.Errorf("Error: %v should be parsed to %v, is %v", test.s, test.t, dt)
+		}
+	}
+
+	for _, s := range []string{"now+", "now--1d", "now+30", "nowadays", "now30d", "2026-01-01+1d"} {
+		if IsNowExpression(s) {
+			t.Errorf("Error: %v should not be a datetime relative to now", s)
+		} else if dt, err := ParseDateTimeExpression(s, now); err == nil {
+			t.Errorf("Error: %v should not be parsed, was parsed to %v", s, dt)
+		}
+	}
+}
@@ -73,6 +73,11 @@ func (e *ExternalPolicy) ValidateAndNormalize() error {
 		}
 	}
 
+	// The maintenance window of a node must be a valid schedule.
+	if _, err := GetNodeMaintenanceWindow(e.Properties); err != nil {
+		return err
+	}
+
 	// Validate the Constraints expression by invoking the plugins.
 	if e != nil && len(e.Constraints) != 0 {
 		_, err := e.Constraints.Validate()
@@ -83,6 +88,23 @@ func (e *ExternalPolicy) ValidateAndNormalize() error {
 	return nil
 }
 
+// Same as ValidateAndNormalize, it also returns the warnings from the analysis of the constraints. The warnings are about
+// constraints that are valid but cannot be satisfied, are always satisfied or are redundant, see Analyze. The analysis is
+// only done for the policies that a user adds or changes, so that the user sees the warnings.
+func (e *ExternalPolicy) ValidateAndNormalizeWithWarnings() ([]ConstraintWarning, error) {
+	if err := e.ValidateAndNormalize(); err != nil {
+		return nil, err
+	}
+
+	// The warnings never make the policy invalid, so a constraint that cannot be analyzed is not an error.
+	if e != nil && len(e.Constraints) != 0 {
+		if warnings, err := e.Constraints.Analyze(); err == nil {
+			return warnings, nil
+		}
+	}
+	return nil, nil
+}
+
 // merge the two policies. If the newPol contains the same properties, ignore them unless replaceExsiting is true.
 func (e *ExternalPolicy) MergeWith(newPol *ExternalPolicy, replaceExsiting bool) {
 	if newPol == nil {
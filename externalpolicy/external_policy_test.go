@@ -63,3 +63,23 @@ func ExternalPolicy_Test_MergeWith(t *testing.T) {
 		t.Errorf("Error: Properties %v should have 5 elements but got %v", pol1.Constraints, len(pol1.Constraints))
 	}
 }
+
+func Test_Validate_MaintenanceWindow(t *testing.T) {
+	pol := &ExternalPolicy{Properties: PropertyList{*Property_Factory(PROP_NODE_MAINT_WIN, "TZ=UTC; 0 2 * * 6 240")}}
+	if err := pol.ValidateAndNormalize(); err != nil {
+		t.Errorf("Error: %v should be a valid maintenance window, error: %v", pol, err)
+	} else if sched, err := GetNodeMaintenanceWindow(pol.Properties); err != nil || sched == nil {
+		t.Errorf("Error: unable to get the maintenance window from %v, error: %v", pol, err)
+	}
+
+	for _, value := range []interface{}{"0 2 * * 6", "TZ=Nowhere; 0 2 * * 6 60", 10} {
+		pol := &ExternalPolicy{Properties: PropertyList{*Property_Factory(PROP_NODE_MAINT_WIN, value)}}
+		if err := pol.ValidateAndNormalize(); err == nil {
+			t.Errorf("Error: %v should not be a valid maintenance window", value)
+		}
+	}
+
+	if sched, err := GetNodeMaintenanceWindow(PropertyList{}); err != nil || sched != nil {
+		t.Errorf("Error: a node without a maintenance window should not have a schedule, got %v, error: %v", sched, err)
+	}
+}
@@ -0,0 +1,291 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/i18n"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// This package implements the geo property type and the geospatial constraint operators. A location is written as
+// "lat,lon" or "lat,lon,accuracy" where lat and lon are in decimal degrees and the optional accuracy is the radius in
+// kilometers of the circle around the point in which the node is. The areas used by the constraint operators are written
+// as they are in the text constraint language:
+//   a circle:  10km of (41.0064,-111.9393)
+//   a polygon: [(41.1,-112.0),(41.1,-111.8),(40.9,-111.8),(40.9,-112.0)]
+
+// The mean radius of the earth.
+const EARTH_RADIUS_KM = 6371.0088
+
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("%v,%v", strconv.FormatFloat(p.Lat, 'f', -1, 64), strconv.FormatFloat(p.Lon, 'f', -1, 64))
+}
+
+// The location of a node, the node is somewhere in the circle of radius AccuracyKM around the point.
+type Location struct {
+	Point
+	AccuracyKM float64 `json:"accuracy_km,omitempty"`
+}
+
+func (l Location) String() string {
+	if l.AccuracyKM != 0 {
+		return fmt.Sprintf("%v,%v", l.Point, strconv.FormatFloat(l.AccuracyKM, 'f', -1, 64))
+	}
+	return l.Point.String()
+}
+
+type Circle struct {
+	Center   Point
+	RadiusKM float64
+}
+
+func (c Circle) String() string {
+	return fmt.Sprintf("%vkm of (%v)", strconv.FormatFloat(c.RadiusKM, 'f', -1, 64), c.Center)
+}
+
+type Polygon []Point
+
+func (p Polygon) String() string {
+	points := make([]string, 0, len(p))
+	for _, point := range p {
+		points = append(points, fmt.Sprintf("(%v)", point))
+	}
+	return "[" + strings.Join(points, ",") + "]"
+}
+
+// Create a point and check that the coordinates are on the earth.
+func NewPoint(lat float64, lon float64) (*Point, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if math.IsNaN(lat) || lat < -90 || lat > 90 {
+		return nil, errors.New(msgPrinter.Sprintf("The latitude %v must be between -90 and 90.", lat))
+	} else if math.IsNaN(lon) || lon < -180 || lon > 180 {
+		return nil, errors.New(msgPrinter.Sprintf("The longitude %v must be between -180 and 180.", lon))
+	}
+	return &Point{Lat: lat, Lon: lon}, nil
+}
+
+// Parse a location written as "lat,lon" or "lat,lon,accuracy".
+func ParseLocation(s string) (*Location, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, errors.New(msgPrinter.Sprintf("The location %v must be written as latitude,longitude or latitude,longitude,accuracy in kilometers.", s))
+	}
+
+	nums, err := parseNumbers(parts)
+	if err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("The location %v is not valid: %v", s, err))
+	}
+
+	point, err := NewPoint(nums[0], nums[1])
+	if err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("The location %v is not valid: %v", s, err))
+	}
+
+	loc := &Location{Point: *point}
+	if len(nums) == 3 {
+		if nums[2] < 0 {
+			return nil, errors.New(msgPrinter.Sprintf("The accuracy of the location %v cannot be negative.", s))
+		}
+		loc.AccuracyKM = nums[2]
+	}
+	return loc, nil
+}
+
+// Parse a circle written as "N km of (lat,lon)".
+func ParseCircle(s string) (*Circle, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	kmIndex := strings.Index(s, "km")
+	if kmIndex < 0 || !strings.HasPrefix(strings.TrimSpace(s[kmIndex+2:]), "of") {
+		return nil, errors.New(msgPrinter.Sprintf("The area %v must be written as N km of (latitude,longitude).", s))
+	}
+
+	radius, err := strconv.ParseFloat(strings.TrimSpace(s[:kmIndex]), 64)
+	if err != nil || math.IsNaN(radius) || radius < 0 {
+		return nil, errors.New(msgPrinter.Sprintf("The distance in the area %v must be a positive number of kilometers.", s))
+	}
+
+	points, err := parsePoints(strings.TrimSpace(s[kmIndex+2:])[2:])
+	if err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("The area %v is not valid: %v", s, err))
+	} else if len(points) != 1 {
+		return nil, errors.New(msgPrinter.Sprintf("The area %v must be written as N km of (latitude,longitude).", s))
+	}
+
+	return &Circle{Center: points[0], RadiusKM: radius}, nil
+}
+
+// Parse a polygon written as "[(lat,lon),(lat,lon),(lat,lon)...]", the last point is joined to the first one.
+func ParsePolygon(s string) (Polygon, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "[") || !strings.HasSuffix(trimmed, "]") {
+		return nil, errors.New(msgPrinter.Sprintf("The polygon %v must be written as [(latitude,longitude),(latitude,longitude),(latitude,longitude)...].", s))
+	}
+
+	points, err := parsePoints(trimmed[1 : len(trimmed)-1])
+	if err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("The polygon %v is not valid: %v", s, err))
+	} else if len(points) < 3 {
+		return nil, errors.New(msgPrinter.Sprintf("The polygon %v must have at least 3 points.", s))
+	}
+	return Polygon(points), nil
+}
+
+// Parse a comma separated list of points, each one in parentheses.
+func parsePoints(s string) ([]Point, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	points := make([]Point, 0)
+	remainder := strings.TrimSpace(s)
+	for remainder != "" {
+		if len(points) != 0 {
+			if !strings.HasPrefix(remainder, ",") {
+				return nil, errors.New(msgPrinter.Sprintf("The points must be separated by commas."))
+			}
+			remainder = strings.TrimSpace(remainder[1:])
+		}
+
+		end := strings.Index(remainder, ")")
+		if !strings.HasPrefix(remainder, "(") || end < 0 {
+			return nil, errors.New(msgPrinter.Sprintf("Each point must be written as (latitude,longitude)."))
+		}
+
+		coords := strings.Split(remainder[1:end], ",")
+		if len(coords) != 2 {
+			return nil, errors.New(msgPrinter.Sprintf("Each point must be written as (latitude,longitude)."))
+		}
+		nums, err := parseNumbers(coords)
+		if err != nil {
+			return nil, err
+		}
+		point, err := NewPoint(nums[0], nums[1])
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, *point)
+		remainder = strings.TrimSpace(remainder[end+1:])
+	}
+	return points, nil
+}
+
+func parseNumbers(strs []string) ([]float64, error) {
+	nums := make([]float64, 0, len(strs))
+	for _, s := range strs {
+		if num, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err != nil {
+			return nil, err
+		} else {
+			nums = append(nums, num)
+		}
+	}
+	return nums, nil
+}
+
+// The great circle distance in kilometers between 2 points, computed with the haversine formula.
+func Distance(a Point, b Point) float64 {
+	lat1 := toRadians(a.Lat)
+	lat2 := toRadians(b.Lat)
+	dLat := lat2 - lat1
+	dLon := toRadians(b.Lon - a.Lon)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EARTH_RADIUS_KM * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Returns true if the whole circle in which the node is lies within the circle.
+func (c Circle) Contains(l Location) bool {
+	return Distance(c.Center, l.Point)+l.AccuracyKM <= c.RadiusKM
+}
+
+// Returns true if the whole circle in which the node is lies inside the polygon. The polygon is projected on the plane
+// tangent to the earth at the location of the node, which is accurate enough for the areas that policies target (cities,
+// regions, countries) and works for polygons that cross the 180th meridian. The polygon must span less than 180 degrees
+// of longitude.
+func (p Polygon) Contains(l Location) bool {
+	if len(p) < 3 {
+		return false
+	}
+
+	dLons := make([]float64, len(p))
+	xs := make([]float64, len(p))
+	ys := make([]float64, len(p))
+	for i, point := range p {
+		dLons[i] = lonDifference(l.Point, point)
+		xs[i] = toRadians(dLons[i]) * math.Cos(toRadians(l.Lat)) * EARTH_RADIUS_KM
+		ys[i] = toRadians(point.Lat-l.Lat) * EARTH_RADIUS_KM
+	}
+
+	// An edge that goes around the other side of the earth means that the node is on the other side of the earth.
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		if math.Abs(dLons[i]-dLons[j]) > 180 {
+			return false
+		}
+	}
+
+	// Cast a ray from the node along the x axis and count the edges that it crosses.
+	inside := false
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		if (ys[i] > 0) != (ys[j] > 0) && 0 < xs[i]+(xs[j]-xs[i])*(0-ys[i])/(ys[j]-ys[i]) {
+			inside = !inside
+		}
+	}
+	if !inside {
+		return false
+	}
+
+	// The node is inside, check that the circle around it does not cross an edge.
+	for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+		if distanceToSegment(xs[j], ys[j], xs[i], ys[i]) < l.AccuracyKM {
+			return false
+		}
+	}
+	return true
+}
+
+// The difference of longitude from the origin to a point, between -180 and 180 degrees.
+func lonDifference(origin Point, p Point) float64 {
+	dLon := p.Lon - origin.Lon
+	if dLon > 180 {
+		dLon -= 360
+	} else if dLon < -180 {
+		dLon += 360
+	}
+	return dLon
+}
+
+// The distance from the origin of the plane to the segment between 2 points.
+func distanceToSegment(x1 float64, y1 float64, x2 float64, y2 float64) float64 {
+	dx := x2 - x1
+	dy := y2 - y1
+	t := 0.0
+	if lenSq := dx*dx + dy*dy; lenSq != 0 {
+		t = math.Max(0, math.Min(1, -(x1*dx+y1*dy)/lenSq))
+	}
+	return math.Hypot(x1+t*dx, y1+t*dy)
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
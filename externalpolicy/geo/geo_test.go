@@ -0,0 +1,112 @@
+// +build unit
+
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+// Locations are written as lat,lon with an optional accuracy.
+func Test_ParseLocation(t *testing.T) {
+
+	if loc, err := ParseLocation("41.0064, -111.9393"); err != nil {
+		t.Errorf("Error: unable to parse the location: %v", err)
+	} else if loc.Lat != 41.0064 || loc.Lon != -111.9393 || loc.AccuracyKM != 0 {
+		t.Errorf("Error: wrong location %v", loc)
+	} else if loc.String() != "41.0064,-111.9393" {
+		t.Errorf("Error: the location should be displayed as 41.0064,-111.9393, is %v", loc)
+	}
+
+	if loc, err := ParseLocation("-33.87,151.21,0.5"); err != nil {
+		t.Errorf("Error: unable to parse the location: %v", err)
+	} else if loc.AccuracyKM != 0.5 || loc.String() != "-33.87,151.21,0.5" {
+		t.Errorf("Error: wrong location %v", loc)
+	}
+
+	for _, s := range []string{"", "41.0", "41,-111,1,2", "north,west", "90.5,0", "0,-180.1", "41,-111,-1"} {
+		if loc, err := ParseLocation(s); err == nil {
+			t.Errorf("Error: %v should not be parsed, was parsed to %v", s, loc)
+		}
+	}
+}
+
+// Areas are written as they are in the text constraint language.
+func Test_ParseArea(t *testing.T) {
+
+	if c, err := ParseCircle("2.5 km of ( 41.0064 , -111.9393 )"); err != nil {
+		t.Errorf("Error: unable to parse the circle: %v", err)
+	} else if c.RadiusKM != 2.5 || c.Center.Lat != 41.0064 || c.Center.Lon != -111.9393 {
+		t.Errorf("Error: wrong circle %v", c)
+	} else if c.String() != "2.5km of (41.0064,-111.9393)" {
+		t.Errorf("Error: the circle should be displayed as 2.5km of (41.0064,-111.9393), is %v", c)
+	}
+
+	for _, s := range []string{"10 of (1,1)", "10km (1,1)", "-1km of (1,1)", "10km of (1,1),(2,2)", "10km of 1,1", "10km of (100,1)"} {
+		if c, err := ParseCircle(s); err == nil {
+			t.Errorf("Error: %v should not be parsed, was parsed to %v", s, c)
+		}
+	}
+
+	if p, err := ParsePolygon("[(1,1), (1,2),(2, 2)]"); err != nil {
+		t.Errorf("Error: unable to parse the polygon: %v", err)
+	} else if len(p) != 3 || p.String() != "[(1,1),(1,2),(2,2)]" {
+		t.Errorf("Error: wrong polygon %v", p)
+	}
+
+	for _, s := range []string{"[(1,1),(1,2)]", "(1,1),(1,2),(2,2)", "[(1,1)(1,2),(2,2)]", "[(1,1),(1,2),(2,2,3)]", "[(1,1),(1,2),(2,x)]"} {
+		if p, err := ParsePolygon(s); err == nil {
+			t.Errorf("Error: %v should not be parsed, was parsed to %v", s, p)
+		}
+	}
+}
+
+// The distance is the great circle distance.
+func Test_Distance(t *testing.T) {
+
+	// New York to London is about 5570 km
+	if d := Distance(Point{Lat: 40.7128, Lon: -74.0060}, Point{Lat: 51.5074, Lon: -0.1278}); math.Abs(d-5570) > 5 {
+		t.Errorf("Error: the distance from New York to London should be about 5570 km, is %v", d)
+	}
+
+	// 1 degree of latitude is about 111.2 km
+	if d := Distance(Point{Lat: 0, Lon: 179.5}, Point{Lat: 0, Lon: -179.5}); math.Abs(d-111.2) > 0.1 {
+		t.Errorf("Error: the distance across the 180th meridian should be about 111.2 km, is %v", d)
+	}
+}
+
+// The whole circle given by the accuracy of the location must be in the area.
+func Test_Contains(t *testing.T) {
+
+	circle := Circle{Center: Point{Lat: 40.7608, Lon: -111.8910}, RadiusKM: 10}
+	if !circle.Contains(Location{Point: Point{Lat: 40.8, Lon: -111.9}}) {
+		t.Errorf("Error: the location should be within %v", circle)
+	} else if circle.Contains(Location{Point: Point{Lat: 40.8, Lon: -111.9}, AccuracyKM: 6}) {
+		t.Errorf("Error: the location with a 6 km accuracy should not be within %v", circle)
+	} else if circle.Contains(Location{Point: Point{Lat: 41.2230, Lon: -111.9738}}) {
+		t.Errorf("Error: the location should not be within %v", circle)
+	}
+
+	square := Polygon{{Lat: 1, Lon: 1}, {Lat: 1, Lon: 2}, {Lat: 2, Lon: 2}, {Lat: 2, Lon: 1}}
+	if !square.Contains(Location{Point: Point{Lat: 1.5, Lon: 1.5}, AccuracyKM: 50}) {
+		t.Errorf("Error: the location should be inside %v", square)
+	} else if square.Contains(Location{Point: Point{Lat: 1.5, Lon: 1.5}, AccuracyKM: 60}) {
+		t.Errorf("Error: the location with a 60 km accuracy should not be inside %v", square)
+	} else if square.Contains(Location{Point: Point{Lat: 2.5, Lon: 1.5}}) {
+		t.Errorf("Error: the location should not be inside %v", square)
+	}
+
+	// a concave polygon
+	l := Polygon{{Lat: 0, Lon: 0}, {Lat: 2, Lon: 0}, {Lat: 2, Lon: 1}, {Lat: 1, Lon: 1}, {Lat: 1, Lon: 2}, {Lat: 0, Lon: 2}}
+	if !l.Contains(Location{Point: Point{Lat: 1.5, Lon: 0.5}}) || l.Contains(Location{Point: Point{Lat: 1.5, Lon: 1.5}}) {
+		t.Errorf("Error: wrong result for the concave polygon %v", l)
+	}
+
+	// a polygon across the 180th meridian
+	fiji := Polygon{{Lat: -16, Lon: 177}, {Lat: -16, Lon: -179}, {Lat: -19, Lon: -179}, {Lat: -19, Lon: 177}}
+	if !fiji.Contains(Location{Point: Point{Lat: -17, Lon: 179.9}}) || !fiji.Contains(Location{Point: Point{Lat: -17, Lon: -179.5}}) {
+		t.Errorf("Error: the locations should be inside %v", fiji)
+	} else if fiji.Contains(Location{Point: Point{Lat: -17, Lon: 0}}) {
+		t.Errorf("Error: the location should not be inside %v", fiji)
+	}
+}
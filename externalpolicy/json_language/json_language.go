@@ -0,0 +1,566 @@
+package json_language
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/externalpolicy/datetime"
+	"github.com/open-horizon/anax/externalpolicy/plugin_registry"
+	"github.com/open-horizon/anax/externalpolicy/text_language"
+	"github.com/open-horizon/anax/i18n"
+	"github.com/open-horizon/anax/semanticversion"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The json constraint language writes a constraint as an expression tree, which is easier to generate than the text
+// language. For example, the text constraint:
+//   location == "us" && (cpu >= 2 || gpu == true)
+// is written as:
+//   {"and": [
+//     {"property": "location", "op": "==", "value": "us"},
+//     {"or": [{"property": "cpu", "op": ">=", "value": 2}, {"property": "gpu", "op": "==", "value": true}]}
+//   ]}
+//
+// A constraint in the json language is always equivalent to a constraint in the text language, the plugin converts it
+// to the text language and lets the text language plugin parse it. The NOT operator, which the text language does not
+// have, is removed by negating the comparisons under it. A comparison is false when the property is not defined, so its
+// negation is true when the property is not defined, e.g. {"not": {"property": "gpu", "value": true}} is written as
+//   gpu != true || gpu not exists
+
+func init() {
+	plugin_registry.Register("json", NewJSONConstraintLanguagePlugin())
+}
+
+// The types of values in a comparison, they are the same as the property types.
+const (
+	STRING_TYPE   = "string"
+	VERSION_TYPE  = "version"
+	BOOLEAN_TYPE  = "boolean"
+	INTEGER_TYPE  = "int"
+	FLOAT_TYPE    = "float"
+	LIST_TYPE     = "list of strings"
+	GEO_TYPE      = "geo"
+	DATETIME_TYPE = "datetime"
+	DURATION_TYPE = "duration"
+)
+
+// A node of the expression tree. A node is either a control operator (exactly one of And, Or or Not) or a comparison
+// of a property with a value. The type of the value is taken from its JSON type when Type is not set. A string value is
+// a string unless Type is version, datetime or duration, a list of strings is a JSON array of strings.
+type ConstraintNode struct {
+	And      []ConstraintNode `json:"and,omitempty"`
+	Or       []ConstraintNode `json:"or,omitempty"`
+	Not      *ConstraintNode  `json:"not,omitempty"`
+	Property string           `json:"property,omitempty"`
+	Op       string           `json:"op,omitempty"`
+	Value    interface{}      `json:"value,omitempty"`
+	Type     string           `json:"type,omitempty"`
+}
+
+func (n ConstraintNode) String() string {
+	if b, err := json.Marshal(n); err == nil {
+		return string(b)
+	}
+	return fmt.Sprintf("And: %v, Or: %v, Not: %v, Property: %v, Op: %v, Value: %v, Type: %v", n.And, n.Or, n.Not, n.Property, n.Op, n.Value, n.Type)
+}
+
+// Returns true if the constraint is written in the json language.
+func IsJSONConstraint(constraint string) bool {
+	return strings.HasPrefix(strings.TrimSpace(constraint), "{")
+}
+
+// Parse a constraint written in the json language.
+func ParseConstraint(constraint string) (*ConstraintNode, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	node := new(ConstraintNode)
+	dec := json.NewDecoder(strings.NewReader(constraint))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	if err := dec.Decode(node); err != nil {
+		return nil, errors.New(msgPrinter.Sprintf("The constraint %v is not a valid JSON expression tree: %v", constraint, err))
+	} else if dec.More() {
+		return nil, errors.New(msgPrinter.Sprintf("The constraint %v is not a valid JSON expression tree: it contains more than 1 JSON object", constraint))
+	}
+	return node, nil
+}
+
+// Convert a constraint written in the json language to the text language.
+func ConstraintToText(constraint string) (string, error) {
+	if node, err := ParseConstraint(constraint); err != nil {
+		return "", err
+	} else {
+		return node.ToText()
+	}
+}
+
+// Convert a constraint written in the text language to the json language. The result is the compact JSON text of the
+// expression tree.
+func ConstraintFromText(constraint string) (string, error) {
+	node, err := NodeFromText(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(node); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Convert the expression tree to the text language.
+func (n ConstraintNode) ToText() (string, error) {
+	return n.toText(false, false)
+}
+
+// Build the text of a node. The negate flag is set when the node is under an odd number of NOT operators, the comparisons
+// are negated and AND and OR are swapped. An OR under an AND needs parentheses.
+func (n ConstraintNode) toText(negate bool, inAnd bool) (string, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	set := 0
+	for _, isSet := range []bool{n.And != nil, n.Or != nil, n.Not != nil, n.Property != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return "", errors.New(msgPrinter.Sprintf("The constraint node %v must have exactly one of and, or, not or property.", n))
+	}
+
+	if n.Not != nil {
+		return n.Not.toText(!negate, inAnd)
+	} else if n.Property != "" {
+		return n.comparisonText(negate, inAnd)
+	}
+
+	terms := n.And
+	isAnd := true
+	if n.Or != nil {
+		terms = n.Or
+		isAnd = false
+	}
+	if len(terms) == 0 {
+		return "", errors.New(msgPrinter.Sprintf("The constraint node %v must have at least 1 term.", n))
+	}
+
+	// De Morgan's laws, the negation of an AND is the OR of the negated terms.
+	if negate {
+		isAnd = !isAnd
+	}
+
+	texts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if text, err := term.toText(negate, isAnd); err != nil {
+			return "", err
+		} else {
+			texts = append(texts, text)
+		}
+	}
+
+	if len(texts) == 1 {
+		return texts[0], nil
+	} else if isAnd {
+		return strings.Join(texts, " && "), nil
+	} else if inAnd {
+		return "(" + strings.Join(texts, " || ") + ")", nil
+	}
+	return strings.Join(texts, " || "), nil
+}
+
+// Build the text of a comparison. A negated comparison is also satisfied when the property is not defined, it becomes an
+// OR with the not exists operator, which needs parentheses under an AND.
+func (n ConstraintNode) comparisonText(negate bool, inAnd bool) (string, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if n.And != nil || n.Or != nil || n.Not != nil {
+		return "", errors.New(msgPrinter.Sprintf("The constraint node %v must have exactly one of and, or, not or property.", n))
+	} else if strings.ContainsAny(n.Property, " \t\n\r\"") {
+		return "", errors.New(msgPrinter.Sprintf("The property name %v in the constraint node %v cannot contain spaces or quotes.", n.Property, n))
+	}
+
+	op := n.Op
+	if op == "" || op == "=" {
+		op = "=="
+	}
+	if negate {
+		switch op {
+		case "==":
+			op = "!="
+		case "!=":
+			op = "=="
+		case "<":
+			op = ">="
+		case ">=":
+			op = "<"
+		case ">":
+			op = "<="
+		case "<=":
+			op = ">"
+		case "exists":
+			op = "not exists"
+		case "not exists":
+			op = "exists"
+		default:
+			return "", errors.New(msgPrinter.Sprintf("The operator %v cannot be negated in the constraint node %v.", op, n))
+		}
+	}
+
+	// The exists operators do not have a value.
+	if op == "exists" || op == "not exists" {
+		if n.Value != nil || n.Type != "" {
+			return "", errors.New(msgPrinter.Sprintf("The operator %v in the constraint node %v does not have a value.", op, n))
+		}
+		return fmt.Sprintf("%v %v", n.Property, op), nil
+	}
+
+	value, err := n.valueText()
+	if err != nil {
+		return "", err
+	}
+
+	switch op {
+	case "==", "!=":
+	case "<", ">", "<=", ">=":
+		if _, err := strconv.ParseFloat(value, 64); err != nil && !n.isTime() {
+			return "", errors.New(msgPrinter.Sprintf("The operator %v in the constraint node %v can only be used with a number, a datetime or a duration.", op, n))
+		}
+	case "in":
+		if !n.isList() && !n.isNumericRange() && n.Type != VERSION_TYPE {
+			return "", errors.New(msgPrinter.Sprintf("The operator in in the constraint node %v can only be used with a version range, a numeric range or a list of strings.", n))
+		}
+	case "matches", "startswith", "endswith", "contains", "iequals":
+		if _, ok := n.Value.(string); !ok || (n.Type != "" && n.Type != STRING_TYPE) {
+			return "", errors.New(msgPrinter.Sprintf("The operator %v in the constraint node %v can only be used with a string.", op, n))
+		}
+	case "within", "inside":
+		if !n.isGeoArea() || (n.Type != "" && n.Type != GEO_TYPE) {
+			return "", errors.New(msgPrinter.Sprintf("The operator %v in the constraint node %v can only be used with a geographic area written as a string.", op, n))
+		}
+	default:
+		return "", errors.New(msgPrinter.Sprintf("The operator %v in the constraint node %v is not supported, supported operators are ==, !=, <, >, <=, >=, in, matches, startswith, endswith, contains, iequals, exists, not exists, within and inside.", op, n))
+	}
+	if n.isNumericRange() && op != "in" {
+		return "", errors.New(msgPrinter.Sprintf("A numeric range can only use the operator in, the constraint node is %v.", n))
+	}
+	if n.isList() && op != "in" {
+		return "", errors.New(msgPrinter.Sprintf("A list of strings can only use the operator in, the constraint node is %v.", n))
+	}
+
+	text := fmt.Sprintf("%v %v %v", n.Property, op, value)
+	if negate {
+		text = fmt.Sprintf("%v || %v not exists", text, n.Property)
+		if inAnd {
+			text = "(" + text + ")"
+		}
+	}
+	return text, nil
+}
+
+func (n ConstraintNode) isList() bool {
+	_, ok := n.Value.([]interface{})
+	return ok || n.Type == LIST_TYPE
+}
+
+// A numeric range is a string with the type int or float, e.g. [2,8).
+func (n ConstraintNode) isNumericRange() bool {
+	_, ok := n.Value.(string)
+	return ok && (n.Type == INTEGER_TYPE || n.Type == FLOAT_TYPE)
+}
+
+// A geographic area is a string compared with the operators within and inside, e.g. 10km of (41.0064,-111.9393).
+func (n ConstraintNode) isGeoArea() bool {
+	_, ok := n.Value.(string)
+	return ok && (n.Op == "within" || n.Op == "inside")
+}
+
+// A datetime or a duration is a string with the type datetime or duration, e.g. now+30d or 1h30m.
+func (n ConstraintNode) isTime() bool {
+	_, ok := n.Value.(string)
+	return ok && (n.Type == DATETIME_TYPE || n.Type == DURATION_TYPE)
+}
+
+// Build the text of the value of a comparison.
+func (n ConstraintNode) valueText() (string, error) {
+
+	// get message printer because this function is called by CLI
+	msgPrinter := i18n.GetMessagePrinter()
+
+	typeError := errors.New(msgPrinter.Sprintf("The value in the constraint node %v is not of type %v.", n, n.Type))
+
+	switch v := n.Value.(type) {
+	case bool:
+		if n.Type != "" && n.Type != BOOLEAN_TYPE {
+			return "", typeError
+		}
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		if n.Type != "" && n.Type != INTEGER_TYPE && n.Type != FLOAT_TYPE {
+			return "", typeError
+		} else if _, err := v.Int64(); err != nil && n.Type == INTEGER_TYPE {
+			return "", typeError
+		}
+		return v.String(), nil
+	case float64:
+		if n.Type != "" && n.Type != INTEGER_TYPE && n.Type != FLOAT_TYPE {
+			return "", typeError
+		} else if n.Type == INTEGER_TYPE && float64(int64(v)) != v {
+			return "", typeError
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case string:
+		if n.Type == VERSION_TYPE || n.isNumericRange() || n.isGeoArea() {
+			return strings.TrimSpace(v), nil
+		} else if n.Type == DATETIME_TYPE {
+			if _, err := datetime.ParseDateTimeExpression(v, time.Now()); err != nil {
+				return "", errors.New(msgPrinter.Sprintf("The value in the constraint node %v is not valid: %v", n, err))
+			}
+			return strings.TrimSpace(v), nil
+		} else if n.Type == DURATION_TYPE {
+			if _, err := datetime.ParseDuration(v); err != nil {
+				return "", errors.New(msgPrinter.Sprintf("The value in the constraint node %v is not valid: %v", n, err))
+			}
+			return strings.TrimSpace(v), nil
+		} else if n.Type != "" && n.Type != STRING_TYPE {
+			return "", typeError
+		} else if v == "" || strings.Contains(v, "\"") {
+			return "", errors.New(msgPrinter.Sprintf("The string value in the constraint node %v cannot be empty or contain quotes.", n))
+		}
+		return "\"" + v + "\"", nil
+	case []interface{}:
+		if n.Type != "" && n.Type != LIST_TYPE {
+			return "", typeError
+		}
+		strs := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); !ok || s == "" || strings.ContainsAny(s, ",\"") {
+				return "", errors.New(msgPrinter.Sprintf("The list in the constraint node %v must only contain strings, which cannot be empty or contain commas or quotes.", n))
+			} else {
+				strs = append(strs, s)
+			}
+		}
+		if len(strs) == 0 {
+			return "", errors.New(msgPrinter.Sprintf("The list in the constraint node %v cannot be empty.", n))
+		}
+		return "\"" + strings.Join(strs, ",") + "\"", nil
+	case nil:
+		return "", errors.New(msgPrinter.Sprintf("The constraint node %v does not have a value.", n))
+	}
+	return "", errors.New(msgPrinter.Sprintf("The value in the constraint node %v is type %T, it must be a string, number, boolean or list of strings.", n, n.Value))
+}
+
+// Convert a constraint written in the text language to an expression tree. The text is parsed by the text language
+// plugin, AND has a higher precedence than OR.
+func NodeFromText(constraint string) (*ConstraintNode, error) {
+	text := text_language.NewTextConstraintLanguagePlugin()
+	if _, _, err := text.Validate([]string{constraint}); err != nil {
+		return nil, err
+	}
+
+	node, _, err := parseText(strings.Replace(constraint, "\a", " ", -1), text)
+	return node, err
+}
+
+// Parse a text expression up to the end of the expression or the closing parenthesis. This function is called recursively
+// to handle parenthetical expressions.
+func parseText(constraint string, text plugin_registry.ConstraintLanguagePlugin) (*ConstraintNode, string, error) {
+	andArray := make([]ConstraintNode, 0)
+	orArray := make([]ConstraintNode, 0)
+
+	var err error
+	var nextProp string
+	var ctrlOp string
+	var subExpr *ConstraintNode
+
+	for err == nil {
+		nextProp, constraint, err = text.GetNextExpression(constraint)
+		if err != nil {
+			return nil, constraint, err
+		}
+		if strings.TrimSpace(nextProp) != "" {
+			prop := strings.Split(nextProp, "\a")
+			andArray = append(andArray, comparisonFromText(strings.TrimSpace(prop[0]), strings.TrimSpace(prop[1]), strings.TrimSpace(prop[2])))
+		}
+
+		ctrlOp, constraint, err = text.GetNextOperator(constraint)
+		if err != nil {
+			return nil, constraint, err
+		}
+
+		if ctrlOp == "(" {
+			subExpr, constraint, err = parseText(constraint, text)
+			if err != nil {
+				return nil, constraint, err
+			}
+
+			andArray = append(andArray, *subExpr)
+
+			ctrlOp, constraint, err = text.GetNextOperator(constraint)
+			if err != nil {
+				return nil, constraint, err
+			}
+		}
+		if ctrlOp == "||" || ctrlOp == "OR" {
+			orArray = append(orArray, newControlNode(andArray, true))
+			andArray = make([]ConstraintNode, 0)
+		} else if ctrlOp == ")" || ctrlOp == "" {
+			orArray = append(orArray, newControlNode(andArray, true))
+			node := newControlNode(orArray, false)
+			return &node, constraint, nil
+		}
+	}
+
+	return nil, constraint, err
+}
+
+// Combine the terms with AND or OR, a single term is returned as is.
+func newControlNode(terms []ConstraintNode, and bool) ConstraintNode {
+	if len(terms) == 1 {
+		return terms[0]
+	} else if and {
+		return ConstraintNode{And: terms}
+	}
+	return ConstraintNode{Or: terms}
+}
+
+// Build a comparison from the text language. The type of the value is the type that the text language gives it, a quoted
+// string is a string, or a list of strings with the in operator. An unquoted value is a number, a boolean, a datetime, a
+// duration, a version or a string, in that order, or a numeric range or a version range with the in operator. A datetime
+// relative to now is only a datetime with a comparison operator, x == now compares strings. The operators that match the
+// text of a string always have a string value, the geographic operators have the area as a string value.
+func comparisonFromText(name string, op string, value string) ConstraintNode {
+	if op == "=" {
+		op = "=="
+	}
+	n := ConstraintNode{Property: name, Op: op}
+
+	if op == "exists" || op == "not exists" {
+		return n
+	} else if op == "within" || op == "inside" {
+		n.Value = value
+		return n
+	} else if op == "matches" || op == "startswith" || op == "endswith" || op == "contains" || op == "iequals" {
+		if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+			value = value[1 : len(value)-1]
+		}
+		n.Value = value
+		return n
+	}
+
+	if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+		value = value[1 : len(value)-1]
+		if op == "in" {
+			list := make([]interface{}, 0)
+			for _, s := range strings.Split(value, ",") {
+				list = append(list, strings.TrimSpace(s))
+			}
+			n.Value = list
+		} else {
+			n.Value = value
+		}
+	} else if _, err := strconv.ParseFloat(value, 64); err == nil && op != "in" {
+		n.Value = json.Number(value)
+	} else if value == "true" || value == "false" {
+		n.Value = (value == "true")
+	} else if _, err := datetime.ParseDateTime(value); err == nil && op != "in" {
+		n.Value = value
+		n.Type = DATETIME_TYPE
+	} else if _, err := datetime.ParseDuration(value); err == nil && op != "in" {
+		n.Value = value
+		n.Type = DURATION_TYPE
+	} else if datetime.IsNowExpression(value) && (op == "<" || op == ">" || op == "<=" || op == ">=") {
+		n.Value = value
+		n.Type = DATETIME_TYPE
+	} else if op == "in" && isNumericRange(value) {
+		n.Value = value
+		n.Type = FLOAT_TYPE
+	} else if semanticversion.IsVersionString(value) || op == "in" {
+		n.Value = value
+		n.Type = VERSION_TYPE
+	} else {
+		n.Value = value
+	}
+	return n
+}
+
+// Returns true if the value is a numeric range, the bounds of a version range are not numbers.
+func isNumericRange(value string) bool {
+	if !strings.HasPrefix(value, "[") && !strings.HasPrefix(value, "(") {
+		return false
+	}
+	bounds := strings.Split(strings.Trim(value, "[]()"), ",")
+	_, err := strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64)
+	return len(bounds) == 2 && err == nil
+}
+
+type JSONConstraintLanguagePlugin struct {
+	text plugin_registry.ConstraintLanguagePlugin
+}
+
+func NewJSONConstraintLanguagePlugin() plugin_registry.ConstraintLanguagePlugin {
+	return &JSONConstraintLanguagePlugin{text: text_language.NewTextConstraintLanguagePlugin()}
+}
+
+// The plugin owns the constraints if all of them are written in the json language. The constraints are validated by
+// converting them to the text language, the returned constraints are the text constraints.
+func (p *JSONConstraintLanguagePlugin) Validate(dconstraints interface{}) (bool, []string, error) {
+
+	constraints, ok := dconstraints.([]string)
+	if !ok || len(constraints) == 0 {
+		return false, []string{}, nil
+	}
+	for _, constraint := range constraints {
+		if !IsJSONConstraint(constraint) {
+			return false, []string{}, nil
+		}
+	}
+
+	textConstraints := make([]string, 0, len(constraints))
+	for _, constraint := range constraints {
+		textConstraint, err := ConstraintToText(constraint)
+		if err != nil {
+			return true, nil, err
+		}
+		if _, _, err := p.text.Validate([]string{textConstraint}); err != nil {
+			return true, nil, fmt.Errorf("Error validating the constraint %v, which is %v in the text language. Error was: %v", constraint, textConstraint, err)
+		}
+		textConstraints = append(textConstraints, textConstraint)
+	}
+
+	return true, textConstraints, nil
+}
+
+// The expression is converted to the text language the first time, the remainders are text.
+func (p *JSONConstraintLanguagePlugin) GetNextExpression(expression string) (string, string, error) {
+	if IsJSONConstraint(expression) {
+		textExpression, err := ConstraintToText(expression)
+		if err != nil {
+			return "", expression, err
+		}
+		expression = textExpression
+	}
+	return p.text.GetNextExpression(expression)
+}
+
+func (p *JSONConstraintLanguagePlugin) GetNextOperator(expression string) (string, string, error) {
+	if IsJSONConstraint(expression) {
+		textExpression, err := ConstraintToText(expression)
+		if err != nil {
+			return "", expression, err
+		}
+		expression = textExpression
+	}
+	return p.text.GetNextOperator(expression)
+}
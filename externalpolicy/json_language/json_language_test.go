@@ -0,0 +1,169 @@
+// +build unit
+
+package json_language
+
+import (
+	"testing"
+)
+
+// Expression trees are converted to the text language.
+func Test_ConstraintToText(t *testing.T) {
+
+	tests := []struct {
+		constraint string
+		text       string
+	}{
+		{`{"property": "hello", "op": "==", "value": "world"}`, `hello == "world"`},
+		{`{"property": "cpu", "op": ">=", "value": 2}`, `cpu >= 2`},
+		{`{"property": "memory", "op": "<", "value": 1.5, "type": "float"}`, `memory < 1.5`},
+		{`{"property": "gpu", "value": true}`, `gpu == true`},
+		{`{"property": "version", "op": "in", "value": "[1.0.0,2.0.0)", "type": "version"}`, `version in [1.0.0,2.0.0)`},
+		{`{"property": "location", "op": "in", "value": ["us", "eu"]}`, `location in "us,eu"`},
+		{`{"and": [{"property": "a", "value": 1}, {"or": [{"property": "b", "value": 2}, {"property": "c", "value": 3}]}]}`, `a == 1 && (b == 2 || c == 3)`},
+		{`{"or": [{"and": [{"property": "a", "value": 1}, {"property": "b", "value": 2}]}, {"property": "c", "value": 3}]}`, `a == 1 && b == 2 || c == 3`},
+		{`{"and": [{"property": "a", "value": 1}]}`, `a == 1`},
+		{`{"not": {"property": "a", "op": "<", "value": 1}}`, `a >= 1 || a not exists`},
+		{`{"not": {"and": [{"property": "a", "value": 1}, {"property": "b", "op": "!=", "value": "x"}]}}`, `a != 1 || a not exists || b == "x" || b not exists`},
+		{`{"and": [{"property": "c", "value": 3}, {"not": {"and": [{"property": "a", "value": 1}, {"property": "b", "value": 2}]}}]}`, `c == 3 && (a != 1 || a not exists || b != 2 || b not exists)`},
+		{`{"not": {"not": {"property": "a", "op": ">", "value": 1}}}`, `a > 1`},
+		{`{"property": "arch", "op": "matches", "value": "^arm(64)?$"}`, `arch matches "^arm(64)?$"`},
+		{`{"property": "hostname", "op": "startswith", "value": "edge-"}`, `hostname startswith "edge-"`},
+		{`{"property": "location", "op": "iequals", "value": "US", "type": "string"}`, `location iequals "US"`},
+		{`{"and": [{"property": "gpu", "op": "exists"}, {"not": {"property": "tpu", "op": "exists"}}]}`, `gpu exists && tpu not exists`},
+		{`{"and": [{"property": "c", "value": 3}, {"not": {"property": "a", "value": 1}}]}`, `c == 3 && (a != 1 || a not exists)`},
+		{`{"property": "cpu", "op": "in", "value": "[2,8)", "type": "int"}`, `cpu in [2,8)`},
+		{`{"property": "location", "op": "within", "value": "10km of (41.0064,-111.9393)", "type": "geo"}`, `location within 10km of (41.0064,-111.9393)`},
+		{`{"property": "location", "op": "inside", "value": "[(1,1),(1,2),(2,2)]"}`, `location inside [(1,1),(1,2),(2,2)]`},
+		{`{"property": "certExpiry", "op": ">", "value": "now+30d", "type": "datetime"}`, `certExpiry > now+30d`},
+		{`{"not": {"property": "installedAt", "op": ">=", "value": "2026-01-01", "type": "datetime"}}`, `installedAt < 2026-01-01 || installedAt not exists`},
+		{`{"property": "uptime", "op": "!=", "value": "1h30m", "type": "duration"}`, `uptime != 1h30m`},
+	}
+
+	for _, test := range tests {
+		if text, err := ConstraintToText(test.constraint); err != nil {
+			t.Errorf("Error: unable to convert %v: %v", test.constraint, err)
+		} else if text != test.text {
+			t.Errorf("Error: %v should be converted to %v, is %v", test.constraint, test.text, text)
+		}
+	}
+}
+
+// Invalid expression trees are rejected.
+func Test_ConstraintToText_invalid(t *testing.T) {
+
+	tests := []string{
+		`{"property": "a", "op": "==", "value": 1`,
+		`{"property": "a", "op": "==", "value": 1, "unknown": 2}`,
+		`{"property": "a", "op": "=="}`,
+		`{"property": "a", "op": "<", "value": "x"}`,
+		`{"property": "a", "op": "like", "value": "x"}`,
+		`{"property": "a", "op": "==", "value": ["x", "y"]}`,
+		`{"property": "a", "op": "in", "value": "x"}`,
+		`{"property": "a", "op": "in", "value": ["x,y"]}`,
+		`{"property": "a", "value": "x", "type": "boolean"}`,
+		`{"property": "a", "value": 1.5, "type": "int"}`,
+		`{"property": "a b", "value": 1}`,
+		`{"property": "a", "value": "say \"hi\""}`,
+		`{"and": []}`,
+		`{"and": [{"property": "a", "value": 1}], "property": "b", "value": 2}`,
+		`{"not": {"property": "a", "op": "in", "value": ["x"]}}`,
+		`{"not": {"property": "a", "op": "contains", "value": "x"}}`,
+		`{"property": "a", "op": "contains", "value": 1}`,
+		`{"property": "a", "op": "exists", "value": true}`,
+		`{"property": "a", "op": "==", "value": "[2,8)", "type": "int"}`,
+		`{"property": "a", "op": "within", "value": 10}`,
+		`{"property": "a", "op": "inside", "value": "[(1,1),(1,2),(2,2)]", "type": "string"}`,
+		`{"not": {"property": "a", "op": "within", "value": "10km of (1,1)"}}`,
+		`{"property": "a", "op": ">", "value": "now+30d"}`,
+		`{"property": "a", "op": ">", "value": "now+30", "type": "datetime"}`,
+		`{"property": "a", "op": "<", "value": "2026-13-01", "type": "datetime"}`,
+		`{"property": "a", "op": "<", "value": "30", "type": "duration"}`,
+		`{"property": "a", "op": "in", "value": "1h", "type": "duration"}`,
+		`{}`,
+	}
+
+	for _, test := range tests {
+		if text, err := ConstraintToText(test); err == nil {
+			t.Errorf("Error: %v should not be converted, was converted to %v", test, text)
+		}
+	}
+}
+
+// Text constraints are converted to expression trees and back.
+func Test_ConstraintFromText(t *testing.T) {
+
+	tests := []struct {
+		text       string
+		constraint string
+		roundTrip  string
+	}{
+		{`hello == "world"`, `{"property":"hello","op":"==","value":"world"}`, `hello == "world"`},
+		{`cert = USDA`, `{"property":"cert","op":"==","value":"USDA"}`, `cert == "USDA"`},
+		{`cpu >= 2 && gpu == true`, `{"and":[{"property":"cpu","op":">=","value":2},{"property":"gpu","op":"==","value":true}]}`, `cpu >= 2 && gpu == true`},
+		{`version in [1.0.0,INFINITY) OR version == 0.9.0`, `{"or":[{"property":"version","op":"in","value":"[1.0.0,INFINITY)","type":"version"},{"property":"version","op":"==","value":"0.9.0","type":"version"}]}`, `version in [1.0.0,INFINITY) || version == 0.9.0`},
+		{`arch matches "^arm(64)?$" && gpu exists`, `{"and":[{"property":"arch","op":"matches","value":"^arm(64)?$"},{"property":"gpu","op":"exists"}]}`, `arch matches "^arm(64)?$" && gpu exists`},
+		{`hostname contains 12 || cpu in (2, 8]`, `{"or":[{"property":"hostname","op":"contains","value":"12"},{"property":"cpu","op":"in","value":"(2, 8]","type":"float"}]}`, `hostname contains "12" || cpu in (2, 8]`},
+		{`location within 10 km of (1.5,-2) || location inside [(1,1),(1,2),(2,2)]`, `{"or":[{"property":"location","op":"within","value":"10 km of (1.5,-2)"},{"property":"location","op":"inside","value":"[(1,1),(1,2),(2,2)]"}]}`, `location within 10 km of (1.5,-2) || location inside [(1,1),(1,2),(2,2)]`},
+		{`certExpiry > now+30d && installedAt == 2026-01-01T10:30:00Z || uptime <= 1h30m`, `{"or":[{"and":[{"property":"certExpiry","op":">","value":"now+30d","type":"datetime"},{"property":"installedAt","op":"==","value":"2026-01-01T10:30:00Z","type":"datetime"}]},{"property":"uptime","op":"<=","value":"1h30m","type":"duration"}]}`, `certExpiry > now+30d && installedAt == 2026-01-01T10:30:00Z || uptime <= 1h30m`},
+		{`status == now`, `{"property":"status","op":"==","value":"now"}`, `status == "now"`},
+		{`location in "us,eu" && (a == 1 || b < 2.5)`, `{"and":[{"property":"location","op":"in","value":["us","eu"]},{"or":[{"property":"a","op":"==","value":1},{"property":"b","op":"<","value":2.5}]}]}`, `location in "us,eu" && (a == 1 || b < 2.5)`},
+	}
+
+	for _, test := range tests {
+		if constraint, err := ConstraintFromText(test.text); err != nil {
+			t.Errorf("Error: unable to convert %v: %v", test.text, err)
+		} else if constraint != test.constraint {
+			t.Errorf("Error: %v should be converted to %v, is %v", test.text, test.constraint, constraint)
+		} else if text, err := ConstraintToText(constraint); err != nil {
+			t.Errorf("Error: unable to convert %v back: %v", constraint, err)
+		} else if text != test.roundTrip {
+			t.Errorf("Error: %v should be converted back to %v, is %v", constraint, test.roundTrip, text)
+		}
+	}
+
+	if constraint, err := ConstraintFromText("a == "); err == nil {
+		t.Errorf("Error: an invalid text constraint should not be converted, was converted to %v", constraint)
+	}
+}
+
+// The plugin only owns constraints written in the json language.
+func Test_Validate(t *testing.T) {
+
+	p := NewJSONConstraintLanguagePlugin()
+
+	if owned, _, _ := p.Validate([]string{`a == 1`}); owned {
+		t.Errorf("Error: the plugin should not own a text constraint")
+	} else if owned, _, _ := p.Validate([]string{`{"property": "a", "value": 1}`, `a == 1`}); owned {
+		t.Errorf("Error: the plugin should not own a mix of json and text constraints")
+	} else if owned, _, _ := p.Validate([]string{}); owned {
+		t.Errorf("Error: the plugin should not own an empty list of constraints")
+	} else if owned, _, _ := p.Validate("a == 1"); owned {
+		t.Errorf("Error: the plugin should not own a string")
+	}
+
+	if owned, constraints, err := p.Validate([]string{`{"property": "a", "value": 1}`, `{"or": [{"property": "b", "value": "x"}, {"property": "c", "op": ">", "value": 2}]}`}); !owned || err != nil {
+		t.Errorf("Error: the plugin should own and validate the constraints, owned: %v, error: %v", owned, err)
+	} else if len(constraints) != 2 || constraints[0] != `a == 1` || constraints[1] != `b == "x" || c > 2` {
+		t.Errorf("Error: the validated constraints should be in the text language: %v", constraints)
+	}
+
+	if owned, _, err := p.Validate([]string{`{"property": "a", "op": "in", "value": "1.0", "type": "version"}`}); !owned || err == nil {
+		t.Errorf("Error: the plugin should own and reject the invalid version, owned: %v, error: %v", owned, err)
+	}
+}
+
+// The plugin parses the expression tree with the text language.
+func Test_GetNextExpression(t *testing.T) {
+
+	p := NewJSONConstraintLanguagePlugin()
+
+	if exp, remainder, err := p.GetNextExpression(`{"and": [{"property": "a", "value": 1}, {"property": "b", "value": "x"}]}`); err != nil {
+		t.Errorf("Error: unable to get the next expression: %v", err)
+	} else if exp != "a\a==\a1" {
+		t.Errorf("Error: the next expression should be a == 1, is %v", exp)
+	} else if op, remainder, err := p.GetNextOperator(remainder); err != nil || op != "&&" {
+		t.Errorf("Error: the next operator should be &&, is %v, error: %v", op, err)
+	} else if exp, _, err := p.GetNextExpression(remainder); err != nil || exp != "b\a==\a\"x\"" {
+		t.Errorf("Error: the next expression should be b == \"x\", is %v, error: %v", exp, err)
+	}
+}
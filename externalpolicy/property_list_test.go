@@ -176,6 +176,18 @@ func Test_Validate_valid(t *testing.T) {
 			t.Errorf("Error: %v has only valid properties but gave error: %v\n", p1, err)
 		}
 	}
+	p1 = `[{"name":"prop1","value":"41.0064,-111.9393","type":"geo"},{"name":"prop2","value":"-33.87, 151.21, 0.5","type":"geo"}]`
+	if pl1 := create_PropertyList(p1, t); pl1 != nil {
+		if err := pl1.Validate(); err != nil {
+			t.Errorf("Error: %v has only valid properties but gave error: %v\n", p1, err)
+		}
+	}
+	p1 = `[{"name":"prop1","value":"2026-01-01T10:30:00Z","type":"datetime"},{"name":"prop2","value":"2026-01-01","type":"datetime"},{"name":"prop3","value":"1h30m","type":"duration"}]`
+	if pl1 := create_PropertyList(p1, t); pl1 != nil {
+		if err := pl1.Validate(); err != nil {
+			t.Errorf("Error: %v has only valid properties but gave error: %v\n", p1, err)
+		}
+	}
 	p1 = `[{"name":"prop1","value":[1,2]}]`
 	if pl1 := create_PropertyList(p1, t); pl1 != nil {
 		if err := pl1.Validate(); err == nil {
@@ -238,6 +250,36 @@ func Test_Validate_invalid(t *testing.T) {
 			t.Errorf("Error: %v has invalid properties but gave no error\n", p1)
 		}
 	}
+	p1 = `[{"name":"prop1","value":"91.5,10","type":"geo"}]`
+	if pl1 := create_PropertyList(p1, t); pl1 != nil {
+		if err := pl1.Validate(); err == nil {
+			t.Errorf("Error: %v has invalid properties but gave no error\n", p1)
+		}
+	}
+	p1 = `[{"name":"prop1","value":"41.0064,-111.9393,-1","type":"geo"}]`
+	if pl1 := create_PropertyList(p1, t); pl1 != nil {
+		if err := pl1.Validate(); err == nil {
+			t.Errorf("Error: %v has invalid properties but gave no error\n", p1)
+		}
+	}
+	p1 = `[{"name":"prop1","value":"now","type":"datetime"}]`
+	if pl1 := create_PropertyList(p1, t); pl1 != nil {
+		if err := pl1.Validate(); err == nil {
+			t.Errorf("Error: %v has invalid properties but gave no error\n", p1)
+		}
+	}
+	p1 = `[{"name":"prop1","value":"2026-02-30","type":"datetime"}]`
+	if pl1 := create_PropertyList(p1, t); pl1 != nil {
+		if err := pl1.Validate(); err == nil {
+			t.Errorf("Error: %v has invalid properties but gave no error\n", p1)
+		}
+	}
+	p1 = `[{"name":"prop1","value":"30","type":"duration"}]`
+	if pl1 := create_PropertyList(p1, t); pl1 != nil {
+		if err := pl1.Validate(); err == nil {
+			t.Errorf("Error: %v has invalid properties but gave no error\n", p1)
+		}
+	}
 }
 
 func Test_add_property(t *testing.T) {
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"github.com/alecthomas/participle/lexer"
 	"github.com/alecthomas/participle/lexer/ebnf"
+	"github.com/open-horizon/anax/externalpolicy/datetime"
+	"github.com/open-horizon/anax/externalpolicy/geo"
 	"github.com/open-horizon/anax/externalpolicy/plugin_registry"
 	"github.com/open-horizon/anax/i18n"
 	"github.com/open-horizon/anax/semanticversion"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -37,8 +40,15 @@ func (p *TextConstraintLanguagePlugin) Validate(dconstraints interface{}) (bool,
 		return false, []string{}, errors.New(msgPrinter.Sprintf("The constraint expression: %v is type %T, but is expected to be an array of strings", dconstraints, dconstraints))
 	}
 
-	// Validate that the expression is syntactically correct and parse-able
+	// A constraint that starts with { is not in the text language, it is left to the other plugins.
 	constraints = dconstraints.([]string)
+	for _, constraint = range constraints {
+		if strings.HasPrefix(strings.TrimSpace(constraint), "{") {
+			return false, []string{}, nil
+		}
+	}
+
+	// Validate that the expression is syntactically correct and parse-able
 	validConstraints := make([]string, 0, 2)
 
 	for _, constraint = range constraints {
@@ -114,7 +124,7 @@ func (p *TextConstraintLanguagePlugin) GetNextExpression(expression string) (str
 		}
 
 		nextRune = nextToken.Type
-		if nextRune != def["OpEq"] && nextRune != def["OpComp"] && nextRune != def["OpIn"] {
+		if nextRune != def["OpEq"] && nextRune != def["OpComp"] && nextRune != def["OpIn"] && nextRune != def["OpStr"] && nextRune != def["OpExists"] && nextRune != def["OpGeo"] {
 			if len(name) > 3 && name[len(name)-2:] == "in" {
 				op = "in"
 				opType = def["in"]
@@ -128,6 +138,16 @@ func (p *TextConstraintLanguagePlugin) GetNextExpression(expression string) (str
 		if op == "" {
 			op = nextToken.Value
 			opType = nextRune
+
+			// The exists operators do not have a value, this case consumes the name and the operator.
+			if opType == def["OpExists"] {
+				existsOp := "exists"
+				if strings.HasPrefix(strings.TrimSpace(op), "not") {
+					existsOp = "not exists"
+				}
+				return fmt.Sprintf("%v\a%v\a", name, existsOp), strings.Replace(expression, fmt.Sprintf("%v%v", name, op), "", 1), nil
+			}
+
 			nextToken, err = lex.Next()
 			if err != nil {
 				return "", expression, fmt.Errorf("Unrecognized token found: %v", err)
@@ -135,7 +155,7 @@ func (p *TextConstraintLanguagePlugin) GetNextExpression(expression string) (str
 			nextRune = nextToken.Type
 		}
 
-		if nextRune != def["Str"] && nextRune != def["InStr"] && nextRune != def["QuoteStr"] && nextRune != def["ListStr"] && nextRune != def["Vers"] && nextRune != def["VersRange"] && nextRune != def["Num"] {
+		if nextRune != def["Str"] && nextRune != def["InStr"] && nextRune != def["QuoteStr"] && nextRune != def["ListStr"] && nextRune != def["AnyStr"] && nextRune != def["Vers"] && nextRune != def["VersRange"] && nextRune != def["NumRange"] && nextRune != def["GeoCircle"] && nextRune != def["GeoPolygon"] && nextRune != def["DateTime"] && nextRune != def["Duration"] && nextRune != def["Num"] {
 			return "", expression, fmt.Errorf("Invalid property value. %v%v%v", name, op, nextToken.Value)
 		}
 		if val == "" {
@@ -193,6 +213,11 @@ func (p *TextConstraintLanguagePlugin) GetNextOperator(expression string) (strin
 // 4. for string types, a quoted string, inside which is a list of comma separated strings provide acceptable values
 // 5. string values that contain spaces must be quoted
 // 6. for the version type, supported values are a single version or a range of versions in the semantic version format (the same as used for service verions). The == operator implies that the value is a single version. The 'in' operator treats the value as a version range. As with service versions, the version 1.0.0 when treated as a version range is equivalent to the explicit range [1.0.0,INFINITY).
+// 7. for numeric types, the 'in' operator also accepts a range of numbers in the same format as a version range, e.g. [2,8) or (0.5,INFINITY).
+// 8. for string types, the operators matches (a regular expression), startswith, endswith, contains and iequals (equal ignoring case) are supported. Their value can be a quoted string with any character except the quote, e.g. a regular expression.
+// 9. the exists and not exists operators do not have a value, they test whether the property is defined.
+// 10. for the geo type, the operator within takes a circle written as N km of (latitude,longitude) and the operator inside takes a polygon written as [(latitude,longitude),(latitude,longitude),(latitude,longitude)...].
+// 11. for the datetime and duration types, the operators ==, !=, <, >, <=, >= are supported. A datetime is written as 2026-01-01 or 2026-01-01T10:30:00Z, or relative to the time of the evaluation as now, now+30d or now-12h. A duration is written as 30d or 1h30m.
 
 // This function checks that the operator is valid for the specified value and validates version ranges with the semanticversion Factory function
 // Returns a property expression struct with numerical values as float64
@@ -200,6 +225,54 @@ func (p *TextConstraintLanguagePlugin) GetNextOperator(expression string) (strin
 func validOpValuePair(name string, op string, opType rune, val interface{}, valType rune, lexMap map[string]rune) error {
 	var err error
 
+	if lexMap["NumRange"] == valType {
+		if lexMap["OpIn"] != opType {
+			return fmt.Errorf("Numeric range can only use operator 'in'.")
+		} else if err = validNumericRange(val.(string)); err != nil {
+			return err
+		}
+	}
+	if lexMap["AnyStr"] == valType && lexMap["OpStr"] != opType {
+		return fmt.Errorf("Cannot use operator %s with value %v. A value with special characters can only use the operators matches, startswith, endswith, contains and iequals.", strings.TrimSpace(op), val)
+	}
+	if lexMap["OpGeo"] == opType {
+		if strings.TrimSpace(op) == "within" {
+			if lexMap["GeoCircle"] != valType {
+				return fmt.Errorf("The operator within can only be used with an area written as N km of (latitude,longitude), the value is %v.", strings.TrimSpace(val.(string)))
+			} else if _, err = geo.ParseCircle(val.(string)); err != nil {
+				return err
+			}
+		} else if lexMap["GeoPolygon"] != valType {
+			return fmt.Errorf("The operator inside can only be used with a polygon written as [(latitude,longitude),(latitude,longitude),(latitude,longitude)...], the value is %v.", strings.TrimSpace(val.(string)))
+		} else if _, err = geo.ParsePolygon(val.(string)); err != nil {
+			return err
+		}
+	} else if lexMap["GeoCircle"] == valType || lexMap["GeoPolygon"] == valType {
+		return fmt.Errorf("Cannot use operator %s with value %v. A geographic area can only use the operators within and inside.", strings.TrimSpace(op), strings.TrimSpace(val.(string)))
+	}
+	if lexMap["DateTime"] == valType {
+		if _, err = datetime.ParseDateTime(val.(string)); err != nil {
+			return err
+		}
+	} else if lexMap["Duration"] == valType {
+		if _, err = datetime.ParseDuration(val.(string)); err != nil {
+			return err
+		}
+	}
+	if lexMap["OpStr"] == opType {
+		if lexMap["VersRange"] == valType || lexMap["NumRange"] == valType || lexMap["DateTime"] == valType || lexMap["Duration"] == valType {
+			return fmt.Errorf("The operator %s can only be used with a string value.", strings.TrimSpace(op))
+		}
+		if strings.TrimSpace(op) == "matches" {
+			pattern := strings.TrimSpace(val.(string))
+			if len(pattern) >= 2 && strings.HasPrefix(pattern, "\"") && strings.HasSuffix(pattern, "\"") {
+				pattern = pattern[1 : len(pattern)-1]
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("Invalid regular expression %v: %v", pattern, err)
+			}
+		}
+	}
 	if lexMap["OpEq"] == opType {
 		if lexMap["VersRange"] == valType {
 			return fmt.Errorf("Version range can only use operator 'in'.")
@@ -209,13 +282,15 @@ func validOpValuePair(name string, op string, opType rune, val interface{}, valT
 		}
 	}
 	if lexMap["OpComp"] == opType {
-		if _, err := strconv.ParseFloat(val.(string), 64); err != nil {
+		if lexMap["DateTime"] == valType || lexMap["Duration"] == valType || datetime.IsNowExpression(val.(string)) {
+			return nil
+		} else if _, err := strconv.ParseFloat(val.(string), 64); err != nil {
 			return fmt.Errorf("Cannot use numerical comparison operator %s with value %v.", op, val)
 		}
 	}
 	if lexMap["OpIn"] == opType {
-		if lexMap["ListStr"] != valType && lexMap["QuoteStr"] != valType && lexMap["VersRange"] != valType && lexMap["Vers"] != valType {
-			return fmt.Errorf("The 'in' operator can only be used for types version and list of strings")
+		if lexMap["ListStr"] != valType && lexMap["QuoteStr"] != valType && lexMap["VersRange"] != valType && lexMap["Vers"] != valType && lexMap["NumRange"] != valType {
+			return fmt.Errorf("The 'in' operator can only be used for types version, list of strings and numeric ranges")
 		}
 		if lexMap["VersRange"] == valType {
 			// Using the factory function to validate version ranges
@@ -229,6 +304,26 @@ func validOpValuePair(name string, op string, opType rune, val interface{}, valT
 	return nil
 }
 
+// This function checks that the lower bound of a numeric range is not greater than the upper bound.
+func validNumericRange(val string) error {
+	bounds := strings.Split(strings.Trim(strings.TrimSpace(val), "[]()"), ",")
+	if len(bounds) != 2 {
+		return fmt.Errorf("Invalid numeric range %v.", val)
+	}
+	lower, err := strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64)
+	if err != nil {
+		return fmt.Errorf("Invalid numeric range %v: %v", val, err)
+	}
+	if upper := strings.TrimSpace(bounds[1]); upper != "INFINITY" {
+		if upperNum, err := strconv.ParseFloat(upper, 64); err != nil {
+			return fmt.Errorf("Invalid numeric range %v: %v", val, err)
+		} else if lower > upperNum {
+			return fmt.Errorf("Invalid numeric range %v, the lower bound is greater than the upper bound.", val)
+		}
+	}
+	return nil
+}
+
 func getLexer() lexer.Definition {
 	return lexer.Must(ebnf.New(`
 	  alphanumeric = digit | alpha .
@@ -243,10 +338,23 @@ func getLexer() lexer.Definition {
 	  OrOp = whitespace {whitespace} ("OR" | "||") whitespace {whitespace} .
 
 		OpComp =  {whitespace} ( ["="] (">" | "<") ["="] ) {whitespace} .
+	  OpGeo = whitespace {whitespace} ( "within" | "inside" ) whitespace {whitespace} .
 		OpIn =  {whitespace} "in" {whitespace} .
 	  OpEq =  {whitespace}  ( "!=" | "="["="] )  {whitespace} .
+	  OpStr = whitespace {whitespace} ( "matches" | "startswith" | "endswith" | "contains" | "iequals" ) whitespace {whitespace} .
+	  OpExists = whitespace {whitespace} ["not" whitespace {whitespace}] "exists" .
 
 	  VersRange = {whitespace}  ( "(" | "[" )  vers {whitespace}  "," {whitespace}  (vers | "INFINITY")  ("]" | ")").
+	  NumRange = {whitespace}  ( "(" | "[" ) {whitespace} num {whitespace}  "," {whitespace}  (num | "INFINITY") {whitespace} ("]" | ")") .
+	  num = ["-"] digit {digit} ["." {digit}] .
+	  GeoCircle = {whitespace} num {whitespace} "km" whitespace {whitespace} "of" {whitespace} point .
+	  GeoPolygon = {whitespace} "[" {whitespace} point {{whitespace} "," {whitespace} point} {whitespace} "]" .
+	  point = "(" {whitespace} num {whitespace} "," {whitespace} num {whitespace} ")" .
+	  DateTime = {whitespace} date ["T" digit digit ":" digit digit ":" digit digit ["." digit {digit}] ["Z" | ("+" | "-") digit digit ":" digit digit]] .
+	  date = digit digit digit digit "-" digit digit "-" digit digit .
+	  Duration = {whitespace} num unit {durpart} .
+	  durpart = digit {digit} ["." {digit}] unit .
+	  unit = "w" | "d" | "h" | "m" | "s" .
 		Vers = {whitespace}  vers .
 	  Num = {whitespace} ["-"] digit {digit} ["." {digit}] .
 	  whitespace = "\n" | "\r" | "\t" | " " .
@@ -257,6 +365,8 @@ func getLexer() lexer.Definition {
 	  Str =  {whitespace} (alphanumeric | "_" | "-" | "/" | "!" | "?" | "+" | "~" | "'" | ".") {alphanumeric | "_" | "-" | "/" | "!" | "?" | "+" | "~" | "'" | "."} .
 	  QuoteStr = {whitespace} "\x22" (alphanumeric  | "_" | "-" |  "/" | "!" | "?" | "+" | "~" | "." | "'" | " " | "\t") {alphanumeric | "_" | "-" |  "/" | "!" | "?" | "+" | "~" | "." | "'" | " " | "\t" } "\x22" .
 		ListStr = {whitespace} "\x22" (alphanumeric  | "_" | "-" |  "/" | "!" | "?" | "+" | "~" | "." | "'" | "," | " " | "\t") {alphanumeric | "_" | "-" |  "/" | "!" | "?" | "+" | "~" | "." | "'" | "," | " " | "\t" } "\x22" .
+	  AnyStr = {whitespace} "\x22" anychar {anychar} "\x22" .
+	  anychar = "\x20"…"\x7e"-"\x22" | "\t" .
 
 
 	  Unused = digit .`))
@@ -340,3 +340,179 @@ func Test_GetNextExpression_Succeed(t *testing.T) {
 	}
 
 }
+
+func Test_Validate_Succeed9(t *testing.T) {
+	// string operators, exists and numeric ranges
+	textConstraintLanguagePlugin := NewTextConstraintLanguagePlugin()
+	constraintStrings := []string{
+		"arch matches \"^(arm|arm64)$\" && hostname startswith edge-",
+		"hostname endswith \"-prod\" || hostname contains \"test lab\"",
+		"location iequals US",
+		"gpu exists AND tpu not exists",
+		"(gpu exists) || cpu in [2,8)",
+		"memory in (0.5, INFINITY) && version in [1.1.1,INFINITY)",
+		"contains == 1 && inventory exists",
+	}
+
+	for _, c := range constraintStrings {
+		if validated, _, err := textConstraintLanguagePlugin.Validate([]string{c}); !validated || err != nil {
+			t.Errorf("%v should validate successfully but not, err: %v", c, err)
+		}
+	}
+}
+
+func Test_Validate_Failed6(t *testing.T) {
+	// invalid regular expression, numeric range and special characters with the other operators
+	textConstraintLanguagePlugin := NewTextConstraintLanguagePlugin()
+	constraintStrings := map[string]string{
+		"arch matches \"(arm\"":          "Invalid regular expression (arm: error parsing regexp: missing closing ): `(arm`",
+		"cpu in [8,2)":                   "Invalid numeric range [8,2), the lower bound is greater than the upper bound.",
+		"cpu == [2,8)":                   "Numeric range can only use operator 'in'.",
+		"arch == \"^arm$\"":              "Cannot use operator == with value \"^arm$\". A value with special characters can only use the operators matches, startswith, endswith, contains and iequals.",
+		"version contains [1.0.0,2.0.0)": "The operator contains can only be used with a string value.",
+	}
+
+	for c, msg := range constraintStrings {
+		if validated, _, err := textConstraintLanguagePlugin.Validate([]string{c}); validated || err == nil {
+			t.Errorf("Validation of %v should fail but did not", c)
+		} else if err.Error() != "Error finding an expression in "+c+". Error was: "+msg {
+			t.Errorf("Error message: %v is not the expected error message", err)
+		}
+	}
+}
+
+func Test_GetNextExpression_Succeed2(t *testing.T) {
+	// the exists operators do not have a value
+	textConstraintLanguagePlugin := NewTextConstraintLanguagePlugin()
+	ce := "gpu exists AND tpu  not  exists || arch matches \"^arm(64)?$\""
+
+	expected := []string{"gpu\aexists\a", "AND", "tpu\anot exists\a", "||", "arch\amatches\a\"^arm(64)?$\"", ""}
+	found := []string{}
+	rem := ce
+	for rem != "" {
+		exp, r, err := textConstraintLanguagePlugin.GetNextExpression(rem)
+		if err != nil {
+			t.Errorf("Error parsing constraint expression %v with GetNextExpression: %v", ce, err)
+			return
+		}
+		op, r, err := textConstraintLanguagePlugin.GetNextOperator(r)
+		if err != nil {
+			t.Errorf("Error parsing constraint expression %v with GetNextOperator: %v", ce, err)
+			return
+		}
+		found = append(found, exp, op)
+		rem = r
+	}
+
+	if len(found) != len(expected) {
+		t.Errorf("Expected %q, found %q", expected, found)
+		return
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Errorf("Expected %q, found %q", expected, found)
+			break
+		}
+	}
+}
+
+func Test_Validate_geo(t *testing.T) {
+	// the geographic operators
+	textConstraintLanguagePlugin := NewTextConstraintLanguagePlugin()
+	constraintStrings := []string{
+		"location within 10km of (41.0064,-111.9393)",
+		"location within 2.5 km of ( -33.87 , 151.21 ) && cpu > 2",
+		"location inside [(41.1,-112.0),(41.1,-111.8),(40.9,-111.8),(40.9,-112.0)] || location within 50km of (40.7,-74.0)",
+		"(location inside [ (1,1), (1,2), (2,2) ])",
+		"inside_temp > 20 && within == true",
+	}
+
+	for _, c := range constraintStrings {
+		if validated, _, err := textConstraintLanguagePlugin.Validate([]string{c}); !validated || err != nil {
+			t.Errorf("%v should validate successfully but not, err: %v", c, err)
+		}
+	}
+
+	failedStrings := []string{
+		"location within (41.0064,-111.9393)",
+		"location within 10km of (91.0,-111.9393)",
+		"location within [(1,1),(1,2),(2,2)]",
+		"location inside 10km of (41.0064,-111.9393)",
+		"location inside [(1,1),(1,2)]",
+		"location == 10km of (41.0064,-111.9393)",
+		"location in [(1,1),(1,2),(2,2)]",
+	}
+
+	for _, c := range failedStrings {
+		if validated, _, err := textConstraintLanguagePlugin.Validate([]string{c}); validated || err == nil {
+			t.Errorf("Validation of %v should fail but did not", c)
+		}
+	}
+}
+
+func Test_GetNextExpression_geo(t *testing.T) {
+	textConstraintLanguagePlugin := NewTextConstraintLanguagePlugin()
+	ce := "location within 10 km of (41.0064,-111.9393) AND location inside [(1,1),(1,2),(2,2)]"
+
+	if exp, rem, err := textConstraintLanguagePlugin.GetNextExpression(ce); err != nil {
+		t.Errorf("Error parsing constraint expression %v with GetNextExpression: %v", ce, err)
+	} else if exp != "location\awithin\a10 km of (41.0064,-111.9393)" {
+		t.Errorf("Expected the circle expression, found %q", exp)
+	} else if op, rem, err := textConstraintLanguagePlugin.GetNextOperator(rem); err != nil || op != "AND" {
+		t.Errorf("Expected AND, found %q, error: %v", op, err)
+	} else if exp, _, err := textConstraintLanguagePlugin.GetNextExpression(rem); err != nil {
+		t.Errorf("Error parsing constraint expression %v with GetNextExpression: %v", rem, err)
+	} else if exp != "location\ainside\a[(1,1),(1,2),(2,2)]" {
+		t.Errorf("Expected the polygon expression, found %q", exp)
+	}
+}
+
+func Test_Validate_datetime(t *testing.T) {
+	// the datetime and duration comparisons
+	textConstraintLanguagePlugin := NewTextConstraintLanguagePlugin()
+	constraintStrings := []string{
+		"certExpiry > now+30d",
+		"installedAt < 2026-01-01 && cpu > 2",
+		"installedAt >= 2026-01-01T10:30:00Z || installedAt == 2025-12-31T23:00:00.5-01:00",
+		"(lastSeen > now-12h) AND uptime >= 1h30m",
+		"startedAt <= now && timeout != 1.5d",
+	}
+
+	for _, c := range constraintStrings {
+		if validated, _, err := textConstraintLanguagePlugin.Validate([]string{c}); !validated || err != nil {
+			t.Errorf("%v should validate successfully but not, err: %v", c, err)
+		}
+	}
+
+	failedStrings := []string{
+		"certExpiry > now+30",
+		"certExpiry > now--30d",
+		"installedAt < 2026-13-01",
+		"installedAt in 2026-01-01",
+		"uptime startswith 1h",
+		"installedAt > yesterday",
+	}
+
+	for _, c := range failedStrings {
+		if validated, _, err := textConstraintLanguagePlugin.Validate([]string{c}); validated || err == nil {
+			t.Errorf("Validation of %v should fail but did not", c)
+		}
+	}
+}
+
+func Test_GetNextExpression_datetime(t *testing.T) {
+	textConstraintLanguagePlugin := NewTextConstraintLanguagePlugin()
+	ce := "installedAt < 2026-01-01T10:30:00+02:00 && uptime > 1h30m"
+
+	if exp, rem, err := textConstraintLanguagePlugin.GetNextExpression(ce); err != nil {
+		t.Errorf("Error parsing constraint expression %v with GetNextExpression: %v", ce, err)
+	} else if exp != "installedAt\a<\a2026-01-01T10:30:00+02:00" {
+		t.Errorf("Expected the datetime expression, found %q", exp)
+	} else if op, rem, err := textConstraintLanguagePlugin.GetNextOperator(rem); err != nil || op != "&&" {
+		t.Errorf("Expected &&, found %q, error: %v", op, err)
+	} else if exp, _, err := textConstraintLanguagePlugin.GetNextExpression(rem); err != nil {
+		t.Errorf("Error parsing constraint expression %v with GetNextExpression: %v", rem, err)
+	} else if exp != "uptime\a>\a1h30m" {
+		t.Errorf("Expected the duration expression, found %q", exp)
+	}
+}
@@ -9,12 +9,16 @@ import (
 	"github.com/open-horizon/anax/agreementbot"
 	agbotPersistence "github.com/open-horizon/anax/agreementbot/persistence"
 	_ "github.com/open-horizon/anax/agreementbot/persistence/bolt"
+	_ "github.com/open-horizon/anax/agreementbot/persistence/memory"
 	_ "github.com/open-horizon/anax/agreementbot/persistence/postgresql"
+	_ "github.com/open-horizon/anax/agreementbot/persistence/sqlite"
 	"github.com/open-horizon/anax/api"
 	"github.com/open-horizon/anax/changes"
 	"github.com/open-horizon/anax/config"
 	"github.com/open-horizon/anax/container"
 	"github.com/open-horizon/anax/exchange"
+	"github.com/open-horizon/anax/externalpolicy"
+	_ "github.com/open-horizon/anax/externalpolicy/json_language"
 	_ "github.com/open-horizon/anax/externalpolicy/text_language"
 	"github.com/open-horizon/anax/governance"
 	"github.com/open-horizon/anax/i18n"
@@ -144,6 +148,12 @@ func main() {
 		pm = policyManager
 	}
 
+	// The location of the node comes from the location attribute, or the node location file if there is no attribute.
+	if db != nil {
+		externalpolicy.AddNodeLocationSource(func() (string, error) { return persistence.FindNodeLocation(db) })
+		externalpolicy.AddNodeLocationSource(externalpolicy.NodeLocationFromFile(cfg.Edge.NodeLocationFile))
+	}
+
 	// Initialize the shared authentication manager for service containers to authentication to the agent.
 	authm := resource.NewAuthenticationManager(cfg.GetFileSyncServiceAuthPath())
 
@@ -0,0 +1,343 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A minimal implementation of metrics in the Prometheus text exposition format (version 0.0.4). Metrics are grouped into
+// families, each family has a name, a help string, a type and a set of samples that are distinguished by their labels.
+// Collectors produce families when the metrics are scraped. Counters, gauges and histograms are collectors that keep
+// their values in memory, a CollectorFunc can compute its families from the state of the system at scrape time.
+
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	COUNTER   = "counter"
+	GAUGE     = "gauge"
+	HISTOGRAM = "histogram"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Suffix string  // appended to the family name, used by histograms for _bucket, _sum and _count
+	Labels []Label // the labels of the sample, in the order they are written
+	Value  float64
+}
+
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Add a sample with the given label names and values.
+func (f *Family) Add(value float64, labelNames []string, labelValues ...string) {
+	f.Samples = append(f.Samples, Sample{Labels: makeLabels(labelNames, labelValues), Value: value})
+}
+
+func NewFamily(name string, help string, familyType string) *Family {
+	return &Family{Name: name, Help: help, Type: familyType, Samples: make([]Sample, 0)}
+}
+
+type Collector interface {
+	Collect() []*Family
+}
+
+// A function that computes families when the metrics are scraped.
+type CollectorFunc func() []*Family
+
+func (c CollectorFunc) Collect() []*Family {
+	return c()
+}
+
+func makeLabels(labelNames []string, labelValues []string) []Label {
+	labels := make([]Label, 0, len(labelNames))
+	for ix, name := range labelNames {
+		value := ""
+		if ix < len(labelValues) {
+			value = labelValues[ix]
+		}
+		labels = append(labels, Label{Name: name, Value: value})
+	}
+	return labels
+}
+
+// A vector of values keyed by their label values. It is the state behind counters and gauges.
+type valueVec struct {
+	lock       sync.Mutex
+	name       string
+	help       string
+	labelNames []string
+	values     map[string]float64
+	labels     map[string][]string
+}
+
+func newValueVec(name string, help string, labelNames []string) valueVec {
+	return valueVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     make(map[string]float64),
+		labels:     make(map[string][]string),
+	}
+}
+
+func (v *valueVec) update(labelValues []string, fn func(float64) float64) {
+	key := strings.Join(labelValues, "\xff")
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if _, ok := v.labels[key]; !ok {
+		v.labels[key] = append([]string{}, labelValues...)
+	}
+	v.values[key] = fn(v.values[key])
+}
+
+func (v *valueVec) collect(familyType string) []*Family {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	f := NewFamily(v.name, v.help, familyType)
+	for _, key := range sortedKeys(v.labels) {
+		f.Add(v.values[key], v.labelNames, v.labels[key]...)
+	}
+	return []*Family{f}
+}
+
+// A counter only goes up.
+type CounterVec struct {
+	valueVec
+}
+
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{newValueVec(name, help, labelNames)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.update(labelValues, func(old float64) float64 { return old + delta })
+}
+
+func (c *CounterVec) Collect() []*Family {
+	return c.collect(COUNTER)
+}
+
+// A gauge can be set to any value.
+type GaugeVec struct {
+	valueVec
+}
+
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{newValueVec(name, help, labelNames)}
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return value })
+}
+
+func (g *GaugeVec) Collect() []*Family {
+	return g.collect(GAUGE)
+}
+
+// The default histogram buckets, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64 // the number of observations in each bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// A histogram counts observations in buckets, and keeps their sum and count.
+type HistogramVec struct {
+	lock       sync.Mutex
+	name       string
+	help       string
+	buckets    []float64
+	labelNames []string
+	histograms map[string]*histogram
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{
+		name:       name,
+		help:       help,
+		buckets:    sorted,
+		labelNames: labelNames,
+		histograms: make(map[string]*histogram),
+	}
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	hist, ok := h.histograms[key]
+	if !ok {
+		hist = &histogram{labelValues: append([]string{}, labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.histograms[key] = hist
+	}
+	if ix := sort.SearchFloat64s(h.buckets, value); ix < len(h.buckets) {
+		hist.counts[ix] += 1
+	}
+	hist.count += 1
+	hist.sum += value
+}
+
+func (h *HistogramVec) Collect() []*Family {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	f := NewFamily(h.name, h.help, HISTOGRAM)
+	keys := make([]string, 0, len(h.histograms))
+	for key := range h.histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hist := h.histograms[key]
+		labels := makeLabels(h.labelNames, hist.labelValues)
+		cumulative := uint64(0)
+		for ix, le := range h.buckets {
+			cumulative += hist.counts[ix]
+			f.Samples = append(f.Samples, Sample{Suffix: "_bucket", Labels: append(append([]Label{}, labels...), Label{"le", formatFloat(le)}), Value: float64(cumulative)})
+		}
+		f.Samples = append(f.Samples, Sample{Suffix: "_bucket", Labels: append(append([]Label{}, labels...), Label{"le", "+Inf"}), Value: float64(hist.count)})
+		f.Samples = append(f.Samples, Sample{Suffix: "_sum", Labels: labels, Value: hist.sum})
+		f.Samples = append(f.Samples, Sample{Suffix: "_count", Labels: labels, Value: float64(hist.count)})
+	}
+	return []*Family{f}
+}
+
+// The registry holds the collectors of each owner, usually a worker. The collectors of an owner are removed together,
+// when the owner goes away.
+type Registry struct {
+	lock       sync.Mutex
+	collectors map[string][]Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string][]Collector)}
+}
+
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) Register(owner string, c Collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors[owner] = append(r.collectors[owner], c)
+}
+
+func (r *Registry) Unregister(owner string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.collectors, owner)
+}
+
+// Collect the families of all the collectors, sorted by name. Families with the same name are merged.
+func (r *Registry) Gather() []*Family {
+	r.lock.Lock()
+	collectors := make([]Collector, 0)
+	for _, cs := range r.collectors {
+		collectors = append(collectors, cs...)
+	}
+	r.lock.Unlock()
+
+	byName := make(map[string]*Family)
+	for _, c := range collectors {
+		for _, f := range c.Collect() {
+			if existing, ok := byName[f.Name]; ok {
+				existing.Samples = append(existing.Samples, f.Samples...)
+			} else {
+				byName[f.Name] = f
+			}
+		}
+	}
+
+	families := make([]*Family, 0, len(byName))
+	for _, f := range byName {
+		families = append(families, f)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// Write all the metrics in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.Gather() {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "# HELP %v %v\n", f.Name, escapeHelp(f.Help))
+		fmt.Fprintf(bw, "# TYPE %v %v\n", f.Name, f.Type)
+		for _, s := range f.Samples {
+			fmt.Fprintf(bw, "%v%v%v %v\n", f.Name, s.Suffix, labelString(s.Labels), formatFloat(s.Value))
+		}
+	}
+	return bw.Flush()
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func labelString(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, fmt.Sprintf("%v=\"%v\"", l.Name, escapeLabelValue(l.Value)))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelValueEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+var helpEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func escapeHelp(h string) string {
+	return helpEscaper.Replace(h)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,91 @@
+// +build unit
+
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_WriteText(t *testing.T) {
+
+	r := NewRegistry()
+
+	c := NewCounterVec("test_requests_total", "The number of requests.", "method")
+	c.Inc("GET")
+	c.Add(2, "GET")
+	c.Inc("POST")
+	c.Add(-1, "POST")
+
+	g := NewGaugeVec("test_depth", "The depth of a \"queue\".", "name")
+	g.Set(7, "a\"b")
+
+	h := NewHistogramVec("test_duration_seconds", "A duration.", []float64{1, 0.1}, "type")
+	h.Observe(0.05, "x")
+	h.Observe(0.5, "x")
+	h.Observe(5, "x")
+
+	r.Register("owner1", c)
+	r.Register("owner1", g)
+	r.Register("owner2", h)
+	r.Register("owner2", CollectorFunc(func() []*Family {
+		f := NewFamily("test_func", "Computed at scrape time.", GAUGE)
+		f.Add(1.5, nil)
+		return []*Family{f}
+	}))
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("unexpected error writing metrics: %v", err)
+	}
+
+	expected := `# HELP test_depth The depth of a "queue".
+# TYPE test_depth gauge
+test_depth{name="a\"b"} 7
+# HELP test_duration_seconds A duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{type="x",le="0.1"} 1
+test_duration_seconds_bucket{type="x",le="1"} 2
+test_duration_seconds_bucket{type="x",le="+Inf"} 3
+test_duration_seconds_sum{type="x"} 5.55
+test_duration_seconds_count{type="x"} 3
+# HELP test_func Computed at scrape time.
+# TYPE test_func gauge
+test_func 1.5
+# HELP test_requests_total The number of requests.
+# TYPE test_requests_total counter
+test_requests_total{method="GET"} 3
+test_requests_total{method="POST"} 1
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected metrics output:\n%v\nexpected:\n%v", buf.String(), expected)
+	}
+
+	// The collectors of an owner are removed together.
+	r.Unregister("owner2")
+	buf.Reset()
+	r.WriteText(&buf)
+	if strings.Contains(buf.String(), "test_duration_seconds") || strings.Contains(buf.String(), "test_func") {
+		t.Errorf("expected the collectors of owner2 to be removed, got:\n%v", buf.String())
+	} else if !strings.Contains(buf.String(), "test_depth") {
+		t.Errorf("expected the collectors of owner1 to remain, got:\n%v", buf.String())
+	}
+}
+
+func Test_Gather_merges_families(t *testing.T) {
+
+	r := NewRegistry()
+	for _, owner := range []string{"a", "b"} {
+		name := owner
+		r.Register(owner, CollectorFunc(func() []*Family {
+			f := NewFamily("test_shared", "Reported by two collectors.", GAUGE)
+			f.Add(1, []string{"owner"}, name)
+			return []*Family{f}
+		}))
+	}
+
+	if families := r.Gather(); len(families) != 1 || len(families[0].Samples) != 2 {
+		t.Errorf("expected one family with 2 samples, got %v", families)
+	}
+}
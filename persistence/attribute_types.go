@@ -2,6 +2,7 @@ package persistence
 
 import (
 	"fmt"
+	"github.com/open-horizon/anax/externalpolicy/geo"
 )
 
 type HAAttributes struct {
@@ -210,6 +211,51 @@ func (a HTTPSBasicAuthAttributes) Update(other Attribute) error {
 	return nil
 }
 
+// The location of the node, it is published in the node policy as the openhorizon.location built-in property.
+type LocationAttributes struct {
+	Meta               *AttributeMeta `json:"meta"`
+	Lat                float64        `json:"lat"`
+	Lon                float64        `json:"lon"`
+	LocationAccuracyKM float64        `json:"location_accuracy_km"`
+}
+
+func (a LocationAttributes) String() string {
+	return fmt.Sprintf("meta: %v, lat: %v, lon: %v, location_accuracy_km: %v", a.GetMeta(), a.Lat, a.Lon, a.LocationAccuracyKM)
+}
+
+func (a LocationAttributes) GetMeta() *AttributeMeta {
+	return a.Meta
+}
+
+func (a LocationAttributes) GetGenericMappings() map[string]interface{} {
+	return map[string]interface{}{
+		"lat":                  a.Lat,
+		"lon":                  a.Lon,
+		"location_accuracy_km": a.LocationAccuracyKM,
+	}
+}
+
+func (a LocationAttributes) Update(other Attribute) error {
+	switch other.(type) {
+	case *LocationAttributes:
+		o := other.(*LocationAttributes)
+		a.GetMeta().Update(*o.GetMeta())
+
+		a.Lat = o.Lat
+		a.Lon = o.Lon
+		a.LocationAccuracyKM = o.LocationAccuracyKM
+	default:
+		return fmt.Errorf("Concrete type of attribute (%T) provided to Update() is incompatible with this Attribute's type (%T)", a, other)
+	}
+
+	return nil
+}
+
+// Returns the location in the format of the geo property type.
+func (a LocationAttributes) GetLocation() geo.Location {
+	return geo.Location{Point: geo.Point{Lat: a.Lat, Lon: a.Lon}, AccuracyKM: a.LocationAccuracyKM}
+}
+
 type Auth struct {
 	Registry string `json:"registry"`
 	UserName string `json:"username"` // The name of the user, the default is 'token'
@@ -228,8 +228,17 @@ func HydrateConcreteAttribute(v []byte) (Attribute, error) {
 		}
 		attr = dra
 
+	case "LocationAttributes":
+		var la LocationAttributes
+		if err := json.Unmarshal(v, &la); err != nil {
+			// location attributes saved by old versions of anax are ignored
+			glog.Warningf("Ignoring location attribute that cannot be deserialized: %v", err)
+			return nil, nil
+		}
+		attr = la
+
 		// for backward compatibility
-	case "LocationAttributes", "ArchitectureAttributes", "ComputeAttributes", "PropertyAttributes":
+	case "ArchitectureAttributes", "ComputeAttributes", "PropertyAttributes":
 		return nil, nil
 
 	default:
@@ -309,6 +318,22 @@ func FindApplicableAttributes(db *bolt.DB, serviceUrl string, org string) ([]Att
 	})
 }
 
+// Returns the location of the node from the node wide location attribute, in the format of the geo property type. An
+// empty string is returned if there is no location attribute.
+func FindNodeLocation(db *bolt.DB) (string, error) {
+	attrs, err := FindApplicableAttributes(db, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	for _, attr := range attrs {
+		if la, ok := attr.(LocationAttributes); ok {
+			return la.GetLocation().String(), nil
+		}
+	}
+	return "", nil
+}
+
 // This function is used to convert the persistent attributes for a service to an env var map.
 // This will include *all* values for which HostOnly is false, include those marked to not publish.
 func AttributesToEnvvarMap(attributes []Attribute, envvars map[string]string, prefix string, defaultRAM int64, nodePol *externalpolicy.ExternalPolicy, isCluster bool) (map[string]string, error) {
@@ -390,6 +415,9 @@ func AttributesToEnvvarMap(attributes []Attribute, envvars map[string]string, pr
 		case AgreementProtocolAttributes:
 			// Nothing to do
 
+		case LocationAttributes:
+			// Nothing to do, the location is in the built-in properties
+
 		default:
 			return nil, fmt.Errorf("Unhandled service attribute: %v", serv)
 		}
@@ -236,6 +236,29 @@ func Are_Compatible(producer_policy *Policy, consumer_policy *Policy, msgPrinter
 	return nil
 }
 
+// The evaluation of the constraints on both sides of Are_Compatible, it shows why the properties of one side do or do not
+// satisfy the constraints of the other side.
+type CompatibilityTrace struct {
+	ConsumerConstraints *externalpolicy.ConstraintTrace `json:"consumer_constraints"` // The consumer constraints evaluated against the producer properties.
+	ProducerConstraints *externalpolicy.ConstraintTrace `json:"producer_constraints"` // The producer constraints evaluated against the consumer properties.
+}
+
+func (t CompatibilityTrace) String() string {
+	return fmt.Sprintf("ConsumerConstraints:\n%v\nProducerConstraints:\n%v", t.ConsumerConstraints, t.ProducerConstraints)
+}
+
+// This function explains the constraint part of Are_Compatible. The order of parameters is the same as Are_Compatible.
+func Explain_Compatibility(producer_policy *Policy, consumer_policy *Policy) (*CompatibilityTrace, error) {
+	trace := new(CompatibilityTrace)
+	var err error
+	if trace.ConsumerConstraints, err = (&consumer_policy.Constraints).Explain(producer_policy.Properties); err != nil {
+		return nil, errors.New(fmt.Sprintf("Unable to explain the constraints %v, error: %v", consumer_policy.Constraints, err))
+	} else if trace.ProducerConstraints, err = (&producer_policy.Constraints).Explain(consumer_policy.Properties); err != nil {
+		return nil, errors.New(fmt.Sprintf("Unable to explain the constraints %v, error: %v", producer_policy.Constraints, err))
+	}
+	return trace, nil
+}
+
 // This function will select an agreement protocol to pursue based on the input policies. This function
 // assumes that the input policies are compatible.
 func Select_Protocol(producer_policy *Policy, consumer_policy *Policy) string {
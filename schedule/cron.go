@@ -0,0 +1,158 @@
+package schedule
+
+import (
+	"errors"
+	"github.com/open-horizon/anax/i18n"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A parsed cron expression. Each field is a bit set of the values that match.
+type cronExpr struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool // the day of month field is '*'
+	dowStar bool // the day of week field is '*'
+}
+
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCron(expr string) (*cronExpr, error) {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, errors.New(msgPrinter.Sprintf("cron expression %v must have %v fields", expr, len(cronFields)))
+	}
+
+	sets := make([]uint64, len(cronFields))
+	for ix, f := range fields {
+		if set, err := parseCronField(f, cronFields[ix]); err != nil {
+			return nil, errors.New(msgPrinter.Sprintf("cron expression %v: %v", expr, err))
+		} else {
+			sets[ix] = set
+		}
+	}
+
+	// Sunday can be 0 or 7.
+	dow := sets[4]
+	if dow&(1<<7) != 0 {
+		dow |= 1
+	}
+
+	return &cronExpr{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     dow,
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// Parse one field of a cron expression into the set of values it matches.
+func parseCronField(field string, cf cronField) (uint64, error) {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	set := uint64(0)
+	for _, part := range strings.Split(field, ",") {
+
+		rng, step := part, 1
+		if ix := strings.Index(part, "/"); ix != -1 {
+			rng = part[:ix]
+			if s, err := strconv.Atoi(part[ix+1:]); err != nil || s <= 0 {
+				return 0, errors.New(msgPrinter.Sprintf("invalid step in %v field %v", cf.name, part))
+			} else {
+				step = s
+			}
+		}
+
+		low, high := cf.min, cf.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.New(msgPrinter.Sprintf("invalid value in %v field %v", cf.name, part))
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, errors.New(msgPrinter.Sprintf("invalid value in %v field %v", cf.name, part))
+				}
+			} else if step != 1 {
+				// A single value with a step runs to the end of the range, as in cron.
+				high = cf.max
+			}
+		}
+
+		if low < cf.min || high > cf.max || low > high {
+			return 0, errors.New(msgPrinter.Sprintf("%v field %v is outside the range %v-%v", cf.name, part, cf.min, cf.max))
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (c *cronExpr) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Returns true when the minute of t is a time at which the expression fires.
+func (c *cronExpr) matches(t time.Time) bool {
+	return c.month&(1<<uint(t.Month())) != 0 &&
+		c.dayMatches(t) &&
+		c.hour&(1<<uint(t.Hour())) != 0 &&
+		c.minute&(1<<uint(t.Minute())) != 0
+}
+
+// Returns the first minute at or after start and before end when the expression fires, or the zero time if there
+// is none. Days and hours that do not match are skipped as a whole.
+func (c *cronExpr) next(start time.Time, end time.Time) time.Time {
+
+	t := start
+	loc := t.Location()
+	for t.Before(end) {
+		if c.month&(1<<uint(t.Month())) == 0 || !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		} else if c.hour&(1<<uint(t.Hour())) == 0 {
+			n := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if !n.After(t) {
+				// The clock moved back during this hour, move forward a minute at a time.
+				n = t.Add(time.Minute)
+			}
+			t = n
+		} else if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+		} else {
+			return t
+		}
+	}
+	return time.Time{}
+}
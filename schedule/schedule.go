@@ -0,0 +1,224 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"github.com/open-horizon/anax/i18n"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A maintenance schedule restricts when work that disrupts a node is done. The agbot only forms new agreements for a
+// deployment policy or pattern while one of its agreement windows is open, and it only cancels agreements in order to
+// upgrade the service while one of its upgrade windows is open. Each window starts at the times given by a cron
+// expression and stays open for the given number of minutes. A schedule without windows of a given kind does not
+// restrict that kind of work.
+//
+// The cron expression has the usual 5 fields: minute (0-59), hour (0-23), day of month (1-31), month (1-12) and
+// day of week (0-7, 0 and 7 are Sunday). Each field is a '*', a number, a range (a-b) or a comma separated list of
+// numbers and ranges, and a range or '*' can be followed by a step (/n). As in cron, when both the day of month and
+// the day of week are restricted, a day matches if either field matches.
+
+const MAX_WINDOW_MINUTES = 7 * 24 * 60
+
+// The longest time to look ahead for the next window to open.
+const MAX_LOOKAHEAD = 366 * 24 * time.Hour
+
+type Window struct {
+	Cron      string `json:"cron"`            // when the window opens, a 5 field cron expression
+	DurationM int    `json:"durationMinutes"` // how long the window stays open, in minutes
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("Cron: %v, DurationM: %v", w.Cron, w.DurationM)
+}
+
+type MaintenanceSchedule struct {
+	TimeZone         string   `json:"timezone,omitempty"`         // the IANA time zone of the cron expressions, the default is UTC
+	AgreementWindows []Window `json:"agreementWindows,omitempty"` // when new agreements can be formed, any time when empty
+	UpgradeWindows   []Window `json:"upgradeWindows,omitempty"`   // when agreements can be cancelled to upgrade the service, any time when empty
+}
+
+func (s MaintenanceSchedule) String() string {
+	return fmt.Sprintf("TimeZone: %v, AgreementWindows: %v, UpgradeWindows: %v",
+		s.TimeZone,
+		s.AgreementWindows,
+		s.UpgradeWindows)
+}
+
+func (s *MaintenanceSchedule) DeepCopy() *MaintenanceSchedule {
+	if s == nil {
+		return nil
+	}
+	newSchedule := MaintenanceSchedule{TimeZone: s.TimeZone}
+	if s.AgreementWindows != nil {
+		newSchedule.AgreementWindows = make([]Window, len(s.AgreementWindows))
+		copy(newSchedule.AgreementWindows, s.AgreementWindows)
+	}
+	if s.UpgradeWindows != nil {
+		newSchedule.UpgradeWindows = make([]Window, len(s.UpgradeWindows))
+		copy(newSchedule.UpgradeWindows, s.UpgradeWindows)
+	}
+	return &newSchedule
+}
+
+// Verify that the time zone and all the windows are valid.
+func (s *MaintenanceSchedule) Validate() error {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if _, err := s.location(); err != nil {
+		return errors.New(msgPrinter.Sprintf("invalid timezone %v: %v", s.TimeZone, err))
+	}
+	for _, w := range s.AgreementWindows {
+		if err := w.Validate(); err != nil {
+			return errors.New(msgPrinter.Sprintf("invalid agreement window: %v", err))
+		}
+	}
+	for _, w := range s.UpgradeWindows {
+		if err := w.Validate(); err != nil {
+			return errors.New(msgPrinter.Sprintf("invalid upgrade window: %v", err))
+		}
+	}
+	return nil
+}
+
+func (w Window) Validate() error {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	if _, err := parseCron(w.Cron); err != nil {
+		return err
+	} else if w.DurationM <= 0 || w.DurationM > MAX_WINDOW_MINUTES {
+		return errors.New(msgPrinter.Sprintf("durationMinutes must be between 1 and %v, it is %v", MAX_WINDOW_MINUTES, w.DurationM))
+	}
+	return nil
+}
+
+// Returns true when new agreements can be formed at the given time.
+func (s *MaintenanceSchedule) AgreementsAllowed(t time.Time) bool {
+	return s == nil || s.isOpen(s.AgreementWindows, t)
+}
+
+// Returns true when agreements can be cancelled to upgrade the service at the given time.
+func (s *MaintenanceSchedule) UpgradesAllowed(t time.Time) bool {
+	return s == nil || s.isOpen(s.UpgradeWindows, t)
+}
+
+// Returns the time at or after t when new agreements can be formed. The zero time is returned when no window opens
+// within a year.
+func (s *MaintenanceSchedule) NextAgreementWindow(t time.Time) time.Time {
+	if s == nil {
+		return t
+	}
+	return s.nextOpen(s.AgreementWindows, t)
+}
+
+// Returns the time at or after t when agreements can be cancelled to upgrade the service. The zero time is returned
+// when no window opens within a year.
+func (s *MaintenanceSchedule) NextUpgradeWindow(t time.Time) time.Time {
+	if s == nil {
+		return t
+	}
+	return s.nextOpen(s.UpgradeWindows, t)
+}
+
+func (s *MaintenanceSchedule) location() (*time.Location, error) {
+	if s.TimeZone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(s.TimeZone)
+}
+
+// A window is open at t if it opened within its duration before t. Invalid windows are never open, they are rejected
+// when the schedule is validated.
+func (s *MaintenanceSchedule) isOpen(windows []Window, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+
+	loc, err := s.location()
+	if err != nil {
+		return false
+	}
+	now := t.In(loc).Truncate(time.Minute)
+
+	for _, w := range windows {
+		if c, err := parseCron(w.Cron); err == nil {
+			for m := 0; m < w.DurationM && m < MAX_WINDOW_MINUTES; m++ {
+				if c.matches(now.Add(-time.Duration(m) * time.Minute)) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (s *MaintenanceSchedule) nextOpen(windows []Window, t time.Time) time.Time {
+	if s.isOpen(windows, t) {
+		return t
+	}
+
+	loc, err := s.location()
+	if err != nil {
+		return time.Time{}
+	}
+	start := t.In(loc).Truncate(time.Minute).Add(time.Minute)
+
+	var next time.Time
+	for _, w := range windows {
+		if c, err := parseCron(w.Cron); err == nil {
+			if n := c.next(start, start.Add(MAX_LOOKAHEAD)); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+				next = n
+			}
+		}
+	}
+	return next
+}
+
+// Parse a maintenance window published as a node property. The value is a semicolon separated list of windows, each
+// one a cron expression followed by the duration in minutes, optionally preceded by a TZ=<zone> entry. For example,
+// "TZ=Europe/Paris; 0 2 * * 6 240" is open from 2am to 6am Paris time every Saturday. The windows apply to both new
+// agreements and upgrades.
+func ParseMaintenanceWindow(value string) (*MaintenanceSchedule, error) {
+
+	msgPrinter := i18n.GetMessagePrinter()
+
+	s := new(MaintenanceSchedule)
+	windows := make([]Window, 0, 2)
+	for ix, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		} else if strings.HasPrefix(entry, "TZ=") {
+			if ix != 0 {
+				return nil, errors.New(msgPrinter.Sprintf("the TZ entry must be first in maintenance window %v", value))
+			}
+			s.TimeZone = strings.TrimPrefix(entry, "TZ=")
+			continue
+		}
+
+		fields := strings.Fields(entry)
+		if len(fields) != 6 {
+			return nil, errors.New(msgPrinter.Sprintf("maintenance window %v must have a 5 field cron expression followed by a duration in minutes", entry))
+		}
+		duration, err := strconv.Atoi(fields[5])
+		if err != nil {
+			return nil, errors.New(msgPrinter.Sprintf("maintenance window %v has an invalid duration: %v", entry, err))
+		}
+		windows = append(windows, Window{Cron: strings.Join(fields[:5], " "), DurationM: duration})
+	}
+
+	if len(windows) == 0 {
+		return nil, errors.New(msgPrinter.Sprintf("maintenance window %v does not contain any windows", value))
+	}
+
+	s.AgreementWindows = windows
+	s.UpgradeWindows = windows
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
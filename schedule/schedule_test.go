@@ -0,0 +1,108 @@
+// +build unit
+
+package schedule
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_ParseCron(t *testing.T) {
+
+	valid := []string{"* * * * *", "0 2 * * 6", "*/15 1-5 1,15 * 1-5", "30 22 * 12 7", "5/20 0 * * *"}
+	for _, expr := range valid {
+		_, err := parseCron(expr)
+		assert.Nil(t, err, expr)
+	}
+
+	invalid := []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"}
+	for _, expr := range invalid {
+		_, err := parseCron(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func Test_Cron_Matches(t *testing.T) {
+
+	c, _ := parseCron("*/15 2 * * 6")
+	assert.True(t, c.matches(time.Date(2026, 10, 17, 2, 30, 0, 0, time.UTC)))  // a Saturday
+	assert.False(t, c.matches(time.Date(2026, 10, 17, 2, 31, 0, 0, time.UTC))) // not on a 15 minute mark
+	assert.False(t, c.matches(time.Date(2026, 10, 18, 2, 30, 0, 0, time.UTC))) // a Sunday
+
+	// Sunday can be written as 7.
+	c, _ = parseCron("0 0 * * 7")
+	assert.True(t, c.matches(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)))
+
+	// When both day fields are restricted, either one matches.
+	c, _ = parseCron("0 0 1 * 1")
+	assert.True(t, c.matches(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)))  // the 1st, a Thursday
+	assert.True(t, c.matches(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC))) // a Monday
+	assert.False(t, c.matches(time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)))
+}
+
+func Test_Schedule_Windows(t *testing.T) {
+
+	s := &MaintenanceSchedule{
+		TimeZone:         "America/New_York",
+		AgreementWindows: []Window{{Cron: "0 22 * * *", DurationM: 240}},
+	}
+	assert.Nil(t, s.Validate())
+
+	ny, _ := time.LoadLocation("America/New_York")
+
+	// The window runs from 10pm to 2am New York time, and crosses midnight.
+	assert.True(t, s.AgreementsAllowed(time.Date(2026, 10, 17, 23, 0, 0, 0, ny)))
+	assert.True(t, s.AgreementsAllowed(time.Date(2026, 10, 18, 1, 59, 0, 0, ny)))
+	assert.False(t, s.AgreementsAllowed(time.Date(2026, 10, 18, 2, 0, 0, 0, ny)))
+	assert.False(t, s.AgreementsAllowed(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)))
+
+	// No upgrade windows means upgrades are always allowed.
+	assert.True(t, s.UpgradesAllowed(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)))
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, ny)
+	assert.Equal(t, time.Date(2026, 10, 18, 22, 0, 0, 0, ny).Unix(), s.NextAgreementWindow(now).Unix())
+	assert.Equal(t, now, s.NextUpgradeWindow(now))
+
+	// An open window is reported as open now.
+	open := time.Date(2026, 10, 18, 23, 0, 0, 0, ny)
+	assert.Equal(t, open, s.NextAgreementWindow(open))
+
+	// A nil schedule does not restrict anything.
+	var none *MaintenanceSchedule
+	assert.True(t, none.AgreementsAllowed(now))
+	assert.True(t, none.UpgradesAllowed(now))
+}
+
+func Test_Schedule_Validate(t *testing.T) {
+
+	s := &MaintenanceSchedule{TimeZone: "Not/AZone"}
+	assert.NotNil(t, s.Validate())
+
+	s = &MaintenanceSchedule{UpgradeWindows: []Window{{Cron: "0 2 * * *", DurationM: 0}}}
+	assert.NotNil(t, s.Validate())
+
+	s = &MaintenanceSchedule{UpgradeWindows: []Window{{Cron: "0 2 * *", DurationM: 60}}}
+	assert.NotNil(t, s.Validate())
+
+	s = &MaintenanceSchedule{UpgradeWindows: []Window{{Cron: "0 2 * * *", DurationM: MAX_WINDOW_MINUTES + 1}}}
+	assert.NotNil(t, s.Validate())
+}
+
+func Test_ParseMaintenanceWindow(t *testing.T) {
+
+	s, err := ParseMaintenanceWindow("TZ=Europe/Paris; 0 2 * * 6 240; 30 1 1 * * 60")
+	assert.Nil(t, err)
+	assert.Equal(t, "Europe/Paris", s.TimeZone)
+	assert.Equal(t, []Window{{Cron: "0 2 * * 6", DurationM: 240}, {Cron: "30 1 1 * *", DurationM: 60}}, s.AgreementWindows)
+	assert.Equal(t, s.AgreementWindows, s.UpgradeWindows)
+
+	paris, _ := time.LoadLocation("Europe/Paris")
+	assert.True(t, s.AgreementsAllowed(time.Date(2026, 10, 17, 5, 59, 0, 0, paris)))
+	assert.False(t, s.UpgradesAllowed(time.Date(2026, 10, 17, 6, 0, 0, 0, paris)))
+
+	for _, value := range []string{"", "TZ=UTC", "0 2 * * 6", "0 2 * * 6 x", "0 2 * * 6 60; TZ=UTC", "TZ=Nowhere; 0 2 * * 6 60"} {
+		_, err := ParseMaintenanceWindow(value)
+		assert.NotNil(t, err, value)
+	}
+}
@@ -281,6 +281,7 @@ func (w *BaseWorker) HandleFrameworkCommands(command Command) (bool, bool) {
 		workerStatusManager.SetWorkerStatus(w.GetName(), STATUS_TERMINATING)
 		// If we can terminate, do it. Otherwise requeue the termination.
 		if w.AreAllSubworkersTerminated() {
+			w.unregisterCollectors()
 			w.Messages <- events.NewWorkerStopMessage(events.WORKER_STOP, w.GetName())
 			return true, true
 		} else {
@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"github.com/open-horizon/anax/metrics"
+)
+
+// Workers register the collectors for the metrics they own with the worker framework. The collectors of a worker are
+// removed when the worker terminates. The framework itself reports the status of every worker and subworker.
+
+const METRICS_OWNER = "WorkerFramework"
+
+func init() {
+	metrics.DefaultRegistry.Register(METRICS_OWNER, metrics.CollectorFunc(collectWorkerStatus))
+}
+
+func (w *BaseWorker) RegisterCollector(c metrics.Collector) {
+	metrics.DefaultRegistry.Register(w.GetName(), c)
+}
+
+func (w *BaseWorker) unregisterCollectors() {
+	metrics.DefaultRegistry.Unregister(w.GetName())
+}
+
+func collectWorkerStatus() []*metrics.Family {
+	workers := metrics.NewFamily("horizon_worker_status", "The status of each worker, the value is always 1.", metrics.GAUGE)
+	subworkers := metrics.NewFamily("horizon_subworker_status", "The status of each subworker, the value is always 1.", metrics.GAUGE)
+
+	wsm := GetWorkerStatusManager()
+	wsm.ManagerLock.Lock()
+	defer wsm.ManagerLock.Unlock()
+
+	for name, ws := range wsm.Workers {
+		ws.StatusLock.Lock()
+		workers.Add(1, []string{"worker", "status"}, name, ws.Status)
+		for subname, status := range ws.SubworkerStatus {
+			subworkers.Add(1, []string{"worker", "subworker", "status"}, name, subname, status)
+		}
+		ws.StatusLock.Unlock()
+	}
+	return []*metrics.Family{workers, subworkers}
+}